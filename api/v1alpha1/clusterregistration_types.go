@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ClusterRegistrationReady is true when every registration phase of the HostedCluster succeeded
+	ClusterRegistrationReady = "Ready"
+	// ClusterRegistrationFailed is true when the last registration attempt failed
+	ClusterRegistrationFailed = "Failed"
+)
+
+// ClusterRegistrationSpec references the HostedCluster of the registration
+type ClusterRegistrationSpec struct {
+	// HostedClusterName is the name of the HostedCluster in the namespace of the ClusterRegistration
+	HostedClusterName string `json:"hostedClusterName"`
+}
+
+// ClusterRegistrationStatus records where and how the HostedCluster is registered with ArgoCD
+type ClusterRegistrationStatus struct {
+	// GitOpsNamespace is the namespace of the ArgoCD instance the HostedCluster is registered to
+	GitOpsNamespace string `json:"gitOpsNamespace,omitempty"`
+	// SecretName is the name of the ArgoCD cluster secret in the gitops namespace
+	SecretName string `json:"secretName,omitempty"`
+	// GitOpsNamespaceCopies are the additional gitops namespaces a copy of the ArgoCD cluster secret was written to
+	GitOpsNamespaceCopies []string `json:"gitOpsNamespaceCopies,omitempty"`
+	// Server is the API server URL of the HostedCluster registered with ArgoCD
+	Server string `json:"server,omitempty"`
+	// TokenIssuedAt is the time the bearer token of the registration was issued, only known for bound tokens
+	TokenIssuedAt *metav1.Time `json:"tokenIssuedAt,omitempty"`
+	// TokenExpiresAt is the expiration of the bearer token, only known for bound tokens
+	TokenExpiresAt *metav1.Time `json:"tokenExpiresAt,omitempty"`
+	// Phase is the last registration phase that ran
+	Phase string `json:"phase,omitempty"`
+	// Conditions are the Ready and Failed conditions of the registration
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:shortName=creg
+//+kubebuilder:printcolumn:name="GitOps Namespace",type=string,JSONPath=`.status.gitOpsNamespace`
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretName`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterRegistration records the ArgoCD registration of the HostedCluster of the same name and namespace
+type ClusterRegistration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterRegistrationSpec   `json:"spec,omitempty"`
+	Status ClusterRegistrationStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterRegistrationList contains a list of ClusterRegistration
+type ClusterRegistrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterRegistration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterRegistration{}, &ClusterRegistrationList{})
+}
@@ -0,0 +1,476 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	cfg "sigs.k8s.io/controller-runtime/pkg/config/v1alpha1"
+)
+
+// RegistrationConfig configures how HostedClusters are registered with ArgoCD
+type RegistrationConfig struct {
+	// DefaultEnrollment decides whether HostedClusters without the enabled label are registered, one of enabled or
+	// disabled
+	DefaultEnrollment string `json:"defaultEnrollment,omitempty"`
+	// DuplicateServerWinner selects which HostedCluster keeps a server URL registered by several HostedClusters, one
+	// of oldest or newest. Hot reloadable.
+	DuplicateServerWinner string `json:"duplicateServerWinner,omitempty"`
+	// TerminalStatePolicy decides how HostedClusters in a terminal failure state are handled, one of retry, skip or
+	// deregister. Hot reloadable.
+	TerminalStatePolicy string `json:"terminalStatePolicy,omitempty"`
+	// HostedClusterRole is the ClusterRole bound to the service account of hyper-ops in the hosted clusters,
+	// cluster-admin by default. hyper-ops-gitops-deployer selects the bundled least-privilege role.
+	HostedClusterRole string `json:"hostedClusterRole,omitempty"`
+	// AuthMode decides how ArgoCD authenticates to the hosted clusters, serviceAccount (default) for a token of the
+	// hyper-ops service account, clientCertificate for the client certificate of the admin kubeconfig or
+	// awsExecProvider for argocd-k8s-auth aws on HostedClusters on AWS
+	AuthMode string `json:"authMode,omitempty"`
+	// AWSRoleName is the IAM role argocd-k8s-auth assumes in the AWS account of the HostedClusters with the
+	// awsExecProvider auth mode
+	AWSRoleName string `json:"awsRoleName,omitempty"`
+	// ClusterNameSource decides the name of the ArgoCD clusters, one of name (default), infraID or template
+	ClusterNameSource string `json:"clusterNameSource,omitempty"`
+	// ClusterNameTemplate is the text/template the names of the ArgoCD clusters are rendered from with the template
+	// cluster name source, executed with the Name, Namespace, InfraID and Labels of the HostedCluster
+	ClusterNameTemplate string `json:"clusterNameTemplate,omitempty"`
+	// SecretConflictPolicy decides what happens to an existing ArgoCD cluster secret not created by hyper-ops, one of
+	// skip (default), fail or adopt. Hot reloadable.
+	SecretConflictPolicy string `json:"secretConflictPolicy,omitempty"`
+	// UpgradePolicy decides how GitOps treats HostedClusters rolling out a new release, one of ignore (default), flag
+	// to label their ArgoCD cluster secrets or pause to also pause the sync of their root Application. Hot reloadable.
+	UpgradePolicy string `json:"upgradePolicy,omitempty"`
+	// TerminalStateTimeout is the time a HostedCluster may be in a terminal state before the deregister policy
+	// removes its registration. Hot reloadable.
+	TerminalStateTimeout *metav1.Duration `json:"terminalStateTimeout,omitempty"`
+	// AllowedGitOpsNamespaces restricts the gitops namespaces registrations may be written to
+	AllowedGitOpsNamespaces []string `json:"allowedGitOpsNamespaces,omitempty"`
+	// HostedClusterHeaders are added to every request against a hosted cluster. Hot reloadable.
+	HostedClusterHeaders map[string]string `json:"hostedClusterHeaders,omitempty"`
+	// DiscoveryLabels are added to the ArgoCD cluster secrets by gitops namespace, "*" applies to every namespace
+	DiscoveryLabels map[string]map[string]string `json:"discoveryLabels,omitempty"`
+	// Shards is the number of application controller shards the ArgoCD clusters are spread over by the namespace and
+	// name of their HostedCluster, the application controller assigns the shards if 0. The shard label of a
+	// HostedCluster overrides it.
+	Shards int `json:"shards,omitempty"`
+	// ClusterResources lets ArgoCD manage cluster scoped resources of namespace scoped clusters, false by default. The
+	// cluster-resources annotation of a HostedCluster overrides it.
+	ClusterResources *bool `json:"clusterResources,omitempty"`
+	// BoundTokens registers hosted clusters with TokenRequest issued tokens, true by default. false falls back to the
+	// deprecated legacy service account token secrets.
+	BoundTokens *bool `json:"boundTokens,omitempty"`
+	// LocalClusterInCluster registers the management cluster without credentials, ArgoCD uses its own service account
+	// and hyper-ops doesn't keep a token secret on the management cluster
+	LocalClusterInCluster *bool `json:"localClusterInCluster,omitempty"`
+	// TokenAudiences are consumers besides ArgoCD that get bound tokens of their own audience in separate secrets,
+	// they require BoundTokens
+	TokenAudiences []TokenAudience `json:"tokenAudiences,omitempty"`
+	// TopologyLabels adds NodePool topology labels to the ArgoCD cluster secrets
+	TopologyLabels *bool `json:"topologyLabels,omitempty"`
+	// WorkersLabel adds the workers label, false until a NodePool has nodes, to the ArgoCD cluster secrets
+	WorkersLabel *bool `json:"workersLabel,omitempty"`
+	// InfraClusterName is the name of the management cluster used in the topology labels of KubeVirt hosted clusters
+	InfraClusterName string `json:"infraClusterName,omitempty"`
+	// DeletionGracePeriod keeps deregistered ArgoCD cluster secrets, hidden from ArgoCD, for the period before they
+	// are deleted
+	DeletionGracePeriod *metav1.Duration `json:"deletionGracePeriod,omitempty"`
+	// EgressNetworkPolicies maintains NetworkPolicies in the gitops namespaces allowing the ArgoCD pods to reach the
+	// registered hosted clusters
+	EgressNetworkPolicies *bool `json:"egressNetworkPolicies,omitempty"`
+	// ClusterRegistrations maintains a ClusterRegistration resource recording the registration of every enrolled
+	// HostedCluster in its namespace
+	ClusterRegistrations *bool `json:"clusterRegistrations,omitempty"`
+	// OffboardHostedRBAC also removes the service account of hyper-ops from hosted clusters labeled enabled=false
+	OffboardHostedRBAC *bool `json:"offboardHostedRBAC,omitempty"`
+	// TenantRBAC maintains ArgoCD RBAC policies for the tenant groups of the HostedClusters
+	TenantRBAC *bool `json:"tenantRBAC,omitempty"`
+	// TenantScopedClusters scopes the ArgoCD clusters of HostedClusters with tenant groups to their tenant project,
+	// so only the AppProject of the tenant can deploy to them
+	TenantScopedClusters *bool `json:"tenantScopedClusters,omitempty"`
+	// ClusterAppProjects creates an AppProject deploying only to the registered clusters per HostedCluster (cluster)
+	// or per tenant project (tenant)
+	ClusterAppProjects string `json:"clusterAppProjects,omitempty"`
+	// SyncProjectDestinations keeps the destinations of the AppProjects named by the registrations in sync with them
+	SyncProjectDestinations *bool `json:"syncProjectDestinations,omitempty"`
+	// AgentPrincipalAddress is the host:port of the principal the agents of outbound-only HostedClusters dial
+	AgentPrincipalAddress string `json:"agentPrincipalAddress,omitempty"`
+	// AgentResourceProxyServer is the URL of the resource proxy of the principal
+	AgentResourceProxyServer string `json:"agentResourceProxyServer,omitempty"`
+	// AgentImage is the image of the agent installed into outbound-only HostedClusters
+	AgentImage string `json:"agentImage,omitempty"`
+	// PrivateClusterConnectivity is the connectivity of HostedClusters with private endpoint access and without a
+	// connectivity annotation, direct or outbound-only
+	PrivateClusterConnectivity string `json:"privateClusterConnectivity,omitempty"`
+	// StandaloneInstaller installs ArgoCD into HostedClusters in the standalone gitops mode through the OpenShift
+	// GitOps operator (openshift-gitops) or the upstream manifests (manifests)
+	StandaloneInstaller string `json:"standaloneInstaller,omitempty"`
+	// StandaloneChannel is the channel of the OpenShift GitOps operator subscription of standalone HostedClusters
+	StandaloneChannel string `json:"standaloneChannel,omitempty"`
+	// StandaloneManifestsURL are the ArgoCD install manifests applied to standalone HostedClusters
+	StandaloneManifestsURL string `json:"standaloneManifestsURL,omitempty"`
+	// BaselineManifestsConfigMap is the <namespace>/<name> of a ConfigMap on the hub whose manifests are applied into
+	// every HostedCluster after its registration
+	BaselineManifestsConfigMap string `json:"baselineManifestsConfigMap,omitempty"`
+	// BaselineManifestsOCIArtifact is the reference of an OCI artifact whose YAML layers are applied into every
+	// HostedCluster after its registration
+	BaselineManifestsOCIArtifact string `json:"baselineManifestsOCIArtifact,omitempty"`
+	// Policies are evaluated against every HostedCluster before its registration is written. Hot reloadable.
+	Policies []RegistrationPolicy `json:"policies,omitempty"`
+	// Quotas cap the number of registered HostedClusters per namespace or team label. Hot reloadable.
+	Quotas []RegistrationQuota `json:"quotas,omitempty"`
+	// ManageAdmissionPolicy maintains a ValidatingAdmissionPolicy enforcing the hyper-ops label contract
+	ManageAdmissionPolicy *bool `json:"manageAdmissionPolicy,omitempty"`
+	// GitOpsNamespaceRoutes route HostedClusters without the gitops namespace label into a gitops namespace by their
+	// labels, the first matching route wins
+	GitOpsNamespaceRoutes []GitOpsNamespaceRoute `json:"gitOpsNamespaceRoutes,omitempty"`
+	// DiscoverArgoCDInstances registers HostedClusters selecting ArgoCD instances into the namespaces of the ArgoCD
+	// CRs matching their selector
+	DiscoverArgoCDInstances *bool `json:"discoverArgoCDInstances,omitempty"`
+	// ArgoCDInstanceSelector selects the ArgoCD instances of HostedClusters without the gitops namespace label or an
+	// instance selector annotation, requires DiscoverArgoCDInstances
+	ArgoCDInstanceSelector *metav1.LabelSelector `json:"argoCDInstanceSelector,omitempty"`
+	// CIOutputs write the credentials of the registered hosted clusters in the formats of CI systems on the
+	// management cluster
+	CIOutputs []CIOutput `json:"ciOutputs,omitempty"`
+	// MaxCredentialAge flags registrations whose credential was not rotated for longer, e.g. because renewals kept
+	// failing, disabled if zero
+	MaxCredentialAge *metav1.Duration `json:"maxCredentialAge,omitempty"`
+	// QuarantineStaleCredentials withdraws registrations whose credential exceeded MaxCredentialAge until a newer
+	// credential is obtained
+	QuarantineStaleCredentials *bool `json:"quarantineStaleCredentials,omitempty"`
+	// Flux registers the hosted clusters with Flux besides ArgoCD
+	Flux *FluxConfig `json:"flux,omitempty"`
+	// RancherFleet registers the hosted clusters with Rancher Fleet besides ArgoCD
+	RancherFleet *RancherFleetConfig `json:"rancherFleet,omitempty"`
+	// ACM imports the hosted clusters into Advanced Cluster Management besides registering them with ArgoCD
+	ACM *ACMConfig `json:"acm,omitempty"`
+	// Karmada registers the hosted clusters with a Karmada control plane besides ArgoCD
+	Karmada *KarmadaConfig `json:"karmada,omitempty"`
+	// LabelSchema selects the schema of the hyper-ops labels written by the operator
+	LabelSchema *LabelSchemaConfig `json:"labelSchema,omitempty"`
+}
+
+// CIOutput writes a kubeconfig secret for every registered hosted cluster for a CI system
+type CIOutput struct {
+	// Type is the CI system, tekton or argo-workflows
+	Type string `json:"type"`
+	// Namespace the secrets are written to, the namespace the pipelines or workflows run in
+	Namespace string `json:"namespace"`
+}
+
+// FluxConfig writes a kubeconfig secret, a GitRepository and a Kustomization for every registered hosted cluster, so
+// Flux deploys to the hosted cluster with the credential hyper-ops obtained. URL, Branch and Path are text/templates
+// executed with the Name, Namespace, InfraID and Labels of the HostedCluster.
+type FluxConfig struct {
+	// Namespace the secrets, GitRepositories and Kustomizations are written to
+	Namespace string `json:"namespace"`
+	// URL of the git repository holding the manifests of the hosted clusters
+	URL string `json:"url"`
+	// Branch of the git repository, main if empty
+	Branch string `json:"branch,omitempty"`
+	// Path of the manifests of a hosted cluster in the git repository, clusters/{{ .Name }} if empty
+	Path string `json:"path,omitempty"`
+	// SecretRef names the secret in Namespace holding the credentials of the git repository
+	SecretRef string `json:"secretRef,omitempty"`
+	// Interval at which Flux reconciles the GitRepositories and Kustomizations, 10m if not set
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// RancherFleetConfig writes a kubeconfig secret, a fleet.cattle.io Cluster and a ClusterRegistrationToken for every
+// registered hosted cluster, so Fleet onboards the hosted cluster with the credential hyper-ops obtained
+type RancherFleetConfig struct {
+	// Workspace is the Fleet workspace, the namespace the Clusters are created in, e.g. fleet-default
+	Workspace string `json:"workspace"`
+	// RegistrationTokenTTL is the time to live of the ClusterRegistrationTokens, 24h if not set
+	RegistrationTokenTTL *metav1.Duration `json:"registrationTokenTTL,omitempty"`
+}
+
+// ACMConfig creates a ManagedCluster and an auto-import secret for every registered hosted cluster, so ACM imports
+// the hosted cluster with the credential hyper-ops obtained
+type ACMConfig struct {
+	// ClusterSet adds the ManagedClusters to the ManagedClusterSet, the default cluster set of ACM if empty
+	ClusterSet string `json:"clusterSet,omitempty"`
+	// AutoImportRetry is the number of times ACM retries a failed import, 5 if not set
+	AutoImportRetry *int32 `json:"autoImportRetry,omitempty"`
+}
+
+// KarmadaConfig writes a cluster secret and a cluster.karmada.io Cluster in push mode for every registered hosted
+// cluster, so Karmada distributes workloads to the hosted cluster with the credential hyper-ops obtained
+type KarmadaConfig struct {
+	// KubeconfigSecret is the <namespace>/<name> secret holding the kubeconfig of the Karmada API server in its
+	// kubeconfig key
+	KubeconfigSecret string `json:"kubeconfigSecret"`
+	// Namespace of the Karmada control plane the cluster secrets are written to, karmada-cluster if empty
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// LabelSchemaConfig selects the schema the hyper-ops labels are written in, labels of every schema are read
+type LabelSchemaConfig struct {
+	// Version is the schema the labels are written in, v1 or v2, v1 if empty
+	Version string `json:"version,omitempty"`
+	// KeepPrevious also writes the labels of the previous schema while label selectors are moved to the new one
+	KeepPrevious *bool `json:"keepPrevious,omitempty"`
+	// MigrationInterval is the interval at which the labels of the existing ArgoCD cluster secrets are rewritten in
+	// the schema, disabled if zero
+	MigrationInterval *metav1.Duration `json:"migrationInterval,omitempty"`
+	// MigrateHostedClusters also rewrites the labels of the HostedClusters. Their labels are usually owned by the
+	// tooling creating the HostedClusters, which would revert the migration.
+	MigrateHostedClusters *bool `json:"migrateHostedClusters,omitempty"`
+}
+
+// GitOpsNamespaceRoute registers the HostedClusters matching the selector into the gitops namespace
+type GitOpsNamespaceRoute struct {
+	// Selector matches the labels of the HostedClusters
+	Selector metav1.LabelSelector `json:"selector"`
+	// Namespace is the gitops namespace of the matching HostedClusters
+	Namespace string `json:"namespace"`
+}
+
+// RegistrationPolicy is an organizational rule written in CEL. The expressions see the HostedCluster as
+// hostedCluster and the computed registration, without credentials, as registration.
+type RegistrationPolicy struct {
+	// Name identifies the policy in the registration conditions
+	Name string `json:"name"`
+	// Validate is a CEL expression returning a bool, the registration is vetoed when it is false
+	Validate string `json:"validate,omitempty"`
+	// Message explains a veto of Validate
+	Message string `json:"message,omitempty"`
+	// Labels is a CEL expression returning a map of labels added to the ArgoCD cluster secret
+	Labels string `json:"labels,omitempty"`
+	// DisabledBuiltinLabels is a CEL expression returning a list of built-in label groups and keys removed from the
+	// ArgoCD cluster secret
+	DisabledBuiltinLabels string `json:"disabledBuiltinLabels,omitempty"`
+}
+
+// RegistrationQuota caps the number of registered HostedClusters sharing a namespace or the value of a label
+type RegistrationQuota struct {
+	// Name identifies the quota in the registration conditions and events
+	Name string `json:"name"`
+	// LabelKey groups the HostedClusters by the value of the label, by namespace if empty. HostedClusters without the
+	// label are not counted.
+	LabelKey string `json:"labelKey,omitempty"`
+	// GitOpsNamespace restricts the quota to registrations into the gitops namespace, all namespaces if empty
+	GitOpsNamespace string `json:"gitOpsNamespace,omitempty"`
+	// Max is the number of HostedClusters of a group that may be registered
+	Max int `json:"max"`
+}
+
+// TokenAudience is a consumer of hosted cluster credentials with its own token audience
+type TokenAudience struct {
+	// Name of the consumer, the token is written to the secret <hostedcluster>-<name>-token
+	Name string `json:"name"`
+	// Audience of the tokens of the consumer
+	Audience string `json:"audience"`
+	// Namespace the secret is written to, defaults to the namespace of the HostedCluster
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RefreshConfig configures the throttled steady state refreshes of healthy registrations
+type RefreshConfig struct {
+	// QPS is the rate at which refreshes are processed
+	QPS *float64 `json:"qps,omitempty"`
+	// MaxConcurrentRefreshes is the number of refreshes processed concurrently
+	MaxConcurrentRefreshes *int `json:"maxConcurrentRefreshes,omitempty"`
+}
+
+// RegistrationProxyConfig configures the registration proxy ArgoCD cluster secrets are sent to
+type RegistrationProxyConfig struct {
+	// URL of the registration proxy
+	URL string `json:"url"`
+	// SigningKeyFile contains the shared key used to sign the payloads
+	SigningKeyFile string `json:"signingKeyFile"`
+	// CAFile contains the CA bundle used to verify the registration proxy certificate
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// RemoteHubConfig configures the hub cluster running ArgoCD, the kubeconfig is read from a file or a secret
+type RemoteHubConfig struct {
+	// KubeconfigFile contains the kubeconfig of the hub
+	KubeconfigFile string `json:"kubeconfigFile,omitempty"`
+	// KubeconfigSecret is the <namespace>/<name> secret holding the kubeconfig of the hub in its kubeconfig key
+	KubeconfigSecret string `json:"kubeconfigSecret,omitempty"`
+}
+
+// ReportConfig configures a periodically written report
+type ReportConfig struct {
+	// Interval at which the report is written, a zero interval disables the report
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Namespace the report ConfigMap is written to
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConsistencyCheckConfig configures the consistency check of the ArgoCD cluster secrets
+type ConsistencyCheckConfig struct {
+	// Interval at which the check runs, a zero interval disables the check
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Repair deletes orphaned and stale registrations instead of only reporting them
+	Repair *bool `json:"repair,omitempty"`
+}
+
+// OrphanReaperConfig configures the reaper of registrations whose HostedCluster disappeared without deregistration
+type OrphanReaperConfig struct {
+	// Interval at which the reaper runs, a zero interval disables the reaper
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// RevocationTimeout is the time a failing token revocation is retried before the registration is deleted anyway
+	RevocationTimeout *metav1.Duration `json:"revocationTimeout,omitempty"`
+}
+
+// InventoryConfig configures the cluster inventory committed to a git repository
+type InventoryConfig struct {
+	// Repository is the URL of the git repository, the inventory is only written when set
+	Repository string `json:"repository,omitempty"`
+	// Branch is the existing branch the inventory is committed to, defaults to main
+	Branch string `json:"branch,omitempty"`
+	// Path of the inventory file in the repository, defaults to clusters.yaml
+	Path string `json:"path,omitempty"`
+	// DeployKeySecret is the name of the secret in the operator namespace holding the SSH deploy key in the
+	// sshPrivateKey key and the known hosts of the git server in the knownHosts key
+	DeployKeySecret string `json:"deployKeySecret,omitempty"`
+	// Interval at which the inventory is written, defaults to 5 minutes
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// TokenRotationConfig configures the lifetime and renewal of bound tokens
+type TokenRotationConfig struct {
+	// TTL is the requested lifetime of bound tokens, at least 10 minutes
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// RenewBefore is the remaining lifetime at which bound tokens are renewed, shorter than the TTL
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+	// Interval at which the ArgoCD cluster secrets are checked for tokens that missed their renewal, a zero interval
+	// disables the check
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// DryRunConfig configures the dry-run mode
+type DryRunConfig struct {
+	// Enabled records the changes in a report instead of applying them
+	Enabled *bool `json:"enabled,omitempty"`
+	// ReportInterval is the interval at which the dry-run report is written
+	ReportInterval *metav1.Duration `json:"reportInterval,omitempty"`
+	// FreezeNamespace is the namespace of the hyper-ops-freeze ConfigMap putting the operator into dry-run mode
+	// until its expiresAt, an empty namespace disables the freeze
+	FreezeNamespace *string `json:"freezeNamespace,omitempty"`
+}
+
+// PlatformApplicationConfig configures the ArgoCD Application deploying HyperShift itself to the management cluster
+type PlatformApplicationConfig struct {
+	// RepoURL is the git repository holding the HyperShift operator manifests, the Application is only maintained
+	// when set
+	RepoURL string `json:"repoURL,omitempty"`
+	// Path of the manifests within the repository
+	Path string `json:"path,omitempty"`
+	// TargetRevision is the git revision deployed, defaults to HEAD
+	TargetRevision string `json:"targetRevision,omitempty"`
+	// Namespace on the management cluster the manifests are deployed to, defaults to hypershift
+	Namespace string `json:"namespace,omitempty"`
+	// AutoSync enables automated sync with pruning and self healing
+	AutoSync *bool `json:"autoSync,omitempty"`
+}
+
+// BaselineApplicationSetConfig configures the ApplicationSet deploying a baseline to every registered hosted cluster
+type BaselineApplicationSetConfig struct {
+	// RepoURL is the git repository holding the baseline, the ApplicationSet is only created when set
+	RepoURL string `json:"repoURL,omitempty"`
+	// Path of the manifests within the repository, ApplicationSet parameters such as {{name}} are substituted
+	Path string `json:"path,omitempty"`
+	// TargetRevision is the git revision deployed, defaults to HEAD
+	TargetRevision string `json:"targetRevision,omitempty"`
+	// Namespace on the hosted clusters the manifests are deployed to
+	Namespace string `json:"namespace,omitempty"`
+	// Project is the AppProject of the generated Applications, defaults to default
+	Project string `json:"project,omitempty"`
+	// AutoSync enables automated sync with pruning and self healing of the generated Applications
+	AutoSync *bool `json:"autoSync,omitempty"`
+	// Maintain reverts changes to the ApplicationSet, otherwise it is only created if missing
+	Maintain *bool `json:"maintain,omitempty"`
+	// GitOpsNamespace is the namespace of the ApplicationSet, defaults to openshift-gitops
+	GitOpsNamespace string `json:"gitOpsNamespace,omitempty"`
+}
+
+// BootstrapConfig configures the root Application of an app-of-apps created for every registered hosted cluster.
+// {{name}} and {{server}} in the path and the values are replaced with the name and server of the ArgoCD cluster.
+type BootstrapConfig struct {
+	// RepoURL is the git repository holding the root Application, it is only created when set
+	RepoURL string `json:"repoURL,omitempty"`
+	// Path of the manifests or Helm chart within the repository
+	Path string `json:"path,omitempty"`
+	// TargetRevision is the git revision deployed, defaults to HEAD
+	TargetRevision string `json:"targetRevision,omitempty"`
+	// Values are the Helm values of the chart, the source is rendered as a Helm chart when set
+	Values string `json:"values,omitempty"`
+	// Project is the AppProject of the root Applications, defaults to default
+	Project string `json:"project,omitempty"`
+	// Namespace on the hosted clusters the manifests are deployed to
+	Namespace string `json:"namespace,omitempty"`
+	// AutoSync enables automated sync with pruning and self healing of the root Applications
+	AutoSync *bool `json:"autoSync,omitempty"`
+}
+
+// HubClientsConfig configures the clients the subsystems of hyper-ops use to talk to the hub API server
+type HubClientsConfig struct {
+	// UserAgent is the user agent of the clients, the subsystem is appended, defaults to hyper-ops/<version>
+	UserAgent string `json:"userAgent,omitempty"`
+	// Limits are the client side rate limits of the subsystems
+	Limits []HubClientLimits `json:"limits,omitempty"`
+}
+
+// HubClientLimits is the client side rate limit of the hub client of a subsystem
+type HubClientLimits struct {
+	// Subsystem is registrar, rotation, gc or health
+	Subsystem string `json:"subsystem"`
+	// QPS is the sustained rate of requests of the subsystem
+	QPS float64 `json:"qps"`
+	// Burst is the number of requests allowed at once, defaults to twice the QPS
+	Burst int `json:"burst,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// HyperOpsOperatorConfig is the Schema for the hyper-ops operator configuration file. Settings in the file take
+// precedence over the corresponding command line flags.
+type HyperOpsOperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ControllerManagerConfigurationSpec returns the configurations for controllers
+	cfg.ControllerManagerConfigurationSpec `json:",inline"`
+
+	Registration      RegistrationConfig       `json:"registration,omitempty"`
+	Refresh           RefreshConfig            `json:"refresh,omitempty"`
+	RegistrationProxy *RegistrationProxyConfig `json:"registrationProxy,omitempty"`
+	FleetReport       ReportConfig             `json:"fleetReport,omitempty"`
+	ConsistencyCheck  ConsistencyCheckConfig   `json:"consistencyCheck,omitempty"`
+	OrphanReaper      OrphanReaperConfig       `json:"orphanReaper,omitempty"`
+	Inventory         InventoryConfig          `json:"inventory,omitempty"`
+	TokenRotation     TokenRotationConfig      `json:"tokenRotation,omitempty"`
+	DryRun            DryRunConfig             `json:"dryRun,omitempty"`
+	// RemoteHub writes the ArgoCD cluster secrets to a hub cluster running ArgoCD instead of the management cluster
+	RemoteHub *RemoteHubConfig `json:"remoteHub,omitempty"`
+	// PlatformApplication makes the HyperShift operator itself GitOps managed
+	PlatformApplication PlatformApplicationConfig `json:"platformApplication,omitempty"`
+	// BaselineApplicationSet deploys a baseline to every registered hosted cluster
+	BaselineApplicationSet BaselineApplicationSetConfig `json:"baselineApplicationSet,omitempty"`
+	// Bootstrap creates the root Application of an app-of-apps for every registered hosted cluster
+	Bootstrap BootstrapConfig `json:"bootstrap,omitempty"`
+	// HubClients configures the user agent and rate limits of the hub clients of the subsystems
+	HubClients HubClientsConfig `json:"hubClients,omitempty"`
+	// ArchiveURL keeps the full change histories and the fleet report outside of etcd, in a directory
+	// (file:///<dir>, e.g. on a persistent volume) or an S3 compatible bucket (s3://<bucket>[/<prefix>])
+	ArchiveURL string `json:"archiveURL,omitempty"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HyperOpsOperatorConfig{})
+}
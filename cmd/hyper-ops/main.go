@@ -0,0 +1,368 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/controllers"
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+	"github.com/cldmnky/hyper-ops/pkg/cli"
+)
+
+const usage = `Usage: hyper-ops [--kubeconfig=<path>] <command> [flags]
+
+Commands:
+  list                        List the HostedClusters and their registrations
+  status <namespace>/<name>   Show the registration of a HostedCluster
+  history <namespace>/<name>  Show the last changes of the registration of a HostedCluster
+  validate-config <path>      Check an operator config file before it is rolled out
+  render                      Render the registration of a HostedCluster manifest without a cluster
+  export <namespace>/<name>   Export the hub objects of the registration of a HostedCluster as a YAML bundle
+  exclude [<namespace>/<name>...]
+                              Exclude HostedClusters from ApplicationSets without deregistering them
+  include [<namespace>/<name>...]
+                              Include excluded HostedClusters in ApplicationSets again
+
+Every command but render and export accepts -o table|json|yaml.
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "list":
+		err = list(args)
+	case "status":
+		err = status(args)
+	case "history":
+		err = history(args)
+	case "validate-config":
+		err = validateConfig(args)
+	case "render":
+		err = render(args)
+	case "export":
+		err = export(args)
+	case "exclude":
+		err = setExclusion("exclude", args, true)
+	case "include":
+		err = setExclusion("include", args, false)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// commandFlags returns the flag set shared by all commands
+func commandFlags(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	output := fs.String("o", cli.OutputTable, "Output format, one of table, json or yaml.")
+	defaultEnrollment := fs.String("default-enrollment", controllers.DefaultEnrollmentDisabled,
+		"The default enrollment of the controller, one of enabled or disabled.")
+	return fs, output, defaultEnrollment
+}
+
+func list(args []string) error {
+	fs, output, defaultEnrollment := commandFlags("list")
+	namespace := fs.String("n", "", "Only list the HostedClusters in the namespace.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cli.ValidateOutput(*output); err != nil {
+		return err
+	}
+	report, err := fleetReport(*defaultEnrollment)
+	if err != nil {
+		return err
+	}
+	clusters := []cli.Cluster{}
+	for _, c := range report.Clusters {
+		if *namespace == "" || c.Namespace == *namespace {
+			clusters = append(clusters, cli.NewCluster(c))
+		}
+	}
+	return cli.Print(os.Stdout, *output, cli.NewClusterList(clusters))
+}
+
+func status(args []string) error {
+	fs, output, defaultEnrollment := commandFlags("status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cli.ValidateOutput(*output); err != nil {
+		return err
+	}
+	namespace, name, ok := strings.Cut(fs.Arg(0), "/")
+	if fs.NArg() != 1 || !ok {
+		return fmt.Errorf("status expects a single <namespace>/<name> argument")
+	}
+	report, err := fleetReport(*defaultEnrollment)
+	if err != nil {
+		return err
+	}
+	for _, c := range report.Clusters {
+		if c.Namespace == namespace && c.Name == name {
+			return cli.Print(os.Stdout, *output, cli.NewClusterStatus(cli.NewCluster(c)))
+		}
+	}
+	return fmt.Errorf("HostedCluster %s/%s not found", namespace, name)
+}
+
+func history(args []string) error {
+	fs, output, defaultEnrollment := commandFlags("history")
+	archiveURL := fs.String("archive-url", "", "Read the full history from the archive of the operator, file:///<dir> or s3://<bucket>[/<prefix>].")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cli.ValidateOutput(*output); err != nil {
+		return err
+	}
+	namespace, name, ok := strings.Cut(fs.Arg(0), "/")
+	if fs.NArg() != 1 || !ok {
+		return fmt.Errorf("history expects a single <namespace>/<name> argument")
+	}
+	report, err := fleetReport(*defaultEnrollment)
+	if err != nil {
+		return err
+	}
+	for _, c := range report.Clusters {
+		if c.Namespace != namespace || c.Name != name {
+			continue
+		}
+		if !c.Registered {
+			return fmt.Errorf("HostedCluster %s/%s is not registered", namespace, name)
+		}
+		kc, err := newClient()
+		if err != nil {
+			return err
+		}
+		secret := &corev1.Secret{}
+		if err := kc.Get(context.Background(), client.ObjectKey{Namespace: c.GitOpsNamespace, Name: name}, secret); err != nil {
+			return err
+		}
+		changes := controllers.RegistrationHistory(secret)
+		if *archiveURL != "" {
+			store, err := archive.Open(*archiveURL)
+			if err != nil {
+				return err
+			}
+			if changes, err = controllers.ArchivedRegistrationHistory(context.Background(), store, secret); err != nil {
+				return err
+			}
+		}
+		return cli.Print(os.Stdout, *output, cli.NewRegistrationHistory(namespace, name, changes))
+	}
+	return fmt.Errorf("HostedCluster %s/%s not found", namespace, name)
+}
+
+func validateConfig(args []string) error {
+	fs, output, _ := commandFlags("validate-config")
+	offline := fs.Bool("offline", false, "Don't check the cluster for the gitops namespaces referenced by the config.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("validate-config expects a single <path> argument")
+	}
+	if err := cli.ValidateOutput(*output); err != nil {
+		return err
+	}
+	scheme := runtime.NewScheme()
+	if err := hyperopsv1alpha1.AddToScheme(scheme); err != nil {
+		return err
+	}
+	var c client.Reader
+	if !*offline {
+		var err error
+		if c, err = newClient(); err != nil {
+			return err
+		}
+	}
+	var warnings []string
+	config, err := controllers.LoadOperatorConfig(fs.Arg(0), scheme)
+	if err == nil {
+		warnings, err = controllers.ValidateRegistrationConfig(context.Background(), c, config.Registration)
+	}
+	validation := cli.NewConfigValidation(fs.Arg(0), warnings, err)
+	if err := cli.Print(os.Stdout, *output, validation); err != nil {
+		return err
+	}
+	if !validation.Valid {
+		return fmt.Errorf("%s is invalid", fs.Arg(0))
+	}
+	return nil
+}
+
+func render(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	hostedCluster := fs.String("hostedcluster", "", "Path of the HostedCluster manifest.")
+	policy := fs.String("policy", "", "Path of the registration policies, a single policy or a list as in registration.policies.")
+	server := fs.String("server", "", "API server of the hosted cluster, the control plane endpoint of the HostedCluster status by default.")
+	argoCDVersion := fs.String("argocd-version", "", "Version of the ArgoCD instance the features are negotiated with, all features are supported if empty.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *hostedCluster == "" || fs.NArg() != 0 {
+		return fmt.Errorf("render expects --hostedcluster <path> and no arguments")
+	}
+	hc, err := cli.ReadHostedCluster(*hostedCluster)
+	if err != nil {
+		return err
+	}
+	opts := controllers.RenderOptions{Server: *server, ArgoCDVersion: *argoCDVersion}
+	if opts.Server == "" {
+		if opts.Server, err = cli.RenderServer(hc); err != nil {
+			return fmt.Errorf("%w, set --server", err)
+		}
+	}
+	if *policy != "" {
+		if opts.Policies, err = cli.ReadPolicies(*policy); err != nil {
+			return err
+		}
+	}
+	rendered, err := controllers.RenderRegistration(context.Background(), hc, opts)
+	if err != nil {
+		return err
+	}
+	return cli.PrintRendered(os.Stdout, rendered)
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	showSecrets := fs.Bool("show-secrets", false, "Keep the credentials of the exported secrets instead of redacting them.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	namespace, name, ok := strings.Cut(fs.Arg(0), "/")
+	if fs.NArg() != 1 || !ok {
+		return fmt.Errorf("export expects a single <namespace>/<name> argument")
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	hc := &hypershiftv1beta1.HostedCluster{}
+	if err := c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: name}, hc); err != nil {
+		return err
+	}
+	exported, err := controllers.ExportRegistration(context.Background(), c, hc, controllers.ExportOptions{ShowSecrets: *showSecrets})
+	if err != nil {
+		return err
+	}
+	return cli.PrintExport(os.Stdout, exported)
+}
+
+// setExclusion excludes or includes the HostedClusters named by the arguments or matching the selector
+func setExclusion(name string, args []string, excluded bool) error {
+	fs, output, _ := commandFlags(name)
+	namespace := fs.String("n", "", "Only select the HostedClusters in the namespace.")
+	selector := fs.String("l", "", "Select the HostedClusters matching the label selector.")
+	all := fs.Bool("all", false, "Select all HostedClusters.")
+	var reason *string
+	if excluded {
+		reason = fs.String("reason", "", "Why the HostedClusters are excluded, e.g. the incident.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := cli.ValidateOutput(*output); err != nil {
+		return err
+	}
+	if (fs.NArg() > 0) == (*selector != "" || *all) {
+		return fmt.Errorf("%s expects <namespace>/<name> arguments, -l <selector> or --all", name)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if fs.NArg() > 0 {
+		for _, arg := range fs.Args() {
+			ns, n, ok := strings.Cut(arg, "/")
+			if !ok {
+				return fmt.Errorf("invalid HostedCluster %q, must be <namespace>/<name>", arg)
+			}
+			hc := hypershiftv1beta1.HostedCluster{}
+			if err := c.Get(context.Background(), client.ObjectKey{Namespace: ns, Name: n}, &hc); err != nil {
+				return err
+			}
+			hcs.Items = append(hcs.Items, hc)
+		}
+	} else {
+		s, err := labels.Parse(*selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector: %w", err)
+		}
+		if err := c.List(context.Background(), hcs, client.InNamespace(*namespace), client.MatchingLabelsSelector{Selector: s}); err != nil {
+			return err
+		}
+	}
+	var why string
+	if reason != nil {
+		why = *reason
+	}
+	if err := controllers.SetClusterExclusion(context.Background(), c, hcs.Items, excluded, why); err != nil {
+		return err
+	}
+	return cli.Print(os.Stdout, *output, cli.NewClusterExclusion(hcs.Items, excluded, why))
+}
+
+func fleetReport(defaultEnrollment string) (*controllers.FleetReport, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+	return controllers.GenerateFleetReport(context.Background(), c, defaultEnrollment)
+}
+
+// newClient returns a client for the cluster of the kubeconfig
+func newClient() (client.Client, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if err := hypershiftv1beta1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return client.New(cfg, client.Options{Scheme: scheme})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+	"github.com/cldmnky/hyper-ops/pkg/regproxy"
+)
+
+func main() {
+	var bindAddr string
+	var tlsCertFile string
+	var tlsKeyFile string
+	var signingKeyFile string
+	var namespaces string
+	flag.StringVar(&bindAddr, "bind-address", ":8443", "The address the registration endpoint binds to.")
+	flag.StringVar(&tlsCertFile, "tls-cert-file", "", "The TLS certificate used to serve the registration endpoint.")
+	flag.StringVar(&tlsKeyFile, "tls-key-file", "", "The TLS key used to serve the registration endpoint.")
+	flag.StringVar(&signingKeyFile, "signing-key-file", "", "File containing the shared key used to verify registration payloads.")
+	flag.StringVar(&namespaces, "allowed-namespaces", "", "Comma separated list of gitops namespaces registrations may be written to. All namespaces are allowed if empty.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(redact.NewLogger(zap.New(zap.UseFlagOptions(&opts))))
+	log := ctrl.Log.WithName("registration-proxy")
+
+	signingKey, err := os.ReadFile(signingKeyFile)
+	if err != nil {
+		log.Error(err, "unable to read signing key")
+		os.Exit(1)
+	}
+	signingKey = bytes.TrimSpace(signingKey)
+	if len(signingKey) == 0 {
+		log.Error(errors.New("empty signing key"), "a signing key is required")
+		os.Exit(1)
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		log.Error(err, "unable to create client")
+		os.Exit(1)
+	}
+
+	server := &regproxy.Server{
+		Client:     c,
+		SigningKey: signingKey,
+		Log:        log,
+	}
+	if namespaces != "" {
+		server.AllowedNamespaces = strings.Split(namespaces, ",")
+	}
+
+	srv := &http.Server{
+		Addr:              bindAddr,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	ctx := ctrl.SetupSignalHandler()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("starting registration proxy", "address", bindAddr)
+	if err := srv.ListenAndServeTLS(tlsCertFile, tlsKeyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "problem running registration proxy")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// DefaultACMAutoImportRetry is the number of times ACM retries a failed import if none is configured
+	DefaultACMAutoImportRetry = 5
+
+	// acmAutoImportSecretName is the secret in the namespace of the ManagedCluster ACM imports the cluster with
+	acmAutoImportSecretName = "auto-import-secret"
+	// acmClusterSetLabel adds a ManagedCluster to a ManagedClusterSet
+	acmClusterSetLabel = "cluster.open-cluster-management.io/clusterset"
+	// acmManagedClusterNamespaceLabel marks the namespace of a ManagedCluster
+	acmManagedClusterNamespaceLabel = "cluster.open-cluster-management.io/managedCluster"
+	// acmManagedClusterJoined is the condition of ManagedClusters whose klusterlet joined the hub
+	acmManagedClusterJoined = "ManagedClusterJoined"
+)
+
+var acmManagedClusterGVK = schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1", Kind: "ManagedCluster"}
+
+// ACMRegistrar imports the HostedClusters into Advanced Cluster Management. Every hosted cluster gets a
+// ManagedCluster carrying the labels of the ArgoCD cluster secret, so Placements select hosted clusters the way
+// ApplicationSets do, and an auto-import secret with the kubeconfig until its klusterlet joined the hub.
+type ACMRegistrar struct {
+	Client          client.Client
+	ClusterSet      string
+	AutoImportRetry int32
+}
+
+var _ Registrar = &ACMRegistrar{}
+
+// NewACMRegistrar returns an ACMRegistrar importing the clusters into the cluster set of the config
+func NewACMRegistrar(c client.Client, config hyperopsv1alpha1.ACMConfig) (*ACMRegistrar, error) {
+	if config.ClusterSet != "" {
+		if errs := validation.IsDNS1123Label(config.ClusterSet); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid acm cluster set %q: %s", config.ClusterSet, strings.Join(errs, ", "))
+		}
+	}
+	a := &ACMRegistrar{Client: c, ClusterSet: config.ClusterSet, AutoImportRetry: DefaultACMAutoImportRetry}
+	if config.AutoImportRetry != nil {
+		if *config.AutoImportRetry < 0 {
+			return nil, fmt.Errorf("the acm auto import retry %d must not be negative", *config.AutoImportRetry)
+		}
+		a.AutoImportRetry = *config.AutoImportRetry
+	}
+	return a, nil
+}
+
+// ValidateACMConfig returns an error if no ACMRegistrar can be created from the config
+func ValidateACMConfig(config *hyperopsv1alpha1.ACMConfig) error {
+	_, err := NewACMRegistrar(nil, *config)
+	return err
+}
+
+func (a *ACMRegistrar) Name() string {
+	return "acm"
+}
+
+// Register writes the ManagedCluster of the HostedCluster and, until the cluster joined, its auto-import secret. ACM
+// deletes the auto-import secret after the import, writing it again would import the cluster again.
+func (a *ACMRegistrar) Register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	kubeconfig, err := clusterKubeconfig(cluster)
+	if err != nil {
+		return err
+	}
+	managedCluster := &unstructured.Unstructured{}
+	managedCluster.SetGroupVersionKind(acmManagedClusterGVK)
+	managedCluster.SetName(hc.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, a.Client, managedCluster, func() error {
+		if err := claimRegistrarObject(managedCluster, hc); err != nil {
+			return err
+		}
+		// ACM labels the ManagedCluster with the cloud, vendor and cluster set, only the hyper-ops labels are replaced
+		existing := map[string]string{}
+		for k, v := range managedCluster.GetLabels() {
+			if !isHyperOpsLabel(k) {
+				existing[k] = v
+			}
+		}
+		labels := mergeLabels(existing, cluster.LabelSchema.Apply(hostedClusterLabels(hc)), cluster.PolicyLabels)
+		if a.ClusterSet != "" {
+			labels[acmClusterSetLabel] = a.ClusterSet
+		}
+		managedCluster.SetLabels(labels)
+		return unstructured.SetNestedField(managedCluster.Object, true, "spec", "hubAcceptsClient")
+	}); err != nil {
+		return fmt.Errorf("unable to write the ManagedCluster: %w", err)
+	}
+	if managedClusterJoined(managedCluster) {
+		return nil
+	}
+
+	// the namespace of the ManagedCluster holds the auto-import secret, it is removed by ACM when the cluster is
+	// detached
+	namespace := &corev1.Namespace{}
+	if err := a.Client.Get(ctx, client.ObjectKey{Name: hc.Name}, namespace); apierrors.IsNotFound(err) {
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   hc.Name,
+			Labels: map[string]string{acmManagedClusterNamespaceLabel: hc.Name},
+		}}
+		if err := a.Client.Create(ctx, namespace); client.IgnoreAlreadyExists(err) != nil {
+			return fmt.Errorf("unable to create the namespace of the ManagedCluster: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: acmAutoImportSecretName, Namespace: hc.Name}}
+	if _, err := CreateOrUpdateWithRetries(ctx, a.Client, secret, func() error {
+		if err := claimRegistrarObject(secret, hc); err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{
+			"autoImportRetry": []byte(strconv.Itoa(int(a.AutoImportRetry))),
+			"kubeconfig":      kubeconfig,
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the auto-import secret: %w", err)
+	}
+	return nil
+}
+
+// Deregister deletes the ManagedCluster of the HostedCluster, which makes ACM detach the cluster, and its auto-import
+// secret if the import didn't happen yet
+func (a *ACMRegistrar) Deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	managedCluster := &unstructured.Unstructured{}
+	managedCluster.SetGroupVersionKind(acmManagedClusterGVK)
+	managedCluster.SetName(hc.Name)
+	if err := deleteRegistrarObjects(ctx, a.Client, hc, "", managedCluster); err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: acmAutoImportSecretName}}
+	return deleteRegistrarObjects(ctx, a.Client, hc, hc.Name, secret)
+}
+
+// managedClusterJoined returns true if the klusterlet of the ManagedCluster joined the hub
+func managedClusterJoined(managedCluster *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(managedCluster.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == acmManagedClusterJoined && condition["status"] == string(metav1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
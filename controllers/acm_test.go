@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("ACM registrar", func() {
+	hostedCluster := func(hcLabels map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", UID: "uid", Labels: hcLabels,
+		}}
+	}
+	cluster := &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   "hosted",
+			Server: "https://hosted:6443",
+			Config: argocd.ClusterConfig{BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+		},
+		PolicyLabels: map[string]string{"env": "prod"},
+	}
+	registrar := func(c client.Client) *ACMRegistrar {
+		a, err := NewACMRegistrar(c, hyperopsv1alpha1.ACMConfig{ClusterSet: "hosted-clusters"})
+		Expect(err).NotTo(HaveOccurred())
+		return a
+	}
+	managedCluster := func(c client.Client) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(acmManagedClusterGVK)
+		return obj, c.Get(context.Background(), client.ObjectKey{Name: "hosted"}, obj)
+	}
+	autoImportSecret := client.ObjectKey{Namespace: "hosted", Name: acmAutoImportSecretName}
+
+	It("Should validate the acm config", func() {
+		retry := int32(-1)
+		Expect(ValidateACMConfig(&hyperopsv1alpha1.ACMConfig{})).To(Succeed())
+		Expect(ValidateACMConfig(&hyperopsv1alpha1.ACMConfig{ClusterSet: "Hosted_Clusters"})).NotTo(Succeed())
+		Expect(ValidateACMConfig(&hyperopsv1alpha1.ACMConfig{AutoImportRetry: &retry})).NotTo(Succeed())
+	})
+
+	It("Should write the ManagedCluster and the auto-import secret until the cluster joined", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(registrar(c).Register(context.Background(), hostedCluster(map[string]string{hyperOpsExcludedLabel: "true"}), cluster)).To(Succeed())
+
+		mc, err := managedCluster(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mc.GetLabels()).To(HaveKeyWithValue("env", "prod"))
+		Expect(mc.GetLabels()).To(HaveKeyWithValue(hyperOpsExcludedLabel, "true"))
+		Expect(mc.GetLabels()).To(HaveKeyWithValue(acmClusterSetLabel, "hosted-clusters"))
+		accepted, _, _ := unstructured.NestedBool(mc.Object, "spec", "hubAcceptsClient")
+		Expect(accepted).To(BeTrue())
+
+		namespace := &corev1.Namespace{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Name: "hosted"}, namespace)).To(Succeed())
+		Expect(namespace.Labels).To(HaveKeyWithValue(acmManagedClusterNamespaceLabel, "hosted"))
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), autoImportSecret, secret)).To(Succeed())
+		Expect(string(secret.Data["autoImportRetry"])).To(Equal("5"))
+		kubeconfig, err := clientcmd.Load(secret.Data["kubeconfig"])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubeconfig.Clusters["hosted"].Server).To(Equal("https://hosted:6443"))
+
+		By("not importing a joined cluster again")
+		Expect(c.Delete(context.Background(), secret)).To(Succeed())
+		mc.SetLabels(mergeLabels(mc.GetLabels(), map[string]string{"vendor": "OpenShift"}))
+		Expect(unstructured.SetNestedSlice(mc.Object, []interface{}{
+			map[string]interface{}{"type": acmManagedClusterJoined, "status": "True"},
+		}, "status", "conditions")).To(Succeed())
+		Expect(c.Update(context.Background(), mc)).To(Succeed())
+		Expect(registrar(c).Register(context.Background(), hostedCluster(nil), cluster)).To(Succeed())
+		err = c.Get(context.Background(), autoImportSecret, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		mc, err = managedCluster(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mc.GetLabels()).To(HaveKeyWithValue("vendor", "OpenShift"))
+		Expect(mc.GetLabels()).NotTo(HaveKey(hyperOpsExcludedLabel))
+	})
+
+	It("Should deregister the cluster and leave ManagedClusters it did not write alone", func() {
+		foreign := &unstructured.Unstructured{}
+		foreign.SetGroupVersionKind(acmManagedClusterGVK)
+		foreign.SetName("local-cluster")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(foreign).Build()
+		Expect(registrar(c).Register(context.Background(), hostedCluster(nil), cluster)).To(Succeed())
+
+		local := hostedCluster(nil)
+		local.Name = "local-cluster"
+		Expect(registrar(c).Register(context.Background(), local, cluster)).NotTo(Succeed())
+		Expect(registrar(c).Deregister(context.Background(), local)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+
+		Expect(registrar(c).Deregister(context.Background(), hostedCluster(nil))).To(Succeed())
+		_, err := managedCluster(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = c.Get(context.Background(), autoImportSecret, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	admissionPolicyName = "hyper-ops.cloudmonkey.org"
+	// admissionPolicyResyncInterval is how often drift on the admission policy objects is reverted
+	admissionPolicyResyncInterval = 10 * time.Minute
+)
+
+var (
+	validatingAdmissionPolicyGVK        = schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "ValidatingAdmissionPolicy"}
+	validatingAdmissionPolicyBindingGVK = schema.GroupVersionKind{Group: "admissionregistration.k8s.io", Version: "v1", Kind: "ValidatingAdmissionPolicyBinding"}
+)
+
+// AdmissionPolicyManager keeps a ValidatingAdmissionPolicy and its binding in sync with the active configuration, so
+// the hyper-ops label contract on HostedClusters is enforced by the API server even when the controller is down
+type AdmissionPolicyManager struct {
+	Client                  client.Client
+	AllowedGitOpsNamespaces []string
+}
+
+// Start applies the admission policy and re-applies it periodically until the context is cancelled
+func (a *AdmissionPolicyManager) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("admission-policy")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := a.apply(ctx); err != nil {
+			log.Error(err, "unable to apply admission policy")
+		}
+	}, admissionPolicyResyncInterval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader writes the admission policy
+func (a *AdmissionPolicyManager) NeedLeaderElection() bool {
+	return true
+}
+
+func (a *AdmissionPolicyManager) apply(ctx context.Context) error {
+	for _, desired := range AdmissionPolicyObjects(a.AllowedGitOpsNamespaces) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(desired.GroupVersionKind())
+		obj.SetName(desired.GetName())
+		if _, err := CreateOrUpdateWithRetries(ctx, a.Client, obj, func() error {
+			obj.SetLabels(desired.GetLabels())
+			stampManaged(obj, "")
+			obj.Object["spec"] = desired.Object["spec"]
+			return nil
+		}); err != nil {
+			return fmt.Errorf("unable to apply %s %s: %w", desired.GetKind(), desired.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// AdmissionPolicyObjects renders the ValidatingAdmissionPolicy and ValidatingAdmissionPolicyBinding encoding the
+// hyper-ops label contract for HostedClusters. The labels are validated in every label schema, since hyper-ops reads
+// them from any schema and HostedClusters may carry both while they are migrated.
+func AdmissionPolicyObjects(allowedGitOpsNamespaces []string) []*unstructured.Unstructured {
+	validations := []interface{}{}
+	for _, key := range schemaLabelKeys(hyperOpsEnabledLabel) {
+		validations = append(validations, map[string]interface{}{
+			"expression": fmt.Sprintf(`!has(object.metadata.labels) || !('%[1]s' in object.metadata.labels) || object.metadata.labels['%[1]s'] in ['true', 'false']`, key),
+			"message":    fmt.Sprintf("the %s label must be either true or false", key),
+		})
+	}
+	if len(allowedGitOpsNamespaces) > 0 {
+		quoted := make([]string, 0, len(allowedGitOpsNamespaces))
+		for _, ns := range allowedGitOpsNamespaces {
+			quoted = append(quoted, fmt.Sprintf("'%s'", ns))
+		}
+		for _, key := range schemaLabelKeys(hyperOpsGitopsNamespaceLabel) {
+			validations = append(validations, map[string]interface{}{
+				"expression": fmt.Sprintf(`!has(object.metadata.labels) || !('%[1]s' in object.metadata.labels) || object.metadata.labels['%[1]s'] in [%[2]s]`, key, strings.Join(quoted, ", ")),
+				"message":    fmt.Sprintf("the %s label must be one of %s", key, strings.Join(allowedGitOpsNamespaces, ", ")),
+			})
+		}
+	}
+
+	labels := managedLabels(nil)
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"failurePolicy": "Fail",
+			"matchConstraints": map[string]interface{}{
+				"resourceRules": []interface{}{
+					map[string]interface{}{
+						"apiGroups":   []interface{}{"hypershift.openshift.io"},
+						"apiVersions": []interface{}{"*"},
+						"operations":  []interface{}{"CREATE", "UPDATE"},
+						"resources":   []interface{}{"hostedclusters"},
+					},
+				},
+			},
+			"validations": validations,
+		},
+	}}
+	policy.SetGroupVersionKind(validatingAdmissionPolicyGVK)
+	policy.SetName(admissionPolicyName)
+	policy.SetLabels(labels)
+
+	binding := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"policyName":        admissionPolicyName,
+			"validationActions": []interface{}{"Deny"},
+		},
+	}}
+	binding.SetGroupVersionKind(validatingAdmissionPolicyBindingGVK)
+	binding.SetName(admissionPolicyName)
+	binding.SetLabels(labels)
+
+	return []*unstructured.Unstructured{policy, binding}
+}
+
+// schemaLabelKeys returns the keys of the versioned hyper-ops label, given by its v1 key, in every label schema
+func schemaLabelKeys(key string) []string {
+	return []string{LabelSchema{Version: LabelSchemaV1}.Key(key), LabelSchema{Version: LabelSchemaV2}.Key(key)}
+}
+
+// gitOpsNamespaceAllowed returns true if registrations may be written to the namespace
+func gitOpsNamespaceAllowed(namespace string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ns := range allowed {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
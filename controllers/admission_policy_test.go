@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Admission policy", func() {
+	It("Should only validate the enabled labels without allowed namespaces", func() {
+		objs := AdmissionPolicyObjects(nil)
+		Expect(objs).To(HaveLen(2))
+		Expect(objs[0].GetKind()).To(Equal("ValidatingAdmissionPolicy"))
+		Expect(objs[1].GetKind()).To(Equal("ValidatingAdmissionPolicyBinding"))
+		validations, _, err := unstructured.NestedSlice(objs[0].Object, "spec", "validations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(validations).To(HaveLen(2))
+		Expect(validations[0].(map[string]interface{})["expression"]).To(ContainSubstring("'" + hyperOpsEnabledLabel + "'"))
+		Expect(validations[1].(map[string]interface{})["expression"]).To(ContainSubstring("'" + hyperOpsLabelV2 + "/enabled'"))
+	})
+
+	It("Should encode the allowed gitops namespaces", func() {
+		objs := AdmissionPolicyObjects([]string{"openshift-gitops", "team-gitops"})
+		validations, _, err := unstructured.NestedSlice(objs[0].Object, "spec", "validations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(validations).To(HaveLen(4))
+		Expect(validations[2].(map[string]interface{})["expression"]).To(ContainSubstring("['openshift-gitops', 'team-gitops']"))
+	})
+
+	It("Should reject a gitops namespace set through the v2 label schema", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		hc.Labels = LabelSchema{Version: LabelSchemaV2}.Apply(map[string]string{
+			hyperOpsEnabledLabel:         "true",
+			hyperOpsGitopsNamespaceLabel: "team-gitops",
+		})
+		key := hyperOpsLabelV2 + "/gitops-namespace"
+		Expect(hc.Labels).To(HaveKey(key))
+		Expect(hc.Labels).NotTo(HaveKey(hyperOpsGitopsNamespaceLabel))
+
+		objs := AdmissionPolicyObjects([]string{"openshift-gitops"})
+		validations, _, err := unstructured.NestedSlice(objs[0].Object, "spec", "validations")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(validations).To(ContainElement(HaveKeyWithValue("expression",
+			fmt.Sprintf(`!has(object.metadata.labels) || !('%[1]s' in object.metadata.labels) || object.metadata.labels['%[1]s'] in ['openshift-gitops']`, key))))
+		Expect(gitOpsNamespaceAllowed(hostedClusterGitOpsNamespace(hc, nil), []string{"openshift-gitops"})).To(BeFalse())
+	})
+
+	It("Should allow every namespace when no namespaces are configured", func() {
+		Expect(gitOpsNamespaceAllowed("anything", nil)).To(BeTrue())
+		Expect(gitOpsNamespaceAllowed("team-gitops", []string{"openshift-gitops"})).To(BeFalse())
+		Expect(gitOpsNamespaceAllowed("openshift-gitops", []string{"openshift-gitops"})).To(BeTrue())
+	})
+})
@@ -0,0 +1,369 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsConnectivityAnnotation selects how ArgoCD reaches the hosted cluster, ConnectivityOutboundOnly registers
+	// it through an agent dialing out of the hosted cluster
+	hyperOpsConnectivityAnnotation = "hyper-ops.cloudmonkey.org/connectivity"
+	// ConnectivityOutboundOnly is set on HostedClusters whose API server can't be reached by the hub
+	ConnectivityOutboundOnly = "outbound-only"
+	// ConnectivityDirect registers the HostedCluster with the hub reaching its API server, also when it is private
+	ConnectivityDirect = "direct"
+
+	// argoCDAgentNameLabel links an ArgoCD cluster secret to the agent serving the cluster
+	argoCDAgentNameLabel = "argocd-agent.argoproj-labs.io/agent-name"
+
+	// agentNamespace, agentName and agentCredentialsSecret are the resources of the agent in the hosted cluster
+	agentNamespace         = "hyper-ops-agent"
+	agentName              = "hyper-ops-agent"
+	agentCredentialsSecret = "hyper-ops-agent-credentials"
+	// agentCredentialsKey holds the userpass credentials of the agent, in the secret in the hosted cluster and in
+	// the hub credentials secret
+	agentCredentialsKey = "userpass.creds"
+
+	// serviceNetworkKubeconfigSecret is the admin kubeconfig of the hosted control plane pointing at the
+	// kube-apiserver service, usable from the management cluster when the external endpoint is not
+	serviceNetworkKubeconfigSecret = "service-network-admin-kubeconfig"
+
+	// DefaultAgentImage is the image of the agent unless configured otherwise
+	DefaultAgentImage = "quay.io/argoprojlabs/argocd-agent:latest"
+
+	// agentRequeueAfter is the interval at which agents are checked until they are available
+	agentRequeueAfter = 30 * time.Second
+
+	// ConditionAgentReady is true when the agent of an outbound-only HostedCluster is available
+	ConditionAgentReady = "AgentReady"
+)
+
+// hyperOpsAgentCredentialsLabel marks the hub credentials secrets of the agents, for the principal to load
+var hyperOpsAgentCredentialsLabel = fmt.Sprintf("%s/agent-credentials", hyperOpsLabel)
+
+// ValidateConnectivity returns an error if the connectivity is not direct or outbound-only
+func ValidateConnectivity(connectivity string) error {
+	switch connectivity {
+	case ConnectivityDirect, ConnectivityOutboundOnly:
+		return nil
+	}
+	return fmt.Errorf("invalid connectivity %q, must be %s or %s", connectivity, ConnectivityDirect, ConnectivityOutboundOnly)
+}
+
+// privateEndpoint returns true if the API server of the HostedCluster is only published on private endpoints
+func privateEndpoint(hc *hypershiftv1beta1.HostedCluster) bool {
+	aws := hc.Spec.Platform.AWS
+	return aws != nil && aws.EndpointAccess == hypershiftv1beta1.Private
+}
+
+// outboundOnly returns true when the HostedCluster is registered through an agent: it is annotated outbound-only, or
+// it is private, not annotated and private HostedClusters are registered through agents
+func (r *HyperOpsReconciler) outboundOnly(hc *hypershiftv1beta1.HostedCluster) bool {
+	switch hc.GetAnnotations()[hyperOpsConnectivityAnnotation] {
+	case ConnectivityOutboundOnly:
+		return true
+	case ConnectivityDirect:
+		return false
+	}
+	return r.PrivateClusterConnectivity == ConnectivityOutboundOnly && privateEndpoint(hc)
+}
+
+// agentCredentialsSecretName returns the name of the hub credentials secret of the agent of the HostedCluster
+func agentCredentialsSecretName(hc *hypershiftv1beta1.HostedCluster) string {
+	return fmt.Sprintf("hyper-ops-agent-%s", hc.Name)
+}
+
+// agentServer returns the server of the ArgoCD cluster secret of the agent, the resource proxy of the principal
+// routes the requests of ArgoCD to the agent named in the agentName parameter
+func agentServer(resourceProxyServer, name string) string {
+	return fmt.Sprintf("%s?agentName=%s", strings.TrimSuffix(resourceProxyServer, "/"), url.QueryEscape(name))
+}
+
+// serviceNetworkServer returns the server of the service network kubeconfig, qualified with the namespace of the
+// hosted control plane so it resolves from the namespace of hyper-ops
+func serviceNetworkServer(server, controlPlaneNamespace string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	host, port := u.Hostname(), u.Port()
+	if !strings.Contains(host, ".") && net.ParseIP(host) == nil {
+		host = fmt.Sprintf("%s.%s.svc", host, controlPlaneNamespace)
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// reconcileAgent registers an outbound-only HostedCluster: the agent is installed into the hosted cluster through
+// the service network of its control plane, its credentials are shared with the hub and the ArgoCD cluster secret
+// points at the resource proxy of the principal
+func (r *HyperOpsReconciler) reconcileAgent(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string, labels map[string]string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if r.remoteRegistrations() != nil {
+		return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionAgentReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AgentModeNotSupported",
+			Message: "outbound-only clusters can't be registered into a remote ArgoCD",
+		})
+	}
+	if r.AgentPrincipalAddress == "" || r.AgentResourceProxyServer == "" {
+		return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionAgentReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AgentModeNotConfigured",
+			Message: "outbound-only clusters require --agent-principal-address and --agent-resource-proxy-server",
+		})
+	}
+	if r.readOnly() {
+		return ctrl.Result{}, ignoreSkippedConflict(r.createArgoCDClusterSecret(ctx, r.agentLabels(hc, labels), r.agentCluster(hc, gitOpsNamespace)))
+	}
+
+	controlPlaneNamespace := hostedControlPlaneNamespace(hc)
+	kubeConfigSecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: controlPlaneNamespace, Name: serviceNetworkKubeconfigSecret}, kubeConfigSecret); err != nil {
+		log.V(3).Error(err, "unable to fetch service network kubeconfig secret")
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		// the kubeconfig is created by HyperShift with the control plane, the agent is installed once it exists
+		return ctrl.Result{RequeueAfter: agentRequeueAfter}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionAgentReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "WaitingForKubeconfig",
+			Message: fmt.Sprintf("waiting for the kubeconfig secret %s/%s", controlPlaneNamespace, serviceNetworkKubeconfigSecret),
+		})
+	}
+	restConfig, err := GetRESTConfigForCluster(kubeConfigSecret.Data["kubeconfig"],
+		WithUserAgent(HostedClusterUserAgent(hc.Namespace, hc.Name)),
+		WithHeaders(r.HostedClusterHeaders))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if restConfig.Host, err = serviceNetworkServer(restConfig.Host, controlPlaneNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+	hostedClusterClient, err := r.hostedClient(hc, restConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	credentials, err := r.ensureAgentCredentials(ctx, hc, gitOpsNamespace)
+	if err != nil {
+		log.V(3).Error(err, "unable to ensure the agent credentials")
+		return ctrl.Result{}, err
+	}
+	deployment, err := ensureAgent(ctx, hostedClusterClient, r.AgentImage, r.AgentPrincipalAddress, credentials, correlationID(hc))
+	if err != nil {
+		log.V(3).Error(err, "unable to install the agent")
+		return ctrl.Result{}, err
+	}
+	if err := r.createArgoCDClusterSecret(ctx, r.agentLabels(hc, labels), r.agentCluster(hc, gitOpsNamespace)); err != nil {
+		log.V(3).Error(err, "unable to create argocd cluster secret")
+		return ctrl.Result{}, ignoreSkippedConflict(err)
+	}
+	if deployment.Status.AvailableReplicas == 0 {
+		return ctrl.Result{RequeueAfter: agentRequeueAfter}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionAgentReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "AgentNotAvailable",
+			Message: fmt.Sprintf("the agent in namespace %s of the hosted cluster is not available", agentNamespace),
+		})
+	}
+	return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionAgentReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "AgentAvailable",
+		Message: fmt.Sprintf("the agent dials out to %s", r.AgentPrincipalAddress),
+	})
+}
+
+// agentCluster returns the ArgoCD cluster of the agent. The principal authenticates ArgoCD, the secret carries no
+// credentials of the hosted cluster.
+func (r *HyperOpsReconciler) agentCluster(hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) *Cluster {
+	return &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   hc.Name,
+			Server: agentServer(r.AgentResourceProxyServer, hc.Name),
+		},
+		HostedCluster:   hc,
+		GitOpsNamespace: gitOpsNamespace,
+	}
+}
+
+// agentLabels adds the agent name label to the labels of the ArgoCD cluster secret
+func (r *HyperOpsReconciler) agentLabels(hc *hypershiftv1beta1.HostedCluster, labels map[string]string) map[string]string {
+	return mergeLabels(map[string]string{argoCDAgentNameLabel: hc.Name}, labels)
+}
+
+// ensureAgentCredentials returns the userpass credentials of the agent, generated once and kept in the hub
+// credentials secret in the gitops namespace
+func (r *HyperOpsReconciler) ensureAgentCredentials(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) ([]byte, error) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: agentCredentialsSecretName(hc), Namespace: gitOpsNamespace}}
+	if _, err := CreateOrUpdateWithRetries(ctx, r.Client, secret, func() error {
+		stampManaged(secret, correlationID(hc))
+		metav1.SetMetaDataLabel(&secret.ObjectMeta, hyperOpsAgentCredentialsLabel, "true")
+		metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsHostedClusterAnnotation, client.ObjectKeyFromObject(hc).String())
+		if len(secret.Data[agentCredentialsKey]) > 0 {
+			return nil
+		}
+		password := make([]byte, 32)
+		if _, err := rand.Read(password); err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{
+			agentCredentialsKey: []byte(fmt.Sprintf("%s:%s", hc.Name, hex.EncodeToString(password))),
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return secret.Data[agentCredentialsKey], nil
+}
+
+// removeAgentCredentials deletes the hub credentials secret of the agent of the HostedCluster
+func (r *HyperOpsReconciler) removeAgentCredentials(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: agentCredentialsSecretName(hc), Namespace: gitOpsNamespace}}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// ensureAgent installs the agent into the hosted cluster and returns its deployment. The agent runs in managed
+// mode, it applies the Applications pushed by the principal with cluster-admin permissions like the ArgoCD
+// application controller would.
+func ensureAgent(ctx context.Context, clnt client.Client, image, principalAddress string, credentials []byte, correlationID string) (*appsv1.Deployment, error) {
+	host, port, err := net.SplitHostPort(principalAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid principal address %q: %w", principalAddress, err)
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: agentNamespace}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, ns, func() error {
+		stampManaged(ns, correlationID)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to ensure namespace %s: %w", agentNamespace, err)
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: agentCredentialsSecret, Namespace: agentNamespace}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, secret, func() error {
+		stampManaged(secret, correlationID)
+		secret.Data = map[string][]byte{agentCredentialsKey: credentials}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to ensure the agent credentials: %w", err)
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: agentName, Namespace: agentNamespace}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, sa, func() error {
+		stampManaged(sa, correlationID)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to ensure the agent service account: %w", err)
+	}
+	crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: agentName}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, crb, func() error {
+		stampManaged(crb, correlationID)
+		crb.Subjects = []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: agentName, Namespace: agentNamespace}}
+		crb.RoleRef = rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin", APIGroup: rbacv1.GroupName}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to ensure the agent cluster role binding: %w", err)
+	}
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: agentName, Namespace: agentNamespace}}
+	selector := map[string]string{"app.kubernetes.io/name": agentName}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, deployment, func() error {
+		stampManaged(deployment, correlationID)
+		replicas := int32(1)
+		deployment.Spec.Replicas = &replicas
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+		deployment.Spec.Template = corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: selector},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: agentName,
+				Containers: []corev1.Container{{
+					Name:  "agent",
+					Image: image,
+					Env: []corev1.EnvVar{
+						{Name: "ARGOCD_AGENT_MODE", Value: "managed"},
+						{Name: "ARGOCD_AGENT_REMOTE_SERVER", Value: host},
+						{Name: "ARGOCD_AGENT_REMOTE_PORT", Value: port},
+						{Name: "ARGOCD_AGENT_CREDS", Value: "userpass:/app/config/creds/" + agentCredentialsKey},
+					},
+					VolumeMounts: []corev1.VolumeMount{{Name: "creds", MountPath: "/app/config/creds", ReadOnly: true}},
+				}},
+				Volumes: []corev1.Volume{{
+					Name:         "creds",
+					VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: agentCredentialsSecret}},
+				}},
+			},
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to ensure the agent deployment: %w", err)
+	}
+	return deployment, nil
+}
+
+// cleanupAgent removes the agent and its credentials once the HostedCluster is no longer outbound-only
+func (r *HyperOpsReconciler) cleanupAgent(ctx context.Context, hostedClient client.Client, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	condition := meta.FindStatusCondition(registrationConditions(hc), ConditionAgentReady)
+	if r.readOnly() || condition == nil || condition.Reason == "NotConfigured" {
+		return nil
+	}
+	log.FromContext(ctx).Info("removing the agent of the HostedCluster")
+	if err := r.removeAgentCredentials(ctx, hc, gitOpsNamespace); err != nil {
+		return err
+	}
+	for _, obj := range []client.Object{
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: agentName}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: agentNamespace}},
+	} {
+		if err := hostedClient.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionAgentReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NotConfigured",
+		Message: "the HostedCluster is reached directly",
+	})
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Outbound-only agent mode", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsConnectivityAnnotation: ConnectivityOutboundOnly},
+			},
+		}
+	})
+
+	It("Should resolve the servers of the agent", func() {
+		Expect((&HyperOpsReconciler{}).outboundOnly(hc)).To(BeTrue())
+		Expect(agentServer("https://principal.example.com:9090/", "hosted")).To(Equal("https://principal.example.com:9090?agentName=hosted"))
+		server, err := serviceNetworkServer("https://kube-apiserver:6443", "clusters-hosted")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server).To(Equal("https://kube-apiserver.clusters-hosted.svc:6443"))
+		server, err = serviceNetworkServer("https://172.30.0.1:6443", "clusters-hosted")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server).To(Equal("https://172.30.0.1:6443"))
+	})
+
+	It("Should report a missing agent configuration", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c}
+		_, err := r.reconcileAgent(context.Background(), hc, defaultGitOpsNamespace, hostedClusterLabels(hc))
+		Expect(err).NotTo(HaveOccurred())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionAgentReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("AgentModeNotConfigured"))
+	})
+
+	It("Should register private HostedClusters through agents if configured", func() {
+		private := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "clusters"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{Platform: hypershiftv1beta1.PlatformSpec{
+				AWS: &hypershiftv1beta1.AWSPlatformSpec{EndpointAccess: hypershiftv1beta1.Private},
+			}},
+		}
+		Expect((&HyperOpsReconciler{PrivateClusterConnectivity: ConnectivityDirect}).outboundOnly(private)).To(BeFalse())
+		r := &HyperOpsReconciler{PrivateClusterConnectivity: ConnectivityOutboundOnly}
+		Expect(r.outboundOnly(private)).To(BeTrue())
+
+		// the annotation wins
+		private.Annotations = map[string]string{hyperOpsConnectivityAnnotation: ConnectivityDirect}
+		Expect(r.outboundOnly(private)).To(BeFalse())
+
+		public := private.DeepCopy()
+		public.Annotations = nil
+		public.Spec.Platform.AWS.EndpointAccess = hypershiftv1beta1.PublicAndPrivate
+		Expect(r.outboundOnly(public)).To(BeFalse())
+
+		Expect(ValidateConnectivity(ConnectivityOutboundOnly)).To(Succeed())
+		Expect(ValidateConnectivity("private")).NotTo(Succeed())
+	})
+
+	It("Should wait for the service network kubeconfig", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c, AgentPrincipalAddress: "principal.example.com:8443", AgentResourceProxyServer: "https://principal.example.com:9090"}
+		result, err := r.reconcileAgent(context.Background(), hc, defaultGitOpsNamespace, hostedClusterLabels(hc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(agentRequeueAfter))
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionAgentReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("WaitingForKubeconfig"))
+	})
+
+	It("Should keep the generated agent credentials", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c}
+		credentials, err := r.ensureAgentCredentials(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(credentials)).To(HavePrefix("hosted:"))
+		again, err := r.ensureAgentCredentials(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(credentials))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hyper-ops-agent-hosted"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue(hyperOpsAgentCredentialsLabel, "true"))
+
+		Expect(r.removeAgentCredentials(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).NotTo(Succeed())
+	})
+
+	It("Should install and remove the agent", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		deployment, err := ensureAgent(context.Background(), hosted, DefaultAgentImage, "principal.example.com:8443", []byte("hosted:secret"), "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+			corev1.EnvVar{Name: "ARGOCD_AGENT_REMOTE_SERVER", Value: "principal.example.com"},
+			corev1.EnvVar{Name: "ARGOCD_AGENT_REMOTE_PORT", Value: "8443"},
+		))
+		secret := &corev1.Secret{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: agentNamespace, Name: agentCredentialsSecret}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue(agentCredentialsKey, []byte("hosted:secret")))
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: agentName}, &rbacv1.ClusterRoleBinding{})).To(Succeed())
+
+		_, err = ensureAgent(context.Background(), hosted, DefaultAgentImage, "principal.example.com", nil, "")
+		Expect(err).To(HaveOccurred())
+
+		By("removing the agent once the cluster is reached directly")
+		r := &HyperOpsReconciler{Client: c}
+		Expect(r.setRegistrationCondition(context.Background(), hc, metav1.Condition{
+			Type:   ConditionAgentReady,
+			Status: metav1.ConditionTrue,
+			Reason: "AgentAvailable",
+		})).To(Succeed())
+		delete(hc.Annotations, hyperOpsConnectivityAnnotation)
+		Expect(r.cleanupAgent(context.Background(), hosted, hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: agentNamespace}, &corev1.Namespace{})).NotTo(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: agentName}, &rbacv1.ClusterRoleBinding{})).NotTo(Succeed())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionAgentReady).Reason).To(Equal("NotConfigured"))
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+)
+
+const (
+	// hyperOpsChangeHistoryArchiveAnnotation points at the full change history of a registration in the archive
+	hyperOpsChangeHistoryArchiveAnnotation = "hyper-ops.cloudmonkey.org/change-history-archive"
+
+	// compactChangeHistory is the number of changes kept on the ArgoCD cluster secret when the history is archived
+	compactChangeHistory = 3
+	// maxArchivedChanges is the number of changes kept per registration in the archive
+	maxArchivedChanges = 1000
+
+	// fleetReportArchiveKey is the key of the full fleet report in the archive and, on the ConfigMap of the report,
+	// the key holding its location
+	fleetReportArchiveKey  = "fleet-report/report.json"
+	fleetReportLocationKey = "archive"
+)
+
+var archiveWriteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hyperops_archive_write_errors_total",
+	Help: "Failed writes of verbose data to the archive outside of the Kubernetes API, by kind",
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(archiveWriteErrors)
+}
+
+// changeHistoryArchiveKey returns the key of the change history of the ArgoCD cluster secret in the archive
+func changeHistoryArchiveKey(secret client.ObjectKey) string {
+	return fmt.Sprintf("history/%s/%s.json", secret.Namespace, secret.Name)
+}
+
+// compactRegistrationHistory keeps only the last compactChangeHistory changes on the secret and points at the full
+// history in the archive
+func compactRegistrationHistory(secret *corev1.Secret, store archive.Store) {
+	history := RegistrationHistory(secret)
+	if len(history) > compactChangeHistory {
+		if raw, err := json.Marshal(history[len(history)-compactChangeHistory:]); err == nil {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsChangeHistoryAnnotation, string(raw))
+		}
+	}
+	metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsChangeHistoryArchiveAnnotation, store.Location(changeHistoryArchiveKey(client.ObjectKeyFromObject(secret))))
+}
+
+// archiveRegistrationChanges appends the changes to the history of the secret in the archive. A failed write is
+// logged and counted but doesn't fail the registration, the last changes are still on the secret.
+func (r *HyperOpsReconciler) archiveRegistrationChanges(ctx context.Context, secret client.ObjectKey, changes []RegistrationChange) {
+	if r.Archive == nil || len(changes) == 0 {
+		return
+	}
+	if err := appendArchivedHistory(ctx, r.Archive, secret, changes); err != nil {
+		archiveWriteErrors.WithLabelValues("history").Inc()
+		log.FromContext(ctx).Error(err, "unable to archive the registration changes", "secret", secret)
+	}
+}
+
+func appendArchivedHistory(ctx context.Context, store archive.Store, secret client.ObjectKey, changes []RegistrationChange) error {
+	key := changeHistoryArchiveKey(secret)
+	history := []RegistrationChange{}
+	raw, err := store.Get(ctx, key)
+	switch {
+	case errors.Is(err, archive.ErrNotFound):
+	case err != nil:
+		return err
+	default:
+		// a corrupted history is started over, like the one on the secret
+		_ = json.Unmarshal(raw, &history)
+	}
+	history = append(history, changes...)
+	if len(history) > maxArchivedChanges {
+		history = history[len(history)-maxArchivedChanges:]
+	}
+	raw, err = json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, raw)
+}
+
+// ArchivedRegistrationHistory returns the change history of the ArgoCD cluster secret from the archive, oldest first.
+// Registrations that were never archived fall back to the history recorded on the secret.
+func ArchivedRegistrationHistory(ctx context.Context, store archive.Store, secret *corev1.Secret) ([]RegistrationChange, error) {
+	raw, err := store.Get(ctx, changeHistoryArchiveKey(client.ObjectKeyFromObject(secret)))
+	if errors.Is(err, archive.ErrNotFound) {
+		return RegistrationHistory(secret), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	history := []RegistrationChange{}
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil, fmt.Errorf("invalid archived history of %s: %w", client.ObjectKeyFromObject(secret), err)
+	}
+	return history, nil
+}
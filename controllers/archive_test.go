@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+// unavailableArchive fails every read and write
+type unavailableArchive struct{}
+
+func (unavailableArchive) Get(context.Context, string) ([]byte, error) {
+	return nil, errors.New("archive unavailable")
+}
+
+func (unavailableArchive) Put(context.Context, string, []byte) error {
+	return errors.New("archive unavailable")
+}
+
+func (unavailableArchive) Location(key string) string {
+	return "unavailable://" + key
+}
+
+var _ = Describe("Archive", func() {
+	var (
+		c     client.Client
+		store *archive.FileStore
+	)
+	labels := map[string]string{hyperOpsTypeLabel: "hosted"}
+	key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}
+	write := func(r *HyperOpsReconciler, token string) *corev1.Secret {
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443", Config: argocd.ClusterConfig{BearerToken: token}}}
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.writeArgoCDClusterSecret(context.Background(), defaultGitOpsNamespace, labels, cluster, data)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), key, secret)).To(Succeed())
+		return secret
+	}
+
+	BeforeEach(func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		store = &archive.FileStore{Dir: GinkgoT().TempDir()}
+	})
+
+	It("Should keep the full history in the archive and the last changes on the secret", func() {
+		r := &HyperOpsReconciler{Client: c}
+		// the fake client doesn't set the creation timestamp, which tells created secrets apart
+		secret := write(r, "a")
+		secret.CreationTimestamp = metav1.Now()
+		Expect(c.Update(context.Background(), secret)).To(Succeed())
+		for _, token := range []string{"b", "c", "d", "e"} {
+			write(r, token)
+		}
+
+		r.Archive = store
+		secret = write(r, "f")
+		Expect(RegistrationHistory(secret)).To(HaveLen(compactChangeHistory))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsChangeHistoryArchiveAnnotation, store.Location("history/openshift-gitops/hosted.json")))
+		history, err := ArchivedRegistrationHistory(context.Background(), store, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(6))
+		Expect(history[0].Type).To(Equal(ChangeTypeCreated))
+
+		secret = write(r, "g")
+		Expect(RegistrationHistory(secret)).To(HaveLen(compactChangeHistory))
+		history, err = ArchivedRegistrationHistory(context.Background(), store, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(7))
+		Expect(history[6].Type).To(Equal(ChangeTypeCredentialsRotated))
+
+		By("keeping the history on the secret again without the archive")
+		r.Archive = nil
+		secret = write(r, "h")
+		Expect(RegistrationHistory(secret)).To(HaveLen(compactChangeHistory + 1))
+		Expect(secret.Annotations).NotTo(HaveKey(hyperOpsChangeHistoryArchiveAnnotation))
+	})
+
+	It("Should fall back to the history of the secret for registrations that were never archived", func() {
+		secret := write(&HyperOpsReconciler{Client: c}, "a")
+		history, err := ArchivedRegistrationHistory(context.Background(), store, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(Equal(RegistrationHistory(secret)))
+	})
+
+	It("Should register the cluster while the archive is unavailable", func() {
+		before := testutil.ToFloat64(archiveWriteErrors.WithLabelValues("history"))
+		secret := write(&HyperOpsReconciler{Client: c, Archive: unavailableArchive{}}, "a")
+		Expect(RegistrationHistory(secret)).To(HaveLen(1))
+		Expect(testutil.ToFloat64(archiveWriteErrors.WithLabelValues("history"))).To(Equal(before + 1))
+	})
+
+	It("Should keep the full fleet report in the archive and its summary in the ConfigMap", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", Labels: map[string]string{hyperOpsEnabledLabel: "true"},
+		}}
+		Expect(c.Create(context.Background(), hc)).To(Succeed())
+		reporter := &FleetReporter{Client: c, Namespace: "hyper-ops", DefaultEnrollment: DefaultEnrollmentDisabled, Archive: store}
+		Expect(reporter.writeReport(context.Background())).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "hyper-ops", Name: fleetReportConfigMapName}, cm)).To(Succeed())
+		Expect(cm.Data).To(HaveKeyWithValue(fleetReportLocationKey, store.Location(fleetReportArchiveKey)))
+		compact := &FleetReport{}
+		Expect(json.Unmarshal([]byte(cm.Data[fleetReportDataKey]), compact)).To(Succeed())
+		Expect(compact.Summary.Total).To(Equal(1))
+		Expect(compact.Clusters).To(BeEmpty())
+
+		raw, err := store.Get(context.Background(), fleetReportArchiveKey)
+		Expect(err).NotTo(HaveOccurred())
+		full := &FleetReport{}
+		Expect(json.Unmarshal(raw, full)).To(Succeed())
+		Expect(full.Clusters).To(HaveLen(1))
+		Expect(full.Clusters[0].Name).To(Equal("hosted"))
+	})
+})
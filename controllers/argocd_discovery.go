@@ -0,0 +1,271 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsArgoCDInstanceSelectorAnnotation selects the ArgoCD instances a HostedCluster is registered into by the
+	// labels of their ArgoCD CRs
+	hyperOpsArgoCDInstanceSelectorAnnotation = "hyper-ops.cloudmonkey.org/argocd-instance-selector"
+
+	// ConditionArgoCDInstancesDiscovered is false when the ArgoCD instance selector of a HostedCluster matches no
+	// ArgoCD instance
+	ConditionArgoCDInstancesDiscovered = "ArgoCDInstancesDiscovered"
+
+	// DefaultArgoCDDiscoveryInterval is how often the ArgoCD instances are discovered by default
+	DefaultArgoCDDiscoveryInterval = time.Minute
+)
+
+// errArgoCDInstancesNotDiscovered is returned for HostedClusters selecting ArgoCD instances before the first discovery
+var errArgoCDInstancesNotDiscovered = errors.New("the ArgoCD instances have not been discovered yet")
+
+// DiscoveredArgoCD is an ArgoCD CR found by the ArgoCDInstanceDiscovery
+type DiscoveredArgoCD struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string
+}
+
+// ArgoCDInstanceDiscovery keeps a snapshot of the ArgoCD CRs of the ArgoCD and OpenShift GitOps operators, so
+// HostedClusters can be registered into the instances matching a selector instead of a hardcoded gitops namespace.
+// The namespace of the first matching instance is the gitops namespace of the HostedCluster, the registration is
+// copied to the namespaces of the other matching instances.
+type ArgoCDInstanceDiscovery struct {
+	// Client lists the HostedClusters to requeue when the instances change
+	Client client.Client
+	// Reader lists the ArgoCD CRs, hyper-ops doesn't watch them
+	Reader client.Reader
+	// Selector selects the instances of HostedClusters without the selector annotation, those HostedClusters keep
+	// their gitops namespace if nil
+	Selector labels.Selector
+	// Interval is how often the instances are discovered, DefaultArgoCDDiscoveryInterval if zero
+	Interval time.Duration
+	// Changes queues the HostedClusters selecting instances whenever the discovered instances change
+	Changes chan event.GenericEvent
+
+	mu        sync.RWMutex
+	instances []DiscoveredArgoCD
+	synced    bool
+}
+
+// Start discovers the instances periodically until the context is cancelled, it implements manager.Runnable
+func (d *ArgoCDInstanceDiscovery) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("argocd-discovery")
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultArgoCDDiscoveryInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		changed, err := d.refresh(ctx)
+		if err != nil {
+			log.Error(err, "unable to discover the ArgoCD instances")
+			return
+		}
+		if changed {
+			if err := d.requeueSelecting(ctx); err != nil {
+				log.Error(err, "unable to requeue the HostedClusters selecting ArgoCD instances")
+			}
+		}
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection makes the discovery run next to the reconciler, which consumes its changes
+func (d *ArgoCDInstanceDiscovery) NeedLeaderElection() bool {
+	return true
+}
+
+// Instances returns the discovered instances sorted by namespace and name
+func (d *ArgoCDInstanceDiscovery) Instances() []DiscoveredArgoCD {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]DiscoveredArgoCD{}, d.instances...)
+}
+
+// refresh lists the ArgoCD CRs of all served versions and returns true if the instances changed
+func (d *ArgoCDInstanceDiscovery) refresh(ctx context.Context) (bool, error) {
+	seen := map[client.ObjectKey]bool{}
+	instances := []DiscoveredArgoCD{}
+	for _, gvk := range argoCDGVKs {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+		if err := d.Reader.List(ctx, list); err != nil {
+			// the operator isn't installed or doesn't serve this version
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return false, err
+		}
+		for i := range list.Items {
+			key := client.ObjectKeyFromObject(&list.Items[i])
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			instances = append(instances, DiscoveredArgoCD{Namespace: key.Namespace, Name: key.Name, Labels: list.Items[i].GetLabels()})
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Namespace != instances[j].Namespace {
+			return instances[i].Namespace < instances[j].Namespace
+		}
+		return instances[i].Name < instances[j].Name
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := d.synced && !reflect.DeepEqual(instances, d.instances)
+	d.instances, d.synced = instances, true
+	return changed, nil
+}
+
+// requeueSelecting queues the HostedClusters selecting instances through Changes
+func (d *ArgoCDInstanceDiscovery) requeueSelecting(ctx context.Context) error {
+	if d.Changes == nil {
+		return nil
+	}
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := d.Client.List(ctx, hcs); err != nil {
+		return err
+	}
+	for i := range hcs.Items {
+		if selector, _ := d.selector(&hcs.Items[i]); selector == nil {
+			continue
+		}
+		select {
+		case d.Changes <- event.GenericEvent{Object: &hcs.Items[i]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// selector returns the instance selector of the HostedCluster, nil if it doesn't select instances. The gitops
+// namespace label always wins over the instance selectors.
+func (d *ArgoCDInstanceDiscovery) selector(hc *hypershiftv1beta1.HostedCluster) (labels.Selector, error) {
+	if ns, _ := hostedClusterLabel(hc, hyperOpsGitopsNamespaceLabel); ns != "" {
+		return nil, nil
+	}
+	if raw := hc.GetAnnotations()[hyperOpsArgoCDInstanceSelectorAnnotation]; raw != "" {
+		selector, err := labels.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", hyperOpsArgoCDInstanceSelectorAnnotation, err)
+		}
+		return selector, nil
+	}
+	return d.Selector, nil
+}
+
+// Targets returns the sorted gitops namespaces of the ArgoCD instances selected by the HostedCluster. selected is
+// false if the HostedCluster selects no instances, it then keeps the gitops namespace of its label, the routes or the
+// default.
+func (d *ArgoCDInstanceDiscovery) Targets(hc *hypershiftv1beta1.HostedCluster) (namespaces []string, selected bool, err error) {
+	if d == nil {
+		return nil, false, nil
+	}
+	selector, err := d.selector(hc)
+	if err != nil || selector == nil {
+		return nil, false, err
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if !d.synced {
+		return nil, true, errArgoCDInstancesNotDiscovered
+	}
+	namespaces = []string{}
+	for _, instance := range d.instances {
+		if selector.Matches(labels.Set(instance.Labels)) && (len(namespaces) == 0 || namespaces[len(namespaces)-1] != instance.Namespace) {
+			namespaces = append(namespaces, instance.Namespace)
+		}
+	}
+	return namespaces, true, nil
+}
+
+// discoveredGitOpsNamespaces resolves the gitops namespace of the HostedCluster against the discovered ArgoCD
+// instances. It returns the namespace of the first selected instance, or the given gitops namespace if the HostedCluster
+// selects no instances, and the namespaces of the other selected instances.
+func discoveredGitOpsNamespaces(discovery *ArgoCDInstanceDiscovery, hc *hypershiftv1beta1.HostedCluster, namespace string) (string, []string, error) {
+	targets, selected, err := discovery.Targets(hc)
+	if err != nil || !selected || len(targets) == 0 {
+		return namespace, nil, err
+	}
+	return targets[0], targets[1:], nil
+}
+
+// CompileArgoCDInstanceSelector converts the ArgoCD instance selector of the operator config, an empty selector would
+// register every HostedCluster into every ArgoCD instance and is rejected
+func CompileArgoCDInstanceSelector(config *metav1.LabelSelector) (labels.Selector, error) {
+	selector, err := metav1.LabelSelectorAsSelector(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid argoCDInstanceSelector: %w", err)
+	}
+	if selector.Empty() {
+		return nil, fmt.Errorf("argoCDInstanceSelector must not be empty")
+	}
+	return selector, nil
+}
+
+// reportDiscoveredArgoCDInstances reports the ArgoCD instances selected by the HostedCluster in the
+// ArgoCDInstancesDiscovered registration condition. It returns true when the registration must wait for a matching
+// instance or a valid selector.
+func (r *HyperOpsReconciler) reportDiscoveredArgoCDInstances(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, targets []string, selected bool, err error) (bool, error) {
+	condition := metav1.Condition{
+		Type:    ConditionArgoCDInstancesDiscovered,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Discovered",
+		Message: fmt.Sprintf("registered into the ArgoCD instances in %s", strings.Join(targets, ", ")),
+	}
+	switch {
+	case errors.Is(err, errArgoCDInstancesNotDiscovered):
+		return true, err
+	case err != nil:
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "InvalidSelector", err.Error()
+	case !selected:
+		if meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDInstancesDiscovered) == nil {
+			return false, nil
+		}
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "NotConfigured", "the HostedCluster selects no ArgoCD instances"
+	case len(targets) == 0:
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "NoMatchingInstance", "no ArgoCD instance matches the selector of the HostedCluster"
+	}
+	stop := selected && len(targets) == 0
+	if stop {
+		log.FromContext(ctx).Info("waiting for a matching ArgoCD instance", "reason", condition.Reason, "message", condition.Message)
+	}
+	return stop, r.setRegistrationCondition(ctx, hc, condition)
+}
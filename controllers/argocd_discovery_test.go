@@ -0,0 +1,200 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("ArgoCD instance discovery", func() {
+	instance := func(namespace, name string, instanceLabels map[string]string) client.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(argoCDGVKs[0].GroupVersion().WithKind("ArgoCD"))
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(instanceLabels)
+		return obj
+	}
+	hostedCluster := func(name string, hcLabels, annotations map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters", Labels: hcLabels, Annotations: annotations},
+		}
+	}
+	fleet := func(objs ...client.Object) client.Client {
+		return fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(append([]client.Object{
+			instance("argocd-team-b", "argocd", map[string]string{"tier": "shared", "team": "b"}),
+			instance("argocd-team-a", "argocd", map[string]string{"tier": "shared", "team": "a"}),
+			instance("argocd-team-a", "secondary", map[string]string{"tier": "shared"}),
+			instance(defaultGitOpsNamespace, "openshift-gitops", map[string]string{"tier": "platform"}),
+		}, objs...)...).Build()
+	}
+	discover := func(d *ArgoCDInstanceDiscovery) {
+		_, err := d.refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+	}
+	selectAnnotation := func(selector string) map[string]string {
+		return map[string]string{hyperOpsArgoCDInstanceSelectorAnnotation: selector}
+	}
+
+	It("Should resolve the gitops namespaces of the selected instances", func() {
+		c := fleet()
+		d := &ArgoCDInstanceDiscovery{Client: c, Reader: c, Selector: labels.SelectorFromSet(labels.Set{"tier": "platform"})}
+		hc := hostedCluster("hosted", nil, selectAnnotation("tier=shared"))
+
+		_, selected, err := d.Targets(hc)
+		Expect(err).To(MatchError(errArgoCDInstancesNotDiscovered))
+		Expect(selected).To(BeTrue())
+
+		changed, err := d.refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		// the first discovery is not a change, the HostedClusters are reconciled anyway on startup
+		Expect(changed).To(BeFalse())
+		Expect(d.Instances()).To(HaveLen(4))
+
+		targets, selected, err := d.Targets(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(BeTrue())
+		Expect(targets).To(Equal([]string{"argocd-team-a", "argocd-team-b"}))
+
+		primary, others, err := discoveredGitOpsNamespaces(d, hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(primary).To(Equal("argocd-team-a"))
+		Expect(others).To(Equal([]string{"argocd-team-b"}))
+		Expect(additionalGitOpsNamespaces(hc, primary, others...)).To(Equal([]string{"argocd-team-b"}))
+
+		// HostedClusters without the annotation use the default selector
+		targets, _, err = d.Targets(hostedCluster("default", nil, nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(Equal([]string{defaultGitOpsNamespace}))
+
+		targets, selected, err = d.Targets(hostedCluster("unmatched", nil, selectAnnotation("team=c")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(BeTrue())
+		Expect(targets).To(BeEmpty())
+	})
+
+	It("Should let the gitops namespace label win over the selectors", func() {
+		c := fleet()
+		d := &ArgoCDInstanceDiscovery{Client: c, Reader: c, Selector: labels.SelectorFromSet(labels.Set{"tier": "platform"})}
+		discover(d)
+		hc := hostedCluster("labelled", map[string]string{hyperOpsGitopsNamespaceLabel: "team-gitops"}, selectAnnotation("tier=shared"))
+
+		targets, selected, err := d.Targets(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(BeFalse())
+		Expect(targets).To(BeEmpty())
+
+		primary, others, err := discoveredGitOpsNamespaces(d, hc, "team-gitops")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(primary).To(Equal("team-gitops"))
+		Expect(others).To(BeEmpty())
+
+		// without a default selector HostedClusters keep their gitops namespace
+		d.Selector = nil
+		_, selected, err = d.Targets(hostedCluster("default", nil, nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(BeFalse())
+
+		// a disabled discovery selects nothing
+		var disabled *ArgoCDInstanceDiscovery
+		_, selected, err = disabled.Targets(hostedCluster("hosted", nil, selectAnnotation("tier=shared")))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selected).To(BeFalse())
+	})
+
+	It("Should reject invalid selectors", func() {
+		c := fleet()
+		d := &ArgoCDInstanceDiscovery{Client: c, Reader: c}
+		discover(d)
+
+		_, selected, err := d.Targets(hostedCluster("hosted", nil, selectAnnotation("tier in (")))
+		Expect(err).To(HaveOccurred())
+		Expect(selected).To(BeFalse())
+
+		_, err = CompileArgoCDInstanceSelector(&metav1.LabelSelector{})
+		Expect(err).To(HaveOccurred())
+		selector, err := CompileArgoCDInstanceSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"tier": "shared"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(selector.Matches(labels.Set{"tier": "shared"})).To(BeTrue())
+	})
+
+	It("Should requeue the HostedClusters selecting instances when the instances change", func() {
+		selecting := hostedCluster("selecting", nil, selectAnnotation("tier=shared"))
+		labelled := hostedCluster("labelled", map[string]string{hyperOpsGitopsNamespaceLabel: "team-gitops"}, nil)
+		c := fleet(selecting, labelled)
+		d := &ArgoCDInstanceDiscovery{Client: c, Reader: c, Changes: make(chan event.GenericEvent, 2)}
+		discover(d)
+
+		changed, err := d.refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		Expect(c.Create(context.Background(), instance("argocd-team-c", "argocd", map[string]string{"tier": "shared"}))).To(Succeed())
+		changed, err = d.refresh(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		Expect(d.requeueSelecting(context.Background())).To(Succeed())
+		Expect(d.Changes).To(HaveLen(1))
+		Expect((<-d.Changes).Object.GetName()).To(Equal("selecting"))
+	})
+
+	It("Should report the discovered instances in the registration conditions", func() {
+		hc := hostedCluster("hosted", nil, selectAnnotation("team=c"))
+		c := fleet(hc)
+		r := &HyperOpsReconciler{Client: c}
+		ctx := context.Background()
+
+		stop, err := r.reportDiscoveredArgoCDInstances(ctx, hc, nil, true, errArgoCDInstancesNotDiscovered)
+		Expect(err).To(MatchError(errArgoCDInstancesNotDiscovered))
+		Expect(stop).To(BeTrue())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDInstancesDiscovered)).To(BeNil())
+
+		// HostedClusters that never selected instances don't get the condition
+		stop, err = r.reportDiscoveredArgoCDInstances(ctx, hc, nil, false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDInstancesDiscovered)).To(BeNil())
+
+		stop, err = r.reportDiscoveredArgoCDInstances(ctx, hc, []string{}, true, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDInstancesDiscovered).Reason).To(Equal("NoMatchingInstance"))
+
+		stop, err = r.reportDiscoveredArgoCDInstances(ctx, hc, []string{"argocd-team-a", "argocd-team-b"}, true, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionArgoCDInstancesDiscovered)).To(BeTrue())
+
+		stop, err = r.reportDiscoveredArgoCDInstances(ctx, hc, nil, false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDInstancesDiscovered).Reason).To(Equal("NotConfigured"))
+	})
+})
@@ -0,0 +1,213 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// ConditionArgoCDAvailable is false when the gitops namespace has no ArgoCD instance or it is unhealthy, so the
+	// registration is written but nothing picks it up
+	ConditionArgoCDAvailable = "ArgoCDAvailable"
+
+	// ArgoCDReasonAvailable is an ArgoCD instance that reports itself available
+	ArgoCDReasonAvailable = "Available"
+	// ArgoCDReasonNotInstalled is a gitops namespace without an ArgoCD CR or an ArgoCD server
+	ArgoCDReasonNotInstalled = "NotInstalled"
+	// ArgoCDReasonUnavailable is an ArgoCD instance that exists but isn't available
+	ArgoCDReasonUnavailable = "Unavailable"
+
+	// argoCDInstanceTTL is the time the detected ArgoCD instance of a gitops namespace is reused
+	argoCDInstanceTTL = time.Minute
+	// argoCDInstanceRecheckInterval is how often the registration of a HostedCluster rechecks a missing or
+	// unhealthy ArgoCD instance
+	argoCDInstanceRecheckInterval = 5 * time.Minute
+)
+
+// argoCDGVKs are the kinds of the ArgoCD CR of the ArgoCD and OpenShift GitOps operators, newest first
+var argoCDGVKs = []schema.GroupVersionKind{
+	{Group: "argoproj.io", Version: "v1beta1", Kind: "ArgoCDList"},
+	{Group: "argoproj.io", Version: "v1alpha1", Kind: "ArgoCDList"},
+}
+
+var argoCDInstanceAvailable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "hyperops_argocd_instance_available",
+	Help: "1 if the gitops namespace has an available ArgoCD instance, 0 if it is missing or unhealthy.",
+}, []string{"namespace"})
+
+func init() {
+	metrics.Registry.MustRegister(argoCDInstanceAvailable)
+}
+
+// ArgoCDInstance is the ArgoCD instance found in a gitops namespace
+type ArgoCDInstance struct {
+	// Found is true when the namespace has an ArgoCD CR or an ArgoCD server deployment
+	Found bool
+	// Available is true when the ArgoCD CR reports the Available phase or the server has available replicas
+	Available bool
+	// Message describes the instance
+	Message string
+}
+
+// DetectArgoCDInstance returns the ArgoCD instance of the namespace. The status of an ArgoCD CR of the operator
+// wins, ArgoCD instances installed without the operator are detected by their server deployment.
+func DetectArgoCDInstance(ctx context.Context, c client.Reader, namespace string) (ArgoCDInstance, error) {
+	for _, gvk := range argoCDGVKs {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk)
+		if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+			// the operator isn't installed or doesn't serve this version
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return ArgoCDInstance{}, err
+		}
+		for _, item := range list.Items {
+			phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+			if phase == "Available" {
+				return ArgoCDInstance{Found: true, Available: true, Message: fmt.Sprintf("ArgoCD %s is available", item.GetName())}, nil
+			}
+			if phase == "" {
+				phase = "Unknown"
+			}
+			return ArgoCDInstance{Found: true, Message: fmt.Sprintf("ArgoCD %s is in phase %s", item.GetName(), phase)}, nil
+		}
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments, client.InNamespace(namespace), client.MatchingLabels{
+		"app.kubernetes.io/component": "server",
+		"app.kubernetes.io/part-of":   "argocd",
+	}); err != nil {
+		return ArgoCDInstance{}, err
+	}
+	for _, d := range deployments.Items {
+		if d.Status.AvailableReplicas > 0 {
+			return ArgoCDInstance{Found: true, Available: true, Message: fmt.Sprintf("ArgoCD server %s is available", d.Name)}, nil
+		}
+	}
+	if len(deployments.Items) > 0 {
+		return ArgoCDInstance{Found: true, Message: fmt.Sprintf("ArgoCD server %s has no available replicas", deployments.Items[0].Name)}, nil
+	}
+	return ArgoCDInstance{Message: fmt.Sprintf("no ArgoCD instance found in namespace %s", namespace)}, nil
+}
+
+type argoCDInstanceEntry struct {
+	instance   ArgoCDInstance
+	detectedAt time.Time
+}
+
+// argoCDInstanceCache keeps the detected ArgoCD instances by gitops namespace
+type argoCDInstanceCache struct {
+	mu      sync.Mutex
+	entries map[string]argoCDInstanceEntry
+}
+
+func (c *argoCDInstanceCache) get(namespace string, now time.Time) (ArgoCDInstance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[namespace]
+	if !ok || now.Sub(entry.detectedAt) > argoCDInstanceTTL {
+		return ArgoCDInstance{}, false
+	}
+	return entry.instance, true
+}
+
+func (c *argoCDInstanceCache) set(namespace string, instance ArgoCDInstance, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]argoCDInstanceEntry{}
+	}
+	c.entries[namespace] = argoCDInstanceEntry{instance: instance, detectedAt: now}
+}
+
+// healthReader returns the reader of the ArgoCD instance probes
+func (r *HyperOpsReconciler) healthReader() client.Reader {
+	if r.HealthReader != nil {
+		return r.HealthReader
+	}
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// argoCDInstance returns the ArgoCD instance of the namespace, detected at most once per argoCDInstanceTTL
+func (r *HyperOpsReconciler) argoCDInstance(ctx context.Context, namespace string) (ArgoCDInstance, error) {
+	if instance, ok := r.argoCDInstances.get(namespace, time.Now()); ok {
+		return instance, nil
+	}
+	instance, err := DetectArgoCDInstance(ctx, r.healthReader(), namespace)
+	if err != nil {
+		return ArgoCDInstance{}, err
+	}
+	log.FromContext(ctx).V(3).Info("detected argocd instance", "namespace", namespace, "instance", instance)
+	r.argoCDInstances.set(namespace, instance, time.Now())
+	return instance, nil
+}
+
+// reportArgoCDInstance records in the ArgoCDAvailable registration condition and metric whether the ArgoCD instance
+// of the gitops namespace can pick up the registration. It returns the interval to check again, zero while the
+// instance is available. Failing to detect the instance never fails the registration.
+func (r *HyperOpsReconciler) reportArgoCDInstance(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, namespace string) time.Duration {
+	log := log.FromContext(ctx)
+	instance, err := r.argoCDInstance(ctx, namespace)
+	if err != nil {
+		log.V(3).Error(err, "unable to detect the argocd instance", "namespace", namespace)
+		return argoCDInstanceRecheckInterval
+	}
+	condition := metav1.Condition{
+		Type:    ConditionArgoCDAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  ArgoCDReasonAvailable,
+		Message: instance.Message,
+	}
+	switch {
+	case !instance.Found:
+		condition.Status, condition.Reason = metav1.ConditionFalse, ArgoCDReasonNotInstalled
+	case !instance.Available:
+		condition.Status, condition.Reason = metav1.ConditionFalse, ArgoCDReasonUnavailable
+	}
+	if instance.Available {
+		argoCDInstanceAvailable.WithLabelValues(namespace).Set(1)
+	} else {
+		argoCDInstanceAvailable.WithLabelValues(namespace).Set(0)
+	}
+	if err := r.setRegistrationCondition(ctx, hc, condition); err != nil {
+		log.V(3).Error(err, "unable to record the argocd instance")
+	}
+	if instance.Available {
+		return 0
+	}
+	return argoCDInstanceRecheckInterval
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("ArgoCD instance", func() {
+	server := func(available int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "argocd-server",
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{"app.kubernetes.io/component": "server", "app.kubernetes.io/part-of": "argocd"},
+			},
+			Status: appsv1.DeploymentStatus{AvailableReplicas: available},
+		}
+	}
+	argoCD := func(phase string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"status": map[string]interface{}{"phase": phase}}}
+		obj.SetGroupVersionKind(argoCDGVKs[0].GroupVersion().WithKind("ArgoCD"))
+		obj.SetNamespace(defaultGitOpsNamespace)
+		obj.SetName("openshift-gitops")
+		return obj
+	}
+
+	It("Should detect the instance from the ArgoCD CR or the server deployment", func() {
+		instance, err := DetectArgoCDInstance(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Found).To(BeFalse())
+
+		instance, err = DetectArgoCDInstance(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(server(0)).Build(), defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance).To(Equal(ArgoCDInstance{Found: true, Message: "ArgoCD server argocd-server has no available replicas"}))
+
+		instance, err = DetectArgoCDInstance(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(server(1)).Build(), defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Available).To(BeTrue())
+
+		// the status of the operator wins over the deployment it manages
+		instance, err = DetectArgoCDInstance(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(server(1), argoCD("Pending")).Build(), defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance).To(Equal(ArgoCDInstance{Found: true, Message: "ArgoCD openshift-gitops is in phase Pending"}))
+
+		instance, err = DetectArgoCDInstance(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(argoCD("Available")).Build(), defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.Available).To(BeTrue())
+	})
+
+	It("Should report a missing instance until it becomes available", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		Expect(r.reportArgoCDInstance(context.Background(), hc, defaultGitOpsNamespace)).To(Equal(argoCDInstanceRecheckInterval))
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionArgoCDAvailable)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(ArgoCDReasonNotInstalled))
+		Expect(testutil.ToFloat64(argoCDInstanceAvailable.WithLabelValues(defaultGitOpsNamespace))).To(BeZero())
+
+		Expect(c.Create(context.Background(), server(1))).To(Succeed())
+		// the detected instance is reused until it expires
+		Expect(r.reportArgoCDInstance(context.Background(), hc, defaultGitOpsNamespace)).To(Equal(argoCDInstanceRecheckInterval))
+		r.argoCDInstances = argoCDInstanceCache{}
+		Expect(r.reportArgoCDInstance(context.Background(), hc, defaultGitOpsNamespace)).To(BeZero())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionArgoCDAvailable)).To(BeTrue())
+		Expect(testutil.ToFloat64(argoCDInstanceAvailable.WithLabelValues(defaultGitOpsNamespace))).To(Equal(float64(1)))
+	})
+})
@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsAuthModeAnnotation selects how ArgoCD authenticates to the hosted cluster, it overrides the configured
+	// auth mode
+	hyperOpsAuthModeAnnotation = "hyper-ops.cloudmonkey.org/auth-mode"
+
+	// AuthModeServiceAccount authenticates with a token of the hyper-ops service account in kube-system of the hosted
+	// cluster, the default
+	AuthModeServiceAccount = "serviceAccount"
+	// AuthModeClientCertificate authenticates with the client certificate of the admin kubeconfig, no service account
+	// is created in the hosted cluster
+	AuthModeClientCertificate = "clientCertificate"
+	// AuthModeAWSExecProvider lets ArgoCD authenticate to HostedClusters on AWS with argocd-k8s-auth aws, no bearer
+	// token is written and no service account is created in the hosted cluster
+	AuthModeAWSExecProvider = "awsExecProvider"
+)
+
+// ValidateAuthMode returns an error if the auth mode is unknown
+func ValidateAuthMode(mode string) error {
+	switch mode {
+	case AuthModeServiceAccount, AuthModeClientCertificate, AuthModeAWSExecProvider:
+		return nil
+	}
+	return fmt.Errorf("unknown auth mode %q, must be %s, %s or %s", mode, AuthModeServiceAccount, AuthModeClientCertificate, AuthModeAWSExecProvider)
+}
+
+// authMode returns the auth mode of the HostedCluster, the annotation wins over the configured auth mode. A
+// configured AuthModeAWSExecProvider only applies to HostedClusters on AWS, the others use a service account.
+func (r *HyperOpsReconciler) authMode(hc *hypershiftv1beta1.HostedCluster) (string, error) {
+	if mode, ok := hc.GetAnnotations()[hyperOpsAuthModeAnnotation]; ok {
+		mode = strings.TrimSpace(mode)
+		if err := ValidateAuthMode(mode); err != nil {
+			return "", fmt.Errorf("invalid %s annotation: %w", hyperOpsAuthModeAnnotation, err)
+		}
+		if mode == AuthModeAWSExecProvider && hc.Spec.Platform.Type != hypershiftv1beta1.AWSPlatform {
+			return "", fmt.Errorf("the %s auth mode requires a HostedCluster on the %s platform", mode, hypershiftv1beta1.AWSPlatform)
+		}
+		return mode, nil
+	}
+	if r.AuthMode == AuthModeAWSExecProvider && hc.Spec.Platform.Type != hypershiftv1beta1.AWSPlatform {
+		return AuthModeServiceAccount, nil
+	}
+	if r.AuthMode != "" {
+		return r.AuthMode, nil
+	}
+	return AuthModeServiceAccount, nil
+}
+
+// setupClientCertificateClusterConfig returns the cluster config of the HostedCluster using the client certificate
+// of its admin kubeconfig. The service account of hyper-ops and its token are removed from the hosted cluster, so
+// no long-lived service account is left in kube-system.
+func (r *HyperOpsReconciler) setupClientCertificateClusterConfig(ctx context.Context, clnt client.Client, restConfig *rest.Config, server string, hc *hypershiftv1beta1.HostedCluster) (*Cluster, error) {
+	if len(restConfig.CertData) == 0 || len(restConfig.KeyData) == 0 {
+		return nil, fmt.Errorf("the admin kubeconfig has no embedded client certificate and key")
+	}
+	if name := hc.GetAnnotations()[hyperOpsClientCertificateSecretAnnotation]; name != "" {
+		return nil, fmt.Errorf("the %s annotation can't be combined with the %s auth mode", hyperOpsClientCertificateSecretAnnotation, AuthModeClientCertificate)
+	}
+	if err := r.removeServiceAccountCredentials(ctx, clnt); err != nil {
+		return nil, fmt.Errorf("unable to remove the service account of hyper-ops: %w", err)
+	}
+	return &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   hc.Name,
+			Server: server,
+			Config: argocd.ClusterConfig{
+				TLSClientConfig: argocd.TLSClientConfig{
+					CAData:   restConfig.CAData,
+					CertData: restConfig.CertData,
+					KeyData:  restConfig.KeyData,
+				},
+			},
+		},
+		HostedCluster: hc,
+	}, nil
+}
+
+// removeServiceAccountCredentials deletes the legacy token secret, the service account and the cluster role binding
+// hyper-ops created in the cluster of the client
+func (r *HyperOpsReconciler) removeServiceAccountCredentials(ctx context.Context, clnt client.Client) error {
+	if r.readOnly() {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := clnt.Get(ctx, client.ObjectKey{Namespace: hostedClusterServiceAccountNamespace, Name: legacyTokenSecretName}, secret); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	} else if secret.Labels[managedByLabel] == managedByValue {
+		log.FromContext(ctx).Info("removing the token of the service account of hyper-ops", "secret", client.ObjectKeyFromObject(secret))
+		if err := clnt.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return deleteHostedRBAC(ctx, clnt)
+}
+
+// verifyClientCertificate verifies that the client authenticates to its cluster. Any authenticated user may create
+// a SelfSubjectAccessReview, the request fails for an unknown or expired certificate.
+func verifyClientCertificate(ctx context.Context, c client.Client) error {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{Path: "/version", Verb: "get"},
+		},
+	}
+	if err := c.Create(ctx, review); err != nil {
+		return fmt.Errorf("unable to authenticate with the client certificate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Auth mode", func() {
+	var (
+		managed    = map[string]string{managedByLabel: managedByValue}
+		restConfig *rest.Config
+		hc         *hypershiftv1beta1.HostedCluster
+	)
+
+	BeforeEach(func() {
+		restConfig = &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca"), CertData: []byte("cert"), KeyData: []byte("key")}}
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	})
+
+	It("Should validate auth modes", func() {
+		Expect(ValidateAuthMode(AuthModeServiceAccount)).To(Succeed())
+		Expect(ValidateAuthMode(AuthModeClientCertificate)).To(Succeed())
+		Expect(ValidateAuthMode(AuthModeAWSExecProvider)).To(Succeed())
+		Expect(ValidateAuthMode("token")).NotTo(Succeed())
+	})
+
+	It("Should prefer the annotation over the configured auth mode", func() {
+		r := &HyperOpsReconciler{}
+		Expect(r.authMode(hc)).To(Equal(AuthModeServiceAccount))
+		r.AuthMode = AuthModeClientCertificate
+		Expect(r.authMode(hc)).To(Equal(AuthModeClientCertificate))
+		hc.Annotations = map[string]string{hyperOpsAuthModeAnnotation: AuthModeServiceAccount}
+		Expect(r.authMode(hc)).To(Equal(AuthModeServiceAccount))
+		hc.Annotations[hyperOpsAuthModeAnnotation] = "token"
+		_, err := r.authMode(hc)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should register with the client certificate of the admin kubeconfig and remove the service account", func() {
+		token := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: legacyTokenSecretName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName, Labels: managed}}
+		hostedClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(token, sa, crb).Build()
+		r := &HyperOpsReconciler{AuthMode: AuthModeClientCertificate}
+
+		cluster, err := r.setupClientCertificateClusterConfig(context.Background(), hostedClient, restConfig, "https://api.hosted:6443", hc)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := argocd.ClusterFromSecretData(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Config.BearerToken).To(BeEmpty())
+		Expect(parsed.Config.TLSClientConfig.CAData).To(Equal([]byte("ca")))
+		Expect(parsed.Config.TLSClientConfig.CertData).To(Equal([]byte("cert")))
+		Expect(parsed.Config.TLSClientConfig.KeyData).To(Equal([]byte("key")))
+		Expect(credentialFingerprints(cluster)).To(HaveKey(credentialClientCertificate))
+
+		for _, obj := range []client.Object{token, sa, crb} {
+			err := hostedClient.Get(context.Background(), client.ObjectKeyFromObject(obj), obj)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), client.ObjectKeyFromObject(obj).String())
+		}
+	})
+
+	It("Should refuse kubeconfigs without a client certificate and mTLS frontend certificates", func() {
+		hostedClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{AuthMode: AuthModeClientCertificate}
+
+		_, err := r.setupClientCertificateClusterConfig(context.Background(), hostedClient, &rest.Config{BearerToken: "token"}, "https://api.hosted:6443", hc)
+		Expect(err).To(MatchError(ContainSubstring("no embedded client certificate")))
+
+		hc.Annotations = map[string]string{hyperOpsClientCertificateSecretAnnotation: "frontend"}
+		_, err = r.setupClientCertificateClusterConfig(context.Background(), hostedClient, restConfig, "https://api.hosted:6443", hc)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should only use the AWS exec provider for HostedClusters on AWS", func() {
+		r := &HyperOpsReconciler{AuthMode: AuthModeAWSExecProvider}
+		Expect(r.authMode(hc)).To(Equal(AuthModeServiceAccount))
+		hc.Spec.Platform.Type = hypershiftv1beta1.AWSPlatform
+		Expect(r.authMode(hc)).To(Equal(AuthModeAWSExecProvider))
+
+		hc.Spec.Platform.Type = hypershiftv1beta1.KubevirtPlatform
+		hc.Annotations = map[string]string{hyperOpsAuthModeAnnotation: AuthModeAWSExecProvider}
+		_, err := r.authMode(hc)
+		Expect(err).To(MatchError(ContainSubstring("requires a HostedCluster on the AWS platform")))
+	})
+
+	It("Should register HostedClusters on AWS with argocd-k8s-auth and remove the service account", func() {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		hostedClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(sa).Build()
+		r := &HyperOpsReconciler{AuthMode: AuthModeAWSExecProvider, AWSRoleName: "argocd-deployer"}
+		hc.Spec.InfraID = "hosted-x7k2p"
+		hc.Spec.Platform = hypershiftv1beta1.PlatformSpec{
+			Type: hypershiftv1beta1.AWSPlatform,
+			AWS: &hypershiftv1beta1.AWSPlatformSpec{
+				Region:   "eu-north-1",
+				RolesRef: hypershiftv1beta1.AWSRolesRef{ControlPlaneOperatorARN: "arn:aws:iam::123456789012:role/hosted-control-plane-operator"},
+			},
+		}
+
+		cluster, err := r.setupAWSExecProviderClusterConfig(context.Background(), hostedClient, restConfig, "https://api.hosted:6443", hc)
+		Expect(err).NotTo(HaveOccurred())
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := argocd.ClusterFromSecretData(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Config.BearerToken).To(BeEmpty())
+		Expect(parsed.Config.TLSClientConfig.CAData).To(Equal([]byte("ca")))
+		Expect(parsed.Config.TLSClientConfig.CertData).To(BeEmpty())
+		Expect(parsed.Config.ExecProviderConfig).To(Equal(&argocd.ExecProviderConfig{
+			Command:     "argocd-k8s-auth",
+			Args:        []string{"aws", "--cluster-name", "hosted-x7k2p", "--role-arn", "arn:aws:iam::123456789012:role/argocd-deployer"},
+			Env:         map[string]string{"AWS_REGION": "eu-north-1"},
+			APIVersion:  "client.authentication.k8s.io/v1beta1",
+			InstallHint: "argocd-k8s-auth is part of the ArgoCD image",
+		}))
+		err = hostedClient.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		// the annotation wins, without a role name the identity of the ArgoCD pods is used
+		hc.Annotations = map[string]string{hyperOpsAWSRoleARNAnnotation: "arn:aws-us-gov:iam::210987654321:role/deployer"}
+		Expect(awsRoleARN(hc, "argocd-deployer")).To(Equal("arn:aws-us-gov:iam::210987654321:role/deployer"))
+		hc.Annotations = nil
+		Expect(awsRoleARN(hc, "")).To(BeEmpty())
+		hc.Spec.Platform.AWS.RolesRef = hypershiftv1beta1.AWSRolesRef{}
+		_, err = awsRoleARN(hc, "argocd-deployer")
+		Expect(err).To(HaveOccurred())
+		hc.Annotations = map[string]string{hyperOpsAWSRoleARNAnnotation: "deployer"}
+		_, err = awsRoleARN(hc, "")
+		Expect(err).To(HaveOccurred())
+	})
+})
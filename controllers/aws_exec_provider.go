@@ -0,0 +1,129 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsAWSRoleARNAnnotation is the IAM role argocd-k8s-auth assumes to authenticate to the HostedCluster, it
+	// overrides the role derived from the AWS account of the HostedCluster
+	hyperOpsAWSRoleARNAnnotation = "hyper-ops.cloudmonkey.org/aws-role-arn"
+
+	// argoCDK8sAuthCommand is the credential helper shipped with ArgoCD
+	argoCDK8sAuthCommand = "argocd-k8s-auth"
+	// execCredentialAPIVersion is the ExecCredential version argocd-k8s-auth returns
+	execCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+)
+
+var (
+	awsRoleNamePattern = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+	awsRoleARNPattern  = regexp.MustCompile(`^arn:[a-z-]+:iam::\d{12}:role/.+$`)
+)
+
+// ValidateAWSRoleName returns an error if the name is not a valid IAM role name, an empty name is valid
+func ValidateAWSRoleName(name string) error {
+	if name != "" && !awsRoleNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid IAM role name %q", name)
+	}
+	return nil
+}
+
+// awsRoleARN returns the IAM role argocd-k8s-auth assumes for the HostedCluster. The annotation wins, otherwise
+// the role name is qualified with the partition and account of the roles of the HostedCluster. It is empty without
+// a role name, argocd-k8s-auth then uses the identity of the ArgoCD pods.
+func awsRoleARN(hc *hypershiftv1beta1.HostedCluster, roleName string) (string, error) {
+	if arn := strings.TrimSpace(hc.GetAnnotations()[hyperOpsAWSRoleARNAnnotation]); arn != "" {
+		if !awsRoleARNPattern.MatchString(arn) {
+			return "", fmt.Errorf("invalid %s annotation %q, must be the ARN of an IAM role", hyperOpsAWSRoleARNAnnotation, arn)
+		}
+		return arn, nil
+	}
+	if roleName == "" {
+		return "", nil
+	}
+	roles := hc.Spec.Platform.AWS.RolesRef
+	for _, arn := range []string{roles.ControlPlaneOperatorARN, roles.NodePoolManagementARN, roles.KubeCloudControllerARN,
+		roles.NetworkARN, roles.StorageARN, roles.ImageRegistryARN, roles.IngressARN} {
+		// arn:partition:service:region:account:resource
+		if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 && parts[4] != "" {
+			return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], roleName), nil
+		}
+	}
+	return "", fmt.Errorf("unable to derive the AWS account of the HostedCluster from its roles, set the %s annotation", hyperOpsAWSRoleARNAnnotation)
+}
+
+// awsExecProviderConfig returns the exec provider running argocd-k8s-auth aws for the HostedCluster, the cluster is
+// known to AWS by its infraID
+func awsExecProviderConfig(hc *hypershiftv1beta1.HostedCluster, roleARN string) *argocd.ExecProviderConfig {
+	args := []string{"aws", "--cluster-name", hc.Spec.InfraID}
+	if roleARN != "" {
+		args = append(args, "--role-arn", roleARN)
+	}
+	config := &argocd.ExecProviderConfig{
+		Command:     argoCDK8sAuthCommand,
+		Args:        args,
+		APIVersion:  execCredentialAPIVersion,
+		InstallHint: "argocd-k8s-auth is part of the ArgoCD image",
+	}
+	if region := hc.Spec.Platform.AWS.Region; region != "" {
+		config.Env = map[string]string{"AWS_REGION": region}
+	}
+	return config
+}
+
+// setupAWSExecProviderClusterConfig returns the cluster config of a HostedCluster on AWS authenticating with
+// argocd-k8s-auth aws. Like the client certificate auth mode, the service account of hyper-ops and its token are
+// removed from the hosted cluster. The credential is only available to ArgoCD and is not verified.
+func (r *HyperOpsReconciler) setupAWSExecProviderClusterConfig(ctx context.Context, clnt client.Client, restConfig *rest.Config, server string, hc *hypershiftv1beta1.HostedCluster) (*Cluster, error) {
+	if hc.Spec.Platform.AWS == nil {
+		return nil, fmt.Errorf("the HostedCluster has no AWS platform spec")
+	}
+	if name := hc.GetAnnotations()[hyperOpsClientCertificateSecretAnnotation]; name != "" {
+		return nil, fmt.Errorf("the %s annotation can't be combined with the %s auth mode", hyperOpsClientCertificateSecretAnnotation, AuthModeAWSExecProvider)
+	}
+	roleARN, err := awsRoleARN(hc, r.AWSRoleName)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.removeServiceAccountCredentials(ctx, clnt); err != nil {
+		return nil, fmt.Errorf("unable to remove the service account of hyper-ops: %w", err)
+	}
+	return &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   hc.Name,
+			Server: server,
+			Config: argocd.ClusterConfig{
+				TLSClientConfig: argocd.TLSClientConfig{
+					CAData: restConfig.CAData,
+				},
+				ExecProviderConfig: awsExecProviderConfig(hc, roleARN),
+			},
+		},
+		HostedCluster: hc,
+	}, nil
+}
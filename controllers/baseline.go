@@ -0,0 +1,186 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// BaselineApplicationSetName is the name of the ApplicationSet deploying the baseline to the hosted clusters
+	BaselineApplicationSetName = "hyper-ops-baseline"
+	// DefaultBaselineProject is the AppProject of the baseline Applications
+	DefaultBaselineProject = "default"
+	// baselineApplicationSetResyncInterval is how often a missing or, if maintained, drifted ApplicationSet is reverted
+	baselineApplicationSetResyncInterval = 10 * time.Minute
+)
+
+var applicationSetGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "ApplicationSet"}
+
+// BaselineApplicationSet is the git source of the baseline every hosted cluster receives once it is registered
+type BaselineApplicationSet struct {
+	RepoURL string
+	// Path of the manifests within the repository, ApplicationSet parameters such as {{name}} are substituted per
+	// cluster
+	Path           string
+	TargetRevision string
+	// Namespace on the hosted clusters the manifests are deployed to
+	Namespace string
+	// Project is the AppProject of the generated Applications, DefaultBaselineProject if empty
+	Project string
+	// AutoSync enables automated sync with pruning and self healing of the generated Applications
+	AutoSync bool
+	// Maintain reverts changes to the ApplicationSet, otherwise it is only created if missing and then left to its
+	// users
+	Maintain bool
+	// GitOpsNamespace is the namespace of the ApplicationSet, the default gitops namespace if empty
+	GitOpsNamespace string
+	// LabelSchema is the schema of the excluded label the cluster generator skips
+	LabelSchema LabelSchema
+}
+
+// BaselineApplicationSetManager keeps an ApplicationSet generating an Application per hosted cluster registered by
+// hyper-ops, so newly onboarded clusters receive the baseline without further ArgoCD configuration
+type BaselineApplicationSetManager struct {
+	Client         client.Client
+	ApplicationSet BaselineApplicationSet
+}
+
+// Start applies the baseline ApplicationSet and re-applies it periodically until the context is cancelled
+func (b *BaselineApplicationSetManager) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("baseline-applicationset")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := b.apply(ctx); err != nil {
+			log.Error(err, "unable to apply baseline applicationset")
+		}
+	}, baselineApplicationSetResyncInterval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader writes the baseline ApplicationSet
+func (b *BaselineApplicationSetManager) NeedLeaderElection() bool {
+	return true
+}
+
+func (b *BaselineApplicationSetManager) apply(ctx context.Context) error {
+	desired := BaselineApplicationSetObject(b.ApplicationSet)
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationSetGVK)
+	obj.SetNamespace(desired.GetNamespace())
+	obj.SetName(desired.GetName())
+	if !b.ApplicationSet.Maintain {
+		if err := b.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); !apierrors.IsNotFound(err) {
+			return err
+		}
+		stampManaged(desired, "")
+		if err := b.Client.Create(ctx, desired); client.IgnoreAlreadyExists(err) != nil {
+			return fmt.Errorf("unable to create ApplicationSet %s/%s: %w", desired.GetNamespace(), desired.GetName(), err)
+		}
+		return nil
+	}
+	if _, err := CreateOrUpdateWithRetries(ctx, b.Client, obj, func() error {
+		obj.SetLabels(mergeLabels(obj.GetLabels(), desired.GetLabels()))
+		stampManaged(obj, "")
+		obj.Object["spec"] = desired.Object["spec"]
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to apply ApplicationSet %s/%s: %w", desired.GetNamespace(), desired.GetName(), err)
+	}
+	return nil
+}
+
+// BaselineApplicationSetObject renders the ApplicationSet deploying the baseline to every hosted cluster registered
+// by hyper-ops that is not excluded
+func BaselineApplicationSetObject(set BaselineApplicationSet) *unstructured.Unstructured {
+	project := set.Project
+	if project == "" {
+		project = DefaultBaselineProject
+	}
+	revision := set.TargetRevision
+	if revision == "" {
+		revision = DefaultPlatformRevision
+	}
+	namespace := set.GitOpsNamespace
+	if namespace == "" {
+		namespace = defaultGitOpsNamespace
+	}
+
+	syncPolicy := map[string]interface{}{
+		"syncOptions": []interface{}{"CreateNamespace=true"},
+	}
+	if set.AutoSync {
+		syncPolicy["automated"] = map[string]interface{}{
+			"prune":    true,
+			"selfHeal": true,
+		}
+	}
+	spec := map[string]interface{}{
+		"generators": []interface{}{
+			map[string]interface{}{
+				"clusters": map[string]interface{}{
+					"selector": map[string]interface{}{
+						"matchLabels": map[string]interface{}{hyperOpsTypeLabel: "hosted"},
+						"matchExpressions": []interface{}{
+							map[string]interface{}{"key": set.LabelSchema.Key(hyperOpsExcludedLabel), "operator": "DoesNotExist"},
+						},
+					},
+				},
+			},
+		},
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":   "{{name}}-baseline",
+				"labels": map[string]interface{}{managedByLabel: managedByValue},
+			},
+			"spec": map[string]interface{}{
+				"project": project,
+				"source": map[string]interface{}{
+					"repoURL":        set.RepoURL,
+					"path":           set.Path,
+					"targetRevision": revision,
+				},
+				"destination": map[string]interface{}{
+					"server":    "{{server}}",
+					"namespace": set.Namespace,
+				},
+				"syncPolicy": syncPolicy,
+			},
+		},
+		// deleting the ApplicationSet or deregistering a cluster never removes the baseline from the hosted clusters
+		"syncPolicy": map[string]interface{}{
+			"preserveResourcesOnDeletion": true,
+		},
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(applicationSetGVK)
+	obj.SetNamespace(namespace)
+	obj.SetName(BaselineApplicationSetName)
+	obj.SetLabels(managedLabels(map[string]string{
+		"app.kubernetes.io/part-of": "hyper-ops",
+	}))
+	return obj
+}
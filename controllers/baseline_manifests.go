@@ -0,0 +1,300 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/oci"
+)
+
+const (
+	// ConditionBaselineManifestsApplied is true when the baseline manifests are applied to the hosted cluster
+	ConditionBaselineManifestsApplied = "BaselineManifestsApplied"
+
+	// baselineManifestsResyncInterval is how often the baseline manifests are applied again to revert drift
+	baselineManifestsResyncInterval = 10 * time.Minute
+	// baselineArtifactRefreshInterval is how often the tag of the baseline artifact is resolved again
+	baselineArtifactRefreshInterval = 5 * time.Minute
+)
+
+// BaselineManifests are the manifests applied into every registered hosted cluster right after its registration,
+// e.g. namespaces, RBAC, OperatorGroups and pull secrets the first sync of ArgoCD relies on
+type BaselineManifests struct {
+	// ConfigMap on the hub holding the manifests in its keys ending in .yaml, .yml or .json
+	ConfigMap client.ObjectKey
+	// OCIArtifact is the reference of an OCI artifact whose YAML or JSON layers hold the manifests
+	OCIArtifact string
+}
+
+func (b BaselineManifests) enabled() bool {
+	return b.ConfigMap.Name != "" || b.OCIArtifact != ""
+}
+
+// source describes where the manifests are read from
+func (b BaselineManifests) source() string {
+	sources := []string{}
+	if b.ConfigMap.Name != "" {
+		sources = append(sources, "ConfigMap "+b.ConfigMap.String())
+	}
+	if b.OCIArtifact != "" {
+		sources = append(sources, "artifact "+b.OCIArtifact)
+	}
+	return strings.Join(sources, " and ")
+}
+
+// ParseBaselineManifestsConfigMap parses the <namespace>/<name> reference of the ConfigMap of the baseline manifests
+func ParseBaselineManifestsConfigMap(raw string) (client.ObjectKey, error) {
+	if raw == "" {
+		return client.ObjectKey{}, nil
+	}
+	namespace, name, ok := strings.Cut(raw, "/")
+	if !ok || namespace == "" || name == "" {
+		return client.ObjectKey{}, fmt.Errorf("invalid baseline manifests ConfigMap %q, must be <namespace>/<name>", raw)
+	}
+	return client.ObjectKey{Namespace: namespace, Name: name}, nil
+}
+
+// ValidateBaselineManifestsArtifact returns an error if the reference of the baseline artifact is invalid
+func ValidateBaselineManifestsArtifact(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	_, err := oci.ParseReference(raw)
+	return err
+}
+
+var (
+	// baselineApplied records the hash of the baseline manifests last applied to a HostedCluster and when
+	baselineApplied   = map[client.ObjectKey]baselineApplication{}
+	baselineAppliedMu sync.Mutex
+
+	// baselineArtifacts caches the pulled baseline artifacts by reference
+	baselineArtifacts   = map[string]baselineArtifact{}
+	baselineArtifactsMu sync.Mutex
+
+	// baselinePuller pulls the baseline artifacts
+	baselinePuller = &oci.Puller{}
+)
+
+type baselineApplication struct {
+	hash string
+	at   time.Time
+}
+
+type baselineArtifact struct {
+	content  []byte
+	pulledAt time.Time
+}
+
+// reconcileBaselineManifests applies the baseline manifests to the hosted cluster. They are applied again when they
+// change and every baselineManifestsResyncInterval, so drift is reverted without writing to every hosted cluster on
+// every reconcile.
+func (r *HyperOpsReconciler) reconcileBaselineManifests(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, hostedClient client.Client) error {
+	if !r.BaselineManifests.enabled() || r.readOnly() {
+		return nil
+	}
+	raw, err := r.baselineManifestsContent(ctx)
+	if err != nil {
+		return r.baselineManifestsFailed(ctx, hc, "SourceUnavailable", err)
+	}
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])
+	key := client.ObjectKeyFromObject(hc)
+	baselineAppliedMu.Lock()
+	last, ok := baselineApplied[key]
+	baselineAppliedMu.Unlock()
+	if ok && last.hash == hash && time.Since(last.at) < baselineManifestsResyncInterval {
+		return nil
+	}
+	manifests, err := decodeManifests(bytes.NewReader(raw))
+	if err != nil {
+		return r.baselineManifestsFailed(ctx, hc, "InvalidManifests", err)
+	}
+	// namespaces first, so the objects in them can be created in the same pass
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return manifests[i].GetKind() == "Namespace" && manifests[j].GetKind() != "Namespace"
+	})
+	if err := applyManifests(ctx, hostedClient, manifests, metav1.NamespaceDefault, correlationID(hc)); err != nil {
+		return r.baselineManifestsFailed(ctx, hc, "ApplyFailed", err)
+	}
+	baselineAppliedMu.Lock()
+	baselineApplied[key] = baselineApplication{hash: hash, at: time.Now()}
+	baselineAppliedMu.Unlock()
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionBaselineManifestsApplied,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Applied",
+		Message: fmt.Sprintf("%d manifests of %s applied", len(manifests), r.BaselineManifests.source()),
+	})
+}
+
+// baselineManifestsFailed reports the failure in the BaselineManifestsApplied condition and returns it, so the
+// registration is retried
+func (r *HyperOpsReconciler) baselineManifestsFailed(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, reason string, err error) error {
+	if cerr := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionBaselineManifestsApplied,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	}); cerr != nil {
+		return cerr
+	}
+	return fmt.Errorf("unable to apply the baseline manifests: %w", err)
+}
+
+// baselineManifestsContent returns the manifests of the ConfigMap, in the order of its keys, followed by the layers
+// of the artifact as a single YAML stream
+func (r *HyperOpsReconciler) baselineManifestsContent(ctx context.Context) ([]byte, error) {
+	docs := [][]byte{}
+	if r.BaselineManifests.ConfigMap.Name != "" {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, r.BaselineManifests.ConfigMap, cm); err != nil {
+			return nil, fmt.Errorf("unable to read the ConfigMap %s: %w", r.BaselineManifests.ConfigMap, err)
+		}
+		keys := []string{}
+		for k := range cm.Data {
+			if strings.HasSuffix(k, ".yaml") || strings.HasSuffix(k, ".yml") || strings.HasSuffix(k, ".json") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			docs = append(docs, []byte(cm.Data[k]))
+		}
+	}
+	if r.BaselineManifests.OCIArtifact != "" {
+		content, err := pullBaselineArtifact(ctx, r.BaselineManifests.OCIArtifact)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, content)
+	}
+	return bytes.Join(docs, []byte("\n---\n")), nil
+}
+
+// pullBaselineArtifact returns the YAML and JSON layers of the artifact, pulled at most every
+// baselineArtifactRefreshInterval so a moved tag is picked up without pulling for every HostedCluster
+func pullBaselineArtifact(ctx context.Context, raw string) ([]byte, error) {
+	baselineArtifactsMu.Lock()
+	defer baselineArtifactsMu.Unlock()
+	if cached, ok := baselineArtifacts[raw]; ok && time.Since(cached.pulledAt) < baselineArtifactRefreshInterval {
+		return cached.content, nil
+	}
+	ref, err := oci.ParseReference(raw)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := baselinePuller.Pull(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	docs := [][]byte{}
+	for _, layer := range artifact.Layers {
+		if !strings.Contains(layer.MediaType, "yaml") && !strings.Contains(layer.MediaType, "json") {
+			return nil, fmt.Errorf("layer %s of %s has the unsupported media type %q, push the manifests as application/yaml", layer.Digest, raw, layer.MediaType)
+		}
+		docs = append(docs, layer.Content)
+	}
+	content := bytes.Join(docs, []byte("\n---\n"))
+	baselineArtifacts[raw] = baselineArtifact{content: content, pulledAt: time.Now()}
+	return content, nil
+}
+
+// decodeManifests parses a stream of YAML or JSON documents, empty documents are skipped
+func decodeManifests(r io.Reader) ([]unstructured.Unstructured, error) {
+	manifests := []unstructured.Unstructured{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		obj := unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				return manifests, nil
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest %d has no kind or name", len(manifests)+1)
+		}
+		manifests = append(manifests, obj)
+	}
+}
+
+// applyManifests creates or updates the objects of the manifests through the client, namespaced objects without a
+// namespace are applied to the namespace like kubectl apply -n. The scope of every object is looked up with the REST
+// mapper of the client. Labels and annotations added by others are kept, the rest of the objects is reverted to the
+// manifests.
+func applyManifests(ctx context.Context, clnt client.Client, manifests []unstructured.Unstructured, namespace, correlationID string) error {
+	for i := range manifests {
+		desired := manifests[i].DeepCopy()
+		gvk := desired.GroupVersionKind()
+		mapping, err := clnt.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("unable to map %s %s: %w", gvk.Kind, desired.GetName(), err)
+		}
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName(desired.GetName())
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			obj.SetNamespace(desired.GetNamespace())
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+		}
+		if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, obj, func() error {
+			for k, v := range desired.Object {
+				if k != "metadata" && k != "status" {
+					obj.Object[k] = v
+				}
+			}
+			obj.SetLabels(mergeLabels(obj.GetLabels(), desired.GetLabels()))
+			annotations := obj.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			for k, v := range desired.GetAnnotations() {
+				annotations[k] = v
+			}
+			obj.SetAnnotations(annotations)
+			stampManaged(obj, correlationID)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("unable to apply %s %s: %w", gvk.Kind, desired.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/oci"
+)
+
+var _ = Describe("Baseline manifests", func() {
+	var (
+		hc     *hypershiftv1beta1.HostedCluster
+		hosted client.Client
+	)
+
+	BeforeEach(func() {
+		baselineApplied = map[client.ObjectKey]baselineApplication{}
+		baselineArtifacts = map[string]baselineArtifact{}
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+		mapper.Add(rbacv1.SchemeGroupVersion.WithKind("RoleBinding"), meta.RESTScopeNamespace)
+		hosted = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).Build()
+	})
+
+	It("Should parse the ConfigMap and artifact references", func() {
+		key, err := ParseBaselineManifestsConfigMap("hyper-ops/baseline")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(client.ObjectKey{Namespace: "hyper-ops", Name: "baseline"}))
+		key, err = ParseBaselineManifestsConfigMap("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Name).To(BeEmpty())
+		_, err = ParseBaselineManifestsConfigMap("baseline")
+		Expect(err).To(HaveOccurred())
+
+		Expect(ValidateBaselineManifestsArtifact("quay.io/example/baseline:v1")).To(Succeed())
+		Expect(ValidateBaselineManifestsArtifact("baseline")).NotTo(Succeed())
+	})
+
+	It("Should apply the manifests of the ConfigMap into the hosted cluster", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline", Namespace: "hyper-ops"},
+			Data: map[string]string{
+				// applied after the namespace although its key sorts first
+				"a-rbac.yaml": `apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: gitops-admin
+  namespace: team-a
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: admin
+subjects:
+- kind: ServiceAccount
+  name: argocd-application-controller
+  namespace: openshift-gitops
+`,
+				"b-namespace.yml": `apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  labels:
+    argocd.argoproj.io/managed-by: openshift-gitops
+`,
+				"c-pull-secret.json": `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"pull-secret"},"type":"Opaque","stringData":{"token":"abc"}}`,
+				"README.md":          "not a manifest",
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, cm).Build()
+		r := &HyperOpsReconciler{Client: c, BaselineManifests: BaselineManifests{ConfigMap: client.ObjectKeyFromObject(cm)}}
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).To(Succeed())
+
+		ns := &corev1.Namespace{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "team-a"}, ns)).To(Succeed())
+		Expect(ns.Labels).To(HaveKeyWithValue("argocd.argoproj.io/managed-by", "openshift-gitops"))
+		Expect(ns.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: "team-a", Name: "gitops-admin"}, &rbacv1.RoleBinding{})).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: metav1.NamespaceDefault, Name: "pull-secret"}, &corev1.Secret{})).To(Succeed())
+
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionBaselineManifestsApplied)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Message).To(ContainSubstring("3 manifests"))
+
+		By("not writing unchanged manifests again before the resync")
+		Expect(hosted.Delete(context.Background(), ns)).To(Succeed())
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "team-a"}, ns)).NotTo(Succeed())
+
+		By("applying changed manifests right away")
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(cm), cm)).To(Succeed())
+		delete(cm.Data, "a-rbac.yaml")
+		Expect(c.Update(context.Background(), cm)).To(Succeed())
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "team-a"}, ns)).To(Succeed())
+	})
+
+	It("Should report a missing source", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c, BaselineManifests: BaselineManifests{ConfigMap: client.ObjectKey{Namespace: "hyper-ops", Name: "missing"}}}
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).NotTo(Succeed())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionBaselineManifestsApplied)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("SourceUnavailable"))
+	})
+
+	It("Should apply the YAML layers of an OCI artifact", func() {
+		layer := []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: team-b\n")
+		sum := sha256.Sum256(layer)
+		layerDigest := "sha256:" + hex.EncodeToString(sum[:])
+		pulls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/example/baseline/manifests/v1":
+				pulls++
+				w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+				fmt.Fprintf(w, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"mediaType":"application/yaml","digest":%q,"size":%d}]}`, layerDigest, len(layer))
+			case "/v2/example/baseline/blobs/" + layerDigest:
+				_, _ = w.Write(layer)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+		defer func(p *oci.Puller) { baselinePuller = p }(baselinePuller)
+		baselinePuller = &oci.Puller{PlainHTTP: true}
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		artifact := strings.TrimPrefix(srv.URL, "http://") + "/example/baseline:v1"
+		r := &HyperOpsReconciler{Client: c, BaselineManifests: BaselineManifests{OCIArtifact: artifact}}
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "team-b"}, &corev1.Namespace{})).To(Succeed())
+
+		By("pulling the artifact once for all HostedClusters")
+		other := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "clusters"}}
+		Expect(c.Create(context.Background(), other)).To(Succeed())
+		Expect(r.reconcileBaselineManifests(context.Background(), other, hosted)).To(Succeed())
+		Expect(pulls).To(Equal(1))
+	})
+
+	It("Should do nothing without a source", func() {
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()}
+		Expect(r.reconcileBaselineManifests(context.Background(), hc, hosted)).To(Succeed())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionBaselineManifestsApplied)).To(BeNil())
+	})
+})
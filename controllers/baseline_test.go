@@ -0,0 +1,90 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Baseline ApplicationSet", func() {
+	baseline := BaselineApplicationSet{RepoURL: "https://git.example.com/baseline.git", Path: "clusters/{{name}}", Namespace: "baseline"}
+	key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: BaselineApplicationSetName}
+	revision := func(obj *unstructured.Unstructured) string {
+		revision, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "source", "targetRevision")
+		return revision
+	}
+
+	It("Should generate an Application per registered hosted cluster that is not excluded", func() {
+		obj := BaselineApplicationSetObject(baseline)
+		Expect(obj.GetKind()).To(Equal("ApplicationSet"))
+		Expect(obj.GetNamespace()).To(Equal(defaultGitOpsNamespace))
+		Expect(obj.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		generators, _, _ := unstructured.NestedSlice(obj.Object, "spec", "generators")
+		Expect(generators).To(HaveLen(1))
+		matchLabels, _, _ := unstructured.NestedStringMap(generators[0].(map[string]interface{}), "clusters", "selector", "matchLabels")
+		Expect(matchLabels).To(Equal(map[string]string{hyperOpsTypeLabel: "hosted"}))
+		expressions, _, _ := unstructured.NestedSlice(generators[0].(map[string]interface{}), "clusters", "selector", "matchExpressions")
+		Expect(expressions).To(ConsistOf(map[string]interface{}{"key": hyperOpsExcludedLabel, "operator": "DoesNotExist"}))
+
+		path, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "source", "path")
+		Expect(path).To(Equal("clusters/{{name}}"))
+		Expect(revision(obj)).To(Equal(DefaultPlatformRevision))
+		server, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "destination", "server")
+		Expect(server).To(Equal("{{server}}"))
+		project, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "project")
+		Expect(project).To(Equal(DefaultBaselineProject))
+		_, found, _ := unstructured.NestedMap(obj.Object, "spec", "template", "spec", "syncPolicy", "automated")
+		Expect(found).To(BeFalse())
+		preserve, _, _ := unstructured.NestedBool(obj.Object, "spec", "syncPolicy", "preserveResourcesOnDeletion")
+		Expect(preserve).To(BeTrue())
+
+		v2 := baseline
+		v2.LabelSchema = LabelSchema{Version: LabelSchemaV2, KeepPrevious: true}
+		generators, _, _ = unstructured.NestedSlice(BaselineApplicationSetObject(v2).Object, "spec", "generators")
+		expressions, _, _ = unstructured.NestedSlice(generators[0].(map[string]interface{}), "clusters", "selector", "matchExpressions")
+		Expect(expressions).To(ConsistOf(map[string]interface{}{"key": "v2.hyper-ops.cloudmonkey.org/excluded", "operator": "DoesNotExist"}))
+	})
+
+	It("Should only create a missing ApplicationSet unless it is maintained", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		b := &BaselineApplicationSetManager{Client: c, ApplicationSet: baseline}
+		Expect(b.apply(context.Background())).To(Succeed())
+
+		set := &unstructured.Unstructured{}
+		set.SetGroupVersionKind(applicationSetGVK)
+		Expect(c.Get(context.Background(), key, set)).To(Succeed())
+		Expect(unstructured.SetNestedField(set.Object, "main", "spec", "template", "spec", "source", "targetRevision")).To(Succeed())
+		Expect(c.Update(context.Background(), set)).To(Succeed())
+
+		Expect(b.apply(context.Background())).To(Succeed())
+		Expect(c.Get(context.Background(), key, set)).To(Succeed())
+		Expect(revision(set)).To(Equal("main"))
+
+		By("maintaining the ApplicationSet")
+		b.ApplicationSet.Maintain = true
+		Expect(b.apply(context.Background())).To(Succeed())
+		Expect(c.Get(context.Background(), key, set)).To(Succeed())
+		Expect(revision(set)).To(Equal(DefaultPlatformRevision))
+	})
+})
@@ -0,0 +1,155 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Every registered cluster can get a root Application of an app-of-apps, deploying the rest of its configuration.
+// The root Application is written along with the ArgoCD cluster secret and removed with it.
+
+const (
+	// bootstrapApplicationSuffix is appended to the name of the ArgoCD cluster secret to name the root Application
+	bootstrapApplicationSuffix = "-bootstrap"
+	// DefaultBootstrapProject is the AppProject of the root Applications
+	DefaultBootstrapProject = "default"
+)
+
+// BootstrapApplication is the git source of the root Application created for every registered cluster. {{name}} and
+// {{server}} in the path and the values are replaced with the name and server of the ArgoCD cluster.
+type BootstrapApplication struct {
+	RepoURL        string
+	Path           string
+	TargetRevision string
+	// Values are Helm values, the source is rendered as a Helm chart when set
+	Values string
+	// Project is the AppProject of the root Applications
+	Project string
+	// Namespace on the hosted clusters the manifests are deployed to
+	Namespace string
+	// AutoSync enables automated sync with pruning and self healing
+	AutoSync bool
+}
+
+// bootstrapApplicationName returns the name of the root Application of the ArgoCD cluster secret
+func bootstrapApplicationName(secretName string) string {
+	return secretName + bootstrapApplicationSuffix
+}
+
+// BootstrapApplicationObject renders the root Application deploying the bootstrap source to the cluster
+func BootstrapApplicationObject(app BootstrapApplication, key client.ObjectKey, clusterName, server string) *unstructured.Unstructured {
+	parameters := strings.NewReplacer("{{name}}", clusterName, "{{server}}", server)
+	revision := app.TargetRevision
+	if revision == "" {
+		revision = DefaultPlatformRevision
+	}
+	project := app.Project
+	if project == "" {
+		project = DefaultBootstrapProject
+	}
+	source := map[string]interface{}{
+		"repoURL":        app.RepoURL,
+		"path":           parameters.Replace(app.Path),
+		"targetRevision": revision,
+	}
+	if app.Values != "" {
+		source["helm"] = map[string]interface{}{"values": parameters.Replace(app.Values)}
+	}
+	destination := map[string]interface{}{"server": server}
+	if app.Namespace != "" {
+		destination["namespace"] = app.Namespace
+	}
+	syncPolicy := map[string]interface{}{
+		"syncOptions": []interface{}{"CreateNamespace=true"},
+	}
+	if app.AutoSync {
+		syncPolicy["automated"] = map[string]interface{}{
+			"prune":    true,
+			"selfHeal": true,
+		}
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{
+		"project":     project,
+		"source":      source,
+		"destination": destination,
+		"syncPolicy":  syncPolicy,
+	}}}
+	obj.SetGroupVersionKind(applicationGVK)
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+	obj.SetLabels(managedLabels(map[string]string{
+		"app.kubernetes.io/part-of": "hyper-ops",
+	}))
+	return obj
+}
+
+// reconcileBootstrapApplication maintains the root Application of the registered cluster next to its ArgoCD cluster
+// secret, changes to its spec are reverted
+func (r *HyperOpsReconciler) reconcileBootstrapApplication(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	if r.Bootstrap.RepoURL == "" || r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	key := client.ObjectKey{Namespace: cluster.GitOpsNamespace, Name: bootstrapApplicationName(hc.Name)}
+	app := r.Bootstrap
+	// the automated sync is restored once the release rollout completed
+	if r.syncPaused(hc) {
+		app.AutoSync = false
+	}
+	desired := BootstrapApplicationObject(app, key, cluster.Name, cluster.Server)
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationGVK)
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, r.Client, obj, func() error {
+		obj.SetLabels(mergeLabels(obj.GetLabels(), desired.GetLabels()))
+		stampManaged(obj, correlationID(hc))
+		annotations := obj.GetAnnotations()
+		annotations[hyperOpsHostedClusterAnnotation] = client.ObjectKeyFromObject(hc).String()
+		obj.SetAnnotations(annotations)
+		obj.Object["spec"] = desired.Object["spec"]
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to apply the bootstrap Application %s: %w", key, err)
+	}
+	return nil
+}
+
+// removeBootstrapApplication deletes the root Application of the HostedCluster. It has no resources finalizer, the
+// resources it deployed are left on the cluster.
+func (r *HyperOpsReconciler) removeBootstrapApplication(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationGVK)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: bootstrapApplicationName(hc.Name)}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if obj.GetLabels()[managedByLabel] != managedByValue ||
+		obj.GetAnnotations()[hyperOpsHostedClusterAnnotation] != client.ObjectKeyFromObject(hc).String() {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Bootstrap Application", func() {
+	const server = "https://api.hosted.example.com:6443"
+
+	bootstrap := BootstrapApplication{
+		RepoURL: "https://git.example.com/bootstrap.git",
+		Path:    "clusters/{{name}}",
+		Values:  "cluster:\n  server: {{server}}\n",
+	}
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: server}, GitOpsNamespace: defaultGitOpsNamespace}
+	key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted-bootstrap"}
+	getApplication := func(c client.Client) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(applicationGVK)
+		return obj, c.Get(context.Background(), key, obj)
+	}
+
+	It("Should render a root Application targeting the cluster", func() {
+		obj := BootstrapApplicationObject(bootstrap, key, cluster.Name, cluster.Server)
+		Expect(obj.GetKind()).To(Equal("Application"))
+		Expect(obj.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		source, _, _ := unstructured.NestedMap(obj.Object, "spec", "source")
+		Expect(source).To(Equal(map[string]interface{}{
+			"repoURL":        "https://git.example.com/bootstrap.git",
+			"path":           "clusters/hosted",
+			"targetRevision": DefaultPlatformRevision,
+			"helm":           map[string]interface{}{"values": "cluster:\n  server: " + server + "\n"},
+		}))
+		destination, _, _ := unstructured.NestedMap(obj.Object, "spec", "destination")
+		Expect(destination).To(Equal(map[string]interface{}{"server": server}))
+		project, _, _ := unstructured.NestedString(obj.Object, "spec", "project")
+		Expect(project).To(Equal(DefaultBootstrapProject))
+		_, found, _ := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+		Expect(found).To(BeFalse())
+
+		plain := bootstrap
+		plain.Values = ""
+		_, found, _ = unstructured.NestedMap(BootstrapApplicationObject(plain, key, cluster.Name, cluster.Server).Object, "spec", "source", "helm")
+		Expect(found).To(BeFalse())
+	})
+
+	It("Should maintain the root Application of a registered cluster and remove it with the registration", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, Bootstrap: bootstrap}
+		Expect(r.reconcileBootstrapApplication(context.Background(), hc, cluster)).To(Succeed())
+		obj, err := getApplication(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetAnnotations()).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+
+		By("reverting changes to the spec")
+		Expect(unstructured.SetNestedField(obj.Object, "main", "spec", "source", "targetRevision")).To(Succeed())
+		Expect(c.Update(context.Background(), obj)).To(Succeed())
+		Expect(r.reconcileBootstrapApplication(context.Background(), hc, cluster)).To(Succeed())
+		obj, _ = getApplication(c)
+		revision, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "targetRevision")
+		Expect(revision).To(Equal(DefaultPlatformRevision))
+
+		By("keeping the Application of another HostedCluster")
+		other := hc.DeepCopy()
+		other.Namespace = "other"
+		Expect(r.removeBootstrapApplication(context.Background(), other, defaultGitOpsNamespace)).To(Succeed())
+		_, err = getApplication(c)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.removeBootstrapApplication(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		_, err = getApplication(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should not write the root Application in dry-run mode", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, Bootstrap: bootstrap, DryRun: true}
+		Expect(r.reconcileBootstrapApplication(context.Background(), hc, cluster)).To(Succeed())
+		_, err := getApplication(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,130 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// hyperOpsCABundleConfigMapAnnotation references a ConfigMap in the HostedCluster namespace holding an additional
+	// CA bundle trusted for the API server, e.g. of a re-encrypting load balancer in front of it
+	hyperOpsCABundleConfigMapAnnotation = "hyper-ops.cloudmonkey.org/ca-bundle-configmap"
+	// hyperOpsCABundleSecretAnnotation references a Secret in the HostedCluster namespace holding an additional CA
+	// bundle trusted for the API server
+	hyperOpsCABundleSecretAnnotation = "hyper-ops.cloudmonkey.org/ca-bundle-secret"
+
+	// caBundleKey is the key of the CA bundle injected by OpenShift into ConfigMaps
+	caBundleKey = "ca-bundle.crt"
+)
+
+// caBundleKeys are the keys an additional CA bundle is read from, in order
+var caBundleKeys = []string{caBundleKey, corev1.ServiceAccountRootCAKey}
+
+// additionalCABundle returns the CA bundles referenced by the HostedCluster, none if it references no bundle
+func (r *HyperOpsReconciler) additionalCABundle(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) ([]byte, error) {
+	bundles := [][]byte{}
+	if name := hc.GetAnnotations()[hyperOpsCABundleConfigMapAnnotation]; name != "" {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: name}, cm); err != nil {
+			return nil, fmt.Errorf("unable to fetch CA bundle configmap %s: %w", name, err)
+		}
+		bundle, err := caBundleFromData(fmt.Sprintf("configmap %s", name), func(key string) []byte { return []byte(cm.Data[key]) })
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+	if name := hc.GetAnnotations()[hyperOpsCABundleSecretAnnotation]; name != "" {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: name}, secret); err != nil {
+			return nil, fmt.Errorf("unable to fetch CA bundle secret %s: %w", name, err)
+		}
+		bundle, err := caBundleFromData(fmt.Sprintf("secret %s", name), func(key string) []byte { return secret.Data[key] })
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bundle)
+	}
+	return mergeCABundles(bundles...), nil
+}
+
+// caBundleFromData returns the CA bundle of the first bundle key holding one, it must contain a certificate
+func caBundleFromData(source string, data func(key string) []byte) ([]byte, error) {
+	for _, key := range caBundleKeys {
+		bundle := data(key)
+		if len(bundle) == 0 {
+			continue
+		}
+		if block, _ := pem.Decode(bundle); block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("%s key %s holds no PEM encoded certificate", source, key)
+		}
+		return bundle, nil
+	}
+	return nil, fmt.Errorf("%s must contain %s or %s", source, caBundleKey, corev1.ServiceAccountRootCAKey)
+}
+
+// mergeCABundles returns the PEM encoded certificates of the bundles, certificates in several bundles are only kept
+// once and anything that is not a certificate is dropped
+func mergeCABundles(bundles ...[]byte) []byte {
+	merged := &bytes.Buffer{}
+	seen := map[string]bool{}
+	for _, bundle := range bundles {
+		for {
+			var block *pem.Block
+			if block, bundle = pem.Decode(bundle); block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" || seen[string(block.Bytes)] {
+				continue
+			}
+			seen[string(block.Bytes)] = true
+			_ = pem.Encode(merged, block)
+		}
+	}
+	if merged.Len() == 0 {
+		return nil
+	}
+	return merged.Bytes()
+}
+
+// hostedClustersForCABundle maps a ConfigMap or a Secret to the HostedClusters referencing it as CA bundle
+func (r *HyperOpsReconciler) hostedClustersForCABundle(obj client.Object) []reconcile.Request {
+	annotation := hyperOpsCABundleConfigMapAnnotation
+	if _, ok := obj.(*corev1.Secret); ok {
+		annotation = hyperOpsCABundleSecretAnnotation
+	}
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := r.List(context.Background(), hcs, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range hcs.Items {
+		if hcs.Items[i].GetAnnotations()[annotation] == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hcs.Items[i])})
+		}
+	}
+	return requests
+}
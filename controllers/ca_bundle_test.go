@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Additional CA bundles", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+	certificate := func(content string) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(content)})
+	}
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	})
+
+	It("Should merge the bundles and keep every certificate once", func() {
+		key := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key")})
+		merged := mergeCABundles(certificate("ca"), append(certificate("proxy"), append(key, certificate("ca")...)...))
+		Expect(merged).To(Equal(append(certificate("ca"), certificate("proxy")...)))
+		Expect(mergeCABundles(nil, key)).To(BeNil())
+	})
+
+	It("Should read the bundle referenced by the HostedCluster", func() {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "proxy-ca", Namespace: "clusters"},
+			Data:       map[string]string{caBundleKey: string(certificate("proxy"))},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "lb-ca", Namespace: "clusters"},
+			Data:       map[string][]byte{corev1.ServiceAccountRootCAKey: certificate("lb")},
+		}
+		invalid := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid", Namespace: "clusters"},
+			Data:       map[string]string{caBundleKey: "not a certificate"},
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cm, secret, invalid).Build()}
+
+		bundle, err := r.additionalCABundle(context.Background(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle).To(BeNil())
+
+		hc.Annotations = map[string]string{hyperOpsCABundleConfigMapAnnotation: "proxy-ca", hyperOpsCABundleSecretAnnotation: "lb-ca"}
+		bundle, err = r.additionalCABundle(context.Background(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle).To(Equal(append(certificate("proxy"), certificate("lb")...)))
+
+		hc.Annotations = map[string]string{hyperOpsCABundleConfigMapAnnotation: "invalid"}
+		_, err = r.additionalCABundle(context.Background(), hc)
+		Expect(err).To(MatchError(ContainSubstring("holds no PEM encoded certificate")))
+
+		hc.Annotations = map[string]string{hyperOpsCABundleSecretAnnotation: "missing"}
+		_, err = r.additionalCABundle(context.Background(), hc)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should map a bundle to the HostedClusters referencing it", func() {
+		hc.Annotations = map[string]string{hyperOpsCABundleConfigMapAnnotation: "proxy-ca"}
+		other := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "clusters",
+			Annotations: map[string]string{hyperOpsCABundleSecretAnnotation: "proxy-ca"}}}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, other).Build()}
+
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "proxy-ca", Namespace: "clusters"}}
+		Expect(r.hostedClustersForCABundle(cm)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(hc)}))
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "proxy-ca", Namespace: "clusters"}}
+		Expect(r.hostedClustersForCABundle(secret)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(other)}))
+		cm.Namespace = "elsewhere"
+		Expect(r.hostedClustersForCABundle(cm)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,265 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsProjectAnnotation scopes the ArgoCD cluster of the HostedCluster to an AppProject
+	hyperOpsProjectAnnotation = "hyper-ops.cloudmonkey.org/project"
+	// hyperOpsTenantApplicationNamespaceAnnotation restricts the tenant RBAC policy to the Applications in a
+	// namespace, for ArgoCD instances with Applications in any namespace
+	hyperOpsTenantApplicationNamespaceAnnotation = "hyper-ops.cloudmonkey.org/tenant-application-namespace"
+	// hyperOpsArgoCDVersionAnnotation on a gitops namespace overrides the detected ArgoCD version, e.g. for images
+	// referenced by digest
+	hyperOpsArgoCDVersionAnnotation = "hyper-ops.cloudmonkey.org/argocd-version"
+
+	// capabilitiesTTL is the time the detected capabilities of a gitops namespace are reused
+	capabilitiesTTL = 10 * time.Minute
+
+	// ConditionFeaturesSupported is false when the ArgoCD instance can't use a feature requested by the HostedCluster
+	ConditionFeaturesSupported = "FeaturesSupported"
+)
+
+var (
+	// minimum ArgoCD versions of the features
+	projectScopedClustersVersion      = utilversion.MustParseGeneric("2.4.0")
+	applicationsInAnyNamespaceVersion = utilversion.MustParseGeneric("2.5.0")
+
+	imageVersionPattern = regexp.MustCompile(`:v?(\d+\.\d+(\.\d+)?)`)
+)
+
+// ArgoCDCapabilities are the features supported by the ArgoCD instance of a gitops namespace
+type ArgoCDCapabilities struct {
+	// Version is the detected ArgoCD version, empty if it is unknown
+	Version string
+	// ProjectScopedClusters is true when clusters can be scoped to an AppProject
+	ProjectScopedClusters bool
+	// ApplicationsInAnyNamespace is true when Applications can live outside the ArgoCD namespace
+	ApplicationsInAnyNamespace bool
+}
+
+// capabilitiesForVersion returns the capabilities of an ArgoCD version, none if it is unknown
+func capabilitiesForVersion(raw string) ArgoCDCapabilities {
+	v, err := utilversion.ParseGeneric(raw)
+	if err != nil {
+		return ArgoCDCapabilities{}
+	}
+	return ArgoCDCapabilities{
+		Version:                    raw,
+		ProjectScopedClusters:      v.AtLeast(projectScopedClustersVersion),
+		ApplicationsInAnyNamespace: v.AtLeast(applicationsInAnyNamespaceVersion),
+	}
+}
+
+type capabilitiesEntry struct {
+	capabilities ArgoCDCapabilities
+	detectedAt   time.Time
+}
+
+// capabilitiesCache keeps the detected capabilities by gitops namespace
+type capabilitiesCache struct {
+	mu      sync.Mutex
+	entries map[string]capabilitiesEntry
+}
+
+func (c *capabilitiesCache) get(namespace string, now time.Time) (ArgoCDCapabilities, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[namespace]
+	if !ok || now.Sub(entry.detectedAt) > capabilitiesTTL {
+		return ArgoCDCapabilities{}, false
+	}
+	return entry.capabilities, true
+}
+
+func (c *capabilitiesCache) set(namespace string, capabilities ArgoCDCapabilities, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]capabilitiesEntry{}
+	}
+	c.entries[namespace] = capabilitiesEntry{capabilities: capabilities, detectedAt: now}
+}
+
+// DetectArgoCDVersion returns the version of the ArgoCD instance in the namespace, from the version annotation of
+// the namespace or the image tag of the ArgoCD server. It is empty if the version can't be detected.
+func DetectArgoCDVersion(ctx context.Context, c client.Reader, namespace string) (string, error) {
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	if v := ns.GetAnnotations()[hyperOpsArgoCDVersionAnnotation]; v != "" {
+		return strings.TrimPrefix(v, "v"), nil
+	}
+	deployments := &appsv1.DeploymentList{}
+	if err := c.List(ctx, deployments, client.InNamespace(namespace), client.MatchingLabels{
+		"app.kubernetes.io/component": "server",
+		"app.kubernetes.io/part-of":   "argocd",
+	}); err != nil {
+		return "", err
+	}
+	for _, d := range deployments.Items {
+		for _, container := range d.Spec.Template.Spec.Containers {
+			if m := imageVersionPattern.FindStringSubmatch(container.Image); m != nil {
+				return m[1], nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// argoCDCapabilities returns the capabilities of the ArgoCD instance in the namespace, detected at most once per
+// capabilitiesTTL
+func (r *HyperOpsReconciler) argoCDCapabilities(ctx context.Context, namespace string) (ArgoCDCapabilities, error) {
+	if capabilities, ok := r.capabilities.get(namespace, time.Now()); ok {
+		return capabilities, nil
+	}
+	version, err := DetectArgoCDVersion(ctx, r.healthReader(), namespace)
+	if err != nil {
+		return ArgoCDCapabilities{}, err
+	}
+	capabilities := capabilitiesForVersion(version)
+	log.FromContext(ctx).V(3).Info("detected argocd capabilities", "namespace", namespace, "capabilities", capabilities)
+	r.capabilities.set(namespace, capabilities, time.Now())
+	return capabilities, nil
+}
+
+// unsupportedFeatures returns the features requested by the HostedCluster the ArgoCD instance can't use
+func unsupportedFeatures(hc *hypershiftv1beta1.HostedCluster, project string, capabilities ArgoCDCapabilities) []string {
+	unsupported := []string{}
+	if project != "" && !capabilities.ProjectScopedClusters {
+		unsupported = append(unsupported, fmt.Sprintf("project scoped clusters require ArgoCD %s", projectScopedClustersVersion))
+	}
+	if hc.GetAnnotations()[hyperOpsTenantApplicationNamespaceAnnotation] != "" && !capabilities.ApplicationsInAnyNamespace {
+		unsupported = append(unsupported, fmt.Sprintf("applications in any namespace require ArgoCD %s", applicationsInAnyNamespaceVersion))
+	}
+	return unsupported
+}
+
+// requestsVersionedFeatures returns true when the HostedCluster requests a feature gated by the ArgoCD version
+func requestsVersionedFeatures(hc *hypershiftv1beta1.HostedCluster, project string) bool {
+	return project != "" || hc.GetAnnotations()[hyperOpsTenantApplicationNamespaceAnnotation] != ""
+}
+
+// clusterProject returns the AppProject the ArgoCD cluster of the HostedCluster is scoped to, none if empty. The
+// project annotation wins, with TenantScopedClusters clusters with tenant groups are scoped to their tenant project.
+func (r *HyperOpsReconciler) clusterProject(hc *hypershiftv1beta1.HostedCluster) (string, error) {
+	project := hc.GetAnnotations()[hyperOpsProjectAnnotation]
+	if project == "" && r.TenantScopedClusters && len(tenantGroups(hc)) > 0 {
+		project = tenantProject(hc)
+	}
+	if project == "" {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(project); len(errs) > 0 {
+		return "", fmt.Errorf("invalid AppProject %q for the ArgoCD cluster: %s", project, strings.Join(errs, ", "))
+	}
+	return project, nil
+}
+
+// negotiateCapabilities applies the features requested by the HostedCluster that the ArgoCD instance of the gitops
+// namespace supports, the others are reported in the FeaturesSupported condition instead of being written
+func (r *HyperOpsReconciler) negotiateCapabilities(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) (ArgoCDCapabilities, error) {
+	project, err := r.clusterProject(hc)
+	if err != nil {
+		return ArgoCDCapabilities{}, err
+	}
+	if !requestsVersionedFeatures(hc, project) {
+		if condition := meta.FindStatusCondition(registrationConditions(hc), ConditionFeaturesSupported); condition == nil || condition.Status == metav1.ConditionTrue {
+			return ArgoCDCapabilities{}, nil
+		}
+		return ArgoCDCapabilities{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionFeaturesSupported,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NoVersionedFeatures",
+			Message: "the HostedCluster requests no features depending on the ArgoCD version",
+		})
+	}
+	gitOpsNamespace := cluster.GitOpsNamespace
+	capabilities, err := r.argoCDCapabilities(ctx, gitOpsNamespace)
+	if err != nil {
+		return capabilities, err
+	}
+	if capabilities.ProjectScopedClusters {
+		cluster.Project = project
+	}
+	unsupported := unsupportedFeatures(hc, project, capabilities)
+	if len(unsupported) == 0 {
+		return capabilities, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionFeaturesSupported,
+			Status:  metav1.ConditionTrue,
+			Reason:  "FeaturesSupported",
+			Message: fmt.Sprintf("ArgoCD %s in %s supports the requested features", capabilities.Version, gitOpsNamespace),
+		})
+	}
+	message := fmt.Sprintf("ArgoCD %s in %s: %s", capabilities.Version, gitOpsNamespace, strings.Join(unsupported, ", "))
+	if capabilities.Version == "" {
+		message = fmt.Sprintf("the ArgoCD version in %s is unknown, set the %s annotation of the namespace: %s",
+			gitOpsNamespace, hyperOpsArgoCDVersionAnnotation, strings.Join(unsupported, ", "))
+	}
+	return capabilities, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionFeaturesSupported,
+		Status:  metav1.ConditionFalse,
+		Reason:  "UnsupportedFeature",
+		Message: message,
+	})
+}
+
+// CheckHyperShiftAPI verifies that the HyperShift operator serves the HostedCluster version used by hyper-ops
+func CheckHyperShiftAPI(mapper meta.RESTMapper) error {
+	gvk := hypershiftv1beta1.GroupVersion.WithKind("HostedCluster")
+	if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return fmt.Errorf("the HyperShift operator does not serve %s, a HyperShift operator supporting %s is required: %w",
+			gvk.Kind, hypershiftv1beta1.GroupVersion, err)
+	}
+	return nil
+}
+
+// LogArgoCDCapabilities logs the capabilities of the ArgoCD instances in the namespaces, the default gitops namespace
+// if none are given. Namespaces created later are detected when their first HostedCluster is registered.
+func LogArgoCDCapabilities(ctx context.Context, c client.Reader, namespaces []string, log logr.Logger) {
+	if len(namespaces) == 0 {
+		namespaces = []string{defaultGitOpsNamespace}
+	}
+	for _, ns := range namespaces {
+		version, err := DetectArgoCDVersion(ctx, c, ns)
+		if err != nil {
+			log.Error(err, "unable to detect the argocd version", "namespace", ns)
+			continue
+		}
+		log.Info("detected argocd capabilities", "namespace", ns, "capabilities", capabilitiesForVersion(version))
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("ArgoCD capabilities", func() {
+	argoCDServer := func(image string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "argocd-server",
+				Namespace: defaultGitOpsNamespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/component": "server",
+					"app.kubernetes.io/part-of":   "argocd",
+				},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "argocd-server", Image: image}}},
+				},
+			},
+		}
+	}
+	namespace := func(annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultGitOpsNamespace, Annotations: annotations}}
+	}
+
+	It("Should gate the features by version", func() {
+		Expect(capabilitiesForVersion("2.3.1")).To(Equal(ArgoCDCapabilities{Version: "2.3.1"}))
+		Expect(capabilitiesForVersion("2.4.0")).To(Equal(ArgoCDCapabilities{Version: "2.4.0", ProjectScopedClusters: true}))
+		Expect(capabilitiesForVersion("2.10.4").ApplicationsInAnyNamespace).To(BeTrue())
+		Expect(capabilitiesForVersion("")).To(Equal(ArgoCDCapabilities{}))
+	})
+
+	It("Should detect the ArgoCD version", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(namespace(nil), argoCDServer("quay.io/argoproj/argocd:v2.9.3")).Build()
+		version, err := DetectArgoCDVersion(context.Background(), c, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("2.9.3"))
+
+		By("preferring the namespace annotation")
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(namespace(map[string]string{hyperOpsArgoCDVersionAnnotation: "v2.4.1"}), argoCDServer("registry.example.com/argocd@sha256:0123")).Build()
+		version, err = DetectArgoCDVersion(context.Background(), c, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(Equal("2.4.1"))
+
+		By("returning no version for images referenced by digest")
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(namespace(nil), argoCDServer("registry.example.com/argocd@sha256:0123")).Build()
+		version, err = DetectArgoCDVersion(context.Background(), c, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(version).To(BeEmpty())
+	})
+
+	It("Should report features the ArgoCD instance can't use", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsProjectAnnotation: "tenant-a"},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(hc, namespace(nil), argoCDServer("quay.io/argoproj/argocd:v2.3.0")).Build()
+		r := &HyperOpsReconciler{Client: c}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted"}, GitOpsNamespace: defaultGitOpsNamespace}
+		_, err := r.negotiateCapabilities(context.Background(), hc, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(BeEmpty())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionFeaturesSupported)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("UnsupportedFeature"))
+
+		By("scoping the cluster once ArgoCD is upgraded")
+		server := &appsv1.Deployment{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "argocd-server"}, server)).To(Succeed())
+		server.Spec.Template.Spec.Containers[0].Image = "quay.io/argoproj/argocd:v2.8.0"
+		Expect(c.Update(context.Background(), server)).To(Succeed())
+		r.capabilities = capabilitiesCache{}
+		_, err = r.negotiateCapabilities(context.Background(), hc, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(Equal("tenant-a"))
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionFeaturesSupported)).To(BeTrue())
+	})
+
+	It("Should scope the clusters of tenants to their tenant project", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsTenantGroupsAnnotation: "team-a", hyperOpsTenantProjectAnnotation: "team-a"},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+			WithObjects(hc, namespace(nil), argoCDServer("quay.io/argoproj/argocd:v2.8.0")).Build()
+		r := &HyperOpsReconciler{Client: c}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted"}, GitOpsNamespace: defaultGitOpsNamespace}
+		_, err := r.negotiateCapabilities(context.Background(), hc, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(BeEmpty())
+
+		r.TenantScopedClusters = true
+		_, err = r.negotiateCapabilities(context.Background(), hc, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(Equal("team-a"))
+
+		By("preferring the project annotation")
+		hc.Annotations[hyperOpsProjectAnnotation] = "platform"
+		_, err = r.negotiateCapabilities(context.Background(), hc, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(Equal("platform"))
+	})
+
+	It("Should reject invalid AppProject names", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsProjectAnnotation: "Team A"},
+			},
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()}
+		_, err := r.negotiateCapabilities(context.Background(), hc, &Cluster{Cluster: argocd.Cluster{Name: "hosted"}, GitOpsNamespace: defaultGitOpsNamespace})
+		Expect(err).To(MatchError(ContainSubstring("invalid AppProject")))
+	})
+})
@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// hyperOpsAPICertificateExpiresAtAnnotation records the notAfter of the serving certificate of the hosted cluster
+	// API server on the ArgoCD cluster secret
+	hyperOpsAPICertificateExpiresAtAnnotation = "hyper-ops.cloudmonkey.org/api-certificate-expires-at"
+
+	// apiCertificateProbeTimeout bounds the TLS handshake with the hosted cluster API server
+	apiCertificateProbeTimeout = 10 * time.Second
+)
+
+var apiCertificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "hyperops_hosted_cluster_api_certificate_expiry_timestamp_seconds",
+	Help: "Unix time the serving certificate of the hosted cluster API server expires.",
+}, []string{"namespace", "name"})
+
+func init() {
+	metrics.Registry.MustRegister(apiCertificateExpiry)
+}
+
+// probeAPICertificate returns the notAfter of the serving certificate presented by the API server of the config.
+// The handshake verifies the certificate like every other client of the config would.
+func probeAPICertificate(ctx context.Context, config *rest.Config) (time.Time, error) {
+	u, err := url.Parse(config.Host)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid server %q: %w", config.Host, err)
+	}
+	if u.Scheme != "https" {
+		return time.Time{}, fmt.Errorf("server %s does not use TLS", config.Host)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "443")
+	}
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return time.Time{}, err
+	}
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: apiCertificateProbeTimeout}, Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, fmt.Errorf("server %s presented no certificate", config.Host)
+	}
+	return certs[0].NotAfter, nil
+}
+
+// recordAPICertificateExpiry probes the serving certificate of the hosted cluster and records its expiry in the
+// metric and on the cluster. A failed probe is only logged and keeps the last known expiry, an expired certificate
+// fails the handshake and must not hide itself.
+func (r *HyperOpsReconciler) recordAPICertificateExpiry(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, config *rest.Config, cluster *Cluster) {
+	probe := r.probeCertificate
+	if probe == nil {
+		probe = probeAPICertificate
+	}
+	notAfter, err := probe(ctx, config)
+	if err != nil {
+		log.FromContext(ctx).V(3).Error(err, "unable to probe the api server certificate")
+		return
+	}
+	cluster.APICertificateExpiresAt = notAfter
+	apiCertificateExpiry.WithLabelValues(hc.Namespace, hc.Name).Set(float64(notAfter.Unix()))
+}
+
+// forgetAPICertificateExpiry removes the metric of a HostedCluster that is gone
+func forgetAPICertificateExpiry(key types.NamespacedName) {
+	apiCertificateExpiry.DeleteLabelValues(key.Namespace, key.Name)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("API certificate expiry", func() {
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+
+	It("Should read the notAfter of the serving certificate", func() {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+		cert := server.Certificate()
+		config := &rest.Config{
+			Host:            server.URL,
+			TLSClientConfig: rest.TLSClientConfig{CAData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})},
+		}
+		notAfter, err := probeAPICertificate(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(notAfter).To(BeTemporally("==", cert.NotAfter))
+
+		// the certificate is verified like any other connection of the config
+		_, err = probeAPICertificate(context.Background(), &rest.Config{Host: server.URL})
+		Expect(err).To(HaveOccurred())
+		_, err = probeAPICertificate(context.Background(), &rest.Config{Host: "http://hosted:6443"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should record the expiry in the metric and forget it with the HostedCluster", func() {
+		notAfter := time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC)
+		r := &HyperOpsReconciler{probeCertificate: func(context.Context, *rest.Config) (time.Time, error) { return notAfter, nil }}
+		cluster := &Cluster{}
+		r.recordAPICertificateExpiry(context.Background(), hc, &rest.Config{}, cluster)
+		Expect(cluster.APICertificateExpiresAt).To(Equal(notAfter))
+		Expect(testutil.ToFloat64(apiCertificateExpiry.WithLabelValues("clusters", "hosted"))).To(Equal(float64(notAfter.Unix())))
+
+		forgetAPICertificateExpiry(types.NamespacedName{Namespace: "clusters", Name: "hosted"})
+		Expect(testutil.CollectAndCount(apiCertificateExpiry)).To(BeZero())
+
+		// a failed probe leaves the last known expiry in place
+		r.recordAPICertificateExpiry(context.Background(), hc, &rest.Config{}, cluster)
+		r.probeCertificate = func(context.Context, *rest.Config) (time.Time, error) { return time.Time{}, errors.New("timeout") }
+		cluster = &Cluster{}
+		r.recordAPICertificateExpiry(context.Background(), hc, &rest.Config{}, cluster)
+		Expect(cluster.APICertificateExpiresAt.IsZero()).To(BeTrue())
+		Expect(testutil.ToFloat64(apiCertificateExpiry.WithLabelValues("clusters", "hosted"))).To(Equal(float64(notAfter.Unix())))
+		forgetAPICertificateExpiry(types.NamespacedName{Namespace: "clusters", Name: "hosted"})
+	})
+
+	It("Should annotate the ArgoCD cluster secret with the expiry", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c}
+		cluster := &Cluster{
+			Cluster:                 argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"},
+			HostedCluster:           hc,
+			APICertificateExpiresAt: time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC),
+			GitOpsNamespace:         defaultGitOpsNamespace,
+		}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsAPICertificateExpiresAtAnnotation, "2027-01-02T03:04:05Z"))
+
+		// a failed probe keeps the last known expiry
+		cluster.APICertificateExpiresAt = time.Time{}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsAPICertificateExpiresAtAnnotation, "2027-01-02T03:04:05Z"))
+	})
+})
@@ -0,0 +1,203 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// CIOutputTekton writes kubeconfig secrets that Tekton pipelines bind as workspaces
+	CIOutputTekton = "tekton"
+	// CIOutputArgoWorkflows writes cluster profile secrets that Argo Workflows mount into their steps
+	CIOutputArgoWorkflows = "argo-workflows"
+
+	// hyperOpsCIOutputLabel names the CI system a CI output secret is written for
+	hyperOpsCIOutputLabel = "hyper-ops.cloudmonkey.org/ci-output"
+
+	// ciOutputKubeconfigKey holds the kubeconfig in the CI output secrets
+	ciOutputKubeconfigKey = "kubeconfig"
+)
+
+// errCredentialNotExportable is returned for credentials that only work from within the ArgoCD pods
+var errCredentialNotExportable = errors.New("the credential can't be exported")
+
+// ParseCIOutputs parses a comma separated list of <type>=<namespace> CI outputs
+func ParseCIOutputs(raw string) ([]hyperopsv1alpha1.CIOutput, error) {
+	outputs := []hyperopsv1alpha1.CIOutput{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		outputType, namespace, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid CI output %q, must be <type>=<namespace>", entry)
+		}
+		outputs = append(outputs, hyperopsv1alpha1.CIOutput{Type: outputType, Namespace: namespace})
+	}
+	return outputs, ValidateCIOutputs(outputs)
+}
+
+// ValidateCIOutputs returns an error if a CI output has an unknown type, an invalid namespace or is configured twice
+func ValidateCIOutputs(outputs []hyperopsv1alpha1.CIOutput) error {
+	seen := map[hyperopsv1alpha1.CIOutput]bool{}
+	for _, o := range outputs {
+		switch o.Type {
+		case CIOutputTekton, CIOutputArgoWorkflows:
+		default:
+			return fmt.Errorf("unknown CI output type %q, must be %s or %s", o.Type, CIOutputTekton, CIOutputArgoWorkflows)
+		}
+		if errs := validation.IsDNS1123Label(o.Namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q of CI output %s: %s", o.Namespace, o.Type, strings.Join(errs, ", "))
+		}
+		if seen[o] {
+			return fmt.Errorf("duplicate CI output %s=%s", o.Type, o.Namespace)
+		}
+		seen[o] = true
+	}
+	return nil
+}
+
+// ciOutputSecretKey returns the secret of the CI output for the HostedCluster. Tekton workspaces and Argo Workflows
+// volumes name the secret, so the names only depend on the HostedCluster.
+func ciOutputSecretKey(hc *hypershiftv1beta1.HostedCluster, output hyperopsv1alpha1.CIOutput) client.ObjectKey {
+	suffix := "kubeconfig"
+	if output.Type == CIOutputArgoWorkflows {
+		suffix = "cluster-profile"
+	}
+	return client.ObjectKey{Namespace: output.Namespace, Name: fmt.Sprintf("%s-%s", hc.Name, suffix)}
+}
+
+// argoCDClusterName returns the name of the cluster in ArgoCD
+func argoCDClusterName(cluster *Cluster) string {
+	if cluster.ArgoCDName != "" {
+		return cluster.ArgoCDName
+	}
+	return cluster.Name
+}
+
+// clusterKubeconfig renders the credential of the ArgoCD cluster as a kubeconfig with a single context named after
+// the cluster. Credentials obtained by running a command in the ArgoCD pods can't be handed to CI systems.
+func clusterKubeconfig(cluster *Cluster) ([]byte, error) {
+	config := cluster.Config
+	if config.ExecProviderConfig != nil || config.AWSAuthConfig != nil {
+		return nil, fmt.Errorf("%w: the credential of cluster %s is obtained by a command", errCredentialNotExportable, cluster.Name)
+	}
+	name := argoCDClusterName(cluster)
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[name] = &clientcmdapi.Cluster{
+		Server:                   cluster.Server,
+		CertificateAuthorityData: config.TLSClientConfig.CAData,
+		InsecureSkipTLSVerify:    config.TLSClientConfig.Insecure,
+		TLSServerName:            config.TLSClientConfig.ServerName,
+	}
+	kubeconfig.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		Token:                 config.BearerToken,
+		ClientCertificateData: config.TLSClientConfig.CertData,
+		ClientKeyData:         config.TLSClientConfig.KeyData,
+		Username:              config.Username,
+		Password:              config.Password,
+	}
+	kubeconfig.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	kubeconfig.CurrentContext = name
+	return clientcmd.Write(*kubeconfig)
+}
+
+// reconcileCIOutputs writes the credential of the registration to a secret for every CI output and removes the
+// secrets of outputs that are no longer configured. The secrets are rewritten with every registration, so they follow
+// token renewals.
+func (r *HyperOpsReconciler) reconcileCIOutputs(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	if r.readOnly() {
+		return nil
+	}
+	configured := map[client.ObjectKey]bool{}
+	if len(r.CIOutputs) > 0 {
+		kubeconfig, err := clusterKubeconfig(cluster)
+		if err != nil {
+			// the registration itself is fine, only CI systems go without the cluster
+			r.recordEvent(hc, corev1.EventTypeWarning, "CIOutputSkipped", err.Error())
+			return r.removeCIOutputs(ctx, hc, nil)
+		}
+		for _, output := range r.CIOutputs {
+			key := ciOutputSecretKey(hc, output)
+			configured[key] = true
+			if err := r.writeCIOutput(ctx, hc, cluster, output, key, kubeconfig); err != nil {
+				return fmt.Errorf("unable to write the %s output to %s: %w", output.Type, key.Namespace, err)
+			}
+		}
+	}
+	return r.removeCIOutputs(ctx, hc, configured)
+}
+
+// writeCIOutput writes the kubeconfig secret of the CI output
+func (r *HyperOpsReconciler) writeCIOutput(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster, output hyperopsv1alpha1.CIOutput, key client.ObjectKey, kubeconfig []byte) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	_, err := CreateOrUpdateWithRetries(ctx, r.Client, secret, func() error {
+		secret.Labels = managedLabels(secret.Labels)
+		secret.Labels[hyperOpsCIOutputLabel] = output.Type
+		for k, v := range clusterIdentityAnnotations(hc) {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, k, v)
+		}
+		metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsHostedClusterAnnotation, client.ObjectKeyFromObject(hc).String())
+		secret.Data = map[string][]byte{ciOutputKubeconfigKey: kubeconfig}
+		// Argo Workflows steps talk to the cluster with tools that don't read kubeconfigs, e.g. curl
+		if output.Type == CIOutputArgoWorkflows {
+			secret.Data["name"] = []byte(argoCDClusterName(cluster))
+			secret.Data["server"] = []byte(cluster.Server)
+			secret.Data["ca.crt"] = cluster.Config.TLSClientConfig.CAData
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	})
+	return err
+}
+
+// removeCIOutputs deletes the CI output secrets of the HostedCluster that are not configured, all of them if
+// configured is empty
+func (r *HyperOpsReconciler) removeCIOutputs(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, configured map[client.ObjectKey]bool) error {
+	if r.readOnly() {
+		return nil
+	}
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.HasLabels{hyperOpsCIOutputLabel}, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Annotations[hyperOpsHostedClusterAnnotation] != client.ObjectKeyFromObject(hc).String() || configured[client.ObjectKeyFromObject(secret)] {
+			continue
+		}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
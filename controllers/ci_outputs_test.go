@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("CI outputs", func() {
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "uid"}}
+	cluster := func(token string) *Cluster {
+		return &Cluster{Cluster: argocd.Cluster{
+			Name:   "hosted",
+			Server: "https://hosted:6443",
+			Config: argocd.ClusterConfig{BearerToken: token, TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+		}}
+	}
+
+	It("Should parse the CI outputs", func() {
+		outputs, err := ParseCIOutputs("tekton=ci, argo-workflows=argo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(outputs).To(Equal([]hyperopsv1alpha1.CIOutput{
+			{Type: CIOutputTekton, Namespace: "ci"},
+			{Type: CIOutputArgoWorkflows, Namespace: "argo"},
+		}))
+
+		_, err = ParseCIOutputs("tekton")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseCIOutputs("jenkins=ci")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseCIOutputs("tekton=")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseCIOutputs("tekton=ci,tekton=ci")
+		Expect(err).To(HaveOccurred())
+		// a CI system may run in several namespaces
+		_, err = ParseCIOutputs("tekton=ci,tekton=release")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should write the credential of the registration for every CI output", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, CIOutputs: []hyperopsv1alpha1.CIOutput{
+			{Type: CIOutputTekton, Namespace: "ci"},
+			{Type: CIOutputArgoWorkflows, Namespace: "argo"},
+		}}
+		Expect(r.reconcileCIOutputs(context.Background(), hc, cluster("token"))).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-kubeconfig"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue(hyperOpsCIOutputLabel, CIOutputTekton))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+		restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[ciOutputKubeconfigKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restConfig.Host).To(Equal("https://hosted:6443"))
+		Expect(restConfig.BearerToken).To(Equal("token"))
+		Expect(restConfig.CAData).To(Equal([]byte("ca")))
+
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "argo", Name: "hosted-cluster-profile"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue(hyperOpsCIOutputLabel, CIOutputArgoWorkflows))
+		Expect(secret.Data).To(HaveKey(ciOutputKubeconfigKey))
+		Expect(secret.Data).To(HaveKeyWithValue("server", []byte("https://hosted:6443")))
+		Expect(secret.Data).To(HaveKeyWithValue("ca.crt", []byte("ca")))
+
+		// the secrets follow the renewed token of the registration
+		Expect(r.reconcileCIOutputs(context.Background(), hc, cluster("renewed"))).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-kubeconfig"}, secret)).To(Succeed())
+		restConfig, err = clientcmd.RESTConfigFromKubeConfig(secret.Data[ciOutputKubeconfigKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restConfig.BearerToken).To(Equal("renewed"))
+
+		// outputs that are no longer configured lose their secret
+		r.CIOutputs = r.CIOutputs[:1]
+		Expect(r.reconcileCIOutputs(context.Background(), hc, cluster("renewed"))).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "argo", Name: "hosted-cluster-profile"}, secret))).To(BeTrue())
+
+		Expect(r.deregisterArgoCDClusterSecrets(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-kubeconfig"}, secret))).To(BeTrue())
+	})
+
+	It("Should not export credentials obtained by a command", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, CIOutputs: []hyperopsv1alpha1.CIOutput{{Type: CIOutputTekton, Namespace: "ci"}}}
+		exec := cluster("")
+		exec.Config.ExecProviderConfig = &argocd.ExecProviderConfig{Command: "argocd-k8s-auth"}
+		Expect(r.reconcileCIOutputs(context.Background(), hc, exec)).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-kubeconfig"}, &corev1.Secret{}))).To(BeTrue())
+	})
+})
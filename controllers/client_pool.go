@@ -0,0 +1,259 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubectl/pkg/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// hostedClientPoolSweepInterval is how often idle clients are evicted from the pool
+const hostedClientPoolSweepInterval = time.Minute
+
+var (
+	hostedClientPoolLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hyperops_hosted_client_pool_lookups_total",
+		Help: "Lookups of hosted cluster clients in the client pool, by result",
+	}, []string{"result"})
+	hostedClientPoolEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hyperops_hosted_client_pool_evictions_total",
+		Help: "Hosted cluster clients evicted from the client pool, by reason",
+	}, []string{"reason"})
+	hostedClientPoolClients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hyperops_hosted_client_pool_clients",
+		Help: "Hosted cluster clients kept alive in the client pool",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(hostedClientPoolLookups, hostedClientPoolEvictions, hostedClientPoolClients)
+}
+
+// pooledClient is a client of the pool with the fingerprint of the config it was created from
+type pooledClient struct {
+	key         client.ObjectKey
+	fingerprint string
+	client      client.Client
+	lastUsed    time.Time
+}
+
+// HostedClientPool keeps the clients of hosted clusters alive between reconciles, so their API discovery is not
+// repeated on every reconcile. At most Size clients are kept, the least recently used client is evicted first, and
+// clients unused for IdleTimeout are evicted by Start. A client is replaced when the rest config of its HostedCluster
+// changes, e.g. after a regenerated kubeconfig. It is safe for concurrent use.
+type HostedClientPool struct {
+	// Size is the maximum number of clients kept alive
+	Size int
+	// IdleTimeout evicts clients that were not used for the duration, idle clients are kept if zero
+	IdleTimeout time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[client.ObjectKey]*list.Element
+	// newClient creates the clients, client.New if nil
+	newClient func(*rest.Config) (client.Client, error)
+	// now returns the current time, time.Now if nil
+	now func() time.Time
+}
+
+// NewHostedClientPool returns a pool keeping at most size clients, evicting clients idle for idleTimeout
+func NewHostedClientPool(size int, idleTimeout time.Duration) *HostedClientPool {
+	return &HostedClientPool{Size: size, IdleTimeout: idleTimeout}
+}
+
+// Get returns the client of the HostedCluster for the config and the headers the config was wrapped with, creating it
+// if the pool has no client for the same config and headers. The headers are passed separately since the transport
+// wrappers of the config can't be compared.
+func (p *HostedClientPool) Get(key client.ObjectKey, config *rest.Config, headers map[string]string) (client.Client, error) {
+	fingerprint := restConfigFingerprint(config, headers)
+	p.mu.Lock()
+	if c := p.lookup(key, fingerprint); c != nil {
+		p.mu.Unlock()
+		hostedClientPoolLookups.WithLabelValues("hit").Inc()
+		return c, nil
+	}
+	p.mu.Unlock()
+	hostedClientPoolLookups.WithLabelValues("miss").Inc()
+
+	// creating a client runs the API discovery of the hosted cluster, the pool is not locked meanwhile
+	newClient := p.newClient
+	if newClient == nil {
+		newClient = func(config *rest.Config) (client.Client, error) {
+			return client.New(config, client.Options{Scheme: scheme.Scheme})
+		}
+	}
+	c, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// a concurrent Get may have created a client for the same config in the meantime
+	if existing := p.lookup(key, fingerprint); existing != nil {
+		return existing, nil
+	}
+	p.lru.PushFront(&pooledClient{key: key, fingerprint: fingerprint, client: c, lastUsed: p.clock()})
+	p.entries[key] = p.lru.Front()
+	for p.Size > 0 && p.lru.Len() > p.Size {
+		p.remove(p.lru.Back(), "capacity")
+	}
+	hostedClientPoolClients.Set(float64(p.lru.Len()))
+	return c, nil
+}
+
+// Forget evicts the client of the HostedCluster, e.g. once it is deleted
+func (p *HostedClientPool) Forget(key client.ObjectKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if element, ok := p.entries[key]; ok {
+		p.remove(element, "forgotten")
+	}
+}
+
+// Len returns the number of clients in the pool
+func (p *HostedClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lru == nil {
+		return 0
+	}
+	return p.lru.Len()
+}
+
+// Start evicts idle clients periodically until the context is cancelled
+func (p *HostedClientPool) Start(ctx context.Context) error {
+	if p.IdleTimeout <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		p.evictIdle()
+	}, hostedClientPoolSweepInterval)
+	return nil
+}
+
+// NeedLeaderElection is false, every replica keeps the clients of its own reconciles
+func (p *HostedClientPool) NeedLeaderElection() bool {
+	return false
+}
+
+// evictIdle evicts the clients unused for IdleTimeout
+func (p *HostedClientPool) evictIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lru == nil {
+		return
+	}
+	now := p.clock()
+	// the list is ordered by use, the first client used recently enough ends the sweep
+	for element := p.lru.Back(); element != nil; element = p.lru.Back() {
+		if now.Sub(element.Value.(*pooledClient).lastUsed) < p.IdleTimeout {
+			return
+		}
+		p.remove(element, "idle")
+	}
+}
+
+// lookup returns the pooled client of the HostedCluster if it was created from the same config and marks it as used,
+// a client of another config is evicted. The pool must be locked.
+func (p *HostedClientPool) lookup(key client.ObjectKey, fingerprint string) client.Client {
+	if p.lru == nil {
+		p.lru = list.New()
+		p.entries = map[client.ObjectKey]*list.Element{}
+	}
+	element, ok := p.entries[key]
+	if !ok {
+		return nil
+	}
+	pooled := element.Value.(*pooledClient)
+	if pooled.fingerprint != fingerprint {
+		p.remove(element, "stale")
+		return nil
+	}
+	pooled.lastUsed = p.clock()
+	p.lru.MoveToFront(element)
+	return pooled.client
+}
+
+// remove evicts a client for the reason. The pool must be locked.
+func (p *HostedClientPool) remove(element *list.Element, reason string) {
+	p.lru.Remove(element)
+	delete(p.entries, element.Value.(*pooledClient).key)
+	hostedClientPoolEvictions.WithLabelValues(reason).Inc()
+	hostedClientPoolClients.Set(float64(p.lru.Len()))
+}
+
+func (p *HostedClientPool) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// restConfigFingerprint identifies the server and the credentials of a rest config and the headers added to its
+// requests, a client is reused only for a config with the same fingerprint
+func restConfigFingerprint(config *rest.Config, headers map[string]string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%s\x00%v\x00%s\x00%s\x00%s\x00%s\x00%t\x00%s\x00",
+		config.Host, config.APIPath, config.UserAgent, config.BearerToken, config.BearerTokenFile, config.Username,
+		config.Impersonate, config.CAFile, config.CertFile, config.KeyFile, config.ServerName, config.Insecure, config.Password)
+	for _, data := range [][]byte{config.CAData, config.CertData, config.KeyData} {
+		h.Write(data)
+		h.Write([]byte{0})
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, headers[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hostedClient returns a client of the hosted cluster of the HostedCluster for the config, kept in the
+// HostedClients pool if the reconciler has one. The config must be wrapped with the HostedClusterHeaders, a pooled
+// client is replaced once they are reloaded.
+func (r *HyperOpsReconciler) hostedClient(hc *hypershiftv1beta1.HostedCluster, config *rest.Config) (client.Client, error) {
+	if r.HostedClients == nil {
+		return client.New(config, client.Options{Scheme: scheme.Scheme})
+	}
+	return r.HostedClients.Get(client.ObjectKeyFromObject(hc), config, r.HostedClusterHeaders)
+}
+
+// forgetHostedClient evicts the pooled client of a HostedCluster that is deleted
+func (r *HyperOpsReconciler) forgetHostedClient(key client.ObjectKey) {
+	if r.HostedClients != nil {
+		r.HostedClients.Forget(key)
+	}
+}
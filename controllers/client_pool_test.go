@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Hosted cluster client pool", func() {
+	var (
+		pool    *HostedClientPool
+		created int
+		now     time.Time
+	)
+	a := client.ObjectKey{Namespace: "clusters", Name: "a"}
+	b := client.ObjectKey{Namespace: "clusters", Name: "b"}
+	c := client.ObjectKey{Namespace: "clusters", Name: "c"}
+	config := func(host string) *rest.Config {
+		return &rest.Config{Host: host, TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca")}}
+	}
+
+	BeforeEach(func() {
+		created = 0
+		now = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		pool = NewHostedClientPool(2, 10*time.Minute)
+		pool.newClient = func(*rest.Config) (client.Client, error) {
+			created++
+			return fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), nil
+		}
+		pool.now = func() time.Time { return now }
+	})
+
+	It("Should reuse the client of a HostedCluster until its config changes", func() {
+		hits := testutil.ToFloat64(hostedClientPoolLookups.WithLabelValues("hit"))
+		stale := testutil.ToFloat64(hostedClientPoolEvictions.WithLabelValues("stale"))
+
+		first, err := pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(BeIdenticalTo(first))
+		Expect(created).To(Equal(1))
+		Expect(testutil.ToFloat64(hostedClientPoolLookups.WithLabelValues("hit"))).To(Equal(hits + 1))
+
+		// a regenerated kubeconfig with a new CA gets a new client
+		rotated := config("https://a:6443")
+		rotated.CAData = []byte("rotated")
+		third, err := pool.Get(a, rotated, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third).NotTo(BeIdenticalTo(first))
+		Expect(created).To(Equal(2))
+		Expect(pool.Len()).To(Equal(1))
+		Expect(testutil.ToFloat64(hostedClientPoolEvictions.WithLabelValues("stale"))).To(Equal(stale + 1))
+	})
+
+	It("Should replace the client of a HostedCluster once its headers are reloaded", func() {
+		first, err := pool.Get(a, config("https://a:6443"), map[string]string{"X-Fleet": "prod"})
+		Expect(err).NotTo(HaveOccurred())
+		second, err := pool.Get(a, config("https://a:6443"), map[string]string{"X-Fleet": "prod"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(BeIdenticalTo(first))
+
+		third, err := pool.Get(a, config("https://a:6443"), map[string]string{"X-Fleet": "staging"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(third).NotTo(BeIdenticalTo(first))
+		fourth, err := pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fourth).NotTo(BeIdenticalTo(third))
+		Expect(created).To(Equal(3))
+	})
+
+	It("Should evict the least recently used client at capacity", func() {
+		_, err := pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pool.Get(b, config("https://b:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pool.Get(c, config("https://c:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pool.Len()).To(Equal(2))
+		Expect(pool.entries).To(HaveKey(a))
+		Expect(pool.entries).NotTo(HaveKey(b))
+		Expect(testutil.ToFloat64(hostedClientPoolClients)).To(Equal(2.0))
+	})
+
+	It("Should evict idle and forgotten clients", func() {
+		_, err := pool.Get(a, config("https://a:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		now = now.Add(9 * time.Minute)
+		_, err = pool.Get(b, config("https://b:6443"), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		now = now.Add(2 * time.Minute)
+		pool.evictIdle()
+		Expect(pool.entries).NotTo(HaveKey(a))
+		Expect(pool.entries).To(HaveKey(b))
+
+		pool.Forget(b)
+		Expect(pool.Len()).To(BeZero())
+		pool.Forget(b)
+	})
+
+	It("Should keep the clients of the reconciler in its pool", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "clusters"}}
+		r := &HyperOpsReconciler{HostedClients: pool}
+		_, err := r.hostedClient(hc, config("https://a:6443"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pool.entries).To(HaveKey(a))
+		r.forgetHostedClient(a)
+		Expect(pool.Len()).To(BeZero())
+
+		// without a pool there is nothing to forget
+		(&HyperOpsReconciler{}).forgetHostedClient(a)
+	})
+})
@@ -0,0 +1,177 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// ClusterAppProjectsCluster creates an AppProject per HostedCluster, named after the HostedCluster
+	ClusterAppProjectsCluster = "cluster"
+	// ClusterAppProjectsTenant creates an AppProject per tenant, named after the tenant project of the HostedClusters
+	ClusterAppProjectsTenant = "tenant"
+)
+
+// ValidateClusterAppProjects returns an error if the AppProject mode is unknown
+func ValidateClusterAppProjects(mode string) error {
+	switch mode {
+	case "", ClusterAppProjectsCluster, ClusterAppProjectsTenant:
+		return nil
+	}
+	return fmt.Errorf("unknown cluster AppProject mode %q, must be %s or %s", mode, ClusterAppProjectsCluster, ClusterAppProjectsTenant)
+}
+
+// clusterAppProject returns the AppProject created for the HostedCluster, none if empty
+func (r *HyperOpsReconciler) clusterAppProject(hc *hypershiftv1beta1.HostedCluster) (string, error) {
+	project := ""
+	switch r.ClusterAppProjects {
+	case ClusterAppProjectsCluster:
+		project = hc.Name
+	case ClusterAppProjectsTenant:
+		project = tenantProject(hc)
+	default:
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(project); len(errs) > 0 {
+		return "", fmt.Errorf("invalid AppProject %q for the HostedCluster: %s", project, strings.Join(errs, ", "))
+	}
+	return project, nil
+}
+
+// clusterAppProjectObject returns a new AppProject deploying from any repository to the servers only. Cluster scoped
+// resources are denied until the owners of the project allow them.
+func clusterAppProjectObject(key client.ObjectKey, description string, servers sets.String) *unstructured.Unstructured {
+	project := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"description":  description,
+			"sourceRepos":  []interface{}{"*"},
+			"destinations": clusterAppProjectDestinations(servers),
+		},
+	}}
+	project.SetGroupVersionKind(appProjectGVK)
+	project.SetNamespace(key.Namespace)
+	project.SetName(key.Name)
+	return project
+}
+
+// clusterAppProjectDestinations allows all namespaces of the servers
+func clusterAppProjectDestinations(servers sets.String) []interface{} {
+	destinations := []interface{}{}
+	for _, server := range servers.List() {
+		destinations = append(destinations, map[string]interface{}{"server": server, "namespace": "*"})
+	}
+	return destinations
+}
+
+// reconcileClusterAppProject creates the AppProject of the HostedCluster and restricts its destinations to the
+// registered clusters it was created for
+func (r *HyperOpsReconciler) reconcileClusterAppProject(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace, server string) error {
+	if r.ClusterAppProjects == "" || r.readOnly() {
+		return nil
+	}
+	if r.remoteRegistrations() != nil {
+		log.FromContext(ctx).V(3).Info("cluster AppProjects are not supported for a remote ArgoCD")
+		return nil
+	}
+	project, err := r.clusterAppProject(hc)
+	if err != nil {
+		return err
+	}
+	return r.syncClusterAppProject(ctx, hc, gitOpsNamespace, project, server)
+}
+
+// removeClusterAppProject removes the server of the HostedCluster from its AppProject, the AppProject is deleted with
+// its last registration
+func (r *HyperOpsReconciler) removeClusterAppProject(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if r.ClusterAppProjects == "" || r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	project, err := r.clusterAppProject(hc)
+	if err != nil {
+		// the AppProject of an invalid name was never created
+		return nil
+	}
+	return r.syncClusterAppProject(ctx, hc, gitOpsNamespace, project, "")
+}
+
+// syncClusterAppProject sets the destinations of the AppProject to the servers of the registrations naming it, with the
+// server of the HostedCluster, if any, instead of its registration. AppProjects not created by hyper-ops are never
+// modified.
+func (r *HyperOpsReconciler) syncClusterAppProject(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace, name, server string) error {
+	log := log.FromContext(ctx)
+	key := client.ObjectKey{Namespace: gitOpsNamespace, Name: name}
+	servers, err := projectServers(ctx, r.Client, key.Namespace, key.Name, client.ObjectKeyFromObject(hc).String())
+	if err != nil {
+		return err
+	}
+	if server != "" {
+		servers.Insert(server)
+	}
+	project := &unstructured.Unstructured{}
+	project.SetGroupVersionKind(appProjectGVK)
+	if err := r.Get(ctx, key, project); err != nil {
+		if !apierrors.IsNotFound(err) || servers.Len() == 0 {
+			return client.IgnoreNotFound(err)
+		}
+		description := fmt.Sprintf("Applications of the hosted cluster %s", client.ObjectKeyFromObject(hc))
+		if r.ClusterAppProjects == ClusterAppProjectsTenant {
+			description = fmt.Sprintf("Applications of the hosted clusters of tenant %s", name)
+		}
+		project = clusterAppProjectObject(key, description, servers)
+		stampManaged(project, correlationID(hc))
+		if err := r.Create(ctx, project); err != nil {
+			return fmt.Errorf("unable to create AppProject %s: %w", key, err)
+		}
+		log.Info("AppProject created", "appProject", key.String(), "servers", servers.List())
+		return nil
+	}
+	if project.GetLabels()[managedByLabel] != managedByValue {
+		log.V(3).Info("AppProject was not created by hyper-ops, leaving it alone", "appProject", key.String())
+		return nil
+	}
+	if servers.Len() == 0 {
+		if err := r.Delete(ctx, project); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("unable to delete AppProject %s: %w", key, err)
+		}
+		log.Info("AppProject deleted with its last registration", "appProject", key.String())
+		return nil
+	}
+	destinations := clusterAppProjectDestinations(servers)
+	if existing, _, _ := unstructured.NestedSlice(project.Object, "spec", "destinations"); reflect.DeepEqual(existing, destinations) {
+		return nil
+	}
+	if err := unstructured.SetNestedSlice(project.Object, destinations, "spec", "destinations"); err != nil {
+		return err
+	}
+	if err := r.Update(ctx, project); err != nil {
+		return fmt.Errorf("unable to update the destinations of AppProject %s: %w", key, err)
+	}
+	log.Info("AppProject destinations updated", "appProject", key.String(), "servers", servers.List())
+	return nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Cluster AppProjects", func() {
+	const (
+		serverOne = "https://api.one.example.com:6443"
+		serverTwo = "https://api.two.example.com:6443"
+	)
+
+	hostedCluster := func(name string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "clusters",
+			Annotations: map[string]string{hyperOpsTenantProjectAnnotation: "tenant-a"},
+		}}
+	}
+	registration := func(hc *hypershiftv1beta1.HostedCluster, server string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      hc.Name,
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{
+					hyperOpsDestinationProjectsAnnotation: "tenant-a",
+					hyperOpsHostedClusterAnnotation:       client.ObjectKeyFromObject(hc).String(),
+				},
+			},
+			Data: map[string][]byte{"server": []byte(server)},
+		}
+	}
+	getProject := func(c client.Client, name string) (*unstructured.Unstructured, error) {
+		project := &unstructured.Unstructured{}
+		project.SetGroupVersionKind(appProjectGVK)
+		return project, c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: name}, project)
+	}
+	servers := func(project *unstructured.Unstructured) []string {
+		destinations, _, _ := unstructured.NestedSlice(project.Object, "spec", "destinations")
+		servers := []string{}
+		for _, d := range destinations {
+			Expect(d).To(HaveKeyWithValue("namespace", "*"))
+			servers = append(servers, d.(map[string]interface{})["server"].(string))
+		}
+		return servers
+	}
+
+	It("Should name the AppProject after the HostedCluster or its tenant", func() {
+		r := &HyperOpsReconciler{}
+		hc := hostedCluster("hosted")
+		Expect(r.clusterAppProject(hc)).To(BeEmpty())
+		r.ClusterAppProjects = ClusterAppProjectsCluster
+		Expect(r.clusterAppProject(hc)).To(Equal("hosted"))
+		r.ClusterAppProjects = ClusterAppProjectsTenant
+		Expect(r.clusterAppProject(hc)).To(Equal("tenant-a"))
+		Expect(destinationProjects(hc, "", "tenant-a")).To(Equal([]string{"tenant-a"}))
+
+		hc.Annotations[hyperOpsTenantProjectAnnotation] = "Tenant A"
+		_, err := r.clusterAppProject(hc)
+		Expect(err).To(HaveOccurred())
+		Expect(ValidateClusterAppProjects("team")).NotTo(Succeed())
+	})
+
+	It("Should restrict the tenant AppProject to the registered clusters of the tenant", func() {
+		one, two := hostedCluster("one"), hostedCluster("two")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, ClusterAppProjects: ClusterAppProjectsTenant}
+
+		Expect(r.reconcileClusterAppProject(context.Background(), one, defaultGitOpsNamespace, serverOne)).To(Succeed())
+		project, err := getProject(c, "tenant-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(project.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(servers(project)).To(Equal([]string{serverOne}))
+		repos, _, _ := unstructured.NestedStringSlice(project.Object, "spec", "sourceRepos")
+		Expect(repos).To(Equal([]string{"*"}))
+
+		By("adding the clusters registered for the tenant")
+		Expect(c.Create(context.Background(), registration(one, serverOne))).To(Succeed())
+		Expect(c.Create(context.Background(), registration(two, serverTwo))).To(Succeed())
+		Expect(r.reconcileClusterAppProject(context.Background(), one, defaultGitOpsNamespace, serverOne)).To(Succeed())
+		project, _ = getProject(c, "tenant-a")
+		Expect(servers(project)).To(Equal([]string{serverOne, serverTwo}))
+
+		By("removing the server of a deregistered cluster")
+		Expect(c.Delete(context.Background(), registration(one, serverOne))).To(Succeed())
+		Expect(r.removeClusterAppProject(context.Background(), one, defaultGitOpsNamespace)).To(Succeed())
+		project, _ = getProject(c, "tenant-a")
+		Expect(servers(project)).To(Equal([]string{serverTwo}))
+
+		By("deleting the AppProject with the last registration")
+		Expect(c.Delete(context.Background(), registration(two, serverTwo))).To(Succeed())
+		Expect(r.removeClusterAppProject(context.Background(), two, defaultGitOpsNamespace)).To(Succeed())
+		_, err = getProject(c, "tenant-a")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should not modify AppProjects it did not create", func() {
+		hc := hostedCluster("hosted")
+		existing := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"destinations": []interface{}{}},
+		}}
+		existing.SetGroupVersionKind(appProjectGVK)
+		existing.SetNamespace(defaultGitOpsNamespace)
+		existing.SetName("hosted")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(existing).Build()
+		r := &HyperOpsReconciler{Client: c, ClusterAppProjects: ClusterAppProjectsCluster}
+
+		Expect(r.reconcileClusterAppProject(context.Background(), hc, defaultGitOpsNamespace, serverOne)).To(Succeed())
+		Expect(r.removeClusterAppProject(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		project, err := getProject(c, "hosted")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(servers(project)).To(BeEmpty())
+	})
+
+	It("Should not create AppProjects in dry-run mode", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, ClusterAppProjects: ClusterAppProjectsCluster, DryRun: true}
+		Expect(r.reconcileClusterAppProject(context.Background(), hostedCluster("hosted"), defaultGitOpsNamespace, serverOne)).To(Succeed())
+		_, err := getProject(c, "hosted")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,48 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// clusterInfo maps every registered HostedCluster to its ArgoCD instance. It is an info metric, the value is always
+// 1 and dashboards join on its labels.
+var clusterInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "hyperops_cluster_info",
+	Help: "Registration of a HostedCluster with ArgoCD, the value is always 1.",
+}, []string{"hostedcluster", "namespace", "argocd_namespace", "server", "platform", "version"})
+
+func init() {
+	metrics.Registry.MustRegister(clusterInfo)
+}
+
+// recordClusterInfo publishes the info metric of the registration, replacing the series of its previous server,
+// version or ArgoCD instance
+func recordClusterInfo(reg *registration) {
+	hc := reg.hc
+	forgetClusterInfo(types.NamespacedName{Namespace: hc.Namespace, Name: hc.Name})
+	clusterInfo.WithLabelValues(hc.Name, hc.Namespace, reg.renderedSecretKey.Namespace, reg.cluster.Server,
+		string(hc.Spec.Platform.Type), hostedClusterVersion(hc)).Set(1)
+}
+
+// forgetClusterInfo removes the info metric of a HostedCluster that is deregistered or gone
+func forgetClusterInfo(key types.NamespacedName) {
+	clusterInfo.DeletePartialMatch(prometheus.Labels{"hostedcluster": key.Name, "namespace": key.Namespace})
+}
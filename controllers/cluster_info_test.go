@@ -0,0 +1,55 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Cluster info metric", func() {
+	It("Should publish one series per registration and remove it", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "info", Namespace: "clusters"},
+			Spec:       hypershiftv1beta1.HostedClusterSpec{Platform: hypershiftv1beta1.PlatformSpec{Type: hypershiftv1beta1.KubevirtPlatform}},
+		}
+		reg := &registration{
+			hc:                hc,
+			cluster:           &Cluster{Cluster: argocd.Cluster{Name: "info", Server: "https://api.info.example.com:6443"}},
+			renderedSecretKey: client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "info"},
+		}
+		recordClusterInfo(reg)
+		Expect(testutil.ToFloat64(clusterInfo.WithLabelValues("info", "clusters", defaultGitOpsNamespace,
+			"https://api.info.example.com:6443", "KubeVirt", ""))).To(Equal(1.0))
+
+		By("replacing the series when the server changes")
+		reg.cluster.Server = "https://api.moved.example.com:6443"
+		recordClusterInfo(reg)
+		Expect(clusterInfo.DeleteLabelValues("info", "clusters", defaultGitOpsNamespace,
+			"https://api.info.example.com:6443", "KubeVirt", "")).To(BeFalse())
+
+		forgetClusterInfo(client.ObjectKeyFromObject(hc))
+		Expect(clusterInfo.DeleteLabelValues("info", "clusters", defaultGitOpsNamespace,
+			"https://api.moved.example.com:6443", "KubeVirt", "")).To(BeFalse())
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+const (
+	// ClusterNameSourceName names the ArgoCD cluster after the HostedCluster (default)
+	ClusterNameSourceName = "name"
+	// ClusterNameSourceInfraID names the ArgoCD cluster after the infraID of the HostedCluster, which changes when a
+	// HostedCluster of the same name is recreated
+	ClusterNameSourceInfraID = "infraID"
+	// ClusterNameSourceTemplate renders the name of the ArgoCD cluster from the cluster name template
+	ClusterNameSourceTemplate = "template"
+)
+
+// clusterNameData is the data the cluster name template is executed with
+type clusterNameData struct {
+	Name      string
+	Namespace string
+	InfraID   string
+	Labels    map[string]string
+}
+
+// ValidateClusterNameSource returns an error if the source is not one of the cluster name sources
+func ValidateClusterNameSource(source string) error {
+	switch source {
+	case ClusterNameSourceName, ClusterNameSourceInfraID, ClusterNameSourceTemplate:
+		return nil
+	}
+	return fmt.Errorf("invalid cluster name source %q, must be %s, %s or %s", source,
+		ClusterNameSourceName, ClusterNameSourceInfraID, ClusterNameSourceTemplate)
+}
+
+// ParseClusterNameTemplate parses the text/template the names of ArgoCD clusters are rendered from. The template is
+// executed with the Name, Namespace, InfraID and Labels of the HostedCluster.
+func ParseClusterNameTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, fmt.Errorf("the cluster name template must not be empty")
+	}
+	tmpl, err := template.New("cluster-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster name template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// argoCDClusterName returns the name of the ArgoCD cluster of the HostedCluster. The name of the ArgoCD cluster
+// secret is not affected, it is always the name of the HostedCluster. ok is false if the infraID of the HostedCluster
+// is not set yet.
+func (r *HyperOpsReconciler) argoCDClusterName(hc *hypershiftv1beta1.HostedCluster) (name string, ok bool, err error) {
+	switch r.ClusterNameSource {
+	case ClusterNameSourceInfraID:
+		return hc.Spec.InfraID, hc.Spec.InfraID != "", nil
+	case ClusterNameSourceTemplate:
+		if r.ClusterNameTemplate == nil {
+			return "", false, fmt.Errorf("the cluster name source is %s but no cluster name template is configured", ClusterNameSourceTemplate)
+		}
+		if hc.Spec.InfraID == "" && strings.Contains(r.ClusterNameTemplate.Root.String(), ".InfraID") {
+			return "", false, nil
+		}
+		var buf bytes.Buffer
+		if err := r.ClusterNameTemplate.Execute(&buf, clusterNameData{
+			Name:      hc.Name,
+			Namespace: hc.Namespace,
+			InfraID:   hc.Spec.InfraID,
+			Labels:    hc.GetLabels(),
+		}); err != nil {
+			return "", false, fmt.Errorf("unable to render the cluster name: %w", err)
+		}
+		name := strings.TrimSpace(buf.String())
+		if name == "" {
+			return "", false, fmt.Errorf("the cluster name template rendered an empty name")
+		}
+		return name, true, nil
+	default:
+		return hc.Name, true, nil
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("ArgoCD cluster names", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", Labels: map[string]string{"team": "blue"}},
+			Spec:       hypershiftv1beta1.HostedClusterSpec{InfraID: "hosted-x7k2p"},
+		}
+	})
+
+	It("Should validate the cluster name source and template", func() {
+		Expect(ValidateClusterNameSource(ClusterNameSourceName)).To(Succeed())
+		Expect(ValidateClusterNameSource(ClusterNameSourceInfraID)).To(Succeed())
+		Expect(ValidateClusterNameSource(ClusterNameSourceTemplate)).To(Succeed())
+		Expect(ValidateClusterNameSource("uid")).NotTo(Succeed())
+		_, err := ParseClusterNameTemplate("")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseClusterNameTemplate("{{.Name")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should name the ArgoCD cluster after the configured source", func() {
+		r := &HyperOpsReconciler{}
+		name, ok, err := r.argoCDClusterName(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("hosted"))
+
+		r.ClusterNameSource = ClusterNameSourceInfraID
+		name, ok, err = r.argoCDClusterName(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("hosted-x7k2p"))
+
+		r.ClusterNameSource = ClusterNameSourceTemplate
+		r.ClusterNameTemplate, err = ParseClusterNameTemplate(`{{.Labels.team}}-{{.Namespace}}-{{.InfraID}}`)
+		Expect(err).NotTo(HaveOccurred())
+		name, ok, err = r.argoCDClusterName(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("blue-clusters-hosted-x7k2p"))
+
+		By("failing on labels the HostedCluster does not have")
+		hc.Labels = nil
+		_, _, err = r.argoCDClusterName(hc)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should wait for the infraID of new HostedClusters", func() {
+		hc.Spec.InfraID = ""
+		r := &HyperOpsReconciler{ClusterNameSource: ClusterNameSourceInfraID}
+		_, ok, err := r.argoCDClusterName(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		r.ClusterNameSource = ClusterNameSourceTemplate
+		r.ClusterNameTemplate, err = ParseClusterNameTemplate(`{{.Name}}-{{.InfraID}}`)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok, err = r.argoCDClusterName(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should only rename the cluster in the secret data", func() {
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"}, ArgoCDName: "hosted-x7k2p"}
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data["name"])).To(Equal("hosted-x7k2p"))
+		Expect(cluster.Name).To(Equal("hosted"))
+	})
+})
@@ -0,0 +1,135 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+// recordClusterRegistration writes the outcome of the registration phases to the ClusterRegistration of the
+// HostedCluster. phaseErr is the error of the last phase that ran. The ClusterRegistration is a view of the
+// registration, failing to write it is logged and doesn't fail the registration.
+func (r *HyperOpsReconciler) recordClusterRegistration(ctx context.Context, reg *registration, phase string, stopped bool, phaseErr error) {
+	if !r.ClusterRegistrations || r.readOnly() {
+		return
+	}
+	if err := r.writeClusterRegistration(ctx, reg, phase, stopped, phaseErr); err != nil {
+		log.FromContext(ctx).Error(err, "unable to record the cluster registration")
+	}
+}
+
+func (r *HyperOpsReconciler) writeClusterRegistration(ctx context.Context, reg *registration, phase string, stopped bool, phaseErr error) error {
+	hc := reg.hc
+	cr := &hyperopsv1alpha1.ClusterRegistration{ObjectMeta: metav1.ObjectMeta{Name: hc.Name, Namespace: hc.Namespace}}
+	if _, err := CreateOrUpdateWithRetries(ctx, r.Client, cr, func() error {
+		stampManaged(cr, correlationID(hc))
+		cr.Spec.HostedClusterName = hc.Name
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to apply ClusterRegistration %s: %w", client.ObjectKeyFromObject(cr), err)
+	}
+
+	status := cr.Status.DeepCopy()
+	status.Phase = phase
+	if reg.renderedSecretKey.Name != "" {
+		status.GitOpsNamespace = reg.renderedSecretKey.Namespace
+		status.SecretName = reg.renderedSecretKey.Name
+	}
+	// copies are only known once the outputs were written
+	if phase == PhaseWriteOutputs || phase == PhaseVerify {
+		status.GitOpsNamespaceCopies = reg.gitOpsNamespaceCopies
+	}
+	if reg.cluster != nil {
+		status.Server = reg.cluster.Server
+		setClusterRegistrationToken(status, reg.cluster)
+	}
+
+	ready := metav1.Condition{
+		Type:    hyperopsv1alpha1.ClusterRegistrationReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Registered",
+		Message: fmt.Sprintf("registered in %s/%s", status.GitOpsNamespace, status.SecretName),
+	}
+	failed := metav1.Condition{
+		Type:    hyperopsv1alpha1.ClusterRegistrationFailed,
+		Status:  metav1.ConditionFalse,
+		Reason:  "PhasesSucceeded",
+		Message: "the last registration attempt succeeded",
+	}
+	switch {
+	case phaseErr != nil:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "PhaseFailed", fmt.Sprintf("%s failed", phase)
+		failed.Status, failed.Reason, failed.Message = metav1.ConditionTrue, "PhaseFailed", phaseErr.Error()
+	case reg.waiting != "":
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "Waiting", reg.waiting
+	case stopped:
+		ready.Status, ready.Reason, ready.Message = metav1.ConditionFalse, "Stopped", fmt.Sprintf("registration stopped in %s", phase)
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+	meta.SetStatusCondition(&status.Conditions, failed)
+
+	if reflect.DeepEqual(status, &cr.Status) {
+		return nil
+	}
+	cr.Status = *status
+	if err := r.Status().Update(ctx, cr); err != nil {
+		return fmt.Errorf("unable to update the status of ClusterRegistration %s: %w", client.ObjectKeyFromObject(cr), err)
+	}
+	return nil
+}
+
+// setClusterRegistrationToken records the issuance and expiration of the bound token. A reused token keeps the
+// recorded issuance, legacy tokens have neither.
+func setClusterRegistrationToken(status *hyperopsv1alpha1.ClusterRegistrationStatus, cluster *Cluster) {
+	if cluster.TokenExpiresAt.IsZero() {
+		status.TokenIssuedAt, status.TokenExpiresAt = nil, nil
+		return
+	}
+	expiresAt := metav1.NewTime(cluster.TokenExpiresAt.Truncate(time.Second))
+	switch {
+	case !cluster.TokenIssuedAt.IsZero():
+		issuedAt := metav1.NewTime(cluster.TokenIssuedAt.Truncate(time.Second))
+		status.TokenIssuedAt = &issuedAt
+	case status.TokenExpiresAt == nil || !status.TokenExpiresAt.Equal(&expiresAt):
+		// a token issued before the ClusterRegistration existed
+		status.TokenIssuedAt = nil
+	}
+	status.TokenExpiresAt = &expiresAt
+}
+
+// removeClusterRegistration deletes the ClusterRegistration of the HostedCluster
+func (r *HyperOpsReconciler) removeClusterRegistration(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	if !r.ClusterRegistrations || r.readOnly() {
+		return nil
+	}
+	cr := &hyperopsv1alpha1.ClusterRegistration{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(hc), cr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, cr))
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Cluster registrations", func() {
+	var c client.Client
+	var r *HyperOpsReconciler
+	var reg *registration
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	key := client.ObjectKeyFromObject(hc)
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+		Expect(hypershiftv1beta1.AddToScheme(s)).To(Succeed())
+		Expect(hyperopsv1alpha1.AddToScheme(s)).To(Succeed())
+		c = fake.NewClientBuilder().WithScheme(s).WithObjects(hc.DeepCopy()).Build()
+		r = &HyperOpsReconciler{Client: c, ClusterRegistrations: true}
+		reg = &registration{
+			hc:                hc,
+			cluster:           &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted.example.com:6443"}, HostedCluster: hc},
+			renderedSecretKey: client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"},
+		}
+	})
+
+	It("Should record a successful registration", func() {
+		issuedAt := time.Now()
+		reg.cluster.TokenIssuedAt, reg.cluster.TokenExpiresAt = issuedAt, issuedAt.Add(24*time.Hour)
+		reg.gitOpsNamespaceCopies = []string{"team-a"}
+		r.recordClusterRegistration(context.Background(), reg, PhaseVerify, false, nil)
+
+		cr := &hyperopsv1alpha1.ClusterRegistration{}
+		Expect(c.Get(context.Background(), key, cr)).To(Succeed())
+		Expect(cr.Spec.HostedClusterName).To(Equal("hosted"))
+		Expect(cr.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(cr.Status.GitOpsNamespace).To(Equal(defaultGitOpsNamespace))
+		Expect(cr.Status.SecretName).To(Equal("hosted"))
+		Expect(cr.Status.GitOpsNamespaceCopies).To(Equal([]string{"team-a"}))
+		Expect(cr.Status.Server).To(Equal("https://api.hosted.example.com:6443"))
+		Expect(cr.Status.TokenIssuedAt.Unix()).To(Equal(issuedAt.Unix()))
+		Expect(meta.IsStatusConditionTrue(cr.Status.Conditions, hyperopsv1alpha1.ClusterRegistrationReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionFalse(cr.Status.Conditions, hyperopsv1alpha1.ClusterRegistrationFailed)).To(BeTrue())
+
+		By("keeping the issuance of a reused token")
+		reg.cluster.TokenIssuedAt = time.Time{}
+		r.recordClusterRegistration(context.Background(), reg, PhaseVerify, false, nil)
+		Expect(c.Get(context.Background(), key, cr)).To(Succeed())
+		Expect(cr.Status.TokenIssuedAt).NotTo(BeNil())
+	})
+
+	It("Should record a failed phase", func() {
+		r.recordClusterRegistration(context.Background(), reg, PhaseWriteOutputs, true, errors.New("hub unavailable"))
+
+		cr := &hyperopsv1alpha1.ClusterRegistration{}
+		Expect(c.Get(context.Background(), key, cr)).To(Succeed())
+		Expect(cr.Status.Phase).To(Equal(PhaseWriteOutputs))
+		Expect(cr.Status.TokenIssuedAt).To(BeNil())
+		ready := meta.FindStatusCondition(cr.Status.Conditions, hyperopsv1alpha1.ClusterRegistrationReady)
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal("PhaseFailed"))
+		failed := meta.FindStatusCondition(cr.Status.Conditions, hyperopsv1alpha1.ClusterRegistrationFailed)
+		Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+		Expect(failed.Message).To(Equal("hub unavailable"))
+	})
+
+	It("Should remove the registration and do nothing when disabled", func() {
+		r.recordClusterRegistration(context.Background(), reg, PhaseVerify, false, nil)
+		Expect(r.removeClusterRegistration(context.Background(), hc)).To(Succeed())
+		err := c.Get(context.Background(), key, &hyperopsv1alpha1.ClusterRegistration{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		r.ClusterRegistrations = false
+		r.recordClusterRegistration(context.Background(), reg, PhaseVerify, false, nil)
+		err = c.Get(context.Background(), key, &hyperopsv1alpha1.ClusterRegistration{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
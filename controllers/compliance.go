@@ -0,0 +1,73 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var (
+	// hyperOpsFIPSLabel is true when the nodes of the hosted cluster run in FIPS mode
+	hyperOpsFIPSLabel = fmt.Sprintf("%s/fips", hyperOpsLabel)
+	// hyperOpsArchLabel is the architecture of the release payload of the hosted cluster, multi for multi-arch payloads
+	hyperOpsArchLabel = fmt.Sprintf("%s/arch", hyperOpsLabel)
+)
+
+// releaseArchitectures maps the architecture suffix of OpenShift release image tags to the GOARCH names used by the
+// kubernetes.io/arch node label
+var releaseArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"ppc64le": "ppc64le",
+	"s390x":   "s390x",
+	"multi":   "multi",
+}
+
+// complianceLabels returns the FIPS and architecture labels derived from the HostedCluster spec, they are always set
+// so compliance scoped ApplicationSets can select on them
+func complianceLabels(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	labels := map[string]string{
+		hyperOpsFIPSLabel: strconv.FormatBool(hc.Spec.FIPS),
+	}
+	if arch := releaseArchitecture(hc.Spec.Release.Image); arch != "" {
+		labels[hyperOpsArchLabel] = arch
+	}
+	return labels
+}
+
+// releaseArchitecture returns the architecture of a release image from the suffix of its tag, e.g.
+// quay.io/openshift-release-dev/ocp-release:4.12.0-aarch64. Images referenced by digest or without a known suffix
+// return an empty string.
+func releaseArchitecture(image string) string {
+	if strings.Contains(image, "@") {
+		return ""
+	}
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	tag := image[i+1:]
+	j := strings.LastIndex(tag, "-")
+	if j < 0 {
+		return ""
+	}
+	return releaseArchitectures[tag[j+1:]]
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Compliance labels", func() {
+	It("Should label the FIPS mode and the release architecture", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				FIPS:    true,
+				Release: hypershiftv1beta1.Release{Image: "quay.io/openshift-release-dev/ocp-release:4.12.0-aarch64"},
+			},
+		}
+		Expect(complianceLabels(hc)).To(Equal(map[string]string{
+			"hyper-ops.cloudmonkey.org/fips": "true",
+			"hyper-ops.cloudmonkey.org/arch": "arm64",
+		}))
+	})
+
+	It("Should always set the FIPS label", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				Release: hypershiftv1beta1.Release{Image: "quay.io/openshift-release-dev/ocp-release@sha256:abc"},
+			},
+		}
+		Expect(complianceLabels(hc)).To(Equal(map[string]string{
+			"hyper-ops.cloudmonkey.org/fips": "false",
+		}))
+	})
+
+	It("Should detect the architecture from the release image tag", func() {
+		Expect(releaseArchitecture("quay.io/openshift-release-dev/ocp-release:4.12.0-x86_64")).To(Equal("amd64"))
+		Expect(releaseArchitecture("quay.io/openshift-release-dev/ocp-release:4.13.0-multi")).To(Equal("multi"))
+		Expect(releaseArchitecture("registry.local:5000/ocp-release:4.12.0-s390x")).To(Equal("s390x"))
+		Expect(releaseArchitecture("registry.local:5000/ocp-release")).To(BeEmpty())
+		Expect(releaseArchitecture("quay.io/openshift-release-dev/ocp-release:4.12.0")).To(BeEmpty())
+	})
+})
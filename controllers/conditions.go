@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+)
+
+const (
+	// hyperOpsConditionsAnnotation holds the registration conditions of a HostedCluster as a JSON list
+	hyperOpsConditionsAnnotation = "hyper-ops.cloudmonkey.org/conditions"
+
+	// ConditionDuplicateServer is true when another registration already uses the same API server URL
+	ConditionDuplicateServer = "DuplicateServer"
+	// ConditionGitOpsNamespaceReady is true when the gitops namespace the HostedCluster registers into exists
+	ConditionGitOpsNamespaceReady = "GitOpsNamespaceReady"
+	// ConditionBoundServiceAccountToken is true when the registration uses a TokenRequest issued token instead of the
+	// legacy service account token secret
+	ConditionBoundServiceAccountToken = "BoundServiceAccountToken"
+)
+
+// registrationConditions returns the registration conditions recorded on the HostedCluster
+func registrationConditions(hc *hypershiftv1beta1.HostedCluster) []metav1.Condition {
+	conditions := []metav1.Condition{}
+	if raw, ok := hc.GetAnnotations()[hyperOpsConditionsAnnotation]; ok {
+		// a malformed annotation is treated as no conditions and overwritten on the next update
+		_ = json.Unmarshal([]byte(raw), &conditions)
+	}
+	return conditions
+}
+
+// setRegistrationCondition records the condition on the HostedCluster, the HostedCluster is only patched when the
+// condition changed. Credentials in the message, e.g. from errors of hosted cluster clients, are scrubbed.
+func (r *HyperOpsReconciler) setRegistrationCondition(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, condition metav1.Condition) error {
+	if r.readOnly() {
+		return nil
+	}
+	condition.Message = redact.String(condition.Message)
+	conditions := registrationConditions(hc)
+	if existing := meta.FindStatusCondition(conditions, condition.Type); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return nil
+	}
+	meta.SetStatusCondition(&conditions, condition)
+	raw, err := json.Marshal(conditions)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(hc.DeepCopy())
+	metav1.SetMetaDataAnnotation(&hc.ObjectMeta, hyperOpsConditionsAnnotation, string(raw))
+	return r.Patch(ctx, hc, patch)
+}
+
+// recordEvent emits an event on the object with credentials scrubbed from the message, events are only emitted when
+// the reconciler has a recorder
+func (r *HyperOpsReconciler) recordEvent(obj runtime.Object, eventType, reason, message string) {
+	if r.Recorder == nil || r.readOnly() {
+		return
+	}
+	r.Recorder.Event(obj, eventType, reason, redact.String(message))
+}
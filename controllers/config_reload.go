@@ -0,0 +1,196 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+// DefaultConfigReloadInterval is how often the operator config file is checked for changes
+const DefaultConfigReloadInterval = 30 * time.Second
+
+// LoadOperatorConfig reads the HyperOpsOperatorConfig from the file, the scheme must know the config type
+func LoadOperatorConfig(path string, scheme *runtime.Scheme) (*hyperopsv1alpha1.HyperOpsOperatorConfig, error) {
+	config := &hyperopsv1alpha1.HyperOpsOperatorConfig{}
+	loader := ctrl.ConfigFile().AtPath(path).OfKind(config)
+	if err := loader.InjectScheme(scheme); err != nil {
+		return nil, err
+	}
+	if _, err := loader.Complete(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DecodeOperatorConfig decodes a HyperOpsOperatorConfig document like LoadOperatorConfig, e.g. from a ConfigMap
+func DecodeOperatorConfig(content []byte, scheme *runtime.Scheme) (*hyperopsv1alpha1.HyperOpsOperatorConfig, error) {
+	config := &hyperopsv1alpha1.HyperOpsOperatorConfig{}
+	if err := runtime.DecodeInto(serializer.NewCodecFactory(scheme).UniversalDecoder(), content, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// RuntimeConfig holds the hot reloadable registration settings
+type RuntimeConfig struct {
+	DuplicateServerWinner string
+	TerminalStatePolicy   string
+	SecretConflictPolicy  string
+	UpgradePolicy         string
+	TerminalStateTimeout  time.Duration
+	HostedClusterHeaders  map[string]string
+	Policies              []*RegistrationPolicy
+	Quotas                []hyperopsv1alpha1.RegistrationQuota
+}
+
+// ConfigReloader applies the hot reloadable settings of the operator config file to the reconciler whenever the file
+// changes. Other settings only take effect after a restart.
+type ConfigReloader struct {
+	Path       string
+	Scheme     *runtime.Scheme
+	Interval   time.Duration
+	Reconciler *HyperOpsReconciler
+	// Defaults are the hot reloadable settings given by the flags, settings missing from the file revert to them
+	Defaults RuntimeConfig
+
+	last []byte
+}
+
+// Start watches the config file until the context is cancelled, it implements manager.Runnable
+func (c *ConfigReloader) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("config-reload")
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultConfigReloadInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		content, err := os.ReadFile(c.Path)
+		if err != nil {
+			log.Error(err, "unable to read operator config", "path", c.Path)
+			return
+		}
+		if c.last != nil && bytes.Equal(content, c.last) {
+			return
+		}
+		config, err := LoadOperatorConfig(c.Path, c.Scheme)
+		if err != nil {
+			log.Error(err, "unable to load operator config", "path", c.Path)
+			return
+		}
+		// a config that would be rejected at startup is not applied either
+		warnings, err := ValidateRegistrationConfig(ctx, c.Reconciler.Client, config.Registration)
+		if err != nil {
+			log.Error(err, "invalid operator config", "path", c.Path)
+			return
+		}
+		for _, warning := range warnings {
+			log.Info("operator config warning", "path", c.Path, "warning", warning)
+		}
+		if err := c.Reconciler.ApplyRuntimeConfig(c.Defaults, config.Registration); err != nil {
+			log.Error(err, "unable to apply operator config", "path", c.Path)
+			return
+		}
+		if c.last != nil {
+			log.Info("reloaded operator config", "path", c.Path)
+		}
+		c.last = content
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection is false, every replica applies the config
+func (c *ConfigReloader) NeedLeaderElection() bool {
+	return false
+}
+
+// ApplyRuntimeConfig replaces the hot reloadable registration settings with the defaults overridden by the settings
+// of the config, so settings removed from the config revert to their defaults. It waits for running reconciles to
+// finish.
+func (r *HyperOpsReconciler) ApplyRuntimeConfig(defaults RuntimeConfig, config hyperopsv1alpha1.RegistrationConfig) error {
+	if w := config.DuplicateServerWinner; w != "" && w != DuplicateServerWinnerOldest && w != DuplicateServerWinnerNewest {
+		return fmt.Errorf("invalid duplicateServerWinner %q, must be oldest or newest", w)
+	}
+	if p := config.TerminalStatePolicy; p != "" {
+		if err := ValidateTerminalStatePolicy(p); err != nil {
+			return err
+		}
+	}
+	if p := config.SecretConflictPolicy; p != "" {
+		if err := ValidateSecretConflictPolicy(p); err != nil {
+			return err
+		}
+	}
+	if p := config.UpgradePolicy; p != "" {
+		if err := ValidateUpgradePolicy(p); err != nil {
+			return err
+		}
+	}
+	if err := ValidateRegistrationQuotas(config.Quotas); err != nil {
+		return err
+	}
+	settings := defaults
+	if config.Policies != nil {
+		var err error
+		if settings.Policies, err = CompilePolicies(config.Policies); err != nil {
+			return err
+		}
+	}
+	if config.DuplicateServerWinner != "" {
+		settings.DuplicateServerWinner = config.DuplicateServerWinner
+	}
+	if config.TerminalStatePolicy != "" {
+		settings.TerminalStatePolicy = config.TerminalStatePolicy
+	}
+	if config.SecretConflictPolicy != "" {
+		settings.SecretConflictPolicy = config.SecretConflictPolicy
+	}
+	if config.UpgradePolicy != "" {
+		settings.UpgradePolicy = config.UpgradePolicy
+	}
+	if config.TerminalStateTimeout != nil {
+		settings.TerminalStateTimeout = config.TerminalStateTimeout.Duration
+	}
+	if config.HostedClusterHeaders != nil {
+		settings.HostedClusterHeaders = config.HostedClusterHeaders
+	}
+	if config.Quotas != nil {
+		settings.Quotas = config.Quotas
+	}
+	r.configMu.Lock()
+	defer r.configMu.Unlock()
+	r.DuplicateServerWinner = settings.DuplicateServerWinner
+	r.TerminalStatePolicy = settings.TerminalStatePolicy
+	r.SecretConflictPolicy = settings.SecretConflictPolicy
+	r.UpgradePolicy = settings.UpgradePolicy
+	r.TerminalStateTimeout = settings.TerminalStateTimeout
+	r.HostedClusterHeaders = settings.HostedClusterHeaders
+	r.Policies = settings.Policies
+	r.Quotas = settings.Quotas
+	return nil
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("Operator config", func() {
+	var s *runtime.Scheme
+
+	BeforeEach(func() {
+		s = runtime.NewScheme()
+		Expect(hyperopsv1alpha1.AddToScheme(s)).To(Succeed())
+	})
+
+	It("Should load the operator config file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.WriteFile(path, []byte(`apiVersion: hyper-ops.cloudmonkey.org/v1alpha1
+kind: HyperOpsOperatorConfig
+registration:
+  duplicateServerWinner: newest
+  hostedClusterHeaders:
+    X-Fleet: prod
+refresh:
+  qps: 2.5
+fleetReport:
+  interval: 5m
+`), 0o600)).To(Succeed())
+
+		config, err := LoadOperatorConfig(path, s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Registration.DuplicateServerWinner).To(Equal(DuplicateServerWinnerNewest))
+		Expect(*config.Refresh.QPS).To(Equal(2.5))
+		Expect(config.FleetReport.Interval.Duration.Minutes()).To(Equal(5.0))
+
+		r := &HyperOpsReconciler{DuplicateServerWinner: DuplicateServerWinnerOldest}
+		Expect(r.ApplyRuntimeConfig(RuntimeConfig{DuplicateServerWinner: DuplicateServerWinnerOldest}, config.Registration)).To(Succeed())
+		Expect(r.DuplicateServerWinner).To(Equal(DuplicateServerWinnerNewest))
+		Expect(r.HostedClusterHeaders).To(HaveKeyWithValue("X-Fleet", "prod"))
+	})
+
+	It("Should reject invalid hot reloaded settings", func() {
+		r := &HyperOpsReconciler{DuplicateServerWinner: DuplicateServerWinnerOldest}
+		Expect(r.ApplyRuntimeConfig(RuntimeConfig{}, hyperopsv1alpha1.RegistrationConfig{DuplicateServerWinner: "random"})).NotTo(Succeed())
+		Expect(r.DuplicateServerWinner).To(Equal(DuplicateServerWinnerOldest))
+	})
+
+	It("Should revert settings removed from the config to their defaults", func() {
+		defaults := RuntimeConfig{
+			DuplicateServerWinner: DuplicateServerWinnerOldest,
+			HostedClusterHeaders:  map[string]string{"X-Fleet": "default"},
+			Quotas:                []hyperopsv1alpha1.RegistrationQuota{{Name: "namespace", Max: 10}},
+		}
+		r := &HyperOpsReconciler{}
+		Expect(r.ApplyRuntimeConfig(defaults, hyperopsv1alpha1.RegistrationConfig{
+			DuplicateServerWinner: DuplicateServerWinnerNewest,
+			HostedClusterHeaders:  map[string]string{"X-Fleet": "prod"},
+			Quotas:                []hyperopsv1alpha1.RegistrationQuota{{Name: "team", LabelKey: "team", Max: 2}},
+			Policies:              []hyperopsv1alpha1.RegistrationPolicy{{Name: "deny-all", Validate: "false"}},
+		})).To(Succeed())
+		Expect(r.DuplicateServerWinner).To(Equal(DuplicateServerWinnerNewest))
+		Expect(r.Policies).To(HaveLen(1))
+
+		Expect(r.ApplyRuntimeConfig(defaults, hyperopsv1alpha1.RegistrationConfig{})).To(Succeed())
+		Expect(r.DuplicateServerWinner).To(Equal(DuplicateServerWinnerOldest))
+		Expect(r.HostedClusterHeaders).To(HaveKeyWithValue("X-Fleet", "default"))
+		Expect(r.Quotas).To(Equal(defaults.Quotas))
+		Expect(r.Policies).To(BeEmpty())
+	})
+})
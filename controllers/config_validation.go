@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+// ValidateRegistrationConfig checks the registration settings of an operator config before it is rolled out, it
+// compiles the policies, routes and templates the controller would otherwise only reject at startup or reload. With
+// a client it also warns about gitops namespaces referenced by the config that don't exist.
+func ValidateRegistrationConfig(ctx context.Context, c client.Reader, config hyperopsv1alpha1.RegistrationConfig) ([]string, error) {
+	errs := []error{}
+	if e := config.DefaultEnrollment; e != "" && e != DefaultEnrollmentEnabled && e != DefaultEnrollmentDisabled {
+		errs = append(errs, fmt.Errorf("invalid defaultEnrollment %q, must be enabled or disabled", e))
+	}
+	if w := config.DuplicateServerWinner; w != "" && w != DuplicateServerWinnerOldest && w != DuplicateServerWinnerNewest {
+		errs = append(errs, fmt.Errorf("invalid duplicateServerWinner %q, must be oldest or newest", w))
+	}
+	if p := config.TerminalStatePolicy; p != "" {
+		errs = append(errs, ValidateTerminalStatePolicy(p))
+	}
+	if p := config.SecretConflictPolicy; p != "" {
+		errs = append(errs, ValidateSecretConflictPolicy(p))
+	}
+	if p := config.UpgradePolicy; p != "" {
+		errs = append(errs, ValidateUpgradePolicy(p))
+	}
+	if role := config.HostedClusterRole; role != "" {
+		errs = append(errs, ValidateHostedClusterRole(role))
+	}
+	if m := config.AuthMode; m != "" {
+		errs = append(errs, ValidateAuthMode(m))
+	}
+	errs = append(errs, ValidateClusterAppProjects(config.ClusterAppProjects))
+	if c := config.PrivateClusterConnectivity; c != "" {
+		errs = append(errs, ValidateConnectivity(c))
+	}
+	if i := config.StandaloneInstaller; i != "" {
+		errs = append(errs, ValidateStandaloneInstaller(i))
+	}
+	if _, err := ParseBaselineManifestsConfigMap(config.BaselineManifestsConfigMap); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, ValidateBaselineManifestsArtifact(config.BaselineManifestsOCIArtifact))
+	errs = append(errs, ValidateAWSRoleName(config.AWSRoleName))
+	errs = append(errs, ValidateShards(config.Shards))
+	if s := config.ClusterNameSource; s != "" {
+		errs = append(errs, ValidateClusterNameSource(s))
+		if s == ClusterNameSourceTemplate {
+			_, err := ParseClusterNameTemplate(config.ClusterNameTemplate)
+			errs = append(errs, err)
+		}
+	}
+	if config.DiscoveryLabels != nil {
+		errs = append(errs, ValidateDiscoveryLabels(config.DiscoveryLabels))
+	}
+	if config.TokenAudiences != nil {
+		errs = append(errs, ValidateTokenAudiences(config.TokenAudiences))
+	}
+	if config.CIOutputs != nil {
+		errs = append(errs, ValidateCIOutputs(config.CIOutputs))
+	}
+	if config.Flux != nil {
+		errs = append(errs, ValidateFluxConfig(config.Flux))
+	}
+	if config.RancherFleet != nil {
+		errs = append(errs, ValidateRancherFleetConfig(config.RancherFleet))
+	}
+	if config.ACM != nil {
+		errs = append(errs, ValidateACMConfig(config.ACM))
+	}
+	if config.Karmada != nil {
+		errs = append(errs, ValidateKarmadaConfig(config.Karmada))
+	}
+	if s := config.LabelSchema; s != nil {
+		if s.Version != "" {
+			errs = append(errs, ValidateLabelSchema(s.Version))
+		}
+		if i := s.MigrationInterval; i != nil && i.Duration < 0 {
+			errs = append(errs, fmt.Errorf("labelSchema.migrationInterval %s must not be negative", i.Duration))
+		}
+	}
+	if age := config.MaxCredentialAge; age != nil && age.Duration < 0 {
+		errs = append(errs, fmt.Errorf("maxCredentialAge %s must not be negative", age.Duration))
+	}
+	errs = append(errs, ValidateRegistrationQuotas(config.Quotas))
+	if config.Policies != nil {
+		_, err := CompilePolicies(config.Policies)
+		errs = append(errs, err)
+	}
+	if config.GitOpsNamespaceRoutes != nil {
+		_, err := CompileGitOpsNamespaceRoutes(config.GitOpsNamespaceRoutes)
+		errs = append(errs, err)
+	}
+	if config.ArgoCDInstanceSelector != nil {
+		_, err := CompileArgoCDInstanceSelector(config.ArgoCDInstanceSelector)
+		errs = append(errs, err)
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil || c == nil {
+		return nil, err
+	}
+	return missingGitOpsNamespaces(ctx, c, config)
+}
+
+// missingGitOpsNamespaces warns about the gitops namespaces of the routes, quotas and discovery labels that don't
+// exist, registrations into them wait until they are created
+func missingGitOpsNamespaces(ctx context.Context, c client.Reader, config hyperopsv1alpha1.RegistrationConfig) ([]string, error) {
+	referenced := map[string]string{}
+	for _, route := range config.GitOpsNamespaceRoutes {
+		referenced[route.Namespace] = "gitOpsNamespaceRoutes"
+	}
+	for _, q := range config.Quotas {
+		if q.GitOpsNamespace != "" {
+			referenced[q.GitOpsNamespace] = fmt.Sprintf("quota %s", q.Name)
+		}
+	}
+	for ns := range config.DiscoveryLabels {
+		if ns != "*" {
+			referenced[ns] = "discoveryLabels"
+		}
+	}
+	warnings := []string{}
+	for ns, source := range referenced {
+		if err := c.Get(ctx, client.ObjectKey{Name: ns}, &corev1.Namespace{}); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			warnings = append(warnings, fmt.Sprintf("gitops namespace %s referenced by %s does not exist", ns, source))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("Operator config validation", func() {
+	It("Should reject every invalid setting at once", func() {
+		_, err := ValidateRegistrationConfig(context.Background(), nil, hyperopsv1alpha1.RegistrationConfig{
+			DefaultEnrollment:   "sometimes",
+			ClusterNameSource:   ClusterNameSourceTemplate,
+			ClusterNameTemplate: "{{.Name",
+			Policies:            []hyperopsv1alpha1.RegistrationPolicy{{Name: "broken", Validate: "hostedCluster.metadata.name =="}},
+			GitOpsNamespaceRoutes: []hyperopsv1alpha1.GitOpsNamespaceRoute{{
+				Selector:  metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Near"}}},
+				Namespace: "argocd-premium",
+			}},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("defaultEnrollment"))
+		Expect(err.Error()).To(ContainSubstring("cluster name template"))
+		Expect(err.Error()).To(ContainSubstring("policy broken"))
+		Expect(err.Error()).To(ContainSubstring("Near"))
+	})
+
+	It("Should warn about gitops namespaces that don't exist", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "argocd-ml"}},
+		).Build()
+		warnings, err := ValidateRegistrationConfig(context.Background(), c, hyperopsv1alpha1.RegistrationConfig{
+			GitOpsNamespaceRoutes: []hyperopsv1alpha1.GitOpsNamespaceRoute{
+				{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"purpose": "ml"}}, Namespace: "argocd-ml"},
+				{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"tier": "gold"}}, Namespace: "argocd-premium"},
+			},
+			Quotas: []hyperopsv1alpha1.RegistrationQuota{{Name: "teams", Max: 10, GitOpsNamespace: "argocd-teams"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(Equal([]string{
+			"gitops namespace argocd-premium referenced by gitOpsNamespaceRoutes does not exist",
+			"gitops namespace argocd-teams referenced by quota teams does not exist",
+		}))
+	})
+})
@@ -0,0 +1,83 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// OperatorConfigWebhookPath is the path the operator config validation webhook is served on
+	OperatorConfigWebhookPath = "/validate-hyperops-operator-config"
+	// OperatorConfigLabel marks the ConfigMaps holding a HyperOpsOperatorConfig, the validation webhook only selects
+	// ConfigMaps with the label
+	OperatorConfigLabel = "hyper-ops.cloudmonkey.org/operator-config"
+)
+
+// OperatorConfigValidator is a validating admission webhook for the ConfigMaps holding the operator config file. Every
+// key of the ConfigMap must hold a HyperOpsOperatorConfig that passes ValidateRegistrationConfig, so a config the
+// operator would reject on reload is rejected when it is applied. Warnings, e.g. about missing gitops namespaces, are
+// returned as admission warnings.
+type OperatorConfigValidator struct {
+	// Client looks up the gitops namespaces referenced by the config, they are not checked if nil
+	Client client.Reader
+	// Scheme must know the HyperOpsOperatorConfig type
+	Scheme *runtime.Scheme
+}
+
+var _ admission.Handler = &OperatorConfigValidator{}
+
+// Handle validates the operator config of a created or updated ConfigMap
+func (v *OperatorConfigValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+	cm := &corev1.ConfigMap{}
+	if err := json.Unmarshal(req.Object.Raw, cm); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	warnings := []string{}
+	for _, key := range keys {
+		config, err := DecodeOperatorConfig([]byte(cm.Data[key]), v.Scheme)
+		if err != nil {
+			return admission.Denied(fmt.Sprintf("%s: unable to decode the operator config: %v", key, err))
+		}
+		keyWarnings, err := ValidateRegistrationConfig(ctx, v.Client, config.Registration)
+		if err != nil {
+			return admission.Denied(fmt.Sprintf("%s: %v", key, err))
+		}
+		for _, warning := range keyWarnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", key, warning))
+		}
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("Operator config webhook", func() {
+	var v *OperatorConfigValidator
+
+	BeforeEach(func() {
+		s := runtime.NewScheme()
+		Expect(hyperopsv1alpha1.AddToScheme(s)).To(Succeed())
+		v = &OperatorConfigValidator{Scheme: s}
+	})
+
+	request := func(operation admissionv1.Operation, config string) admission.Request {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-config", Namespace: "hyper-ops-system"},
+			Data:       map[string]string{"controller_manager_config.yaml": config},
+		}
+		raw, err := json.Marshal(cm)
+		Expect(err).NotTo(HaveOccurred())
+		req := admission.Request{}
+		req.Operation = operation
+		req.Object = runtime.RawExtension{Raw: raw}
+		return req
+	}
+
+	It("Should admit a valid operator config", func() {
+		resp := v.Handle(context.Background(), request(admissionv1.Create, `apiVersion: hyper-ops.cloudmonkey.org/v1alpha1
+kind: HyperOpsOperatorConfig
+registration:
+  duplicateServerWinner: newest
+`))
+		Expect(resp.Allowed).To(BeTrue())
+	})
+
+	It("Should deny an operator config the controller would reject on reload", func() {
+		resp := v.Handle(context.Background(), request(admissionv1.Update, `apiVersion: hyper-ops.cloudmonkey.org/v1alpha1
+kind: HyperOpsOperatorConfig
+registration:
+  duplicateServerWinner: random
+`))
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(string(resp.Result.Reason)).To(ContainSubstring("duplicateServerWinner"))
+
+		resp = v.Handle(context.Background(), request(admissionv1.Create, "registration: ["))
+		Expect(resp.Allowed).To(BeFalse())
+	})
+
+	It("Should not block the deletion of a ConfigMap", func() {
+		Expect(v.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Delete}}).Allowed).To(BeTrue())
+	})
+})
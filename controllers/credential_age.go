@@ -0,0 +1,208 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Rotation keeps credentials young as long as it works. The maximum credential age is a hard cap on top of it for
+// audits requiring that no credential is older than a given age: a registration whose credential outlived the cap,
+// e.g. because its renewal kept failing, is flagged and, if quarantining is enabled, withdrawn from ArgoCD until a
+// newer credential is obtained.
+
+const (
+	// hyperOpsQuarantinedCredentialsAnnotation records the fingerprints of the credentials of a HostedCluster that
+	// exceeded the maximum credential age, they are not registered again
+	hyperOpsQuarantinedCredentialsAnnotation = "hyper-ops.cloudmonkey.org/quarantined-credentials"
+
+	// ConditionCredentialMaxAgeExceeded is true when the credential of the registration is older than the maximum
+	// credential age
+	ConditionCredentialMaxAgeExceeded = "CredentialMaxAgeExceeded"
+)
+
+var (
+	credentialAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hyperops_credential_age_seconds",
+		Help: "Time since the credential in the ArgoCD cluster secret of a HostedCluster was rotated.",
+	}, []string{"hostedcluster", "namespace", "credential"})
+	credentialMaxAgeExceeded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hyperops_credential_max_age_exceeded",
+		Help: "1 if a credential of the registration of a HostedCluster is older than the maximum credential age.",
+	}, []string{"hostedcluster", "namespace"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(credentialAge, credentialMaxAgeExceeded)
+}
+
+// ValidateMaxCredentialAge returns an error if bound tokens are renewed later than the maximum credential age
+func ValidateMaxCredentialAge(maxAge, ttl, renewBefore time.Duration) error {
+	if maxAge < 0 {
+		return fmt.Errorf("the maximum credential age %s must not be negative", maxAge)
+	}
+	if maxAge > 0 && ttl-renewBefore >= maxAge {
+		return fmt.Errorf("bound tokens are renewed after %s, later than the maximum credential age of %s", ttl-renewBefore, maxAge)
+	}
+	return nil
+}
+
+// credentialAges returns the time since every credential on the ArgoCD cluster secret was rotated, keyed by credential
+// kind
+func credentialAges(secret *corev1.Secret, now time.Time) map[string]time.Duration {
+	ages := map[string]time.Duration{}
+	for _, kind := range []string{credentialToken, credentialClientCertificate} {
+		rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[fmt.Sprintf("%s/%s-rotated-at", hyperOpsLabel, kind)])
+		if err != nil {
+			continue
+		}
+		ages[kind] = now.Sub(rotatedAt)
+	}
+	return ages
+}
+
+// quarantinedCredentials returns the quarantined credential fingerprints of the HostedCluster
+func quarantinedCredentials(hc *hypershiftv1beta1.HostedCluster) map[string]bool {
+	quarantined := map[string]bool{}
+	for _, fp := range strings.Split(hc.GetAnnotations()[hyperOpsQuarantinedCredentialsAnnotation], ",") {
+		if fp = strings.TrimSpace(fp); fp != "" {
+			quarantined[fp] = true
+		}
+	}
+	return quarantined
+}
+
+// quarantinedCredential returns the kind of the first credential in the fingerprints that is quarantined
+func quarantinedCredential(hc *hypershiftv1beta1.HostedCluster, fingerprints map[string]string) (string, bool) {
+	quarantined := quarantinedCredentials(hc)
+	for _, kind := range []string{credentialToken, credentialClientCertificate} {
+		if fp, ok := fingerprints[kind]; ok && quarantined[fp] {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// enforceMaxCredentialAge checks the age of the credentials of the registration against the maximum credential age.
+// An exceeded age is reported in the CredentialMaxAgeExceeded registration condition, the metric and a warning
+// event; with QuarantineStaleCredentials the registration is withdrawn and the credential quarantined, so only a newer
+// credential is registered again.
+func (r *HyperOpsReconciler) enforceMaxCredentialAge(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	// the secrets of a remote ArgoCD aren't read
+	if r.MaxCredentialAge <= 0 || r.remoteRegistrations() != nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	// a withdrawn registration no longer serves its credential
+	if !hyperOpsManaged(secret) || !sameClusterIdentity(secret, hc) || secret.Labels[hyperOpsPendingDeletionLabel] == "true" {
+		return nil
+	}
+	ages := credentialAges(secret, time.Now())
+	exceeded := []string{}
+	for kind, age := range ages {
+		credentialAge.WithLabelValues(hc.Name, hc.Namespace, kind).Set(age.Seconds())
+		if age > r.MaxCredentialAge {
+			exceeded = append(exceeded, fmt.Sprintf("the %s is %s old", kind, age.Truncate(time.Second)))
+		}
+	}
+	if len(exceeded) == 0 {
+		credentialMaxAgeExceeded.WithLabelValues(hc.Name, hc.Namespace).Set(0)
+		if meta.FindStatusCondition(registrationConditions(hc), ConditionCredentialMaxAgeExceeded) == nil {
+			return nil
+		}
+		return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionCredentialMaxAgeExceeded,
+			Status:  metav1.ConditionFalse,
+			Reason:  "WithinMaxAge",
+			Message: fmt.Sprintf("the credentials are younger than the maximum credential age of %s", r.MaxCredentialAge),
+		})
+	}
+	sort.Strings(exceeded)
+	credentialMaxAgeExceeded.WithLabelValues(hc.Name, hc.Namespace).Set(1)
+	message := fmt.Sprintf("%s, exceeding the maximum credential age of %s", strings.Join(exceeded, " and "), r.MaxCredentialAge)
+	log.FromContext(ctx).Info("credential exceeds the maximum credential age", "message", message)
+	r.recordEvent(hc, corev1.EventTypeWarning, "CredentialMaxAgeExceeded", message)
+	condition := metav1.Condition{
+		Type:    ConditionCredentialMaxAgeExceeded,
+		Status:  metav1.ConditionTrue,
+		Reason:  "MaxAgeExceeded",
+		Message: message,
+	}
+	if r.QuarantineStaleCredentials && !r.readOnly() {
+		if err := r.quarantineCredentials(ctx, hc, gitOpsNamespace, secret); err != nil {
+			return err
+		}
+		condition.Reason = "Quarantined"
+		condition.Message += ", the registration was withdrawn until a newer credential is obtained"
+	}
+	return r.setRegistrationCondition(ctx, hc, condition)
+}
+
+// quarantineCredentials records the fingerprints of the credentials of the ArgoCD cluster secret on the HostedCluster
+// and withdraws the registration
+func (r *HyperOpsReconciler) quarantineCredentials(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string, secret *corev1.Secret) error {
+	quarantined := quarantinedCredentials(hc)
+	for _, kind := range []string{credentialToken, credentialClientCertificate} {
+		if fp := secret.Annotations[fmt.Sprintf("%s/%s-fingerprint", hyperOpsLabel, kind)]; fp != "" {
+			quarantined[fp] = true
+		}
+	}
+	fingerprints := make([]string, 0, len(quarantined))
+	for fp := range quarantined {
+		fingerprints = append(fingerprints, fp)
+	}
+	sort.Strings(fingerprints)
+	patch := client.MergeFrom(hc.DeepCopy())
+	metav1.SetMetaDataAnnotation(&hc.ObjectMeta, hyperOpsQuarantinedCredentialsAnnotation, strings.Join(fingerprints, ","))
+	if err := r.Patch(ctx, hc, patch); err != nil {
+		return fmt.Errorf("unable to quarantine the credentials: %w", err)
+	}
+	return r.deregisterArgoCDClusterSecrets(ctx, hc, gitOpsNamespace)
+}
+
+// releaseCredentialQuarantine forgets the quarantined credentials once a newer credential is registered
+func (r *HyperOpsReconciler) releaseCredentialQuarantine(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	if _, ok := hc.GetAnnotations()[hyperOpsQuarantinedCredentialsAnnotation]; !ok || r.readOnly() {
+		return nil
+	}
+	patch := client.MergeFrom(hc.DeepCopy())
+	delete(hc.Annotations, hyperOpsQuarantinedCredentialsAnnotation)
+	return r.Patch(ctx, hc, patch)
+}
+
+// forgetCredentialAge removes the metrics of a HostedCluster that is gone
+func forgetCredentialAge(key types.NamespacedName) {
+	credentialAge.DeletePartialMatch(prometheus.Labels{"hostedcluster": key.Name, "namespace": key.Namespace})
+	credentialMaxAgeExceeded.DeleteLabelValues(key.Name, key.Namespace)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Maximum credential age", func() {
+	var c client.Client
+	var hc *hypershiftv1beta1.HostedCluster
+	key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}
+	cluster := func(token string) *Cluster {
+		return &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443", Config: argocd.ClusterConfig{BearerToken: token}}}
+	}
+	registration := func(token string, rotatedAt time.Time) *corev1.Secret {
+		data, err := cluster(token).SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        key.Name,
+				Namespace:   key.Namespace,
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/hosted"},
+			},
+			Data: data,
+		}
+		trackCredentialRotation(secret, credentialFingerprints(cluster(token)), rotatedAt)
+		return secret
+	}
+	condition := func() *metav1.Condition {
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		return meta.FindStatusCondition(registrationConditions(updated), ConditionCredentialMaxAgeExceeded)
+	}
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	})
+
+	It("Should reject a maximum age bound tokens outlive", func() {
+		Expect(ValidateMaxCredentialAge(0, 24*time.Hour, 8*time.Hour)).To(Succeed())
+		Expect(ValidateMaxCredentialAge(7*24*time.Hour, 24*time.Hour, 8*time.Hour)).To(Succeed())
+		Expect(ValidateMaxCredentialAge(12*time.Hour, 24*time.Hour, 8*time.Hour)).NotTo(Succeed())
+		Expect(ValidateMaxCredentialAge(-time.Hour, 0, 0)).NotTo(Succeed())
+	})
+
+	It("Should flag credentials older than the maximum age", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, registration("stale", time.Now().Add(-10*24*time.Hour))).Build()
+		r := &HyperOpsReconciler{Client: c, MaxCredentialAge: 7 * 24 * time.Hour}
+		Expect(r.enforceMaxCredentialAge(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+
+		Expect(condition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition().Reason).To(Equal("MaxAgeExceeded"))
+		Expect(testutil.ToFloat64(credentialMaxAgeExceeded.WithLabelValues("hosted", "clusters"))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(credentialAge.WithLabelValues("hosted", "clusters", credentialToken))).To(BeNumerically(">", 9*24*time.Hour.Seconds()))
+		// without quarantining the registration stays in place
+		Expect(c.Get(context.Background(), key, &corev1.Secret{})).To(Succeed())
+
+		// a renewed credential clears the condition
+		Expect(c.Update(context.Background(), registration("renewed", time.Now()))).To(Succeed())
+		Expect(r.enforceMaxCredentialAge(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(condition().Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition().Reason).To(Equal("WithinMaxAge"))
+		Expect(testutil.ToFloat64(credentialMaxAgeExceeded.WithLabelValues("hosted", "clusters"))).To(Equal(0.0))
+
+		forgetCredentialAge(client.ObjectKeyFromObject(hc))
+		Expect(testutil.CollectAndCount(credentialMaxAgeExceeded)).To(Equal(0))
+	})
+
+	It("Should not set the condition for registrations that never exceeded the maximum age", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, registration("fresh", time.Now())).Build()
+		r := &HyperOpsReconciler{Client: c, MaxCredentialAge: 7 * 24 * time.Hour}
+		Expect(r.enforceMaxCredentialAge(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(condition()).To(BeNil())
+	})
+
+	It("Should quarantine stale credentials until a newer one is registered", func() {
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, registration("stale", time.Now().Add(-10*24*time.Hour))).Build()
+		r := &HyperOpsReconciler{Client: c, MaxCredentialAge: 7 * 24 * time.Hour, QuarantineStaleCredentials: true}
+		Expect(r.enforceMaxCredentialAge(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+
+		Expect(condition().Reason).To(Equal("Quarantined"))
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), key, &corev1.Secret{}))).To(BeTrue())
+		kind, ok := quarantinedCredential(hc, credentialFingerprints(cluster("stale")))
+		Expect(ok).To(BeTrue())
+		Expect(kind).To(Equal(credentialToken))
+		_, ok = quarantinedCredential(hc, credentialFingerprints(cluster("renewed")))
+		Expect(ok).To(BeFalse())
+
+		Expect(r.releaseCredentialQuarantine(context.Background(), hc)).To(Succeed())
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(updated.Annotations).NotTo(HaveKey(hyperOpsQuarantinedCredentialsAnnotation))
+	})
+})
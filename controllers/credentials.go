@@ -0,0 +1,113 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// hyperOpsClientCertificateSecretAnnotation references a kubernetes.io/tls secret in the HostedCluster namespace
+	// holding the client certificate presented to an mTLS frontend in front of the hosted API server
+	hyperOpsClientCertificateSecretAnnotation = "hyper-ops.cloudmonkey.org/client-certificate-secret"
+
+	credentialToken             = "token"
+	credentialClientCertificate = "client-certificate"
+)
+
+// applyClientCertificate adds the client certificate referenced by the HostedCluster to the cluster config
+func (r *HyperOpsReconciler) applyClientCertificate(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	name, ok := hc.GetAnnotations()[hyperOpsClientCertificateSecretAnnotation]
+	if !ok || name == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: name}, secret); err != nil {
+		return fmt.Errorf("unable to fetch client certificate secret %s: %w", name, err)
+	}
+	if len(secret.Data[corev1.TLSCertKey]) == 0 || len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		return fmt.Errorf("client certificate secret %s must contain %s and %s", name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	cluster.Config.TLSClientConfig.CertData = secret.Data[corev1.TLSCertKey]
+	cluster.Config.TLSClientConfig.KeyData = secret.Data[corev1.TLSPrivateKeyKey]
+	return nil
+}
+
+// hostedClustersForClientCertificate maps a client certificate secret to the HostedClusters referencing it
+func (r *HyperOpsReconciler) hostedClustersForClientCertificate(obj client.Object) []reconcile.Request {
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := r.List(context.Background(), hcs, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range hcs.Items {
+		if hcs.Items[i].GetAnnotations()[hyperOpsClientCertificateSecretAnnotation] == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hcs.Items[i])})
+		}
+	}
+	return requests
+}
+
+// credentialFingerprints returns a fingerprint of every credential in the cluster config, keyed by credential kind
+func credentialFingerprints(cluster *Cluster) map[string]string {
+	fingerprints := map[string]string{}
+	if cluster.Config.BearerToken != "" {
+		fingerprints[credentialToken] = fingerprint([]byte(cluster.Config.BearerToken))
+	}
+	if len(cluster.Config.TLSClientConfig.CertData) > 0 {
+		fingerprints[credentialClientCertificate] = fingerprint(cluster.Config.TLSClientConfig.CertData, cluster.Config.TLSClientConfig.KeyData)
+	}
+	return fingerprints
+}
+
+// trackCredentialRotation records the fingerprint and the time of the last rotation of every credential on the
+// ArgoCD cluster secret, so rotations of the bearer token and the client certificate can be followed independently
+func trackCredentialRotation(secret *corev1.Secret, fingerprints map[string]string, now time.Time) {
+	for _, kind := range []string{credentialToken, credentialClientCertificate} {
+		fingerprintKey := fmt.Sprintf("%s/%s-fingerprint", hyperOpsLabel, kind)
+		rotatedKey := fmt.Sprintf("%s/%s-rotated-at", hyperOpsLabel, kind)
+		fp, ok := fingerprints[kind]
+		if !ok {
+			delete(secret.Annotations, fingerprintKey)
+			delete(secret.Annotations, rotatedKey)
+			continue
+		}
+		if secret.Annotations[fingerprintKey] != fp {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, fingerprintKey, fp)
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, rotatedKey, now.UTC().Format(time.RFC3339))
+		}
+	}
+}
+
+// fingerprint returns a short, non reversible identifier of a credential
+func fingerprint(data ...[]byte) string {
+	h := sha256.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Credentials", func() {
+	It("Should add the referenced client certificate to the cluster config", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsClientCertificateSecretAnnotation: "frontend-cert"},
+			},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "frontend-cert", Namespace: "clusters"},
+			Type:       corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte("cert"),
+				corev1.TLSPrivateKeyKey: []byte("key"),
+			},
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()}
+		cluster := &Cluster{Cluster: argocd.Cluster{Config: argocd.ClusterConfig{BearerToken: "token"}}}
+		Expect(r.applyClientCertificate(context.Background(), hc, cluster)).To(Succeed())
+		Expect(cluster.Config.TLSClientConfig.CertData).To(Equal([]byte("cert")))
+		Expect(cluster.Config.TLSClientConfig.KeyData).To(Equal([]byte("key")))
+		Expect(cluster.Config.BearerToken).To(Equal("token"))
+
+		requests := r.hostedClustersForClientCertificate(secret)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("hosted"))
+	})
+
+	It("Should track the rotation of each credential independently", func() {
+		secret := &corev1.Secret{}
+		cluster := &Cluster{Cluster: argocd.Cluster{Config: argocd.ClusterConfig{
+			BearerToken:     "token",
+			TLSClientConfig: argocd.TLSClientConfig{CertData: []byte("cert"), KeyData: []byte("key")},
+		}}}
+		first := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		trackCredentialRotation(secret, credentialFingerprints(cluster), first)
+		Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/token-rotated-at", "2023-01-01T00:00:00Z"))
+		Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/client-certificate-rotated-at", "2023-01-01T00:00:00Z"))
+		Expect(secret.Annotations["hyper-ops.cloudmonkey.org/token-fingerprint"]).NotTo(ContainSubstring("token"))
+
+		cluster.Config.BearerToken = "rotated"
+		trackCredentialRotation(secret, credentialFingerprints(cluster), first.Add(time.Hour))
+		Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/token-rotated-at", "2023-01-01T01:00:00Z"))
+		Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/client-certificate-rotated-at", "2023-01-01T00:00:00Z"))
+
+		cluster.Config.TLSClientConfig = argocd.TLSClientConfig{}
+		trackCredentialRotation(secret, credentialFingerprints(cluster), first.Add(2*time.Hour))
+		Expect(secret.Annotations).NotTo(HaveKey("hyper-ops.cloudmonkey.org/client-certificate-rotated-at"))
+	})
+})
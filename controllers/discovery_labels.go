@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DiscoveryLabelsAllNamespaces selects every gitops namespace in the discovery labels
+const DiscoveryLabelsAllNamespaces = "*"
+
+// ParseDiscoveryLabels parses a comma separated list of <namespace>/<key>=<value> discovery labels. The namespace is
+// a gitops namespace or DiscoveryLabelsAllNamespaces, the key may contain a prefix, e.g.
+// gitops-fork/fork.example.com/cluster=true.
+func ParseDiscoveryLabels(raw string) (map[string]map[string]string, error) {
+	labels := map[string]map[string]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		namespace, label, ok := strings.Cut(entry, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid discovery label %q, must be <namespace>/<key>=<value>", entry)
+		}
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid discovery label %q, must be <namespace>/<key>=<value>", entry)
+		}
+		if labels[namespace] == nil {
+			labels[namespace] = map[string]string{}
+		}
+		labels[namespace][key] = value
+	}
+	return labels, ValidateDiscoveryLabels(labels)
+}
+
+// ValidateDiscoveryLabels returns an error if a discovery label is not a valid label or would override a label
+// managed by hyper-ops
+func ValidateDiscoveryLabels(labels map[string]map[string]string) error {
+	for namespace, nsLabels := range labels {
+		if namespace != DiscoveryLabelsAllNamespaces {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return fmt.Errorf("invalid discovery label namespace %q: %s", namespace, strings.Join(errs, ", "))
+			}
+		}
+		for key, value := range nsLabels {
+			if err := validateAddedLabel(key, value); err != nil {
+				return fmt.Errorf("invalid discovery label: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAddedLabel checks a label added to the ArgoCD cluster secrets by configuration, labels managed by hyper-ops
+// can't be overridden
+func validateAddedLabel(key, value string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, ", "))
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return fmt.Errorf("invalid label value %q: %s", value, strings.Join(errs, ", "))
+	}
+	if key == argoCDSecretTypeLabel || key == managedByLabel || strings.HasPrefix(key, hyperOpsLabel+"/") {
+		return fmt.Errorf("label %q is managed by hyper-ops", key)
+	}
+	return nil
+}
+
+// discoveryLabels returns the discovery labels of the gitops namespace, the labels of the namespace take precedence
+// over the labels of all namespaces
+func (r *HyperOpsReconciler) discoveryLabels(namespace string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range r.DiscoveryLabels[DiscoveryLabelsAllNamespaces] {
+		labels[k] = v
+	}
+	for k, v := range r.DiscoveryLabels[namespace] {
+		labels[k] = v
+	}
+	return labels
+}
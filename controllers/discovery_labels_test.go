@@ -0,0 +1,74 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Discovery labels", func() {
+
+	It("Should parse the discovery labels by namespace", func() {
+		labels, err := ParseDiscoveryLabels("*/example.com/fleet=prod, openshift-gitops/fork.example.com/cluster=true")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]map[string]string{
+			"*":                {"example.com/fleet": "prod"},
+			"openshift-gitops": {"fork.example.com/cluster": "true"},
+		}))
+
+		_, err = ParseDiscoveryLabels("openshift-gitops/cluster")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseDiscoveryLabels("openshift-gitops/argocd.argoproj.io/secret-type=other")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseDiscoveryLabels("Not_A_Namespace/cluster=true")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should add the discovery labels of the gitops namespace to the ArgoCD cluster secret", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, DiscoveryLabels: map[string]map[string]string{
+			"*":                {"example.com/fleet": "prod", "fork.example.com/cluster": "false"},
+			"openshift-gitops": {"fork.example.com/cluster": "true"},
+			"other":            {"other.example.com/cluster": "true"},
+		}}
+		cluster := &Cluster{
+			Cluster:         argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"},
+			HostedCluster:   &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}},
+			GitOpsNamespace: defaultGitOpsNamespace,
+		}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{}, cluster)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue("argocd.argoproj.io/secret-type", "cluster"))
+		Expect(secret.Labels).To(HaveKeyWithValue("example.com/fleet", "prod"))
+		Expect(secret.Labels).To(HaveKeyWithValue("fork.example.com/cluster", "true"))
+		Expect(secret.Labels).NotTo(HaveKey("other.example.com/cluster"))
+	})
+})
@@ -0,0 +1,227 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	dryRunReportConfigMapName = "hyper-ops-dry-run-report"
+	dryRunReportDataKey       = "report.json"
+
+	// DryRunOperationCreate is reported for ArgoCD cluster secrets that would be created
+	DryRunOperationCreate = "create"
+	// DryRunOperationUpdate is reported for ArgoCD cluster secrets that would be updated
+	DryRunOperationUpdate = "update"
+	// DryRunOperationDelete is reported for ArgoCD cluster secrets that would be deleted
+	DryRunOperationDelete = "delete"
+	// DryRunOperationRelease is reported for ArgoCD cluster secrets that would be released from management
+	DryRunOperationRelease = "release"
+	// DryRunOperationApply is reported for ArgoCD cluster secrets that would be sent to the registration proxy or the
+	// remote hub, the remote secret isn't compared
+	DryRunOperationApply = "apply"
+)
+
+// DryRunReport aggregates the changes hyper-ops would make to the ArgoCD cluster secrets of the fleet
+type DryRunReport struct {
+	GeneratedAt metav1.Time `json:"generatedAt"`
+	// Summary counts the changes by operation
+	Summary map[string]int `json:"summary"`
+	Changes []DryRunChange `json:"changes"`
+}
+
+// DryRunChange is a single change hyper-ops would make. Fields only names the changed data keys, labels and
+// annotations, credentials never end up in the report.
+type DryRunChange struct {
+	Secret        string      `json:"secret"`
+	HostedCluster string      `json:"hostedCluster,omitempty"`
+	Operation     string      `json:"operation"`
+	Fields        []string    `json:"fields,omitempty"`
+	ObservedAt    metav1.Time `json:"observedAt"`
+}
+
+// dryRunRecorder keeps the latest pending change of every ArgoCD cluster secret
+type dryRunRecorder struct {
+	mu      sync.Mutex
+	changes map[string]DryRunChange
+}
+
+func (d *dryRunRecorder) record(change DryRunChange) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.changes == nil {
+		d.changes = map[string]DryRunChange{}
+	}
+	if existing, ok := d.changes[change.Secret]; ok && existing.Operation == change.Operation &&
+		fmt.Sprint(existing.Fields) == fmt.Sprint(change.Fields) {
+		return
+	}
+	change.ObservedAt = metav1.Now()
+	d.changes[change.Secret] = change
+}
+
+func (d *dryRunRecorder) forget(secret string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.changes, secret)
+}
+
+func (d *dryRunRecorder) report() *DryRunReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	report := &DryRunReport{
+		GeneratedAt: metav1.Now(),
+		Summary:     map[string]int{},
+		Changes:     []DryRunChange{},
+	}
+	for _, change := range d.changes {
+		report.Summary[change.Operation]++
+		report.Changes = append(report.Changes, change)
+	}
+	sort.Slice(report.Changes, func(i, j int) bool {
+		return report.Changes[i].Secret < report.Changes[j].Secret
+	})
+	return report
+}
+
+// DryRunReport returns the changes the reconciler would have made since it started in dry-run mode
+func (r *HyperOpsReconciler) DryRunReport() *DryRunReport {
+	return r.dryRun.report()
+}
+
+// recordArgoCDClusterSecretChange records the difference between the ArgoCD cluster secret and the desired secret
+func (r *HyperOpsReconciler) recordArgoCDClusterSecretChange(ctx context.Context, desired *corev1.Secret, hostedCluster string) error {
+	key := client.ObjectKeyFromObject(desired).String()
+	if r.remoteRegistrations() != nil {
+		r.dryRun.record(DryRunChange{Secret: key, HostedCluster: hostedCluster, Operation: DryRunOperationApply})
+		return nil
+	}
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.dryRun.record(DryRunChange{Secret: key, HostedCluster: hostedCluster, Operation: DryRunOperationCreate})
+		return nil
+	}
+	fields := []string{}
+	for k, v := range desired.Data {
+		if string(existing.Data[k]) != string(v) {
+			fields = append(fields, "data."+k)
+		}
+	}
+	for k := range existing.Data {
+		if _, ok := desired.Data[k]; !ok {
+			fields = append(fields, "data."+k)
+		}
+	}
+	for k, v := range desired.Labels {
+		if existing.Labels[k] != v {
+			fields = append(fields, "labels."+k)
+		}
+	}
+	for k := range existing.Labels {
+		if _, ok := desired.Labels[k]; !ok {
+			fields = append(fields, "labels."+k)
+		}
+	}
+	for k, v := range desired.Annotations {
+		if existing.Annotations[k] != v {
+			fields = append(fields, "annotations."+k)
+		}
+	}
+	if len(fields) == 0 {
+		r.dryRun.forget(key)
+		return nil
+	}
+	sort.Strings(fields)
+	r.dryRun.record(DryRunChange{Secret: key, HostedCluster: hostedCluster, Operation: DryRunOperationUpdate, Fields: fields})
+	return nil
+}
+
+// recordArgoCDClusterSecretRemoval records that the ArgoCD cluster secret would be deleted or released
+func (r *HyperOpsReconciler) recordArgoCDClusterSecretRemoval(ctx context.Context, key client.ObjectKey, operation string) error {
+	if r.remoteRegistrations() == nil {
+		if err := r.Get(ctx, key, &corev1.Secret{}); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			r.dryRun.forget(key.String())
+			return nil
+		}
+	}
+	r.dryRun.record(DryRunChange{Secret: key.String(), Operation: operation})
+	return nil
+}
+
+// DryRunReporter periodically writes the DryRunReport of the reconciler into a ConfigMap, so fleet wide changes can
+// be reviewed from a single object
+type DryRunReporter struct {
+	Client     client.Client
+	Namespace  string
+	Interval   time.Duration
+	Reconciler *HyperOpsReconciler
+}
+
+// Start runs the reporter until the context is cancelled, it implements manager.Runnable
+func (d *DryRunReporter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("dry-run-report")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := d.writeReport(ctx); err != nil {
+			log.Error(err, "unable to write dry-run report")
+		}
+	}, d.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader, which is the only one reconciling, writes the report
+func (d *DryRunReporter) NeedLeaderElection() bool {
+	return true
+}
+
+func (d *DryRunReporter) writeReport(ctx context.Context) error {
+	data, err := json.MarshalIndent(d.Reconciler.DryRunReport(), "", "  ")
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dryRunReportConfigMapName,
+			Namespace: d.Namespace,
+		},
+	}
+	_, err = CreateOrUpdateWithRetries(ctx, d.Client, cm, func() error {
+		stampManaged(cm, "")
+		cm.Data = map[string]string{
+			dryRunReportDataKey: string(data),
+		}
+		return nil
+	})
+	return err
+}
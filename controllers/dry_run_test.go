@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Dry-run", func() {
+
+	It("Should report changes instead of writing the ArgoCD cluster secrets", func() {
+		existing := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "existing",
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+			},
+			Data: map[string][]byte{"name": []byte("existing"), "server": []byte("https://old:6443")},
+		}
+		stale := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: defaultGitOpsNamespace},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(existing, stale).Build()
+		r := &HyperOpsReconciler{Client: c, DryRun: true}
+
+		created := &Cluster{Cluster: argocd.Cluster{Name: "new", Server: "https://new:6443"}, GitOpsNamespace: defaultGitOpsNamespace}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{}, created)).To(Succeed())
+		updated := &Cluster{Cluster: argocd.Cluster{Name: "existing", Server: "https://existing:6443"}, GitOpsNamespace: defaultGitOpsNamespace}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{}, updated)).To(Succeed())
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), stale)).To(Succeed())
+
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "new"}, &corev1.Secret{})).NotTo(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(stale), &corev1.Secret{})).To(Succeed())
+
+		report := r.DryRunReport()
+		Expect(report.Summary).To(Equal(map[string]int{
+			DryRunOperationCreate: 1,
+			DryRunOperationUpdate: 1,
+			DryRunOperationDelete: 1,
+		}))
+		Expect(report.Changes).To(HaveLen(3))
+		Expect(report.Changes[0].Secret).To(Equal("openshift-gitops/existing"))
+		Expect(report.Changes[0].Fields).To(ContainElements("data.config", "data.server"))
+	})
+
+	It("Should drop changes that no longer apply", func() {
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), DryRun: true}
+		r.dryRun.record(DryRunChange{Secret: "openshift-gitops/gone", Operation: DryRunOperationDelete})
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "gone", Namespace: defaultGitOpsNamespace},
+		})).To(Succeed())
+		Expect(r.DryRunReport().Changes).To(BeEmpty())
+	})
+})
@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DuplicateServerWinnerOldest keeps the registration of the oldest HostedCluster for a server URL
+	DuplicateServerWinnerOldest = "oldest"
+	// DuplicateServerWinnerNewest keeps the registration of the newest HostedCluster for a server URL
+	DuplicateServerWinnerNewest = "newest"
+)
+
+// resolveDuplicateServer finds the other registrations using the same server URL as the HostedCluster and returns
+// the HostedCluster that should keep the server according to the duplicate server policy. If hc wins, the ArgoCD
+// cluster secrets of the losing registrations are returned as well.
+func (r *HyperOpsReconciler) resolveDuplicateServer(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, server string) (*hypershiftv1beta1.HostedCluster, []corev1.Secret, error) {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return nil, nil, err
+	}
+	self := client.ObjectKeyFromObject(hc).String()
+	winner := hc
+	duplicates := []corev1.Secret{}
+	for _, secret := range secrets.Items {
+		ref, ok := secret.Annotations[hyperOpsHostedClusterAnnotation]
+		if !ok || ref == self || normalizeServer(string(secret.Data["server"])) != normalizeServer(server) {
+			continue
+		}
+		namespace, name, _ := strings.Cut(ref, "/")
+		other := &hypershiftv1beta1.HostedCluster{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, other); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, nil, err
+			}
+			// the secret of a deleted HostedCluster does not compete for the server
+			continue
+		}
+		duplicates = append(duplicates, secret)
+		if r.preferForServer(other, winner) {
+			winner = other
+		}
+	}
+	if winner != hc {
+		return winner, nil, nil
+	}
+	return hc, duplicates, nil
+}
+
+// preferForServer returns true if a should win the server URL over b
+func (r *HyperOpsReconciler) preferForServer(a, b *hypershiftv1beta1.HostedCluster) bool {
+	if a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return client.ObjectKeyFromObject(a).String() < client.ObjectKeyFromObject(b).String()
+	}
+	if r.DuplicateServerWinner == DuplicateServerWinnerNewest {
+		return b.CreationTimestamp.Before(&a.CreationTimestamp)
+	}
+	return a.CreationTimestamp.Before(&b.CreationTimestamp)
+}
+
+func normalizeServer(server string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(server)), "/")
+}
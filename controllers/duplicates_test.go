@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Duplicate servers", func() {
+	var (
+		older  *hypershiftv1beta1.HostedCluster
+		newer  *hypershiftv1beta1.HostedCluster
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		older = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "older",
+				Namespace:         "clusters",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+		}
+		newer = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "newer",
+				Namespace:         "clusters",
+				CreationTimestamp: metav1.NewTime(time.Now()),
+			},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "older",
+				Namespace:   "openshift-gitops",
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/older"},
+			},
+			Data: map[string][]byte{"server": []byte("https://api.example.com:6443/")},
+		}
+	})
+
+	It("Should keep the server on the oldest HostedCluster by default", func() {
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(older, newer, secret).Build()}
+		winner, duplicates, err := r.resolveDuplicateServer(context.Background(), newer, "https://API.example.com:6443")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(winner.Name).To(Equal("older"))
+		Expect(duplicates).To(BeEmpty())
+	})
+
+	It("Should hand the server to the newest HostedCluster when configured", func() {
+		r := &HyperOpsReconciler{
+			Client:                fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(older, newer, secret).Build(),
+			DuplicateServerWinner: DuplicateServerWinnerNewest,
+		}
+		winner, duplicates, err := r.resolveDuplicateServer(context.Background(), newer, "https://api.example.com:6443")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(winner.Name).To(Equal("newer"))
+		Expect(duplicates).To(HaveLen(1))
+		Expect(duplicates[0].Name).To(Equal("older"))
+	})
+
+	It("Should ignore secrets of deleted HostedClusters", func() {
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(newer, secret).Build()}
+		winner, duplicates, err := r.resolveDuplicateServer(context.Background(), newer, "https://api.example.com:6443")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(winner.Name).To(Equal("newer"))
+		Expect(duplicates).To(BeEmpty())
+	})
+})
@@ -0,0 +1,138 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// egressNetworkPolicyPrefix prefixes the NetworkPolicy allowing ArgoCD to reach the cluster of an ArgoCD
+	// cluster secret, the policy is named after the secret
+	egressNetworkPolicyPrefix = "hyper-ops-egress-"
+
+	// kubeAPIServerPort is the port the kube-apiserver pods of a hosted control plane listen on
+	kubeAPIServerPort = 6443
+)
+
+// egressNetworkPolicyName returns the name of the NetworkPolicy of the ArgoCD cluster secret
+func egressNetworkPolicyName(secretName string) string {
+	return egressNetworkPolicyPrefix + secretName
+}
+
+// egressNetworkPolicySpec allows the ArgoCD pods to reach the kube-apiserver of the hosted control plane and, when
+// the server is an IP address, the server itself
+func egressNetworkPolicySpec(hc *hypershiftv1beta1.HostedCluster, server string) (networkingv1.NetworkPolicySpec, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return networkingv1.NetworkPolicySpec{}, fmt.Errorf("invalid server %q: %w", server, err)
+	}
+	port := 443
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return networkingv1.NetworkPolicySpec{}, fmt.Errorf("invalid port of server %q: %w", server, err)
+		}
+	}
+	tcp := corev1.ProtocolTCP
+	ports := func(numbers ...int) []networkingv1.NetworkPolicyPort {
+		policyPorts := []networkingv1.NetworkPolicyPort{}
+		for _, n := range numbers {
+			p := intstr.FromInt(n)
+			policyPorts = append(policyPorts, networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &p})
+		}
+		return policyPorts
+	}
+	controlPlanePorts := ports(kubeAPIServerPort)
+	if port != kubeAPIServerPort {
+		controlPlanePorts = ports(kubeAPIServerPort, port)
+	}
+	egress := []networkingv1.NetworkPolicyEgressRule{{
+		To: []networkingv1.NetworkPolicyPeer{{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: hostedControlPlaneNamespace(hc)}},
+			PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "kube-apiserver"}},
+		}},
+		Ports: controlPlanePorts,
+	}}
+	// servers exposed through a load balancer IP are reached outside of the pod network
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		cidr := ip.String() + "/32"
+		if ip.To4() == nil {
+			cidr = ip.String() + "/128"
+		}
+		egress = append(egress, networkingv1.NetworkPolicyEgressRule{
+			To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}},
+			Ports: ports(port),
+		})
+	}
+	return networkingv1.NetworkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/part-of": "argocd"}},
+		PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		Egress:      egress,
+	}, nil
+}
+
+// reconcileEgressNetworkPolicy maintains the NetworkPolicy allowing the ArgoCD instance in the gitops namespace to
+// reach the hosted cluster of the ArgoCD cluster secret
+func (r *HyperOpsReconciler) reconcileEgressNetworkPolicy(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	if !r.EgressNetworkPolicies || r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	spec, err := egressNetworkPolicySpec(hc, cluster.Server)
+	if err != nil {
+		return err
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      egressNetworkPolicyName(cluster.Name),
+			Namespace: cluster.GitOpsNamespace,
+		},
+	}
+	_, err = CreateOrUpdateWithRetries(ctx, r.Client, policy, func() error {
+		policy.Labels = managedLabels(policy.Labels)
+		metav1.SetMetaDataAnnotation(&policy.ObjectMeta, hyperOpsHostedClusterAnnotation, client.ObjectKeyFromObject(hc).String())
+		policy.Spec = spec
+		return nil
+	})
+	return err
+}
+
+// removeEgressNetworkPolicy removes the NetworkPolicy of a deregistered ArgoCD cluster secret. Policies are removed
+// even when the feature was disabled since they were created.
+func (r *HyperOpsReconciler) removeEgressNetworkPolicy(ctx context.Context, secret client.ObjectKey) error {
+	if r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	policy := &networkingv1.NetworkPolicy{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: secret.Namespace, Name: egressNetworkPolicyName(secret.Name)}, policy); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if policy.Labels[managedByLabel] != managedByValue {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, policy))
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Egress network policies", func() {
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+
+	It("Should allow the kube-apiserver of the hosted control plane and IP servers", func() {
+		spec, err := egressNetworkPolicySpec(hc, "https://api.hosted.example.com:6443")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.PolicyTypes).To(Equal([]networkingv1.PolicyType{networkingv1.PolicyTypeEgress}))
+		Expect(spec.Egress).To(HaveLen(1))
+		Expect(spec.Egress[0].To[0].NamespaceSelector.MatchLabels).To(Equal(map[string]string{corev1.LabelMetadataName: "clusters-hosted"}))
+		Expect(spec.Egress[0].Ports).To(HaveLen(1))
+
+		spec, err = egressNetworkPolicySpec(hc, "https://10.0.0.10")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec.Egress).To(HaveLen(2))
+		Expect(spec.Egress[0].Ports).To(HaveLen(2))
+		Expect(spec.Egress[1].To[0].IPBlock.CIDR).To(Equal("10.0.0.10/32"))
+		Expect(spec.Egress[1].Ports[0].Port.IntValue()).To(Equal(443))
+	})
+
+	It("Should create the policy with the registration and remove it on deregistration", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, EgressNetworkPolicies: true}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted.example.com:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)).To(Succeed())
+		Expect(r.reconcileEgressNetworkPolicy(context.Background(), hc, cluster)).To(Succeed())
+
+		policy := &networkingv1.NetworkPolicy{}
+		key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hyper-ops-egress-hosted"}
+		Expect(c.Get(context.Background(), key, policy)).To(Succeed())
+		Expect(policy.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(policy.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace},
+		})).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), key, policy))).To(BeTrue())
+	})
+
+	It("Should not create policies when disabled or keep policies of others", func() {
+		other := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-egress-hosted", Namespace: defaultGitOpsNamespace}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(other).Build()
+		r := &HyperOpsReconciler{Client: c}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "other", Server: "https://api.other.example.com:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+		Expect(r.reconcileEgressNetworkPolicy(context.Background(), hc, cluster)).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hyper-ops-egress-other"}, &networkingv1.NetworkPolicy{}))).To(BeTrue())
+
+		Expect(r.removeEgressNetworkPolicy(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"})).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(other), &networkingv1.NetworkPolicy{})).To(Succeed())
+	})
+})
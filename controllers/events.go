@@ -0,0 +1,75 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+)
+
+const (
+	// EventRegistered is emitted when the HostedCluster becomes registered
+	EventRegistered = "Registered"
+	// EventKubeconfigMissing is emitted when the admin kubeconfig of the HostedCluster does not exist yet
+	EventKubeconfigMissing = "KubeconfigMissing"
+	// EventResolveConfigFailed is emitted when the admin kubeconfig of the HostedCluster can not be used
+	EventResolveConfigFailed = "ResolveConfigFailed"
+	// EventHostedRBACFailed is emitted when the service accounts in the hosted cluster can not be maintained
+	EventHostedRBACFailed = "HostedRBACFailed"
+	// EventTokenIssueFailed is emitted when no credential can be issued for the hosted cluster
+	EventTokenIssueFailed = "TokenIssueFailed"
+	// EventRenderFailed is emitted when the ArgoCD cluster secret can not be rendered
+	EventRenderFailed = "RenderFailed"
+	// EventRegistrationWriteFailed is emitted when the ArgoCD cluster secret or its outputs can not be written
+	EventRegistrationWriteFailed = "RegistrationWriteFailed"
+	// EventVerificationFailed is emitted when the written registration can not be verified
+	EventVerificationFailed = "VerificationFailed"
+	// EventRegistrationSkipped is emitted when the registration is skipped for a HostedCluster in a terminal state
+	EventRegistrationSkipped = "RegistrationSkipped"
+	// EventDeregistered is emitted when the registration of the HostedCluster is removed
+	EventDeregistered = "Deregistered"
+)
+
+// phaseFailureEvents are the event reasons of the failed registration phases
+var phaseFailureEvents = map[string]string{
+	PhaseResolveConfig:    EventResolveConfigFailed,
+	PhaseEnsureHostedRBAC: EventHostedRBACFailed,
+	PhaseObtainCredential: EventTokenIssueFailed,
+	PhaseRenderSecret:     EventRenderFailed,
+	PhaseWriteOutputs:     EventRegistrationWriteFailed,
+	PhaseVerify:           EventVerificationFailed,
+}
+
+// phaseFailureEvent returns the event reason of a failed registration phase
+func phaseFailureEvent(phase string) string {
+	if reason, ok := phaseFailureEvents[phase]; ok {
+		return reason
+	}
+	return phase + "Failed"
+}
+
+// conditionChanged returns true if the registration condition of the HostedCluster differs from the condition in
+// status, reason or message. Events are only emitted on changes, a reconcile repeating the same outcome stays quiet.
+func conditionChanged(hc *hypershiftv1beta1.HostedCluster, condition metav1.Condition) bool {
+	existing := meta.FindStatusCondition(registrationConditions(hc), condition.Type)
+	// the recorded messages are scrubbed
+	return existing == nil || existing.Status != condition.Status || existing.Reason != condition.Reason ||
+		existing.Message != redact.String(condition.Message)
+}
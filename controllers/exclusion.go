@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hyperOpsExcludedLabel marks a HostedCluster, and the ArgoCD cluster secrets of its registration, as excluded,
+	// so ApplicationSet selectors can stop targeting the cluster, e.g. during an incident, without deregistering it
+	hyperOpsExcludedLabel = "hyper-ops.cloudmonkey.org/excluded"
+	// hyperOpsExcludedReasonAnnotation records why the HostedCluster is excluded
+	hyperOpsExcludedReasonAnnotation = "hyper-ops.cloudmonkey.org/excluded-reason"
+)
+
+// excludedLabels returns the excluded label of the HostedCluster. It is applied regardless of the disabled built-in
+// labels, an exclusion must reach the cluster secrets.
+func excludedLabels(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	if value, ok := hostedClusterLabel(hc, hyperOpsExcludedLabel); ok {
+		return map[string]string{hyperOpsExcludedLabel: value}
+	}
+	return nil
+}
+
+// SetClusterExclusion excludes the HostedClusters from ApplicationSets, or includes them again. The HostedClusters
+// are labeled, so every later registration keeps the label, and the ArgoCD cluster secrets written by hyper-ops for
+// them, including the copies in other gitops namespaces, are labeled right away rather than with the next refresh.
+func SetClusterExclusion(ctx context.Context, c client.Client, hcs []hypershiftv1beta1.HostedCluster, excluded bool, reason string) error {
+	selected := map[string]bool{}
+	for i := range hcs {
+		hc := &hcs[i]
+		selected[client.ObjectKeyFromObject(hc).String()] = true
+		patch := client.MergeFrom(hc.DeepCopy())
+		labels, annotations := hc.GetLabels(), hc.GetAnnotations()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		delete(annotations, hyperOpsExcludedReasonAnnotation)
+		if excluded {
+			setSchemaLabel(labels, hyperOpsExcludedLabel, "true")
+			if reason != "" {
+				annotations[hyperOpsExcludedReasonAnnotation] = reason
+			}
+		} else {
+			setSchemaLabel(labels, hyperOpsExcludedLabel, "")
+		}
+		hc.SetLabels(labels)
+		hc.SetAnnotations(annotations)
+		if err := c.Patch(ctx, hc, patch); err != nil {
+			return fmt.Errorf("unable to label HostedCluster %s: %w", client.ObjectKeyFromObject(hc), err)
+		}
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !hyperOpsManaged(secret) || !selected[secret.Annotations[hyperOpsHostedClusterAnnotation]] {
+			continue
+		}
+		patch := client.MergeFrom(secret.DeepCopy())
+		if excluded {
+			setSchemaLabel(secret.Labels, hyperOpsExcludedLabel, "true")
+		} else {
+			setSchemaLabel(secret.Labels, hyperOpsExcludedLabel, "")
+		}
+		if err := c.Patch(ctx, secret, patch); err != nil {
+			return fmt.Errorf("unable to label ArgoCD cluster secret %s: %w", client.ObjectKeyFromObject(secret), err)
+		}
+	}
+	return nil
+}
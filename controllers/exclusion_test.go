@@ -0,0 +1,97 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Cluster exclusion", func() {
+	hostedCluster := func(name string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"}}
+	}
+	clusterSecret := func(namespace, name, hostedCluster string, managed bool) *corev1.Secret {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+			Annotations: map[string]string{hyperOpsHostedClusterAnnotation: hostedCluster},
+		}}
+		if managed {
+			secret.Labels[hyperOpsTypeLabel] = "hosted"
+		}
+		return secret
+	}
+	excludedSecret := func(c client.Client, namespace, name string) bool {
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: namespace, Name: name}, secret)).To(Succeed())
+		_, ok := secret.Labels[hyperOpsExcludedLabel]
+		return ok
+	}
+
+	It("Should label the HostedClusters and their cluster secrets and remove the labels again", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			hostedCluster("incident"), hostedCluster("healthy"),
+			clusterSecret(defaultGitOpsNamespace, "incident", "clusters/incident", true),
+			clusterSecret("argocd-team-a", "incident", "clusters/incident", true),
+			clusterSecret(defaultGitOpsNamespace, "healthy", "clusters/healthy", true),
+			// secrets hyper-ops did not write are left alone
+			clusterSecret("argocd-team-b", "incident", "clusters/incident", false),
+		).Build()
+		hc := hostedCluster("incident")
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+
+		Expect(SetClusterExclusion(context.Background(), c, []hypershiftv1beta1.HostedCluster{*hc}, true, "INC-42")).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Labels).To(HaveKeyWithValue(hyperOpsExcludedLabel, "true"))
+		Expect(hc.Annotations).To(HaveKeyWithValue(hyperOpsExcludedReasonAnnotation, "INC-42"))
+		Expect(excludedSecret(c, defaultGitOpsNamespace, "incident")).To(BeTrue())
+		Expect(excludedSecret(c, "argocd-team-a", "incident")).To(BeTrue())
+		Expect(excludedSecret(c, defaultGitOpsNamespace, "healthy")).To(BeFalse())
+		Expect(excludedSecret(c, "argocd-team-b", "incident")).To(BeFalse())
+
+		report, err := GenerateFleetReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		for _, cluster := range report.Clusters {
+			Expect(cluster.Excluded).To(Equal(cluster.Name == "incident"))
+		}
+
+		Expect(SetClusterExclusion(context.Background(), c, []hypershiftv1beta1.HostedCluster{*hc}, false, "")).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Labels).NotTo(HaveKey(hyperOpsExcludedLabel))
+		Expect(hc.Annotations).NotTo(HaveKey(hyperOpsExcludedReasonAnnotation))
+		Expect(excludedSecret(c, defaultGitOpsNamespace, "incident")).To(BeFalse())
+		Expect(excludedSecret(c, "argocd-team-a", "incident")).To(BeFalse())
+	})
+
+	It("Should keep the excluded label on the cluster secret with every registration", func() {
+		hc := hostedCluster("incident")
+		hc.Labels = map[string]string{hyperOpsExcludedLabel: "true"}
+		// disabling the HostedCluster labels does not lift the exclusion
+		hc.Annotations = map[string]string{hyperOpsDisabledBuiltinLabelsAnnotation: BuiltinLabelsHostedCluster}
+		Expect(hostedClusterLabels(hc)).To(HaveKeyWithValue(hyperOpsExcludedLabel, "true"))
+	})
+})
@@ -0,0 +1,237 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+)
+
+// ExportOptions control the contents of an exported registration
+type ExportOptions struct {
+	// ShowSecrets keeps the credentials of the exported secrets, they are redacted by default
+	ShowSecrets bool
+}
+
+// ExportedRegistration is the bundle of the hub objects hyper-ops manages for a single HostedCluster
+type ExportedRegistration struct {
+	// HostedCluster is the key of the exported HostedCluster
+	HostedCluster client.ObjectKey
+	// Conditions are the registration conditions of the HostedCluster, e.g. whether the policies allowed it
+	Conditions []metav1.Condition
+	// Objects are the exported objects, without the fields set by the API server so they can be applied to another
+	// hub
+	Objects []*unstructured.Unstructured
+}
+
+// ExportRegistration collects the hub objects of the registration of the HostedCluster: the ClusterRegistration, the
+// ArgoCD cluster secret with its copies and the other secrets written for the cluster, the egress NetworkPolicy, the
+// AppProjects the cluster is a destination of, the Applications hyper-ops created for it and its tenant RBAC policy.
+// Kinds whose CRD is not installed are skipped.
+func ExportRegistration(ctx context.Context, c client.Client, hc *hypershiftv1beta1.HostedCluster, opts ExportOptions) (*ExportedRegistration, error) {
+	self := client.ObjectKeyFromObject(hc).String()
+	export := &ExportedRegistration{HostedCluster: client.ObjectKeyFromObject(hc), Conditions: registrationConditions(hc)}
+	add := func(obj client.Object) error {
+		u, err := exportObject(c.Scheme(), obj)
+		if err != nil {
+			return err
+		}
+		export.Objects = append(export.Objects, u)
+		return nil
+	}
+
+	cr := &unstructured.Unstructured{}
+	cr.SetGroupVersionKind(hyperopsv1alpha1.GroupVersion.WithKind("ClusterRegistration"))
+	if err := c.Get(ctx, client.ObjectKeyFromObject(hc), cr); err == nil {
+		if err := add(cr); err != nil {
+			return nil, err
+		}
+	} else if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return nil, err
+	}
+	sort.Slice(secrets.Items, func(i, j int) bool {
+		return client.ObjectKeyFromObject(&secrets.Items[i]).String() < client.ObjectKeyFromObject(&secrets.Items[j]).String()
+	})
+	var registration *corev1.Secret
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Annotations[hyperOpsHostedClusterAnnotation] != self {
+			continue
+		}
+		_, copied := secret.Annotations[hyperOpsCopyOfAnnotation]
+		if secret.Labels[argoCDSecretTypeLabel] == argoCDSecretTypeCluster && !copied {
+			registration = secret
+		}
+		if !opts.ShowSecrets {
+			secret = redactSecret(secret)
+		}
+		if err := add(secret); err != nil {
+			return nil, err
+		}
+	}
+	if registration == nil {
+		return nil, fmt.Errorf("HostedCluster %s is not registered", self)
+	}
+
+	policies := &networkingv1.NetworkPolicyList{}
+	if err := c.List(ctx, policies, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return nil, err
+	}
+	for i := range policies.Items {
+		if policies.Items[i].Annotations[hyperOpsHostedClusterAnnotation] == self {
+			if err := add(&policies.Items[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	projects := secretDestinationProjects(registration)
+	if p := string(registration.Data["project"]); p != "" {
+		projects = append(projects, p)
+	}
+	sort.Strings(projects)
+	for i, name := range projects {
+		if i > 0 && projects[i-1] == name {
+			continue
+		}
+		project := &unstructured.Unstructured{}
+		project.SetGroupVersionKind(appProjectGVK)
+		if err := c.Get(ctx, client.ObjectKey{Namespace: registration.Namespace, Name: name}, project); err == nil {
+			if err := add(project); err != nil {
+				return nil, err
+			}
+		} else if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return nil, err
+		}
+	}
+
+	apps := &unstructured.UnstructuredList{}
+	apps.SetGroupVersionKind(applicationGVK.GroupVersion().WithKind(applicationGVK.Kind + "List"))
+	if err := c.List(ctx, apps, client.MatchingLabels{managedByLabel: managedByValue}); err != nil && !meta.IsNoMatchError(err) {
+		return nil, err
+	}
+	for i := range apps.Items {
+		app := &apps.Items[i]
+		server, _, _ := unstructured.NestedString(app.Object, "spec", "destination", "server")
+		if app.GetAnnotations()[hyperOpsHostedClusterAnnotation] == self || (server != "" && server == string(registration.Data["server"])) {
+			if err := add(app); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: registration.Namespace, Name: argoCDRBACConfigMapName}, cm); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if policy, ok := cm.Data[tenantRBACPolicyKey(hc)]; ok {
+		// only the key of the HostedCluster, the rest of the ConfigMap belongs to its owner
+		fragment := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Namespace: cm.Namespace},
+			Data:       map[string]string{tenantRBACPolicyKey(hc): policy},
+		}
+		if err := add(fragment); err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// exportObject converts the object to unstructured and removes the fields set by the API server
+func exportObject(scheme *runtime.Scheme, obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	u.SetUID("")
+	u.SetResourceVersion("")
+	u.SetGeneration(0)
+	u.SetSelfLink("")
+	u.SetManagedFields(nil)
+	u.SetOwnerReferences(nil)
+	unstructured.RemoveNestedField(u.Object, "metadata", "creationTimestamp")
+	return u, nil
+}
+
+// redactSecret returns a copy of the secret without credentials. The config of ArgoCD cluster secrets keeps its
+// structure with the token, password and client key replaced, every value of other secrets is replaced.
+func redactSecret(secret *corev1.Secret) *corev1.Secret {
+	secret = secret.DeepCopy()
+	// the last applied configuration contains the data of the secret
+	if _, ok := secret.Annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		secret.Annotations[corev1.LastAppliedConfigAnnotation] = redact.Redacted
+	}
+	for k := range secret.Data {
+		switch {
+		case secret.Labels[argoCDSecretTypeLabel] != argoCDSecretTypeCluster:
+			secret.Data[k] = []byte(redact.Redacted)
+		case k == "config":
+			secret.Data[k] = redactClusterConfig(secret.Data[k])
+		}
+	}
+	return secret
+}
+
+// redactClusterConfig replaces the credentials of the config of an ArgoCD cluster secret
+func redactClusterConfig(raw []byte) []byte {
+	config := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return []byte(redact.Redacted)
+	}
+	for _, k := range []string{"bearerToken", "password"} {
+		if _, ok := config[k]; ok {
+			config[k] = redact.Redacted
+		}
+	}
+	if tls, ok := config["tlsClientConfig"].(map[string]interface{}); ok {
+		if _, ok := tls["keyData"]; ok {
+			tls["keyData"] = redact.Redacted
+		}
+	}
+	redacted, err := json.Marshal(config)
+	if err != nil {
+		return []byte(redact.Redacted)
+	}
+	return redacted
+}
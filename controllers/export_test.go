@@ -0,0 +1,154 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+)
+
+var _ = Describe("Registration export", func() {
+	const server = "https://api.hosted.example.com:6443"
+
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	owned := func(obj client.Object, owner string) client.Object {
+		obj.SetLabels(managedLabels(obj.GetLabels()))
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[hyperOpsHostedClusterAnnotation] = owner
+		obj.SetAnnotations(annotations)
+		return obj
+	}
+	registration := func(namespace, owner string) *corev1.Secret {
+		return owned(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   namespace,
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{hyperOpsDestinationProjectsAnnotation: "tenant-a"},
+			},
+			Data: map[string][]byte{
+				"server":  []byte(server),
+				"project": []byte("hosted"),
+				"config":  []byte(`{"bearerToken":"secret-token","tlsClientConfig":{"caData":"Y2E=","insecure":false}}`),
+			},
+		}, owner).(*corev1.Secret)
+	}
+	application := func(name, destination string) *unstructured.Unstructured {
+		app := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"destination": map[string]interface{}{"server": destination}},
+		}}
+		app.SetGroupVersionKind(applicationGVK)
+		app.SetName(name)
+		app.SetNamespace(defaultGitOpsNamespace)
+		app.SetLabels(managedLabels(nil))
+		return app
+	}
+	appProject := func(name string) *unstructured.Unstructured {
+		project := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+		project.SetGroupVersionKind(appProjectGVK)
+		project.SetName(name)
+		project.SetNamespace(defaultGitOpsNamespace)
+		return project
+	}
+	exported := func(export *ExportedRegistration) []string {
+		keys := []string{}
+		for _, obj := range export.Objects {
+			keys = append(keys, obj.GetKind()+" "+obj.GetNamespace()+"/"+obj.GetName())
+		}
+		return keys
+	}
+
+	It("Should export the hub objects of the registration", func() {
+		copied := registration("team-gitops", "clusters/hosted")
+		copied.Annotations[hyperOpsCopyOfAnnotation] = defaultGitOpsNamespace + "/hosted"
+		ciOutput := owned(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted-kubeconfig", Namespace: "ci", Labels: map[string]string{hyperOpsCIOutputLabel: CIOutputTekton}},
+			Data:       map[string][]byte{ciOutputKubeconfigKey: []byte("kubeconfig")},
+		}, "clusters/hosted")
+		egress := owned(&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: egressNetworkPolicyName("hosted"), Namespace: defaultGitOpsNamespace}}, "clusters/hosted")
+		bootstrap := owned(application("hosted-bootstrap", server), "clusters/hosted")
+		rbac := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: argoCDRBACConfigMapName, Namespace: defaultGitOpsNamespace},
+			Data:       map[string]string{"policy.csv": "g, admins, role:admin", tenantRBACPolicyKey(hc): "p, role:tenant, clusters, get, *, allow"},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			registration(defaultGitOpsNamespace, "clusters/hosted"), copied, ciOutput, egress, bootstrap, rbac,
+			application("platform-hosted", server), application("platform-other", "https://api.other.example.com:6443"),
+			appProject("hosted"), appProject("tenant-a"), appProject("tenant-b"),
+			registration("other-gitops", "clusters/other"),
+		).Build()
+
+		export, err := ExportRegistration(context.Background(), c, hc, ExportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(export.HostedCluster).To(Equal(client.ObjectKeyFromObject(hc)))
+		Expect(exported(export)).To(Equal([]string{
+			"Secret ci/hosted-kubeconfig",
+			"Secret openshift-gitops/hosted",
+			"Secret team-gitops/hosted",
+			"NetworkPolicy openshift-gitops/" + egressNetworkPolicyName("hosted"),
+			"AppProject openshift-gitops/hosted",
+			"AppProject openshift-gitops/tenant-a",
+			"Application openshift-gitops/hosted-bootstrap",
+			"Application openshift-gitops/platform-hosted",
+			"ConfigMap openshift-gitops/" + argoCDRBACConfigMapName,
+		}))
+
+		By("redacting the credentials and the fields set by the API server")
+		for _, obj := range export.Objects {
+			Expect(obj.GetResourceVersion()).To(BeEmpty())
+			Expect(obj.GetAPIVersion()).NotTo(BeEmpty())
+		}
+		secret := &corev1.Secret{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(export.Objects[1].Object, secret)).To(Succeed())
+		Expect(string(secret.Data["config"])).To(ContainSubstring(`"bearerToken":"` + redact.Redacted + `"`))
+		Expect(string(secret.Data["config"])).To(ContainSubstring(`"caData":"Y2E="`))
+		Expect(string(secret.Data["server"])).To(Equal(server))
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(export.Objects[0].Object, secret)).To(Succeed())
+		Expect(string(secret.Data[ciOutputKubeconfigKey])).To(Equal(redact.Redacted))
+		data, _, _ := unstructured.NestedStringMap(export.Objects[8].Object, "data")
+		Expect(data).To(Equal(map[string]string{tenantRBACPolicyKey(hc): "p, role:tenant, clusters, get, *, allow"}))
+
+		By("keeping the credentials when asked to")
+		export, err = ExportRegistration(context.Background(), c, hc, ExportOptions{ShowSecrets: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(export.Objects[1].Object, secret)).To(Succeed())
+		Expect(string(secret.Data["config"])).To(ContainSubstring("secret-token"))
+	})
+
+	It("Should fail for a HostedCluster that is not registered", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(registration("other-gitops", "clusters/other")).Build()
+		_, err := ExportRegistration(context.Background(), c, hc, ExportOptions{})
+		Expect(err).To(MatchError(ContainSubstring("not registered")))
+	})
+})
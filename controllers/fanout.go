@@ -0,0 +1,182 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsAdditionalGitOpsNamespacesAnnotation lists the comma separated gitops namespaces a HostedCluster is
+	// registered into besides its gitops namespace, e.g. to serve several ArgoCD instances
+	hyperOpsAdditionalGitOpsNamespacesAnnotation = "hyper-ops.cloudmonkey.org/additional-gitops-namespaces"
+	// hyperOpsCopyOfAnnotation marks an ArgoCD cluster secret in an additional gitops namespace with the secret in the
+	// gitops namespace it was copied from
+	hyperOpsCopyOfAnnotation = "hyper-ops.cloudmonkey.org/copy-of"
+
+	// ConditionGitOpsNamespaceCopiesReady is true when the registration was written to all additional gitops
+	// namespaces
+	ConditionGitOpsNamespaceCopiesReady = "GitOpsNamespaceCopiesReady"
+)
+
+// additionalGitOpsNamespaces returns the sorted additional gitops namespaces of the HostedCluster and the namespaces
+// of the other discovered ArgoCD instances it selects, without the gitops namespace itself
+func additionalGitOpsNamespaces(hc *hypershiftv1beta1.HostedCluster, primary string, discovered ...string) []string {
+	seen := map[string]bool{primary: true}
+	namespaces := []string{}
+	for _, ns := range append(strings.Split(hc.GetAnnotations()[hyperOpsAdditionalGitOpsNamespacesAnnotation], ","), discovered...) {
+		if ns = strings.TrimSpace(ns); ns != "" && !seen[ns] {
+			seen[ns] = true
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// isGitOpsNamespaceCopy returns true if the secret is a copy in one of the additional gitops namespaces of the
+// HostedCluster
+func isGitOpsNamespaceCopy(secret *corev1.Secret, hc *hypershiftv1beta1.HostedCluster, primary string, discovered ...string) bool {
+	if _, ok := secret.Annotations[hyperOpsCopyOfAnnotation]; !ok {
+		return false
+	}
+	for _, ns := range additionalGitOpsNamespaces(hc, primary, discovered...) {
+		if ns == secret.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGitOpsNamespaceCopies writes the registration, rendered once for the gitops namespace, to the additional
+// gitops namespaces and returns the namespaces written. Every namespace is written independently, the failed
+// namespaces are reported together and the copies in namespaces that are no longer listed are removed.
+func (r *HyperOpsReconciler) writeGitOpsNamespaceCopies(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, labels map[string]string, cluster *Cluster, data map[string][]byte) ([]string, error) {
+	gitOpsNamespace := cluster.GitOpsNamespace
+	_, discovered, err := discoveredGitOpsNamespaces(r.ArgoCDDiscovery, hc, gitOpsNamespace)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := additionalGitOpsNamespaces(hc, gitOpsNamespace, discovered...)
+	if r.remoteRegistrations() != nil {
+		if len(namespaces) > 0 {
+			log.FromContext(ctx).V(3).Info("additional gitops namespaces are not supported for a remote ArgoCD")
+		}
+		return nil, nil
+	}
+	keep := map[string]bool{}
+	written := []string{}
+	failed := []string{}
+	errs := []error{}
+	for _, ns := range namespaces {
+		keep[ns] = true
+		if !gitOpsNamespaceAllowed(ns, r.AllowedGitOpsNamespaces) {
+			failed = append(failed, fmt.Sprintf("%s: not an allowed gitops namespace", ns))
+			continue
+		}
+		if err := r.writeArgoCDClusterSecret(ctx, ns, labels, cluster, data); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", ns, err))
+			// a skipped conflict is reported, retrying won't resolve it
+			if err = ignoreSkippedConflict(err); err != nil {
+				errs = append(errs, fmt.Errorf("unable to write the copy in %s: %w", ns, err))
+			}
+			continue
+		}
+		written = append(written, ns)
+	}
+	if err := r.removeGitOpsNamespaceCopies(ctx, hc, keep); err != nil {
+		return written, err
+	}
+	if len(namespaces) == 0 && meta.FindStatusCondition(registrationConditions(hc), ConditionGitOpsNamespaceCopiesReady) == nil {
+		return written, utilerrors.NewAggregate(errs)
+	}
+	condition := metav1.Condition{
+		Type:    ConditionGitOpsNamespaceCopiesReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "CopiesWritten",
+		Message: fmt.Sprintf("registration written to %s", strings.Join(written, ", ")),
+	}
+	switch {
+	case len(failed) > 0:
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "CopiesFailed", strings.Join(failed, "; ")
+	case len(namespaces) == 0:
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "NotConfigured", "the HostedCluster has no additional gitops namespaces"
+	}
+	if err := r.setRegistrationCondition(ctx, hc, condition); err != nil {
+		errs = append(errs, err)
+	}
+	return written, utilerrors.NewAggregate(errs)
+}
+
+// removeGitOpsNamespaceCopies deregisters the copies of the HostedCluster outside of the kept namespaces, all of them
+// if keep is empty
+func (r *HyperOpsReconciler) removeGitOpsNamespaceCopies(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, keep map[string]bool) error {
+	if r.remoteRegistrations() != nil {
+		return nil
+	}
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return err
+	}
+	self := client.ObjectKeyFromObject(hc).String()
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if _, ok := secret.Annotations[hyperOpsCopyOfAnnotation]; !ok || secret.Annotations[hyperOpsHostedClusterAnnotation] != self || keep[secret.Namespace] {
+			continue
+		}
+		// copies pending deletion are already deregistered
+		if _, ok := secret.Annotations[hyperOpsDeleteAfterAnnotation]; ok {
+			continue
+		}
+		if err := r.deleteArgoCDClusterSecret(ctx, secret); client.IgnoreNotFound(err) != nil && !isInvariantViolation(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deregisterArgoCDClusterSecrets deletes the ArgoCD cluster secret of the HostedCluster in the gitops namespace and
+// its copies in the additional gitops namespaces, so no ArgoCD instance or CI system keeps a credential of a
+// registration that was withdrawn
+func (r *HyperOpsReconciler) deregisterArgoCDClusterSecrets(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if err := r.deleteArgoCDClusterSecret(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hc.Name,
+			Namespace: gitOpsNamespace,
+		},
+	}); client.IgnoreNotFound(err) != nil && !isInvariantViolation(err) {
+		return err
+	}
+	if err := r.removeCIOutputs(ctx, hc, nil); err != nil {
+		return err
+	}
+	if err := r.deregister(ctx, hc); err != nil {
+		return err
+	}
+	return r.removeGitOpsNamespaceCopies(ctx, hc, nil)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Additional gitops namespaces", func() {
+	var c client.Client
+	var hc *hypershiftv1beta1.HostedCluster
+	labels := map[string]string{hyperOpsTypeLabel: "hosted"}
+	cluster := func() *Cluster {
+		return &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+	}
+	copyIn := func(ns string) (*corev1.Secret, error) {
+		secret := &corev1.Secret{}
+		return secret, c.Get(context.Background(), client.ObjectKey{Namespace: ns, Name: "hosted"}, secret)
+	}
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:        "hosted",
+			Namespace:   "clusters",
+			Annotations: map[string]string{hyperOpsAdditionalGitOpsNamespacesAnnotation: "team-b, team-a,openshift-gitops,team-a"},
+		}}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+	})
+
+	It("Should list the additional namespaces without the gitops namespace", func() {
+		Expect(additionalGitOpsNamespaces(hc, defaultGitOpsNamespace)).To(Equal([]string{"team-a", "team-b"}))
+	})
+
+	It("Should write the rendered registration to every namespace and remove dropped copies", func() {
+		r := &HyperOpsReconciler{Client: c, DiscoveryLabels: map[string]map[string]string{"team-b": {"example.com/team": "b"}}}
+		data, err := cluster().SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.writeArgoCDClusterSecret(context.Background(), defaultGitOpsNamespace, labels, cluster(), data)).To(Succeed())
+		written, err := r.writeGitOpsNamespaceCopies(context.Background(), hc, labels, cluster(), data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal([]string{"team-a", "team-b"}))
+
+		primary, err := copyIn(defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(primary.Annotations).NotTo(HaveKey(hyperOpsCopyOfAnnotation))
+		for _, ns := range []string{"team-a", "team-b"} {
+			secret, err := copyIn(ns)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(Equal(primary.Data))
+			Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsCopyOfAnnotation, "openshift-gitops/hosted"))
+			Expect(isGitOpsNamespaceCopy(secret, hc, defaultGitOpsNamespace)).To(BeTrue())
+		}
+		secret, _ := copyIn("team-b")
+		Expect(secret.Labels).To(HaveKeyWithValue("example.com/team", "b"))
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(updated), ConditionGitOpsNamespaceCopiesReady)).To(BeTrue())
+
+		updated.Annotations[hyperOpsAdditionalGitOpsNamespacesAnnotation] = "team-a"
+		Expect(c.Update(context.Background(), updated)).To(Succeed())
+		written, err = r.writeGitOpsNamespaceCopies(context.Background(), updated, labels, cluster(), data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal([]string{"team-a"}))
+		_, err = copyIn("team-b")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = copyIn("team-a")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.removeGitOpsNamespaceCopies(context.Background(), updated, nil)).To(Succeed())
+		_, err = copyIn("team-a")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = copyIn(defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should report namespaces that are not allowed without blocking the others", func() {
+		r := &HyperOpsReconciler{Client: c, AllowedGitOpsNamespaces: []string{defaultGitOpsNamespace, "team-a"}}
+		data, err := cluster().SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		written, err := r.writeGitOpsNamespaceCopies(context.Background(), hc, labels, cluster(), data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(written).To(Equal([]string{"team-a"}))
+		_, err = copyIn("team-a")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = copyIn("team-b")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		condition := meta.FindStatusCondition(registrationConditions(updated), ConditionGitOpsNamespaceCopiesReady)
+		Expect(condition.Reason).To(Equal("CopiesFailed"))
+		Expect(condition.Message).To(ContainSubstring("team-b"))
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hyperOpsFeaturesAnnotation holds the features active for the registration of a HostedCluster as JSON
+const hyperOpsFeaturesAnnotation = "hyper-ops.cloudmonkey.org/features"
+
+// RegistrationFeatures lists the hyper-ops features active for a single registration, so mixed mode fleets can be
+// audited for configuration drift between clusters
+type RegistrationFeatures struct {
+	// DefaultEnrollment is true when the cluster is registered through the default enrollment rather than the
+	// enabled label
+	DefaultEnrollment bool `json:"defaultEnrollment"`
+	// RegistrationProxy is true when the cluster secret is written through the registration proxy
+	RegistrationProxy bool `json:"registrationProxy"`
+	// RemoteHub is true when the cluster secret is written to a remote hub running ArgoCD
+	RemoteHub bool `json:"remoteHub"`
+	// ClientCertificate is true when a client certificate for an mTLS frontend is added to the cluster config
+	ClientCertificate bool `json:"clientCertificate"`
+	// AuditHeaders is true when additional headers are added to the requests against the hosted cluster
+	AuditHeaders bool `json:"auditHeaders"`
+	// ConditionMirroring is true when the HostedCluster conditions are mirrored onto the cluster secret
+	ConditionMirroring bool `json:"conditionMirroring"`
+	// BoundServiceAccountToken is true when the registration uses TokenRequest issued tokens
+	BoundServiceAccountToken bool `json:"boundServiceAccountToken"`
+	// TopologyLabels is true when NodePool and node architecture labels are added to the cluster secret
+	TopologyLabels bool `json:"topologyLabels"`
+	// WorkersLabel is true when the label telling whether the cluster has worker nodes is added to the cluster secret
+	WorkersLabel bool `json:"workersLabel"`
+	// Impersonation is true when destination service accounts are created for ArgoCD impersonation
+	Impersonation bool `json:"impersonation"`
+	// TenantRBAC is true when an ArgoCD RBAC policy is maintained for the tenant groups of the cluster
+	TenantRBAC bool `json:"tenantRBAC"`
+	// EgressNetworkPolicy is true when a NetworkPolicy allows the ArgoCD pods to reach the cluster
+	EgressNetworkPolicy bool `json:"egressNetworkPolicy"`
+	// Registrars names the GitOps tools besides ArgoCD the cluster is registered with
+	Registrars []string `json:"registrars,omitempty"`
+}
+
+// registrationFeatures returns the features active for the registration of the HostedCluster
+func (r *HyperOpsReconciler) registrationFeatures(hc *hypershiftv1beta1.HostedCluster) RegistrationFeatures {
+	_, labeled := hostedClusterLabel(hc, hyperOpsEnabledLabel)
+	_, clientCertificate := hc.GetAnnotations()[hyperOpsClientCertificateSecretAnnotation]
+	targets, _ := impersonationTargets(hc)
+	var registrars []string
+	for _, registrar := range r.Registrars {
+		registrars = append(registrars, registrar.Name())
+	}
+	return RegistrationFeatures{
+		DefaultEnrollment:        !labeled && r.DefaultEnrollment == DefaultEnrollmentEnabled,
+		RegistrationProxy:        r.RegistrationProxy != nil,
+		RemoteHub:                r.RegistrationProxy == nil && r.RemoteHub != nil,
+		ClientCertificate:        clientCertificate,
+		AuditHeaders:             len(r.HostedClusterHeaders) > 0,
+		ConditionMirroring:       true,
+		BoundServiceAccountToken: r.BoundTokens,
+		TopologyLabels:           r.TopologyLabels,
+		WorkersLabel:             r.WorkersLabel,
+		Impersonation:            len(targets) > 0,
+		TenantRBAC:               r.TenantRBAC && len(tenantGroups(hc)) > 0,
+		EgressNetworkPolicy:      r.EgressNetworkPolicies && r.remoteRegistrations() == nil,
+		Registrars:               registrars,
+	}
+}
+
+// registrationFeaturesFromAnnotation returns the features recorded on the HostedCluster, nil if none are recorded
+func registrationFeaturesFromAnnotation(hc *hypershiftv1beta1.HostedCluster) *RegistrationFeatures {
+	raw, ok := hc.GetAnnotations()[hyperOpsFeaturesAnnotation]
+	if !ok {
+		return nil
+	}
+	features := &RegistrationFeatures{}
+	if err := json.Unmarshal([]byte(raw), features); err != nil {
+		return nil
+	}
+	return features
+}
+
+// setRegistrationFeatures records the features on the HostedCluster, the HostedCluster is only patched when the
+// features changed
+func (r *HyperOpsReconciler) setRegistrationFeatures(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, features RegistrationFeatures) error {
+	if r.readOnly() {
+		return nil
+	}
+	raw, err := json.Marshal(features)
+	if err != nil {
+		return err
+	}
+	if hc.GetAnnotations()[hyperOpsFeaturesAnnotation] == string(raw) {
+		return nil
+	}
+	patch := client.MergeFrom(hc.DeepCopy())
+	metav1.SetMetaDataAnnotation(&hc.ObjectMeta, hyperOpsFeaturesAnnotation, string(raw))
+	return r.Patch(ctx, hc, patch)
+}
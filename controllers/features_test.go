@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Registration features", func() {
+	It("Should record the active features on the HostedCluster", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsClientCertificateSecretAnnotation: "frontend-cert"},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{
+			Client:               c,
+			DefaultEnrollment:    DefaultEnrollmentEnabled,
+			HostedClusterHeaders: map[string]string{"X-Fleet": "prod"},
+		}
+
+		features := r.registrationFeatures(hc)
+		Expect(features).To(Equal(RegistrationFeatures{
+			DefaultEnrollment:  true,
+			ClientCertificate:  true,
+			AuditHeaders:       true,
+			ConditionMirroring: true,
+		}))
+		Expect(r.setRegistrationFeatures(context.Background(), hc, features)).To(Succeed())
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(registrationFeaturesFromAnnotation(updated)).To(Equal(&features))
+	})
+
+	It("Should not report features for unreconciled HostedClusters", func() {
+		hc := &hypershiftv1beta1.HostedCluster{}
+		Expect(registrationFeaturesFromAnnotation(hc)).To(BeNil())
+	})
+})
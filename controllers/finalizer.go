@@ -0,0 +1,49 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// hyperOpsFinalizer keeps an enrolled HostedCluster around until its ArgoCD cluster secret and the other artifacts of
+// its registration are removed
+const hyperOpsFinalizer = "hyper-ops.cloudmonkey.org/cleanup"
+
+// ensureFinalizer adds the cleanup finalizer to the HostedCluster before anything is registered for it
+func (r *HyperOpsReconciler) ensureFinalizer(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	if r.readOnly() || controllerutil.ContainsFinalizer(hc, hyperOpsFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(hc.DeepCopy())
+	controllerutil.AddFinalizer(hc, hyperOpsFinalizer)
+	return r.Patch(ctx, hc, patch)
+}
+
+// removeFinalizer releases the HostedCluster once its registration is cleaned up or handed over
+func (r *HyperOpsReconciler) removeFinalizer(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	if r.readOnly() || !controllerutil.ContainsFinalizer(hc, hyperOpsFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(hc.DeepCopy())
+	controllerutil.RemoveFinalizer(hc, hyperOpsFinalizer)
+	return client.IgnoreNotFound(r.Patch(ctx, hc, patch))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Cleanup finalizer", func() {
+	It("Should add the finalizer once and not in dry-run mode", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+
+		r := &HyperOpsReconciler{Client: c, DryRun: true}
+		Expect(r.ensureFinalizer(context.Background(), hc)).To(Succeed())
+		Expect(hc.Finalizers).To(BeEmpty())
+
+		r.DryRun = false
+		Expect(r.ensureFinalizer(context.Background(), hc)).To(Succeed())
+		Expect(r.ensureFinalizer(context.Background(), hc)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Finalizers).To(Equal([]string{hyperOpsFinalizer}))
+	})
+
+	It("Should remove the registration before releasing a deleted HostedCluster", func() {
+		now := metav1.Now()
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", DeletionTimestamp: &now, Finalizers: []string{hyperOpsFinalizer, "other"},
+		}}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "hosted",
+			Namespace: defaultGitOpsNamespace,
+			Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+		Expect(err).NotTo(HaveOccurred())
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Finalizers).To(Equal([]string{"other"}))
+
+		By("releasing a HostedCluster whose registration is already gone")
+		gone := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "gone", Namespace: "clusters", DeletionTimestamp: &now, Finalizers: []string{hyperOpsFinalizer, "other"},
+		}}
+		Expect(c.Create(context.Background(), gone)).To(Succeed())
+		_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(gone)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(gone), gone)).To(Succeed())
+		Expect(gone.Finalizers).To(Equal([]string{"other"}))
+	})
+})
@@ -0,0 +1,307 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+)
+
+const (
+	fleetReportConfigMapName = "hyper-ops-fleet-report"
+	fleetReportDataKey       = "report.json"
+
+	// ClusterStateRegistered is the state of HostedClusters with an ArgoCD cluster secret
+	ClusterStateRegistered = "Registered"
+	// ClusterStatePending is the state of enrolled HostedClusters that are not registered yet
+	ClusterStatePending = "Pending"
+	// ClusterStateFailed is the state of enrolled HostedClusters whose registration fails
+	ClusterStateFailed = "Failed"
+	// ClusterStateSkipped is the state of HostedClusters skipped by the terminal state policy
+	ClusterStateSkipped = "Skipped"
+	// ClusterStateDisabled is the state of HostedClusters explicitly labeled enabled=false
+	ClusterStateDisabled = "Disabled"
+	// ClusterStateNotEnrolled is the state of unlabeled HostedClusters while the default enrollment is disabled
+	ClusterStateNotEnrolled = "NotEnrolled"
+	// ClusterStateUnmanaged is the state of HostedClusters whose registration was handed over to manual management
+	ClusterStateUnmanaged = "Unmanaged"
+	// ClusterStateStandalone is the state of HostedClusters running their own ArgoCD instead of being registered
+	ClusterStateStandalone = "Standalone"
+)
+
+// failedRegistrationConditions are the registration conditions that signal a failing registration with the status
+// they have while failing
+var failedRegistrationConditions = map[string]metav1.ConditionStatus{
+	ConditionGitOpsNamespaceReady:     metav1.ConditionFalse,
+	ConditionDuplicateServer:          metav1.ConditionTrue,
+	ConditionBoundServiceAccountToken: metav1.ConditionFalse,
+	ConditionImpersonationReady:       metav1.ConditionFalse,
+}
+
+// FleetReport is a point in time snapshot of the hosted cluster fleet as seen by hyper-ops
+type FleetReport struct {
+	GeneratedAt metav1.Time          `json:"generatedAt"`
+	Summary     FleetReportSummary   `json:"summary"`
+	Clusters    []FleetReportCluster `json:"clusters"`
+}
+
+// FleetReportSummary holds the aggregated counters of a FleetReport
+type FleetReportSummary struct {
+	Total      int `json:"total"`
+	Enabled    int `json:"enabled"`
+	Registered int `json:"registered"`
+	Available  int `json:"available"`
+	Degraded   int `json:"degraded"`
+	// States is the number of HostedClusters in each cluster state
+	States map[string]int `json:"states"`
+	// BoundTokens is the number of registrations migrated to TokenRequest issued tokens
+	BoundTokens int `json:"boundTokens"`
+}
+
+// FleetReportCluster describes a single HostedCluster in a FleetReport
+type FleetReportCluster struct {
+	Name                   string `json:"name"`
+	Namespace              string `json:"namespace"`
+	Platform               string `json:"platform,omitempty"`
+	Version                string `json:"version,omitempty"`
+	Enabled                bool   `json:"enabled"`
+	Registered             bool   `json:"registered"`
+	GitOpsNamespace        string `json:"gitopsNamespace,omitempty"`
+	Server                 string `json:"server,omitempty"`
+	LastRegistrationChange string `json:"lastRegistrationChange,omitempty"`
+	Available              bool   `json:"available"`
+	Degraded               bool   `json:"degraded"`
+	// State tells registered, pending, failed, skipped, disabled, not enrolled and unmanaged clusters apart
+	State string `json:"state"`
+	// Reason explains the state of clusters that are not registered
+	Reason string `json:"reason,omitempty"`
+	// BoundToken is true when the registration uses a TokenRequest issued token
+	BoundToken bool `json:"boundToken"`
+	// Excluded is true when the cluster is excluded from ApplicationSets
+	Excluded bool `json:"excluded"`
+	// ExcludedReason tells why the cluster is excluded
+	ExcludedReason string `json:"excludedReason,omitempty"`
+	// Features are the hyper-ops features active for the registration, as recorded by the last reconcile
+	Features *RegistrationFeatures `json:"features,omitempty"`
+	// Conditions are the registration conditions recorded on the HostedCluster
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// FleetReporter periodically writes a FleetReport into a ConfigMap
+type FleetReporter struct {
+	Client            client.Client
+	Namespace         string
+	Interval          time.Duration
+	DefaultEnrollment string
+	// Archive keeps the full report outside of etcd, the ConfigMap only holds the summary and the location of the
+	// report. The full report is written to the ConfigMap if nil.
+	Archive archive.Store
+}
+
+// Start runs the reporter until the context is cancelled, it implements manager.Runnable
+func (f *FleetReporter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("fleet-report")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := f.writeReport(ctx); err != nil {
+			log.Error(err, "unable to write fleet report")
+		}
+	}, f.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader writes the report
+func (f *FleetReporter) NeedLeaderElection() bool {
+	return true
+}
+
+func (f *FleetReporter) writeReport(ctx context.Context) error {
+	report, err := GenerateFleetReport(ctx, f.Client, f.DefaultEnrollment)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	location := ""
+	if f.Archive != nil {
+		if err := f.Archive.Put(ctx, fleetReportArchiveKey, data); err != nil {
+			archiveWriteErrors.WithLabelValues("fleet-report").Inc()
+			return fmt.Errorf("unable to archive the fleet report: %w", err)
+		}
+		location = f.Archive.Location(fleetReportArchiveKey)
+		compact := *report
+		compact.Clusters = []FleetReportCluster{}
+		if data, err = json.MarshalIndent(compact, "", "  "); err != nil {
+			return err
+		}
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fleetReportConfigMapName,
+			Namespace: f.Namespace,
+		},
+	}
+	_, err = CreateOrUpdateWithRetries(ctx, f.Client, cm, func() error {
+		stampManaged(cm, "")
+		cm.Data = map[string]string{
+			fleetReportDataKey: string(data),
+		}
+		if location != "" {
+			cm.Data[fleetReportLocationKey] = location
+		}
+		return nil
+	})
+	return err
+}
+
+// GenerateFleetReport builds a FleetReport from the HostedClusters and the ArgoCD cluster secrets on the cluster
+func GenerateFleetReport(ctx context.Context, c client.Client, defaultEnrollment string) (*FleetReport, error) {
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := c.List(ctx, hcs); err != nil {
+		return nil, err
+	}
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return nil, err
+	}
+	registrations := map[string]*corev1.Secret{}
+	for i := range secrets.Items {
+		// copies in additional gitops namespaces carry the annotation as well, the primary secret is reported
+		if _, ok := secrets.Items[i].Annotations[hyperOpsCopyOfAnnotation]; ok {
+			continue
+		}
+		if ref, ok := secrets.Items[i].Annotations[hyperOpsHostedClusterAnnotation]; ok {
+			registrations[ref] = &secrets.Items[i]
+		}
+	}
+
+	report := &FleetReport{
+		GeneratedAt: metav1.Now(),
+		Summary:     FleetReportSummary{States: map[string]int{}},
+		Clusters:    []FleetReportCluster{},
+	}
+	for i := range hcs.Items {
+		hc := &hcs.Items[i]
+		entry := FleetReportCluster{
+			Name:      hc.Name,
+			Namespace: hc.Namespace,
+			Platform:  string(hc.Spec.Platform.Type),
+			Version:   hostedClusterVersion(hc),
+			Available: meta.IsStatusConditionTrue(hc.Status.Conditions, string(hypershiftv1beta1.HostedClusterAvailable)),
+			Degraded:  meta.IsStatusConditionTrue(hc.Status.Conditions, string(hypershiftv1beta1.HostedClusterDegraded)),
+			Features:  registrationFeaturesFromAnnotation(hc),
+		}
+		entry.Conditions = registrationConditions(hc)
+		entry.BoundToken = meta.IsStatusConditionTrue(entry.Conditions, ConditionBoundServiceAccountToken)
+		entry.Enabled = hostedClusterEnrolled(hc, defaultEnrollment)
+		entry.Excluded = canonicalLabels(hc.GetLabels())[hyperOpsExcludedLabel] == "true"
+		entry.ExcludedReason = hc.GetAnnotations()[hyperOpsExcludedReasonAnnotation]
+		if secret, ok := registrations[client.ObjectKeyFromObject(hc).String()]; ok {
+			entry.Registered = true
+			entry.GitOpsNamespace = secret.Namespace
+			entry.Server = string(secret.Data["server"])
+			entry.LastRegistrationChange = secret.Annotations[hyperOpsLastRegistrationChangeAnnotation]
+		}
+		entry.State, entry.Reason = clusterState(hc, &entry)
+		report.Summary.States[entry.State]++
+		report.Summary.Total++
+		if entry.Enabled {
+			report.Summary.Enabled++
+		}
+		if entry.Registered {
+			report.Summary.Registered++
+		}
+		if entry.Available {
+			report.Summary.Available++
+		}
+		if entry.Degraded {
+			report.Summary.Degraded++
+		}
+		if entry.BoundToken {
+			report.Summary.BoundTokens++
+		}
+		report.Clusters = append(report.Clusters, entry)
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		if report.Clusters[i].Namespace != report.Clusters[j].Namespace {
+			return report.Clusters[i].Namespace < report.Clusters[j].Namespace
+		}
+		return report.Clusters[i].Name < report.Clusters[j].Name
+	})
+	return report, nil
+}
+
+// clusterState returns the state of the HostedCluster in the fleet inventory and the reason for it
+func clusterState(hc *hypershiftv1beta1.HostedCluster, entry *FleetReportCluster) (string, string) {
+	if hc.GetAnnotations()[hyperOpsUnmanageAnnotation] == "true" {
+		return ClusterStateUnmanaged, fmt.Sprintf("annotated %s=true", hyperOpsUnmanageAnnotation)
+	}
+	if canonicalLabels(hc.GetLabels())[hyperOpsEnabledLabel] == "false" {
+		return ClusterStateDisabled, fmt.Sprintf("labeled %s=false", hyperOpsEnabledLabel)
+	}
+	if !entry.Enabled {
+		return ClusterStateNotEnrolled, fmt.Sprintf("not labeled %s and the default enrollment is disabled", hyperOpsEnabledLabel)
+	}
+	if standalone(hc) {
+		if condition := meta.FindStatusCondition(entry.Conditions, ConditionStandaloneGitOpsReady); condition != nil {
+			return ClusterStateStandalone, condition.Message
+		}
+		return ClusterStateStandalone, "waiting for the installation of ArgoCD"
+	}
+	if entry.Registered {
+		return ClusterStateRegistered, ""
+	}
+	if condition := meta.FindStatusCondition(entry.Conditions, ConditionTerminalState); condition != nil &&
+		condition.Status == metav1.ConditionTrue && condition.Reason != "Retrying" {
+		return ClusterStateSkipped, condition.Message
+	}
+	for _, condition := range entry.Conditions {
+		status, ok := failedRegistrationConditions[condition.Type]
+		if ok && condition.Status == status && condition.Reason != "NotConfigured" {
+			return ClusterStateFailed, fmt.Sprintf("%s: %s", condition.Type, condition.Message)
+		}
+	}
+	return ClusterStatePending, "waiting for the first registration"
+}
+
+// hostedClusterVersion returns the current version of the hosted cluster, falling back to the desired version
+func hostedClusterVersion(hc *hypershiftv1beta1.HostedCluster) string {
+	if hc.Status.Version == nil {
+		return ""
+	}
+	for _, h := range hc.Status.Version.History {
+		if h.State == configv1.CompletedUpdate {
+			return h.Version
+		}
+	}
+	return hc.Status.Version.Desired.Version
+}
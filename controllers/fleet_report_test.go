@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Fleet report", func() {
+	It("Should summarize enabled, disabled and registered HostedClusters", func() {
+		enabled := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "enabled",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsEnabledLabel: "true"},
+			},
+			Status: hypershiftv1beta1.HostedClusterStatus{
+				Conditions: []metav1.Condition{
+					{Type: string(hypershiftv1beta1.HostedClusterAvailable), Status: metav1.ConditionTrue},
+				},
+			},
+		}
+		disabled := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "disabled",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsEnabledLabel: "false"},
+			},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "enabled",
+				Namespace: "openshift-gitops",
+				Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+				Annotations: map[string]string{
+					hyperOpsHostedClusterAnnotation: "clusters/enabled",
+				},
+			},
+			Data: map[string][]byte{"server": []byte("https://enabled:6443")},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(enabled, disabled, secret).Build()
+
+		report, err := GenerateFleetReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Summary).To(Equal(FleetReportSummary{Total: 2, Enabled: 1, Registered: 1, Available: 1,
+			States: map[string]int{ClusterStateRegistered: 1, ClusterStateDisabled: 1}}))
+		Expect(report.Clusters).To(HaveLen(2))
+		Expect(report.Clusters[0].Name).To(Equal("disabled"))
+		Expect(report.Clusters[0].State).To(Equal(ClusterStateDisabled))
+		Expect(report.Clusters[1].State).To(Equal(ClusterStateRegistered))
+		Expect(report.Clusters[1].Server).To(Equal("https://enabled:6443"))
+		Expect(report.Clusters[1].GitOpsNamespace).To(Equal("openshift-gitops"))
+	})
+
+	It("Should report the primary registration of a HostedCluster with copies", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsEnabledLabel: "true"},
+			},
+		}
+		primary := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "openshift-gitops",
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/hosted"},
+			},
+			Data: map[string][]byte{"server": []byte("https://hosted:6443")},
+		}
+		// listed after the primary secret
+		copied := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "team-b",
+				Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+				Annotations: map[string]string{
+					hyperOpsHostedClusterAnnotation: "clusters/hosted",
+					hyperOpsCopyOfAnnotation:        "openshift-gitops/hosted",
+				},
+			},
+			Data: map[string][]byte{"server": []byte("https://hosted.team-b:6443")},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, primary, copied).Build()
+
+		report, err := GenerateFleetReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Clusters).To(HaveLen(1))
+		Expect(report.Clusters[0].Registered).To(BeTrue())
+		Expect(report.Clusters[0].GitOpsNamespace).To(Equal("openshift-gitops"))
+		Expect(report.Clusters[0].Server).To(Equal("https://hosted:6443"))
+	})
+
+	It("Should tell never enrolled, failed and pending HostedClusters apart", func() {
+		hostedCluster := func(name string, conditions ...metav1.Condition) *hypershiftv1beta1.HostedCluster {
+			hc := &hypershiftv1beta1.HostedCluster{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+			}
+			if len(conditions) > 0 {
+				raw, err := json.Marshal(conditions)
+				Expect(err).NotTo(HaveOccurred())
+				hc.Annotations = map[string]string{hyperOpsConditionsAnnotation: string(raw)}
+			}
+			return hc
+		}
+		failed := hostedCluster("failed", metav1.Condition{
+			Type: ConditionGitOpsNamespaceReady, Status: metav1.ConditionFalse, Reason: "NamespaceNotFound", Message: "gitops namespace team-a does not exist",
+		})
+		skipped := hostedCluster("skipped", metav1.Condition{
+			Type: ConditionTerminalState, Status: metav1.ConditionTrue, Reason: "Skipped", Message: "invalid configuration",
+		})
+		pending := hostedCluster("pending")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(failed, skipped, pending).Build()
+
+		report, err := GenerateFleetReport(context.Background(), c, DefaultEnrollmentEnabled)
+		Expect(err).NotTo(HaveOccurred())
+		states := map[string]string{}
+		for _, cluster := range report.Clusters {
+			states[cluster.Name] = cluster.State
+		}
+		Expect(states).To(Equal(map[string]string{
+			"failed":  ClusterStateFailed,
+			"skipped": ClusterStateSkipped,
+			"pending": ClusterStatePending,
+		}))
+		Expect(report.Clusters[0].Reason).To(Equal("GitOpsNamespaceReady: gitops namespace team-a does not exist"))
+
+		report, err = GenerateFleetReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Summary.States).To(Equal(map[string]int{ClusterStateNotEnrolled: 3}))
+	})
+})
@@ -0,0 +1,219 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// DefaultFluxBranch is the branch of the git repository if none is configured
+	DefaultFluxBranch = "main"
+	// DefaultFluxPath is the path of the manifests of a hosted cluster if none is configured
+	DefaultFluxPath = "clusters/{{ .Name }}"
+	// DefaultFluxInterval is the interval at which Flux reconciles the objects if none is configured
+	DefaultFluxInterval = 10 * time.Minute
+
+	// fluxKubeconfigKey holds the kubeconfig in the secret, the key Flux reads by default
+	fluxKubeconfigKey = "value"
+)
+
+var (
+	fluxGitRepositoryGVK = schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1", Kind: "GitRepository"}
+	fluxKustomizationGVK = schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"}
+)
+
+// FluxRegistrar registers the HostedClusters with Flux. Every hosted cluster gets a kubeconfig secret, a
+// GitRepository and a Kustomization applying the manifests of the cluster with that kubeconfig, all named after the
+// HostedCluster.
+type FluxRegistrar struct {
+	Client    client.Client
+	Namespace string
+	URL       *template.Template
+	Branch    *template.Template
+	Path      *template.Template
+	SecretRef string
+	Interval  time.Duration
+}
+
+var _ Registrar = &FluxRegistrar{}
+
+// NewFluxRegistrar returns a FluxRegistrar writing to the namespace of the config, empty settings are defaulted
+func NewFluxRegistrar(c client.Client, config hyperopsv1alpha1.FluxConfig) (*FluxRegistrar, error) {
+	if errs := validation.IsDNS1123Label(config.Namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid flux namespace %q: %s", config.Namespace, strings.Join(errs, ", "))
+	}
+	if config.URL == "" {
+		return nil, fmt.Errorf("the flux git repository url must not be empty")
+	}
+	if config.Branch == "" {
+		config.Branch = DefaultFluxBranch
+	}
+	if config.Path == "" {
+		config.Path = DefaultFluxPath
+	}
+	f := &FluxRegistrar{Client: c, Namespace: config.Namespace, SecretRef: config.SecretRef, Interval: DefaultFluxInterval}
+	if config.Interval != nil {
+		if config.Interval.Duration <= 0 {
+			return nil, fmt.Errorf("the flux interval %s must be positive", config.Interval.Duration)
+		}
+		f.Interval = config.Interval.Duration
+	}
+	for _, t := range []struct {
+		name string
+		text string
+		tmpl **template.Template
+	}{{"url", config.URL, &f.URL}, {"branch", config.Branch, &f.Branch}, {"path", config.Path, &f.Path}} {
+		tmpl, err := template.New("flux-" + t.name).Option("missingkey=error").Parse(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flux %s template: %w", t.name, err)
+		}
+		*t.tmpl = tmpl
+	}
+	return f, nil
+}
+
+// ValidateFluxConfig returns an error if no FluxRegistrar can be created from the config
+func ValidateFluxConfig(config *hyperopsv1alpha1.FluxConfig) error {
+	_, err := NewFluxRegistrar(nil, *config)
+	return err
+}
+
+func (f *FluxRegistrar) Name() string {
+	return "flux"
+}
+
+// Register writes the kubeconfig secret, the GitRepository and the Kustomization of the HostedCluster
+func (f *FluxRegistrar) Register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	kubeconfig, err := clusterKubeconfig(cluster)
+	if err != nil {
+		return err
+	}
+	data := clusterNameData{Name: hc.Name, Namespace: hc.Namespace, InfraID: hc.Spec.InfraID, Labels: hc.GetLabels()}
+	url, err := renderFluxTemplate(f.URL, data)
+	if err != nil {
+		return err
+	}
+	branch, err := renderFluxTemplate(f.Branch, data)
+	if err != nil {
+		return err
+	}
+	path, err := renderFluxTemplate(f.Path, data)
+	if err != nil {
+		return err
+	}
+	interval := f.Interval.String()
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: fluxKubeconfigSecretName(hc), Namespace: f.Namespace}}
+	if _, err := CreateOrUpdateWithRetries(ctx, f.Client, secret, func() error {
+		if err := claimRegistrarObject(secret, hc); err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{fluxKubeconfigKey: kubeconfig}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the kubeconfig secret: %w", err)
+	}
+
+	source := map[string]interface{}{
+		"interval": interval,
+		"url":      url,
+		"ref":      map[string]interface{}{"branch": branch},
+	}
+	if f.SecretRef != "" {
+		source["secretRef"] = map[string]interface{}{"name": f.SecretRef}
+	}
+	if err := f.apply(ctx, hc, fluxGitRepositoryGVK, source); err != nil {
+		return err
+	}
+	return f.apply(ctx, hc, fluxKustomizationGVK, map[string]interface{}{
+		"interval": interval,
+		"path":     path,
+		"prune":    true,
+		"sourceRef": map[string]interface{}{
+			"kind": fluxGitRepositoryGVK.Kind,
+			"name": hc.Name,
+		},
+		"kubeConfig": map[string]interface{}{
+			"secretRef": map[string]interface{}{"name": secret.Name, "key": fluxKubeconfigKey},
+		},
+	})
+}
+
+// apply writes the spec of the Flux object of the HostedCluster
+func (f *FluxRegistrar) apply(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gvk schema.GroupVersionKind, spec map[string]interface{}) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(f.Namespace)
+	obj.SetName(hc.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, f.Client, obj, func() error {
+		if err := claimRegistrarObject(obj, hc); err != nil {
+			return err
+		}
+		obj.Object["spec"] = spec
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the %s: %w", gvk.Kind, err)
+	}
+	return nil
+}
+
+// Deregister deletes the Kustomization, the GitRepository and the kubeconfig secret of the HostedCluster. The
+// Kustomization goes first, so Flux can still prune with the kubeconfig.
+func (f *FluxRegistrar) Deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	kustomization := &unstructured.Unstructured{}
+	kustomization.SetGroupVersionKind(fluxKustomizationGVK)
+	kustomization.SetName(hc.Name)
+	repository := &unstructured.Unstructured{}
+	repository.SetGroupVersionKind(fluxGitRepositoryGVK)
+	repository.SetName(hc.Name)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: fluxKubeconfigSecretName(hc)}}
+	return deleteRegistrarObjects(ctx, f.Client, hc, f.Namespace, kustomization, repository, secret)
+}
+
+// fluxKubeconfigSecretName returns the name of the kubeconfig secret of the HostedCluster
+func fluxKubeconfigSecretName(hc *hypershiftv1beta1.HostedCluster) string {
+	return hc.Name + "-flux-kubeconfig"
+}
+
+func renderFluxTemplate(tmpl *template.Template, data clusterNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("unable to render the %s: %w", strings.TrimPrefix(tmpl.Name(), "flux-"), err)
+	}
+	value := strings.TrimSpace(buf.String())
+	if value == "" {
+		return "", fmt.Errorf("the %s template rendered an empty value", strings.TrimPrefix(tmpl.Name(), "flux-"))
+	}
+	return value, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Flux registrar", func() {
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+		Name: "hosted", Namespace: "clusters", UID: "uid", Labels: map[string]string{"env": "prod"},
+	}}
+	cluster := &Cluster{Cluster: argocd.Cluster{
+		Name:   "hosted",
+		Server: "https://hosted:6443",
+		Config: argocd.ClusterConfig{BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+	}}
+	registrar := func(c client.Client) *FluxRegistrar {
+		f, err := NewFluxRegistrar(c, hyperopsv1alpha1.FluxConfig{
+			Namespace: "flux-system",
+			URL:       "https://git.example.com/fleet.git",
+			Branch:    "{{ .Labels.env }}",
+			SecretRef: "fleet-auth",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return f
+	}
+	fluxObject := func(c client.Client, kind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		gvk := fluxKustomizationGVK
+		if kind == fluxGitRepositoryGVK.Kind {
+			gvk = fluxGitRepositoryGVK
+		}
+		obj.SetGroupVersionKind(gvk)
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: name}, obj)).To(Succeed())
+		return obj
+	}
+
+	It("Should validate the flux config", func() {
+		Expect(ValidateFluxConfig(&hyperopsv1alpha1.FluxConfig{Namespace: "flux-system", URL: "https://git.example.com/fleet.git"})).To(Succeed())
+		Expect(ValidateFluxConfig(&hyperopsv1alpha1.FluxConfig{Namespace: "flux-system"})).NotTo(Succeed())
+		Expect(ValidateFluxConfig(&hyperopsv1alpha1.FluxConfig{Namespace: "Flux", URL: "https://git.example.com/fleet.git"})).NotTo(Succeed())
+		Expect(ValidateFluxConfig(&hyperopsv1alpha1.FluxConfig{Namespace: "flux-system", URL: "https://git.example.com/fleet.git", Path: "{{ .Name"})).NotTo(Succeed())
+		Expect(ValidateFluxConfig(&hyperopsv1alpha1.FluxConfig{
+			Namespace: "flux-system", URL: "https://git.example.com/fleet.git", Interval: &metav1.Duration{},
+		})).NotTo(Succeed())
+	})
+
+	It("Should write the kubeconfig secret, GitRepository and Kustomization of the cluster", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(registrar(c).Register(context.Background(), hc, cluster)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: "hosted-flux-kubeconfig"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+		Expect(secret.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		kubeconfig, err := clientcmd.Load(secret.Data[fluxKubeconfigKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubeconfig.AuthInfos["hosted"].Token).To(Equal("token"))
+
+		repository := fluxObject(c, fluxGitRepositoryGVK.Kind, "hosted")
+		Expect(repository.Object["spec"]).To(Equal(map[string]interface{}{
+			"interval":  "10m0s",
+			"url":       "https://git.example.com/fleet.git",
+			"ref":       map[string]interface{}{"branch": "prod"},
+			"secretRef": map[string]interface{}{"name": "fleet-auth"},
+		}))
+		kustomization := fluxObject(c, fluxKustomizationGVK.Kind, "hosted")
+		path, _, _ := unstructured.NestedString(kustomization.Object, "spec", "path")
+		Expect(path).To(Equal("clusters/hosted"))
+		secretRef, _, _ := unstructured.NestedString(kustomization.Object, "spec", "kubeConfig", "secretRef", "name")
+		Expect(secretRef).To(Equal("hosted-flux-kubeconfig"))
+		source, _, _ := unstructured.NestedString(kustomization.Object, "spec", "sourceRef", "name")
+		Expect(source).To(Equal("hosted"))
+	})
+
+	It("Should not take over objects it did not write", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "flux-system", Name: "hosted-flux-kubeconfig"},
+			Data:       map[string][]byte{fluxKubeconfigKey: []byte("foreign")},
+		}).Build()
+		Expect(registrar(c).Register(context.Background(), hc, cluster)).NotTo(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: "hosted-flux-kubeconfig"}, secret)).To(Succeed())
+		Expect(secret.Data[fluxKubeconfigKey]).To(Equal([]byte("foreign")))
+
+		// the foreign secret is left alone on deregistration
+		Expect(registrar(c).Deregister(context.Background(), hc)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+	})
+
+	It("Should deregister the cluster with the registration", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, Recorder: record.NewFakeRecorder(10), Registrars: []Registrar{registrar(c)}}
+		Expect(r.register(context.Background(), hc, cluster)).To(Succeed())
+		Expect(r.registrationFeatures(hc).Registrars).To(Equal([]string{"flux"}))
+
+		Expect(r.deregister(context.Background(), hc)).To(Succeed())
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: "hosted-flux-kubeconfig"}, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(fluxKustomizationGVK)
+		err = c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: "hosted"}, obj)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should skip credentials obtained by a command", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		recorder := record.NewFakeRecorder(10)
+		r := &HyperOpsReconciler{Client: c, Recorder: recorder, Registrars: []Registrar{registrar(c)}}
+		Expect(r.register(context.Background(), hc, cluster)).To(Succeed())
+
+		exec := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443", Config: argocd.ClusterConfig{
+			ExecProviderConfig: &argocd.ExecProviderConfig{Command: "argocd-k8s-auth"},
+		}}}
+		Expect(r.register(context.Background(), hc, exec)).To(Succeed())
+		Expect(recorder.Events).To(Receive(ContainSubstring("RegistrarSkipped")))
+		err := c.Get(context.Background(), client.ObjectKey{Namespace: "flux-system", Name: "hosted-flux-kubeconfig"}, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,168 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// FreezeConfigMapName is the ConfigMap in the freeze namespace that puts the operator into read-only mode
+	FreezeConfigMapName = "hyper-ops-freeze"
+	// FreezeExpiresAtKey holds the RFC3339 time the freeze ends, freezes without it are ignored
+	FreezeExpiresAtKey = "expiresAt"
+	// FreezeReasonKey holds the optional reason of the freeze, e.g. the incident
+	FreezeReasonKey = "reason"
+)
+
+var operatorFrozen = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "hyperops_frozen",
+	Help: "1 while the freeze ConfigMap keeps the operator in read-only mode",
+})
+
+func init() {
+	metrics.Registry.MustRegister(operatorFrozen)
+}
+
+// Freeze is a request to stop all writes of the operator until ExpiresAt
+type Freeze struct {
+	ExpiresAt time.Time
+	Reason    string
+}
+
+// ParseFreeze returns the freeze of the freeze ConfigMap. The expiry is required, so a forgotten freeze can't keep
+// the operator read-only forever.
+func ParseFreeze(cm *corev1.ConfigMap) (*Freeze, error) {
+	raw, ok := cm.Data[FreezeExpiresAtKey]
+	if !ok {
+		return nil, fmt.Errorf("freeze %s/%s has no %s", cm.Namespace, cm.Name, FreezeExpiresAtKey)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("freeze %s/%s has an invalid %s: %w", cm.Namespace, cm.Name, FreezeExpiresAtKey, err)
+	}
+	return &Freeze{ExpiresAt: expiresAt, Reason: cm.Data[FreezeReasonKey]}, nil
+}
+
+// freezeState is the last freeze read by the reconciler, safe for concurrent use
+type freezeState struct {
+	mu     sync.Mutex
+	freeze *Freeze
+}
+
+// set replaces the freeze and returns true if it changed
+func (f *freezeState) set(freeze *Freeze) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := (f.freeze == nil) != (freeze == nil) || (freeze != nil && *f.freeze != *freeze)
+	f.freeze = freeze
+	return changed
+}
+
+// active returns the freeze if it didn't expire yet
+func (f *freezeState) active(now time.Time) (*Freeze, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.freeze == nil || !now.Before(f.freeze.ExpiresAt) {
+		return nil, false
+	}
+	return f.freeze, true
+}
+
+// refreshFreeze reads the freeze ConfigMap, the previous freeze is kept if it can't be read
+func (r *HyperOpsReconciler) refreshFreeze(ctx context.Context) {
+	if r.FreezeNamespace == "" {
+		return
+	}
+	log := log.FromContext(ctx)
+	var freeze *Freeze
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: r.FreezeNamespace, Name: FreezeConfigMapName}, cm); client.IgnoreNotFound(err) != nil {
+		log.Error(err, "unable to read the freeze, keeping the previous one")
+		return
+	} else if err == nil {
+		if freeze, err = ParseFreeze(cm); err != nil {
+			log.Error(err, "ignoring freeze")
+		}
+	}
+	if r.freeze.set(freeze) {
+		if active, ok := r.freeze.active(time.Now()); ok {
+			log.Info("operator frozen, reconciles don't write until the freeze expires", "expiresAt", active.ExpiresAt, "reason", active.Reason)
+		} else {
+			log.Info("operator unfrozen")
+		}
+	}
+	if r.Frozen() {
+		operatorFrozen.Set(1)
+	} else {
+		operatorFrozen.Set(0)
+	}
+}
+
+// Frozen returns true while an unexpired freeze keeps the operator read-only
+func (r *HyperOpsReconciler) Frozen() bool {
+	_, ok := r.freeze.active(time.Now())
+	return ok
+}
+
+// readOnly returns true if reconciles compute their changes without writing them, in dry-run mode or while frozen
+func (r *HyperOpsReconciler) readOnly() bool {
+	return r.DryRun || r.Frozen()
+}
+
+// requeueAfterFreeze makes sure the HostedCluster is reconciled again once the freeze expires, so pending writes
+// are applied without waiting for the next change
+func (r *HyperOpsReconciler) requeueAfterFreeze(result reconcile.Result) reconcile.Result {
+	freeze, ok := r.freeze.active(time.Now())
+	if !ok {
+		return result
+	}
+	if after := time.Until(freeze.ExpiresAt); result.RequeueAfter == 0 || after < result.RequeueAfter {
+		result.RequeueAfter = after
+	}
+	return result
+}
+
+// hostedClustersForFreeze reconciles all enrolled HostedClusters when the freeze ConfigMap changes, lifting a
+// freeze early applies the pending writes right away
+func (r *HyperOpsReconciler) hostedClustersForFreeze(obj client.Object) []reconcile.Request {
+	if r.FreezeNamespace == "" || obj.GetNamespace() != r.FreezeNamespace || obj.GetName() != FreezeConfigMapName {
+		return nil
+	}
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := r.List(context.Background(), hcs); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range hcs.Items {
+		if hostedClusterEnrolled(&hcs.Items[i], r.DefaultEnrollment) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hcs.Items[i])})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Freeze", func() {
+	freezeConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: FreezeConfigMapName, Namespace: "hyper-ops"}, Data: data}
+	}
+
+	It("Should require an expiry", func() {
+		_, err := ParseFreeze(freezeConfigMap(map[string]string{FreezeReasonKey: "incident"}))
+		Expect(err).To(HaveOccurred())
+		_, err = ParseFreeze(freezeConfigMap(map[string]string{FreezeExpiresAtKey: "tomorrow"}))
+		Expect(err).To(HaveOccurred())
+
+		freeze, err := ParseFreeze(freezeConfigMap(map[string]string{FreezeExpiresAtKey: "2023-05-01T10:00:00Z", FreezeReasonKey: "incident"}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(freeze.ExpiresAt).To(Equal(time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)))
+		Expect(freeze.Reason).To(Equal("incident"))
+	})
+
+	It("Should not write while frozen and requeue at the expiry", func() {
+		now := metav1.Now()
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", DeletionTimestamp: &now, Finalizers: []string{hyperOpsFinalizer},
+			Labels: map[string]string{hyperOpsEnabledLabel: "true"},
+		}}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "hosted",
+			Namespace: defaultGitOpsNamespace,
+			Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+		}}
+		freeze := freezeConfigMap(map[string]string{FreezeExpiresAtKey: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)})
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret, freeze).Build()
+		r := &HyperOpsReconciler{Client: c, FreezeNamespace: "hyper-ops"}
+
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Frozen()).To(BeTrue())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Finalizers).To(Equal([]string{hyperOpsFinalizer}))
+		Expect(r.hostedClustersForFreeze(freeze)).To(HaveLen(1))
+
+		By("lifting the freeze")
+		Expect(c.Delete(context.Background(), freeze)).To(Succeed())
+		result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(hc)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Frozen()).To(BeFalse())
+		Expect(result.RequeueAfter).To(BeZero())
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should ignore expired freezes and freezes without an expiry", func() {
+		for _, data := range []map[string]string{
+			{FreezeExpiresAtKey: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)},
+			{FreezeReasonKey: "forever"},
+		} {
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(freezeConfigMap(data)).Build()
+			r := &HyperOpsReconciler{Client: c, FreezeNamespace: "hyper-ops"}
+			r.refreshFreeze(context.Background())
+			Expect(r.Frozen()).To(BeFalse())
+			Expect(r.readOnly()).To(BeFalse())
+		}
+	})
+
+	It("Should ignore the freeze if disabled and other ConfigMaps", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c, FreezeNamespace: "hyper-ops"}
+		other := freezeConfigMap(nil)
+		other.Name = "other"
+		Expect(r.hostedClustersForFreeze(other)).To(BeEmpty())
+
+		r.FreezeNamespace = ""
+		Expect(r.hostedClustersForFreeze(freezeConfigMap(nil))).To(BeEmpty())
+	})
+})
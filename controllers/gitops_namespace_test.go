@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("GitOps namespace watch", func() {
+	It("Should map a new namespace to the HostedClusters registering into it", func() {
+		labeled := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "labeled",
+				Namespace: "clusters",
+				Labels: map[string]string{
+					hyperOpsEnabledLabel:         "true",
+					hyperOpsGitopsNamespaceLabel: "team-gitops",
+				},
+			},
+		}
+		defaulted := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "defaulted",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsEnabledLabel: "true"},
+			},
+		}
+		notEnabled := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "not-enabled",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsGitopsNamespaceLabel: "team-gitops"},
+			},
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(labeled, defaulted, notEnabled).Build()}
+
+		requests := r.hostedClustersForNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-gitops"}})
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("labeled"))
+
+		requests = r.hostedClustersForNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultGitOpsNamespace}})
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("defaulted"))
+	})
+})
+
+var _ = Describe("Enrollment", func() {
+	It("Should follow the enabled label before the default enrollment", func() {
+		hc := &hypershiftv1beta1.HostedCluster{}
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentDisabled)).To(BeFalse())
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentEnabled)).To(BeTrue())
+
+		hc.Labels = map[string]string{hyperOpsEnabledLabel: "false"}
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentEnabled)).To(BeFalse())
+
+		hc.Labels = map[string]string{hyperOpsEnabledLabel: "true"}
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentDisabled)).To(BeTrue())
+	})
+})
@@ -0,0 +1,181 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsChangeHistoryAnnotation holds the last changes of the registration on the ArgoCD cluster secret
+	hyperOpsChangeHistoryAnnotation = "hyper-ops.cloudmonkey.org/change-history"
+
+	// maxChangeHistory is the number of changes kept per registration
+	maxChangeHistory = 10
+
+	ChangeTypeCreated            = "Created"
+	ChangeTypeServerChanged      = "ServerChanged"
+	ChangeTypeCredentialsRotated = "CredentialsRotated"
+	ChangeTypeConfigChanged      = "ConfigChanged"
+	ChangeTypeLabelsChanged      = "LabelsChanged"
+
+	// ChangeActorController is the controller acting on the HostedCluster or its configuration
+	ChangeActorController = "controller"
+	// ChangeActorRotation is a credential rotation
+	ChangeActorRotation = "rotation"
+	// ChangeActorLabel is a change of the labels of the HostedCluster
+	ChangeActorLabel = "label"
+	// ChangeActorPolicy is a registration policy
+	ChangeActorPolicy = "policy"
+)
+
+// RegistrationChange is an entry of the change history of a registration
+type RegistrationChange struct {
+	Time    metav1.Time `json:"time"`
+	Type    string      `json:"type"`
+	Actor   string      `json:"actor"`
+	Message string      `json:"message,omitempty"`
+}
+
+// RegistrationHistory returns the change history recorded on the ArgoCD cluster secret, oldest first
+func RegistrationHistory(secret *corev1.Secret) []RegistrationChange {
+	history := []RegistrationChange{}
+	if raw, ok := secret.Annotations[hyperOpsChangeHistoryAnnotation]; ok {
+		// a corrupted history is started over
+		_ = json.Unmarshal([]byte(raw), &history)
+	}
+	return history
+}
+
+// recordRegistrationChanges appends the changes between the current content of the ArgoCD cluster secret and the
+// desired data and labels to its history and returns them. It must run before the secret and its credential
+// fingerprints are updated.
+func recordRegistrationChanges(secret *corev1.Secret, cluster *Cluster, data map[string][]byte, labels map[string]string, now time.Time) []RegistrationChange {
+	changes := registrationChanges(secret, cluster, data, labels)
+	if len(changes) == 0 {
+		return nil
+	}
+	history := RegistrationHistory(secret)
+	for i := range changes {
+		changes[i].Time = metav1.NewTime(now.UTC().Truncate(time.Second))
+		history = append(history, changes[i])
+	}
+	if len(history) > maxChangeHistory {
+		history = history[len(history)-maxChangeHistory:]
+	}
+	raw, err := json.Marshal(history)
+	if err != nil {
+		return changes
+	}
+	metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsChangeHistoryAnnotation, string(raw))
+	return changes
+}
+
+// registrationChanges returns the changes between the secret and the desired data and labels
+func registrationChanges(secret *corev1.Secret, cluster *Cluster, data map[string][]byte, labels map[string]string) []RegistrationChange {
+	if secret.CreationTimestamp.IsZero() {
+		return []RegistrationChange{{Type: ChangeTypeCreated, Actor: ChangeActorController, Message: fmt.Sprintf("registered server %s", cluster.Server)}}
+	}
+	changes := []RegistrationChange{}
+	if old := string(secret.Data["server"]); old != cluster.Server {
+		changes = append(changes, RegistrationChange{
+			Type:    ChangeTypeServerChanged,
+			Actor:   ChangeActorController,
+			Message: fmt.Sprintf("server changed from %s to %s", old, cluster.Server),
+		})
+	}
+	rotated := []string{}
+	fingerprints := credentialFingerprints(cluster)
+	for _, kind := range []string{credentialToken, credentialClientCertificate} {
+		if old, ok := secret.Annotations[fmt.Sprintf("%s/%s-fingerprint", hyperOpsLabel, kind)]; ok && old != fingerprints[kind] {
+			rotated = append(rotated, kind)
+		}
+	}
+	if len(rotated) > 0 {
+		changes = append(changes, RegistrationChange{
+			Type:    ChangeTypeCredentialsRotated,
+			Actor:   ChangeActorRotation,
+			Message: fmt.Sprintf("rotated %s", strings.Join(rotated, ", ")),
+		})
+	}
+	if !reflect.DeepEqual(withoutCredentials(secret.Data), withoutCredentials(data)) {
+		changes = append(changes, RegistrationChange{
+			Type:    ChangeTypeConfigChanged,
+			Actor:   ChangeActorController,
+			Message: "the connection configuration changed",
+		})
+	}
+	changed := []string{}
+	actor := ChangeActorLabel
+	for _, k := range unionKeys(secret.Labels, labels) {
+		if old, ok := secret.Labels[k]; ok && old == labels[k] {
+			continue
+		}
+		changed = append(changed, k)
+		if _, ok := cluster.PolicyLabels[k]; ok {
+			actor = ChangeActorPolicy
+		}
+	}
+	if len(changed) > 0 {
+		changes = append(changes, RegistrationChange{
+			Type:    ChangeTypeLabelsChanged,
+			Actor:   actor,
+			Message: fmt.Sprintf("labels changed: %s", strings.Join(changed, ", ")),
+		})
+	}
+	return changes
+}
+
+// withoutCredentials returns the cluster of the secret data without its server and credentials, or nil if it can't
+// be parsed
+func withoutCredentials(data map[string][]byte) *argocd.Cluster {
+	c, err := argocd.ClusterFromSecretData(data)
+	if err != nil {
+		return nil
+	}
+	c.Server = ""
+	c.Config.BearerToken = ""
+	c.Config.Password = ""
+	c.Config.TLSClientConfig.CertData = nil
+	c.Config.TLSClientConfig.KeyData = nil
+	return c
+}
+
+// unionKeys returns the sorted keys of both maps
+func unionKeys(a, b map[string]string) []string {
+	keys := []string{}
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
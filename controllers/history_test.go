@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Registration change history", func() {
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cluster := func(server, token string) *Cluster {
+		return &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: server, Config: argocd.ClusterConfig{BearerToken: token}}}
+	}
+	apply := func(secret *corev1.Secret, c *Cluster, labels map[string]string) {
+		data, err := c.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		recordRegistrationChanges(secret, c, data, labels, now)
+		trackCredentialRotation(secret, credentialFingerprints(c), now)
+		secret.Data = data
+		secret.Labels = labels
+		secret.CreationTimestamp = metav1.NewTime(now)
+	}
+
+	It("Should record why the registration changed", func() {
+		secret := &corev1.Secret{}
+		apply(secret, cluster("https://api.hosted:6443", "a"), map[string]string{"team": "a"})
+		apply(secret, cluster("https://api.hosted:6443", "a"), map[string]string{"team": "a"})
+		apply(secret, cluster("https://api.hosted:6443", "b"), map[string]string{"team": "a"})
+		rotated := cluster("https://api.other:6443", "b")
+		rotated.Config.TLSClientConfig.CAData = []byte("ca")
+		apply(secret, rotated, map[string]string{"team": "a"})
+		withPolicy := cluster("https://api.other:6443", "b")
+		withPolicy.Config.TLSClientConfig.CAData = []byte("ca")
+		withPolicy.PolicyLabels = map[string]string{"cost-center": "1234"}
+		apply(secret, withPolicy, map[string]string{"team": "a", "cost-center": "1234"})
+		apply(secret, withPolicy, map[string]string{"cost-center": "1234"})
+
+		history := RegistrationHistory(secret)
+		types := []string{}
+		actors := []string{}
+		for _, c := range history {
+			types = append(types, c.Type)
+			actors = append(actors, c.Actor)
+		}
+		Expect(types).To(Equal([]string{ChangeTypeCreated, ChangeTypeCredentialsRotated, ChangeTypeServerChanged,
+			ChangeTypeConfigChanged, ChangeTypeLabelsChanged, ChangeTypeLabelsChanged}))
+		Expect(actors).To(Equal([]string{ChangeActorController, ChangeActorRotation, ChangeActorController,
+			ChangeActorController, ChangeActorPolicy, ChangeActorLabel}))
+		Expect(history[1].Message).To(Equal("rotated token"))
+		Expect(history[5].Message).To(Equal("labels changed: team"))
+	})
+
+	It("Should keep a bounded history", func() {
+		secret := &corev1.Secret{}
+		for i := 0; i < maxChangeHistory+5; i++ {
+			apply(secret, cluster("https://api.hosted:6443", string(rune('a'+i))), nil)
+		}
+		history := RegistrationHistory(secret)
+		Expect(history).To(HaveLen(maxChangeHistory))
+		Expect(history[0].Type).To(Equal(ChangeTypeCredentialsRotated))
+	})
+})
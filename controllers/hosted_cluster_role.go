@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hyperOpsClusterRoleAnnotation selects the ClusterRole bound to the service account of hyper-ops in the hosted
+	// cluster, it overrides the configured hosted cluster role
+	hyperOpsClusterRoleAnnotation = "hyper-ops.cloudmonkey.org/cluster-role"
+
+	// DefaultHostedClusterRole is bound to the service account of hyper-ops unless another ClusterRole is selected
+	DefaultHostedClusterRole = "cluster-admin"
+	// BundledHostedClusterRole is the least-privilege ClusterRole shipped with hyper-ops. It is created in the hosted
+	// cluster when selected, other ClusterRoles must exist in the hosted cluster.
+	BundledHostedClusterRole = "hyper-ops-gitops-deployer"
+)
+
+// bundledHostedClusterRoleRules lets ArgoCD read every resource for its cluster cache and manage the namespaced
+// resources applications commonly consist of, it can't change cluster scoped resources other than namespaces
+var bundledHostedClusterRoleRules = []rbacv1.PolicyRule{
+	{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"get", "list", "watch"}},
+	{NonResourceURLs: []string{"/version", "/api", "/apis", "/api/*", "/apis/*"}, Verbs: []string{"get"}},
+	{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"create", "update", "patch"}},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps", "secrets", "services", "serviceaccounts", "persistentvolumeclaims", "pods", "limitranges", "resourcequotas"},
+		Verbs:     []string{"create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments", "statefulsets", "daemonsets", "replicasets"},
+		Verbs:     []string{"create", "update", "patch", "delete"},
+	},
+	{APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: []string{"create", "update", "patch", "delete"}},
+	{APIGroups: []string{"autoscaling"}, Resources: []string{"horizontalpodautoscalers"}, Verbs: []string{"create", "update", "patch", "delete"}},
+	{APIGroups: []string{"policy"}, Resources: []string{"poddisruptionbudgets"}, Verbs: []string{"create", "update", "patch", "delete"}},
+	{
+		APIGroups: []string{"networking.k8s.io"},
+		Resources: []string{"ingresses", "networkpolicies"},
+		Verbs:     []string{"create", "update", "patch", "delete"},
+	},
+	{APIGroups: []string{"route.openshift.io"}, Resources: []string{"routes", "routes/custom-host"}, Verbs: []string{"create", "update", "patch", "delete"}},
+}
+
+// ValidateHostedClusterRole returns an error if the name is not a valid ClusterRole name
+func ValidateHostedClusterRole(name string) error {
+	if name == "" {
+		return fmt.Errorf("the hosted cluster role must not be empty")
+	}
+	if errs := path.IsValidPathSegmentName(name); len(errs) > 0 {
+		return fmt.Errorf("invalid hosted cluster role %q: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// hostedClusterRole returns the ClusterRole bound to the service account of hyper-ops in the hosted cluster of the
+// HostedCluster. The annotation wins over the configured role, the in-cluster registration (nil HostedCluster)
+// always uses the default role.
+func (r *HyperOpsReconciler) hostedClusterRole(hc *hypershiftv1beta1.HostedCluster) (string, error) {
+	if hc == nil {
+		return DefaultHostedClusterRole, nil
+	}
+	if role, ok := hc.GetAnnotations()[hyperOpsClusterRoleAnnotation]; ok {
+		role = strings.TrimSpace(role)
+		if err := ValidateHostedClusterRole(role); err != nil {
+			return "", fmt.Errorf("invalid %s annotation: %w", hyperOpsClusterRoleAnnotation, err)
+		}
+		return role, nil
+	}
+	if r.HostedClusterRole != "" {
+		return r.HostedClusterRole, nil
+	}
+	return DefaultHostedClusterRole, nil
+}
+
+// ensureHostedClusterRole creates the bundled ClusterRole when it is selected, any other ClusterRole but the
+// bootstrapped default role has to exist
+func ensureHostedClusterRole(ctx context.Context, clnt client.Client, role string, correlationID string) error {
+	if role == DefaultHostedClusterRole {
+		return nil
+	}
+	clusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: role}}
+	if role != BundledHostedClusterRole {
+		if err := clnt.Get(ctx, client.ObjectKeyFromObject(clusterRole), clusterRole); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				return fmt.Errorf("the cluster role %s does not exist in the hosted cluster", role)
+			}
+			return err
+		}
+		return nil
+	}
+	_, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, clusterRole, func() error {
+		stampManaged(clusterRole, correlationID)
+		clusterRole.Rules = bundledHostedClusterRoleRules
+		return nil
+	})
+	return err
+}
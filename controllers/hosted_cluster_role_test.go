@@ -0,0 +1,78 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Hosted cluster role", func() {
+	It("Should select the role from the annotation, the configuration or the default", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		r := &HyperOpsReconciler{}
+		Expect(r.hostedClusterRole(hc)).To(Equal(DefaultHostedClusterRole))
+
+		r.HostedClusterRole = BundledHostedClusterRole
+		Expect(r.hostedClusterRole(hc)).To(Equal(BundledHostedClusterRole))
+		Expect(r.hostedClusterRole(nil)).To(Equal(DefaultHostedClusterRole))
+
+		hc.Annotations = map[string]string{hyperOpsClusterRoleAnnotation: "gitops-deployer"}
+		Expect(r.hostedClusterRole(hc)).To(Equal("gitops-deployer"))
+
+		hc.Annotations[hyperOpsClusterRoleAnnotation] = "../admin"
+		_, err := r.hostedClusterRole(hc)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should create the bundled role and replace the binding when the role changes", func() {
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(ensureServiceAccount(context.Background(), hosted, "1234", DefaultHostedClusterRole)).To(Succeed())
+		crb := &rbacv1.ClusterRoleBinding{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: hostedClusterServiceAccountName}, crb)).To(Succeed())
+		Expect(crb.RoleRef.Name).To(Equal(DefaultHostedClusterRole))
+
+		Expect(ensureServiceAccount(context.Background(), hosted, "1234", BundledHostedClusterRole)).To(Succeed())
+		role := &rbacv1.ClusterRole{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: BundledHostedClusterRole}, role)).To(Succeed())
+		Expect(role.Rules).To(Equal(bundledHostedClusterRoleRules))
+		Expect(role.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: hostedClusterServiceAccountName}, crb)).To(Succeed())
+		Expect(crb.RoleRef.Name).To(Equal(BundledHostedClusterRole))
+		Expect(crb.Subjects).To(HaveLen(1))
+		Expect(crb.Subjects[0].Name).To(Equal(hostedClusterServiceAccountName))
+	})
+
+	It("Should fail if a custom role does not exist in the hosted cluster", func() {
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(ensureServiceAccount(context.Background(), hosted, "1234", "gitops-deployer")).NotTo(Succeed())
+
+		Expect(hosted.Create(context.Background(), &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "gitops-deployer"}})).To(Succeed())
+		Expect(ensureServiceAccount(context.Background(), hosted, "1234", "gitops-deployer")).To(Succeed())
+		crb := &rbacv1.ClusterRoleBinding{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: hostedClusterServiceAccountName}, crb)).To(Succeed())
+		Expect(crb.RoleRef.Name).To(Equal("gitops-deployer"))
+	})
+})
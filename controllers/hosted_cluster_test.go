@@ -0,0 +1,105 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopstesting "github.com/cldmnky/hyper-ops/pkg/testing"
+)
+
+var _ = Describe("Registration against an in-memory hosted cluster", func() {
+	var (
+		ctx    = context.Background()
+		hc     *hypershiftv1beta1.HostedCluster
+		hosted *hyperopstesting.HostedCluster
+		r      *HyperOpsReconciler
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "1234"},
+		}
+		hosted = hyperopstesting.NewHostedCluster()
+		r = &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()}
+	})
+
+	register := func(cluster *Cluster) *corev1.Secret {
+		cluster.GitOpsNamespace = defaultGitOpsNamespace
+		Expect(r.createArgoCDClusterSecret(ctx, map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)).To(Succeed())
+		secret, _, err := hyperopstesting.GetClusterSecret(ctx, r.Client, client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"})
+		Expect(err).NotTo(HaveOccurred())
+		return secret
+	}
+
+	It("Should register the legacy service account token", func() {
+		cluster, err := r.setupClusterConfig(ctx, hosted.Client, hosted.Server, hc.Name, hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.verifyClusterToken(ctx, hosted.Client, cluster)).To(Succeed())
+
+		secret := register(cluster)
+		Expect(hyperopstesting.CheckClusterSecret(secret,
+			hyperopstesting.HasName("hosted"),
+			hyperopstesting.HasServer(hyperopstesting.DefaultServer),
+			hyperopstesting.HasLabel(managedByLabel, managedByValue),
+			hyperopstesting.AuthenticatesAgainst(hosted),
+		)).To(Succeed())
+	})
+
+	It("Should register a bound token and revoke the legacy token on migration", func() {
+		legacy, err := r.setupClusterConfig(ctx, hosted.Client, hosted.Server, hc.Name, hc)
+		Expect(err).NotTo(HaveOccurred())
+
+		r.BoundTokens = true
+		issuer := &tokenIssuer{clientset: hosted.Clientset, verify: hosted.VerifyToken, review: hosted.ReviewToken}
+		cluster, err := r.setupBoundTokenClusterConfig(ctx, hosted.Client, issuer, hosted.Server, hosted.CAData, hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Config.BearerToken).NotTo(Equal(legacy.Config.BearerToken))
+		Expect(hyperopstesting.CheckClusterSecret(register(cluster), hyperopstesting.AuthenticatesAgainst(hosted))).To(Succeed())
+
+		Expect(r.completeTokenMigration(ctx, hosted.Client, hc)).To(Succeed())
+		Expect(hosted.VerifyToken(ctx, legacy.Config.BearerToken)).NotTo(Succeed())
+		Expect(hosted.VerifyToken(ctx, cluster.Config.BearerToken)).To(Succeed())
+	})
+
+	It("Should revoke the token of an orphaned registration", func() {
+		cluster, err := r.setupClusterConfig(ctx, hosted.Client, hosted.Server, hc.Name, hc)
+		Expect(err).NotTo(HaveOccurred())
+		secret := register(cluster)
+		Expect(r.Client.Delete(ctx, hc)).To(Succeed())
+
+		o := &OrphanReaper{
+			Client:    r.Client,
+			newClient: func(*rest.Config) (client.Client, error) { return hosted.Client, nil },
+		}
+		orphans, err := o.Reap(ctx, metav1.Now().Time)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(HaveLen(1))
+		Expect(orphans[0].Revoked).To(BeTrue())
+		Expect(hyperopstesting.CheckClusterSecret(secret, hyperopstesting.AuthenticatesAgainst(hosted))).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,212 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/version"
+)
+
+// Every subsystem talks to the hub API server through its own client. The subsystem is part of the user agent, so the
+// audit log of the API server attributes the requests, and every client has its own client side rate limit, so e.g.
+// the garbage collection of a large fleet can't use up the budget of the registrations.
+
+const (
+	// HubSubsystemRegistrar writes the registrations, the reconciler and the managers of ArgoCD objects
+	HubSubsystemRegistrar = "registrar"
+	// HubSubsystemRotation renews bound tokens
+	HubSubsystemRotation = "rotation"
+	// HubSubsystemGC deletes orphaned, stale and soft deleted registrations
+	HubSubsystemGC = "gc"
+	// HubSubsystemHealth probes the ArgoCD instances
+	HubSubsystemHealth = "health"
+)
+
+// DefaultHubClientLimits are the rate limits of the subsystems without configured limits. The registrar keeps the
+// defaults of controller-runtime, the background subsystems get a smaller budget.
+var DefaultHubClientLimits = map[string]hyperopsv1alpha1.HubClientLimits{
+	HubSubsystemRegistrar: {Subsystem: HubSubsystemRegistrar, QPS: 20, Burst: 30},
+	HubSubsystemRotation:  {Subsystem: HubSubsystemRotation, QPS: 5, Burst: 10},
+	HubSubsystemGC:        {Subsystem: HubSubsystemGC, QPS: 5, Burst: 10},
+	HubSubsystemHealth:    {Subsystem: HubSubsystemHealth, QPS: 5, Burst: 10},
+}
+
+var hubAPIRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "hyperops_hub_api_requests_total",
+	Help: "Requests to the hub API server by subsystem and response code.",
+}, []string{"subsystem", "code"})
+
+func init() {
+	metrics.Registry.MustRegister(hubAPIRequests)
+}
+
+// DefaultHubUserAgent returns the default user agent of the hub clients, the subsystem is appended to it
+func DefaultHubUserAgent() string {
+	return "hyper-ops/" + version.Version
+}
+
+// HubSubsystemUserAgent returns the user agent of the hub client of the subsystem
+func HubSubsystemUserAgent(userAgent, subsystem string) string {
+	if userAgent == "" {
+		userAgent = DefaultHubUserAgent()
+	}
+	return fmt.Sprintf("%s (subsystem=%s)", userAgent, subsystem)
+}
+
+// ParseHubClientLimits parses a list of <subsystem>=<qps>[:<burst>] rate limits
+func ParseHubClientLimits(raw string) ([]hyperopsv1alpha1.HubClientLimits, error) {
+	limits := []hyperopsv1alpha1.HubClientLimits{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		subsystem, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid hub client limit %q, must be <subsystem>=<qps>[:<burst>]", entry)
+		}
+		limit := hyperopsv1alpha1.HubClientLimits{Subsystem: subsystem}
+		qps, burst, hasBurst := strings.Cut(value, ":")
+		var err error
+		if limit.QPS, err = strconv.ParseFloat(qps, 64); err != nil {
+			return nil, fmt.Errorf("invalid qps of hub client limit %q: %w", entry, err)
+		}
+		if hasBurst {
+			if limit.Burst, err = strconv.Atoi(burst); err != nil {
+				return nil, fmt.Errorf("invalid burst of hub client limit %q: %w", entry, err)
+			}
+		}
+		limits = append(limits, limit)
+	}
+	return limits, ValidateHubClientLimits(limits)
+}
+
+// ValidateHubClientLimits returns an error if a limit is for an unknown subsystem, isn't positive or is configured twice
+func ValidateHubClientLimits(limits []hyperopsv1alpha1.HubClientLimits) error {
+	seen := map[string]bool{}
+	for _, l := range limits {
+		if _, ok := DefaultHubClientLimits[l.Subsystem]; !ok {
+			return fmt.Errorf("unknown hub client subsystem %q, must be %s, %s, %s or %s", l.Subsystem,
+				HubSubsystemRegistrar, HubSubsystemRotation, HubSubsystemGC, HubSubsystemHealth)
+		}
+		if l.QPS <= 0 || l.Burst < 0 {
+			return fmt.Errorf("the hub client limit of %s must have a positive qps and burst", l.Subsystem)
+		}
+		if seen[l.Subsystem] {
+			return fmt.Errorf("duplicate hub client limit for %s", l.Subsystem)
+		}
+		seen[l.Subsystem] = true
+	}
+	return nil
+}
+
+// hubClientLimits returns the limits of the subsystem, the burst defaults to twice the QPS
+func hubClientLimits(limits []hyperopsv1alpha1.HubClientLimits, subsystem string) hyperopsv1alpha1.HubClientLimits {
+	limit := DefaultHubClientLimits[subsystem]
+	for _, l := range limits {
+		if l.Subsystem == subsystem {
+			limit = l
+		}
+	}
+	if limit.Burst == 0 {
+		limit.Burst = int(math.Ceil(2 * limit.QPS))
+	}
+	return limit
+}
+
+// HubClients are the clients of the subsystems for the hub API server
+type HubClients struct {
+	Registrar client.Client
+	Rotation  client.Client
+	GC        client.Client
+	// Health reads from the API server, the probed objects aren't watched
+	Health client.Reader
+}
+
+// NewHubClients returns the clients of the subsystems. Reads of the clients go to the cache unless it is nil, so only
+// writes and uncached reads count against the rate limits.
+func NewHubClients(config *rest.Config, c cache.Cache, options client.Options, userAgent string, limits []hyperopsv1alpha1.HubClientLimits) (*HubClients, error) {
+	if err := ValidateHubClientLimits(limits); err != nil {
+		return nil, err
+	}
+	newClient := func(subsystem string) (client.Client, error) {
+		subsystemConfig := hubRESTConfig(config, userAgent, subsystem, limits)
+		if c == nil {
+			return client.New(subsystemConfig, options)
+		}
+		return cluster.DefaultNewClient(c, subsystemConfig, options)
+	}
+	clients := &HubClients{}
+	var err error
+	if clients.Registrar, err = newClient(HubSubsystemRegistrar); err != nil {
+		return nil, err
+	}
+	if clients.Rotation, err = newClient(HubSubsystemRotation); err != nil {
+		return nil, err
+	}
+	if clients.GC, err = newClient(HubSubsystemGC); err != nil {
+		return nil, err
+	}
+	if clients.Health, err = client.New(hubRESTConfig(config, userAgent, HubSubsystemHealth, limits), options); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// hubRESTConfig returns a copy of the config with the user agent and rate limit of the subsystem
+func hubRESTConfig(config *rest.Config, userAgent, subsystem string, limits []hyperopsv1alpha1.HubClientLimits) *rest.Config {
+	limit := hubClientLimits(limits, subsystem)
+	subsystemConfig := rest.CopyConfig(config)
+	subsystemConfig.UserAgent = HubSubsystemUserAgent(userAgent, subsystem)
+	subsystemConfig.QPS = float32(limit.QPS)
+	subsystemConfig.Burst = limit.Burst
+	// the rate limiter of the copied config would be shared with the manager
+	subsystemConfig.RateLimiter = nil
+	subsystemConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &subsystemRoundTripper{subsystem: subsystem, next: rt}
+	})
+	return subsystemConfig
+}
+
+// subsystemRoundTripper counts the requests of a subsystem by response code
+type subsystemRoundTripper struct {
+	subsystem string
+	next      http.RoundTripper
+}
+
+func (rt *subsystemRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	hubAPIRequests.WithLabelValues(rt.subsystem, code).Inc()
+	return resp, err
+}
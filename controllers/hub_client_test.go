@@ -0,0 +1,92 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("Hub clients", func() {
+	It("Should parse the rate limits of the subsystems", func() {
+		limits, err := ParseHubClientLimits("gc=2:4, rotation=0.5")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(limits).To(Equal([]hyperopsv1alpha1.HubClientLimits{
+			{Subsystem: HubSubsystemGC, QPS: 2, Burst: 4},
+			{Subsystem: HubSubsystemRotation, QPS: 0.5},
+		}))
+
+		for _, raw := range []string{"gc", "gc=fast", "gc=2:many", "reaper=2", "gc=0", "gc=2,gc=3"} {
+			_, err := ParseHubClientLimits(raw)
+			Expect(err).To(HaveOccurred(), raw)
+		}
+	})
+
+	It("Should give every subsystem its own user agent and rate limit", func() {
+		limits := []hyperopsv1alpha1.HubClientLimits{{Subsystem: HubSubsystemGC, QPS: 0.5}}
+		cfg := hubRESTConfig(&rest.Config{Host: "https://hub.example.com", QPS: 20, Burst: 30}, "", HubSubsystemGC, limits)
+		Expect(cfg.UserAgent).To(Equal("hyper-ops/dev (subsystem=gc)"))
+		Expect(cfg.QPS).To(BeNumerically("==", 0.5))
+		Expect(cfg.Burst).To(Equal(1))
+
+		cfg = hubRESTConfig(&rest.Config{Host: "https://hub.example.com"}, "fleet-operator/v2", HubSubsystemRotation, limits)
+		Expect(cfg.UserAgent).To(Equal("fleet-operator/v2 (subsystem=rotation)"))
+		Expect(cfg.QPS).To(BeNumerically("==", 5))
+		Expect(cfg.Burst).To(Equal(10))
+	})
+
+	It("Should attribute the requests to the subsystem", func() {
+		var userAgent string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			userAgent = req.UserAgent()
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+		}))
+		defer srv.Close()
+
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+		clients, err := NewHubClients(&rest.Config{Host: srv.URL}, nil, client.Options{Scheme: scheme.Scheme, Mapper: mapper}, "", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		before := testutil.ToFloat64(hubAPIRequests.WithLabelValues(HubSubsystemHealth, "404"))
+		err = clients.Health.Get(context.Background(), client.ObjectKey{Name: "openshift-gitops"}, &corev1.Namespace{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(userAgent).To(Equal("hyper-ops/dev (subsystem=health)"))
+		Expect(testutil.ToFloat64(hubAPIRequests.WithLabelValues(HubSubsystemHealth, "404"))).To(Equal(before + 1))
+
+		namespace := &corev1.Namespace{}
+		namespace.Name = "openshift-gitops"
+		err = clients.GC.Delete(context.Background(), namespace)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(userAgent).To(Equal("hyper-ops/dev (subsystem=gc)"))
+	})
+})
@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/retry"
+)
+
+const (
+	// ConditionHubAPIUnhealthy is true when writes to the hub API keep timing out or failing with server errors
+	ConditionHubAPIUnhealthy = "HubAPIUnhealthy"
+
+	// HubAPIReasonTimeout is a request that timed out on the API server or on the way to it
+	HubAPIReasonTimeout = retry.ReasonTimeout
+	// HubAPIReasonWebhook is an admission webhook that timed out or could not be reached
+	HubAPIReasonWebhook = retry.ReasonWebhook
+	// HubAPIReasonThrottled is a request rejected by API priority and fairness
+	HubAPIReasonThrottled = retry.ReasonThrottled
+	// HubAPIReasonServerError is any other 5xx response of the API server
+	HubAPIReasonServerError = retry.ReasonServerError
+)
+
+// HubAPIError is returned when a write to the hub API still failed with a transient error after the retries
+type HubAPIError struct {
+	Reason   string
+	Attempts int
+	Err      error
+}
+
+func (e *HubAPIError) Error() string {
+	return fmt.Sprintf("hub API unhealthy (%s) after %d attempts: %s", e.Reason, e.Attempts, e.Err)
+}
+
+func (e *HubAPIError) Unwrap() error {
+	return e.Err
+}
+
+// reportHubAPIHealth records in the HubAPIUnhealthy registration condition whether the write failed because of
+// the hub API. A healthy hub is only recorded on HostedClusters that reported an unhealthy one before.
+func (r *HyperOpsReconciler) reportHubAPIHealth(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, err error) {
+	condition := metav1.Condition{
+		Type:    ConditionHubAPIUnhealthy,
+		Status:  metav1.ConditionFalse,
+		Reason:  "HubAPIHealthy",
+		Message: "the hub API accepted the registration",
+	}
+	var hubErr *HubAPIError
+	switch {
+	case errors.As(err, &hubErr):
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionTrue, hubErr.Reason, hubErr.Error()
+	case err != nil:
+		// other errors say nothing about the health of the hub
+		return
+	case meta.FindStatusCondition(registrationConditions(hc), ConditionHubAPIUnhealthy) == nil:
+		return
+	}
+	// the condition is written through the same struggling hub, failing to record it must not hide the write error
+	if cerr := r.setRegistrationCondition(ctx, hc, condition); cerr != nil {
+		log.FromContext(ctx).V(3).Error(cerr, "unable to record the hub API health")
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/retry"
+)
+
+// failingClient fails the first creates with the error
+type failingClient struct {
+	client.Client
+	err      error
+	failures int
+}
+
+func (f *failingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if f.failures > 0 {
+		f.failures--
+		return f.err
+	}
+	return f.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("Hub API health", func() {
+	var backoff wait.Backoff
+	var timeout time.Duration
+	secretsResource := schema.GroupResource{Resource: "secrets"}
+	webhookErr := apierrors.NewInternalError(errors.New(`failed calling webhook "validate.example.com": context deadline exceeded`))
+
+	BeforeEach(func() {
+		backoff, timeout = hubAPIBackoff, hubAPIRetryTimeout
+		hubAPIBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3}
+		hubAPIRetryTimeout = time.Second
+	})
+
+	AfterEach(func() {
+		hubAPIBackoff, hubAPIRetryTimeout = backoff, timeout
+	})
+
+	It("Should classify hub API errors", func() {
+		for err, reason := range map[error]string{
+			webhookErr: HubAPIReasonWebhook,
+			apierrors.NewServerTimeout(secretsResource, "create", 1): HubAPIReasonTimeout,
+			apierrors.NewTimeoutError("request timed out", 1):        HubAPIReasonTimeout,
+			apierrors.NewTooManyRequests("slow down", 1):             HubAPIReasonThrottled,
+			apierrors.NewServiceUnavailable("unavailable"):           HubAPIReasonServerError,
+		} {
+			got, ok := retry.Classify(err)
+			Expect(ok).To(BeTrue(), err.Error())
+			Expect(got).To(Equal(reason))
+		}
+		_, ok := retry.Classify(apierrors.NewForbidden(secretsResource, "hosted", errors.New("denied")))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should retry transient hub API errors", func() {
+		c := &failingClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), err: webhookErr, failures: 2}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace}}
+		_, err := CreateOrUpdateWithRetries(context.Background(), c, secret, func() error { return nil })
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should give up on a persistently unhealthy hub API", func() {
+		c := &failingClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), err: webhookErr, failures: 10}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace}}
+		_, err := CreateOrUpdateWithRetries(context.Background(), c, secret, func() error { return nil })
+		var hubErr *HubAPIError
+		Expect(errors.As(err, &hubErr)).To(BeTrue())
+		Expect(hubErr.Reason).To(Equal(HubAPIReasonWebhook))
+		Expect(hubErr.Attempts).To(Equal(3))
+		Expect(apierrors.IsInternalError(err)).To(BeTrue())
+	})
+
+	It("Should not retry other errors", func() {
+		c := &failingClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), err: apierrors.NewBadRequest("invalid"), failures: 1}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace}}
+		_, err := CreateOrUpdateWithRetries(context.Background(), c, secret, func() error { return nil })
+		Expect(apierrors.IsBadRequest(err)).To(BeTrue())
+		Expect(c.failures).To(BeZero())
+	})
+
+	It("Should not blame the hub for an unhealthy hosted cluster API", func() {
+		backoff, timeout := hostedClusterAPIBackoff, hostedClusterAPIRetryTimeout
+		defer func() { hostedClusterAPIBackoff, hostedClusterAPIRetryTimeout = backoff, timeout }()
+		hostedClusterAPIBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 2}
+		hostedClusterAPIRetryTimeout = time.Second
+
+		c := &failingClient{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), err: webhookErr, failures: 10}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-admin", Namespace: "kube-system"}}
+		_, err := CreateOrUpdateWithPolicy(context.Background(), hostedClusterRetryPolicy(), c, sa, func() error { return nil })
+		var retryErr *retry.Error
+		Expect(errors.As(err, &retryErr)).To(BeTrue())
+		Expect(retryErr.Policy).To(Equal("hosted cluster"))
+		Expect(retryErr.Attempts).To(Equal(2))
+		var hubErr *HubAPIError
+		Expect(errors.As(err, &hubErr)).To(BeFalse())
+	})
+
+	It("Should report an unhealthy hub API and its recovery", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		r.reportHubAPIHealth(context.Background(), hc, nil)
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionHubAPIUnhealthy)).To(BeNil())
+
+		r.reportHubAPIHealth(context.Background(), hc, &HubAPIError{Reason: HubAPIReasonTimeout, Attempts: 6, Err: errors.New("timeout")})
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionHubAPIUnhealthy)).To(BeTrue())
+
+		r.reportHubAPIHealth(context.Background(), hc, errors.New("unrelated"))
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionHubAPIUnhealthy)).To(BeTrue())
+
+		r.reportHubAPIHealth(context.Background(), hc, nil)
+		Expect(meta.IsStatusConditionFalse(registrationConditions(hc), ConditionHubAPIUnhealthy)).To(BeTrue())
+	})
+})
@@ -18,20 +18,33 @@ package controllers
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
-	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	"github.com/kubernetes-client/go-base/config/api"
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+	"github.com/cldmnky/hyper-ops/pkg/regproxy"
 	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
 
 	corev1 "k8s.io/api/core/v1"
@@ -42,139 +55,444 @@ import (
 const (
 	hyperOpsLabel = "hyper-ops.cloudmonkey.org"
 
-	argoCDSecretTypeLabel   = "argocd.argoproj.io/secret-type"
-	argoCDSecretTypeCluster = "cluster"
+	argoCDSecretTypeLabel   = argocd.SecretTypeLabel
+	argoCDSecretTypeCluster = argocd.SecretTypeCluster
+
+	// HostedClusterAnnotation holds the <namespace>/<name> of the HostedCluster on its ArgoCD cluster secrets
+	HostedClusterAnnotation = "hyper-ops.cloudmonkey.org/hosted-cluster"
+
+	hyperOpsUnmanageAnnotation               = "hyper-ops.cloudmonkey.org/unmanage"
+	hyperOpsHostedClusterAnnotation          = HostedClusterAnnotation
+	hyperOpsLastRegistrationChangeAnnotation = "hyper-ops.cloudmonkey.org/last-registration-change"
+
+	defaultGitOpsNamespace = "openshift-gitops"
 
 	hostedClusterServiceAccountName      = "hyper-ops-admin"
 	hostedClusterServiceAccountNamespace = "kube-system"
 )
 
+const (
+	// DefaultEnrollmentEnabled registers every HostedCluster unless it is labeled enabled=false
+	DefaultEnrollmentEnabled = "enabled"
+	// DefaultEnrollmentDisabled only registers HostedClusters labeled enabled=true
+	DefaultEnrollmentDisabled = "disabled"
+)
+
 var (
 	hyperOpsEnabledLabel         = fmt.Sprintf("%s/enabled", hyperOpsLabel)
 	hyperOpsGitopsNamespaceLabel = fmt.Sprintf("%s/gitops-namespace", hyperOpsLabel)
-	gitOpsNamespace              = "openshift-gitops"
+
+	// mirroredHostedClusterConditions are the HostedCluster conditions mirrored as annotations on the ArgoCD cluster secret
+	mirroredHostedClusterConditions = []hypershiftv1beta1.ConditionType{
+		hypershiftv1beta1.HostedClusterAvailable,
+		hypershiftv1beta1.HostedClusterDegraded,
+		hypershiftv1beta1.HostedClusterProgressing,
+		hypershiftv1beta1.ClusterVersionSucceeding,
+	}
 )
 
+// Cluster is an ArgoCD cluster registration, backed by a HostedCluster for hosted clusters
 type Cluster struct {
-	Name          string        `json:"name"`
-	Server        string        `json:"server"`
-	Config        ClusterConfig `json:"clusterConfig"`
+	argocd.Cluster
 	HostedCluster *hypershiftv1beta1.HostedCluster
+	// TokenExpiresAt is the expiration of the bearer token, zero for tokens of legacy service account token secrets
+	TokenExpiresAt time.Time
+	// PolicyLabels are the labels added by the registration policies, used to attribute label changes
+	PolicyLabels map[string]string
+	// TokenIssuedAt is the time the bound token was issued, zero for reused and legacy tokens
+	TokenIssuedAt time.Time
+	// APICertificateExpiresAt is the notAfter of the serving certificate of the API server, zero if it wasn't probed
+	APICertificateExpiresAt time.Time
+	// ArgoCDName is the name of the cluster in ArgoCD if it differs from the name of the ArgoCD cluster secret
+	ArgoCDName string
+	// KubeconfigContext is the context of the admin kubeconfig the registration was resolved from, empty for the
+	// current context
+	KubeconfigContext string
+	// DestinationProjects are the AppProjects whose destinations are kept in sync with the registration
+	DestinationProjects []string
+	// LabelSchema is the schema the registrars write the hyper-ops labels in
+	LabelSchema LabelSchema
+	// GitOpsNamespace is the gitops namespace the registration is written to, copies in additional gitops
+	// namespaces refer to the secret in this namespace
+	GitOpsNamespace string
 }
 
-type ClusterConfig struct {
-	BearerToken     string          `json:"bearerToken"`
-	TLSClientConfig TLSClientConfig `json:"tlsClientConfig"`
-}
-type TLSClientConfig struct {
-	CAData string `json:"caData"`
+// SecretData returns the data of the ArgoCD cluster secret, named ArgoCDName if it is set
+func (c *Cluster) SecretData() (map[string][]byte, error) {
+	cluster := c.Cluster
+	if c.ArgoCDName != "" {
+		cluster.Name = c.ArgoCDName
+	}
+	return cluster.SecretData()
 }
 
 // ConfigReconciler reconciles a Config object
 type HyperOpsReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// DefaultEnrollment decides whether HostedClusters without the enabled label are registered,
+	// one of DefaultEnrollmentDisabled (default, opt-in) or DefaultEnrollmentEnabled (opt-out)
+	DefaultEnrollment string
+	// AllowedGitOpsNamespaces restricts the gitops namespaces registrations may be written to, all namespaces are
+	// allowed if empty
+	AllowedGitOpsNamespaces []string
+	// GitOpsNamespaceRoutes routes HostedClusters without the gitops namespace label by their labels
+	GitOpsNamespaceRoutes GitOpsNamespaceRoutes
+	// DuplicateServerWinner selects which HostedCluster keeps a server URL registered by several HostedClusters,
+	// one of DuplicateServerWinnerOldest (default) or DuplicateServerWinnerNewest
+	DuplicateServerWinner string
+	// LocalClusterInCluster registers the management cluster without credentials, ArgoCD connects with its own
+	// service account instead of a token of hyper-ops
+	LocalClusterInCluster bool
+	// HostedClusterRole is the ClusterRole bound to the service account of hyper-ops in the hosted clusters,
+	// DefaultHostedClusterRole if empty. The cluster role annotation of a HostedCluster overrides it.
+	HostedClusterRole string
+	// TenantScopedClusters scopes the ArgoCD clusters of HostedClusters with tenant groups to their tenant project,
+	// the project annotation of a HostedCluster overrides it
+	TenantScopedClusters bool
+	// ClusterAppProjects creates an AppProject deploying only to the registered cluster per HostedCluster (cluster) or
+	// per tenant project (tenant), none if empty
+	ClusterAppProjects string
+	// Shards is the number of application controller shards the ArgoCD clusters are spread over, the application
+	// controller assigns the shards if 0. The shard label of a HostedCluster overrides it.
+	Shards int
+	// ClusterResources lets ArgoCD manage cluster scoped resources of namespace scoped clusters. The cluster-resources
+	// annotation of a HostedCluster overrides it.
+	ClusterResources bool
+	// AuthMode decides how ArgoCD authenticates to the hosted clusters, AuthModeServiceAccount if empty. The auth mode
+	// annotation of a HostedCluster overrides it.
+	AuthMode string
+	// AWSRoleName is the IAM role argocd-k8s-auth assumes in the account of a HostedCluster with
+	// AuthModeAWSExecProvider, the identity of the ArgoCD pods is used if empty
+	AWSRoleName string
+	// ClusterNameSource decides the name of the ArgoCD clusters, one of ClusterNameSourceName (default),
+	// ClusterNameSourceInfraID or ClusterNameSourceTemplate
+	ClusterNameSource string
+	// ClusterNameTemplate renders the name of the ArgoCD clusters with ClusterNameSourceTemplate
+	ClusterNameTemplate *template.Template
+	// TerminalStatePolicy decides how HostedClusters in a terminal failure state are handled, one of
+	// TerminalStatePolicyRetry (default), TerminalStatePolicySkip or TerminalStatePolicyDeregister
+	TerminalStatePolicy string
+	// UpgradePolicy decides how GitOps treats HostedClusters rolling out a new release, one of UpgradePolicyIgnore
+	// (default), UpgradePolicyFlag or UpgradePolicyPause
+	UpgradePolicy string
+	// SecretConflictPolicy decides what happens to an existing ArgoCD cluster secret not created by hyper-ops, one of
+	// SecretConflictPolicySkip (default), SecretConflictPolicyFail or SecretConflictPolicyAdopt
+	SecretConflictPolicy string
+	// TerminalStateTimeout is the time a HostedCluster may be in a terminal state before TerminalStatePolicyDeregister
+	// removes its registration
+	TerminalStateTimeout time.Duration
+	// RefreshQPS limits the rate at which steady state refreshes of healthy registrations are processed
+	RefreshQPS float64
+	// MaxConcurrentRefreshes is the number of concurrent steady state refreshes
+	MaxConcurrentRefreshes int
+	// HostedClusterHeaders are added to every request hyper-ops makes against a hosted cluster, e.g. to tag the
+	// requests for an audit webhook
+	HostedClusterHeaders map[string]string
+	// DiscoveryLabels are added to the ArgoCD cluster secrets by gitops namespace, for ArgoCD distributions that
+	// discover clusters through additional labels. DiscoveryLabelsAllNamespaces applies to every namespace.
+	DiscoveryLabels map[string]map[string]string
+	// DeletionGracePeriod keeps deregistered ArgoCD cluster secrets, hidden from ArgoCD, for the period before they
+	// are deleted. Zero deletes them immediately.
+	DeletionGracePeriod time.Duration
+	// EgressNetworkPolicies maintains NetworkPolicies allowing the ArgoCD pods to reach the registered hosted clusters
+	EgressNetworkPolicies bool
+	// ClusterRegistrations maintains a ClusterRegistration recording the registration of every enrolled HostedCluster
+	ClusterRegistrations bool
+	// OffboardHostedRBAC also removes the service account of hyper-ops from hosted clusters labeled enabled=false
+	OffboardHostedRBAC bool
+	// Quotas cap the number of registered HostedClusters per namespace or team label
+	Quotas []hyperopsv1alpha1.RegistrationQuota
+	// Recorder emits events on the HostedClusters, no events are emitted if nil
+	Recorder record.EventRecorder
+	// TenantRBAC maintains ArgoCD RBAC policies granting the tenant groups of a HostedCluster access to its
+	// Applications
+	TenantRBAC bool
+	// AgentPrincipalAddress is the host:port of the principal the agents of outbound-only HostedClusters dial
+	AgentPrincipalAddress string
+	// AgentResourceProxyServer is the URL of the resource proxy of the principal, ArgoCD reaches outbound-only
+	// HostedClusters through it
+	AgentResourceProxyServer string
+	// AgentImage is the image of the agent installed into outbound-only HostedClusters
+	AgentImage string
+	// PrivateClusterConnectivity is the connectivity of HostedClusters with private endpoint access and without a
+	// connectivity annotation, outbound-only registers them through agents
+	PrivateClusterConnectivity string
+	// Policies are organizational rules evaluated before a registration is written, they may add labels or veto the
+	// registration
+	Policies []*RegistrationPolicy
+	// APIReader reads objects hyper-ops doesn't watch, e.g. the ArgoCD deployments, the client is used if nil
+	APIReader client.Reader
+	// HealthReader reads the ArgoCD instances probed for their version and health, the APIReader is used if nil
+	HealthReader client.Reader
+	// RegistrationProxy, when set, is used to write the ArgoCD cluster secrets instead of the local client
+	RegistrationProxy *regproxy.Client
+	// RemoteHub, when set, writes the ArgoCD cluster secrets to the hub cluster running ArgoCD instead of the local
+	// client, it is ignored if RegistrationProxy is set
+	RemoteHub *RemoteHub
+	// BoundTokens registers hosted clusters with TokenRequest issued tokens and migrates registrations from the
+	// legacy service account token secret, without it the deprecated legacy token secrets are used
+	BoundTokens bool
+	// TokenTTL is the requested lifetime of bound tokens, 24 hours if zero
+	TokenTTL time.Duration
+	// TokenRenewBefore is the remaining lifetime at which bound tokens are renewed, 8 hours if zero
+	TokenRenewBefore time.Duration
+	// MaxCredentialAge is the age at which the credential of a registration is flagged, disabled if zero
+	MaxCredentialAge time.Duration
+	// QuarantineStaleCredentials withdraws registrations whose credential exceeded MaxCredentialAge until a newer
+	// credential is obtained
+	QuarantineStaleCredentials bool
+	// TokenRotations queues the registrations the TokenRotator found due for renewal
+	TokenRotations <-chan event.GenericEvent
+	// TokenAudiences are the consumers besides ArgoCD getting bound tokens of their own audience, requires BoundTokens
+	TokenAudiences []hyperopsv1alpha1.TokenAudience
+	// CIOutputs write the credentials of the registrations as kubeconfig secrets for CI systems on the management
+	// cluster
+	CIOutputs []hyperopsv1alpha1.CIOutput
+	// Registrars register the clusters with GitOps tools besides ArgoCD, e.g. Flux or Rancher Fleet
+	Registrars []Registrar
+	// TopologyLabels adds labels summarizing the NodePools and node architectures of hosted clusters to their
+	// ArgoCD cluster secrets
+	TopologyLabels bool
+	// WorkersLabel adds a label telling whether the NodePools of hosted clusters have nodes yet to their ArgoCD cluster
+	// secrets
+	WorkersLabel bool
+	// Bootstrap is the source of the root Application created for every registered cluster, none if the repository
+	// is empty
+	Bootstrap BootstrapApplication
+	// Standalone configures the ArgoCD installed into HostedClusters annotated with the standalone gitops mode
+	Standalone StandaloneGitOps
+	// BaselineManifests are applied into every hosted cluster right after its registration
+	BaselineManifests BaselineManifests
+	// Archive keeps the full change histories of the registrations outside of etcd, only the last changes are kept
+	// on the ArgoCD cluster secrets. The histories are only kept on the secrets if nil.
+	Archive archive.Store
+	// InfraClusterName is the name of the management cluster, used in the topology labels of KubeVirt hosted clusters
+	// whose VMs run on the management cluster
+	InfraClusterName string
+	// ArgoCDDiscovery registers HostedClusters selecting ArgoCD instances into the namespaces of the matching
+	// instances, nil without discovery
+	ArgoCDDiscovery *ArgoCDInstanceDiscovery
+	// HostedClients keeps the clients of hosted clusters alive between reconciles, a client is created per reconcile
+	// if nil
+	HostedClients *HostedClientPool
+	// DryRun only records the changes to ArgoCD cluster secrets and HostedClusters instead of writing them, see
+	// DryRunReport
+	DryRun bool
+	// LabelSchema is the schema of the hyper-ops labels written to the ArgoCD cluster secrets and by the registrars,
+	// labels of every schema are read from the HostedClusters
+	LabelSchema LabelSchema
+	// FreezeNamespace is the namespace of the freeze ConfigMap, which keeps the reconciler in dry-run mode until the
+	// freeze expires. The freeze is disabled if empty.
+	FreezeNamespace string
+
+	locks   keyLocks
+	tracker registrationTracker
+	dryRun  dryRunRecorder
+	freeze  freezeState
+	// capabilities are the detected ArgoCD capabilities by gitops namespace
+	capabilities capabilitiesCache
+	// argoCDInstances are the detected ArgoCD instances by gitops namespace
+	argoCDInstances argoCDInstanceCache
+	// configMu guards the hot reloadable settings, reconciles hold it for reading
+	configMu sync.RWMutex
+	// verifyToken checks a token before it is written, a TokenReview against the cluster if nil
+	verifyToken func(ctx context.Context, c client.Client, token string) error
+	// probeCertificate returns the expiry of the API server certificate, a TLS handshake with the server if nil
+	probeCertificate func(ctx context.Context, config *rest.Config) (time.Time, error)
 }
 
-// +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters,verbs=get;list;watch
+// +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=hypershift.openshift.io,resources=hostedclusters/finalizers,verbs=update
+// +kubebuilder:rbac:groups=hypershift.openshift.io,resources=nodepools,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingadmissionpolicies;validatingadmissionpolicybindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hyper-ops.cloudmonkey.org,resources=clusterregistrations,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=hyper-ops.cloudmonkey.org,resources=clusterregistrations/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=argoproj.io,resources=applications,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=argoproj.io,resources=appprojects,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=argoproj.io,resources=argocds,verbs=get;list
+// +kubebuilder:rbac:groups=argoproj.io,resources=applicationsets,verbs=get;list;create;update;patch
+// +kubebuilder:rbac:groups=source.toolkit.fluxcd.io,resources=gitrepositories,verbs=get;list;create;update;patch;delete
+// +kubebuilder:rbac:groups=kustomize.toolkit.fluxcd.io,resources=kustomizations,verbs=get;list;create;update;patch;delete
+// +kubebuilder:rbac:groups=fleet.cattle.io,resources=clusters;clusterregistrationtokens,verbs=get;list;create;update;patch;delete
+// +kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclusters,verbs=get;list;create;update;patch;delete
+// +kubebuilder:rbac:groups=cluster.open-cluster-management.io,resources=managedclustersets/join,verbs=create
 func (r *HyperOpsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	unlock := r.locks.lock(req.String())
+	defer unlock()
+	r.configMu.RLock()
+	defer r.configMu.RUnlock()
+	r.refreshFreeze(ctx)
+	result, err := r.reconcileHostedCluster(ctx, req)
+	// failed registrations are handled by the registration controller until they succeed again
+	if err != nil {
+		r.tracker.markPending(req.NamespacedName)
+	} else {
+		r.tracker.markHealthy(req.NamespacedName)
+	}
+	return r.requeueAfterFreeze(result), err
+}
+
+func (r *HyperOpsReconciler) reconcileHostedCluster(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
 	hc := &hypershiftv1beta1.HostedCluster{}
 	if err := r.Get(ctx, req.NamespacedName, hc); err != nil {
 		log.V(3).Error(err, "unable to fetch HostedCluster")
+		if apierrors.IsNotFound(err) {
+			forgetAPICertificateExpiry(req.NamespacedName)
+			forgetCredentialAge(req.NamespacedName)
+			forgetClusterInfo(req.NamespacedName)
+			r.forgetHostedClient(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
-	// TODO: Handle deletion
+	log = log.WithValues("correlationID", correlationID(hc))
+	ctx = ctrl.LoggerInto(ctx, log)
+	// check if the hostedcluster has defined the gitops namespace
+	if _, ok := hostedClusterLabel(hc, hyperOpsGitopsNamespaceLabel); !ok {
+		log.V(3).Info("HostedCluster does not have the gitops namespace label, using default namespace: openshift-gitops")
+	}
+	// the namespace is resolved for this reconcile only, concurrent reconciles of other HostedClusters resolve their own
+	gitOpsNamespace := hostedClusterGitOpsNamespace(hc, r.GitOpsNamespaceRoutes)
+	// HostedClusters selecting ArgoCD instances are registered into the namespace of the first matching instance
+	discovered, selected, discoveryErr := r.ArgoCDDiscovery.Targets(hc)
+	if len(discovered) > 0 {
+		gitOpsNamespace = discovered[0]
+	}
+	// hand the artifacts over to manual management, the secret is kept but no longer tracked
+	if hc.GetAnnotations()[hyperOpsUnmanageAnnotation] == "true" {
+		log.V(3).Info("HostedCluster has the unmanage annotation set, releasing the argocd cluster secret")
+		if err := r.releaseArgoCDClusterSecret(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: req.Name}); err != nil {
+			log.V(3).Error(err, "unable to release argocd cluster secret")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.removeFinalizer(ctx, hc)
+	}
+	// the finalizer keeps the HostedCluster until its registration is cleaned up
 	if hc.DeletionTimestamp != nil {
 		log.Info("HostedCluster is being deleted")
-		// cleanup secret
-		if err := r.Delete(ctx, &corev1.Secret{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      req.Name,
-				Namespace: gitOpsNamespace,
-			},
-		}); err != nil {
-			return ctrl.Result{}, client.IgnoreNotFound(err)
+		forgetAPICertificateExpiry(req.NamespacedName)
+		forgetCredentialAge(req.NamespacedName)
+		forgetClusterInfo(req.NamespacedName)
+		if err := r.removeRegistration(ctx, hc, gitOpsNamespace); err != nil {
+			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.removeFinalizer(ctx, hc)
 	}
-	// check if the hostedcluster has defined the gitops namespace
-	if _, ok := hc.GetLabels()[hyperOpsGitopsNamespaceLabel]; !ok {
-		log.V(3).Info("HostedCluster does not have the gitops namespace label, using default namespace: openshift-gitops")
-	} else {
-		gitOpsNamespace = hc.GetLabels()[hyperOpsGitopsNamespaceLabel]
+	if stop, err := r.reportDiscoveredArgoCDInstances(ctx, hc, discovered, selected, discoveryErr); stop || err != nil {
+		return ctrl.Result{}, err
+	}
+	if !gitOpsNamespaceAllowed(gitOpsNamespace, r.AllowedGitOpsNamespaces) {
+		log.Info("gitops namespace is not allowed", "namespace", gitOpsNamespace)
+		return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionGitOpsNamespaceReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NamespaceNotAllowed",
+			Message: fmt.Sprintf("gitops namespace %s is not one of the allowed namespaces %s", gitOpsNamespace, strings.Join(r.AllowedGitOpsNamespaces, ", ")),
+		})
+	}
+	// wait for the gitops namespace, the namespace watch triggers a new reconcile once it is created
+	if r.remoteRegistrations() == nil {
+		ns := &corev1.Namespace{}
+		if err := r.Get(ctx, client.ObjectKey{Name: gitOpsNamespace}, ns); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+			log.Info("gitops namespace does not exist, waiting for it to be created", "namespace", gitOpsNamespace)
+			return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+				Type:    ConditionGitOpsNamespaceReady,
+				Status:  metav1.ConditionFalse,
+				Reason:  "NamespaceNotFound",
+				Message: fmt.Sprintf("gitops namespace %s does not exist", gitOpsNamespace),
+			})
+		}
+		if err := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionGitOpsNamespaceReady,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NamespaceFound",
+			Message: fmt.Sprintf("gitops namespace %s exists", gitOpsNamespace),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
-	// create the service account for the local cluster
-	localCluster, err := r.setupClusterConfig(ctx, r.Client, "https://kubernetes.default.svc", "in-cluster-local", nil)
+	// register the local cluster, with the token of a service account or the in-cluster config of ArgoCD
+	localCluster, err := r.localCluster(ctx)
 	if err != nil {
 		log.V(3).Error(err, "unable to create in-cluster config")
 		return ctrl.Result{}, err
 	}
+	localCluster.GitOpsNamespace = gitOpsNamespace
 
 	localClusterLabels := map[string]string{
-		"hyper-ops.cloudmonkey.org/type": "local",
+		hyperOpsTypeLabel: "local",
 	}
 
-	if err := r.createArgoCDClusterSecret(ctx, localClusterLabels, localCluster); err != nil {
+	// a skipped conflict of the in-cluster secret does not hold back the hosted cluster
+	if err := ignoreSkippedConflict(r.createArgoCDClusterSecret(ctx, localClusterLabels, localCluster)); err != nil {
 		log.V(3).Error(err, "unable to create in-cluster argocd cluster secret")
 		return ctrl.Result{}, err
 	}
 
-	// skip if the hosted cluster sets the label to false
-	if enabled, ok := hc.GetLabels()[hyperOpsEnabledLabel]; ok && enabled == "false" {
-		log.V(3).Info("HostedCluster have the hyper-ops enabled label set to false")
-		return ctrl.Result{}, nil
-	}
-	// get the kubeconfig for the hosted cluster
-	kubeConfigSecret := &corev1.Secret{}
-	if err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: fmt.Sprintf("%s-admin-kubeconfig", req.Name)}, kubeConfigSecret); err != nil {
-		log.V(3).Error(err, "unable to fetch kubeconfig secret")
-		return ctrl.Result{}, client.IgnoreNotFound(err)
-	}
-	hostedClusterClient, err := GetClientForCluster(kubeConfigSecret.Data["kubeconfig"])
-	if err != nil {
-		log.V(3).Error(err, "unable to create hosted cluster client")
-		return ctrl.Result{}, err
+	// skip if the hosted cluster sets the label to false, or is not labeled and enrollment is opt-in
+	if !hostedClusterEnrolled(hc, r.DefaultEnrollment) {
+		log.V(3).Info("HostedCluster is not enrolled", "enabledLabel", canonicalLabels(hc.GetLabels())[hyperOpsEnabledLabel], "defaultEnrollment", r.DefaultEnrollment)
+		// flipping the enabled label to false offboards a registered HostedCluster
+		offboard, err := r.offboardingRequired(ctx, hc, gitOpsNamespace)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if offboard {
+			return ctrl.Result{}, r.offboard(ctx, hc, gitOpsNamespace)
+		}
+		forgetClusterInfo(req.NamespacedName)
+		return ctrl.Result{}, r.removeClusterRegistration(ctx, hc)
 	}
-
-	server, err := r.getServerFromKubeConfig(kubeConfigSecret)
-	if err != nil {
-		log.V(3).Error(err, "unable to get server from kubeconfig")
-		return ctrl.Result{}, err
+	if err := r.ensureFinalizer(ctx, hc); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to add the cleanup finalizer: %w", err)
 	}
-
-	hostedClusterConfig, err := r.setupClusterConfig(ctx, hostedClusterClient, server, hc.Name, hc)
-	if err != nil {
-		log.V(3).Error(err, "unable to create hosted cluster config")
-		return ctrl.Result{}, err
+	// clusters that will never come up are handled by the terminal state policy
+	if stop, result, err := r.handleTerminalState(ctx, hc, gitOpsNamespace); stop || err != nil {
+		return result, err
 	}
-
-	hostedClusterLabels := hc.GetLabels()
-	// only keep the labels that are related to hyper-ops
-	for k := range hostedClusterLabels {
-		if !strings.HasPrefix(k, hyperOpsLabel) {
-			delete(hostedClusterLabels, k)
-		}
+	// standalone clusters run their own ArgoCD and are not registered with the hub
+	if standalone(hc) {
+		return r.reconcileStandalone(ctx, hc, gitOpsNamespace, hostedClusterLabels(hc))
 	}
-	hostedClusterLabels["hyper-ops.cloudmonkey.org/type"] = "hosted"
-
-	if err := r.createArgoCDClusterSecret(ctx, hostedClusterLabels, hostedClusterConfig); err != nil {
-		log.V(3).Error(err, "unable to create argocd cluster secret")
-		return ctrl.Result{}, err
+	// the hub can't reach clusters with outbound-only connectivity, they are registered through an agent
+	if r.outboundOnly(hc) {
+		return r.reconcileAgent(ctx, hc, gitOpsNamespace, hostedClusterLabels(hc))
 	}
-	return ctrl.Result{}, nil
+	return r.runPhases(ctx, hc, gitOpsNamespace, r.registrationPhases())
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *HyperOpsReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&hypershiftv1beta1.HostedCluster{}).
-		WithEventFilter(predicate.Funcs{
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&hypershiftv1beta1.HostedCluster{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: func(e event.UpdateEvent) bool {
-				if _, ok := e.ObjectNew.GetLabels()[hyperOpsEnabledLabel]; !ok {
+				if !r.watched(e.ObjectNew) {
+					return false
+				}
+				// deletions are cleaned up right away, also for healthy registrations
+				if e.ObjectNew.GetDeletionTimestamp() != nil {
+					return true
+				}
+				// so are the start and the end of a release rollout, the upgrade policy may hold GitOps back
+				if hostedClusterRollout(e.ObjectOld.(*hypershiftv1beta1.HostedCluster)) !=
+					hostedClusterRollout(e.ObjectNew.(*hypershiftv1beta1.HostedCluster)) {
+					return true
+				}
+				// healthy registrations are refreshed through the throttled refresh controller
+				if r.tracker.isHealthy(client.ObjectKeyFromObject(e.ObjectNew)) {
 					return false
 				}
 				mgr.GetLogger().Info("watching", e.ObjectNew.GetObjectKind().GroupVersionKind().String(), e.ObjectNew.GetName())
@@ -182,41 +500,239 @@ func (r *HyperOpsReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return true
 			},
 			CreateFunc: func(e event.CreateEvent) bool {
-				if _, ok := e.Object.GetLabels()[hyperOpsEnabledLabel]; !ok {
+				if !r.watched(e.Object) {
 					return false
 				}
 				mgr.GetLogger().Info("watching", e.Object.GetObjectKind().GroupVersionKind().String(), e.Object.GetName())
 				return true
 			},
-		}).
+		})).
 		Owns(&corev1.Secret{}).
-		Complete(r)
+		// rotated client certificates are picked up as soon as the referenced secret changes
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForClientCertificate),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.(*corev1.Secret).Type == corev1.SecretTypeTLS
+			}))).
+		// additional CA bundles are picked up as soon as the referenced configmap or secret changes
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForCABundle)).
+		// creating, changing or deleting the freeze takes effect on all registrations
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForFreeze)).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForCABundle),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.(*corev1.Secret).Type == corev1.SecretTypeOpaque
+			}))).
+		// registrations waiting for their gitops namespace are retried once it is created
+		Watches(&source.Kind{Type: &corev1.Namespace{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClustersForNamespace),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(e event.CreateEvent) bool { return true },
+				UpdateFunc:  func(e event.UpdateEvent) bool { return false },
+				DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+				GenericFunc: func(e event.GenericEvent) bool { return false },
+			}))
+	if r.ArgoCDDiscovery != nil && r.ArgoCDDiscovery.Changes != nil {
+		// registrations follow the ArgoCD instances they select as they come and go
+		b = b.Watches(&source.Channel{Source: r.ArgoCDDiscovery.Changes}, &handler.EnqueueRequestForObject{})
+	}
+	if r.TokenRotations != nil {
+		// bound tokens that missed their scheduled renewal
+		b = b.Watches(&source.Channel{Source: r.TokenRotations}, &handler.EnqueueRequestForObject{})
+	}
+	if r.TopologyLabels || r.WorkersLabel {
+		// scaling a NodePool changes the topology and workers labels of its HostedCluster
+		b = b.Watches(&source.Kind{Type: &hypershiftv1beta1.NodePool{}},
+			handler.EnqueueRequestsFromMapFunc(r.hostedClusterForNodePool))
+	}
+	if err := b.Complete(r); err != nil {
+		return err
+	}
+
+	qps := r.RefreshQPS
+	if qps <= 0 {
+		qps = DefaultRefreshQPS
+	}
+	refresh, err := controller.New("hostedcluster-refresh", mgr, controller.Options{
+		Reconciler:              r,
+		MaxConcurrentReconciles: r.MaxConcurrentRefreshes,
+		RateLimiter:             refreshRateLimiter(qps),
+	})
+	if err != nil {
+		return err
+	}
+	return refresh.Watch(&source.Kind{Type: &hypershiftv1beta1.HostedCluster{}}, &refreshEnqueueHandler{
+		tracker: &r.tracker,
+		filter:  r.watched,
+	})
 }
 
-func (r *HyperOpsReconciler) createArgoCDClusterSecret(ctx context.Context, labels map[string]string, cluster *Cluster) error {
-	log := log.FromContext(ctx)
-	// create the secret for the local cluster
-	argocdClusterLabels := labels
-	argocdClusterLabels[argoCDSecretTypeLabel] = argoCDSecretTypeCluster
+// watched returns true if events of the HostedCluster should trigger a reconcile
+func (r *HyperOpsReconciler) watched(obj client.Object) bool {
+	_, ok := hostedClusterLabel(obj, hyperOpsEnabledLabel)
+	return ok || r.DefaultEnrollment == DefaultEnrollmentEnabled
+}
+
+// hostedClustersForNamespace maps a gitops namespace to the enabled HostedClusters registering into it
+func (r *HyperOpsReconciler) hostedClustersForNamespace(obj client.Object) []reconcile.Request {
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := r.List(context.Background(), hcs); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range hcs.Items {
+		if hostedClusterEnrolled(&hcs.Items[i], r.DefaultEnrollment) && hostedClusterGitOpsNamespace(&hcs.Items[i], r.GitOpsNamespaceRoutes) == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&hcs.Items[i])})
+		}
+	}
+	return requests
+}
+
+// hostedClusterEnrolled returns true if the HostedCluster should be registered. The enabled label always wins,
+// HostedClusters without the label follow the default enrollment.
+func hostedClusterEnrolled(hc *hypershiftv1beta1.HostedCluster, defaultEnrollment string) bool {
+	if enabled, ok := hostedClusterLabel(hc, hyperOpsEnabledLabel); ok {
+		return enabled != "false"
+	}
+	return defaultEnrollment == DefaultEnrollmentEnabled
+}
 
-	jsonConfig, err := json.Marshal(cluster.Config)
+// hostedClusterGitOpsNamespace returns the gitops namespace the HostedCluster registers into. The gitops namespace
+// label wins over the routing table, HostedClusters matching neither use the default gitops namespace.
+func hostedClusterGitOpsNamespace(hc *hypershiftv1beta1.HostedCluster, routes GitOpsNamespaceRoutes) string {
+	if ns, ok := hostedClusterLabel(hc, hyperOpsGitopsNamespaceLabel); ok && ns != "" {
+		return ns
+	}
+	if ns, ok := routes.Namespace(hc); ok {
+		return ns
+	}
+	return defaultGitOpsNamespace
+}
+
+// createArgoCDClusterSecret renders the cluster and writes it to the gitops namespace of the cluster
+func (r *HyperOpsReconciler) createArgoCDClusterSecret(ctx context.Context, labels map[string]string, cluster *Cluster) error {
+	data, err := cluster.SecretData()
 	if err != nil {
 		return err
 	}
+	return r.writeArgoCDClusterSecret(ctx, cluster.GitOpsNamespace, labels, cluster, data)
+}
+
+// argoCDClusterSecretMetadata returns the labels and the annotations of the ArgoCD cluster secret of the cluster in
+// the namespace
+func (r *HyperOpsReconciler) argoCDClusterSecretMetadata(namespace string, labels map[string]string, cluster *Cluster) (map[string]string, map[string]string) {
+	// distributions discovering clusters through other labels get them in addition to the secret type label, the
+	// labels of the caller are copied and never modified
+	argocdClusterLabels := managedLabels(mergeLabels(r.LabelSchema.Apply(labels), r.discoveryLabels(namespace),
+		map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster}))
+
+	annotations := managedAnnotations(map[string]string{}, correlationID(cluster.HostedCluster))
+	if namespace != cluster.GitOpsNamespace {
+		annotations[hyperOpsCopyOfAnnotation] = client.ObjectKey{Namespace: cluster.GitOpsNamespace, Name: cluster.Name}.String()
+	}
+	if cluster.HostedCluster != nil {
+		annotations[hyperOpsHostedClusterAnnotation] = client.ObjectKeyFromObject(cluster.HostedCluster).String()
+		for k, v := range hostedClusterConditionAnnotations(cluster.HostedCluster) {
+			annotations[k] = v
+		}
+		for k, v := range clusterIdentityAnnotations(cluster.HostedCluster) {
+			annotations[k] = v
+		}
+		// the annotation was validated when the service accounts were created
+		if targets, _ := impersonationTargets(cluster.HostedCluster); len(targets) > 0 {
+			annotations[hyperOpsImpersonationServiceAccountsAnnotation] = impersonationServiceAccounts(targets)
+		}
+	}
+	if !cluster.TokenExpiresAt.IsZero() {
+		annotations[hyperOpsTokenExpiresAtAnnotation] = cluster.TokenExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if cluster.KubeconfigContext != "" {
+		annotations[hyperOpsKubeconfigContextAnnotation] = cluster.KubeconfigContext
+	}
+	if len(cluster.DestinationProjects) > 0 {
+		annotations[hyperOpsDestinationProjectsAnnotation] = strings.Join(cluster.DestinationProjects, ",")
+	}
+	if !cluster.APICertificateExpiresAt.IsZero() {
+		annotations[hyperOpsAPICertificateExpiresAtAnnotation] = cluster.APICertificateExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return argocdClusterLabels, annotations
+}
+
+// writeArgoCDClusterSecret writes the rendered data of the cluster to the ArgoCD cluster secret in the namespace.
+// Secrets outside of the gitops namespace are marked as copies of the secret in the gitops namespace.
+func (r *HyperOpsReconciler) writeArgoCDClusterSecret(ctx context.Context, namespace string, labels map[string]string, cluster *Cluster, data map[string][]byte) error {
+	log := log.FromContext(ctx)
+	argocdClusterLabels, annotations := r.argoCDClusterSecretMetadata(namespace, labels, cluster)
 
 	argocdCluster := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      cluster.Name,
-			Namespace: gitOpsNamespace,
+			Namespace: namespace,
 		},
 	}
-	op, err := CreateOrUpdateWithRetries(ctx, r.Client, argocdCluster, func() error {
+	// never overwrite the secret of another tool unless the conflict policy adopts it, the remote secret of the
+	// registration proxy or the remote hub isn't inspected
+	if r.remoteRegistrations() == nil {
+		existing := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(argocdCluster), existing); client.IgnoreNotFound(err) != nil {
+			return err
+		} else if err == nil {
+			if err := r.checkSecretConflict(ctx, cluster, existing); err != nil {
+				return err
+			}
+		}
+	}
+	if r.readOnly() {
+		argocdCluster.Labels = argocdClusterLabels
+		argocdCluster.Annotations = annotations
+		argocdCluster.Data = data
+		return r.recordArgoCDClusterSecretChange(ctx, argocdCluster, annotations[hyperOpsHostedClusterAnnotation])
+	}
+	if r.remoteRegistrations() != nil {
 		argocdCluster.Labels = argocdClusterLabels
-		argocdCluster.Data = map[string][]byte{
-			"name":   []byte(cluster.Name),
-			"server": []byte(cluster.Server),
-			"config": jsonConfig,
+		argocdCluster.Annotations = annotations
+		argocdCluster.Data = data
+		if err := r.remoteRegistrations().Apply(ctx, argocdCluster); err != nil {
+			log.V(3).Error(err, "unable to send argo cluster secret to the remote ArgoCD")
+			return err
+		}
+		log.V(3).Info("argocd cluster secret sent to the remote ArgoCD")
+		return nil
+	}
+	var changes []RegistrationChange
+	op, err := CreateOrUpdateWithRetries(ctx, r.Client, argocdCluster, func() error {
+		// record when the registration content last changed, used by the fleet report
+		if !reflect.DeepEqual(argocdCluster.Data, data) || !reflect.DeepEqual(argocdCluster.Labels, argocdClusterLabels) {
+			metav1.SetMetaDataAnnotation(&argocdCluster.ObjectMeta, hyperOpsLastRegistrationChangeAnnotation, time.Now().UTC().Format(time.RFC3339))
+		}
+		// a registration pending deletion is restored by replacing the labels and dropping its deadline
+		for _, k := range []string{hyperOpsTokenExpiresAtAnnotation, hyperOpsImpersonationServiceAccountsAnnotation, hyperOpsDeleteAfterAnnotation, hyperOpsCopyOfAnnotation, hyperOpsKubeconfigContextAnnotation, hyperOpsDestinationProjectsAnnotation} {
+			if _, ok := annotations[k]; !ok {
+				delete(argocdCluster.Annotations, k)
+			}
+		}
+		for k, v := range annotations {
+			metav1.SetMetaDataAnnotation(&argocdCluster.ObjectMeta, k, v)
 		}
+		// an adopted secret is no longer garbage collected with its previous owner
+		if !hyperOpsManaged(argocdCluster) && argocdCluster.Labels[managedByLabel] != managedByValue {
+			argocdCluster.OwnerReferences = nil
+		}
+		changes = recordRegistrationChanges(argocdCluster, cluster, data, argocdClusterLabels, time.Now())
+		if r.Archive != nil {
+			// the first archived changes of a registration take the history recorded so far along
+			if _, ok := argocdCluster.Annotations[hyperOpsChangeHistoryArchiveAnnotation]; !ok {
+				changes = RegistrationHistory(argocdCluster)
+			}
+			compactRegistrationHistory(argocdCluster, r.Archive)
+		} else {
+			delete(argocdCluster.Annotations, hyperOpsChangeHistoryArchiveAnnotation)
+		}
+		trackCredentialRotation(argocdCluster, credentialFingerprints(cluster), time.Now())
+		argocdCluster.Labels = argocdClusterLabels
+		argocdCluster.Data = data
 		argocdCluster.Type = corev1.SecretTypeOpaque
 		return nil
 	})
@@ -225,73 +741,116 @@ func (r *HyperOpsReconciler) createArgoCDClusterSecret(ctx context.Context, labe
 		return err
 	}
 	log.V(3).Info("argocd cluster secret", "op", op)
+	r.archiveRegistrationChanges(ctx, client.ObjectKeyFromObject(argocdCluster), changes)
 	return nil
 }
 
-func (r *HyperOpsReconciler) getServerFromKubeConfig(kubeConfigSecret *corev1.Secret) (string, error) {
-	kubeconfig := api.Config{}
-	if err := yaml.Unmarshal(kubeConfigSecret.Data["kubeconfig"], &kubeconfig); err != nil {
-		return "", err
+// deleteArgoCDClusterSecret deletes the ArgoCD cluster secret, through the registration proxy or on the remote hub if
+// one is configured
+func (r *HyperOpsReconciler) deleteArgoCDClusterSecret(ctx context.Context, secret *corev1.Secret) error {
+	if r.readOnly() {
+		return r.recordArgoCDClusterSecretRemoval(ctx, client.ObjectKeyFromObject(secret), DryRunOperationDelete)
+	}
+	if r.remoteRegistrations() != nil {
+		return r.remoteRegistrations().Delete(ctx, secret)
+	}
+	existing := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+		return err
+	}
+	if !hyperOpsManaged(existing) {
+		return &InvariantViolation{Invariant: "only secrets created by hyper-ops may be deleted", Object: client.ObjectKeyFromObject(secret).String()}
+	}
+	// ArgoCD no longer reaches a deregistered cluster, also not during the deletion grace period
+	if err := r.removeEgressNetworkPolicy(ctx, client.ObjectKeyFromObject(existing)); err != nil {
+		return err
+	}
+	if r.DeletionGracePeriod > 0 {
+		return r.markPendingDeletion(ctx, existing)
 	}
-	return kubeconfig.Clusters[0].Cluster.Server, nil
+	return r.Delete(ctx, existing, client.Preconditions{UID: &existing.UID, ResourceVersion: &existing.ResourceVersion})
 }
 
-func (r *HyperOpsReconciler) setupClusterConfig(ctx context.Context, clnt client.Client, server string, name string, hc *hypershiftv1beta1.HostedCluster) (*Cluster, error) {
+// releaseArgoCDClusterSecret strips the hyper-ops labels, annotations and finalizers from the ArgoCD cluster secret
+// while keeping the secret and its credentials in place
+func (r *HyperOpsReconciler) releaseArgoCDClusterSecret(ctx context.Context, key client.ObjectKey) error {
 	log := log.FromContext(ctx)
-	log.Info("setting up cluster config", "name", name, "server", server)
-	sa := &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      hostedClusterServiceAccountName,
-			Namespace: hostedClusterServiceAccountNamespace,
-		},
+	if r.readOnly() {
+		return r.recordArgoCDClusterSecretRemoval(ctx, key, DryRunOperationRelease)
 	}
-	op, err := CreateOrUpdateWithRetries(ctx, clnt, sa, func() error {
+	if r.remoteRegistrations() != nil {
+		log.Info("unmanage is not supported for a remote ArgoCD, leaving the remote secret untouched")
 		return nil
-	})
-	if err != nil {
-		log.V(3).Error(err, "unable to ensure hosted cluster service account")
-		return nil, err
 	}
-	log.V(3).Info("service account created", "op", op)
-	// create a cluster role binding
-	crb := &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: hostedClusterServiceAccountName,
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      hostedClusterServiceAccountName,
-				Namespace: hostedClusterServiceAccountNamespace,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			Kind:     "ClusterRole",
-			Name:     "cluster-admin",
-			APIGroup: "rbac.authorization.k8s.io",
-		},
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, key, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	released := secret.DeepCopy()
+	if released.Labels[managedByLabel] == managedByValue {
+		delete(released.Labels, managedByLabel)
+	}
+	for k := range released.Labels {
+		if isHyperOpsLabel(k) {
+			delete(released.Labels, k)
+		}
+	}
+	for k := range released.Annotations {
+		if strings.HasPrefix(k, hyperOpsLabel) {
+			delete(released.Annotations, k)
+		}
 	}
-	op, err = CreateOrUpdateWithRetries(ctx, clnt, crb, func() error {
+	finalizers := []string{}
+	for _, f := range released.Finalizers {
+		if !strings.HasPrefix(f, hyperOpsLabel) {
+			finalizers = append(finalizers, f)
+		}
+	}
+	released.Finalizers = finalizers
+	if reflect.DeepEqual(secret, released) {
 		return nil
-	})
+	}
+	return r.Patch(ctx, released, client.MergeFrom(secret))
+}
+
+// hostedClusterConditionAnnotations returns the mirrored HostedCluster conditions as secret annotations,
+// conditions not (yet) reported by the HostedCluster are set to Unknown
+func hostedClusterConditionAnnotations(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	annotations := map[string]string{}
+	for _, conditionType := range mirroredHostedClusterConditions {
+		status := metav1.ConditionUnknown
+		if condition := meta.FindStatusCondition(hc.Status.Conditions, string(conditionType)); condition != nil {
+			status = condition.Status
+		}
+		annotations[fmt.Sprintf("%s/condition.%s", hyperOpsLabel, strings.ToLower(string(conditionType)))] = string(status)
+	}
+	return annotations
+}
+
+func (r *HyperOpsReconciler) setupClusterConfig(ctx context.Context, clnt client.Client, server string, name string, hc *hypershiftv1beta1.HostedCluster) (*Cluster, error) {
+	log := log.FromContext(ctx)
+	log.Info("setting up cluster config", "name", name, "server", server)
+	clusterRole, err := r.hostedClusterRole(hc)
 	if err != nil {
-		log.V(3).Error(err, "unable to ensure hosted cluster cluster role binding")
 		return nil, err
 	}
-	log.V(3).Info("cluster role binding created", "op", op)
+	if err := ensureServiceAccount(ctx, clnt, correlationID(hc), clusterRole); err != nil {
+		return nil, err
+	}
 
 	// Create an sa token secret
 	saTokenSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-token", hostedClusterServiceAccountName),
+			Name:      legacyTokenSecretName,
 			Namespace: hostedClusterServiceAccountNamespace,
 			Annotations: map[string]string{
-				corev1.ServiceAccountNameKey: sa.Name,
+				corev1.ServiceAccountNameKey: hostedClusterServiceAccountName,
 			},
 		},
 		Type: corev1.SecretTypeServiceAccountToken,
 	}
-	op, err = CreateOrUpdateWithRetries(ctx, clnt, saTokenSecret, func() error {
+	op, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, saTokenSecret, func() error {
+		stampManaged(saTokenSecret, correlationID(hc))
 		return nil
 	})
 	if err != nil {
@@ -313,14 +872,83 @@ func (r *HyperOpsReconciler) setupClusterConfig(ctx context.Context, clnt client
 	}
 	// create the cluster config
 	return &Cluster{
-		Name:   name,
-		Server: server,
-		Config: ClusterConfig{
-			BearerToken: string(saTokenSecret.Data["token"]),
-			TLSClientConfig: TLSClientConfig{
-				CAData: base64.URLEncoding.EncodeToString(saTokenSecret.Data["ca.crt"]),
+		Cluster: argocd.Cluster{
+			Name:   name,
+			Server: server,
+			Config: argocd.ClusterConfig{
+				BearerToken: string(saTokenSecret.Data["token"]),
+				TLSClientConfig: argocd.TLSClientConfig{
+					CAData: saTokenSecret.Data["ca.crt"],
+				},
 			},
 		},
 		HostedCluster: hc,
 	}, nil
 }
+
+// ensureServiceAccount creates the hyper-ops service account and binds it to the cluster role
+func ensureServiceAccount(ctx context.Context, clnt client.Client, correlationID string, clusterRole string) error {
+	log := log.FromContext(ctx)
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hostedClusterServiceAccountName,
+			Namespace: hostedClusterServiceAccountNamespace,
+		},
+	}
+	op, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, sa, func() error {
+		stampManaged(sa, correlationID)
+		return nil
+	})
+	if err != nil {
+		log.V(3).Error(err, "unable to ensure hosted cluster service account")
+		return err
+	}
+	log.V(3).Info("service account created", "op", op)
+	if err := ensureHostedClusterRole(ctx, clnt, clusterRole, correlationID); err != nil {
+		log.V(3).Error(err, "unable to ensure hosted cluster cluster role", "clusterRole", clusterRole)
+		return err
+	}
+	// create a cluster role binding
+	crb := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName,
+		},
+	}
+	roleRef := rbacv1.RoleRef{
+		Kind:     "ClusterRole",
+		Name:     clusterRole,
+		APIGroup: "rbac.authorization.k8s.io",
+	}
+	// the role of a binding can't be changed, a binding to another role is replaced
+	if err := clnt.Get(ctx, client.ObjectKeyFromObject(crb), crb); client.IgnoreNotFound(err) != nil {
+		return err
+	} else if err == nil && crb.RoleRef != roleRef {
+		log.Info("replacing the hosted cluster cluster role binding", "from", crb.RoleRef.Name, "to", clusterRole)
+		if err := clnt.Delete(ctx, crb); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		crb = &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: hostedClusterServiceAccountName,
+			},
+		}
+	}
+	op, err = CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, crb, func() error {
+		stampManaged(crb, correlationID)
+		crb.Subjects = []rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      hostedClusterServiceAccountName,
+				Namespace: hostedClusterServiceAccountNamespace,
+			},
+		}
+		crb.RoleRef = roleRef
+		return nil
+	})
+	if err != nil {
+		log.V(3).Error(err, "unable to ensure hosted cluster cluster role binding")
+		return err
+	}
+	log.V(3).Info("cluster role binding created", "op", op)
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
@@ -159,6 +160,8 @@ var _ = Describe("Hyper-Ops controller", func() {
 			hyperOpsReconciler = &HyperOpsReconciler{
 				Client: k8sClient,
 				Scheme: k8sClient.Scheme(),
+				// the manually created token can't authenticate against envtest
+				verifyToken: func(context.Context, client.Client, string) error { return nil },
 			}
 		})
 
@@ -169,6 +172,9 @@ var _ = Describe("Hyper-Ops controller", func() {
 			cluster := &hypershiftv1beta1.HostedCluster{}
 			err := k8sClient.Get(ctx, typeNamespaceName, cluster)
 			Expect(err).To(Not(HaveOccurred()))
+			// the manager is stopped at this point, nothing removes the cleanup finalizer
+			cluster.Finalizers = nil
+			Expect(k8sClient.Update(ctx, cluster)).To(Succeed())
 			err = k8sClient.Delete(ctx, cluster)
 			Expect(err).To(Not(HaveOccurred()))
 			By("Deleting the Namespaces to perform the tests")
@@ -259,6 +265,44 @@ var _ = Describe("Hyper-Ops controller", func() {
 						return k8sClient.Get(ctx, types.NamespacedName{Name: hyperOpsControllerBaseName, Namespace: gitOpsNamespace.Name}, secret)
 					}, time.Second*10, time.Second*2).Should(Succeed())
 					Expect(secret.Labels).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/cluster-name", "test"))
+
+					By("Checking that the HostedCluster conditions are mirrored as annotations")
+					Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/condition.available", "Unknown"))
+					Expect(secret.Annotations).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/condition.clusterversionsucceeding", "Unknown"))
+				})
+			})
+			Describe("With the unmanage annotation", func() {
+				It("Should release the ArgoCD cluster secret without deleting it", func() {
+					By("Registering the HostedCluster")
+					cluster.Labels = map[string]string{
+						"hyper-ops.cloudmonkey.org/enabled":          "true",
+						"hyper-ops.cloudmonkey.org/gitops-namespace": gitOpsNamespace.Name,
+					}
+					err := k8sClient.Update(ctx, cluster)
+					Expect(err).To(Not(HaveOccurred()))
+					req := reconcile.Request{
+						NamespacedName: typeNamespaceName,
+					}
+					_, err = hyperOpsReconciler.Reconcile(ctx, req)
+					Expect(err).To(Not(HaveOccurred()))
+
+					By("Setting the unmanage annotation")
+					cluster.Annotations = map[string]string{
+						"hyper-ops.cloudmonkey.org/unmanage": "true",
+					}
+					err = k8sClient.Update(ctx, cluster)
+					Expect(err).To(Not(HaveOccurred()))
+					_, err = hyperOpsReconciler.Reconcile(ctx, req)
+					Expect(err).To(Not(HaveOccurred()))
+
+					By("Checking that the secret is kept without hyper-ops metadata")
+					secret := &corev1.Secret{}
+					err = k8sClient.Get(ctx, types.NamespacedName{Name: hyperOpsControllerBaseName, Namespace: gitOpsNamespace.Name}, secret)
+					Expect(err).To(Not(HaveOccurred()))
+					Expect(secret.Labels).To(HaveKeyWithValue("argocd.argoproj.io/secret-type", "cluster"))
+					Expect(secret.Labels).NotTo(HaveKey("hyper-ops.cloudmonkey.org/enabled"))
+					Expect(secret.Annotations).NotTo(HaveKey("hyper-ops.cloudmonkey.org/hosted-cluster"))
+					Expect(secret.Data).To(HaveKey("config"))
 				})
 			})
 		})
@@ -0,0 +1,86 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// A HostedCluster deleted and recreated with the same name gets a new API server, the registration is keyed by name
+// though. The UID and infraID of the HostedCluster are recorded on the ArgoCD cluster secret, a mismatch identifies
+// a recreated cluster whose credentials must not be reused.
+
+const (
+	// hyperOpsClusterUIDAnnotation records the UID of the HostedCluster the registration was written for
+	hyperOpsClusterUIDAnnotation = "hyper-ops.cloudmonkey.org/cluster-uid"
+	// hyperOpsInfraIDAnnotation records the infraID of the HostedCluster the registration was written for
+	hyperOpsInfraIDAnnotation = "hyper-ops.cloudmonkey.org/infra-id"
+
+	// ConditionRecreated is true when the HostedCluster replaced an earlier HostedCluster with the same name
+	ConditionRecreated = "Recreated"
+)
+
+// clusterIdentityAnnotations returns the identity annotations of the HostedCluster
+func clusterIdentityAnnotations(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	annotations := map[string]string{
+		hyperOpsClusterUIDAnnotation: string(hc.UID),
+	}
+	if hc.Spec.InfraID != "" {
+		annotations[hyperOpsInfraIDAnnotation] = hc.Spec.InfraID
+	}
+	return annotations
+}
+
+// sameClusterIdentity returns false if the secret was written for another HostedCluster with the same name,
+// registrations written before the identity was recorded are assumed to match
+func sameClusterIdentity(secret *corev1.Secret, hc *hypershiftv1beta1.HostedCluster) bool {
+	if uid, ok := secret.Annotations[hyperOpsClusterUIDAnnotation]; ok && uid != string(hc.UID) {
+		return false
+	}
+	if infraID, ok := secret.Annotations[hyperOpsInfraIDAnnotation]; ok && hc.Spec.InfraID != "" && infraID != hc.Spec.InfraID {
+		return false
+	}
+	return true
+}
+
+// detectRecreation flags the HostedCluster with the Recreated condition if its ArgoCD cluster secret was written for an
+// earlier HostedCluster with the same name
+func (r *HyperOpsReconciler) detectRecreation(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	// the secrets of a remote ArgoCD aren't read
+	if r.remoteRegistrations() != nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if sameClusterIdentity(secret, hc) {
+		return nil
+	}
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionRecreated,
+		Status:  metav1.ConditionTrue,
+		Reason:  "IdentityChanged",
+		Message: fmt.Sprintf("replaces HostedCluster %s, the credentials of the registration were rotated", secret.Annotations[hyperOpsClusterUIDAnnotation]),
+	})
+}
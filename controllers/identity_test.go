@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Cluster identity", func() {
+	var (
+		hc     *hypershiftv1beta1.HostedCluster
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "new-uid"},
+			Spec:       hypershiftv1beta1.HostedClusterSpec{InfraID: "hosted-new"},
+		}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"}}
+		cluster.Config.BearerToken = "old-token"
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Annotations: map[string]string{
+					hyperOpsClusterUIDAnnotation:     "old-uid",
+					hyperOpsInfraIDAnnotation:        "hosted-old",
+					hyperOpsTokenExpiresAtAnnotation: time.Now().Add(boundTokenExpiration).UTC().Format(time.RFC3339),
+				},
+			},
+			Data: data,
+		}
+	})
+
+	It("Should flag a recreated HostedCluster", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()
+		r := &HyperOpsReconciler{Client: c}
+		Expect(r.detectRecreation(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(updated), ConditionRecreated)).To(BeTrue())
+	})
+
+	It("Should not reuse the token of the previous HostedCluster", func() {
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()}
+		_, _, ok := r.currentBoundToken(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(ok).To(BeFalse())
+
+		secret.Annotations = clusterIdentityAnnotations(hc)
+		Expect(sameClusterIdentity(secret, hc)).To(BeTrue())
+	})
+
+	It("Should accept registrations written before the identity was recorded", func() {
+		secret.Annotations = nil
+		Expect(sameClusterIdentity(secret, hc)).To(BeTrue())
+	})
+})
@@ -0,0 +1,226 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsImpersonationAnnotation enables scoped impersonation for a HostedCluster. It holds a comma separated
+	// list of <project>/<namespace> pairs, every AppProject gets a service account in each of its namespaces
+	hyperOpsImpersonationAnnotation = "hyper-ops.cloudmonkey.org/impersonation"
+	// hyperOpsImpersonationServiceAccountsAnnotation lists the <project>/<namespace>:<service account> destination
+	// service accounts on the ArgoCD cluster secret, to be referenced from the AppProjects
+	hyperOpsImpersonationServiceAccountsAnnotation = "hyper-ops.cloudmonkey.org/impersonation-service-accounts"
+
+	// impersonationClusterRole is bound to the destination service accounts in their namespace
+	impersonationClusterRole = "admin"
+
+	// ConditionImpersonationReady is true when the destination service accounts for scoped impersonation exist
+	ConditionImpersonationReady = "ImpersonationReady"
+)
+
+// hyperOpsImpersonationProjectLabel marks the destination service accounts and role bindings with their AppProject
+var hyperOpsImpersonationProjectLabel = fmt.Sprintf("%s/impersonation-project", hyperOpsLabel)
+
+// impersonationTarget is a namespace an AppProject deploys to through a destination service account
+type impersonationTarget struct {
+	Project   string
+	Namespace string
+}
+
+// ServiceAccountName returns the name of the destination service account of the AppProject
+func (t impersonationTarget) ServiceAccountName() string {
+	return fmt.Sprintf("%s-deployer", t.Project)
+}
+
+// impersonationTargets parses the impersonation annotation of the HostedCluster, nil if it is not set
+func impersonationTargets(hc *hypershiftv1beta1.HostedCluster) ([]impersonationTarget, error) {
+	raw := strings.TrimSpace(hc.GetAnnotations()[hyperOpsImpersonationAnnotation])
+	if raw == "" {
+		return nil, nil
+	}
+	seen := map[impersonationTarget]bool{}
+	targets := []impersonationTarget{}
+	for _, pair := range strings.Split(raw, ",") {
+		project, namespace, ok := strings.Cut(strings.TrimSpace(pair), "/")
+		if !ok || project == "" || namespace == "" {
+			return nil, fmt.Errorf("invalid impersonation target %q, must be <project>/<namespace>", pair)
+		}
+		target := impersonationTarget{Project: project, Namespace: namespace}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsDNS1123Subdomain(target.ServiceAccountName()); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid project %q: %s", project, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(project); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid project %q: %s", project, strings.Join(errs, ", "))
+		}
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Project != targets[j].Project {
+			return targets[i].Project < targets[j].Project
+		}
+		return targets[i].Namespace < targets[j].Namespace
+	})
+	return targets, nil
+}
+
+// impersonationServiceAccounts returns the value of the impersonation service accounts annotation of the targets
+func impersonationServiceAccounts(targets []impersonationTarget) string {
+	accounts := make([]string, 0, len(targets))
+	for _, t := range targets {
+		accounts = append(accounts, fmt.Sprintf("%s/%s:%s", t.Project, t.Namespace, t.ServiceAccountName()))
+	}
+	return strings.Join(accounts, ",")
+}
+
+// reconcileImpersonation maintains the destination service accounts of the HostedCluster in the hosted cluster. It
+// returns true if the registration should stop because the impersonation annotation is invalid.
+func (r *HyperOpsReconciler) reconcileImpersonation(ctx context.Context, hostedClient client.Client, hc *hypershiftv1beta1.HostedCluster) (bool, error) {
+	log := log.FromContext(ctx)
+	targets, err := impersonationTargets(hc)
+	if err != nil {
+		log.Info("invalid impersonation annotation", "error", err.Error())
+		return true, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionImpersonationReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidAnnotation",
+			Message: err.Error(),
+		})
+	}
+	// clusters that never used impersonation have nothing to clean up
+	condition := meta.FindStatusCondition(registrationConditions(hc), ConditionImpersonationReady)
+	if len(targets) == 0 && (condition == nil || condition.Reason == "NotConfigured") {
+		return false, nil
+	}
+	if !r.readOnly() {
+		if err := ensureImpersonation(ctx, hostedClient, targets, correlationID(hc)); err != nil {
+			log.V(3).Error(err, "unable to ensure the impersonation service accounts")
+			return false, err
+		}
+	}
+	if len(targets) == 0 {
+		return false, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionImpersonationReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotConfigured",
+			Message: "the HostedCluster has no impersonation targets",
+		})
+	}
+	return false, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionImpersonationReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ServiceAccountsReady",
+		Message: fmt.Sprintf("%d destination service accounts exist", len(targets)),
+	})
+}
+
+// ensureImpersonation creates the destination service accounts of the targets in the hosted cluster and binds them
+// to the admin role in their namespace. Service accounts and role bindings of removed targets are deleted.
+func ensureImpersonation(ctx context.Context, clnt client.Client, targets []impersonationTarget, correlationID string) error {
+	log := log.FromContext(ctx)
+	desired := map[client.ObjectKey]bool{}
+	for _, t := range targets {
+		key := client.ObjectKey{Namespace: t.Namespace, Name: t.ServiceAccountName()}
+		desired[key] = true
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: t.Namespace}}
+		if err := clnt.Get(ctx, client.ObjectKeyFromObject(ns), ns); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			stampManaged(ns, correlationID)
+			if err := clnt.Create(ctx, ns); err != nil {
+				return fmt.Errorf("unable to create namespace %s: %w", t.Namespace, err)
+			}
+		}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, sa, func() error {
+			stampManaged(sa, correlationID)
+			metav1.SetMetaDataLabel(&sa.ObjectMeta, hyperOpsImpersonationProjectLabel, t.Project)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("unable to ensure service account %s: %w", key, err)
+		}
+		rb := &rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, rb, func() error {
+			stampManaged(rb, correlationID)
+			metav1.SetMetaDataLabel(&rb.ObjectMeta, hyperOpsImpersonationProjectLabel, t.Project)
+			rb.Subjects = []rbacv1.Subject{{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      key.Name,
+				Namespace: key.Namespace,
+			}}
+			rb.RoleRef = rbacv1.RoleRef{
+				Kind:     "ClusterRole",
+				Name:     impersonationClusterRole,
+				APIGroup: rbacv1.GroupName,
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("unable to ensure role binding %s: %w", key, err)
+		}
+	}
+
+	// remove the service accounts and role bindings of targets that were dropped from the annotation
+	selector := client.MatchingLabels{managedByLabel: managedByValue}
+	owned := client.HasLabels{hyperOpsImpersonationProjectLabel}
+	rbs := &rbacv1.RoleBindingList{}
+	if err := clnt.List(ctx, rbs, selector, owned); err != nil {
+		return err
+	}
+	for i := range rbs.Items {
+		if !desired[client.ObjectKeyFromObject(&rbs.Items[i])] {
+			log.Info("removing role binding of dropped impersonation target", "roleBinding", client.ObjectKeyFromObject(&rbs.Items[i]))
+			if err := clnt.Delete(ctx, &rbs.Items[i]); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	sas := &corev1.ServiceAccountList{}
+	if err := clnt.List(ctx, sas, selector, owned); err != nil {
+		return err
+	}
+	for i := range sas.Items {
+		if !desired[client.ObjectKeyFromObject(&sas.Items[i])] {
+			log.Info("removing service account of dropped impersonation target", "serviceAccount", client.ObjectKeyFromObject(&sas.Items[i]))
+			if err := clnt.Delete(ctx, &sas.Items[i]); client.IgnoreNotFound(err) != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Scoped impersonation", func() {
+	hostedCluster := func(targets string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsImpersonationAnnotation: targets},
+			},
+		}
+	}
+
+	It("Should parse the impersonation targets", func() {
+		targets, err := impersonationTargets(hostedCluster("team-b/web, team-a/api,team-a/api"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targets).To(Equal([]impersonationTarget{
+			{Project: "team-a", Namespace: "api"},
+			{Project: "team-b", Namespace: "web"},
+		}))
+		Expect(impersonationServiceAccounts(targets)).To(Equal("team-a/api:team-a-deployer,team-b/web:team-b-deployer"))
+
+		_, err = impersonationTargets(hostedCluster("team-a"))
+		Expect(err).To(HaveOccurred())
+		_, err = impersonationTargets(hostedCluster("team-a/Not_A_Namespace"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should create and remove the destination service accounts", func() {
+		hc := hostedCluster("team-a/api,team-b/web")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		stop, err := r.reconcileImpersonation(context.Background(), hosted, hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "web"}, &corev1.Namespace{})).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: "web", Name: "team-b-deployer"}, &corev1.ServiceAccount{})).To(Succeed())
+		rb := &rbacv1.RoleBinding{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: "api", Name: "team-a-deployer"}, rb)).To(Succeed())
+		Expect(rb.RoleRef.Name).To(Equal("admin"))
+		Expect(rb.Subjects).To(ConsistOf(rbacv1.Subject{Kind: "ServiceAccount", Name: "team-a-deployer", Namespace: "api"}))
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(updated), ConditionImpersonationReady)).To(BeTrue())
+
+		updated.Annotations[hyperOpsImpersonationAnnotation] = "team-a/api"
+		_, err = r.reconcileImpersonation(context.Background(), hosted, updated)
+		Expect(err).NotTo(HaveOccurred())
+		err = hosted.Get(context.Background(), client.ObjectKey{Namespace: "web", Name: "team-b-deployer"}, &corev1.ServiceAccount{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = hosted.Get(context.Background(), client.ObjectKey{Namespace: "web", Name: "team-b-deployer"}, &rbacv1.RoleBinding{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: "api", Name: "team-a-deployer"}, &corev1.ServiceAccount{})).To(Succeed())
+	})
+
+	It("Should stop the registration on an invalid annotation", func() {
+		hc := hostedCluster("team-a")
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()}
+		stop, err := r.reconcileImpersonation(context.Background(), fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionImpersonationReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("InvalidAnnotation"))
+	})
+})
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Insecure TLS", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+	})
+
+	It("Should verify the certificate unless the HostedCluster opts out", func() {
+		config := &rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: []byte("ca")}}
+		Expect(applyInsecureSkipTLSVerify(hc, config)).To(Succeed())
+		Expect(config.Insecure).To(BeFalse())
+		Expect(config.CAData).To(Equal([]byte("ca")))
+
+		hc.Annotations = map[string]string{hyperOpsInsecureSkipTLSVerifyAnnotation: "true"}
+		Expect(applyInsecureSkipTLSVerify(hc, config)).To(Succeed())
+		Expect(config.Insecure).To(BeTrue())
+		Expect(config.CAData).To(BeNil())
+		_, err := rest.TransportFor(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		hc.Annotations[hyperOpsInsecureSkipTLSVerifyAnnotation] = "yes"
+		Expect(applyInsecureSkipTLSVerify(hc, config)).NotTo(Succeed())
+	})
+
+	It("Should write an insecure ArgoCD cluster without the CA", func() {
+		hc.Annotations = map[string]string{hyperOpsInsecureSkipTLSVerifyAnnotation: "true"}
+		rendered, err := RenderRegistration(context.Background(), hc, RenderOptions{Server: "https://api.hosted:6443"})
+		Expect(err).NotTo(HaveOccurred())
+		cluster, err := argocd.ClusterFromSecretData(rendered.Secrets[0].Data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Config.TLSClientConfig.Insecure).To(BeTrue())
+
+		c := &Cluster{Cluster: argocd.Cluster{Config: argocd.ClusterConfig{TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}}}}
+		Expect(applyInsecureCluster(hc, c)).To(Succeed())
+		Expect(c.Config.TLSClientConfig.Insecure).To(BeTrue())
+		Expect(c.Config.TLSClientConfig.CAData).To(BeNil())
+	})
+})
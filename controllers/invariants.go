@@ -0,0 +1,201 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The reconcile pipeline upholds two invariants, whatever subsystem asks for the write:
+//
+//   - an ArgoCD cluster secret is only deleted if hyper-ops created it, i.e. it carries the hyper-ops type label
+//   - an ArgoCD cluster secret is only written with a token that authenticated against its cluster
+//
+// The ConsistencyChecker looks for registrations that drifted into an inconsistent state anyway, e.g. after a crash
+// between two writes, and repairs or reports them.
+
+// hyperOpsTypeLabel marks the ArgoCD cluster secrets created by hyper-ops, the value is either local or hosted
+const hyperOpsTypeLabel = "hyper-ops.cloudmonkey.org/type"
+
+// InvariantViolation is returned when a write would break one of the reconcile invariants
+type InvariantViolation struct {
+	Invariant string
+	Object    string
+}
+
+func (e *InvariantViolation) Error() string {
+	return fmt.Sprintf("invariant violated for %s: %s", e.Object, e.Invariant)
+}
+
+// isInvariantViolation returns true if the error is an InvariantViolation, the write was refused and the object is
+// left untouched
+func isInvariantViolation(err error) bool {
+	var violation *InvariantViolation
+	return errors.As(err, &violation)
+}
+
+// hyperOpsManaged returns true if the ArgoCD cluster secret was created by hyper-ops
+func hyperOpsManaged(secret *corev1.Secret) bool {
+	_, ok := secret.Labels[hyperOpsTypeLabel]
+	return ok
+}
+
+// verifyTokenReview checks that the token authenticates against the cluster of the client with a TokenReview
+func verifyTokenReview(ctx context.Context, c client.Client, token string) error {
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := c.Create(ctx, review); err != nil {
+		return fmt.Errorf("unable to review token: %w", err)
+	}
+	if !review.Status.Authenticated {
+		return fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+	return nil
+}
+
+// verifyClusterToken enforces the verified token invariant for the cluster config before it is written
+func (r *HyperOpsReconciler) verifyClusterToken(ctx context.Context, c client.Client, cluster *Cluster) error {
+	verify := r.verifyToken
+	if verify == nil {
+		verify = verifyTokenReview
+	}
+	if err := verify(ctx, c, cluster.Config.BearerToken); err != nil {
+		return &InvariantViolation{Invariant: fmt.Sprintf("token must be verified before it is written: %s", err), Object: cluster.Name}
+	}
+	return nil
+}
+
+// ConsistencyViolation is a registration found in an inconsistent state by the ConsistencyChecker
+type ConsistencyViolation struct {
+	Secret        string
+	HostedCluster string
+	Problem       string
+	Repaired      bool
+}
+
+// CheckConsistency looks for inconsistent ArgoCD cluster secrets created by hyper-ops. With repair set, secrets of
+// HostedClusters that no longer exist and stale copies left in a previous gitops namespace are deleted, other
+// violations are only reported.
+func CheckConsistency(ctx context.Context, c client.Client, routes GitOpsNamespaceRoutes, discovery *ArgoCDInstanceDiscovery, repair bool) ([]ConsistencyViolation, error) {
+	return checkConsistency(ctx, c, routes, discovery, repair, false)
+}
+
+// checkConsistency implements CheckConsistency, with skipOrphans the secrets of HostedClusters that no longer exist
+// are only reported and left to the OrphanReaper
+func checkConsistency(ctx context.Context, c client.Client, routes GitOpsNamespaceRoutes, discovery *ArgoCDInstanceDiscovery, repair, skipOrphans bool) ([]ConsistencyViolation, error) {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return nil, err
+	}
+	violations := []ConsistencyViolation{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !hyperOpsManaged(secret) {
+			continue
+		}
+		violation := ConsistencyViolation{Secret: client.ObjectKeyFromObject(secret).String()}
+		if len(secret.Data["server"]) == 0 || len(secret.Data["config"]) == 0 {
+			violation.Problem = "registration has no server or config"
+			violations = append(violations, violation)
+			continue
+		}
+		ref, ok := secret.Annotations[hyperOpsHostedClusterAnnotation]
+		if secret.Labels[hyperOpsTypeLabel] != "hosted" {
+			continue
+		}
+		if !ok {
+			violation.Problem = "hosted registration does not reference its HostedCluster"
+			violations = append(violations, violation)
+			continue
+		}
+		violation.HostedCluster = ref
+		namespace, name, _ := strings.Cut(ref, "/")
+		hc := &hypershiftv1beta1.HostedCluster{}
+		orphaned := false
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, hc); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			violation.Problem = "HostedCluster of the registration no longer exists"
+			orphaned = true
+		} else if ns, discovered, err := discoveredGitOpsNamespaces(discovery, hc, hostedClusterGitOpsNamespace(hc, routes)); err != nil {
+			// registrations into ArgoCD instances that can't be resolved are left alone
+			continue
+		} else if ns != secret.Namespace && !isGitOpsNamespaceCopy(secret, hc, ns, discovered...) {
+			violation.Problem = fmt.Sprintf("registration is not in the gitops namespace %s of its HostedCluster", ns)
+		} else {
+			continue
+		}
+		if repair && !(skipOrphans && orphaned) {
+			if err := c.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			violation.Repaired = true
+		}
+		violations = append(violations, violation)
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Secret < violations[j].Secret
+	})
+	return violations, nil
+}
+
+// ConsistencyChecker periodically runs CheckConsistency and logs the violations it finds
+type ConsistencyChecker struct {
+	Client   client.Client
+	Interval time.Duration
+	Repair   bool
+	// Routes is the gitops namespace routing table of the reconciler
+	Routes GitOpsNamespaceRoutes
+	// Discovery resolves the gitops namespaces of HostedClusters selecting ArgoCD instances, nil without discovery
+	Discovery *ArgoCDInstanceDiscovery
+	// SkipOrphans leaves the registrations of HostedClusters that no longer exist to the OrphanReaper, which revokes
+	// their credentials before deleting them
+	SkipOrphans bool
+}
+
+// Start runs the checker until the context is cancelled, it implements manager.Runnable
+func (cc *ConsistencyChecker) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("consistency-check")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		violations, err := checkConsistency(ctx, cc.Client, cc.Routes, cc.Discovery, cc.Repair, cc.SkipOrphans)
+		if err != nil {
+			log.Error(err, "unable to check registration consistency")
+			return
+		}
+		for _, v := range violations {
+			log.Info("inconsistent registration", "secret", v.Secret, "hostedCluster", v.HostedCluster, "problem", v.Problem, "repaired", v.Repaired)
+		}
+	}, cc.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader repairs registrations
+func (cc *ConsistencyChecker) NeedLeaderElection() bool {
+	return true
+}
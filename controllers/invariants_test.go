@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Invariants", func() {
+	registration := func(namespace, name, hostedCluster string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					argoCDSecretTypeLabel: argoCDSecretTypeCluster,
+					hyperOpsTypeLabel:     "hosted",
+				},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: hostedCluster},
+			},
+			Data: map[string][]byte{"server": []byte("https://" + name + ":6443"), "config": []byte("{}")},
+		}
+	}
+
+	It("Should refuse to delete secrets not created by hyper-ops", func() {
+		foreign := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(foreign).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		err := r.deleteArgoCDClusterSecret(context.Background(), foreign)
+		Expect(isInvariantViolation(err)).To(BeTrue())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(foreign), &corev1.Secret{})).To(Succeed())
+	})
+
+	It("Should delete secrets created by hyper-ops", func() {
+		owned := registration(defaultGitOpsNamespace, "hosted", "clusters/hosted")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(owned).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), owned)).To(Succeed())
+		// deleting again is a no-op apart from the not found error the callers ignore
+		Expect(client.IgnoreNotFound(r.deleteArgoCDClusterSecret(context.Background(), owned))).To(Succeed())
+	})
+
+	It("Should refuse to write unverified tokens", func() {
+		r := &HyperOpsReconciler{
+			verifyToken: func(context.Context, client.Client, string) error { return errors.New("unauthorized") },
+		}
+		err := r.verifyClusterToken(context.Background(), nil, &Cluster{Cluster: argocd.Cluster{Name: "hosted"}})
+		Expect(isInvariantViolation(err)).To(BeTrue())
+	})
+
+	It("Should repair orphaned and stale registrations", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "moved",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsGitopsNamespaceLabel: "team-gitops"},
+			},
+		}
+		current := registration("team-gitops", "moved", "clusters/moved")
+		stale := registration(defaultGitOpsNamespace, "moved", "clusters/moved")
+		orphan := registration(defaultGitOpsNamespace, "deleted", "clusters/deleted")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, current, stale, orphan).Build()
+
+		violations, err := CheckConsistency(context.Background(), c, nil, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violations).To(HaveLen(2))
+		Expect(violations[0].Secret).To(Equal("openshift-gitops/deleted"))
+		Expect(violations[0].Repaired).To(BeFalse())
+
+		violations, err = CheckConsistency(context.Background(), c, nil, nil, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violations).To(HaveLen(2))
+		Expect(violations[1].Repaired).To(BeTrue())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(current), &corev1.Secret{})).To(Succeed())
+
+		// a repaired fleet is consistent, running the check again finds nothing
+		violations, err = CheckConsistency(context.Background(), c, nil, nil, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violations).To(BeEmpty())
+	})
+})
@@ -0,0 +1,283 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// DefaultInventoryBranch is the branch the inventory is committed to
+	DefaultInventoryBranch = "main"
+	// DefaultInventoryPath is the path of the inventory file in the repository
+	DefaultInventoryPath = "clusters.yaml"
+	// DefaultInventoryInterval is the interval at which the inventory is written
+	DefaultInventoryInterval = 5 * time.Minute
+
+	// inventorySSHPrivateKeyKey and inventoryKnownHostsKey are the keys of the deploy key secret, the private key
+	// uses the key name of ArgoCD repository secrets
+	inventorySSHPrivateKeyKey = "sshPrivateKey"
+	inventoryKnownHostsKey    = "knownHosts"
+
+	inventoryCommitAuthor = "hyper-ops"
+	inventoryCommitEmail  = "hyper-ops@cloudmonkey.org"
+)
+
+// InventoryCluster is an entry of the cluster inventory, a registered ArgoCD cluster without its credentials
+type InventoryCluster struct {
+	// Name is the ArgoCD name of the cluster
+	Name string `json:"name"`
+	// Namespace is the gitops namespace the cluster is registered in
+	Namespace string `json:"namespace"`
+	// Server is the API server URL of the cluster
+	Server string `json:"server"`
+	// HostedCluster is the namespace/name of the HostedCluster
+	HostedCluster string `json:"hostedCluster,omitempty"`
+	// Project is the AppProject the cluster is scoped to
+	Project string `json:"project,omitempty"`
+	// Labels are the labels of the ArgoCD cluster secret
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// GenerateInventory returns the registered ArgoCD clusters of hyper-ops sorted by gitops namespace and name. The
+// inventory only changes with the registrations, so an unchanged fleet renders the same inventory.
+func GenerateInventory(ctx context.Context, c client.Reader) ([]InventoryCluster, error) {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}, client.HasLabels{hyperOpsTypeLabel}); err != nil {
+		return nil, err
+	}
+	inventory := []InventoryCluster{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Labels[hyperOpsPendingDeletionLabel] == "true" {
+			continue
+		}
+		cluster, err := argocd.ClusterFromSecretData(secret.Data)
+		if err != nil {
+			log.FromContext(ctx).Info("skipping invalid ArgoCD cluster secret in the inventory", "secret", client.ObjectKeyFromObject(secret), "error", err.Error())
+			continue
+		}
+		labels := map[string]string{}
+		for k, v := range secret.Labels {
+			if k != argoCDSecretTypeLabel {
+				labels[k] = v
+			}
+		}
+		inventory = append(inventory, InventoryCluster{
+			Name:          cluster.Name,
+			Namespace:     secret.Namespace,
+			Server:        cluster.Server,
+			HostedCluster: secret.Annotations[hyperOpsHostedClusterAnnotation],
+			Project:       cluster.Project,
+			Labels:        labels,
+		})
+	}
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Namespace != inventory[j].Namespace {
+			return inventory[i].Namespace < inventory[j].Namespace
+		}
+		return inventory[i].Name < inventory[j].Name
+	})
+	return inventory, nil
+}
+
+// ValidateInventoryPath returns an error if the inventory path is not a file path within the repository
+func ValidateInventoryPath(path string) error {
+	if path == "" {
+		return nil
+	}
+	clean := filepath.ToSlash(filepath.Clean(filepath.FromSlash(path)))
+	if filepath.IsAbs(path) || clean != path || clean == "." || strings.HasPrefix(clean, "../") || clean == ".." || strings.HasPrefix(clean, ".git/") {
+		return fmt.Errorf("invalid inventory path %q, must be a clean relative file path within the repository", path)
+	}
+	return nil
+}
+
+// InventoryWriter periodically commits the cluster inventory to a git repository, so ApplicationSets with a git files
+// generator and reviewers see the fleet as code. The repository is cloned with the git command line client, which must
+// be on the PATH of the operator.
+type InventoryWriter struct {
+	Client client.Client
+	// Repository is the URL of the git repository
+	Repository string
+	// Branch is the existing branch the inventory is committed to, DefaultInventoryBranch if empty
+	Branch string
+	// Path is the path of the inventory file in the repository, DefaultInventoryPath if empty
+	Path string
+	// DeployKeySecret holds the SSH deploy key of the repository in the sshPrivateKey key and the known hosts of its
+	// server in the knownHosts key, no key is used if empty
+	DeployKeySecret client.ObjectKey
+	// Interval at which the inventory is written
+	Interval time.Duration
+}
+
+// Start writes the inventory every interval until the context is done
+func (w *InventoryWriter) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("inventory")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		commit, err := w.Write(ctx)
+		if err != nil {
+			log.Error(err, "unable to write the cluster inventory", "repository", w.Repository)
+			return
+		}
+		if commit != "" {
+			log.Info("committed the cluster inventory", "repository", w.Repository, "commit", commit)
+		}
+	}, w.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader commits the inventory
+func (w *InventoryWriter) NeedLeaderElection() bool {
+	return true
+}
+
+// Write commits the inventory if it changed and returns the commit, empty if the inventory was up to date. A push
+// rejected because the branch moved is retried with a fresh clone on the next interval.
+func (w *InventoryWriter) Write(ctx context.Context) (string, error) {
+	inventory, err := GenerateInventory(ctx, w.Client)
+	if err != nil {
+		return "", err
+	}
+	data, err := yaml.Marshal(inventory)
+	if err != nil {
+		return "", err
+	}
+	data = append([]byte("# generated by hyper-ops, do not edit\n"), data...)
+
+	tmp, err := os.MkdirTemp("", "hyper-ops-inventory")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	env, err := w.gitEnv(ctx, tmp)
+	if err != nil {
+		return "", err
+	}
+	branch, path := w.branch(), w.path()
+	dir := filepath.Join(tmp, "repository")
+	if _, err := runGit(ctx, tmp, env, "clone", "--quiet", "--depth", "1", "--single-branch", "--branch", branch, w.Repository, dir); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return "", err
+	}
+	if _, err := runGit(ctx, dir, env, "add", "--", path); err != nil {
+		return "", err
+	}
+	status, err := runGit(ctx, dir, env, "status", "--porcelain", "--", path)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(status)) == 0 {
+		return "", nil
+	}
+	message := fmt.Sprintf("Update the hyper-ops cluster inventory\n\n%d registered clusters", len(inventory))
+	if _, err := runGit(ctx, dir, env, "commit", "--quiet", "--message", message); err != nil {
+		return "", err
+	}
+	if _, err := runGit(ctx, dir, env, "push", "--quiet", "origin", "HEAD:refs/heads/"+branch); err != nil {
+		return "", err
+	}
+	commit, err := runGit(ctx, dir, env, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(commit)), nil
+}
+
+func (w *InventoryWriter) branch() string {
+	if w.Branch == "" {
+		return DefaultInventoryBranch
+	}
+	return w.Branch
+}
+
+func (w *InventoryWriter) path() string {
+	if w.Path == "" {
+		return DefaultInventoryPath
+	}
+	return w.Path
+}
+
+// gitEnv returns the environment of the git commands. The home directory is the temporary directory, so no git
+// configuration of the operator image applies, and the deploy key is written there for ssh.
+func (w *InventoryWriter) gitEnv(ctx context.Context, tmp string) ([]string, error) {
+	env := []string{
+		"HOME=" + tmp,
+		"PATH=" + os.Getenv("PATH"),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_AUTHOR_NAME=" + inventoryCommitAuthor,
+		"GIT_AUTHOR_EMAIL=" + inventoryCommitEmail,
+		"GIT_COMMITTER_NAME=" + inventoryCommitAuthor,
+		"GIT_COMMITTER_EMAIL=" + inventoryCommitEmail,
+	}
+	if w.DeployKeySecret.Name == "" {
+		return env, nil
+	}
+	secret := &corev1.Secret{}
+	if err := w.Client.Get(ctx, w.DeployKeySecret, secret); err != nil {
+		return nil, fmt.Errorf("unable to get the deploy key secret %s: %w", w.DeployKeySecret, err)
+	}
+	key, knownHosts := secret.Data[inventorySSHPrivateKeyKey], secret.Data[inventoryKnownHostsKey]
+	if len(key) == 0 || len(knownHosts) == 0 {
+		return nil, fmt.Errorf("deploy key secret %s must have the %s and %s keys", w.DeployKeySecret, inventorySSHPrivateKeyKey, inventoryKnownHostsKey)
+	}
+	keyFile, knownHostsFile := filepath.Join(tmp, "deploy-key"), filepath.Join(tmp, "known_hosts")
+	if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(knownHostsFile, knownHosts, 0o600); err != nil {
+		return nil, err
+	}
+	return append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o UserKnownHostsFile=%s -o StrictHostKeyChecking=yes", keyFile, knownHostsFile)), nil
+}
+
+// runGit runs the git command in the directory and returns its output. The error includes the output of git, which
+// never contains the deploy key.
+func runGit(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Cluster inventory", func() {
+	var ctx = context.Background()
+
+	registration := func(namespace, name string, labels map[string]string) *corev1.Secret {
+		data, err := (&argocd.Cluster{Name: name, Server: "https://" + name + ":6443", Config: argocd.ClusterConfig{BearerToken: "secret-token"}}).SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/" + name},
+			},
+			Data: data,
+		}
+		for k, v := range labels {
+			secret.Labels[k] = v
+		}
+		return secret
+	}
+
+	It("Should list the registered clusters without credentials", func() {
+		manual := registration(defaultGitOpsNamespace, "manual", nil)
+		delete(manual.Labels, hyperOpsTypeLabel)
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			registration(defaultGitOpsNamespace, "b", map[string]string{"env": "prod"}),
+			registration(defaultGitOpsNamespace, "a", nil),
+			registration("team-gitops", "a", nil),
+			registration(defaultGitOpsNamespace, "deleted", map[string]string{hyperOpsPendingDeletionLabel: "true"}),
+			manual,
+		).Build()
+
+		inventory, err := GenerateInventory(ctx, c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory).To(HaveLen(3))
+		Expect(inventory[0]).To(Equal(InventoryCluster{
+			Name: "a", Namespace: defaultGitOpsNamespace, Server: "https://a:6443", HostedCluster: "clusters/a",
+			Labels: map[string]string{hyperOpsTypeLabel: "hosted"},
+		}))
+		Expect(inventory[1].Labels).To(HaveKeyWithValue("env", "prod"))
+		Expect(inventory[2].Namespace).To(Equal("team-gitops"))
+
+		data, err := yaml.Marshal(inventory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("secret-token"))
+	})
+
+	It("Should only accept paths within the repository", func() {
+		Expect(ValidateInventoryPath("clusters.yaml")).To(Succeed())
+		Expect(ValidateInventoryPath("fleet/clusters.yaml")).To(Succeed())
+		for _, path := range []string{"/clusters.yaml", "../clusters.yaml", "fleet/../../clusters.yaml", "./clusters.yaml", ".git/config", "."} {
+			Expect(ValidateInventoryPath(path)).NotTo(Succeed(), path)
+		}
+	})
+
+	It("Should commit the inventory when it changed", func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git is not installed")
+		}
+		tmp := GinkgoT().TempDir()
+		remote := filepath.Join(tmp, "remote.git")
+		git := func(dir string, args ...string) string {
+			out, err := runGit(ctx, dir, []string{"HOME=" + tmp, "PATH=" + os.Getenv("PATH"),
+				"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com"}, args...)
+			Expect(err).NotTo(HaveOccurred())
+			return string(out)
+		}
+		git(tmp, "init", "--quiet", "--bare", "--initial-branch", "main", remote)
+		seed := filepath.Join(tmp, "seed")
+		git(tmp, "clone", "--quiet", remote, seed)
+		Expect(os.WriteFile(filepath.Join(seed, "README.md"), []byte("fleet\n"), 0o644)).To(Succeed())
+		git(seed, "add", "README.md")
+		git(seed, "commit", "--quiet", "--message", "Initial commit")
+		git(seed, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(registration(defaultGitOpsNamespace, "a", nil)).Build()
+		w := &InventoryWriter{Client: c, Repository: remote, Path: "fleet/clusters.yaml"}
+		commit, err := w.Write(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commit).NotTo(BeEmpty())
+		Expect(git(tmp, "--git-dir", remote, "rev-parse", "main")).To(HavePrefix(commit))
+		content := git(tmp, "--git-dir", remote, "show", "main:fleet/clusters.yaml")
+		Expect(content).To(ContainSubstring("server: https://a:6443"))
+		Expect(content).NotTo(ContainSubstring("secret-token"))
+		Expect(git(tmp, "--git-dir", remote, "log", "-1", "--format=%an")).To(HavePrefix(inventoryCommitAuthor))
+
+		By("not committing an unchanged inventory")
+		commit, err = w.Write(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commit).To(BeEmpty())
+
+		By("committing a new registration")
+		Expect(c.Create(ctx, registration(defaultGitOpsNamespace, "b", nil))).To(Succeed())
+		commit, err = w.Write(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commit).NotTo(BeEmpty())
+		Expect(git(tmp, "--git-dir", remote, "show", "main:fleet/clusters.yaml")).To(ContainSubstring("server: https://b:6443"))
+	})
+
+	It("Should require the known hosts with a deploy key", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "inventory-deploy-key", Namespace: "hyper-ops"},
+			Data:       map[string][]byte{inventorySSHPrivateKeyKey: []byte("key")},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+		w := &InventoryWriter{Client: c, Repository: "git@example.com:fleet.git", DeployKeySecret: client.ObjectKeyFromObject(secret)}
+		_, err := w.gitEnv(ctx, GinkgoT().TempDir())
+		Expect(err).To(MatchError(ContainSubstring("knownHosts")))
+
+		secret.Data[inventoryKnownHostsKey] = []byte("example.com ssh-ed25519 AAAA")
+		Expect(c.Update(ctx, secret)).To(Succeed())
+		tmp := GinkgoT().TempDir()
+		env, err := w.gitEnv(ctx, tmp)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(ContainElement(ContainSubstring("StrictHostKeyChecking=yes")))
+		info, err := os.Stat(filepath.Join(tmp, "deploy-key"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	})
+})
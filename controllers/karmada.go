@@ -0,0 +1,186 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/version"
+)
+
+const (
+	// DefaultKarmadaNamespace is the namespace of the Karmada control plane holding the cluster secrets, the one
+	// karmadactl join uses
+	DefaultKarmadaNamespace = "karmada-cluster"
+
+	// karmadaTokenKey and karmadaCABundleKey hold the credential in the cluster secret, the keys Karmada reads
+	karmadaTokenKey    = "token"
+	karmadaCABundleKey = "caBundle"
+)
+
+var karmadaClusterGVK = schema.GroupVersionKind{Group: "cluster.karmada.io", Version: "v1alpha1", Kind: "Cluster"}
+
+// KarmadaRegistrar registers the HostedClusters with a Karmada control plane, like karmadactl join does for a cluster
+// in push mode. Every hosted cluster gets a secret holding the token of the registration and a Cluster, both named
+// after the HostedCluster, so PropagationPolicies distribute workloads to it next to ArgoCD.
+type KarmadaRegistrar struct {
+	// Client of the Karmada API server
+	Client    client.Client
+	Namespace string
+}
+
+var _ Registrar = &KarmadaRegistrar{}
+
+// NewKarmadaRegistrar returns a KarmadaRegistrar writing through the client of the Karmada API server
+func NewKarmadaRegistrar(c client.Client, config hyperopsv1alpha1.KarmadaConfig) (*KarmadaRegistrar, error) {
+	if config.KubeconfigSecret == "" {
+		return nil, fmt.Errorf("the karmada kubeconfig secret must not be empty")
+	}
+	if namespace, name, ok := strings.Cut(config.KubeconfigSecret, "/"); !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid karmada kubeconfig secret %q, must be <namespace>/<name>", config.KubeconfigSecret)
+	}
+	if config.Namespace == "" {
+		config.Namespace = DefaultKarmadaNamespace
+	}
+	if errs := validation.IsDNS1123Label(config.Namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid karmada namespace %q: %s", config.Namespace, strings.Join(errs, ", "))
+	}
+	return &KarmadaRegistrar{Client: c, Namespace: config.Namespace}, nil
+}
+
+// ValidateKarmadaConfig returns an error if no KarmadaRegistrar can be created from the config
+func ValidateKarmadaConfig(config *hyperopsv1alpha1.KarmadaConfig) error {
+	_, err := NewKarmadaRegistrar(nil, *config)
+	return err
+}
+
+// NewKarmadaClient returns a client of the Karmada API server with the kubeconfig in the kubeconfig key of the
+// <namespace>/<name> secret
+func NewKarmadaClient(ctx context.Context, reader client.Reader, ref string) (client.Client, error) {
+	kubeconfig, err := kubeconfigFromSecret(ctx, reader, "karmada", ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := GetClientForCluster(kubeconfig, WithUserAgent(fmt.Sprintf("hyper-ops/%s (karmada)", version.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid karmada kubeconfig: %w", err)
+	}
+	return c, nil
+}
+
+func (k *KarmadaRegistrar) Name() string {
+	return "karmada"
+}
+
+// Register writes the cluster secret and the Cluster of the HostedCluster. Karmada only takes bearer tokens, clusters
+// registered with a client certificate or a command are skipped.
+func (k *KarmadaRegistrar) Register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	config := cluster.Config
+	if config.ExecProviderConfig != nil || config.AWSAuthConfig != nil {
+		return fmt.Errorf("%w: the credential of cluster %s is obtained by a command", errCredentialNotExportable, cluster.Name)
+	}
+	if config.BearerToken == "" {
+		return fmt.Errorf("%w: karmada only takes bearer tokens, cluster %s has none", errCredentialNotExportable, cluster.Name)
+	}
+
+	// karmadactl join creates the namespace of the cluster secrets as well
+	namespace := &corev1.Namespace{}
+	if err := k.Client.Get(ctx, client.ObjectKey{Name: k.Namespace}, namespace); apierrors.IsNotFound(err) {
+		namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: k.Namespace}}
+		if err := k.Client.Create(ctx, namespace); client.IgnoreAlreadyExists(err) != nil {
+			return fmt.Errorf("unable to create the namespace of the cluster secrets: %w", err)
+		}
+	} else if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: hc.Name, Namespace: k.Namespace}}
+	if _, err := CreateOrUpdateWithRetries(ctx, k.Client, secret, func() error {
+		if err := claimRegistrarObject(secret, hc); err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{karmadaTokenKey: []byte(config.BearerToken)}
+		if len(config.TLSClientConfig.CAData) > 0 {
+			secret.Data[karmadaCABundleKey] = config.TLSClientConfig.CAData
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the cluster secret: %w", err)
+	}
+
+	karmadaCluster := &unstructured.Unstructured{}
+	karmadaCluster.SetGroupVersionKind(karmadaClusterGVK)
+	karmadaCluster.SetName(hc.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, k.Client, karmadaCluster, func() error {
+		if err := claimRegistrarObject(karmadaCluster, hc); err != nil {
+			return err
+		}
+		// Karmada labels the Cluster as well, only the hyper-ops labels are replaced, so PropagationPolicies select
+		// hosted clusters by the labels ApplicationSets use
+		existing := map[string]string{}
+		for key, v := range karmadaCluster.GetLabels() {
+			if !isHyperOpsLabel(key) {
+				existing[key] = v
+			}
+		}
+		karmadaCluster.SetLabels(mergeLabels(existing, cluster.LabelSchema.Apply(hostedClusterLabels(hc)), cluster.PolicyLabels))
+		spec, _, _ := unstructured.NestedMap(karmadaCluster.Object, "spec")
+		if spec == nil {
+			spec = map[string]interface{}{}
+		}
+		spec["syncMode"] = "Push"
+		spec["apiEndpoint"] = cluster.Server
+		spec["secretRef"] = map[string]interface{}{"namespace": k.Namespace, "name": secret.Name}
+		spec["insecureSkipTLSVerification"] = config.TLSClientConfig.Insecure
+		if provider := strings.ToLower(string(hc.Spec.Platform.Type)); provider != "" {
+			spec["provider"] = provider
+		}
+		if hc.Spec.Platform.AWS != nil && hc.Spec.Platform.AWS.Region != "" {
+			spec["region"] = hc.Spec.Platform.AWS.Region
+		}
+		karmadaCluster.Object["spec"] = spec
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the Cluster: %w", err)
+	}
+	return nil
+}
+
+// Deregister deletes the Cluster and the cluster secret of the HostedCluster. The Cluster goes first, so Karmada can
+// still remove the propagated workloads with the token.
+func (k *KarmadaRegistrar) Deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	karmadaCluster := &unstructured.Unstructured{}
+	karmadaCluster.SetGroupVersionKind(karmadaClusterGVK)
+	karmadaCluster.SetName(hc.Name)
+	if err := deleteRegistrarObjects(ctx, k.Client, hc, "", karmadaCluster); err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: hc.Name}}
+	return deleteRegistrarObjects(ctx, k.Client, hc, k.Namespace, secret)
+}
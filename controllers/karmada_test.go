@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Karmada registrar", func() {
+	hostedCluster := func() *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "uid"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{Platform: hypershiftv1beta1.PlatformSpec{
+				Type: hypershiftv1beta1.AWSPlatform,
+				AWS:  &hypershiftv1beta1.AWSPlatformSpec{Region: "eu-west-1"},
+			}},
+		}
+	}
+	cluster := &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   "hosted",
+			Server: "https://hosted:6443",
+			Config: argocd.ClusterConfig{BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+		},
+		PolicyLabels: map[string]string{"env": "prod"},
+	}
+	registrar := func(c client.Client) *KarmadaRegistrar {
+		k, err := NewKarmadaRegistrar(c, hyperopsv1alpha1.KarmadaConfig{KubeconfigSecret: "hyper-ops/karmada-kubeconfig"})
+		Expect(err).NotTo(HaveOccurred())
+		return k
+	}
+	karmadaCluster := func(c client.Client) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(karmadaClusterGVK)
+		return obj, c.Get(context.Background(), client.ObjectKey{Name: "hosted"}, obj)
+	}
+
+	It("Should validate the karmada config", func() {
+		Expect(ValidateKarmadaConfig(&hyperopsv1alpha1.KarmadaConfig{KubeconfigSecret: "hyper-ops/karmada-kubeconfig"})).To(Succeed())
+		Expect(ValidateKarmadaConfig(&hyperopsv1alpha1.KarmadaConfig{})).NotTo(Succeed())
+		Expect(ValidateKarmadaConfig(&hyperopsv1alpha1.KarmadaConfig{KubeconfigSecret: "karmada-kubeconfig"})).NotTo(Succeed())
+		Expect(ValidateKarmadaConfig(&hyperopsv1alpha1.KarmadaConfig{KubeconfigSecret: "hyper-ops/karmada-kubeconfig", Namespace: "Karmada"})).NotTo(Succeed())
+	})
+
+	It("Should join the cluster in push mode with the token of the registration", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(registrar(c).Register(context.Background(), hostedCluster(), cluster)).To(Succeed())
+
+		Expect(c.Get(context.Background(), client.ObjectKey{Name: DefaultKarmadaNamespace}, &corev1.Namespace{})).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: DefaultKarmadaNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+		Expect(secret.Data).To(HaveKeyWithValue(karmadaTokenKey, []byte("token")))
+		Expect(secret.Data).To(HaveKeyWithValue(karmadaCABundleKey, []byte("ca")))
+
+		obj, err := karmadaCluster(c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetLabels()).To(HaveKeyWithValue("env", "prod"))
+		Expect(obj.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+		Expect(spec).To(HaveKeyWithValue("syncMode", "Push"))
+		Expect(spec).To(HaveKeyWithValue("apiEndpoint", "https://hosted:6443"))
+		Expect(spec).To(HaveKeyWithValue("provider", "aws"))
+		Expect(spec).To(HaveKeyWithValue("region", "eu-west-1"))
+		Expect(spec).To(HaveKeyWithValue("secretRef", map[string]interface{}{"namespace": DefaultKarmadaNamespace, "name": "hosted"}))
+
+		// fields set by Karmada, e.g. the taints of the cluster, are kept
+		Expect(unstructured.SetNestedField(obj.Object, "cluster-id", "spec", "id")).To(Succeed())
+		Expect(c.Update(context.Background(), obj)).To(Succeed())
+		Expect(registrar(c).Register(context.Background(), hostedCluster(), cluster)).To(Succeed())
+		obj, err = karmadaCluster(c)
+		Expect(err).NotTo(HaveOccurred())
+		id, _, _ := unstructured.NestedString(obj.Object, "spec", "id")
+		Expect(id).To(Equal("cluster-id"))
+	})
+
+	It("Should not join clusters registered without a bearer token", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		certificate := &Cluster{Cluster: argocd.Cluster{
+			Name:   "hosted",
+			Server: "https://hosted:6443",
+			Config: argocd.ClusterConfig{TLSClientConfig: argocd.TLSClientConfig{CertData: []byte("cert"), KeyData: []byte("key")}},
+		}}
+		err := registrar(c).Register(context.Background(), hostedCluster(), certificate)
+		Expect(errors.Is(err, errCredentialNotExportable)).To(BeTrue())
+		_, err = karmadaCluster(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should deregister the cluster and leave clusters it did not write alone", func() {
+		foreign := &unstructured.Unstructured{}
+		foreign.SetGroupVersionKind(karmadaClusterGVK)
+		foreign.SetName("other")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(foreign).Build()
+		Expect(registrar(c).Register(context.Background(), hostedCluster(), cluster)).To(Succeed())
+
+		other := hostedCluster()
+		other.Name = "other"
+		Expect(registrar(c).Register(context.Background(), other, cluster)).NotTo(Succeed())
+		Expect(registrar(c).Deregister(context.Background(), other)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+
+		Expect(registrar(c).Deregister(context.Background(), hostedCluster())).To(Succeed())
+		_, err := karmadaCluster(c)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = c.Get(context.Background(), client.ObjectKey{Namespace: DefaultKarmadaNamespace, Name: "hosted"}, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should read the kubeconfig of the Karmada API server from a secret", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		_, err := NewKarmadaClient(context.Background(), c, "hyper-ops/missing")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = NewKarmadaClient(context.Background(), c, "karmada-kubeconfig")
+		Expect(err).To(MatchError(ContainSubstring("invalid karmada kubeconfig secret")))
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsKubeconfigContextAnnotation selects the context of the admin kubeconfig a HostedCluster is registered
+	// with, for kubeconfigs holding several clusters. The ArgoCD cluster secret records the context it was resolved
+	// from with the same annotation.
+	hyperOpsKubeconfigContextAnnotation = "hyper-ops.cloudmonkey.org/kubeconfig-context"
+
+	// ConditionKubeconfigContextResolved is true when the selected context of the admin kubeconfig was found
+	ConditionKubeconfigContextResolved = "KubeconfigContextResolved"
+)
+
+// kubeconfigContext returns the context of the admin kubeconfig selected by the HostedCluster, empty for the current
+// context
+func kubeconfigContext(hc *hypershiftv1beta1.HostedCluster) string {
+	return strings.TrimSpace(hc.GetAnnotations()[hyperOpsKubeconfigContextAnnotation])
+}
+
+// reportKubeconfigContext records how the selected context of the admin kubeconfig resolved. A context that resolves
+// to another server than the one registered for it is reported with the ServerChanged reason and a warning event,
+// kubeconfigs regenerated by a pipeline are expected to keep the server of a context.
+func (r *HyperOpsReconciler) reportKubeconfigContext(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace, contextName, server string, err error) error {
+	if contextName == "" {
+		return nil
+	}
+	condition := metav1.Condition{
+		Type:    ConditionKubeconfigContextResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Resolved",
+		Message: fmt.Sprintf("context %s resolves to %s", contextName, server),
+	}
+	if err != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "ContextNotFound", err.Error()
+	} else if previous, ok := r.registeredServer(ctx, hc, gitOpsNamespace, contextName); ok && previous != server {
+		log.FromContext(ctx).Info("kubeconfig context resolves to another server", "context", contextName, "server", server, "previousServer", previous)
+		condition.Reason = "ServerChanged"
+		condition.Message = fmt.Sprintf("context %s resolves to %s, the registration used %s", contextName, server, previous)
+		r.recordEvent(hc, corev1.EventTypeWarning, "KubeconfigServerChanged", condition.Message)
+	}
+	return r.setRegistrationCondition(ctx, hc, condition)
+}
+
+// registeredServer returns the server of the registration of the HostedCluster if it was resolved from the context
+func (r *HyperOpsReconciler) registeredServer(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace, contextName string) (string, bool) {
+	// the secrets of a remote ArgoCD aren't read
+	if r.remoteRegistrations() != nil {
+		return "", false
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return "", false
+	}
+	if !hyperOpsManaged(secret) || secret.Annotations[hyperOpsHostedClusterAnnotation] != client.ObjectKeyFromObject(hc).String() ||
+		secret.Annotations[hyperOpsKubeconfigContextAnnotation] != contextName {
+		return "", false
+	}
+	return string(secret.Data["server"]), true
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Kubeconfig contexts", func() {
+	var kubeconfig []byte
+
+	BeforeEach(func() {
+		config := clientcmdapi.NewConfig()
+		config.Clusters["private"] = &clientcmdapi.Cluster{Server: "https://api.private:6443"}
+		config.Clusters["public"] = &clientcmdapi.Cluster{Server: "https://api.example.com:443"}
+		config.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: "token"}
+		config.Contexts["private"] = &clientcmdapi.Context{Cluster: "private", AuthInfo: "admin"}
+		config.Contexts["public"] = &clientcmdapi.Context{Cluster: "public", AuthInfo: "admin"}
+		config.CurrentContext = "public"
+		var err error
+		kubeconfig, err = clientcmd.Write(*config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should resolve the client and the server from the same context", func() {
+		restConfig, server, err := GetRESTConfigForContext(kubeconfig, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server).To(Equal("https://api.example.com:443"))
+		Expect(restConfig.Host).To(Equal(server))
+
+		restConfig, server, err = GetRESTConfigForContext(kubeconfig, "private", WithUserAgent("hyper-ops/test"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server).To(Equal("https://api.private:6443"))
+		Expect(restConfig.Host).To(Equal(server))
+		Expect(restConfig.UserAgent).To(Equal("hyper-ops/test"))
+
+		_, _, err = GetRESTConfigForContext(kubeconfig, "internal")
+		Expect(err).To(MatchError(ContainSubstring(`context "internal" not found in the kubeconfig, it has the contexts private, public`)))
+	})
+
+	It("Should report a context resolving to another server than its registration", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:        "hosted",
+			Namespace:   "clusters",
+			Annotations: map[string]string{hyperOpsKubeconfigContextAnnotation: "private"},
+		}}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{
+					hyperOpsHostedClusterAnnotation:     "clusters/hosted",
+					hyperOpsKubeconfigContextAnnotation: "private",
+				},
+			},
+			Data: map[string][]byte{"server": []byte("https://api.private:6443")},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		Expect(kubeconfigContext(hc)).To(Equal("private"))
+		Expect(r.reportKubeconfigContext(context.Background(), hc, defaultGitOpsNamespace, "private", "https://api.private:6443", nil)).To(Succeed())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionKubeconfigContextResolved)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Reason).To(Equal("Resolved"))
+
+		Expect(r.reportKubeconfigContext(context.Background(), hc, defaultGitOpsNamespace, "private", "https://api.other:6443", nil)).To(Succeed())
+		condition = meta.FindStatusCondition(registrationConditions(hc), ConditionKubeconfigContextResolved)
+		Expect(condition.Reason).To(Equal("ServerChanged"))
+		Expect(condition.Message).To(ContainSubstring("the registration used https://api.private:6443"))
+
+		_, _, err := GetRESTConfigForContext(kubeconfig, "internal")
+		Expect(r.reportKubeconfigContext(context.Background(), hc, defaultGitOpsNamespace, "internal", "", err)).To(Succeed())
+		Expect(meta.IsStatusConditionFalse(registrationConditions(hc), ConditionKubeconfigContextResolved)).To(BeTrue())
+	})
+})
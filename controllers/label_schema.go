@@ -0,0 +1,259 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// LabelSchemaV1 writes the hyper-ops labels with the hyper-ops.cloudmonkey.org/ prefix
+	LabelSchemaV1 = "v1"
+	// LabelSchemaV2 writes the hyper-ops labels with the v2.hyper-ops.cloudmonkey.org/ prefix. Label names can't
+	// contain a slash, so the version is part of the prefix.
+	LabelSchemaV2 = "v2"
+
+	hyperOpsLabelV2 = "v2." + hyperOpsLabel
+)
+
+// unversionedLabels are the labels hyper-ops selects its own objects by, they keep their key in every schema
+var unversionedLabels = map[string]bool{
+	hyperOpsTypeLabel:                 true,
+	hyperOpsPendingDeletionLabel:      true,
+	hyperOpsAgentCredentialsLabel:     true,
+	hyperOpsCIOutputLabel:             true,
+	hyperOpsTokenConsumerLabel:        true,
+	hyperOpsImpersonationProjectLabel: true,
+}
+
+// LabelSchema is the schema the hyper-ops labels are written in. Labels of every schema are read, the internal
+// representation uses the keys of LabelSchemaV1.
+type LabelSchema struct {
+	// Version is LabelSchemaV1 or LabelSchemaV2, LabelSchemaV1 if empty
+	Version string
+	// KeepPrevious also writes the labels of the previous schema, so selectors can be moved to the new schema
+	// without a window in which no object matches
+	KeepPrevious bool
+}
+
+// ValidateLabelSchema returns an error if the label schema version is unknown
+func ValidateLabelSchema(version string) error {
+	switch version {
+	case LabelSchemaV1, LabelSchemaV2:
+		return nil
+	}
+	return fmt.Errorf("invalid label schema %q, must be %s or %s", version, LabelSchemaV1, LabelSchemaV2)
+}
+
+// labelSchemaName returns the name of a versioned hyper-ops label of either schema, false for other labels
+func labelSchemaName(key string) (string, bool) {
+	if unversionedLabels[key] {
+		return "", false
+	}
+	if name, ok := strings.CutPrefix(key, hyperOpsLabelV2+"/"); ok {
+		return name, true
+	}
+	return strings.CutPrefix(key, hyperOpsLabel+"/")
+}
+
+// isHyperOpsLabel returns true for the labels of hyper-ops in any schema
+func isHyperOpsLabel(key string) bool {
+	return strings.HasPrefix(key, hyperOpsLabel+"/") || strings.HasPrefix(key, hyperOpsLabelV2+"/")
+}
+
+// canonicalLabels returns the labels with the versioned hyper-ops labels of all schemas under their v1 key, the newer
+// schema wins if a label is set in both
+func canonicalLabels(labels map[string]string) map[string]string {
+	canonical := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if name, ok := labelSchemaName(k); ok && strings.HasPrefix(k, hyperOpsLabelV2) {
+			canonical[hyperOpsLabel+"/"+name] = v
+		}
+	}
+	for k, v := range labels {
+		if name, ok := labelSchemaName(k); ok {
+			if _, set := canonical[hyperOpsLabel+"/"+name]; set {
+				continue
+			}
+			canonical[hyperOpsLabel+"/"+name] = v
+			continue
+		}
+		canonical[k] = v
+	}
+	return canonical
+}
+
+// hostedClusterLabel returns the value of the hyper-ops label, given by its v1 key, in any schema
+func hostedClusterLabel(obj metav1.Object, key string) (string, bool) {
+	v, ok := canonicalLabels(obj.GetLabels())[key]
+	return v, ok
+}
+
+// setSchemaLabel sets the versioned hyper-ops label, given by its v1 key, in the schemas the other hyper-ops labels
+// are written in, v1 if there are none. An empty value removes the label from all schemas.
+func setSchemaLabel(labels map[string]string, key, value string) {
+	name, _ := labelSchemaName(key)
+	v2Key := hyperOpsLabelV2 + "/" + name
+	v1, v2 := false, false
+	for k := range labels {
+		if _, ok := labelSchemaName(k); ok {
+			v2 = v2 || strings.HasPrefix(k, hyperOpsLabelV2)
+			v1 = v1 || strings.HasPrefix(k, hyperOpsLabel)
+		}
+	}
+	delete(labels, key)
+	delete(labels, v2Key)
+	if value == "" {
+		return
+	}
+	if v2 {
+		labels[v2Key] = value
+	}
+	if v1 || !v2 {
+		labels[key] = value
+	}
+}
+
+// Key returns the key of the versioned hyper-ops label, given by its v1 key, in the schema
+func (s LabelSchema) Key(key string) string {
+	if name, ok := labelSchemaName(key); ok && s.Version == LabelSchemaV2 {
+		return hyperOpsLabelV2 + "/" + name
+	}
+	return key
+}
+
+// Apply returns the labels with the versioned hyper-ops labels of any schema written in the schema, labels of the
+// other schema are dropped unless KeepPrevious is set. The labels are never modified.
+func (s LabelSchema) Apply(labels map[string]string) map[string]string {
+	if s.Version != LabelSchemaV2 {
+		return canonicalLabels(labels)
+	}
+	applied := map[string]string{}
+	for k, v := range canonicalLabels(labels) {
+		name, ok := labelSchemaName(k)
+		if !ok {
+			applied[k] = v
+			continue
+		}
+		applied[hyperOpsLabelV2+"/"+name] = v
+		if s.KeepPrevious {
+			applied[k] = v
+		}
+	}
+	return applied
+}
+
+// LabelSchemaMigrator rewrites the labels of the ArgoCD cluster secrets of hosted clusters, and optionally of the
+// HostedClusters, in the label schema. Every object is converted with a single patch and the labels are read in every
+// schema, so the registrations keep working during the migration.
+type LabelSchemaMigrator struct {
+	Client   client.Client
+	Schema   LabelSchema
+	Interval time.Duration
+	// HostedClusters also migrates the labels of the HostedClusters. They are owned by the user, usually by the
+	// tooling creating the HostedClusters, so they are left alone unless this is set.
+	HostedClusters bool
+	// ReadOnly skips the runs while it returns true, e.g. while the operator is frozen
+	ReadOnly func() bool
+}
+
+// Migrate rewrites the labels of the objects that are not in the label schema and returns the migrated objects
+func (m *LabelSchemaMigrator) Migrate(ctx context.Context) ([]string, error) {
+	migrated := []string{}
+	if m.HostedClusters {
+		hcs := &hypershiftv1beta1.HostedClusterList{}
+		if err := m.Client.List(ctx, hcs); err != nil {
+			return migrated, err
+		}
+		for i := range hcs.Items {
+			ok, err := m.migrate(ctx, &hcs.Items[i])
+			if err != nil {
+				return migrated, err
+			}
+			if ok {
+				migrated = append(migrated, "hostedcluster/"+client.ObjectKeyFromObject(&hcs.Items[i]).String())
+			}
+		}
+	}
+	secrets := &corev1.SecretList{}
+	if err := m.Client.List(ctx, secrets, client.MatchingLabels{hyperOpsTypeLabel: "hosted"}); err != nil {
+		return migrated, err
+	}
+	for i := range secrets.Items {
+		ok, err := m.migrate(ctx, &secrets.Items[i])
+		if err != nil {
+			return migrated, err
+		}
+		if ok {
+			migrated = append(migrated, "secret/"+client.ObjectKeyFromObject(&secrets.Items[i]).String())
+		}
+	}
+	return migrated, nil
+}
+
+func (m *LabelSchemaMigrator) migrate(ctx context.Context, obj client.Object) (bool, error) {
+	labels := m.Schema.Apply(obj.GetLabels())
+	if reflect.DeepEqual(labels, obj.GetLabels()) || (len(labels) == 0 && len(obj.GetLabels()) == 0) {
+		return false, nil
+	}
+	// the optimistic lock makes sure labels changed since the list are not reverted
+	patch := client.MergeFromWithOptions(obj.DeepCopyObject().(client.Object), client.MergeFromWithOptimisticLock{})
+	obj.SetLabels(labels)
+	if err := m.Client.Patch(ctx, obj, patch); apierrors.IsConflict(err) {
+		// migrated with the next run
+		return false, nil
+	} else if client.IgnoreNotFound(err) != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Start runs the migrator until the context is cancelled, it implements manager.Runnable
+func (m *LabelSchemaMigrator) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("label-schema-migration")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if m.ReadOnly != nil && m.ReadOnly() {
+			log.V(1).Info("read-only, skipping")
+			return
+		}
+		migrated, err := m.Migrate(ctx)
+		if err != nil {
+			log.Error(err, "unable to migrate the label schema")
+		}
+		if len(migrated) > 0 {
+			log.Info("migrated labels", "schema", m.Schema.Version, "objects", migrated)
+		}
+	}, m.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader migrates labels
+func (m *LabelSchemaMigrator) NeedLeaderElection() bool {
+	return true
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Label schema", func() {
+	const (
+		v2Enabled = "v2.hyper-ops.cloudmonkey.org/enabled"
+		v2Env     = "v2.hyper-ops.cloudmonkey.org/env"
+		v1Env     = "hyper-ops.cloudmonkey.org/env"
+	)
+
+	It("Should validate the label schema", func() {
+		Expect(ValidateLabelSchema(LabelSchemaV1)).To(Succeed())
+		Expect(ValidateLabelSchema(LabelSchemaV2)).To(Succeed())
+		Expect(ValidateLabelSchema("v3")).NotTo(Succeed())
+	})
+
+	It("Should read the labels of both schemas, the newer schema wins", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			v2Enabled: "false", hyperOpsEnabledLabel: "true", v1Env: "prod", "team": "a",
+		}}}
+		Expect(canonicalLabels(hc.Labels)).To(Equal(map[string]string{hyperOpsEnabledLabel: "false", v1Env: "prod", "team": "a"}))
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentEnabled)).To(BeFalse())
+
+		hc.Labels = map[string]string{v2Enabled: "true", v2Env: "prod"}
+		Expect(hostedClusterEnrolled(hc, DefaultEnrollmentDisabled)).To(BeTrue())
+		Expect(hostedClusterLabels(hc)).To(HaveKeyWithValue(hyperOpsEnabledLabel, "true"))
+		Expect(hostedClusterLabels(hc)).To(HaveKeyWithValue(v1Env, "prod"))
+		Expect(hostedClusterLabels(hc)).NotTo(HaveKey(v2Env))
+	})
+
+	It("Should write the labels in the schema", func() {
+		labels := map[string]string{v1Env: "prod", hyperOpsTypeLabel: "hosted", "team": "a"}
+		Expect(LabelSchema{}.Apply(labels)).To(Equal(labels))
+		Expect(LabelSchema{Version: LabelSchemaV2}.Apply(labels)).To(Equal(map[string]string{
+			v2Env: "prod", hyperOpsTypeLabel: "hosted", "team": "a",
+		}))
+		Expect(LabelSchema{Version: LabelSchemaV2, KeepPrevious: true}.Apply(labels)).To(Equal(map[string]string{
+			v2Env: "prod", v1Env: "prod", hyperOpsTypeLabel: "hosted", "team": "a",
+		}))
+		Expect(LabelSchema{Version: LabelSchemaV1}.Apply(map[string]string{v2Env: "prod"})).To(Equal(map[string]string{v1Env: "prod"}))
+		Expect(labels).To(HaveLen(3))
+
+		r := &HyperOpsReconciler{LabelSchema: LabelSchema{Version: LabelSchemaV2}}
+		secretLabels, _ := r.argoCDClusterSecretMetadata(defaultGitOpsNamespace, labels, &Cluster{Cluster: argocd.Cluster{Name: "hosted"}})
+		Expect(secretLabels).To(HaveKeyWithValue(v2Env, "prod"))
+		Expect(secretLabels).NotTo(HaveKey(v1Env))
+		Expect(secretLabels).To(HaveKeyWithValue(hyperOpsTypeLabel, "hosted"))
+	})
+
+	It("Should set labels in the schemas of the object", func() {
+		labels := map[string]string{}
+		setSchemaLabel(labels, hyperOpsExcludedLabel, "true")
+		Expect(labels).To(Equal(map[string]string{hyperOpsExcludedLabel: "true"}))
+
+		labels = map[string]string{v2Env: "prod", hyperOpsTypeLabel: "hosted"}
+		setSchemaLabel(labels, hyperOpsExcludedLabel, "true")
+		Expect(labels).To(HaveKeyWithValue("v2.hyper-ops.cloudmonkey.org/excluded", "true"))
+		Expect(labels).NotTo(HaveKey(hyperOpsExcludedLabel))
+		setSchemaLabel(labels, hyperOpsExcludedLabel, "")
+		Expect(labels).To(Equal(map[string]string{v2Env: "prod", hyperOpsTypeLabel: "hosted"}))
+	})
+
+	It("Should migrate the ArgoCD cluster secrets and, if enabled, the HostedClusters to the schema", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", Labels: map[string]string{hyperOpsEnabledLabel: "true", "team": "a"},
+		}}
+		unlabeled := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "clusters"}}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: defaultGitOpsNamespace,
+			Labels: map[string]string{hyperOpsTypeLabel: "hosted", v1Env: "prod", argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+		}}
+		foreign := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: "foreign", Namespace: defaultGitOpsNamespace, Labels: map[string]string{v1Env: "prod"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, unlabeled, secret, foreign).Build()
+		m := &LabelSchemaMigrator{Client: c, Schema: LabelSchema{Version: LabelSchemaV2}}
+
+		By("leaving the user owned labels of the HostedClusters alone by default")
+		migrated, err := m.Migrate(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(ConsistOf("secret/openshift-gitops/hosted"))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Labels).To(Equal(map[string]string{hyperOpsEnabledLabel: "true", "team": "a"}))
+
+		m.HostedClusters = true
+		migrated, err = m.Migrate(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(ConsistOf("hostedcluster/clusters/hosted"))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Labels).To(Equal(map[string]string{v2Enabled: "true", "team": "a"}))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		Expect(secret.Labels).To(Equal(map[string]string{
+			hyperOpsTypeLabel: "hosted", v2Env: "prod", argoCDSecretTypeLabel: argoCDSecretTypeCluster,
+		}))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+		Expect(foreign.Labels).To(HaveKey(v1Env))
+
+		migrated, err = m.Migrate(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeEmpty())
+	})
+})
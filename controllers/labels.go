@@ -0,0 +1,122 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+const (
+	// hyperOpsDisabledBuiltinLabelsAnnotation lists the comma separated groups and keys of built-in labels that are
+	// not added to the ArgoCD cluster secret of the HostedCluster
+	hyperOpsDisabledBuiltinLabelsAnnotation = "hyper-ops.cloudmonkey.org/disabled-builtin-labels"
+
+	// BuiltinLabelsHostedCluster are the hyper-ops labels copied from the HostedCluster
+	BuiltinLabelsHostedCluster = "hostedcluster"
+	// BuiltinLabelsCompliance are the FIPS and architecture labels
+	BuiltinLabelsCompliance = "compliance"
+	// BuiltinLabelsTopology are the NodePool topology labels
+	BuiltinLabelsTopology = "topology"
+	// BuiltinLabelsLifecycle is the workers label
+	BuiltinLabelsLifecycle = "lifecycle"
+)
+
+// mergeLabels returns a new map with the labels of all layers, later layers take precedence. The layers are never
+// modified.
+func mergeLabels(layers ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, layer := range layers {
+		for k, v := range layer {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// disabledBuiltinLabels returns the groups and keys of built-in labels disabled for the HostedCluster. The type label
+// is always applied, it marks the secret as owned by hyper-ops.
+func disabledBuiltinLabels(hc *hypershiftv1beta1.HostedCluster) map[string]bool {
+	disabled := map[string]bool{}
+	for _, group := range strings.Split(hc.GetAnnotations()[hyperOpsDisabledBuiltinLabelsAnnotation], ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			// keys can be given in any label schema
+			if name, ok := labelSchemaName(group); ok {
+				group = hyperOpsLabel + "/" + name
+			}
+			disabled[group] = true
+		}
+	}
+	return disabled
+}
+
+// hostedClusterLabels returns the labels of the ArgoCD cluster secret of the HostedCluster, from lowest to highest
+// precedence: the hyper-ops labels of the HostedCluster, the compliance labels, the excluded label and the type label.
+// Topology labels, policy labels and discovery labels are merged on top by the later phases.
+func hostedClusterLabels(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	disabled := disabledBuiltinLabels(hc)
+	layers := []map[string]string{}
+	if !disabled[BuiltinLabelsHostedCluster] {
+		// only keep the labels that are related to hyper-ops, in any label schema
+		own := map[string]string{}
+		for k, v := range canonicalLabels(hc.GetLabels()) {
+			if strings.HasPrefix(k, hyperOpsLabel) {
+				own[k] = v
+			}
+		}
+		layers = append(layers, own)
+	}
+	if !disabled[BuiltinLabelsCompliance] {
+		layers = append(layers, complianceLabels(hc))
+	}
+	layers = append(layers, excludedLabels(hc), map[string]string{hyperOpsTypeLabel: "hosted"})
+	return removeBuiltinLabels(hc, mergeLabels(layers...), disabled)
+}
+
+// builtinLabelGroup returns the group of a built-in label of the HostedCluster, empty for the type label and labels
+// that are not built-in
+func builtinLabelGroup(hc *hypershiftv1beta1.HostedCluster, key string) string {
+	switch {
+	case key == hyperOpsTypeLabel, key == hyperOpsExcludedLabel:
+		return ""
+	case key == hyperOpsFIPSLabel, key == hyperOpsArchLabel:
+		return BuiltinLabelsCompliance
+	case key == hyperOpsNodePoolReplicasLabel, key == hyperOpsKubevirtInfraClusterLabel, key == hyperOpsKubevirtInfraNamespaceLabel,
+		strings.HasPrefix(key, hyperOpsArchLabelPrefix), strings.HasPrefix(key, hyperOpsPlatformLabelPrefix):
+		return BuiltinLabelsTopology
+	case key == hyperOpsWorkersLabel:
+		return BuiltinLabelsLifecycle
+	}
+	if _, ok := hostedClusterLabel(hc, key); ok && strings.HasPrefix(key, hyperOpsLabel) {
+		return BuiltinLabelsHostedCluster
+	}
+	return ""
+}
+
+// removeBuiltinLabels removes the built-in labels whose group or key is disabled from the labels and returns them
+func removeBuiltinLabels(hc *hypershiftv1beta1.HostedCluster, labels map[string]string, disabled map[string]bool) map[string]string {
+	if len(disabled) == 0 {
+		return labels
+	}
+	for k := range labels {
+		if group := builtinLabelGroup(hc, k); group != "" && (disabled[group] || disabled[k]) {
+			delete(labels, k)
+		}
+	}
+	return labels
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Cluster secret labels", func() {
+	hostedCluster := func(annotations map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: annotations,
+				Labels: map[string]string{
+					"hyper-ops.cloudmonkey.org/env":  "prod",
+					"hyper-ops.cloudmonkey.org/type": "local",
+					"example.com/team":               "a",
+				},
+			},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				Release: hypershiftv1beta1.Release{Image: "quay.io/openshift-release-dev/ocp-release:4.12.0-x86_64"},
+			},
+		}
+	}
+
+	It("Should merge the layers into a new map with later layers taking precedence", func() {
+		base := map[string]string{"a": "1", "b": "1"}
+		override := map[string]string{"b": "2"}
+		merged := mergeLabels(base, nil, override)
+		Expect(merged).To(Equal(map[string]string{"a": "1", "b": "2"}))
+		Expect(base).To(Equal(map[string]string{"a": "1", "b": "1"}))
+		Expect(override).To(Equal(map[string]string{"b": "2"}))
+		Expect(mergeLabels()).To(BeEmpty())
+	})
+
+	It("Should apply all built-in labels by default and never let the HostedCluster override the type", func() {
+		Expect(hostedClusterLabels(hostedCluster(nil))).To(Equal(map[string]string{
+			"hyper-ops.cloudmonkey.org/env":  "prod",
+			"hyper-ops.cloudmonkey.org/type": "hosted",
+			"hyper-ops.cloudmonkey.org/fips": "false",
+			"hyper-ops.cloudmonkey.org/arch": "amd64",
+		}))
+	})
+
+	It("Should skip the disabled groups of built-in labels", func() {
+		hc := hostedCluster(map[string]string{hyperOpsDisabledBuiltinLabelsAnnotation: "hostedcluster, compliance,unknown"})
+		Expect(disabledBuiltinLabels(hc)).To(HaveKey(BuiltinLabelsCompliance))
+		Expect(hostedClusterLabels(hc)).To(Equal(map[string]string{"hyper-ops.cloudmonkey.org/type": "hosted"}))
+	})
+
+	It("Should skip disabled keys of built-in labels but never the type", func() {
+		hc := hostedCluster(map[string]string{hyperOpsDisabledBuiltinLabelsAnnotation: "hyper-ops.cloudmonkey.org/env,hyper-ops.cloudmonkey.org/arch,hyper-ops.cloudmonkey.org/type"})
+		Expect(hostedClusterLabels(hc)).To(Equal(map[string]string{
+			"hyper-ops.cloudmonkey.org/type": "hosted",
+			"hyper-ops.cloudmonkey.org/fips": "false",
+		}))
+
+		labels := map[string]string{
+			"hyper-ops.cloudmonkey.org/platform-kubevirt": "true",
+			"hyper-ops.cloudmonkey.org/nodepool-replicas": "3",
+			"example.com/team": "a",
+		}
+		Expect(removeBuiltinLabels(hc, labels, map[string]bool{BuiltinLabelsTopology: true})).To(Equal(map[string]string{"example.com/team": "a"}))
+	})
+
+	It("Should not modify the labels of the caller when writing the cluster secret", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, DiscoveryLabels: map[string]map[string]string{"*": {"example.com/fleet": "prod"}}}
+		labels := map[string]string{"hyper-ops.cloudmonkey.org/type": "hosted"}
+		cluster := &Cluster{
+			Cluster:         argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"},
+			HostedCluster:   hostedCluster(nil),
+			GitOpsNamespace: defaultGitOpsNamespace,
+		}
+		Expect(r.createArgoCDClusterSecret(context.Background(), labels, cluster)).To(Succeed())
+		Expect(labels).To(Equal(map[string]string{"hyper-ops.cloudmonkey.org/type": "hosted"}))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/type", "hosted"))
+		Expect(secret.Labels).To(HaveKeyWithValue("example.com/fleet", "prod"))
+		Expect(secret.Labels).To(HaveKeyWithValue("argocd.argoproj.io/secret-type", "cluster"))
+	})
+})
@@ -0,0 +1,52 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+// localClusterName is the name of the ArgoCD cluster secret of the management cluster
+const localClusterName = "in-cluster-local"
+
+// localCluster returns the ArgoCD cluster of the management cluster. By default it carries the verified token of the
+// hyper-ops service account in kube-system, with LocalClusterInCluster it carries no credentials and ArgoCD uses its
+// own service account, the service account of hyper-ops and its token are removed from the management cluster.
+func (r *HyperOpsReconciler) localCluster(ctx context.Context) (*Cluster, error) {
+	if r.LocalClusterInCluster {
+		if err := r.removeLocalClusterCredentials(ctx); err != nil {
+			return nil, err
+		}
+		return &Cluster{Cluster: argocd.Cluster{Name: localClusterName, Server: argocd.InClusterServer}}, nil
+	}
+	cluster, err := r.setupClusterConfig(ctx, r.Client, argocd.InClusterServer, localClusterName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verifyClusterToken(ctx, r.Client, cluster); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// removeLocalClusterCredentials deletes the token secret, the service account and the cluster role binding hyper-ops
+// created on the management cluster for the in-cluster registration
+func (r *HyperOpsReconciler) removeLocalClusterCredentials(ctx context.Context) error {
+	return r.removeServiceAccountCredentials(ctx, r.Client)
+}
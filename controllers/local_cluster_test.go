@@ -0,0 +1,89 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("In-cluster local registration", func() {
+	var (
+		managed = map[string]string{managedByLabel: managedByValue}
+		token   *corev1.Secret
+		sa      *corev1.ServiceAccount
+		crb     *rbacv1.ClusterRoleBinding
+	)
+
+	BeforeEach(func() {
+		token = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: legacyTokenSecretName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		crb = &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName, Labels: managed}}
+	})
+
+	It("Should register the management cluster without credentials and remove the token of hyper-ops", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(token, sa, crb).Build()
+		r := &HyperOpsReconciler{Client: c, LocalClusterInCluster: true}
+
+		cluster, err := r.localCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Name).To(Equal(localClusterName))
+		Expect(cluster.Server).To(Equal(argocd.InClusterServer))
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := argocd.ClusterFromSecretData(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Config.BearerToken).To(BeEmpty())
+
+		for _, obj := range []client.Object{token, sa, crb} {
+			err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), obj)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue(), client.ObjectKeyFromObject(obj).String())
+		}
+	})
+
+	It("Should keep objects it didn't create and leave everything alone in dry-run mode", func() {
+		token.Labels = nil
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(token, sa).Build()
+		r := &HyperOpsReconciler{Client: c, LocalClusterInCluster: true, DryRun: true}
+
+		_, err := r.localCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+
+		r.DryRun = false
+		_, err = r.localCluster(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(token), token)).To(Succeed())
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,71 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/pkg/version"
+)
+
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByValue = "hyper-ops"
+
+	// hyperOpsControllerVersionAnnotation records the version of the controller that last wrote the object
+	hyperOpsControllerVersionAnnotation = "hyper-ops.cloudmonkey.org/controller-version"
+	// hyperOpsCorrelationIDAnnotation correlates the objects of a registration on the hub and the hosted cluster
+	hyperOpsCorrelationIDAnnotation = "hyper-ops.cloudmonkey.org/correlation-id"
+)
+
+// correlationID returns the correlation ID of the registration of the HostedCluster, the UID of the HostedCluster.
+// Registrations of the local cluster have no correlation ID.
+func correlationID(hc *hypershiftv1beta1.HostedCluster) string {
+	if hc == nil {
+		return ""
+	}
+	return string(hc.UID)
+}
+
+// managedLabels adds the managed-by label to the labels
+func managedLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[managedByLabel] = managedByValue
+	return labels
+}
+
+// managedAnnotations adds the controller version and the correlation ID to the annotations
+func managedAnnotations(annotations map[string]string, correlationID string) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[hyperOpsControllerVersionAnnotation] = version.Version
+	if correlationID != "" {
+		annotations[hyperOpsCorrelationIDAnnotation] = correlationID
+	}
+	return annotations
+}
+
+// stampManaged marks the object as managed by hyper-ops, so hyper-ops owned objects can be identified on the hub and
+// on the hosted clusters
+func stampManaged(obj metav1.Object, correlationID string) {
+	obj.SetLabels(managedLabels(obj.GetLabels()))
+	obj.SetAnnotations(managedAnnotations(obj.GetAnnotations(), correlationID))
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+	"github.com/cldmnky/hyper-ops/pkg/version"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Managed by", func() {
+
+	It("Should stamp the ArgoCD cluster secret with managed-by, version and correlation ID", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "1234"},
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c}
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{}, cluster)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsControllerVersionAnnotation, version.Version))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsCorrelationIDAnnotation, "1234"))
+
+		Expect(r.releaseArgoCDClusterSecret(context.Background(), client.ObjectKeyFromObject(secret))).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		Expect(secret.Labels).NotTo(HaveKey(managedByLabel))
+		Expect(secret.Annotations).NotTo(HaveKey(hyperOpsCorrelationIDAnnotation))
+	})
+
+	It("Should stamp objects on the hosted cluster", func() {
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(ensureServiceAccount(context.Background(), hosted, "1234", DefaultHostedClusterRole)).To(Succeed())
+
+		sa := &corev1.ServiceAccount{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: hostedClusterServiceAccountNamespace, Name: hostedClusterServiceAccountName}, sa)).To(Succeed())
+		Expect(sa.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		Expect(sa.Annotations).To(HaveKeyWithValue(hyperOpsCorrelationIDAnnotation, "1234"))
+	})
+})
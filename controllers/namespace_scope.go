@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// hyperOpsNamespacesAnnotation restricts the ArgoCD cluster of the HostedCluster to a comma separated list of
+	// namespaces of the hosted cluster
+	hyperOpsNamespacesAnnotation = "hyper-ops.cloudmonkey.org/namespaces"
+	// hyperOpsClusterResourcesAnnotation lets ArgoCD manage cluster scoped resources of a namespace scoped cluster
+	hyperOpsClusterResourcesAnnotation = "hyper-ops.cloudmonkey.org/cluster-resources"
+)
+
+// namespaceScope returns the sorted namespaces the ArgoCD cluster of the HostedCluster is restricted to, none if it
+// isn't restricted, and whether ArgoCD may manage cluster scoped resources of the restricted cluster, the default
+// unless the HostedCluster sets the cluster-resources annotation
+func namespaceScope(hc *hypershiftv1beta1.HostedCluster, defaultClusterResources bool) ([]string, bool, error) {
+	raw := hc.GetAnnotations()[hyperOpsNamespacesAnnotation]
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, ns := range strings.Split(raw, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, false, fmt.Errorf("invalid namespace %q in the %s annotation: %s", ns, hyperOpsNamespacesAnnotation, strings.Join(errs, ", "))
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	clusterResources := defaultClusterResources
+	if v, ok := hc.GetAnnotations()[hyperOpsClusterResourcesAnnotation]; ok {
+		var err error
+		if clusterResources, err = strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+			return nil, false, fmt.Errorf("invalid %s annotation %q, must be true or false", hyperOpsClusterResourcesAnnotation, v)
+		}
+	}
+	if len(namespaces) == 0 {
+		return nil, false, nil
+	}
+	return namespaces, clusterResources, nil
+}
+
+// applyNamespaceScope restricts the ArgoCD cluster to the namespaces selected by the HostedCluster
+func (r *HyperOpsReconciler) applyNamespaceScope(hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	namespaces, clusterResources, err := namespaceScope(hc, r.ClusterResources)
+	if err != nil {
+		return err
+	}
+	cluster.Namespaces, cluster.ClusterResources = namespaces, clusterResources
+	return nil
+}
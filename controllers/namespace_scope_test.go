@@ -0,0 +1,114 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Namespace scoped clusters", func() {
+	var (
+		hc      *hypershiftv1beta1.HostedCluster
+		cluster *Cluster
+		r       *HyperOpsReconciler
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		cluster = &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted:6443"}, HostedCluster: hc}
+		r = &HyperOpsReconciler{}
+	})
+
+	It("Should not restrict clusters without the namespaces annotation", func() {
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).NotTo(HaveKey("namespaces"))
+		Expect(data).NotTo(HaveKey("clusterResources"))
+	})
+
+	It("Should restrict the cluster to the namespaces of the annotation", func() {
+		hc.Annotations = map[string]string{
+			hyperOpsNamespacesAnnotation:       " team-b, team-a,,team-b",
+			hyperOpsClusterResourcesAnnotation: "true",
+		}
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("namespaces", []byte("team-a,team-b")))
+		Expect(data).To(HaveKeyWithValue("clusterResources", []byte("true")))
+
+		// removing the annotation lifts the restriction
+		delete(hc.Annotations, hyperOpsNamespacesAnnotation)
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		Expect(cluster.Namespaces).To(BeEmpty())
+		Expect(cluster.ClusterResources).To(BeFalse())
+	})
+
+	It("Should write the default cluster resources unless the HostedCluster overrides them", func() {
+		r.ClusterResources = true
+		hc.Annotations = map[string]string{hyperOpsNamespacesAnnotation: "team-a"}
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("clusterResources", []byte("true")))
+
+		hc.Annotations[hyperOpsClusterResourcesAnnotation] = "false"
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		data, err = cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("clusterResources", []byte("false")))
+	})
+
+	It("Should reject invalid namespaces and cluster resources", func() {
+		hc.Annotations = map[string]string{hyperOpsNamespacesAnnotation: "team-a,Team_B"}
+		Expect(r.applyNamespaceScope(hc, cluster)).NotTo(Succeed())
+		hc.Annotations = map[string]string{hyperOpsNamespacesAnnotation: "team-a", hyperOpsClusterResourcesAnnotation: "yes please"}
+		Expect(r.applyNamespaceScope(hc, cluster)).NotTo(Succeed())
+	})
+
+	It("Should expose the namespaces to registration policies", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{Name: "namespace-scoped", Validate: `size(registration.namespaces) > 0`, Message: "clusters must be namespace scoped"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).To(MatchError(ContainSubstring("clusters must be namespace scoped")))
+
+		hc.Annotations = map[string]string{hyperOpsNamespacesAnnotation: "team-a"}
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("Should expose the cluster resources to registration policies", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{Name: "no-cluster-resources", Validate: `!registration.clusterResources`, Message: "clusters must not manage cluster scoped resources"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		hc.Annotations = map[string]string{hyperOpsNamespacesAnnotation: "team-a", hyperOpsClusterResourcesAnnotation: "true"}
+		Expect(r.applyNamespaceScope(hc, cluster)).To(Succeed())
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).To(MatchError(ContainSubstring("must not manage cluster scoped resources")))
+	})
+})
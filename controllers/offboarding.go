@@ -0,0 +1,169 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ConditionOffboarded is true when the registration of a HostedCluster labeled enabled=false was removed
+const ConditionOffboarded = "Offboarded"
+
+// removeRegistration deletes the ArgoCD cluster secret of the HostedCluster and everything written along with it
+func (r *HyperOpsReconciler) removeRegistration(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if err := r.deleteArgoCDClusterSecret(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hc.Name,
+			Namespace: gitOpsNamespace,
+		},
+	}); client.IgnoreNotFound(err) != nil && !isInvariantViolation(err) {
+		return err
+	}
+	if err := r.removeAgentCredentials(ctx, hc, gitOpsNamespace); err != nil {
+		return err
+	}
+	if err := r.removeAudienceTokens(ctx, hc, nil); err != nil {
+		return err
+	}
+	if err := r.removeCIOutputs(ctx, hc, nil); err != nil {
+		return err
+	}
+	if err := r.removeBootstrapApplication(ctx, hc, gitOpsNamespace); err != nil {
+		return err
+	}
+	if err := r.deregister(ctx, hc); err != nil {
+		return err
+	}
+	if err := r.removeGitOpsNamespaceCopies(ctx, hc, nil); err != nil {
+		return err
+	}
+	if err := r.removeClusterRegistration(ctx, hc); err != nil {
+		return err
+	}
+	if err := r.removeClusterAppProject(ctx, hc, gitOpsNamespace); err != nil {
+		return err
+	}
+	return r.removeTenantRBAC(ctx, hc, gitOpsNamespace)
+}
+
+// offboardingRequired returns true if the HostedCluster labeled enabled=false still has a registration, either
+// because it carries the cleanup finalizer or its ArgoCD cluster secret still exists
+func (r *HyperOpsReconciler) offboardingRequired(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (bool, error) {
+	if canonicalLabels(hc.GetLabels())[hyperOpsEnabledLabel] != "false" {
+		return false, nil
+	}
+	if controllerutil.ContainsFinalizer(hc, hyperOpsFinalizer) {
+		return true, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return hyperOpsManaged(secret) && secret.Labels[hyperOpsPendingDeletionLabel] != "true" &&
+		secret.Annotations[hyperOpsHostedClusterAnnotation] == client.ObjectKeyFromObject(hc).String(), nil
+}
+
+// offboard deregisters a HostedCluster labeled enabled=false. The service account of hyper-ops in the hosted cluster
+// is only removed with OffboardHostedRBAC, the HostedCluster is released once everything is gone.
+func (r *HyperOpsReconciler) offboard(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	log.FromContext(ctx).Info("HostedCluster is labeled enabled=false, offboarding it")
+	forgetClusterInfo(client.ObjectKeyFromObject(hc))
+	if err := r.removeRegistration(ctx, hc, gitOpsNamespace); err != nil {
+		return fmt.Errorf("unable to remove the registration: %w", err)
+	}
+	message := "the registration was removed"
+	if r.OffboardHostedRBAC && !r.readOnly() {
+		if err := r.removeHostedRBAC(ctx, hc); err != nil {
+			if cerr := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+				Type:    ConditionOffboarded,
+				Status:  metav1.ConditionFalse,
+				Reason:  "HostedRBACCleanupFailed",
+				Message: err.Error(),
+			}); cerr != nil {
+				return cerr
+			}
+			return fmt.Errorf("unable to remove the service account in the hosted cluster: %w", err)
+		}
+		message = "the registration and the service account in the hosted cluster were removed"
+	}
+	offboarded := metav1.Condition{
+		Type:    ConditionOffboarded,
+		Status:  metav1.ConditionTrue,
+		Reason:  "EnabledLabelFalse",
+		Message: message,
+	}
+	if conditionChanged(hc, offboarded) {
+		r.recordEvent(hc, corev1.EventTypeNormal, EventDeregistered, message)
+	}
+	if err := r.setRegistrationCondition(ctx, hc, offboarded); err != nil {
+		return err
+	}
+	return r.removeFinalizer(ctx, hc)
+}
+
+// removeHostedRBAC removes the service account of hyper-ops from the hosted cluster of the HostedCluster
+func (r *HyperOpsReconciler) removeHostedRBAC(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	kubeConfigSecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: fmt.Sprintf("%s-admin-kubeconfig", hc.Name)}, kubeConfigSecret); err != nil {
+		// without a kubeconfig there is no hosted cluster left to clean up
+		return client.IgnoreNotFound(err)
+	}
+	restConfig, _, err := GetRESTConfigForContext(kubeConfigSecret.Data["kubeconfig"], kubeconfigContext(hc),
+		WithUserAgent(HostedClusterUserAgent(hc.Namespace, hc.Name)),
+		WithHeaders(r.HostedClusterHeaders))
+	if err != nil {
+		return err
+	}
+	hostedClient, err := r.hostedClient(hc, restConfig)
+	if err != nil {
+		return err
+	}
+	return deleteHostedRBAC(ctx, hostedClient)
+}
+
+// deleteHostedRBAC deletes the service account of hyper-ops, its cluster role binding and the bundled cluster role
+// through the hosted cluster client, objects not created by hyper-ops are kept
+func deleteHostedRBAC(ctx context.Context, hostedClient client.Client) error {
+	for _, obj := range []client.Object{
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: BundledHostedClusterRole}},
+	} {
+		if err := hostedClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if obj.GetLabels()[managedByLabel] != managedByValue {
+			continue
+		}
+		if err := hostedClient.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
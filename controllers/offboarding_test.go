@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Offboarding", func() {
+
+	It("Should remove the registration of a HostedCluster labeled enabled=false", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:       "hosted",
+			Namespace:  "clusters",
+			Labels:     map[string]string{hyperOpsEnabledLabel: "false"},
+			Finalizers: []string{hyperOpsFinalizer},
+		}}
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        "hosted",
+			Namespace:   defaultGitOpsNamespace,
+			Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+			Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/hosted"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		required, err := r.offboardingRequired(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(required).To(BeTrue())
+		Expect(r.offboard(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), hc)).To(Succeed())
+		Expect(hc.Finalizers).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionOffboarded)).To(BeTrue())
+
+		By("not offboarding it again once the registration is gone")
+		required, err = r.offboardingRequired(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(required).To(BeFalse())
+	})
+
+	It("Should not offboard HostedClusters that were never registered", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:      "hosted",
+			Namespace: "clusters",
+			Labels:    map[string]string{hyperOpsEnabledLabel: "false"},
+		}}
+		unmanaged := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, unmanaged).Build()
+		r := &HyperOpsReconciler{Client: c}
+
+		required, err := r.offboardingRequired(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(required).To(BeFalse())
+
+		hc.Labels = nil
+		required, err = r.offboardingRequired(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(required).To(BeFalse())
+	})
+
+	It("Should only delete the service account of hyper-ops in the hosted cluster", func() {
+		managed := map[string]string{managedByLabel: managedByValue}
+		crb := &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName, Labels: managed}}
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace,
+		}}
+		hostedClient := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(crb, sa).Build()
+
+		Expect(deleteHostedRBAC(context.Background(), hostedClient)).To(Succeed())
+		err := hostedClient.Get(context.Background(), client.ObjectKeyFromObject(crb), &rbacv1.ClusterRoleBinding{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(hostedClient.Get(context.Background(), client.ObjectKeyFromObject(sa), &corev1.ServiceAccount{})).To(Succeed())
+
+		By("tolerating objects that are already gone")
+		Expect(deleteHostedRBAC(context.Background(), hostedClient)).To(Succeed())
+	})
+})
@@ -0,0 +1,230 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsOrphanedAtAnnotation records when the orphan reaper first failed to revoke the credential of a
+	// registration whose HostedCluster disappeared
+	hyperOpsOrphanedAtAnnotation = "hyper-ops.cloudmonkey.org/orphaned-at"
+
+	// DefaultOrphanRevocationTimeout is the time the orphan reaper retries the revocation before it gives up
+	DefaultOrphanRevocationTimeout = time.Hour
+
+	// orphanRevocationRequestTimeout caps a single request against a hosted cluster that may no longer exist
+	orphanRevocationRequestTimeout = 10 * time.Second
+)
+
+// OrphanedRegistration is a registration found by the orphan reaper
+type OrphanedRegistration struct {
+	Secret        string
+	HostedCluster string
+	// Revoked is true if the service account of hyper-ops was removed from the hosted cluster
+	Revoked bool
+	// Deleted is true if the ArgoCD cluster secret was deleted. Registrations whose revocation failed are kept until
+	// the revocation timeout passed.
+	Deleted bool
+	// Error is the error of the revocation
+	Error string
+}
+
+// OrphanReaper removes the registrations of HostedClusters that disappeared without their finalizer running, e.g.
+// because their namespace was force-deleted. Before the ArgoCD cluster secret is deleted, the token it holds is
+// revoked by deleting the service account of hyper-ops in the hosted cluster, using the connection config of the
+// secret as the last known way to reach the hosted cluster.
+type OrphanReaper struct {
+	Client   client.Client
+	Interval time.Duration
+	// RevocationTimeout is the time a failing revocation is retried before the registration is deleted anyway,
+	// DefaultOrphanRevocationTimeout if zero
+	RevocationTimeout time.Duration
+	// Headers are added to every request against a hosted cluster
+	Headers map[string]string
+	// ReadOnly skips the runs while it returns true, e.g. while the operator is frozen
+	ReadOnly func() bool
+
+	// newClient creates the client of the hosted cluster, replaced in tests
+	newClient func(*rest.Config) (client.Client, error)
+}
+
+// Reap revokes the credentials of orphaned registrations and deletes their ArgoCD cluster secrets
+func (o *OrphanReaper) Reap(ctx context.Context, now time.Time) ([]OrphanedRegistration, error) {
+	secrets := &corev1.SecretList{}
+	if err := o.Client.List(ctx, secrets, client.MatchingLabels{hyperOpsTypeLabel: "hosted"}); err != nil {
+		return nil, err
+	}
+	orphans := []OrphanedRegistration{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		ref, ok := secret.Annotations[hyperOpsHostedClusterAnnotation]
+		// secrets pending deletion are already deregistered, the sweeper deletes them
+		if !ok || secret.Labels[hyperOpsPendingDeletionLabel] == "true" {
+			continue
+		}
+		namespace, name, _ := strings.Cut(ref, "/")
+		hc := &hypershiftv1beta1.HostedCluster{}
+		if err := o.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, hc); client.IgnoreNotFound(err) != nil {
+			return orphans, err
+		} else if err == nil {
+			continue
+		}
+		orphan := OrphanedRegistration{Secret: client.ObjectKeyFromObject(secret).String(), HostedCluster: ref}
+		revoked, err := o.revoke(ctx, secret, namespace, name)
+		orphan.Revoked = revoked
+		if err != nil {
+			orphan.Error = err.Error()
+			orphanedAt, perr := time.Parse(time.RFC3339, secret.Annotations[hyperOpsOrphanedAtAnnotation])
+			if perr != nil {
+				patch := client.MergeFrom(secret.DeepCopy())
+				metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsOrphanedAtAnnotation, now.UTC().Format(time.RFC3339))
+				if err := o.Client.Patch(ctx, secret, patch); client.IgnoreNotFound(err) != nil {
+					return orphans, err
+				}
+				orphans = append(orphans, orphan)
+				continue
+			}
+			if now.Before(orphanedAt.Add(o.revocationTimeout())) {
+				orphans = append(orphans, orphan)
+				continue
+			}
+		}
+		if err := o.Client.Delete(ctx, secret, client.Preconditions{UID: &secret.UID}); client.IgnoreNotFound(err) != nil {
+			return orphans, err
+		}
+		orphan.Deleted = true
+		orphans = append(orphans, orphan)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Secret < orphans[j].Secret
+	})
+	return orphans, nil
+}
+
+// revoke removes the legacy token secret and the service account of hyper-ops from the hosted cluster with the
+// credential of the ArgoCD cluster secret, which invalidates all tokens of the service account. The cluster role
+// binding is kept, deleting it first would take away the permission to delete the service account. Registrations
+// without a token, e.g. those using the client certificate of the admin kubeconfig, have nothing to revoke.
+func (o *OrphanReaper) revoke(ctx context.Context, secret *corev1.Secret, namespace, name string) (bool, error) {
+	// copies share the credential of the registration they were copied from
+	if _, ok := secret.Annotations[hyperOpsCopyOfAnnotation]; ok {
+		return false, nil
+	}
+	cluster, err := argocd.ClusterFromSecretData(secret.Data)
+	if err != nil {
+		return false, fmt.Errorf("unable to read the registration: %w", err)
+	}
+	if cluster.Config.BearerToken == "" {
+		return false, nil
+	}
+	restConfig := &rest.Config{
+		Host:        cluster.Server,
+		BearerToken: cluster.Config.BearerToken,
+		Timeout:     orphanRevocationRequestTimeout,
+		TLSClientConfig: rest.TLSClientConfig{
+			Insecure:   cluster.Config.TLSClientConfig.Insecure,
+			ServerName: cluster.Config.TLSClientConfig.ServerName,
+			CAData:     cluster.Config.TLSClientConfig.CAData,
+			CertData:   cluster.Config.TLSClientConfig.CertData,
+			KeyData:    cluster.Config.TLSClientConfig.KeyData,
+		},
+	}
+	WithUserAgent(HostedClusterUserAgent(namespace, name))(restConfig)
+	WithHeaders(o.Headers)(restConfig)
+	newClient := o.newClient
+	if newClient == nil {
+		newClient = func(c *rest.Config) (client.Client, error) {
+			return client.New(c, client.Options{Scheme: scheme.Scheme})
+		}
+	}
+	hostedClient, err := newClient(restConfig)
+	if err != nil {
+		return false, err
+	}
+	for _, obj := range []client.Object{
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: legacyTokenSecretName, Namespace: hostedClusterServiceAccountNamespace}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace}},
+	} {
+		if err := hostedClient.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			// a rejected token was already revoked, e.g. by a previous attempt
+			if apierrors.IsUnauthorized(err) {
+				return true, nil
+			}
+			if client.IgnoreNotFound(err) != nil {
+				return false, fmt.Errorf("unable to reach the hosted cluster: %w", err)
+			}
+			continue
+		}
+		if obj.GetLabels()[managedByLabel] != managedByValue {
+			continue
+		}
+		if err := hostedClient.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return false, fmt.Errorf("unable to revoke the token: %w", err)
+		}
+	}
+	return true, nil
+}
+
+func (o *OrphanReaper) revocationTimeout() time.Duration {
+	if o.RevocationTimeout > 0 {
+		return o.RevocationTimeout
+	}
+	return DefaultOrphanRevocationTimeout
+}
+
+// Start runs the reaper until the context is cancelled, it implements manager.Runnable
+func (o *OrphanReaper) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("orphan-reaper")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if o.ReadOnly != nil && o.ReadOnly() {
+			log.V(1).Info("read-only, skipping")
+			return
+		}
+		orphans, err := o.Reap(ctx, time.Now())
+		if err != nil {
+			log.Error(err, "unable to reap orphaned registrations")
+		}
+		for _, orphan := range orphans {
+			log.Info("orphaned registration", "secret", orphan.Secret, "hostedCluster", orphan.HostedCluster,
+				"revoked", orphan.Revoked, "deleted", orphan.Deleted, "error", orphan.Error)
+		}
+	}, o.Interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader reaps registrations
+func (o *OrphanReaper) NeedLeaderElection() bool {
+	return true
+}
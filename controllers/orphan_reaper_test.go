@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Orphan reaper", func() {
+	var (
+		managed      = map[string]string{managedByLabel: managedByValue}
+		hostedClient client.Client
+		restConfigs  []*rest.Config
+		sa           *corev1.ServiceAccount
+		now          time.Time
+	)
+
+	registration := func(name string, config argocd.ClusterConfig) *corev1.Secret {
+		data, err := (&Cluster{Cluster: argocd.Cluster{Name: name, Server: "https://" + name + ":6443", Config: config}}).SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: defaultGitOpsNamespace,
+				Labels: map[string]string{
+					argoCDSecretTypeLabel: argoCDSecretTypeCluster,
+					hyperOpsTypeLabel:     "hosted",
+				},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/" + name},
+			},
+			Data: data,
+		}
+	}
+
+	reaper := func(objs ...client.Object) *OrphanReaper {
+		return &OrphanReaper{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build(),
+			newClient: func(c *rest.Config) (client.Client, error) {
+				restConfigs = append(restConfigs, c)
+				return hostedClient, nil
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		restConfigs = nil
+		now = time.Now()
+		sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name: hostedClusterServiceAccountName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		token := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name: legacyTokenSecretName, Namespace: hostedClusterServiceAccountNamespace, Labels: managed,
+		}}
+		hostedClient = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(sa, token).Build()
+	})
+
+	It("Should revoke the token of an orphaned registration before deleting it", func() {
+		orphan := registration("deleted", argocd.ClusterConfig{BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}})
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "alive", Namespace: "clusters"}}
+		alive := registration("alive", argocd.ClusterConfig{BearerToken: "token"})
+		o := reaper(orphan, hc, alive)
+
+		orphans, err := o.Reap(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(Equal([]OrphanedRegistration{{Secret: "openshift-gitops/deleted", HostedCluster: "clusters/deleted", Revoked: true, Deleted: true}}))
+		Expect(restConfigs).To(HaveLen(1))
+		Expect(restConfigs[0].Host).To(Equal("https://deleted:6443"))
+		Expect(restConfigs[0].BearerToken).To(Equal("token"))
+		Expect(restConfigs[0].CAData).To(Equal([]byte("ca")))
+		Expect(restConfigs[0].UserAgent).To(Equal(HostedClusterUserAgent("clusters", "deleted")))
+
+		err = hostedClient.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = o.Client.Get(context.Background(), client.ObjectKeyFromObject(orphan), orphan)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		Expect(o.Client.Get(context.Background(), client.ObjectKeyFromObject(alive), alive)).To(Succeed())
+	})
+
+	It("Should delete orphaned registrations without a token right away", func() {
+		orphan := registration("deleted", argocd.ClusterConfig{TLSClientConfig: argocd.TLSClientConfig{CertData: []byte("cert"), KeyData: []byte("key")}})
+		o := reaper(orphan)
+
+		orphans, err := o.Reap(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(HaveLen(1))
+		Expect(orphans[0].Revoked).To(BeFalse())
+		Expect(orphans[0].Deleted).To(BeTrue())
+		Expect(restConfigs).To(BeEmpty())
+		Expect(hostedClient.Get(context.Background(), client.ObjectKeyFromObject(sa), sa)).To(Succeed())
+	})
+
+	It("Should retry a failing revocation until the revocation timeout passed", func() {
+		orphan := registration("deleted", argocd.ClusterConfig{BearerToken: "token"})
+		o := reaper(orphan)
+		o.RevocationTimeout = time.Hour
+		o.newClient = func(*rest.Config) (client.Client, error) { return nil, errors.New("no such host") }
+
+		orphans, err := o.Reap(context.Background(), now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans).To(HaveLen(1))
+		Expect(orphans[0].Deleted).To(BeFalse())
+		Expect(orphans[0].Error).To(ContainSubstring("no such host"))
+		Expect(o.Client.Get(context.Background(), client.ObjectKeyFromObject(orphan), orphan)).To(Succeed())
+		Expect(orphan.Annotations).To(HaveKeyWithValue(hyperOpsOrphanedAtAnnotation, now.UTC().Format(time.RFC3339)))
+
+		orphans, err = o.Reap(context.Background(), now.Add(30*time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans[0].Deleted).To(BeFalse())
+
+		orphans, err = o.Reap(context.Background(), now.Add(2*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(orphans[0].Revoked).To(BeFalse())
+		Expect(orphans[0].Deleted).To(BeTrue())
+		err = o.Client.Get(context.Background(), client.ObjectKeyFromObject(orphan), orphan)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should leave orphaned registrations to the reaper in the consistency check", func() {
+		orphan := registration("deleted", argocd.ClusterConfig{BearerToken: "token"})
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(orphan).Build()
+
+		violations, err := checkConsistency(context.Background(), c, nil, nil, true, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(violations).To(HaveLen(1))
+		Expect(violations[0].Repaired).To(BeFalse())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(orphan), orphan)).To(Succeed())
+	})
+})
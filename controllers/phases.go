@@ -0,0 +1,507 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// PhaseResolveConfig loads the admin kubeconfig of the hosted cluster and resolves its server
+	PhaseResolveConfig = "ResolveConfig"
+	// PhaseEnsureHostedRBAC maintains the service accounts hyper-ops and ArgoCD use in the hosted cluster
+	PhaseEnsureHostedRBAC = "EnsureHostedRBAC"
+	// PhaseObtainCredential issues and verifies the credential written to the ArgoCD cluster secret
+	PhaseObtainCredential = "ObtainCredential"
+	// PhaseRenderSecret computes the labels and the content of the ArgoCD cluster secret
+	PhaseRenderSecret = "RenderSecret"
+	// PhaseWriteOutputs writes the ArgoCD cluster secret and the outputs derived from it
+	PhaseWriteOutputs = "WriteOutputs"
+	// PhaseVerify checks the written registration and completes pending migrations
+	PhaseVerify = "Verify"
+)
+
+var (
+	phaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "hyperops_registration_phase_duration_seconds",
+		Help: "Duration of the registration phases of a HostedCluster reconcile.",
+	}, []string{"phase"})
+	phaseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hyperops_registration_phase_errors_total",
+		Help: "Number of failed registration phases.",
+	}, []string{"phase"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(phaseDuration, phaseErrors)
+}
+
+// registration is the state handed from one registration phase to the next
+type registration struct {
+	hc *hypershiftv1beta1.HostedCluster
+	// gitOpsNamespace is the gitops namespace the registration is written to
+	gitOpsNamespace string
+	restConfig      *rest.Config
+	// kubeconfigContext is the context of the admin kubeconfig selected by the HostedCluster, empty for the current
+	// context
+	kubeconfigContext string
+	// caBundle is the additional CA bundle referenced by the HostedCluster, trusted next to the kubeconfig CA
+	caBundle          []byte
+	hostedClient      client.Client
+	server            string
+	cluster           *Cluster
+	labels            map[string]string
+	capabilities      ArgoCDCapabilities
+	requeueAfter      time.Duration
+	renderedSecretKey client.ObjectKey
+	// gitOpsNamespaceCopies are the additional gitops namespaces the registration was written to
+	gitOpsNamespaceCopies []string
+	renderedData          map[string][]byte
+	// issuer requests bound tokens from the hosted cluster, nil without bound tokens
+	issuer *tokenIssuer
+	// waiting explains why a phase stopped the reconcile until something else changes
+	waiting string
+}
+
+// registrationPhase is a step of the registration of a HostedCluster. A phase returns true to end the reconcile
+// early without an error, e.g. when the registration is handed to another HostedCluster. A phase waiting for
+// something else to change sets the waiting message of the registration before it stops.
+type registrationPhase struct {
+	Name string
+	Run  func(ctx context.Context, reg *registration) (bool, error)
+}
+
+// phaseConditionType returns the registration condition reporting the phase
+func phaseConditionType(phase string) string {
+	return fmt.Sprintf("%sSucceeded", phase)
+}
+
+// registrationPhases returns the phases of a registration in order
+func (r *HyperOpsReconciler) registrationPhases() []registrationPhase {
+	return []registrationPhase{
+		{Name: PhaseResolveConfig, Run: r.resolveConfigPhase},
+		{Name: PhaseEnsureHostedRBAC, Run: r.ensureHostedRBACPhase},
+		{Name: PhaseObtainCredential, Run: r.obtainCredentialPhase},
+		{Name: PhaseRenderSecret, Run: r.renderSecretPhase},
+		{Name: PhaseWriteOutputs, Run: r.writeOutputsPhase},
+		{Name: PhaseVerify, Run: r.verifyPhase},
+	}
+}
+
+// runPhases runs the phases in order, every phase reports its outcome in its own registration condition and in
+// the phase metrics. The first failing phase ends the reconcile and is retried with the usual backoff.
+func (r *HyperOpsReconciler) runPhases(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string, phases []registrationPhase) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	reg := &registration{hc: hc, gitOpsNamespace: gitOpsNamespace}
+	// the Registered event is only emitted when the HostedCluster was not registered before this reconcile
+	registered := !conditionChanged(hc, metav1.Condition{
+		Type:    phaseConditionType(PhaseVerify),
+		Status:  metav1.ConditionTrue,
+		Reason:  "PhaseSucceeded",
+		Message: fmt.Sprintf("%s succeeded", PhaseVerify),
+	})
+	for _, phase := range phases {
+		start := time.Now()
+		stop, err := phase.Run(ctx, reg)
+		phaseDuration.WithLabelValues(phase.Name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			phaseErrors.WithLabelValues(phase.Name).Inc()
+			log.V(3).Error(err, "registration phase failed", "phase", phase.Name)
+			condition := metav1.Condition{
+				Type:    phaseConditionType(phase.Name),
+				Status:  metav1.ConditionFalse,
+				Reason:  "PhaseFailed",
+				Message: err.Error(),
+			}
+			if conditionChanged(hc, condition) {
+				r.recordEvent(hc, corev1.EventTypeWarning, phaseFailureEvent(phase.Name), err.Error())
+			}
+			if cerr := r.setRegistrationCondition(ctx, hc, condition); cerr != nil {
+				log.V(3).Error(cerr, "unable to record the phase condition", "phase", phase.Name)
+			}
+			r.recordClusterRegistration(ctx, reg, phase.Name, true, err)
+			return ctrl.Result{}, err
+		}
+		condition := metav1.Condition{
+			Type:    phaseConditionType(phase.Name),
+			Status:  metav1.ConditionTrue,
+			Reason:  "PhaseSucceeded",
+			Message: fmt.Sprintf("%s succeeded", phase.Name),
+		}
+		if reg.waiting != "" {
+			condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, "Waiting", reg.waiting
+		}
+		if err := r.setRegistrationCondition(ctx, hc, condition); err != nil {
+			return ctrl.Result{}, err
+		}
+		if stop {
+			r.recordClusterRegistration(ctx, reg, phase.Name, true, nil)
+			return ctrl.Result{RequeueAfter: reg.requeueAfter}, nil
+		}
+	}
+	if !registered && phases[len(phases)-1].Name == PhaseVerify {
+		r.recordEvent(hc, corev1.EventTypeNormal, EventRegistered, fmt.Sprintf("registered %s in the ArgoCD cluster secret %s",
+			reg.server, reg.renderedSecretKey))
+	}
+	r.recordClusterRegistration(ctx, reg, phases[len(phases)-1].Name, false, nil)
+	return ctrl.Result{RequeueAfter: reg.requeueAfter}, nil
+}
+
+// resolveConfigPhase loads the admin kubeconfig of the hosted cluster and makes sure the registration owns its
+// server
+func (r *HyperOpsReconciler) resolveConfigPhase(ctx context.Context, reg *registration) (bool, error) {
+	log := log.FromContext(ctx)
+	hc := reg.hc
+	kubeConfigSecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: fmt.Sprintf("%s-admin-kubeconfig", hc.Name)}, kubeConfigSecret); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			// the kubeconfig is created by HyperShift, its creation triggers a new reconcile through the HostedCluster
+			log.V(3).Info("kubeconfig secret does not exist yet")
+			reg.waiting = fmt.Sprintf("waiting for the kubeconfig secret %s-admin-kubeconfig", hc.Name)
+			if conditionChanged(hc, metav1.Condition{
+				Type:    phaseConditionType(PhaseResolveConfig),
+				Status:  metav1.ConditionFalse,
+				Reason:  "Waiting",
+				Message: reg.waiting,
+			}) {
+				r.recordEvent(hc, corev1.EventTypeNormal, EventKubeconfigMissing, reg.waiting)
+			}
+			return true, nil
+		}
+		return false, fmt.Errorf("unable to fetch kubeconfig secret: %w", err)
+	}
+	var err error
+	// the client and the registered server are resolved from the same context of the kubeconfig
+	reg.kubeconfigContext = kubeconfigContext(hc)
+	reg.restConfig, reg.server, err = GetRESTConfigForContext(kubeConfigSecret.Data["kubeconfig"], reg.kubeconfigContext,
+		WithUserAgent(HostedClusterUserAgent(hc.Namespace, hc.Name)),
+		WithHeaders(r.HostedClusterHeaders))
+	if rerr := r.reportKubeconfigContext(ctx, hc, reg.gitOpsNamespace, reg.kubeconfigContext, reg.server, err); rerr != nil {
+		return false, rerr
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to load hosted cluster kubeconfig: %w", err)
+	}
+	if err := applyInsecureSkipTLSVerify(hc, reg.restConfig); err != nil {
+		return false, err
+	}
+	if reg.caBundle, err = r.additionalCABundle(ctx, hc); err != nil {
+		return false, err
+	}
+	if !reg.restConfig.Insecure && reg.caBundle != nil {
+		reg.restConfig.CAData = mergeCABundles(reg.restConfig.CAData, reg.caBundle)
+	}
+	if reg.hostedClient, err = r.hostedClient(hc, reg.restConfig); err != nil {
+		return false, fmt.Errorf("unable to create hosted cluster client: %w", err)
+	}
+
+	// only one registration may point at a server, the others are flagged with the DuplicateServer condition
+	winner, duplicates, err := r.resolveDuplicateServer(ctx, hc, reg.server)
+	if err != nil {
+		return false, fmt.Errorf("unable to check for duplicate servers: %w", err)
+	}
+	if winner != hc {
+		log.Info("server is already registered by another HostedCluster", "server", reg.server, "hostedCluster", client.ObjectKeyFromObject(winner))
+		if err := r.deregisterArgoCDClusterSecrets(ctx, hc, reg.gitOpsNamespace); err != nil {
+			return false, err
+		}
+		return true, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionDuplicateServer,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ServerRegisteredByOther",
+			Message: fmt.Sprintf("server %s is registered by HostedCluster %s", reg.server, client.ObjectKeyFromObject(winner)),
+		})
+	}
+	for i := range duplicates {
+		log.Info("removing duplicate registration of server", "server", reg.server, "secret", client.ObjectKeyFromObject(&duplicates[i]))
+		if err := r.deleteArgoCDClusterSecret(ctx, &duplicates[i]); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+	}
+	if err := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionDuplicateServer,
+		Status:  metav1.ConditionFalse,
+		Reason:  "UniqueServer",
+		Message: fmt.Sprintf("server %s is only registered by this HostedCluster", reg.server),
+	}); err != nil {
+		return false, err
+	}
+
+	// a recreated HostedCluster must not inherit the credentials of its predecessor
+	if err := r.detectRecreation(ctx, hc, reg.gitOpsNamespace); err != nil {
+		return false, fmt.Errorf("unable to check the cluster identity: %w", err)
+	}
+	// credentials outliving the maximum credential age are flagged and possibly quarantined before they are renewed
+	if err := r.enforceMaxCredentialAge(ctx, hc, reg.gitOpsNamespace); err != nil {
+		return false, fmt.Errorf("unable to check the credential age: %w", err)
+	}
+	// new registrations are held back while their group is at its quota
+	return r.enforceQuotas(ctx, reg)
+}
+
+// ensureHostedRBACPhase maintains the service accounts in the hosted cluster besides the one of hyper-ops, which is
+// created with its credential
+func (r *HyperOpsReconciler) ensureHostedRBACPhase(ctx context.Context, reg *registration) (bool, error) {
+	if err := r.cleanupAgent(ctx, reg.hostedClient, reg.hc, reg.gitOpsNamespace); err != nil {
+		return false, fmt.Errorf("unable to remove the agent: %w", err)
+	}
+	if err := r.leaveStandalone(ctx, reg.hc); err != nil {
+		return false, err
+	}
+	// destination service accounts for ArgoCD impersonation, syncs of an AppProject run as its service account
+	return r.reconcileImpersonation(ctx, reg.hostedClient, reg.hc)
+}
+
+// obtainCredentialPhase issues the credential of the registration and verifies it against the hosted cluster. In
+// the client certificate auth mode the client certificate of the admin kubeconfig is used instead, in the AWS exec
+// provider auth mode ArgoCD obtains its own credential.
+func (r *HyperOpsReconciler) obtainCredentialPhase(ctx context.Context, reg *registration) (bool, error) {
+	hc := reg.hc
+	mode, err := r.authMode(hc)
+	if err != nil {
+		return false, err
+	}
+	if mode == AuthModeClientCertificate {
+		if reg.cluster, err = r.setupClientCertificateClusterConfig(ctx, reg.hostedClient, reg.restConfig, reg.server, hc); err != nil {
+			return false, fmt.Errorf("unable to create hosted cluster config: %w", err)
+		}
+		if err := verifyClientCertificate(ctx, reg.hostedClient); err != nil {
+			return false, &InvariantViolation{Invariant: fmt.Sprintf("client certificate must be verified before it is written: %s", err), Object: reg.cluster.Name}
+		}
+		r.recordAPICertificateExpiry(ctx, hc, reg.restConfig, reg.cluster)
+		return false, nil
+	}
+	if mode == AuthModeAWSExecProvider {
+		// AWS knows the cluster by its infraID, HyperShift sets it shortly after the HostedCluster is created
+		if hc.Spec.InfraID == "" {
+			reg.waiting = "waiting for the infraID of the HostedCluster"
+			return true, nil
+		}
+		if reg.cluster, err = r.setupAWSExecProviderClusterConfig(ctx, reg.hostedClient, reg.restConfig, reg.server, hc); err != nil {
+			return false, fmt.Errorf("unable to create hosted cluster config: %w", err)
+		}
+		r.recordAPICertificateExpiry(ctx, hc, reg.restConfig, reg.cluster)
+		return false, nil
+	}
+	if r.BoundTokens {
+		if reg.issuer, err = newTokenIssuer(reg.restConfig); err != nil {
+			return false, fmt.Errorf("unable to create hosted cluster token issuer: %w", err)
+		}
+		reg.issuer.ttl = r.tokenTTL()
+		reg.cluster, err = r.setupBoundTokenClusterConfig(ctx, reg.hostedClient, reg.issuer, reg.server, reg.restConfig.CAData, hc, reg.gitOpsNamespace)
+	} else {
+		reg.cluster, err = r.setupClusterConfig(ctx, reg.hostedClient, reg.server, hc.Name, hc)
+	}
+	if err != nil {
+		return false, fmt.Errorf("unable to create hosted cluster config: %w", err)
+	}
+	if err := r.applyClientCertificate(ctx, hc, reg.cluster); err != nil {
+		return false, fmt.Errorf("unable to add the client certificate to the hosted cluster config: %w", err)
+	}
+	if err := r.verifyClusterToken(ctx, reg.hostedClient, reg.cluster); err != nil {
+		return false, fmt.Errorf("unable to verify hosted cluster token: %w", err)
+	}
+	// an expired serving certificate breaks all GitOps traffic, fleet operators are warned ahead of time
+	r.recordAPICertificateExpiry(ctx, hc, reg.restConfig, reg.cluster)
+	return false, nil
+}
+
+// renderSecretPhase computes the labels and the features of the ArgoCD cluster secret
+func (r *HyperOpsReconciler) renderSecretPhase(ctx context.Context, reg *registration) (bool, error) {
+	hc := reg.hc
+	name, ok, err := r.argoCDClusterName(hc)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		// HyperShift sets the infraID shortly after the HostedCluster is created, which triggers a new reconcile
+		reg.waiting = "waiting for the infraID of the HostedCluster"
+		return true, nil
+	}
+	if name != reg.cluster.Name {
+		reg.cluster.ArgoCDName = name
+	}
+	reg.cluster.KubeconfigContext = reg.kubeconfigContext
+	reg.cluster.LabelSchema = r.LabelSchema
+	reg.cluster.GitOpsNamespace = reg.gitOpsNamespace
+	if err := r.applyNamespaceScope(hc, reg.cluster); err != nil {
+		return false, err
+	}
+	if err := applyInsecureCluster(hc, reg.cluster); err != nil {
+		return false, err
+	}
+	if !reg.cluster.Config.TLSClientConfig.Insecure && reg.caBundle != nil {
+		reg.cluster.Config.TLSClientConfig.CAData = mergeCABundles(reg.cluster.Config.TLSClientConfig.CAData, reg.caBundle)
+	}
+	if reg.cluster.Shard, err = r.argoCDShard(hc); err != nil {
+		return false, err
+	}
+	reg.labels = hostedClusterLabels(hc)
+	if r.TopologyLabels && !disabledBuiltinLabels(hc)[BuiltinLabelsTopology] {
+		topologyLabels, err := r.topologyLabels(ctx, reg.hostedClient, hc)
+		if err != nil {
+			return false, fmt.Errorf("unable to summarize the hosted cluster topology: %w", err)
+		}
+		reg.labels = removeBuiltinLabels(hc, mergeLabels(reg.labels, topologyLabels), disabledBuiltinLabels(hc))
+	}
+	if r.WorkersLabel && !disabledBuiltinLabels(hc)[BuiltinLabelsLifecycle] {
+		workersLabels, err := r.workersLabels(ctx, hc)
+		if err != nil {
+			return false, fmt.Errorf("unable to determine the workers of the hosted cluster: %w", err)
+		}
+		reg.labels = removeBuiltinLabels(hc, mergeLabels(reg.labels, workersLabels), disabledBuiltinLabels(hc))
+	}
+	// GitOps may be held back while the cluster rolls out a new release
+	if err := r.reconcileUpgrade(ctx, reg); err != nil {
+		return false, fmt.Errorf("unable to apply the upgrade policy: %w", err)
+	}
+	// features the ArgoCD instance can't use are reported instead of written
+	if reg.capabilities, err = r.negotiateCapabilities(ctx, hc, reg.cluster); err != nil {
+		return false, fmt.Errorf("unable to detect the argocd capabilities: %w", err)
+	}
+	appProject, err := r.clusterAppProject(hc)
+	if err != nil {
+		return false, err
+	}
+	if reg.cluster.DestinationProjects, err = destinationProjects(hc, reg.cluster.Project, appProject); err != nil {
+		return false, err
+	}
+	// organizational rules see the computed registration and may add labels or veto it
+	if stop, err := r.applyPolicies(ctx, hc, reg.labels, reg.cluster); stop || err != nil {
+		return stop, err
+	}
+	data, err := reg.cluster.SecretData()
+	if err != nil {
+		return false, err
+	}
+	reg.renderedSecretKey = client.ObjectKey{Namespace: reg.gitOpsNamespace, Name: reg.cluster.Name}
+	reg.renderedData = data
+	return false, nil
+}
+
+// writeOutputsPhase writes the ArgoCD cluster secret and its copies, the egress network policy, the audience tokens,
+// the tenant RBAC policy and the registration features
+func (r *HyperOpsReconciler) writeOutputsPhase(ctx context.Context, reg *registration) (bool, error) {
+	// a quarantined credential is never registered again, only a newer one
+	if kind, ok := quarantinedCredential(reg.hc, credentialFingerprints(reg.cluster)); ok {
+		reg.waiting = fmt.Sprintf("the %s exceeded the maximum credential age and is quarantined, waiting for a newer one", kind)
+		return true, nil
+	}
+	err := r.writeArgoCDClusterSecret(ctx, reg.gitOpsNamespace, reg.labels, reg.cluster, reg.renderedData)
+	r.reportHubAPIHealth(ctx, reg.hc, err)
+	if err != nil {
+		// a skipped conflict waits for the other owner to release the secret
+		if ignoreSkippedConflict(err) == nil {
+			reg.waiting = err.Error()
+			return true, nil
+		}
+		return false, fmt.Errorf("unable to create argocd cluster secret: %w", err)
+	}
+	recordClusterInfo(reg)
+	if err := r.releaseCredentialQuarantine(ctx, reg.hc); err != nil {
+		return false, fmt.Errorf("unable to release the quarantined credentials: %w", err)
+	}
+	// copies reuse the rendered registration, so all ArgoCD instances see the same credential
+	if reg.gitOpsNamespaceCopies, err = r.writeGitOpsNamespaceCopies(ctx, reg.hc, reg.labels, reg.cluster, reg.renderedData); err != nil {
+		return false, err
+	}
+	// locked down management clusters need an explicit allow rule for the ArgoCD traffic to the cluster
+	if err := r.reconcileEgressNetworkPolicy(ctx, reg.hc, reg.cluster); err != nil {
+		return false, fmt.Errorf("unable to apply the egress network policy: %w", err)
+	}
+	// consumers besides ArgoCD get tokens restricted to their own audience
+	if reg.issuer != nil {
+		refreshAfter, err := r.reconcileAudienceTokens(ctx, reg.hc, reg.issuer, reg.cluster)
+		if err != nil {
+			return false, err
+		}
+		reg.requeueAfter = shorterRequeue(reg.requeueAfter, refreshAfter)
+	}
+	// CI systems on the hub run pipelines against the cluster with the same credential as ArgoCD
+	if err := r.reconcileCIOutputs(ctx, reg.hc, reg.cluster); err != nil {
+		return false, err
+	}
+	if err := r.register(ctx, reg.hc, reg.cluster); err != nil {
+		return false, err
+	}
+	// the baseline makes the cluster ready for the first sync of ArgoCD
+	if err := r.reconcileBaselineManifests(ctx, reg.hc, reg.hostedClient); err != nil {
+		return false, err
+	}
+	// the root Application of the app-of-apps deploys the rest of the configuration of the cluster
+	if err := r.reconcileBootstrapApplication(ctx, reg.hc, reg.cluster); err != nil {
+		return false, err
+	}
+	// onboarding the cluster also onboards the groups owning it
+	if err := r.reconcileTenantRBAC(ctx, reg.hc, reg.gitOpsNamespace, reg.cluster.Server, reg.capabilities); err != nil {
+		return false, fmt.Errorf("unable to apply the tenant rbac policy: %w", err)
+	}
+	if err := r.reconcileClusterAppProject(ctx, reg.hc, reg.gitOpsNamespace, reg.cluster.Server); err != nil {
+		return false, fmt.Errorf("unable to apply the AppProject of the cluster: %w", err)
+	}
+	if err := r.setRegistrationFeatures(ctx, reg.hc, r.registrationFeatures(reg.hc)); err != nil {
+		return false, fmt.Errorf("unable to record the registration features: %w", err)
+	}
+	return false, nil
+}
+
+// verifyPhase checks that the ArgoCD cluster secret holds the rendered content and completes the bound token
+// migration once it does
+func (r *HyperOpsReconciler) verifyPhase(ctx context.Context, reg *registration) (bool, error) {
+	// remote registrations and dry runs don't write to the local cluster
+	if r.remoteRegistrations() == nil && !r.readOnly() {
+		// read from the API server, the cache may not have seen the write yet
+		reader := r.APIReader
+		if reader == nil {
+			reader = r.Client
+		}
+		secret := &corev1.Secret{}
+		if err := reader.Get(ctx, reg.renderedSecretKey, secret); err != nil {
+			return false, fmt.Errorf("unable to read back the argocd cluster secret: %w", err)
+		}
+		if !reflect.DeepEqual(secret.Data, reg.renderedData) {
+			return false, fmt.Errorf("argocd cluster secret %s does not hold the rendered registration", reg.renderedSecretKey)
+		}
+	}
+	// a registration in a namespace without a working ArgoCD is written, but nothing picks it up; the remote ArgoCD
+	// of the registration proxy or the remote hub isn't inspected
+	if r.remoteRegistrations() == nil {
+		reg.requeueAfter = shorterRequeue(reg.requeueAfter, r.reportArgoCDInstance(ctx, reg.hc, reg.renderedSecretKey.Namespace))
+	}
+	// registrations using the client certificate of the admin kubeconfig have no issuer
+	if reg.issuer != nil {
+		// the legacy token secret is only removed once the ArgoCD cluster secret holds the bound token
+		if err := r.completeTokenMigration(ctx, reg.hostedClient, reg.hc); err != nil {
+			return false, fmt.Errorf("unable to complete the bound token migration: %w", err)
+		}
+		reg.requeueAfter = shorterRequeue(reg.requeueAfter, boundTokenRefreshAfter(reg.cluster, r.tokenRenewBefore()))
+	}
+	return false, nil
+}
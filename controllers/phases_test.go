@@ -0,0 +1,96 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Registration phases", func() {
+	var (
+		r  *HyperOpsReconciler
+		hc *hypershiftv1beta1.HostedCluster
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		r = &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()}
+	})
+
+	phase := func(name string, ran *[]string, stop bool, err error) registrationPhase {
+		return registrationPhase{Name: name, Run: func(ctx context.Context, reg *registration) (bool, error) {
+			*ran = append(*ran, name)
+			return stop, err
+		}}
+	}
+
+	It("Should report every phase in its own condition", func() {
+		ran := []string{}
+		failed := testutil.ToFloat64(phaseErrors.WithLabelValues("Second"))
+		_, err := r.runPhases(context.Background(), hc, defaultGitOpsNamespace, []registrationPhase{
+			phase("First", &ran, false, nil),
+			phase("Second", &ran, false, errors.New("boom")),
+			phase("Third", &ran, false, nil),
+		})
+		Expect(err).To(MatchError("boom"))
+		Expect(ran).To(Equal([]string{"First", "Second"}))
+		conditions := registrationConditions(hc)
+		Expect(meta.IsStatusConditionTrue(conditions, "FirstSucceeded")).To(BeTrue())
+		second := meta.FindStatusCondition(conditions, "SecondSucceeded")
+		Expect(second).NotTo(BeNil())
+		Expect(second.Reason).To(Equal("PhaseFailed"))
+		Expect(second.Message).To(Equal("boom"))
+		Expect(meta.FindStatusCondition(conditions, "ThirdSucceeded")).To(BeNil())
+		Expect(testutil.ToFloat64(phaseErrors.WithLabelValues("Second"))).To(Equal(failed + 1))
+	})
+
+	It("Should stop early and report waiting phases", func() {
+		ran := []string{}
+		_, err := r.runPhases(context.Background(), hc, defaultGitOpsNamespace, []registrationPhase{
+			{Name: "First", Run: func(ctx context.Context, reg *registration) (bool, error) {
+				reg.waiting = "waiting for the kubeconfig"
+				return true, nil
+			}},
+			phase("Second", &ran, false, nil),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ran).To(BeEmpty())
+		first := meta.FindStatusCondition(registrationConditions(hc), "FirstSucceeded")
+		Expect(first.Status).To(Equal(metav1.ConditionFalse))
+		Expect(first.Reason).To(Equal("Waiting"))
+	})
+
+	It("Should run the phases in order", func() {
+		names := []string{}
+		for _, p := range r.registrationPhases() {
+			names = append(names, p.Name)
+		}
+		Expect(names).To(Equal([]string{PhaseResolveConfig, PhaseEnsureHostedRBAC, PhaseObtainCredential,
+			PhaseRenderSecret, PhaseWriteOutputs, PhaseVerify}))
+	})
+})
@@ -0,0 +1,147 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// PlatformApplicationName is the name of the ArgoCD Application managing HyperShift on the management cluster
+	PlatformApplicationName = "hyper-ops-hypershift"
+	// DefaultPlatformNamespace is the namespace the HyperShift operator is deployed to
+	DefaultPlatformNamespace = "hypershift"
+	// DefaultPlatformRevision is the git revision the platform Application tracks by default
+	DefaultPlatformRevision = "HEAD"
+	// inClusterServer is the ArgoCD server URL of the cluster ArgoCD runs in
+	inClusterServer = "https://kubernetes.default.svc"
+	// platformApplicationResyncInterval is how often drift on the platform Application is reverted
+	platformApplicationResyncInterval = 10 * time.Minute
+)
+
+var applicationGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Application"}
+
+// PlatformApplication is the git source of the HyperShift operator and its supporting configuration
+type PlatformApplication struct {
+	RepoURL        string
+	Path           string
+	TargetRevision string
+	// Namespace is the namespace on the management cluster the manifests are deployed to
+	Namespace string
+	// AutoSync enables automated sync with pruning and self healing
+	AutoSync bool
+}
+
+// PlatformApplicationManager keeps an ArgoCD Application deploying HyperShift itself to the management cluster in
+// sync with the active configuration, so the hosted cluster platform is GitOps managed by the same ArgoCD the hosted
+// clusters are registered to. The Application carries no resources finalizer, removing it or disabling the manager
+// never uninstalls HyperShift.
+type PlatformApplicationManager struct {
+	Client      client.Client
+	Application PlatformApplication
+}
+
+// Start applies the platform Application and re-applies it periodically until the context is cancelled
+func (p *PlatformApplicationManager) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("platform-application")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.apply(ctx); err != nil {
+			log.Error(err, "unable to apply platform application")
+		}
+	}, platformApplicationResyncInterval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader writes the platform Application
+func (p *PlatformApplicationManager) NeedLeaderElection() bool {
+	return true
+}
+
+func (p *PlatformApplicationManager) apply(ctx context.Context) error {
+	desired := PlatformApplicationObject(p.Application)
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationGVK)
+	obj.SetNamespace(desired.GetNamespace())
+	obj.SetName(desired.GetName())
+	if _, err := CreateOrUpdateWithRetries(ctx, p.Client, obj, func() error {
+		obj.SetLabels(mergeLabels(obj.GetLabels(), desired.GetLabels()))
+		stampManaged(obj, "")
+		obj.Object["spec"] = desired.Object["spec"]
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to apply Application %s/%s: %w", desired.GetNamespace(), desired.GetName(), err)
+	}
+
+	health, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status")
+	sync, _, _ := unstructured.NestedString(obj.Object, "status", "sync", "status")
+	log.FromContext(ctx).V(1).Info("platform application applied", "health", health, "sync", sync)
+	return nil
+}
+
+// PlatformApplicationObject renders the ArgoCD Application deploying the HyperShift operator from git to the
+// management cluster
+func PlatformApplicationObject(app PlatformApplication) *unstructured.Unstructured {
+	revision := app.TargetRevision
+	if revision == "" {
+		revision = DefaultPlatformRevision
+	}
+	namespace := app.Namespace
+	if namespace == "" {
+		namespace = DefaultPlatformNamespace
+	}
+
+	spec := map[string]interface{}{
+		"project": "default",
+		"source": map[string]interface{}{
+			"repoURL":        app.RepoURL,
+			"path":           app.Path,
+			"targetRevision": revision,
+		},
+		"destination": map[string]interface{}{
+			"server":    inClusterServer,
+			"namespace": namespace,
+		},
+	}
+	syncPolicy := map[string]interface{}{
+		// The HyperShift CRDs exceed the annotation size limit of client side apply
+		"syncOptions": []interface{}{"CreateNamespace=true", "ServerSideApply=true"},
+	}
+	if app.AutoSync {
+		syncPolicy["automated"] = map[string]interface{}{
+			"prune":    true,
+			"selfHeal": true,
+		}
+	}
+	spec["syncPolicy"] = syncPolicy
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	obj.SetGroupVersionKind(applicationGVK)
+	obj.SetNamespace(defaultGitOpsNamespace)
+	obj.SetName(PlatformApplicationName)
+	obj.SetLabels(managedLabels(map[string]string{
+		"app.kubernetes.io/part-of": "hypershift",
+	}))
+	return obj
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Platform application", func() {
+	It("Should render the Application with defaults and without automated sync", func() {
+		obj := PlatformApplicationObject(PlatformApplication{RepoURL: "https://git.example.com/platform.git", Path: "hypershift"})
+		Expect(obj.GetKind()).To(Equal("Application"))
+		Expect(obj.GetNamespace()).To(Equal(defaultGitOpsNamespace))
+		Expect(obj.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		revision, _, _ := unstructured.NestedString(obj.Object, "spec", "source", "targetRevision")
+		Expect(revision).To(Equal(DefaultPlatformRevision))
+		namespace, _, _ := unstructured.NestedString(obj.Object, "spec", "destination", "namespace")
+		Expect(namespace).To(Equal(DefaultPlatformNamespace))
+		server, _, _ := unstructured.NestedString(obj.Object, "spec", "destination", "server")
+		Expect(server).To(Equal(inClusterServer))
+		_, found, _ := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+		Expect(found).To(BeFalse())
+		Expect(obj.GetFinalizers()).To(BeEmpty())
+	})
+
+	It("Should enable automated sync", func() {
+		obj := PlatformApplicationObject(PlatformApplication{RepoURL: "https://git.example.com/platform.git", AutoSync: true})
+		selfHeal, _, _ := unstructured.NestedBool(obj.Object, "spec", "syncPolicy", "automated", "selfHeal")
+		Expect(selfHeal).To(BeTrue())
+	})
+
+	It("Should revert drift on the Application", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		p := &PlatformApplicationManager{Client: c, Application: PlatformApplication{
+			RepoURL: "https://git.example.com/platform.git", Path: "hypershift", TargetRevision: "v4.14",
+		}}
+		Expect(p.apply(context.Background())).To(Succeed())
+
+		app := &unstructured.Unstructured{}
+		app.SetGroupVersionKind(applicationGVK)
+		key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: PlatformApplicationName}
+		Expect(c.Get(context.Background(), key, app)).To(Succeed())
+		Expect(unstructured.SetNestedField(app.Object, "main", "spec", "source", "targetRevision")).To(Succeed())
+		Expect(c.Update(context.Background(), app)).To(Succeed())
+
+		Expect(p.apply(context.Background())).To(Succeed())
+		Expect(c.Get(context.Background(), key, app)).To(Succeed())
+		revision, _, _ := unstructured.NestedString(app.Object, "spec", "source", "targetRevision")
+		Expect(revision).To(Equal("v4.14"))
+	})
+})
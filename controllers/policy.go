@@ -0,0 +1,260 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+// ConditionPolicyAllowed is false when a registration policy vetoes the registration or can't be evaluated
+const ConditionPolicyAllowed = "PolicyAllowed"
+
+// RegistrationPolicy is a compiled hyperopsv1alpha1.RegistrationPolicy
+type RegistrationPolicy struct {
+	Name     string
+	Message  string
+	validate cel.Program
+	labels   cel.Program
+	// disabledBuiltinLabels returns the built-in label groups and keys removed from the registration
+	disabledBuiltinLabels cel.Program
+}
+
+// policyResult is what the registration policies change on a registration
+type policyResult struct {
+	// labels are the labels added by the policies
+	labels map[string]string
+	// disabledBuiltinLabels are the built-in label groups and keys removed by the policies
+	disabledBuiltinLabels map[string]bool
+}
+
+// policyVeto is returned when a policy vetoes a registration
+type policyVeto struct {
+	policy  string
+	message string
+}
+
+func (v *policyVeto) Error() string {
+	return fmt.Sprintf("vetoed by policy %s: %s", v.policy, v.message)
+}
+
+// CompilePolicies compiles the CEL expressions of the registration policies
+func CompilePolicies(policies []hyperopsv1alpha1.RegistrationPolicy) ([]*RegistrationPolicy, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("hostedCluster", cel.DynType),
+		cel.Variable("registration", cel.DynType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	compile := func(name, expression string, outputs ...*cel.Type) (cel.Program, error) {
+		ast, issues := env.Compile(expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("policy %s: %w", name, issues.Err())
+		}
+		valid := false
+		for _, t := range append(outputs, cel.DynType) {
+			if reflect.DeepEqual(ast.OutputType(), t) {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("policy %s: expression %q returns %s, expected %s", name, expression, ast.OutputType(), outputs[0])
+		}
+		return env.Program(ast)
+	}
+	compiled := []*RegistrationPolicy{}
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.Name == "" {
+			return nil, fmt.Errorf("registration policies must have a name")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate registration policy %s", p.Name)
+		}
+		seen[p.Name] = true
+		if p.Validate == "" && p.Labels == "" && p.DisabledBuiltinLabels == "" {
+			return nil, fmt.Errorf("policy %s: validate, labels or disabledBuiltinLabels is required", p.Name)
+		}
+		policy := &RegistrationPolicy{Name: p.Name, Message: p.Message}
+		if policy.Message == "" {
+			policy.Message = fmt.Sprintf("%s is false", p.Validate)
+		}
+		if p.Validate != "" {
+			if policy.validate, err = compile(p.Name, p.Validate, cel.BoolType); err != nil {
+				return nil, err
+			}
+		}
+		if p.Labels != "" {
+			if policy.labels, err = compile(p.Name, p.Labels,
+				cel.MapType(cel.StringType, cel.StringType), cel.MapType(cel.StringType, cel.DynType)); err != nil {
+				return nil, err
+			}
+		}
+		if p.DisabledBuiltinLabels != "" {
+			if policy.disabledBuiltinLabels, err = compile(p.Name, p.DisabledBuiltinLabels,
+				cel.ListType(cel.StringType), cel.ListType(cel.DynType)); err != nil {
+				return nil, err
+			}
+		}
+		compiled = append(compiled, policy)
+	}
+	return compiled, nil
+}
+
+// evaluatePolicies runs the policies against the HostedCluster and the computed registration, it returns the
+// labels added and the built-in labels removed by the policies or a policyVeto. Policies see the labels added and
+// removed by the policies before them, a policy removes built-in labels before it adds its own.
+func evaluatePolicies(policies []*RegistrationPolicy, hc *hypershiftv1beta1.HostedCluster, labels map[string]string, cluster *Cluster) (*policyResult, error) {
+	hostedCluster, err := runtime.DefaultUnstructuredConverter.ToUnstructured(hc)
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]string{}
+	for k, v := range labels {
+		current[k] = v
+	}
+	added := map[string]string{}
+	disabled := map[string]bool{}
+	for _, p := range policies {
+		// the registration exposes what is written to the ArgoCD cluster secret except for the credentials
+		registration := map[string]interface{}{
+			"name":             cluster.Name,
+			"namespace":        cluster.GitOpsNamespace,
+			"server":           cluster.Server,
+			"project":          cluster.Project,
+			"namespaces":       cluster.Namespaces,
+			"clusterResources": cluster.ClusterResources,
+			"labels":           current,
+		}
+		// the shard is only set when it is assigned, policies test it with has(registration.shard)
+		if cluster.Shard != nil {
+			registration["shard"] = *cluster.Shard
+		}
+		vars := map[string]interface{}{"hostedCluster": hostedCluster, "registration": registration}
+		if p.validate != nil {
+			out, _, err := p.validate.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+			allowed, ok := out.Value().(bool)
+			if !ok {
+				return nil, fmt.Errorf("policy %s: validate returned %v, expected a bool", p.Name, out.Value())
+			}
+			if !allowed {
+				return nil, &policyVeto{policy: p.Name, message: p.Message}
+			}
+		}
+		if p.disabledBuiltinLabels != nil {
+			out, _, err := p.disabledBuiltinLabels.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+			native, err := out.ConvertToNative(reflect.TypeOf([]string{}))
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: disabledBuiltinLabels must be a list of strings: %w", p.Name, err)
+			}
+			for _, d := range native.([]string) {
+				disabled[d] = true
+			}
+			// labels added by the policies before are not built-in, even if they share a key
+			current = mergeLabels(removeBuiltinLabels(hc, current, disabled), added)
+		}
+		if p.labels != nil {
+			out, _, err := p.labels.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+			}
+			native, err := out.ConvertToNative(reflect.TypeOf(map[string]string{}))
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: labels must be a map of strings: %w", p.Name, err)
+			}
+			for k, v := range native.(map[string]string) {
+				if err := validateAddedLabel(k, v); err != nil {
+					return nil, fmt.Errorf("policy %s: %w", p.Name, err)
+				}
+				added[k] = v
+				current[k] = v
+			}
+		}
+	}
+	return &policyResult{labels: added, disabledBuiltinLabels: disabled}, nil
+}
+
+// applyPolicies evaluates the registration policies and adds their labels. It returns true when a policy vetoed the
+// registration, the registration is then removed.
+func (r *HyperOpsReconciler) applyPolicies(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, labels map[string]string, cluster *Cluster) (bool, error) {
+	if len(r.Policies) == 0 {
+		if condition := meta.FindStatusCondition(registrationConditions(hc), ConditionPolicyAllowed); condition == nil || condition.Status == metav1.ConditionTrue {
+			return false, nil
+		}
+		return false, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionPolicyAllowed,
+			Status:  metav1.ConditionTrue,
+			Reason:  "NoPolicies",
+			Message: "no registration policies are configured",
+		})
+	}
+	result, err := evaluatePolicies(r.Policies, hc, labels, cluster)
+	if veto, ok := err.(*policyVeto); ok {
+		log.FromContext(ctx).Info("registration vetoed by policy", "policy", veto.policy, "message", veto.message)
+		forgetClusterInfo(client.ObjectKeyFromObject(hc))
+		if err := r.deregisterArgoCDClusterSecrets(ctx, hc, cluster.GitOpsNamespace); err != nil {
+			return true, err
+		}
+		return true, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionPolicyAllowed,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Vetoed",
+			Message: veto.Error(),
+		})
+	}
+	if err != nil {
+		// fail closed, nothing is written while a policy can't be evaluated
+		if cerr := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionPolicyAllowed,
+			Status:  metav1.ConditionFalse,
+			Reason:  "PolicyError",
+			Message: err.Error(),
+		}); cerr != nil {
+			return true, cerr
+		}
+		return true, err
+	}
+	removeBuiltinLabels(hc, labels, result.disabledBuiltinLabels)
+	for k, v := range result.labels {
+		labels[k] = v
+	}
+	cluster.PolicyLabels = result.labels
+	return false, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionPolicyAllowed,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Allowed",
+		Message: fmt.Sprintf("allowed by %d registration policies", len(r.Policies)),
+	})
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Registration policies", func() {
+	var (
+		hc      *hypershiftv1beta1.HostedCluster
+		cluster *Cluster
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "clusters",
+				Labels:    map[string]string{"cost-center": "1234"},
+			},
+		}
+		cluster = &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted.example.com:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+	})
+
+	It("Should reject invalid policies", func() {
+		_, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{Name: "no-expression"}})
+		Expect(err).To(HaveOccurred())
+		_, err = CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{Name: "not-bool", Validate: `"true"`}})
+		Expect(err).To(HaveOccurred())
+		_, err = CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{Name: "syntax", Validate: `hostedCluster.metadata.name ==`}})
+		Expect(err).To(HaveOccurred())
+		_, err = CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{Name: "a", Validate: "true"}, {Name: "a", Validate: "true"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should add labels and veto registrations", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{
+				Name:   "cost-center",
+				Labels: `{"example.com/cost-center": hostedCluster.metadata.labels["cost-center"]}`,
+			},
+			{
+				Name:     "production-domain",
+				Validate: `registration.server.endsWith(".example.com:6443") && registration.labels["example.com/cost-center"] != ""`,
+				Message:  "clusters must be served from example.com",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		result, err := evaluatePolicies(policies, hc, map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.labels).To(Equal(map[string]string{"example.com/cost-center": "1234"}))
+
+		cluster.Server = "https://api.hosted.other.com:6443"
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).To(MatchError("vetoed by policy production-domain: clusters must be served from example.com"))
+	})
+
+	It("Should remove built-in labels disabled by a policy", func() {
+		hc.Labels["hyper-ops.cloudmonkey.org/customer"] = "acme"
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{
+				Name:                  "shared-argocd",
+				DisabledBuiltinLabels: `hostedCluster.metadata.labels["cost-center"] == "1234" ? ["hyper-ops.cloudmonkey.org/customer", "topology"] : []`,
+				Labels:                `{"example.com/customer": "hidden"}`,
+			},
+			{
+				Name:     "customer-hidden",
+				Validate: `!("hyper-ops.cloudmonkey.org/customer" in registration.labels)`,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		labels := map[string]string{
+			hyperOpsTypeLabel:                    "hosted",
+			"hyper-ops.cloudmonkey.org/customer": "acme",
+			"hyper-ops.cloudmonkey.org/fips":     "false",
+			hyperOpsNodePoolReplicasLabel:        "2",
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build(), Policies: policies}
+		Expect(r.applyPolicies(context.Background(), hc, labels, cluster)).To(BeFalse())
+		Expect(labels).To(Equal(map[string]string{
+			hyperOpsTypeLabel:                "hosted",
+			"hyper-ops.cloudmonkey.org/fips": "false",
+			"example.com/customer":           "hidden",
+		}))
+
+		_, err = CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{Name: "not-list", DisabledBuiltinLabels: `"topology"`}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should not override labels managed by hyper-ops", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{Name: "type", Labels: `{"hyper-ops.cloudmonkey.org/type": "local"}`},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should remove vetoed registrations", func() {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: defaultGitOpsNamespace, Labels: map[string]string{hyperOpsTypeLabel: "hosted"}}}
+		copied := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        "hosted",
+			Namespace:   "team-a",
+			Labels:      map[string]string{hyperOpsTypeLabel: "hosted", argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+			Annotations: map[string]string{hyperOpsCopyOfAnnotation: "openshift-gitops/hosted", hyperOpsHostedClusterAnnotation: "clusters/hosted"},
+		}}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret, copied).Build()
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{Name: "deny-all", Validate: "false"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		r := &HyperOpsReconciler{Client: c, Policies: policies}
+		stop, err := r.applyPolicies(context.Background(), hc, map[string]string{}, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret)).NotTo(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(copied), copied)).NotTo(Succeed())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionPolicyAllowed)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("Vetoed"))
+	})
+})
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Registrations are processed by two controllers sharing the same reconciler. The registration controller handles
+// new and broken registrations as soon as they show up, while the refresh controller handles the steady state updates
+// of healthy registrations through a throttled queue. Onboarding latency is therefore never affected by the amount of
+// routine refresh work in a large fleet.
+
+const (
+	// DefaultRefreshQPS is the default rate at which steady state refreshes are processed
+	DefaultRefreshQPS = 5
+	// refreshBurst is the number of refreshes allowed to be processed at once before throttling kicks in
+	refreshBurst = 10
+)
+
+// registrationTracker remembers which registrations reconciled successfully the last time they were processed
+type registrationTracker struct {
+	healthy sync.Map
+}
+
+func (t *registrationTracker) markHealthy(key client.ObjectKey) {
+	t.healthy.Store(key, struct{}{})
+}
+
+func (t *registrationTracker) markPending(key client.ObjectKey) {
+	t.healthy.Delete(key)
+}
+
+func (t *registrationTracker) isHealthy(key client.ObjectKey) bool {
+	_, ok := t.healthy.Load(key)
+	return ok
+}
+
+// keyLocks serializes reconciles of the same key across the registration and refresh controllers
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a per key mutex counting the reconciles holding or waiting for it
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock blocks until key is free and returns the unlock, which drops the entry once nobody else waits for the key
+func (k *keyLocks) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*keyLock{}
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
+
+// refreshRateLimiter throttles the refresh queue to qps while keeping the per item exponential backoff on failures
+func refreshRateLimiter(qps float64) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), refreshBurst)},
+	)
+}
+
+// refreshEnqueueHandler enqueues updates of healthy registrations into the throttled refresh queue
+type refreshEnqueueHandler struct {
+	tracker *registrationTracker
+	filter  func(obj client.Object) bool
+}
+
+func (h *refreshEnqueueHandler) Create(event.CreateEvent, workqueue.RateLimitingInterface) {}
+
+func (h *refreshEnqueueHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	key := client.ObjectKeyFromObject(e.ObjectNew)
+	if !h.tracker.isHealthy(key) || !h.filter(e.ObjectNew) {
+		return
+	}
+	q.AddRateLimited(reconcile.Request{NamespacedName: key})
+}
+
+func (h *refreshEnqueueHandler) Delete(event.DeleteEvent, workqueue.RateLimitingInterface) {}
+
+func (h *refreshEnqueueHandler) Generic(event.GenericEvent, workqueue.RateLimitingInterface) {}
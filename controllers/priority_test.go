@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Prioritized processing", func() {
+	var (
+		hc      *hypershiftv1beta1.HostedCluster
+		tracker *registrationTracker
+		h       *refreshEnqueueHandler
+		q       workqueue.RateLimitingInterface
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "clusters",
+				Labels:    map[string]string{hyperOpsEnabledLabel: "true"},
+			},
+		}
+		tracker = &registrationTracker{}
+		r := &HyperOpsReconciler{}
+		h = &refreshEnqueueHandler{tracker: tracker, filter: r.watched}
+		q = workqueue.NewRateLimitingQueue(refreshRateLimiter(100))
+	})
+
+	AfterEach(func() {
+		q.ShutDown()
+	})
+
+	It("Should leave pending registrations to the registration controller", func() {
+		h.Update(event.UpdateEvent{ObjectOld: hc, ObjectNew: hc}, q)
+		Consistently(q.Len, 100*time.Millisecond).Should(Equal(0))
+	})
+
+	It("Should refresh healthy registrations through the refresh queue", func() {
+		tracker.markHealthy(client.ObjectKeyFromObject(hc))
+		h.Update(event.UpdateEvent{ObjectOld: hc, ObjectNew: hc}, q)
+		Eventually(q.Len).Should(Equal(1))
+
+		tracker.markPending(client.ObjectKeyFromObject(hc))
+		Expect(tracker.isHealthy(client.ObjectKeyFromObject(hc))).To(BeFalse())
+	})
+
+	It("Should ignore HostedClusters that are not watched", func() {
+		hc.Labels = nil
+		tracker.markHealthy(client.ObjectKeyFromObject(hc))
+		h.Update(event.UpdateEvent{ObjectOld: hc, ObjectNew: hc}, q)
+		Consistently(q.Len, 100*time.Millisecond).Should(Equal(0))
+	})
+
+	It("Should serialize reconciles of the same key and forget released keys", func() {
+		locks := &keyLocks{}
+		unlock := locks.lock("clusters/hosted")
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			locks.lock("clusters/hosted")()
+			close(acquired)
+		}()
+		Consistently(acquired, 100*time.Millisecond).ShouldNot(BeClosed())
+		locks.lock("clusters/other")()
+
+		unlock()
+		Eventually(acquired).Should(BeClosed())
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+		Expect(locks.locks).To(BeEmpty())
+	})
+})
@@ -0,0 +1,237 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// hyperOpsDestinationProjectsAnnotation lists the AppProjects, comma separated, that may deploy to the hosted
+	// cluster. The ArgoCD cluster secret records the projects with the same annotation, including the project the
+	// cluster is scoped to.
+	hyperOpsDestinationProjectsAnnotation = "hyper-ops.cloudmonkey.org/destination-projects"
+	// hyperOpsManagedDestinationsAnnotation records the destination servers hyper-ops added to an AppProject, the
+	// other destinations of the project are never modified
+	hyperOpsManagedDestinationsAnnotation = "hyper-ops.cloudmonkey.org/managed-destinations"
+)
+
+var appProjectGVK = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "AppProject"}
+
+// destinationProjects returns the AppProjects that may deploy to the hosted cluster, sorted, the project the cluster
+// is scoped to and the AppProject created for it are always included
+func destinationProjects(hc *hypershiftv1beta1.HostedCluster, included ...string) ([]string, error) {
+	projects := sets.NewString()
+	for _, p := range strings.Split(hc.GetAnnotations()[hyperOpsDestinationProjectsAnnotation], ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(p); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid AppProject %q in the %s annotation: %s", p, hyperOpsDestinationProjectsAnnotation, strings.Join(errs, ", "))
+		}
+		projects.Insert(p)
+	}
+	for _, project := range included {
+		if project != "" {
+			projects.Insert(project)
+		}
+	}
+	return projects.List(), nil
+}
+
+// secretDestinationProjects returns the AppProjects recorded on an ArgoCD cluster secret
+func secretDestinationProjects(secret client.Object) []string {
+	projects := []string{}
+	for _, p := range strings.Split(secret.GetAnnotations()[hyperOpsDestinationProjectsAnnotation], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			projects = append(projects, p)
+		}
+	}
+	return projects
+}
+
+// AppProjectDestinationReconciler keeps the destinations of AppProjects in sync with the registrations that name
+// them, so teams gain and lose access to a hosted cluster with its registration instead of through manual AppProject
+// edits. Every added destination allows all namespaces of the cluster, destinations not added by hyper-ops are never
+// modified and the AppProjects themselves are never created.
+type AppProjectDestinationReconciler struct {
+	client.Client
+}
+
+// SetupWithManager reconciles the AppProjects when they change and when a registration naming them changes, the
+// annotations of a deleted ArgoCD cluster secret still name the projects to remove it from
+func (r *AppProjectDestinationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	project := &unstructured.Unstructured{}
+	project.SetGroupVersionKind(appProjectGVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("appproject-destinations").
+		For(project).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(appProjectsForSecret),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetLabels()[hyperOpsTypeLabel] != ""
+			}))).
+		Complete(r)
+}
+
+// appProjectsForSecret maps an ArgoCD cluster secret of hyper-ops to the AppProjects in its namespace it names
+func appProjectsForSecret(obj client.Object) []reconcile.Request {
+	requests := []reconcile.Request{}
+	for _, p := range secretDestinationProjects(obj) {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: p}})
+	}
+	return requests
+}
+
+func (r *AppProjectDestinationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	project := &unstructured.Unstructured{}
+	project.SetGroupVersionKind(appProjectGVK)
+	if err := r.Get(ctx, req.NamespacedName, project); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	desired, err := r.desiredDestinations(ctx, project)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	destinations, managed, changed := syncDestinations(project, desired)
+	if !changed {
+		return ctrl.Result{}, nil
+	}
+	if err := unstructured.SetNestedSlice(project.Object, destinations, "spec", "destinations"); err != nil {
+		return ctrl.Result{}, err
+	}
+	annotations := project.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if len(managed) > 0 {
+		annotations[hyperOpsManagedDestinationsAnnotation] = strings.Join(managed, ",")
+	} else {
+		delete(annotations, hyperOpsManagedDestinationsAnnotation)
+	}
+	project.SetAnnotations(annotations)
+	// a conflicting update is retried with the latest AppProject
+	if err := r.Update(ctx, project); err != nil {
+		if apierrors.IsConflict(err) {
+			return ctrl.Result{Requeue: true}, nil
+		}
+		return ctrl.Result{}, fmt.Errorf("unable to update the destinations of AppProject %s: %w", req.NamespacedName, err)
+	}
+	log.Info("AppProject destinations updated", "appProject", req.NamespacedName.String(), "managed", managed)
+	return ctrl.Result{}, nil
+}
+
+// desiredDestinations returns the servers of the registrations in the namespace of the AppProject that name it
+func (r *AppProjectDestinationReconciler) desiredDestinations(ctx context.Context, project client.Object) (sets.String, error) {
+	return projectServers(ctx, r.Client, project.GetNamespace(), project.GetName(), "")
+}
+
+// projectServers returns the servers of the registrations in the namespace that name the AppProject, except the
+// registration of the excluded HostedCluster
+func projectServers(ctx context.Context, c client.Reader, namespace, project, excluded string) (sets.String, error) {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.InNamespace(namespace), client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return nil, fmt.Errorf("unable to list the argocd cluster secrets: %w", err)
+	}
+	servers := sets.NewString()
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		// registrations pending deletion are already removed from the projects
+		if secret.Labels[hyperOpsTypeLabel] == "" || secret.DeletionTimestamp != nil || secret.Annotations[hyperOpsDeleteAfterAnnotation] != "" {
+			continue
+		}
+		if excluded != "" && secret.Annotations[hyperOpsHostedClusterAnnotation] == excluded {
+			continue
+		}
+		if !sets.NewString(secretDestinationProjects(secret)...).Has(project) {
+			continue
+		}
+		if server := string(secret.Data["server"]); server != "" {
+			servers.Insert(server)
+		}
+	}
+	return servers, nil
+}
+
+// syncDestinations returns the destinations of the AppProject with the desired servers added and the servers hyper-ops
+// no longer manages removed, the sorted servers managed afterwards, and whether anything changed. A server the project
+// already allows through a destination of its own is not claimed, so removing the registration keeps it.
+func syncDestinations(project *unstructured.Unstructured, desired sets.String) ([]interface{}, []string, bool) {
+	previous := sets.NewString()
+	for _, s := range strings.Split(project.GetAnnotations()[hyperOpsManagedDestinationsAnnotation], ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			previous.Insert(s)
+		}
+	}
+	existing, _, _ := unstructured.NestedSlice(project.Object, "spec", "destinations")
+
+	destinations := []interface{}{}
+	present := sets.NewString()
+	for _, d := range existing {
+		destination, _ := d.(map[string]interface{})
+		server, _ := destination["server"].(string)
+		if previous.Has(server) {
+			// destinations of hyper-ops are rewritten below
+			if !desired.Has(server) || present.Has(server) {
+				continue
+			}
+			present.Insert(server)
+		}
+		destinations = append(destinations, d)
+	}
+	unmanaged := sets.NewString()
+	for _, d := range destinations {
+		destination, _ := d.(map[string]interface{})
+		if server, _ := destination["server"].(string); server != "" && !previous.Has(server) {
+			unmanaged.Insert(server)
+		}
+	}
+	managed := []string{}
+	for _, server := range desired.List() {
+		if unmanaged.Has(server) {
+			continue
+		}
+		managed = append(managed, server)
+		if !present.Has(server) {
+			destinations = append(destinations, map[string]interface{}{"server": server, "namespace": "*"})
+		}
+	}
+	sort.Strings(managed)
+	changed := !reflect.DeepEqual(previous.List(), managed) || len(destinations) != len(existing)
+	return destinations, managed, changed
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("AppProject destinations", func() {
+	registration := func(name, server, projects string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   defaultGitOpsNamespace,
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{hyperOpsDestinationProjectsAnnotation: projects},
+			},
+			Data: map[string][]byte{"server": []byte(server)},
+		}
+	}
+	appProject := func(destinations ...interface{}) *unstructured.Unstructured {
+		project := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"destinations": destinations},
+		}}
+		project.SetGroupVersionKind(appProjectGVK)
+		project.SetNamespace(defaultGitOpsNamespace)
+		project.SetName("team-a")
+		return project
+	}
+	reconcileProject := func(c client.Client) *unstructured.Unstructured {
+		r := &AppProjectDestinationReconciler{Client: c}
+		_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "team-a"}})
+		Expect(err).NotTo(HaveOccurred())
+		project := &unstructured.Unstructured{}
+		project.SetGroupVersionKind(appProjectGVK)
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "team-a"}, project)).To(Succeed())
+		return project
+	}
+	destinations := func(project *unstructured.Unstructured) []interface{} {
+		d, _, _ := unstructured.NestedSlice(project.Object, "spec", "destinations")
+		return d
+	}
+
+	It("Should add and remove the servers of registrations naming the project", func() {
+		own := map[string]interface{}{"server": "https://kubernetes.default.svc", "namespace": "team-a"}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			appProject(own),
+			registration("one", "https://api.one:6443", "team-a,team-b"),
+			registration("two", "https://api.two:6443", "team-b"),
+		).Build()
+
+		project := reconcileProject(c)
+		Expect(destinations(project)).To(Equal([]interface{}{own,
+			map[string]interface{}{"server": "https://api.one:6443", "namespace": "*"},
+		}))
+		Expect(project.GetAnnotations()).To(HaveKeyWithValue(hyperOpsManagedDestinationsAnnotation, "https://api.one:6443"))
+
+		// a reconcile without changes leaves the project alone
+		version := project.GetResourceVersion()
+		Expect(reconcileProject(c).GetResourceVersion()).To(Equal(version))
+
+		Expect(c.Delete(context.Background(), registration("one", "", ""))).To(Succeed())
+		project = reconcileProject(c)
+		Expect(destinations(project)).To(Equal([]interface{}{own}))
+		Expect(project.GetAnnotations()).NotTo(HaveKey(hyperOpsManagedDestinationsAnnotation))
+	})
+
+	It("Should never claim destinations added by others", func() {
+		own := map[string]interface{}{"server": "https://api.one:6443", "namespace": "apps"}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			appProject(own),
+			registration("one", "https://api.one:6443", "team-a"),
+		).Build()
+
+		project := reconcileProject(c)
+		Expect(destinations(project)).To(Equal([]interface{}{own}))
+		Expect(project.GetAnnotations()).NotTo(HaveKey(hyperOpsManagedDestinationsAnnotation))
+
+		Expect(c.Delete(context.Background(), registration("one", "", ""))).To(Succeed())
+		Expect(destinations(reconcileProject(c))).To(Equal([]interface{}{own}))
+	})
+
+	It("Should map registrations to the projects they name", func() {
+		Expect(appProjectsForSecret(registration("one", "https://api.one:6443", "team-a, team-b"))).To(ConsistOf(
+			reconcile.Request{NamespacedName: client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "team-a"}},
+			reconcile.Request{NamespacedName: client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "team-b"}},
+		))
+	})
+
+	It("Should include the project the cluster is scoped to", func() {
+		hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{hyperOpsDestinationProjectsAnnotation: "team-b, team-a"},
+		}}
+		Expect(destinationProjects(hc, "team-c")).To(Equal([]string{"team-a", "team-b", "team-c"}))
+
+		hc.Annotations[hyperOpsDestinationProjectsAnnotation] = "Team_A"
+		_, err := destinationProjects(hc, "")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,164 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// ConditionQuotaExceeded is true when the HostedCluster is not registered because its group reached a quota
+	ConditionQuotaExceeded = "QuotaExceeded"
+	// quotaRecheckInterval is how often a HostedCluster held back by a quota checks for a free slot
+	quotaRecheckInterval = 5 * time.Minute
+)
+
+// ValidateRegistrationQuotas returns an error if a quota is invalid
+func ValidateRegistrationQuotas(quotas []hyperopsv1alpha1.RegistrationQuota) error {
+	seen := map[string]bool{}
+	for _, q := range quotas {
+		if q.Name == "" {
+			return fmt.Errorf("registration quotas must have a name")
+		}
+		if seen[q.Name] {
+			return fmt.Errorf("duplicate registration quota %s", q.Name)
+		}
+		seen[q.Name] = true
+		if q.Max < 0 {
+			return fmt.Errorf("quota %s: max must not be negative", q.Name)
+		}
+		if q.LabelKey != "" {
+			if errs := validation.IsQualifiedName(q.LabelKey); len(errs) > 0 {
+				return fmt.Errorf("quota %s: invalid label key %q: %v", q.Name, q.LabelKey, errs)
+			}
+		}
+	}
+	return nil
+}
+
+// quotaGroup returns the group the HostedCluster registering into the gitops namespace is counted in, false if the
+// quota doesn't apply to it
+func quotaGroup(q hyperopsv1alpha1.RegistrationQuota, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (string, bool) {
+	if q.GitOpsNamespace != "" && q.GitOpsNamespace != gitOpsNamespace {
+		return "", false
+	}
+	if q.LabelKey == "" {
+		return fmt.Sprintf("namespace %s", hc.Namespace), true
+	}
+	value, ok := hc.GetLabels()[q.LabelKey]
+	return fmt.Sprintf("%s=%s", q.LabelKey, value), ok
+}
+
+// exceededQuota returns a message naming the first quota the registration of the HostedCluster would exceed, empty
+// if it is within all quotas. Registered HostedClusters are always within their quotas, lowering a quota only holds
+// back new registrations.
+func (r *HyperOpsReconciler) exceededQuota(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (string, error) {
+	if len(r.Quotas) == 0 {
+		return "", nil
+	}
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return "", err
+	}
+	// the gitops namespace of every registered HostedCluster, copies in additional namespaces are not counted
+	registered := map[string]string{}
+	for i := range secrets.Items {
+		annotations := secrets.Items[i].Annotations
+		if _, isCopy := annotations[hyperOpsCopyOfAnnotation]; isCopy {
+			continue
+		}
+		if ref, ok := annotations[hyperOpsHostedClusterAnnotation]; ok {
+			registered[ref] = secrets.Items[i].Namespace
+		}
+	}
+	self := client.ObjectKeyFromObject(hc).String()
+	if _, ok := registered[self]; ok {
+		return "", nil
+	}
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := r.List(ctx, hcs); err != nil {
+		return "", err
+	}
+	for _, q := range r.Quotas {
+		group, ok := quotaGroup(q, hc, gitOpsNamespace)
+		if !ok {
+			continue
+		}
+		count := 0
+		for i := range hcs.Items {
+			key := client.ObjectKeyFromObject(&hcs.Items[i]).String()
+			ns, ok := registered[key]
+			if !ok || key == self {
+				continue
+			}
+			if other, ok := quotaGroup(q, &hcs.Items[i], ns); ok && other == group {
+				count++
+			}
+		}
+		if count >= q.Max {
+			return fmt.Sprintf("quota %s allows %d registered HostedClusters for %s, %d are registered", q.Name, q.Max, group, count), nil
+		}
+	}
+	return "", nil
+}
+
+// enforceQuotas holds back the registration of the HostedCluster while it would exceed a quota. The HostedCluster
+// checks for a free slot periodically.
+func (r *HyperOpsReconciler) enforceQuotas(ctx context.Context, reg *registration) (bool, error) {
+	hc := reg.hc
+	exceeded, err := r.exceededQuota(ctx, hc, reg.gitOpsNamespace)
+	if err != nil {
+		return false, fmt.Errorf("unable to check the registration quotas: %w", err)
+	}
+	previous := meta.FindStatusCondition(registrationConditions(hc), ConditionQuotaExceeded)
+	if exceeded != "" {
+		if previous == nil || previous.Status != metav1.ConditionTrue {
+			log.FromContext(ctx).Info("registration held back by quota", "message", exceeded)
+			r.recordEvent(hc, corev1.EventTypeWarning, ConditionQuotaExceeded, exceeded)
+		}
+		reg.waiting = exceeded
+		reg.requeueAfter = quotaRecheckInterval
+		return true, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionQuotaExceeded,
+			Status:  metav1.ConditionTrue,
+			Reason:  ConditionQuotaExceeded,
+			Message: exceeded,
+		})
+	}
+	if previous == nil || previous.Status == metav1.ConditionFalse {
+		return false, nil
+	}
+	r.recordEvent(hc, corev1.EventTypeNormal, "WithinQuota", "the registration is within the registration quotas")
+	return false, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionQuotaExceeded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "WithinQuota",
+		Message: "the registration is within the registration quotas",
+	})
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("Registration quotas", func() {
+	hostedCluster := func(name, team string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: name, Namespace: "clusters", Labels: map[string]string{"team": team},
+		}}
+	}
+	registered := func(hc *hypershiftv1beta1.HostedCluster) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:        hc.Name,
+			Namespace:   defaultGitOpsNamespace,
+			Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+			Annotations: map[string]string{hyperOpsHostedClusterAnnotation: client.ObjectKeyFromObject(hc).String()},
+		}}
+	}
+
+	It("Should validate quotas", func() {
+		Expect(ValidateRegistrationQuotas([]hyperopsv1alpha1.RegistrationQuota{{Name: "team", LabelKey: "team", Max: 10}})).To(Succeed())
+		Expect(ValidateRegistrationQuotas([]hyperopsv1alpha1.RegistrationQuota{{Max: 10}})).NotTo(Succeed())
+		Expect(ValidateRegistrationQuotas([]hyperopsv1alpha1.RegistrationQuota{{Name: "a", Max: 1}, {Name: "a", Max: 2}})).NotTo(Succeed())
+		Expect(ValidateRegistrationQuotas([]hyperopsv1alpha1.RegistrationQuota{{Name: "a", Max: -1}})).NotTo(Succeed())
+		Expect(ValidateRegistrationQuotas([]hyperopsv1alpha1.RegistrationQuota{{Name: "a", LabelKey: "not a key", Max: 1}})).NotTo(Succeed())
+	})
+
+	It("Should hold back new registrations of a team at its quota and keep registered ones", func() {
+		a1, a2, b1 := hostedCluster("a1", "a"), hostedCluster("a2", "a"), hostedCluster("b1", "b")
+		recorder := record.NewFakeRecorder(10)
+		r := &HyperOpsReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(a1, a2, b1, registered(a1)).Build(),
+			Quotas:   []hyperopsv1alpha1.RegistrationQuota{{Name: "team", LabelKey: "team", Max: 1}},
+			Recorder: recorder,
+		}
+
+		reg := &registration{hc: a2}
+		stop, err := r.enforceQuotas(context.Background(), reg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(reg.waiting).To(ContainSubstring("quota team allows 1 registered HostedClusters for team=a, 1 are registered"))
+		Expect(reg.requeueAfter).To(Equal(quotaRecheckInterval))
+		Expect(meta.IsStatusConditionTrue(registrationConditions(a2), ConditionQuotaExceeded)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Warning QuotaExceeded")))
+
+		By("not repeating the event while the quota is exceeded")
+		_, err = r.enforceQuotas(context.Background(), &registration{hc: a2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("keeping the registered HostedCluster and other teams")
+		for _, hc := range []*hypershiftv1beta1.HostedCluster{a1, b1} {
+			stop, err = r.enforceQuotas(context.Background(), &registration{hc: hc})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stop).To(BeFalse())
+		}
+
+		By("admitting the HostedCluster once a slot is free")
+		r.Quotas[0].Max = 2
+		stop, err = r.enforceQuotas(context.Background(), &registration{hc: a2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(meta.IsStatusConditionFalse(registrationConditions(a2), ConditionQuotaExceeded)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("Normal WithinQuota")))
+	})
+
+	It("Should only count registrations into the gitops namespace of the quota", func() {
+		a1, a2 := hostedCluster("a1", "a"), hostedCluster("a2", "a")
+		r := &HyperOpsReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(a1, a2, registered(a1)).Build(),
+			Quotas: []hyperopsv1alpha1.RegistrationQuota{{Name: "production", GitOpsNamespace: "production-gitops", Max: 1}},
+		}
+		exceeded, err := r.exceededQuota(context.Background(), a2, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exceeded).To(BeEmpty())
+
+		r.Quotas[0].GitOpsNamespace = defaultGitOpsNamespace
+		exceeded, err = r.exceededQuota(context.Background(), a2, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exceeded).To(ContainSubstring("namespace clusters"))
+	})
+})
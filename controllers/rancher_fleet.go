@@ -0,0 +1,161 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// DefaultRancherFleetRegistrationTokenTTL is the time to live of the ClusterRegistrationTokens if none is configured
+	DefaultRancherFleetRegistrationTokenTTL = 24 * time.Hour
+
+	// rancherFleetKubeconfigKey holds the kubeconfig in the secret, the key Fleet reads
+	rancherFleetKubeconfigKey = "value"
+)
+
+var (
+	rancherFleetClusterGVK           = schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "Cluster"}
+	rancherFleetRegistrationTokenGVK = schema.GroupVersionKind{Group: "fleet.cattle.io", Version: "v1alpha1", Kind: "ClusterRegistrationToken"}
+)
+
+// RancherFleetRegistrar registers the HostedClusters with Rancher Fleet. Every hosted cluster gets a kubeconfig secret
+// and a Cluster in the Fleet workspace, so the Fleet controller deploys its agent with the kubeconfig (manager
+// initiated registration), and a ClusterRegistrationToken for agents registering on their own.
+type RancherFleetRegistrar struct {
+	Client               client.Client
+	Workspace            string
+	RegistrationTokenTTL time.Duration
+}
+
+var _ Registrar = &RancherFleetRegistrar{}
+
+// NewRancherFleetRegistrar returns a RancherFleetRegistrar writing to the workspace of the config
+func NewRancherFleetRegistrar(c client.Client, config hyperopsv1alpha1.RancherFleetConfig) (*RancherFleetRegistrar, error) {
+	if errs := validation.IsDNS1123Label(config.Workspace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid fleet workspace %q: %s", config.Workspace, strings.Join(errs, ", "))
+	}
+	f := &RancherFleetRegistrar{Client: c, Workspace: config.Workspace, RegistrationTokenTTL: DefaultRancherFleetRegistrationTokenTTL}
+	if config.RegistrationTokenTTL != nil {
+		if config.RegistrationTokenTTL.Duration <= 0 {
+			return nil, fmt.Errorf("the fleet registration token ttl %s must be positive", config.RegistrationTokenTTL.Duration)
+		}
+		f.RegistrationTokenTTL = config.RegistrationTokenTTL.Duration
+	}
+	return f, nil
+}
+
+// ValidateRancherFleetConfig returns an error if no RancherFleetRegistrar can be created from the config
+func ValidateRancherFleetConfig(config *hyperopsv1alpha1.RancherFleetConfig) error {
+	_, err := NewRancherFleetRegistrar(nil, *config)
+	return err
+}
+
+func (f *RancherFleetRegistrar) Name() string {
+	return "rancher-fleet"
+}
+
+// Register writes the kubeconfig secret, the Cluster and the ClusterRegistrationToken of the HostedCluster. The
+// Cluster carries the labels of the ArgoCD cluster secret, so GitRepos target hosted clusters the way ApplicationSets
+// do.
+func (f *RancherFleetRegistrar) Register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	kubeconfig, err := clusterKubeconfig(cluster)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: rancherFleetKubeconfigSecretName(hc), Namespace: f.Workspace}}
+	if _, err := CreateOrUpdateWithRetries(ctx, f.Client, secret, func() error {
+		if err := claimRegistrarObject(secret, hc); err != nil {
+			return err
+		}
+		secret.Data = map[string][]byte{rancherFleetKubeconfigKey: kubeconfig}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to write the kubeconfig secret: %w", err)
+	}
+
+	fleetCluster := &unstructured.Unstructured{}
+	fleetCluster.SetGroupVersionKind(rancherFleetClusterGVK)
+	fleetCluster.SetNamespace(f.Workspace)
+	fleetCluster.SetName(hc.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, f.Client, fleetCluster, func() error {
+		if err := claimRegistrarObject(fleetCluster, hc); err != nil {
+			return err
+		}
+		// Fleet and Rancher label the Cluster as well, only the hyper-ops labels are replaced, so e.g. a lifted
+		// exclusion reaches the Cluster
+		existing := map[string]string{}
+		for k, v := range fleetCluster.GetLabels() {
+			if !isHyperOpsLabel(k) {
+				existing[k] = v
+			}
+		}
+		fleetCluster.SetLabels(mergeLabels(existing, cluster.LabelSchema.Apply(hostedClusterLabels(hc)), cluster.PolicyLabels))
+		if err := unstructured.SetNestedField(fleetCluster.Object, secret.Name, "spec", "kubeConfigSecret"); err != nil {
+			return err
+		}
+		return unstructured.SetNestedField(fleetCluster.Object, f.Workspace, "spec", "kubeConfigSecretNamespace")
+	}); err != nil {
+		return fmt.Errorf("unable to write the Cluster: %w", err)
+	}
+
+	token := &unstructured.Unstructured{}
+	token.SetGroupVersionKind(rancherFleetRegistrationTokenGVK)
+	token.SetNamespace(f.Workspace)
+	token.SetName(hc.Name)
+	if _, err := CreateOrUpdateWithRetries(ctx, f.Client, token, func() error {
+		if err := claimRegistrarObject(token, hc); err != nil {
+			return err
+		}
+		return unstructured.SetNestedField(token.Object, f.RegistrationTokenTTL.String(), "spec", "ttl")
+	}); err != nil {
+		return fmt.Errorf("unable to write the ClusterRegistrationToken: %w", err)
+	}
+	return nil
+}
+
+// Deregister deletes the Cluster, the ClusterRegistrationToken and the kubeconfig secret of the HostedCluster. The
+// Cluster goes first, so Fleet can still remove its agent with the kubeconfig.
+func (f *RancherFleetRegistrar) Deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	fleetCluster := &unstructured.Unstructured{}
+	fleetCluster.SetGroupVersionKind(rancherFleetClusterGVK)
+	fleetCluster.SetName(hc.Name)
+	token := &unstructured.Unstructured{}
+	token.SetGroupVersionKind(rancherFleetRegistrationTokenGVK)
+	token.SetName(hc.Name)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: rancherFleetKubeconfigSecretName(hc)}}
+	return deleteRegistrarObjects(ctx, f.Client, hc, f.Workspace, fleetCluster, token, secret)
+}
+
+// rancherFleetKubeconfigSecretName returns the name of the kubeconfig secret of the HostedCluster
+func rancherFleetKubeconfigSecretName(hc *hypershiftv1beta1.HostedCluster) string {
+	return hc.Name + "-fleet-kubeconfig"
+}
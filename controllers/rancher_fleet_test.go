@@ -0,0 +1,130 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Rancher Fleet registrar", func() {
+	hostedCluster := func(hcLabels map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{
+			Name: "hosted", Namespace: "clusters", UID: "uid", Labels: hcLabels,
+		}}
+	}
+	cluster := &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   "hosted",
+			Server: "https://hosted:6443",
+			Config: argocd.ClusterConfig{BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+		},
+		PolicyLabels: map[string]string{"env": "prod"},
+	}
+	registrar := func(c client.Client) *RancherFleetRegistrar {
+		f, err := NewRancherFleetRegistrar(c, hyperopsv1alpha1.RancherFleetConfig{Workspace: "fleet-default"})
+		Expect(err).NotTo(HaveOccurred())
+		return f
+	}
+	fleetObject := func(c client.Client, gvk schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		return obj, c.Get(context.Background(), client.ObjectKey{Namespace: "fleet-default", Name: "hosted"}, obj)
+	}
+
+	It("Should validate the rancher fleet config", func() {
+		Expect(ValidateRancherFleetConfig(&hyperopsv1alpha1.RancherFleetConfig{Workspace: "fleet-default"})).To(Succeed())
+		Expect(ValidateRancherFleetConfig(&hyperopsv1alpha1.RancherFleetConfig{})).NotTo(Succeed())
+		Expect(ValidateRancherFleetConfig(&hyperopsv1alpha1.RancherFleetConfig{
+			Workspace: "fleet-default", RegistrationTokenTTL: &metav1.Duration{Duration: -time.Hour},
+		})).NotTo(Succeed())
+	})
+
+	It("Should write the kubeconfig secret, Cluster and ClusterRegistrationToken of the cluster", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		hc := hostedCluster(map[string]string{hyperOpsExcludedLabel: "true"})
+		Expect(registrar(c).Register(context.Background(), hc, cluster)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "fleet-default", Name: "hosted-fleet-kubeconfig"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+		kubeconfig, err := clientcmd.Load(secret.Data[rancherFleetKubeconfigKey])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubeconfig.Clusters["hosted"].Server).To(Equal("https://hosted:6443"))
+
+		fleetCluster, err := fleetObject(c, rancherFleetClusterGVK)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fleetCluster.GetLabels()).To(HaveKeyWithValue("env", "prod"))
+		Expect(fleetCluster.GetLabels()).To(HaveKeyWithValue(hyperOpsExcludedLabel, "true"))
+		Expect(fleetCluster.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		kubeConfigSecret, _, _ := unstructured.NestedString(fleetCluster.Object, "spec", "kubeConfigSecret")
+		Expect(kubeConfigSecret).To(Equal("hosted-fleet-kubeconfig"))
+
+		token, err := fleetObject(c, rancherFleetRegistrationTokenGVK)
+		Expect(err).NotTo(HaveOccurred())
+		ttl, _, _ := unstructured.NestedString(token.Object, "spec", "ttl")
+		Expect(ttl).To(Equal("24h0m0s"))
+
+		// labels set by Fleet stay, a lifted exclusion reaches the Cluster
+		fleetCluster.SetLabels(mergeLabels(fleetCluster.GetLabels(), map[string]string{"management.cattle.io/cluster-name": "c-1"}))
+		Expect(c.Update(context.Background(), fleetCluster)).To(Succeed())
+		Expect(registrar(c).Register(context.Background(), hostedCluster(nil), cluster)).To(Succeed())
+		fleetCluster, err = fleetObject(c, rancherFleetClusterGVK)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fleetCluster.GetLabels()).To(HaveKey("management.cattle.io/cluster-name"))
+		Expect(fleetCluster.GetLabels()).NotTo(HaveKey(hyperOpsExcludedLabel))
+	})
+
+	It("Should deregister the cluster and leave clusters it did not write alone", func() {
+		foreign := &unstructured.Unstructured{}
+		foreign.SetGroupVersionKind(rancherFleetClusterGVK)
+		foreign.SetNamespace("fleet-default")
+		foreign.SetName("other")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(foreign).Build()
+		Expect(registrar(c).Register(context.Background(), hostedCluster(nil), cluster)).To(Succeed())
+
+		other := hostedCluster(nil)
+		other.Name = "other"
+		Expect(registrar(c).Register(context.Background(), other, cluster)).NotTo(Succeed())
+		Expect(registrar(c).Deregister(context.Background(), other)).To(Succeed())
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(foreign), foreign)).To(Succeed())
+
+		Expect(registrar(c).Deregister(context.Background(), hostedCluster(nil))).To(Succeed())
+		_, err := fleetObject(c, rancherFleetClusterGVK)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = fleetObject(c, rancherFleetRegistrationTokenGVK)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		err = c.Get(context.Background(), client.ObjectKey{Namespace: "fleet-default", Name: "hosted-fleet-kubeconfig"}, &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,116 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Registrar registers the HostedClusters with a GitOps tool besides ArgoCD, using the credential hyper-ops obtained
+// for the ArgoCD cluster secret
+type Registrar interface {
+	// Name names the GitOps tool in errors and events
+	Name() string
+	// Register writes the registration of the cluster. It is called with every registration, so the registration
+	// follows token renewals.
+	Register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error
+	// Deregister removes the registration of the HostedCluster, if any
+	Deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error
+}
+
+// register registers the cluster with all registrars. Registrars that can't use the credential are skipped with a
+// warning event, the registration in ArgoCD is fine regardless.
+func (r *HyperOpsReconciler) register(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, cluster *Cluster) error {
+	if r.readOnly() {
+		return nil
+	}
+	for _, registrar := range r.Registrars {
+		err := registrar.Register(ctx, hc, cluster)
+		if errors.Is(err, errCredentialNotExportable) {
+			r.recordEvent(hc, corev1.EventTypeWarning, "RegistrarSkipped", fmt.Sprintf("%s: %s", registrar.Name(), err))
+			if err := registrar.Deregister(ctx, hc); err != nil {
+				return fmt.Errorf("unable to deregister from %s: %w", registrar.Name(), err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to register with %s: %w", registrar.Name(), err)
+		}
+	}
+	return nil
+}
+
+// deregister removes the registrations of the HostedCluster from all registrars
+func (r *HyperOpsReconciler) deregister(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	if r.readOnly() {
+		return nil
+	}
+	for _, registrar := range r.Registrars {
+		if err := registrar.Deregister(ctx, hc); err != nil {
+			return fmt.Errorf("unable to deregister from %s: %w", registrar.Name(), err)
+		}
+	}
+	return nil
+}
+
+// claimRegistrarObject marks the object as written by a registrar for the HostedCluster. Existing objects written for
+// another HostedCluster, or not written by hyper-ops, are not taken over.
+func claimRegistrarObject(obj client.Object, hc *hypershiftv1beta1.HostedCluster) error {
+	owner := client.ObjectKeyFromObject(hc).String()
+	if obj.GetResourceVersion() != "" && obj.GetAnnotations()[hyperOpsHostedClusterAnnotation] != owner {
+		return fmt.Errorf("%s/%s exists and was not written by hyper-ops for %s", obj.GetNamespace(), obj.GetName(), owner)
+	}
+	obj.SetLabels(managedLabels(obj.GetLabels()))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for k, v := range clusterIdentityAnnotations(hc) {
+		annotations[k] = v
+	}
+	annotations[hyperOpsHostedClusterAnnotation] = owner
+	obj.SetAnnotations(annotations)
+	return nil
+}
+
+// deleteRegistrarObjects deletes the named objects in the namespace in order. Objects that are gone, whose kind is
+// not installed or that were not written for the HostedCluster are skipped.
+func deleteRegistrarObjects(ctx context.Context, c client.Client, hc *hypershiftv1beta1.HostedCluster, namespace string, objs ...client.Object) error {
+	for _, obj := range objs {
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: obj.GetName()}, obj); err != nil {
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return err
+		}
+		if obj.GetAnnotations()[hyperOpsHostedClusterAnnotation] != client.ObjectKeyFromObject(hc).String() {
+			continue
+		}
+		if err := c.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
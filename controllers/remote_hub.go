@@ -0,0 +1,118 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/version"
+)
+
+// remoteHubKubeconfigKey holds the kubeconfig in the secrets referenced by the operator, e.g. of the remote hub
+const remoteHubKubeconfigKey = "kubeconfig"
+
+// RemoteRegistrations writes the ArgoCD cluster secrets to an ArgoCD outside of the management cluster, through the
+// registration proxy or directly to a remote hub
+type RemoteRegistrations interface {
+	// Apply creates or updates the secret
+	Apply(ctx context.Context, secret *corev1.Secret) error
+	// Delete deletes the secret
+	Delete(ctx context.Context, secret *corev1.Secret) error
+}
+
+// RemoteHub writes the ArgoCD cluster secrets to the gitops namespaces of a hub cluster running ArgoCD, for
+// management clusters that don't run ArgoCD themselves
+type RemoteHub struct {
+	// Client of the hub cluster
+	Client client.Client
+}
+
+// NewRemoteHub returns a RemoteHub writing with the identity of the kubeconfig
+func NewRemoteHub(kubeconfig []byte) (*RemoteHub, error) {
+	c, err := GetClientForCluster(kubeconfig, WithUserAgent(fmt.Sprintf("hyper-ops/%s (remote-hub)", version.Version)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote hub kubeconfig: %w", err)
+	}
+	return &RemoteHub{Client: c}, nil
+}
+
+// RemoteHubKubeconfig reads the kubeconfig of the remote hub from the kubeconfig key of the <namespace>/<name> secret
+func RemoteHubKubeconfig(ctx context.Context, reader client.Reader, ref string) ([]byte, error) {
+	return kubeconfigFromSecret(ctx, reader, "remote hub", ref)
+}
+
+// kubeconfigFromSecret reads the kubeconfig key of the <namespace>/<name> secret, what names the cluster in errors
+func kubeconfigFromSecret(ctx context.Context, reader client.Reader, what, ref string) ([]byte, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid %s kubeconfig secret %q, must be <namespace>/<name>", what, ref)
+	}
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, err
+	}
+	kubeconfig, ok := secret.Data[remoteHubKubeconfigKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", ref, remoteHubKubeconfigKey)
+	}
+	return kubeconfig, nil
+}
+
+// Apply creates or updates the ArgoCD cluster secret on the hub
+func (h *RemoteHub) Apply(ctx context.Context, desired *corev1.Secret) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+	_, err := CreateOrUpdateWithRetries(ctx, h.Client, secret, func() error {
+		secret.Labels = desired.Labels
+		for k, v := range desired.Annotations {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, k, v)
+		}
+		secret.Data = desired.Data
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	})
+	return err
+}
+
+// Delete deletes the ArgoCD cluster secret from the hub, secrets not written by hyper-ops are left alone
+func (h *RemoteHub) Delete(ctx context.Context, secret *corev1.Secret) error {
+	existing := &corev1.Secret{}
+	if err := h.Client.Get(ctx, client.ObjectKeyFromObject(secret), existing); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !hyperOpsManaged(existing) {
+		return &InvariantViolation{Invariant: "only secrets created by hyper-ops may be deleted", Object: client.ObjectKeyFromObject(secret).String()}
+	}
+	return client.IgnoreNotFound(h.Client.Delete(ctx, existing, client.Preconditions{UID: &existing.UID, ResourceVersion: &existing.ResourceVersion}))
+}
+
+// remoteRegistrations returns the writer of the ArgoCD cluster secrets if they are not written to the management
+// cluster, nil otherwise
+func (r *HyperOpsReconciler) remoteRegistrations() RemoteRegistrations {
+	switch {
+	case r.RegistrationProxy != nil:
+		return r.RegistrationProxy
+	case r.RemoteHub != nil:
+		return r.RemoteHub
+	}
+	return nil
+}
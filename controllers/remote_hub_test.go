@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Remote hub", func() {
+	var local, hub client.Client
+	var r *HyperOpsReconciler
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "uid"}}
+	key := client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}
+	labels := map[string]string{hyperOpsTypeLabel: "hosted"}
+	cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443", Config: argocd.ClusterConfig{BearerToken: "token"}}, HostedCluster: hc}
+
+	BeforeEach(func() {
+		local = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc.DeepCopy()).Build()
+		hub = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r = &HyperOpsReconciler{Client: local, RemoteHub: &RemoteHub{Client: hub}}
+	})
+
+	It("Should write and delete the ArgoCD cluster secrets on the hub", func() {
+		cluster.TokenExpiresAt = time.Now().Add(boundTokenExpiration).Truncate(time.Second)
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.writeArgoCDClusterSecret(context.Background(), defaultGitOpsNamespace, labels, cluster, data)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(hub.Get(context.Background(), key, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(data))
+		Expect(secret.Labels).To(HaveKeyWithValue(argoCDSecretTypeLabel, argoCDSecretTypeCluster))
+		Expect(apierrors.IsNotFound(local.Get(context.Background(), key, &corev1.Secret{}))).To(BeTrue())
+		Expect(r.registrationFeatures(hc).RemoteHub).To(BeTrue())
+
+		// the token on the hub is reused until it needs renewal
+		token, _, ok := r.currentBoundToken(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(ok).To(BeTrue())
+		Expect(token).To(Equal("token"))
+
+		Expect(r.deregisterArgoCDClusterSecrets(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(apierrors.IsNotFound(hub.Get(context.Background(), key, secret))).To(BeTrue())
+		// deleting again is a no-op
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}})).To(Succeed())
+	})
+
+	It("Should refuse to delete secrets on the hub not created by hyper-ops", func() {
+		foreign := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster},
+		}}
+		Expect(hub.Create(context.Background(), foreign)).To(Succeed())
+		Expect(isInvariantViolation(r.RemoteHub.Delete(context.Background(), foreign))).To(BeTrue())
+		Expect(hub.Get(context.Background(), key, &corev1.Secret{})).To(Succeed())
+	})
+
+	It("Should read the kubeconfig of the hub from a secret", func() {
+		Expect(local.Create(context.Background(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "hub-kubeconfig", Namespace: "hyper-ops"},
+			Data:       map[string][]byte{remoteHubKubeconfigKey: []byte("kubeconfig")},
+		})).To(Succeed())
+		kubeconfig, err := RemoteHubKubeconfig(context.Background(), local, "hyper-ops/hub-kubeconfig")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kubeconfig).To(Equal([]byte("kubeconfig")))
+
+		_, err = RemoteHubKubeconfig(context.Background(), local, "hub-kubeconfig")
+		Expect(err).To(HaveOccurred())
+		_, err = RemoteHubKubeconfig(context.Background(), local, "hyper-ops/missing")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		_, err = NewRemoteHub([]byte("not a kubeconfig"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+// RenderedBearerToken stands in for the bearer token of rendered registrations, the token is issued by the hosted
+// cluster
+const RenderedBearerToken = "rendered-bearer-token"
+
+// RenderOptions are the inputs of a rendered registration the controller would otherwise read from the clusters
+type RenderOptions struct {
+	// Server is the API server of the hosted cluster, read from the admin kubeconfig by the controller
+	Server string
+	// ArgoCDVersion is the version of the ArgoCD instance the features are negotiated with, all features are
+	// supported if empty
+	ArgoCDVersion string
+	// Policies are the registration policies evaluated for the HostedCluster
+	Policies []*RegistrationPolicy
+}
+
+// RenderedRegistration is the outcome of a rendered registration
+type RenderedRegistration struct {
+	// Secrets are the ArgoCD cluster secrets, the secret in the gitops namespace first followed by its copies
+	Secrets []*corev1.Secret
+	// Skipped explains why nothing would be registered, e.g. a veto of a registration policy
+	Skipped string
+}
+
+// RenderRegistration renders the ArgoCD cluster secrets of the HostedCluster with the render phase of the controller
+// against an in-memory hub, nothing is read from or written to a cluster. The output only depends on the inputs:
+// the credential is RenderedBearerToken and the controller version annotation is left out, so rendered
+// registrations can be compared with golden files across releases.
+func RenderRegistration(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, opts RenderOptions) (*RenderedRegistration, error) {
+	if opts.Server == "" {
+		return nil, fmt.Errorf("the server of the hosted cluster is required")
+	}
+	hub := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(hub); err != nil {
+		return nil, err
+	}
+	if err := hypershiftv1beta1.AddToScheme(hub); err != nil {
+		return nil, err
+	}
+	hc = hc.DeepCopy()
+	r := &HyperOpsReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(hub).WithObjects(hc).Build(),
+		Scheme:   hub,
+		Policies: opts.Policies,
+	}
+	gitOpsNamespace := hostedClusterGitOpsNamespace(hc, r.GitOpsNamespaceRoutes)
+	capabilities := ArgoCDCapabilities{ProjectScopedClusters: true, ApplicationsInAnyNamespace: true}
+	if opts.ArgoCDVersion != "" {
+		capabilities = capabilitiesForVersion(opts.ArgoCDVersion)
+	}
+	r.capabilities.set(gitOpsNamespace, capabilities, time.Now())
+
+	reg := &registration{
+		hc:              hc,
+		gitOpsNamespace: gitOpsNamespace,
+		server:          opts.Server,
+		cluster: &Cluster{
+			Cluster: argocd.Cluster{
+				Name:   hc.Name,
+				Server: opts.Server,
+				Config: argocd.ClusterConfig{BearerToken: RenderedBearerToken},
+			},
+			HostedCluster: hc,
+		},
+	}
+	stop, err := r.renderSecretPhase(ctx, reg)
+	if err != nil {
+		return nil, err
+	}
+	if stop {
+		skipped := reg.waiting
+		if condition := meta.FindStatusCondition(registrationConditions(hc), ConditionPolicyAllowed); condition != nil && condition.Status == metav1.ConditionFalse {
+			skipped = condition.Message
+		}
+		return &RenderedRegistration{Skipped: skipped}, nil
+	}
+
+	rendered := &RenderedRegistration{}
+	for _, namespace := range append([]string{gitOpsNamespace}, additionalGitOpsNamespaces(hc, gitOpsNamespace)...) {
+		labels, annotations := r.argoCDClusterSecretMetadata(namespace, reg.labels, reg.cluster)
+		delete(annotations, hyperOpsControllerVersionAnnotation)
+		rendered.Secrets = append(rendered.Secrets, &corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        reg.cluster.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Data: reg.renderedData,
+			Type: corev1.SecretTypeOpaque,
+		})
+	}
+	return rendered, nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Render", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				UID:         "hosted-uid",
+				Labels:      map[string]string{"env": "prod"},
+				Annotations: map[string]string{hyperOpsProjectAnnotation: "team-a"},
+			},
+			Spec: hypershiftv1beta1.HostedClusterSpec{InfraID: "hosted-x7k2p"},
+		}
+	})
+
+	It("Should render the ArgoCD cluster secret with the registration policies", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{
+			Name:   "tier",
+			Labels: `{"tier": hostedCluster.metadata.labels["env"] == "prod" ? "gold" : "silver"}`,
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		opts := RenderOptions{Server: "https://api.hosted:6443", Policies: policies}
+
+		rendered, err := RenderRegistration(context.Background(), hc, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Skipped).To(BeEmpty())
+		Expect(rendered.Secrets).To(HaveLen(1))
+		secret := rendered.Secrets[0]
+		Expect(secret.Namespace).To(Equal(defaultGitOpsNamespace))
+		Expect(secret.Labels).To(HaveKeyWithValue("tier", "gold"))
+		Expect(secret.Labels).To(HaveKeyWithValue(argoCDSecretTypeLabel, argoCDSecretTypeCluster))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsHostedClusterAnnotation, "clusters/hosted"))
+		Expect(secret.Annotations).NotTo(HaveKey(hyperOpsControllerVersionAnnotation))
+		cluster, err := argocd.ClusterFromSecretData(secret.Data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Server).To(Equal("https://api.hosted:6443"))
+		Expect(cluster.Project).To(Equal("team-a"))
+		Expect(cluster.Config.BearerToken).To(Equal(RenderedBearerToken))
+
+		// the same inputs render the same outputs, the input is never modified
+		again, err := RenderRegistration(context.Background(), hc, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(Equal(rendered))
+		Expect(hc.Annotations).NotTo(HaveKey(hyperOpsConditionsAnnotation))
+
+		// features the ArgoCD version doesn't support are left out like in the controller
+		opts.ArgoCDVersion = "2.3.0"
+		rendered, err = RenderRegistration(context.Background(), hc, opts)
+		Expect(err).NotTo(HaveOccurred())
+		cluster, err = argocd.ClusterFromSecretData(rendered.Secrets[0].Data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Project).To(BeEmpty())
+	})
+
+	It("Should report registrations vetoed by a policy", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{{
+			Name:     "no-prod",
+			Validate: `hostedCluster.metadata.labels["env"] != "prod"`,
+			Message:  "prod clusters are registered by the platform team",
+		}})
+		Expect(err).NotTo(HaveOccurred())
+
+		rendered, err := RenderRegistration(context.Background(), hc, RenderOptions{Server: "https://api.hosted:6443", Policies: policies})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered.Secrets).To(BeEmpty())
+		Expect(rendered.Skipped).To(Equal("vetoed by policy no-prod: prod clusters are registered by the platform team"))
+	})
+})
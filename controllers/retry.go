@@ -0,0 +1,149 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/cldmnky/hyper-ops/pkg/retry"
+)
+
+var (
+	// hubAPIBackoff spaces the retries of transient hub API errors, the jitter keeps the retries of many
+	// registrations from hitting a struggling API server at the same time
+	hubAPIBackoff = wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   1,
+		Steps:    6,
+		Cap:      10 * time.Second,
+	}
+	// hubAPIRetryTimeout caps the time a single write retries transient hub API errors, so a struggling hub doesn't
+	// block a reconcile worker
+	hubAPIRetryTimeout = 30 * time.Second
+
+	// hostedClusterAPIBackoff spaces the retries of transient errors of hosted cluster API servers. They are retried
+	// for a shorter time than the hub, a hosted cluster that is still coming up is picked up by the next reconcile.
+	hostedClusterAPIBackoff = wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   1,
+		Steps:    4,
+		Cap:      5 * time.Second,
+	}
+	// hostedClusterAPIRetryTimeout caps the time a single request retries transient hosted cluster API errors
+	hostedClusterAPIRetryTimeout = 10 * time.Second
+
+	hubAPIRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hyperops_hub_api_retries_total",
+		Help: "Writes to the hub API retried after a transient error, by reason",
+	}, []string{"reason"})
+	hostedClusterAPIRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hyperops_hosted_cluster_api_retries_total",
+		Help: "Requests to hosted cluster APIs retried after a transient error, by reason",
+	}, []string{"reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(hubAPIRetries, hostedClusterAPIRetries)
+}
+
+// hubRetryPolicy returns the policy of writes to the hub API
+func hubRetryPolicy() retry.Policy {
+	return retry.Policy{
+		Name:      "hub",
+		Conflicts: retry.DefaultConflictBackoff,
+		Transient: hubAPIBackoff,
+		Timeout:   hubAPIRetryTimeout,
+		OnRetry:   countRetries(hubAPIRetries),
+	}
+}
+
+// hostedClusterRetryPolicy returns the policy of requests to hosted cluster APIs, writes as well as token requests
+func hostedClusterRetryPolicy() retry.Policy {
+	return retry.Policy{
+		Name:      "hosted cluster",
+		Conflicts: retry.DefaultConflictBackoff,
+		Transient: hostedClusterAPIBackoff,
+		Timeout:   hostedClusterAPIRetryTimeout,
+		OnRetry:   countRetries(hostedClusterAPIRetries),
+	}
+}
+
+// countRetries counts the retries of transient errors, conflicts are expected and not counted
+func countRetries(counter *prometheus.CounterVec) func(string, int, time.Duration, error) {
+	return func(reason string, _ int, _ time.Duration, _ error) {
+		if reason != retry.ReasonConflict {
+			counter.WithLabelValues(reason).Inc()
+		}
+	}
+}
+
+// CreateOrUpdateWithRetries creates or updates the given object in the hub with the hub retry policy. Conflicts are
+// retried with the default backoff. Timeouts, webhook failures and server errors of the API server are retried with a
+// jittered backoff for at most hubAPIRetryTimeout, and returned as a HubAPIError if they persist.
+func CreateOrUpdateWithRetries(
+	ctx context.Context,
+	c client.Client,
+	obj client.Object,
+	f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
+	operationResult, err := CreateOrUpdateWithPolicy(ctx, hubRetryPolicy(), c, obj, f)
+	var retryErr *retry.Error
+	if errors.As(err, &retryErr) {
+		return operationResult, &HubAPIError{Reason: retryErr.Reason, Attempts: retryErr.Attempts, Err: retryErr.Err}
+	}
+	return operationResult, err
+}
+
+// CreateOrUpdateWithPolicy creates or updates the given object with the retries of the policy
+func CreateOrUpdateWithPolicy(
+	ctx context.Context,
+	policy retry.Policy,
+	c client.Client,
+	obj client.Object,
+	f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
+	log := log.FromContext(ctx)
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(reason string, attempt int, delay time.Duration, err error) {
+		// only the key is logged, the objects may be secrets
+		log.V(3).Info("Retrying request", "resource", client.ObjectKeyFromObject(obj), "api", policy.Name, "reason", reason, "delay", delay)
+		if onRetry != nil {
+			onRetry(reason, attempt, delay, err)
+		}
+	}
+	var operationResult controllerutil.OperationResult
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		var err error
+		operationResult, err = controllerutil.CreateOrUpdate(ctx, c, obj, f)
+		return err
+	})
+	if err != nil {
+		log.V(5).Error(err, "Failed to create/update resource", "resource", client.ObjectKeyFromObject(obj))
+		return operationResult, err
+	}
+	log.V(5).Info("Successfully created/updated resource", "resource", client.ObjectKeyFromObject(obj), "operation", operationResult)
+	return operationResult, nil
+}
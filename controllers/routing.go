@@ -0,0 +1,102 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+// GitOpsNamespaceRoute routes the HostedClusters matching the selector into the gitops namespace
+type GitOpsNamespaceRoute struct {
+	Selector  labels.Selector
+	Namespace string
+}
+
+// GitOpsNamespaceRoutes is a routing table of gitops namespaces, the first matching route wins
+type GitOpsNamespaceRoutes []GitOpsNamespaceRoute
+
+// ParseGitOpsNamespaceRoutes parses a semicolon separated list of <selector>:<namespace> routes, e.g.
+// "purpose=ml:argocd-ml;tier in (gold,silver):argocd-premium"
+func ParseGitOpsNamespaceRoutes(raw string) (GitOpsNamespaceRoutes, error) {
+	routes := GitOpsNamespaceRoutes{}
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid gitops namespace route %q, must be <selector>:<namespace>", entry)
+		}
+		selector, err := labels.Parse(entry[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of gitops namespace route %q: %w", entry, err)
+		}
+		route := GitOpsNamespaceRoute{Selector: selector, Namespace: strings.TrimSpace(entry[i+1:])}
+		if err := validateGitOpsNamespaceRoute(route); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// CompileGitOpsNamespaceRoutes converts the routes of the operator config into a routing table
+func CompileGitOpsNamespaceRoutes(config []hyperopsv1alpha1.GitOpsNamespaceRoute) (GitOpsNamespaceRoutes, error) {
+	routes := GitOpsNamespaceRoutes{}
+	for i := range config {
+		selector, err := metav1.LabelSelectorAsSelector(&config[i].Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of gitops namespace route to %s: %w", config[i].Namespace, err)
+		}
+		route := GitOpsNamespaceRoute{Selector: selector, Namespace: config[i].Namespace}
+		if err := validateGitOpsNamespaceRoute(route); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func validateGitOpsNamespaceRoute(route GitOpsNamespaceRoute) error {
+	if route.Selector.Empty() {
+		return fmt.Errorf("gitops namespace route to %s has an empty selector, use the default gitops namespace instead", route.Namespace)
+	}
+	if errs := validation.IsDNS1123Label(route.Namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid gitops namespace route namespace %q: %s", route.Namespace, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Namespace returns the gitops namespace of the first route matching the labels of the HostedCluster
+func (routes GitOpsNamespaceRoutes) Namespace(hc *hypershiftv1beta1.HostedCluster) (string, bool) {
+	for _, route := range routes {
+		if route.Selector.Matches(labels.Set(hc.GetLabels())) {
+			return route.Namespace, true
+		}
+	}
+	return "", false
+}
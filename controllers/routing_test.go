@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+var _ = Describe("GitOps namespace routes", func() {
+	hostedCluster := func(labels map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", Labels: labels}}
+	}
+
+	It("Should parse the routes of the flag", func() {
+		routes, err := ParseGitOpsNamespaceRoutes("purpose=ml:argocd-ml; tier in (gold,silver):argocd-premium")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes).To(HaveLen(2))
+		Expect(routes[1].Namespace).To(Equal("argocd-premium"))
+
+		_, err = ParseGitOpsNamespaceRoutes("purpose=ml")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseGitOpsNamespaceRoutes(":argocd-ml")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseGitOpsNamespaceRoutes("purpose=ml:Not_A_Namespace")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseGitOpsNamespaceRoutes("purpose==ml=x:argocd-ml")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should compile the routes of the config file", func() {
+		routes, err := CompileGitOpsNamespaceRoutes([]hyperopsv1alpha1.GitOpsNamespaceRoute{{
+			Selector:  metav1.LabelSelector{MatchLabels: map[string]string{"purpose": "ml"}},
+			Namespace: "argocd-ml",
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		ns, ok := routes.Namespace(hostedCluster(map[string]string{"purpose": "ml"}))
+		Expect(ok).To(BeTrue())
+		Expect(ns).To(Equal("argocd-ml"))
+
+		_, err = CompileGitOpsNamespaceRoutes([]hyperopsv1alpha1.GitOpsNamespaceRoute{{Namespace: "argocd-ml"}})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should prefer the gitops namespace label over the first matching route", func() {
+		routes, err := ParseGitOpsNamespaceRoutes("purpose=ml:argocd-ml;env=prod:argocd-prod")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(hostedClusterGitOpsNamespace(hostedCluster(map[string]string{"purpose": "ml", "env": "prod"}), routes)).To(Equal("argocd-ml"))
+		Expect(hostedClusterGitOpsNamespace(hostedCluster(map[string]string{"env": "prod"}), routes)).To(Equal("argocd-prod"))
+		Expect(hostedClusterGitOpsNamespace(hostedCluster(map[string]string{"env": "dev"}), routes)).To(Equal(defaultGitOpsNamespace))
+		Expect(hostedClusterGitOpsNamespace(hostedCluster(map[string]string{
+			"purpose":                    "ml",
+			hyperOpsGitopsNamespaceLabel: "argocd-team",
+		}), routes)).To(Equal("argocd-team"))
+		Expect(hostedClusterGitOpsNamespace(hostedCluster(nil), nil)).To(Equal(defaultGitOpsNamespace))
+	})
+})
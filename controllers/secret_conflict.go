@@ -0,0 +1,150 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// SecretConflictPolicySkip leaves a secret owned by another tool untouched and reports the conflict (default)
+	SecretConflictPolicySkip = "skip"
+	// SecretConflictPolicyFail reports the conflict and fails the reconcile, which is retried with backoff
+	SecretConflictPolicyFail = "fail"
+	// SecretConflictPolicyAdopt takes over a secret owned by another tool, its owner references are removed
+	SecretConflictPolicyAdopt = "adopt"
+
+	// hyperOpsSecretConflictPolicyAnnotation overrides the secret conflict policy for a single HostedCluster
+	hyperOpsSecretConflictPolicyAnnotation = "hyper-ops.cloudmonkey.org/secret-conflict-policy"
+
+	// ConditionSecretConflict is true when the ArgoCD cluster secret of the HostedCluster exists but was not created
+	// by hyper-ops
+	ConditionSecretConflict = "SecretConflict"
+)
+
+// ValidateSecretConflictPolicy returns an error if the policy is not one of the secret conflict policies
+func ValidateSecretConflictPolicy(policy string) error {
+	switch policy {
+	case SecretConflictPolicySkip, SecretConflictPolicyFail, SecretConflictPolicyAdopt:
+		return nil
+	}
+	return fmt.Errorf("invalid secret conflict policy %q, must be %s, %s or %s", policy,
+		SecretConflictPolicySkip, SecretConflictPolicyFail, SecretConflictPolicyAdopt)
+}
+
+// SecretConflict is returned when the ArgoCD cluster secret exists but is owned by another tool and the conflict
+// policy does not allow hyper-ops to take it over
+type SecretConflict struct {
+	Secret string
+	Owner  string
+	Policy string
+}
+
+func (e *SecretConflict) Error() string {
+	return fmt.Sprintf("secret %s is owned by %s, not overwritten by the %s conflict policy", e.Secret, e.Owner, e.Policy)
+}
+
+// ignoreSkippedConflict returns nil if the error is a SecretConflict of the skip policy, the conflict was reported and
+// the registration is left as is
+func ignoreSkippedConflict(err error) error {
+	var conflict *SecretConflict
+	if errors.As(err, &conflict) && conflict.Policy == SecretConflictPolicySkip {
+		return nil
+	}
+	return err
+}
+
+// secretOwner describes the tool owning a secret not created by hyper-ops
+func secretOwner(secret *corev1.Secret) string {
+	if len(secret.OwnerReferences) > 0 {
+		ref := secret.OwnerReferences[0]
+		return fmt.Sprintf("%s %s", ref.Kind, ref.Name)
+	}
+	if managedBy := secret.Labels[managedByLabel]; managedBy != "" {
+		return managedBy
+	}
+	for k := range secret.Labels {
+		if strings.Contains(k, "open-cluster-management.io/") {
+			return "open-cluster-management"
+		}
+	}
+	return "another tool or a user"
+}
+
+// secretConflictPolicy returns the secret conflict policy of the cluster, the annotation of the HostedCluster wins
+// over the policy of the reconciler
+func (r *HyperOpsReconciler) secretConflictPolicy(cluster *Cluster) string {
+	if cluster.HostedCluster != nil {
+		if policy := cluster.HostedCluster.GetAnnotations()[hyperOpsSecretConflictPolicyAnnotation]; ValidateSecretConflictPolicy(policy) == nil {
+			return policy
+		}
+	}
+	if r.SecretConflictPolicy == "" {
+		return SecretConflictPolicySkip
+	}
+	return r.SecretConflictPolicy
+}
+
+// checkSecretConflict applies the conflict policy when the ArgoCD cluster secret exists but was not created by
+// hyper-ops. It returns a SecretConflict unless the secret may be written.
+func (r *HyperOpsReconciler) checkSecretConflict(ctx context.Context, cluster *Cluster, existing *corev1.Secret) error {
+	hc := cluster.HostedCluster
+	if hyperOpsManaged(existing) || existing.Labels[managedByLabel] == managedByValue {
+		if hc != nil && meta.FindStatusCondition(registrationConditions(hc), ConditionSecretConflict) != nil {
+			return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+				Type:    ConditionSecretConflict,
+				Status:  metav1.ConditionFalse,
+				Reason:  "NoConflict",
+				Message: fmt.Sprintf("secret %s is managed by hyper-ops", client.ObjectKeyFromObject(existing)),
+			})
+		}
+		return nil
+	}
+	policy := r.secretConflictPolicy(cluster)
+	conflict := &SecretConflict{Secret: client.ObjectKeyFromObject(existing).String(), Owner: secretOwner(existing), Policy: policy}
+	condition := metav1.Condition{Type: ConditionSecretConflict, Status: metav1.ConditionTrue, Message: conflict.Error()}
+	switch policy {
+	case SecretConflictPolicyAdopt:
+		log.FromContext(ctx).Info("adopting argocd cluster secret", "secret", conflict.Secret, "owner", conflict.Owner)
+		condition.Reason = "Adopted"
+		condition.Message = fmt.Sprintf("secret %s owned by %s was adopted", conflict.Secret, conflict.Owner)
+		if hc == nil {
+			return nil
+		}
+		return r.setRegistrationCondition(ctx, hc, condition)
+	case SecretConflictPolicyFail:
+		condition.Reason = "Failed"
+	default:
+		condition.Reason = "Skipped"
+	}
+	log.FromContext(ctx).Info("argocd cluster secret is owned by another tool", "secret", conflict.Secret, "owner", conflict.Owner, "policy", policy)
+	if hc != nil {
+		if err := r.setRegistrationCondition(ctx, hc, condition); err != nil {
+			return err
+		}
+	}
+	return conflict
+}
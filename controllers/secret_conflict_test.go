@@ -0,0 +1,115 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Secret conflicts", func() {
+	var c client.Client
+	var hc *hypershiftv1beta1.HostedCluster
+
+	foreign := func() *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Labels: map[string]string{
+					argoCDSecretTypeLabel:                          argoCDSecretTypeCluster,
+					"cluster.open-cluster-management.io/placement": "all",
+				},
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "owner"}},
+			},
+			Data: map[string][]byte{"server": []byte("https://acm:6443")},
+		}
+	}
+	cluster := func() *Cluster {
+		return &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"}, HostedCluster: hc, GitOpsNamespace: defaultGitOpsNamespace}
+	}
+	condition := func() *metav1.Condition {
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		return meta.FindStatusCondition(registrationConditions(updated), ConditionSecretConflict)
+	}
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, foreign()).Build()
+	})
+
+	It("Should skip a secret owned by another tool by default", func() {
+		r := &HyperOpsReconciler{Client: c}
+		err := r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster())
+		Expect(err).To(HaveOccurred())
+		Expect(ignoreSkippedConflict(err)).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue("server", []byte("https://acm:6443")))
+		Expect(condition().Reason).To(Equal("Skipped"))
+		Expect(condition().Message).To(ContainSubstring("ConfigMap owner"))
+	})
+
+	It("Should fail on a secret owned by another tool with the fail policy", func() {
+		r := &HyperOpsReconciler{Client: c, SecretConflictPolicy: SecretConflictPolicyFail}
+		err := r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster())
+		Expect(ignoreSkippedConflict(err)).To(HaveOccurred())
+		Expect(condition().Reason).To(Equal("Failed"))
+	})
+
+	It("Should adopt a secret owned by another tool when the HostedCluster asks for it", func() {
+		hc.Annotations = map[string]string{hyperOpsSecretConflictPolicyAnnotation: SecretConflictPolicyAdopt}
+		Expect(c.Update(context.Background(), hc)).To(Succeed())
+		r := &HyperOpsReconciler{Client: c, SecretConflictPolicy: SecretConflictPolicyFail}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster())).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted"}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue("server", []byte("https://hosted:6443")))
+		Expect(secret.OwnerReferences).To(BeEmpty())
+		Expect(hyperOpsManaged(secret)).To(BeTrue())
+		Expect(condition().Reason).To(Equal("Adopted"))
+
+		// the adopted secret is managed by hyper-ops from now on
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster())).To(Succeed())
+		Expect(condition().Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("Should describe the owner of a secret", func() {
+		Expect(secretOwner(foreign())).To(Equal("ConfigMap owner"))
+		secret := foreign()
+		secret.OwnerReferences = nil
+		Expect(secretOwner(secret)).To(Equal("open-cluster-management"))
+		secret.Labels[managedByLabel] = "argocd-operator"
+		Expect(secretOwner(secret)).To(Equal("argocd-operator"))
+		Expect(ValidateSecretConflictPolicy("overwrite")).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hyperOpsShardLabel assigns the ArgoCD cluster of the HostedCluster to a shard of the application controller
+const hyperOpsShardLabel = "hyper-ops.cloudmonkey.org/shard"
+
+// ValidateShards returns an error if the number of application controller shards is negative
+func ValidateShards(shards int) error {
+	if shards < 0 {
+		return fmt.Errorf("invalid number of shards %d, must not be negative", shards)
+	}
+	return nil
+}
+
+// argoCDShard returns the application controller shard of the HostedCluster. The shard label wins, otherwise the
+// shard is computed from the namespace and name of the HostedCluster when the number of shards is configured, so it
+// survives the recreation of the ArgoCD cluster secret. Without either the application controller decides.
+func (r *HyperOpsReconciler) argoCDShard(hc *hypershiftv1beta1.HostedCluster) (*int64, error) {
+	if v, ok := hostedClusterLabel(hc, hyperOpsShardLabel); ok {
+		shard, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || shard < 0 {
+			return nil, fmt.Errorf("invalid %s label %q, must be a non-negative number", hyperOpsShardLabel, v)
+		}
+		if r.Shards > 0 && shard >= int64(r.Shards) {
+			return nil, fmt.Errorf("shard %d of the %s label is out of range, there are %d shards", shard, hyperOpsShardLabel, r.Shards)
+		}
+		return &shard, nil
+	}
+	if r.Shards <= 0 {
+		return nil, nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(client.ObjectKeyFromObject(hc).String()))
+	shard := int64(h.Sum32() % uint32(r.Shards))
+	return &shard, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Application controller shards", func() {
+	var (
+		hc *hypershiftv1beta1.HostedCluster
+		r  *HyperOpsReconciler
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}
+		r = &HyperOpsReconciler{}
+	})
+
+	It("Should leave the shard to the application controller by default", func() {
+		shard, err := r.argoCDShard(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shard).To(BeNil())
+	})
+
+	It("Should spread the clusters over the configured shards", func() {
+		r.Shards = 3
+		counts := map[int64]int{}
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+			hc.Name = name
+			shard, err := r.argoCDShard(hc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*shard).To(BeNumerically("<", 3))
+			again, err := r.argoCDShard(hc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again).To(Equal(shard))
+			counts[*shard]++
+		}
+		Expect(counts).To(HaveLen(3))
+	})
+
+	It("Should assign the shard of the label", func() {
+		r.Shards = 3
+		hc.Labels = map[string]string{hyperOpsShardLabel: "2"}
+		shard, err := r.argoCDShard(hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*shard).To(Equal(int64(2)))
+
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted:6443", Shard: shard}, HostedCluster: hc}
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("shard", []byte("2")))
+	})
+
+	It("Should reject invalid and out of range shard labels", func() {
+		hc.Labels = map[string]string{hyperOpsShardLabel: "first"}
+		_, err := r.argoCDShard(hc)
+		Expect(err).To(MatchError(ContainSubstring("must be a non-negative number")))
+
+		r.Shards = 2
+		hc.Labels[hyperOpsShardLabel] = "2"
+		_, err = r.argoCDShard(hc)
+		Expect(err).To(MatchError(ContainSubstring("out of range")))
+		Expect(ValidateShards(-1)).NotTo(Succeed())
+	})
+
+	It("Should expose assigned shards to registration policies", func() {
+		policies, err := CompilePolicies([]hyperopsv1alpha1.RegistrationPolicy{
+			{Name: "sharded", Validate: `has(registration.shard) && registration.shard < 2`, Message: "clusters must be on the first two shards"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted:6443"}, HostedCluster: hc}
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).To(MatchError(ContainSubstring("first two shards")))
+
+		shard := int64(1)
+		cluster.Shard = &shard
+		_, err = evaluatePolicies(policies, hc, map[string]string{}, cluster)
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsDeleteAfterAnnotation is the time after which a secret pending deletion is deleted
+	hyperOpsDeleteAfterAnnotation = "hyper-ops.cloudmonkey.org/delete-after"
+
+	// DefaultPendingDeletionSweepInterval is the interval at which secrets past their deletion grace period are deleted
+	DefaultPendingDeletionSweepInterval = time.Minute
+)
+
+// hyperOpsPendingDeletionLabel marks deregistered ArgoCD cluster secrets during the deletion grace period
+var hyperOpsPendingDeletionLabel = fmt.Sprintf("%s/pending-deletion", hyperOpsLabel)
+
+// markPendingDeletion soft deletes the ArgoCD cluster secret: the secret type label is removed so ArgoCD stops using
+// the cluster, and the secret is deleted by the PendingDeletionSweeper once the grace period passed. A secret that is
+// already pending deletion keeps its deadline.
+func (r *HyperOpsReconciler) markPendingDeletion(ctx context.Context, secret *corev1.Secret) error {
+	if secret.Labels[hyperOpsPendingDeletionLabel] == "true" {
+		return nil
+	}
+	deleteAfter := time.Now().Add(r.DeletionGracePeriod).UTC().Format(time.RFC3339)
+	log.FromContext(ctx).Info("marking argocd cluster secret for deletion", "secret", client.ObjectKeyFromObject(secret), "deleteAfter", deleteAfter)
+	patch := client.MergeFromWithOptions(secret.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	delete(secret.Labels, argoCDSecretTypeLabel)
+	metav1.SetMetaDataLabel(&secret.ObjectMeta, hyperOpsPendingDeletionLabel, "true")
+	metav1.SetMetaDataAnnotation(&secret.ObjectMeta, hyperOpsDeleteAfterAnnotation, deleteAfter)
+	return r.Patch(ctx, secret, patch)
+}
+
+// SweepPendingDeletions deletes the ArgoCD cluster secrets whose deletion grace period passed and returns their keys
+func SweepPendingDeletions(ctx context.Context, c client.Client, now time.Time) ([]string, error) {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{hyperOpsPendingDeletionLabel: "true"}); err != nil {
+		return nil, err
+	}
+	deleted := []string{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !hyperOpsManaged(secret) {
+			continue
+		}
+		deleteAfter, err := time.Parse(time.RFC3339, secret.Annotations[hyperOpsDeleteAfterAnnotation])
+		// a secret without a valid deadline was marked by hand, it is left alone
+		if err != nil || now.Before(deleteAfter) {
+			continue
+		}
+		if err := c.Delete(ctx, secret, client.Preconditions{UID: &secret.UID, ResourceVersion: &secret.ResourceVersion}); client.IgnoreNotFound(err) != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, client.ObjectKeyFromObject(secret).String())
+	}
+	return deleted, nil
+}
+
+// PendingDeletionSweeper periodically deletes the ArgoCD cluster secrets whose deletion grace period passed
+type PendingDeletionSweeper struct {
+	Client   client.Client
+	Interval time.Duration
+}
+
+// Start runs the sweeper until the context is cancelled, it implements manager.Runnable
+func (s *PendingDeletionSweeper) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("pending-deletion")
+	interval := s.Interval
+	if interval == 0 {
+		interval = DefaultPendingDeletionSweepInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		deleted, err := SweepPendingDeletions(ctx, s.Client, time.Now())
+		if err != nil {
+			log.Error(err, "unable to delete argocd cluster secrets pending deletion")
+		}
+		for _, secret := range deleted {
+			log.Info("deleted argocd cluster secret after the deletion grace period", "secret", secret)
+		}
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader deletes secrets
+func (s *PendingDeletionSweeper) NeedLeaderElection() bool {
+	return true
+}
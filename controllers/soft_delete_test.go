@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Deletion grace period", func() {
+	var (
+		c      client.Client
+		r      *HyperOpsReconciler
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Labels: map[string]string{
+					argoCDSecretTypeLabel: argoCDSecretTypeCluster,
+					hyperOpsTypeLabel:     "hosted",
+				},
+			},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+		r = &HyperOpsReconciler{Client: c, DeletionGracePeriod: time.Hour}
+	})
+
+	get := func() (*corev1.Secret, error) {
+		s := &corev1.Secret{}
+		return s, c.Get(context.Background(), client.ObjectKeyFromObject(secret), s)
+	}
+
+	It("Should hide the secret from ArgoCD and delete it after the grace period", func() {
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), secret)).To(Succeed())
+		pending, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending.Labels).NotTo(HaveKey(argoCDSecretTypeLabel))
+		Expect(pending.Labels).To(HaveKeyWithValue(hyperOpsPendingDeletionLabel, "true"))
+		deleteAfter := pending.Annotations[hyperOpsDeleteAfterAnnotation]
+		Expect(deleteAfter).NotTo(BeEmpty())
+
+		By("keeping the deadline when deregistered again")
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), secret)).To(Succeed())
+		pending, err = get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pending.Annotations[hyperOpsDeleteAfterAnnotation]).To(Equal(deleteAfter))
+
+		deleted, err := SweepPendingDeletions(context.Background(), c, time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(BeEmpty())
+
+		deleted, err = SweepPendingDeletions(context.Background(), c, time.Now().Add(2*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{"openshift-gitops/hosted"}))
+		_, err = get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should restore a secret pending deletion when the cluster is registered again", func() {
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), secret)).To(Succeed())
+		cluster := &Cluster{
+			Cluster:         argocd.Cluster{Name: "hosted", Server: "https://hosted:6443"},
+			HostedCluster:   &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}},
+			GitOpsNamespace: defaultGitOpsNamespace,
+		}
+		Expect(r.createArgoCDClusterSecret(context.Background(), map[string]string{hyperOpsTypeLabel: "hosted"}, cluster)).To(Succeed())
+		restored, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.Labels).To(HaveKeyWithValue(argoCDSecretTypeLabel, argoCDSecretTypeCluster))
+		Expect(restored.Labels).NotTo(HaveKey(hyperOpsPendingDeletionLabel))
+		Expect(restored.Annotations).NotTo(HaveKey(hyperOpsDeleteAfterAnnotation))
+	})
+
+	It("Should delete immediately without a grace period", func() {
+		r.DeletionGracePeriod = 0
+		Expect(r.deleteArgoCDClusterSecret(context.Background(), secret)).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,347 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	// hyperOpsGitOpsModeAnnotation selects where the ArgoCD managing the hosted cluster runs, GitOpsModeStandalone
+	// installs one into the hosted cluster instead of registering it with the hub
+	hyperOpsGitOpsModeAnnotation = "hyper-ops.cloudmonkey.org/gitops-mode"
+	// GitOpsModeHub registers the hosted cluster with the ArgoCD of the hub, the default
+	GitOpsModeHub = "hub"
+	// GitOpsModeStandalone installs ArgoCD into the hosted cluster, which only manages the cluster it runs in
+	GitOpsModeStandalone = "standalone"
+
+	// StandaloneInstallerOpenShiftGitOps installs the OpenShift GitOps operator through OLM
+	StandaloneInstallerOpenShiftGitOps = "openshift-gitops"
+	// StandaloneInstallerManifests applies the upstream ArgoCD install manifests
+	StandaloneInstallerManifests = "manifests"
+
+	// DefaultStandaloneChannel is the channel of the OpenShift GitOps operator subscription unless configured
+	// otherwise
+	DefaultStandaloneChannel = "latest"
+	// DefaultStandaloneManifestsURL are the upstream ArgoCD install manifests unless configured otherwise
+	DefaultStandaloneManifestsURL = "https://raw.githubusercontent.com/argoproj/argo-cd/stable/manifests/install.yaml"
+
+	// openShiftGitOpsOperatorNamespace, openShiftGitOpsSubscription and openShiftGitOpsNamespace are the resources
+	// of the OpenShift GitOps operator and of the ArgoCD instance it creates
+	openShiftGitOpsOperatorNamespace = "openshift-gitops-operator"
+	openShiftGitOpsSubscription      = "openshift-gitops-operator"
+	openShiftGitOpsNamespace         = "openshift-gitops"
+	// standaloneArgoCDNamespace is the namespace the upstream manifests are applied to
+	standaloneArgoCDNamespace = "argocd"
+	// standaloneInClusterSecret is the ArgoCD cluster secret of the in-cluster target in the hosted cluster
+	standaloneInClusterSecret = "hyper-ops-in-cluster"
+
+	// standaloneRequeueAfter is the interval at which standalone installations are checked until they are available
+	standaloneRequeueAfter = 30 * time.Second
+
+	// ConditionStandaloneGitOpsReady is true when the ArgoCD installed into a standalone hosted cluster is available
+	ConditionStandaloneGitOpsReady = "StandaloneGitOpsReady"
+)
+
+var (
+	subscriptionGVK  = schema.GroupVersionKind{Group: "operators.coreos.com", Version: "v1alpha1", Kind: "Subscription"}
+	operatorGroupGVK = schema.GroupVersionKind{Group: "operators.coreos.com", Version: "v1", Kind: "OperatorGroup"}
+
+	// standaloneManifests caches the parsed install manifests by URL, they are only fetched once per process
+	standaloneManifests   = map[string][]unstructured.Unstructured{}
+	standaloneManifestsMu sync.Mutex
+)
+
+// StandaloneGitOps configures the installation of ArgoCD into standalone hosted clusters
+type StandaloneGitOps struct {
+	// Installer is StandaloneInstallerOpenShiftGitOps or StandaloneInstallerManifests
+	Installer string
+	// Channel is the channel of the OpenShift GitOps operator subscription
+	Channel string
+	// ManifestsURL are the ArgoCD install manifests applied by StandaloneInstallerManifests
+	ManifestsURL string
+}
+
+// ValidateStandaloneInstaller returns an error if the installer is not openshift-gitops or manifests
+func ValidateStandaloneInstaller(installer string) error {
+	switch installer {
+	case StandaloneInstallerOpenShiftGitOps, StandaloneInstallerManifests:
+		return nil
+	}
+	return fmt.Errorf("invalid standalone installer %q, must be %s or %s", installer, StandaloneInstallerOpenShiftGitOps, StandaloneInstallerManifests)
+}
+
+// standalone returns true when the HostedCluster runs its own ArgoCD
+func standalone(hc *hypershiftv1beta1.HostedCluster) bool {
+	return hc.GetAnnotations()[hyperOpsGitOpsModeAnnotation] == GitOpsModeStandalone
+}
+
+// standaloneServer returns the namespace and the name of the ArgoCD server deployment of the installer
+func standaloneServer(installer string) (string, string) {
+	if installer == StandaloneInstallerManifests {
+		return standaloneArgoCDNamespace, "argocd-server"
+	}
+	return openShiftGitOpsNamespace, "openshift-gitops-server"
+}
+
+// reconcileStandalone installs ArgoCD into a standalone hosted cluster through its admin kubeconfig and registers
+// the in-cluster target there. The hosted cluster is not managed from the hub, an existing hub registration is
+// removed together with the service account of hyper-ops in the hosted cluster.
+func (r *HyperOpsReconciler) reconcileStandalone(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string, labels map[string]string) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	if r.readOnly() {
+		return ctrl.Result{}, nil
+	}
+	kubeConfigSecret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: fmt.Sprintf("%s-admin-kubeconfig", hc.Name)}, kubeConfigSecret); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		// the kubeconfig is created by HyperShift, its creation triggers a new reconcile through the HostedCluster
+		return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionStandaloneGitOpsReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "WaitingForKubeconfig",
+			Message: fmt.Sprintf("waiting for the kubeconfig secret %s-admin-kubeconfig", hc.Name),
+		})
+	}
+	restConfig, _, err := GetRESTConfigForContext(kubeConfigSecret.Data["kubeconfig"], kubeconfigContext(hc),
+		WithUserAgent(HostedClusterUserAgent(hc.Namespace, hc.Name)),
+		WithHeaders(r.HostedClusterHeaders))
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to load hosted cluster kubeconfig: %w", err)
+	}
+	if err := applyInsecureSkipTLSVerify(hc, restConfig); err != nil {
+		return ctrl.Result{}, err
+	}
+	hostedClient, err := r.hostedClient(hc, restConfig)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to create hosted cluster client: %w", err)
+	}
+
+	// a cluster switched to standalone mode leaves the hub
+	registered, err := r.hubRegistrationExists(ctx, hc, gitOpsNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if registered {
+		log.Info("HostedCluster switched to standalone mode, removing the hub registration")
+		if err := r.removeRegistration(ctx, hc, gitOpsNamespace); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unable to remove the hub registration: %w", err)
+		}
+		if err := deleteHostedRBAC(ctx, hostedClient); err != nil {
+			return ctrl.Result{}, fmt.Errorf("unable to remove the service account in the hosted cluster: %w", err)
+		}
+	}
+
+	installer := r.Standalone.Installer
+	if installer == "" {
+		installer = StandaloneInstallerOpenShiftGitOps
+	}
+	switch installer {
+	case StandaloneInstallerManifests:
+		manifests, err := fetchStandaloneManifests(ctx, r.Standalone.ManifestsURL)
+		if err != nil {
+			return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+				Type:    ConditionStandaloneGitOpsReady,
+				Status:  metav1.ConditionFalse,
+				Reason:  "ManifestsUnavailable",
+				Message: err.Error(),
+			})
+		}
+		if err := applyStandaloneManifests(ctx, hostedClient, manifests, correlationID(hc)); err != nil {
+			log.V(3).Error(err, "unable to apply the ArgoCD manifests")
+			return ctrl.Result{}, err
+		}
+	default:
+		if err := ensureOpenShiftGitOps(ctx, hostedClient, r.Standalone.Channel, correlationID(hc)); err != nil {
+			log.V(3).Error(err, "unable to install the OpenShift GitOps operator")
+			return ctrl.Result{}, err
+		}
+	}
+
+	namespace, name := standaloneServer(installer)
+	deployment := &appsv1.Deployment{}
+	if err := hostedClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	if deployment.Status.AvailableReplicas == 0 {
+		return ctrl.Result{RequeueAfter: standaloneRequeueAfter}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionStandaloneGitOpsReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Installing",
+			Message: fmt.Sprintf("waiting for the ArgoCD server %s/%s in the hosted cluster", namespace, name),
+		})
+	}
+	if err := ensureStandaloneInClusterSecret(ctx, hostedClient, namespace, labels, correlationID(hc)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("unable to register the in-cluster target: %w", err)
+	}
+	return ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionStandaloneGitOpsReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ArgoCDAvailable",
+		Message: fmt.Sprintf("ArgoCD in namespace %s of the hosted cluster manages the cluster", namespace),
+	})
+}
+
+// hubRegistrationExists returns true if the ArgoCD cluster secret of the HostedCluster exists in the gitops
+// namespace of the hub
+func (r *HyperOpsReconciler) hubRegistrationExists(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (bool, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return hyperOpsManaged(secret) && secret.Annotations[hyperOpsHostedClusterAnnotation] == client.ObjectKeyFromObject(hc).String(), nil
+}
+
+// leaveStandalone reports that a HostedCluster switched back from the standalone gitops mode is managed from the
+// hub. The ArgoCD installed into the hosted cluster is kept, removing it would take the Applications of the tenant
+// with it.
+func (r *HyperOpsReconciler) leaveStandalone(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) error {
+	condition := meta.FindStatusCondition(registrationConditions(hc), ConditionStandaloneGitOpsReady)
+	if r.readOnly() || condition == nil || condition.Reason == "NotConfigured" {
+		return nil
+	}
+	log.FromContext(ctx).Info("HostedCluster left standalone mode, registering it with the hub")
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionStandaloneGitOpsReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NotConfigured",
+		Message: "the HostedCluster is managed from the hub, the ArgoCD installed into it is kept",
+	})
+}
+
+// ensureOpenShiftGitOps subscribes the hosted cluster to the OpenShift GitOps operator, which creates the default
+// ArgoCD instance in the openshift-gitops namespace
+func ensureOpenShiftGitOps(ctx context.Context, clnt client.Client, channel, correlationID string) error {
+	if channel == "" {
+		channel = DefaultStandaloneChannel
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: openShiftGitOpsOperatorNamespace}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, ns, func() error {
+		stampManaged(ns, correlationID)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to ensure namespace %s: %w", openShiftGitOpsOperatorNamespace, err)
+	}
+	group := &unstructured.Unstructured{}
+	group.SetGroupVersionKind(operatorGroupGVK)
+	group.SetName(openShiftGitOpsOperatorNamespace)
+	group.SetNamespace(openShiftGitOpsOperatorNamespace)
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, group, func() error {
+		stampManaged(group, correlationID)
+		// an empty spec watches all namespaces
+		return unstructured.SetNestedField(group.Object, map[string]interface{}{}, "spec")
+	}); err != nil {
+		return fmt.Errorf("unable to ensure the operator group: %w", err)
+	}
+	subscription := &unstructured.Unstructured{}
+	subscription.SetGroupVersionKind(subscriptionGVK)
+	subscription.SetName(openShiftGitOpsSubscription)
+	subscription.SetNamespace(openShiftGitOpsOperatorNamespace)
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, subscription, func() error {
+		stampManaged(subscription, correlationID)
+		return unstructured.SetNestedField(subscription.Object, map[string]interface{}{
+			"channel":             channel,
+			"name":                openShiftGitOpsSubscription,
+			"source":              "redhat-operators",
+			"sourceNamespace":     "openshift-marketplace",
+			"installPlanApproval": "Automatic",
+		}, "spec")
+	}); err != nil {
+		return fmt.Errorf("unable to ensure the operator subscription: %w", err)
+	}
+	return nil
+}
+
+// fetchStandaloneManifests returns the parsed install manifests of the URL
+func fetchStandaloneManifests(ctx context.Context, url string) ([]unstructured.Unstructured, error) {
+	if url == "" {
+		url = DefaultStandaloneManifestsURL
+	}
+	standaloneManifestsMu.Lock()
+	defer standaloneManifestsMu.Unlock()
+	if manifests, ok := standaloneManifests[url]; ok {
+		return manifests, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch the ArgoCD manifests: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to fetch the ArgoCD manifests from %s: %s", url, resp.Status)
+	}
+	manifests, err := decodeManifests(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the ArgoCD manifests from %s: %w", url, err)
+	}
+	standaloneManifests[url] = manifests
+	return manifests, nil
+}
+
+// applyStandaloneManifests applies the install manifests to the argocd namespace of the hosted cluster, like
+// kubectl apply -n argocd
+func applyStandaloneManifests(ctx context.Context, clnt client.Client, manifests []unstructured.Unstructured, correlationID string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: standaloneArgoCDNamespace}}
+	if _, err := CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, ns, func() error {
+		stampManaged(ns, correlationID)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to ensure namespace %s: %w", standaloneArgoCDNamespace, err)
+	}
+	return applyManifests(ctx, clnt, manifests, standaloneArgoCDNamespace, correlationID)
+}
+
+// ensureStandaloneInClusterSecret registers the in-cluster target with the ArgoCD in the hosted cluster, labeled
+// like the registration on the hub would be so ApplicationSets select it the same way
+func ensureStandaloneInClusterSecret(ctx context.Context, clnt client.Client, namespace string, labels map[string]string, correlationID string) error {
+	data, err := (&argocd.Cluster{Name: "in-cluster", Server: argocd.InClusterServer}).SecretData()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: standaloneInClusterSecret, Namespace: namespace}}
+	_, err = CreateOrUpdateWithPolicy(ctx, hostedClusterRetryPolicy(), clnt, secret, func() error {
+		secret.Labels = mergeLabels(labels, map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster})
+		stampManaged(secret, correlationID)
+		secret.Data = data
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	})
+	return err
+}
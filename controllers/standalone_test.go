@@ -0,0 +1,167 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Standalone gitops mode", func() {
+	var hc *hypershiftv1beta1.HostedCluster
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   "clusters",
+				Annotations: map[string]string{hyperOpsGitOpsModeAnnotation: GitOpsModeStandalone},
+			},
+		}
+	})
+
+	It("Should validate the installer", func() {
+		Expect(ValidateStandaloneInstaller(StandaloneInstallerOpenShiftGitOps)).To(Succeed())
+		Expect(ValidateStandaloneInstaller(StandaloneInstallerManifests)).To(Succeed())
+		Expect(ValidateStandaloneInstaller("helm")).NotTo(Succeed())
+	})
+
+	It("Should wait for the admin kubeconfig and report the cluster as standalone", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c}
+		_, err := r.reconcileStandalone(context.Background(), hc, defaultGitOpsNamespace, hostedClusterLabels(hc))
+		Expect(err).NotTo(HaveOccurred())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionStandaloneGitOpsReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("WaitingForKubeconfig"))
+
+		state, reason := clusterState(hc, &FleetReportCluster{Enabled: true, Conditions: registrationConditions(hc)})
+		Expect(state).To(Equal(ClusterStateStandalone))
+		Expect(reason).To(ContainSubstring("hosted-admin-kubeconfig"))
+	})
+
+	It("Should subscribe the hosted cluster to the OpenShift GitOps operator", func() {
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(ensureOpenShiftGitOps(context.Background(), hosted, "", "uid")).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: openShiftGitOpsOperatorNamespace}, &corev1.Namespace{})).To(Succeed())
+		subscription := &unstructured.Unstructured{}
+		subscription.SetGroupVersionKind(subscriptionGVK)
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: openShiftGitOpsOperatorNamespace, Name: openShiftGitOpsSubscription}, subscription)).To(Succeed())
+		channel, _, _ := unstructured.NestedString(subscription.Object, "spec", "channel")
+		Expect(channel).To(Equal(DefaultStandaloneChannel))
+		Expect(subscription.GetLabels()).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		group := &unstructured.Unstructured{}
+		group.SetGroupVersionKind(operatorGroupGVK)
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: openShiftGitOpsOperatorNamespace, Name: openShiftGitOpsOperatorNamespace}, group)).To(Succeed())
+	})
+
+	It("Should apply the upstream manifests to the argocd namespace", func() {
+		served := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			served++
+			_, _ = w.Write([]byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: argocd-server
+  labels:
+    app.kubernetes.io/name: argocd-server
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: argocd-server
+rules:
+- apiGroups: ["*"]
+  resources: ["*"]
+  verbs: ["get"]
+`))
+		}))
+		defer srv.Close()
+		manifests, err := fetchStandaloneManifests(context.Background(), srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifests).To(HaveLen(2))
+		_, err = fetchStandaloneManifests(context.Background(), srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(served).To(Equal(1))
+
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("ServiceAccount"), meta.RESTScopeNamespace)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+		mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRESTMapper(mapper).Build()
+		Expect(applyStandaloneManifests(context.Background(), hosted, manifests, "uid")).To(Succeed())
+		sa := &corev1.ServiceAccount{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: standaloneArgoCDNamespace, Name: "argocd-server"}, sa)).To(Succeed())
+		Expect(sa.Labels).To(HaveKeyWithValue("app.kubernetes.io/name", "argocd-server"))
+		Expect(sa.Labels).To(HaveKeyWithValue(managedByLabel, managedByValue))
+		role := &rbacv1.ClusterRole{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "argocd-server"}, role)).To(Succeed())
+		Expect(role.Rules).To(HaveLen(1))
+
+		By("reverting changes to the applied objects")
+		role.Rules = nil
+		Expect(hosted.Update(context.Background(), role)).To(Succeed())
+		Expect(applyStandaloneManifests(context.Background(), hosted, manifests, "uid")).To(Succeed())
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Name: "argocd-server"}, role)).To(Succeed())
+		Expect(role.Rules).To(HaveLen(1))
+	})
+
+	It("Should register the in-cluster target with the labels of the HostedCluster", func() {
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		Expect(ensureStandaloneInClusterSecret(context.Background(), hosted, openShiftGitOpsNamespace, map[string]string{"hyper-ops.cloudmonkey.org/env": "prod"}, "uid")).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(hosted.Get(context.Background(), client.ObjectKey{Namespace: openShiftGitOpsNamespace, Name: standaloneInClusterSecret}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKeyWithValue(argoCDSecretTypeLabel, argoCDSecretTypeCluster))
+		Expect(secret.Labels).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/env", "prod"))
+		cluster, err := argocd.ClusterFromSecretData(secret.Data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Server).To(Equal(argocd.InClusterServer))
+		Expect(cluster.Config.BearerToken).To(BeEmpty())
+	})
+
+	It("Should report a cluster that left standalone mode", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		r := &HyperOpsReconciler{Client: c}
+		Expect(r.leaveStandalone(context.Background(), hc)).To(Succeed())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionStandaloneGitOpsReady)).To(BeNil())
+
+		Expect(r.setRegistrationCondition(context.Background(), hc, metav1.Condition{
+			Type:   ConditionStandaloneGitOpsReady,
+			Status: metav1.ConditionTrue,
+			Reason: "ArgoCDAvailable",
+		})).To(Succeed())
+		delete(hc.Annotations, hyperOpsGitOpsModeAnnotation)
+		Expect(r.leaveStandalone(context.Background(), hc)).To(Succeed())
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionStandaloneGitOpsReady).Reason).To(Equal("NotConfigured"))
+	})
+})
@@ -0,0 +1,231 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const (
+	startupReportConfigMapName = "hyper-ops-startup-report"
+	startupReportDataKey       = "report.json"
+
+	// DiscrepancyOrphanedSecret is an ArgoCD cluster secret whose HostedCluster no longer exists
+	DiscrepancyOrphanedSecret = "OrphanedSecret"
+	// DiscrepancyMissingSecret is an enrolled HostedCluster without an ArgoCD cluster secret
+	DiscrepancyMissingSecret = "MissingSecret"
+	// DiscrepancyStaleServer is an ArgoCD cluster secret whose server differs from the admin kubeconfig
+	DiscrepancyStaleServer = "StaleServer"
+	// DiscrepancyStaleCA is an ArgoCD cluster secret that does not trust the CA of the admin kubeconfig
+	DiscrepancyStaleCA = "StaleCA"
+)
+
+// StartupReport is the snapshot of the discrepancies between the ArgoCD cluster secrets and the HostedClusters taken
+// when hyper-ops starts, before the first registration is reconciled
+type StartupReport struct {
+	GeneratedAt    metav1.Time          `json:"generatedAt"`
+	HostedClusters int                  `json:"hostedClusters"`
+	Registrations  int                  `json:"registrations"`
+	Discrepancies  []StartupDiscrepancy `json:"discrepancies"`
+}
+
+// StartupDiscrepancy is a single discrepancy of a StartupReport
+type StartupDiscrepancy struct {
+	Type          string `json:"type"`
+	HostedCluster string `json:"hostedCluster,omitempty"`
+	Secret        string `json:"secret,omitempty"`
+	Message       string `json:"message"`
+}
+
+// GenerateStartupReport compares the ArgoCD cluster secrets written by hyper-ops with the HostedClusters: secrets of
+// HostedClusters that no longer exist, enrolled HostedClusters without a secret and secrets whose server or CA differ
+// from the admin kubeconfig of their HostedCluster. Nothing is repaired, the reconciler takes over afterwards.
+func GenerateStartupReport(ctx context.Context, c client.Reader, defaultEnrollment string) (*StartupReport, error) {
+	hcs := &hypershiftv1beta1.HostedClusterList{}
+	if err := c.List(ctx, hcs); err != nil {
+		return nil, err
+	}
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"}); err != nil {
+		return nil, err
+	}
+	report := &StartupReport{GeneratedAt: metav1.Now(), HostedClusters: len(hcs.Items), Discrepancies: []StartupDiscrepancy{}}
+	hostedClusters := map[string]*hypershiftv1beta1.HostedCluster{}
+	for i := range hcs.Items {
+		hostedClusters[client.ObjectKeyFromObject(&hcs.Items[i]).String()] = &hcs.Items[i]
+	}
+
+	registered := map[string]bool{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		ref, ok := secret.Annotations[hyperOpsHostedClusterAnnotation]
+		if !ok {
+			continue
+		}
+		registered[ref] = true
+		if _, copied := secret.Annotations[hyperOpsCopyOfAnnotation]; !copied {
+			report.Registrations++
+		}
+		hc, ok := hostedClusters[ref]
+		if !ok {
+			report.Discrepancies = append(report.Discrepancies, StartupDiscrepancy{Type: DiscrepancyOrphanedSecret, HostedCluster: ref,
+				Secret: client.ObjectKeyFromObject(secret).String(), Message: "the HostedCluster of the registration no longer exists"})
+			continue
+		}
+		stale, err := staleRegistration(ctx, c, hc, secret)
+		if err != nil {
+			return nil, err
+		}
+		report.Discrepancies = append(report.Discrepancies, stale...)
+	}
+
+	for _, hc := range hcs.Items {
+		ref := client.ObjectKeyFromObject(&hc).String()
+		if registered[ref] || !hostedClusterEnrolled(&hc, defaultEnrollment) || hc.DeletionTimestamp != nil ||
+			hc.GetAnnotations()[hyperOpsUnmanageAnnotation] == "true" {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, StartupDiscrepancy{Type: DiscrepancyMissingSecret, HostedCluster: ref,
+			Message: "the HostedCluster is enrolled but has no ArgoCD cluster secret"})
+	}
+
+	sort.SliceStable(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if a.HostedCluster != b.HostedCluster {
+			return a.HostedCluster < b.HostedCluster
+		}
+		return a.Secret < b.Secret
+	})
+	return report, nil
+}
+
+// staleRegistration compares the server and the CA of the ArgoCD cluster secret with the admin kubeconfig of the
+// HostedCluster. HostedClusters without an admin kubeconfig are not compared.
+func staleRegistration(ctx context.Context, c client.Reader, hc *hypershiftv1beta1.HostedCluster, secret *corev1.Secret) ([]StartupDiscrepancy, error) {
+	kubeconfig := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: hc.Namespace, Name: fmt.Sprintf("%s-admin-kubeconfig", hc.Name)}, kubeconfig); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	restConfig, server, err := GetRESTConfigForContext(kubeconfig.Data["kubeconfig"], kubeconfigContext(hc))
+	if err != nil {
+		// the reconciler reports unusable kubeconfigs on the HostedCluster
+		return nil, nil
+	}
+	discrepancy := StartupDiscrepancy{HostedCluster: client.ObjectKeyFromObject(hc).String(), Secret: client.ObjectKeyFromObject(secret).String()}
+	discrepancies := []StartupDiscrepancy{}
+	if registeredServer := string(secret.Data["server"]); registeredServer != server {
+		discrepancy.Type = DiscrepancyStaleServer
+		discrepancy.Message = fmt.Sprintf("the registration points at %s, the admin kubeconfig at %s", registeredServer, server)
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	cluster, err := argocd.ClusterFromSecretData(secret.Data)
+	if err != nil || cluster.Config.TLSClientConfig.Insecure || restConfig.Insecure {
+		return discrepancies, nil
+	}
+	if !trustsCABundle(cluster.Config.TLSClientConfig.CAData, restConfig.CAData) {
+		discrepancy.Type = DiscrepancyStaleCA
+		discrepancy.Message = "the registration does not trust the CA of the admin kubeconfig"
+		discrepancies = append(discrepancies, discrepancy)
+	}
+	return discrepancies, nil
+}
+
+// trustsCABundle returns true if every certificate of the CA bundle is part of the trusted bundle. The trusted bundle
+// may hold additional CAs, see mergeCABundles.
+func trustsCABundle(trusted, bundle []byte) bool {
+	certificates := map[string]bool{}
+	for {
+		var block *pem.Block
+		if block, trusted = pem.Decode(trusted); block == nil {
+			break
+		}
+		certificates[string(block.Bytes)] = true
+	}
+	for {
+		var block *pem.Block
+		if block, bundle = pem.Decode(bundle); block == nil {
+			return true
+		}
+		if block.Type == "CERTIFICATE" && !certificates[string(block.Bytes)] {
+			return false
+		}
+	}
+}
+
+// LogStartupReport logs the discrepancies of the report
+func LogStartupReport(report *StartupReport, log logr.Logger) {
+	log.Info("startup reconciliation report", "hostedClusters", report.HostedClusters, "registrations", report.Registrations,
+		"discrepancies", len(report.Discrepancies))
+	for _, d := range report.Discrepancies {
+		log.Info("registration discrepancy", "type", d.Type, "hostedCluster", d.HostedCluster, "secret", d.Secret, "message", d.Message)
+	}
+}
+
+// StartupReporter writes the startup report into a ConfigMap once. The report is generated before the manager starts,
+// the reporter only publishes it once the manager is elected leader.
+type StartupReporter struct {
+	Client    client.Client
+	Namespace string
+	Report    *StartupReport
+}
+
+// Start writes the report, it implements manager.Runnable
+func (s *StartupReporter) Start(ctx context.Context) error {
+	if err := s.writeReport(ctx); err != nil {
+		log.FromContext(ctx).WithName("startup-report").Error(err, "unable to write startup report")
+	}
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader writes the report
+func (s *StartupReporter) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *StartupReporter) writeReport(ctx context.Context) error {
+	data, err := json.MarshalIndent(s.Report, "", "  ")
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      startupReportConfigMapName,
+			Namespace: s.Namespace,
+		},
+	}
+	_, err = CreateOrUpdateWithRetries(ctx, s.Client, cm, func() error {
+		stampManaged(cm, "")
+		cm.Data = map[string]string{
+			startupReportDataKey: string(data),
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Startup report", func() {
+	ca := func(content string) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte(content)})
+	}
+	hostedCluster := func(name string, hcLabels map[string]string) *hypershiftv1beta1.HostedCluster {
+		return &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters", Labels: hcLabels}}
+	}
+	adminKubeconfig := func(name, server string, caData []byte) *corev1.Secret {
+		config := clientcmdapi.NewConfig()
+		config.Clusters["hosted"] = &clientcmdapi.Cluster{Server: server, CertificateAuthorityData: caData}
+		config.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: "admin"}
+		config.Contexts["admin"] = &clientcmdapi.Context{Cluster: "hosted", AuthInfo: "admin"}
+		config.CurrentContext = "admin"
+		data, err := clientcmd.Write(*config)
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-admin-kubeconfig", Namespace: "clusters"},
+			Data:       map[string][]byte{"kubeconfig": data},
+		}
+	}
+	clusterSecret := func(name, server string, caData []byte) *corev1.Secret {
+		data, err := (&argocd.Cluster{Name: name, Server: server, Config: argocd.ClusterConfig{
+			BearerToken: "token", TLSClientConfig: argocd.TLSClientConfig{CAData: caData},
+		}}).SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   defaultGitOpsNamespace,
+				Labels:      map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+				Annotations: map[string]string{hyperOpsHostedClusterAnnotation: "clusters/" + name},
+			},
+			Data: data,
+		}
+	}
+	enabled := map[string]string{hyperOpsEnabledLabel: "true"}
+
+	It("Should report orphaned, missing and stale registrations", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			// consistent, the registration also trusts an additional CA bundle
+			hostedCluster("healthy", enabled),
+			adminKubeconfig("healthy", "https://healthy:6443", ca("healthy")),
+			clusterSecret("healthy", "https://healthy:6443", append(ca("healthy"), ca("extra")...)),
+			// the HostedCluster is gone
+			clusterSecret("orphaned", "https://orphaned:6443", ca("orphaned")),
+			// enrolled but not registered
+			hostedCluster("missing", enabled),
+			// not enrolled, nothing is expected
+			hostedCluster("ignored", nil),
+			// the API server moved and its CA was rotated
+			hostedCluster("moved", enabled),
+			adminKubeconfig("moved", "https://moved-new:6443", ca("rotated")),
+			clusterSecret("moved", "https://moved:6443", ca("moved")),
+		).Build()
+
+		report, err := GenerateStartupReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.HostedClusters).To(Equal(4))
+		Expect(report.Registrations).To(Equal(3))
+		types := []string{}
+		for _, d := range report.Discrepancies {
+			types = append(types, d.HostedCluster+" "+d.Type)
+		}
+		Expect(types).To(Equal([]string{
+			"clusters/missing " + DiscrepancyMissingSecret,
+			"clusters/moved " + DiscrepancyStaleServer,
+			"clusters/moved " + DiscrepancyStaleCA,
+			"clusters/orphaned " + DiscrepancyOrphanedSecret,
+		}))
+	})
+
+	It("Should write the report into a ConfigMap", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hostedCluster("missing", enabled)).Build()
+		report, err := GenerateStartupReport(context.Background(), c, DefaultEnrollmentDisabled)
+		Expect(err).NotTo(HaveOccurred())
+		reporter := &StartupReporter{Client: c, Namespace: "hyper-ops", Report: report}
+		Expect(reporter.Start(context.Background())).To(Succeed())
+
+		cm := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "hyper-ops", Name: startupReportConfigMapName}, cm)).To(Succeed())
+		written := &StartupReport{}
+		Expect(json.Unmarshal([]byte(cm.Data[startupReportDataKey]), written)).To(Succeed())
+		Expect(written.Discrepancies).To(HaveLen(1))
+		Expect(written.Discrepancies[0].Type).To(Equal(DiscrepancyMissingSecret))
+	})
+})
@@ -0,0 +1,178 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// hyperOpsTenantGroupsAnnotation lists the comma separated groups owning the hosted cluster in ArgoCD
+	hyperOpsTenantGroupsAnnotation = "hyper-ops.cloudmonkey.org/tenant-groups"
+	// hyperOpsTenantProjectAnnotation names the AppProject of the Applications destined for the hosted cluster,
+	// defaults to the name of the HostedCluster
+	hyperOpsTenantProjectAnnotation = "hyper-ops.cloudmonkey.org/tenant-project"
+
+	// argoCDRBACConfigMapName is the RBAC ConfigMap of an ArgoCD instance
+	argoCDRBACConfigMapName = "argocd-rbac-cm"
+
+	// ConditionTenantRBACReady is true when the ArgoCD RBAC policy of the tenant groups is in place
+	ConditionTenantRBACReady = "TenantRBACReady"
+)
+
+// tenantRBACPolicyKey returns the argocd-rbac-cm key holding the policy of the HostedCluster. ArgoCD merges every
+// policy.*.csv key into its policy, so the keys of hyper-ops never conflict with the policy.csv managed by users.
+func tenantRBACPolicyKey(hc *hypershiftv1beta1.HostedCluster) string {
+	return fmt.Sprintf("policy.hyper-ops.%s.%s.csv", hc.Namespace, hc.Name)
+}
+
+// tenantGroups returns the tenant groups of the HostedCluster
+func tenantGroups(hc *hypershiftv1beta1.HostedCluster) []string {
+	groups := []string{}
+	for _, g := range strings.Split(hc.GetAnnotations()[hyperOpsTenantGroupsAnnotation], ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// tenantProject returns the AppProject of the Applications destined for the hosted cluster
+func tenantProject(hc *hypershiftv1beta1.HostedCluster) string {
+	if project := hc.GetAnnotations()[hyperOpsTenantProjectAnnotation]; project != "" {
+		return project
+	}
+	return hc.Name
+}
+
+// tenantRBACPolicy returns the ArgoCD RBAC policy granting the tenant groups access to the Applications of the
+// tenant project and read access to the cluster
+func tenantRBACPolicy(hc *hypershiftv1beta1.HostedCluster, server string, groups []string) string {
+	project := tenantProject(hc)
+	// Applications in any namespace are addressed as <project>/<namespace>/<name>
+	if namespace := hc.GetAnnotations()[hyperOpsTenantApplicationNamespaceAnnotation]; namespace != "" {
+		project = fmt.Sprintf("%s/%s", project, namespace)
+	}
+	role := fmt.Sprintf("role:hyper-ops-%s-%s", hc.Namespace, hc.Name)
+	lines := []string{
+		fmt.Sprintf("p, %s, applications, *, %s/*, allow", role, project),
+		fmt.Sprintf("p, %s, clusters, get, %s, allow", role, server),
+	}
+	for _, g := range groups {
+		lines = append(lines, fmt.Sprintf("g, %s, %s", g, role))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// reconcileTenantRBAC maintains the policy of the tenant groups of the HostedCluster in the RBAC ConfigMap of the
+// ArgoCD instance in the gitops namespace. The policy is removed when the HostedCluster has no tenant groups.
+func (r *HyperOpsReconciler) reconcileTenantRBAC(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace, server string, capabilities ArgoCDCapabilities) error {
+	if !r.TenantRBAC || r.readOnly() {
+		return nil
+	}
+	log := log.FromContext(ctx)
+	if r.remoteRegistrations() != nil {
+		log.V(3).Info("tenant rbac is not supported for a remote ArgoCD")
+		return nil
+	}
+	groups := tenantGroups(hc)
+	if len(groups) > 0 && hc.GetAnnotations()[hyperOpsTenantApplicationNamespaceAnnotation] != "" && !capabilities.ApplicationsInAnyNamespace {
+		return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionTenantRBACReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "UnsupportedFeature",
+			Message: fmt.Sprintf("the ArgoCD instance in %s does not support applications in any namespace", gitOpsNamespace),
+		})
+	}
+	policy := ""
+	if len(groups) > 0 {
+		policy = tenantRBACPolicy(hc, server, groups)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: argoCDRBACConfigMapName}, cm); err != nil {
+		if client.IgnoreNotFound(err) != nil || len(groups) == 0 {
+			return client.IgnoreNotFound(err)
+		}
+		// the ConfigMap belongs to the ArgoCD instance, it is not created by hyper-ops
+		return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionTenantRBACReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RBACConfigMapNotFound",
+			Message: fmt.Sprintf("%s does not exist in gitops namespace %s", argoCDRBACConfigMapName, gitOpsNamespace),
+		})
+	}
+	if err := r.setTenantRBACPolicy(ctx, cm, tenantRBACPolicyKey(hc), policy); err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		if meta.FindStatusCondition(registrationConditions(hc), ConditionTenantRBACReady) == nil {
+			return nil
+		}
+		return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionTenantRBACReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotConfigured",
+			Message: "the HostedCluster has no tenant groups",
+		})
+	}
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionTenantRBACReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "PolicyApplied",
+		Message: fmt.Sprintf("groups %s have access to the cluster in %s", strings.Join(groups, ", "), gitOpsNamespace),
+	})
+}
+
+// removeTenantRBAC removes the policy of the HostedCluster from the RBAC ConfigMap
+func (r *HyperOpsReconciler) removeTenantRBAC(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) error {
+	if !r.TenantRBAC || r.readOnly() || r.remoteRegistrations() != nil {
+		return nil
+	}
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: argoCDRBACConfigMapName}, cm); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return r.setTenantRBACPolicy(ctx, cm, tenantRBACPolicyKey(hc), "")
+}
+
+// setTenantRBACPolicy patches the policy key of the RBAC ConfigMap, an empty policy removes the key. Only the key is
+// patched, the rest of the ConfigMap is left to its owner.
+func (r *HyperOpsReconciler) setTenantRBACPolicy(ctx context.Context, cm *corev1.ConfigMap, key, policy string) error {
+	current, ok := cm.Data[key]
+	if (policy == "" && !ok) || (policy != "" && current == policy) {
+		return nil
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	if policy == "" {
+		delete(cm.Data, key)
+	} else {
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[key] = policy
+	}
+	return r.Patch(ctx, cm, patch)
+}
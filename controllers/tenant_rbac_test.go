@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Tenant RBAC", func() {
+	const server = "https://api.hosted.example.com:6443"
+
+	var (
+		c  client.Client
+		r  *HyperOpsReconciler
+		hc *hypershiftv1beta1.HostedCluster
+		cm *corev1.ConfigMap
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "clusters",
+				Annotations: map[string]string{
+					hyperOpsTenantGroupsAnnotation:  "team-a, team-b",
+					hyperOpsTenantProjectAnnotation: "tenant-a",
+				},
+			},
+		}
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: argoCDRBACConfigMapName, Namespace: defaultGitOpsNamespace},
+			Data:       map[string]string{"policy.csv": "g, admins, role:admin\n"},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, cm).Build()
+		r = &HyperOpsReconciler{Client: c, TenantRBAC: true}
+	})
+
+	policy := func() map[string]string {
+		updated := &corev1.ConfigMap{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(cm), updated)).To(Succeed())
+		return updated.Data
+	}
+
+	It("Should maintain the policy of the tenant groups", func() {
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, ArgoCDCapabilities{})).To(Succeed())
+		data := policy()
+		Expect(data).To(HaveKeyWithValue("policy.csv", "g, admins, role:admin\n"))
+		Expect(data).To(HaveKeyWithValue("policy.hyper-ops.clusters.hosted.csv",
+			"p, role:hyper-ops-clusters-hosted, applications, *, tenant-a/*, allow\n"+
+				"p, role:hyper-ops-clusters-hosted, clusters, get, "+server+", allow\n"+
+				"g, team-a, role:hyper-ops-clusters-hosted\n"+
+				"g, team-b, role:hyper-ops-clusters-hosted\n"))
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionTenantRBACReady)).To(BeTrue())
+
+		By("removing the policy when the tenant groups are removed")
+		delete(hc.Annotations, hyperOpsTenantGroupsAnnotation)
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, ArgoCDCapabilities{})).To(Succeed())
+		Expect(policy()).NotTo(HaveKey("policy.hyper-ops.clusters.hosted.csv"))
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionTenantRBACReady).Reason).To(Equal("NotConfigured"))
+	})
+
+	It("Should scope the policy to the application namespace when ArgoCD supports it", func() {
+		hc.Annotations[hyperOpsTenantApplicationNamespaceAnnotation] = "team-a-apps"
+		Expect(c.Update(context.Background(), hc)).To(Succeed())
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, ArgoCDCapabilities{})).To(Succeed())
+		Expect(policy()).NotTo(HaveKey("policy.hyper-ops.clusters.hosted.csv"))
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionTenantRBACReady).Reason).To(Equal("UnsupportedFeature"))
+
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, capabilitiesForVersion("2.5.0"))).To(Succeed())
+		Expect(policy()["policy.hyper-ops.clusters.hosted.csv"]).To(HavePrefix(
+			"p, role:hyper-ops-clusters-hosted, applications, *, tenant-a/team-a-apps/*, allow\n"))
+	})
+
+	It("Should remove the policy when the HostedCluster is deleted", func() {
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, ArgoCDCapabilities{})).To(Succeed())
+		Expect(r.removeTenantRBAC(context.Background(), hc, defaultGitOpsNamespace)).To(Succeed())
+		Expect(policy()).To(Equal(map[string]string{"policy.csv": "g, admins, role:admin\n"}))
+	})
+
+	It("Should not create the RBAC ConfigMap", func() {
+		Expect(c.Delete(context.Background(), cm)).To(Succeed())
+		Expect(r.reconcileTenantRBAC(context.Background(), hc, defaultGitOpsNamespace, server, ArgoCDCapabilities{})).To(Succeed())
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionTenantRBACReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Reason).To(Equal("RBACConfigMapNotFound"))
+	})
+})
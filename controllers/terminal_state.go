@@ -0,0 +1,142 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// TerminalStatePolicyRetry keeps reconciling HostedClusters in a terminal state (default)
+	TerminalStatePolicyRetry = "retry"
+	// TerminalStatePolicySkip stops reconciling HostedClusters in a terminal state, existing registrations are kept
+	TerminalStatePolicySkip = "skip"
+	// TerminalStatePolicyDeregister skips HostedClusters in a terminal state and removes their registration once they
+	// have been in the terminal state for longer than the terminal state timeout
+	TerminalStatePolicyDeregister = "deregister"
+
+	// DefaultTerminalStateTimeout is the time a HostedCluster may be in a terminal state before it is deregistered
+	DefaultTerminalStateTimeout = 24 * time.Hour
+
+	// ConditionTerminalState is true when the HostedCluster is in a failure state it will not recover from without a
+	// spec change
+	ConditionTerminalState = "TerminalState"
+)
+
+// terminalHostedClusterConditions are the HostedCluster conditions that, when false, leave the HostedCluster in a
+// state it will not recover from without a spec change
+var terminalHostedClusterConditions = []hypershiftv1beta1.ConditionType{
+	hypershiftv1beta1.ValidHostedClusterConfiguration,
+	hypershiftv1beta1.SupportedHostedCluster,
+	hypershiftv1beta1.ValidReleaseImage,
+}
+
+// ValidateTerminalStatePolicy returns an error if the policy is not one of the terminal state policies
+func ValidateTerminalStatePolicy(policy string) error {
+	switch policy {
+	case TerminalStatePolicyRetry, TerminalStatePolicySkip, TerminalStatePolicyDeregister:
+		return nil
+	}
+	return fmt.Errorf("invalid terminal state policy %q, must be %s, %s or %s", policy,
+		TerminalStatePolicyRetry, TerminalStatePolicySkip, TerminalStatePolicyDeregister)
+}
+
+// terminalCondition returns the first false terminal condition of the HostedCluster, nil if it is not in a terminal
+// state
+func terminalCondition(hc *hypershiftv1beta1.HostedCluster) *metav1.Condition {
+	for _, conditionType := range terminalHostedClusterConditions {
+		if condition := meta.FindStatusCondition(hc.Status.Conditions, string(conditionType)); condition != nil &&
+			condition.Status == metav1.ConditionFalse {
+			return condition
+		}
+	}
+	return nil
+}
+
+// handleTerminalState applies the terminal state policy to the HostedCluster. It returns true if the reconcile should
+// stop with the returned result.
+func (r *HyperOpsReconciler) handleTerminalState(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (bool, ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	condition := terminalCondition(hc)
+	if condition == nil {
+		return false, ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionTerminalState,
+			Status:  metav1.ConditionFalse,
+			Reason:  "NotTerminal",
+			Message: "HostedCluster is not in a terminal state",
+		})
+	}
+	message := fmt.Sprintf("HostedCluster condition %s is false since %s: %s", condition.Type,
+		condition.LastTransitionTime.UTC().Format(time.RFC3339), condition.Message)
+	skipped := metav1.Condition{
+		Type:    ConditionTerminalState,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Skipped",
+		Message: message,
+	}
+	switch r.TerminalStatePolicy {
+	case TerminalStatePolicySkip:
+		log.Info("HostedCluster is in a terminal state, skipping", "condition", condition.Type, "reason", condition.Reason)
+		if conditionChanged(hc, skipped) {
+			r.recordEvent(hc, corev1.EventTypeWarning, EventRegistrationSkipped, message)
+		}
+		return true, ctrl.Result{}, r.setRegistrationCondition(ctx, hc, skipped)
+	case TerminalStatePolicyDeregister:
+		timeout := r.TerminalStateTimeout
+		if timeout == 0 {
+			timeout = DefaultTerminalStateTimeout
+		}
+		remaining := time.Until(condition.LastTransitionTime.Add(timeout))
+		if remaining > 0 {
+			log.Info("HostedCluster is in a terminal state, skipping until it is deregistered", "condition", condition.Type, "deregisterIn", remaining)
+			if conditionChanged(hc, skipped) {
+				r.recordEvent(hc, corev1.EventTypeWarning, EventRegistrationSkipped, message)
+			}
+			return true, ctrl.Result{RequeueAfter: remaining}, r.setRegistrationCondition(ctx, hc, skipped)
+		}
+		log.Info("HostedCluster exceeded the terminal state timeout, deregistering", "condition", condition.Type, "timeout", timeout)
+		if err := r.deregisterArgoCDClusterSecrets(ctx, hc, gitOpsNamespace); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		deregistered := metav1.Condition{
+			Type:    ConditionTerminalState,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Deregistered",
+			Message: message,
+		}
+		if conditionChanged(hc, deregistered) {
+			r.recordEvent(hc, corev1.EventTypeNormal, EventDeregistered, fmt.Sprintf("deregistered after the terminal state timeout: %s", message))
+		}
+		return true, ctrl.Result{}, r.setRegistrationCondition(ctx, hc, deregistered)
+	default:
+		return false, ctrl.Result{}, r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionTerminalState,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Retrying",
+			Message: message,
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Terminal state policy", func() {
+	var (
+		hc     *hypershiftv1beta1.HostedCluster
+		secret *corev1.Secret
+		c      client.Client
+	)
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+			Status: hypershiftv1beta1.HostedClusterStatus{
+				Conditions: []metav1.Condition{{
+					Type:               string(hypershiftv1beta1.ValidHostedClusterConfiguration),
+					Status:             metav1.ConditionFalse,
+					Reason:             "InvalidConfiguration",
+					Message:            "invalid networking",
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+				}},
+			},
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: defaultGitOpsNamespace,
+				Labels:    map[string]string{hyperOpsTypeLabel: "hosted"},
+			},
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build()
+	})
+
+	condition := func() *metav1.Condition {
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		return meta.FindStatusCondition(registrationConditions(updated), ConditionTerminalState)
+	}
+
+	It("Should keep reconciling with the retry policy", func() {
+		r := &HyperOpsReconciler{Client: c, TerminalStatePolicy: TerminalStatePolicyRetry}
+		stop, _, err := r.handleTerminalState(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(condition().Reason).To(Equal("Retrying"))
+	})
+
+	It("Should skip with the skip policy and keep the registration", func() {
+		r := &HyperOpsReconciler{Client: c, TerminalStatePolicy: TerminalStatePolicySkip}
+		stop, _, err := r.handleTerminalState(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(condition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition().Reason).To(Equal("Skipped"))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})).To(Succeed())
+	})
+
+	It("Should deregister once the terminal state timeout passed", func() {
+		r := &HyperOpsReconciler{Client: c, TerminalStatePolicy: TerminalStatePolicyDeregister, TerminalStateTimeout: 3 * time.Hour}
+		stop, result, err := r.handleTerminalState(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})).To(Succeed())
+
+		r.TerminalStateTimeout = time.Hour
+		stop, _, err = r.handleTerminalState(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeTrue())
+		Expect(condition().Reason).To(Equal("Deregistered"))
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(secret), &corev1.Secret{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should not stop HostedClusters that are not in a terminal state", func() {
+		hc.Status.Conditions = nil
+		r := &HyperOpsReconciler{Client: c, TerminalStatePolicy: TerminalStatePolicyDeregister}
+		stop, _, err := r.handleTerminalState(context.Background(), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stop).To(BeFalse())
+		Expect(condition().Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("Should reject unknown policies", func() {
+		Expect(ValidateTerminalStatePolicy("ignore")).NotTo(Succeed())
+		Expect(ValidateTerminalStatePolicy(TerminalStatePolicySkip)).To(Succeed())
+	})
+})
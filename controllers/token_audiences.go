@@ -0,0 +1,180 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+)
+
+const (
+	// hyperOpsTokenConsumerLabel names the consumer of an audience token secret
+	hyperOpsTokenConsumerLabel = "hyper-ops.cloudmonkey.org/token-consumer"
+	// hyperOpsTokenAudienceAnnotation records the audience of the token of an audience token secret
+	hyperOpsTokenAudienceAnnotation = "hyper-ops.cloudmonkey.org/token-audience"
+)
+
+// ParseTokenAudiences parses a comma separated list of [<namespace>/]<name>=<audience> token consumers
+func ParseTokenAudiences(raw string) ([]hyperopsv1alpha1.TokenAudience, error) {
+	audiences := []hyperopsv1alpha1.TokenAudience{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		consumer, audience, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid token audience %q, must be [<namespace>/]<name>=<audience>", entry)
+		}
+		namespace, name, ok := strings.Cut(consumer, "/")
+		if !ok {
+			namespace, name = "", consumer
+		}
+		audiences = append(audiences, hyperopsv1alpha1.TokenAudience{Name: name, Audience: audience, Namespace: namespace})
+	}
+	return audiences, ValidateTokenAudiences(audiences)
+}
+
+// ValidateTokenAudiences returns an error if a token consumer has an invalid or duplicate name or no audience
+func ValidateTokenAudiences(audiences []hyperopsv1alpha1.TokenAudience) error {
+	names := map[string]bool{}
+	for _, a := range audiences {
+		if errs := validation.IsDNS1123Label(a.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid token consumer name %q: %s", a.Name, strings.Join(errs, ", "))
+		}
+		if names[a.Name] {
+			return fmt.Errorf("duplicate token consumer %q", a.Name)
+		}
+		names[a.Name] = true
+		if a.Audience == "" {
+			return fmt.Errorf("token consumer %q has no audience", a.Name)
+		}
+		if a.Namespace != "" {
+			if errs := validation.IsDNS1123Label(a.Namespace); len(errs) > 0 {
+				return fmt.Errorf("invalid namespace %q of token consumer %q: %s", a.Namespace, a.Name, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// audienceTokenSecretKey returns the secret holding the token of the consumer for the HostedCluster, by default in
+// the namespace of the HostedCluster next to its admin kubeconfig
+func audienceTokenSecretKey(hc *hypershiftv1beta1.HostedCluster, audience hyperopsv1alpha1.TokenAudience) client.ObjectKey {
+	namespace := audience.Namespace
+	if namespace == "" {
+		namespace = hc.Namespace
+	}
+	return client.ObjectKey{Namespace: namespace, Name: fmt.Sprintf("%s-%s-token", hc.Name, audience.Name)}
+}
+
+// reconcileAudienceTokens maintains a secret with a bound token of its own audience for every token consumer and
+// removes the secrets of consumers that are no longer configured. It returns the time until the first token needs
+// renewal, zero if there are no consumers.
+func (r *HyperOpsReconciler) reconcileAudienceTokens(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, issuer *tokenIssuer, cluster *Cluster) (time.Duration, error) {
+	if !r.BoundTokens || r.readOnly() {
+		return 0, nil
+	}
+	var refreshAfter time.Duration
+	configured := map[client.ObjectKey]bool{}
+	for _, audience := range r.TokenAudiences {
+		key := audienceTokenSecretKey(hc, audience)
+		configured[key] = true
+		expiresAt, err := r.ensureAudienceToken(ctx, hc, issuer, cluster, audience, key)
+		if err != nil {
+			return 0, fmt.Errorf("unable to issue the token of consumer %s: %w", audience.Name, err)
+		}
+		refreshAfter = shorterRequeue(refreshAfter, boundTokenRefreshAfter(&Cluster{TokenExpiresAt: expiresAt}, r.tokenRenewBefore()))
+	}
+	return refreshAfter, r.removeAudienceTokens(ctx, hc, configured)
+}
+
+// ensureAudienceToken writes the token of the consumer, the current token is reused until it needs renewal
+func (r *HyperOpsReconciler) ensureAudienceToken(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, issuer *tokenIssuer, cluster *Cluster, audience hyperopsv1alpha1.TokenAudience, key client.ObjectKey) (time.Time, error) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+	if err := r.Get(ctx, key, secret); client.IgnoreNotFound(err) != nil {
+		return time.Time{}, err
+	}
+	token := string(secret.Data["token"])
+	expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[hyperOpsTokenExpiresAtAnnotation])
+	if err != nil || token == "" || secret.Annotations[hyperOpsTokenAudienceAnnotation] != audience.Audience ||
+		!sameClusterIdentity(secret, hc) || time.Until(expiresAt) <= r.tokenRenewBefore() {
+		if token, expiresAt, err = issuer.issueForAudience(ctx, audience.Audience); err != nil {
+			return time.Time{}, err
+		}
+	}
+	_, err = CreateOrUpdateWithRetries(ctx, r.Client, secret, func() error {
+		secret.Labels = managedLabels(secret.Labels)
+		secret.Labels[hyperOpsTokenConsumerLabel] = audience.Name
+		annotations := mergeLabels(clusterIdentityAnnotations(hc), map[string]string{
+			hyperOpsHostedClusterAnnotation:  client.ObjectKeyFromObject(hc).String(),
+			hyperOpsTokenAudienceAnnotation:  audience.Audience,
+			hyperOpsTokenExpiresAtAnnotation: expiresAt.UTC().Format(time.RFC3339),
+		})
+		for k, v := range annotations {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, k, v)
+		}
+		secret.Data = map[string][]byte{
+			"token":  []byte(token),
+			"server": []byte(cluster.Server),
+			"ca.crt": cluster.Config.TLSClientConfig.CAData,
+		}
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	})
+	return expiresAt, err
+}
+
+// removeAudienceTokens deletes the token secrets of the HostedCluster that are not configured, all of them if
+// configured is empty
+func (r *HyperOpsReconciler) removeAudienceTokens(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, configured map[client.ObjectKey]bool) error {
+	if r.readOnly() {
+		return nil
+	}
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.HasLabels{hyperOpsTokenConsumerLabel}, client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if secret.Annotations[hyperOpsHostedClusterAnnotation] != client.ObjectKeyFromObject(hc).String() || configured[client.ObjectKeyFromObject(secret)] {
+			continue
+		}
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shorterRequeue returns the shorter of two requeue durations, zero meaning no requeue
+func shorterRequeue(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Token audiences", func() {
+	var requested [][]string
+	var reviewErr error
+	expiresAt := time.Now().Add(boundTokenExpiration).Truncate(time.Second)
+	hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters", UID: "uid"}}
+	cluster := &Cluster{Cluster: argocd.Cluster{
+		Name:   "hosted",
+		Server: "https://hosted:6443",
+		Config: argocd.ClusterConfig{TLSClientConfig: argocd.TLSClientConfig{CAData: []byte("ca")}},
+	}}
+
+	newIssuer := func() *tokenIssuer {
+		clientset := kubefake.NewSimpleClientset()
+		clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenRequest)
+			requested = append(requested, tr.Spec.Audiences)
+			return true, &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{Token: "token-" + tr.Spec.Audiences[0], ExpirationTimestamp: metav1.NewTime(expiresAt)},
+			}, nil
+		})
+		return &tokenIssuer{
+			clientset: clientset,
+			review:    func(context.Context, string, string) error { return reviewErr },
+		}
+	}
+
+	BeforeEach(func() {
+		requested = nil
+		reviewErr = nil
+	})
+
+	It("Should parse the token consumers", func() {
+		audiences, err := ParseTokenAudiences("tekton=tekton.dev, ci/custom=https://ci.example.com/hosted")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(audiences).To(Equal([]hyperopsv1alpha1.TokenAudience{
+			{Name: "tekton", Audience: "tekton.dev"},
+			{Name: "custom", Audience: "https://ci.example.com/hosted", Namespace: "ci"},
+		}))
+
+		_, err = ParseTokenAudiences("tekton")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseTokenAudiences("tekton=")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseTokenAudiences("tekton=a,tekton=b")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseTokenAudiences("Not_A_Name=a")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should write a token of its own audience per consumer and reuse it until renewal", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, BoundTokens: true, TokenAudiences: []hyperopsv1alpha1.TokenAudience{
+			{Name: "tekton", Audience: "tekton.dev"},
+			{Name: "custom", Audience: "custom.example.com", Namespace: "ci"},
+		}}
+		issuer := newIssuer()
+		refreshAfter, err := r.reconcileAudienceTokens(context.Background(), hc, issuer, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refreshAfter).To(BeNumerically(">", boundTokenExpiration-boundTokenRefreshWindow-time.Minute))
+		Expect(requested).To(Equal([][]string{{"tekton.dev"}, {"custom.example.com"}}))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "clusters", Name: "hosted-tekton-token"}, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue("token", []byte("token-tekton.dev")))
+		Expect(secret.Data).To(HaveKeyWithValue("server", []byte("https://hosted:6443")))
+		Expect(secret.Labels).To(HaveKeyWithValue(hyperOpsTokenConsumerLabel, "tekton"))
+		Expect(secret.Annotations).To(HaveKeyWithValue(hyperOpsTokenAudienceAnnotation, "tekton.dev"))
+		Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-custom-token"}, secret)).To(Succeed())
+
+		_, err = r.reconcileAudienceTokens(context.Background(), hc, issuer, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requested).To(HaveLen(2))
+
+		// consumers that are no longer configured lose their secret
+		r.TokenAudiences = r.TokenAudiences[:1]
+		_, err = r.reconcileAudienceTokens(context.Background(), hc, issuer, cluster)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "ci", Name: "hosted-custom-token"}, secret))).To(BeTrue())
+
+		Expect(r.removeAudienceTokens(context.Background(), hc, nil)).To(Succeed())
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "clusters", Name: "hosted-tekton-token"}, secret))).To(BeTrue())
+	})
+
+	It("Should not write tokens failing the review for their audience", func() {
+		reviewErr = errors.New("not authenticated")
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		r := &HyperOpsReconciler{Client: c, BoundTokens: true, TokenAudiences: []hyperopsv1alpha1.TokenAudience{{Name: "tekton", Audience: "tekton.dev"}}}
+		_, err := r.reconcileAudienceTokens(context.Background(), hc, newIssuer(), cluster)
+		Expect(err).To(MatchError(ContainSubstring("not authenticated")))
+		Expect(apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKey{Namespace: "clusters", Name: "hosted-tekton-token"}, &corev1.Secret{}))).To(BeTrue())
+	})
+})
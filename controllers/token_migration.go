@@ -0,0 +1,266 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+// Registrations of hosted clusters are migrated from the legacy service account token secret to TokenRequest issued
+// tokens without downtime: a new token is issued and verified against the hosted cluster, written to the ArgoCD
+// cluster secret, and only then the legacy token secret is deleted. A failure at any step leaves the registration on
+// the token it used before.
+
+const (
+	// hyperOpsTokenExpiresAtAnnotation records when the bound token of the ArgoCD cluster secret expires
+	hyperOpsTokenExpiresAtAnnotation = "hyper-ops.cloudmonkey.org/token-expires-at"
+
+	// boundTokenExpiration is the default lifetime of bound tokens
+	boundTokenExpiration = 24 * time.Hour
+	// boundTokenRefreshWindow is the default remaining lifetime at which bound tokens are renewed
+	boundTokenRefreshWindow = 8 * time.Hour
+)
+
+var legacyTokenSecretName = fmt.Sprintf("%s-token", hostedClusterServiceAccountName)
+
+// tokenIssuer requests bound tokens for the hyper-ops service account of a hosted cluster
+type tokenIssuer struct {
+	clientset kubernetes.Interface
+	// ttl is the requested lifetime of the tokens, boundTokenExpiration if zero
+	ttl time.Duration
+	// verify checks that the token authenticates against the hosted cluster
+	verify func(ctx context.Context, token string) error
+	// review checks that the token authenticates for the audience with a TokenReview in the hosted cluster
+	review func(ctx context.Context, token, audience string) error
+}
+
+// newTokenIssuer returns a tokenIssuer for the hosted cluster reachable with the rest config
+func newTokenIssuer(cfg *rest.Config) (*tokenIssuer, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenIssuer{
+		clientset: clientset,
+		verify: func(ctx context.Context, token string) error {
+			tokenConfig := rest.AnonymousClientConfig(cfg)
+			tokenConfig.WrapTransport = cfg.WrapTransport
+			tokenConfig.BearerToken = token
+			tokenClientset, err := kubernetes.NewForConfig(tokenConfig)
+			if err != nil {
+				return err
+			}
+			_, err = tokenClientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "get", Resource: "secrets"},
+				},
+			}, metav1.CreateOptions{})
+			return err
+		},
+		review: func(ctx context.Context, token, audience string) error {
+			review, err := clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+				Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: []string{audience}},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("unable to review token: %w", err)
+			}
+			if !review.Status.Authenticated {
+				return fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// request requests a bound token for the audiences, the audiences of the API server if empty. Transient errors of
+// the hosted cluster API are retried with the hosted cluster retry policy.
+func (t *tokenIssuer) request(ctx context.Context, audiences []string) (*authenticationv1.TokenRequest, error) {
+	ttl := t.ttl
+	if ttl <= 0 {
+		ttl = boundTokenExpiration
+	}
+	expirationSeconds := int64(ttl.Seconds())
+	var tr *authenticationv1.TokenRequest
+	err := hostedClusterRetryPolicy().Do(ctx, func(ctx context.Context) error {
+		var err error
+		tr, err = t.clientset.CoreV1().ServiceAccounts(hostedClusterServiceAccountNamespace).CreateToken(ctx, hostedClusterServiceAccountName,
+			&authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds, Audiences: audiences}}, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to request a bound token: %w", err)
+	}
+	if tr.Status.Token == "" {
+		return nil, fmt.Errorf("token request returned no token")
+	}
+	return tr, nil
+}
+
+// issue requests a bound token and verifies it against the hosted cluster
+func (t *tokenIssuer) issue(ctx context.Context) (string, time.Time, error) {
+	tr, err := t.request(ctx, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := t.verify(ctx, tr.Status.Token); err != nil {
+		return "", time.Time{}, fmt.Errorf("bound token failed verification: %w", err)
+	}
+	return tr.Status.Token, tr.Status.ExpirationTimestamp.Time, nil
+}
+
+// issueForAudience requests a bound token restricted to the audience. Such a token is usually not accepted by the
+// API server itself, it is verified with a TokenReview for the audience instead.
+func (t *tokenIssuer) issueForAudience(ctx context.Context, audience string) (string, time.Time, error) {
+	tr, err := t.request(ctx, []string{audience})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := t.review(ctx, tr.Status.Token, audience); err != nil {
+		return "", time.Time{}, fmt.Errorf("bound token for audience %s failed verification: %w", audience, err)
+	}
+	return tr.Status.Token, tr.Status.ExpirationTimestamp.Time, nil
+}
+
+// setupBoundTokenClusterConfig returns the cluster config of the HostedCluster using a bound token. The token of the
+// current registration is reused until it enters the refresh window, so the ArgoCD cluster secret only changes on renewal.
+func (r *HyperOpsReconciler) setupBoundTokenClusterConfig(ctx context.Context, clnt client.Client, issuer *tokenIssuer, server string, caData []byte, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (*Cluster, error) {
+	clusterRole, err := r.hostedClusterRole(hc)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureServiceAccount(ctx, clnt, correlationID(hc), clusterRole); err != nil {
+		return nil, err
+	}
+	cluster := &Cluster{
+		Cluster: argocd.Cluster{
+			Name:   hc.Name,
+			Server: server,
+			Config: argocd.ClusterConfig{
+				TLSClientConfig: argocd.TLSClientConfig{CAData: caData},
+			},
+		},
+		HostedCluster: hc,
+	}
+	if token, expiresAt, ok := r.currentBoundToken(ctx, hc, gitOpsNamespace); ok && time.Until(expiresAt) > r.tokenRenewBefore() &&
+		!quarantinedCredentials(hc)[fingerprint([]byte(token))] {
+		cluster.Config.BearerToken = token
+		cluster.TokenExpiresAt = expiresAt
+		return cluster, nil
+	}
+	token, expiresAt, err := issuer.issue(ctx)
+	if err != nil {
+		if cerr := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionBoundServiceAccountToken,
+			Status:  metav1.ConditionFalse,
+			Reason:  "TokenRequestFailed",
+			Message: err.Error(),
+		}); cerr != nil {
+			return nil, cerr
+		}
+		return nil, err
+	}
+	cluster.Config.BearerToken = token
+	cluster.TokenExpiresAt = expiresAt
+	cluster.TokenIssuedAt = time.Now()
+	return cluster, nil
+}
+
+// currentBoundToken returns the bound token of the registration and its expiration, if the registration has one and
+// was written for the same HostedCluster
+func (r *HyperOpsReconciler) currentBoundToken(ctx context.Context, hc *hypershiftv1beta1.HostedCluster, gitOpsNamespace string) (string, time.Time, bool) {
+	// the remote secret can't be read through the registration proxy, tokens are renewed on every reconcile
+	var reader client.Reader = r.Client
+	if r.RegistrationProxy != nil {
+		return "", time.Time{}, false
+	} else if r.RemoteHub != nil {
+		reader = r.RemoteHub.Client
+	}
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: gitOpsNamespace, Name: hc.Name}, secret); err != nil {
+		return "", time.Time{}, false
+	}
+	if !sameClusterIdentity(secret, hc) {
+		return "", time.Time{}, false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[hyperOpsTokenExpiresAtAnnotation])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	cluster, err := argocd.ClusterFromSecretData(secret.Data)
+	if err != nil || cluster.Config.BearerToken == "" {
+		return "", time.Time{}, false
+	}
+	return cluster.Config.BearerToken, expiresAt, true
+}
+
+// completeTokenMigration removes the legacy token secret once the registration uses a bound token
+func (r *HyperOpsReconciler) completeTokenMigration(ctx context.Context, clnt client.Client, hc *hypershiftv1beta1.HostedCluster) error {
+	log := log.FromContext(ctx)
+	if r.readOnly() {
+		return nil
+	}
+	legacy := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      legacyTokenSecretName,
+			Namespace: hostedClusterServiceAccountNamespace,
+		},
+	}
+	err := clnt.Delete(ctx, legacy)
+	if client.IgnoreNotFound(err) != nil {
+		if cerr := r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionBoundServiceAccountToken,
+			Status:  metav1.ConditionFalse,
+			Reason:  "LegacyTokenCleanupFailed",
+			Message: fmt.Sprintf("unable to delete the legacy token secret: %s", err),
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	if err == nil {
+		log.Info("deleted legacy service account token secret")
+	}
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionBoundServiceAccountToken,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Migrated",
+		Message: "registration uses a TokenRequest issued token",
+	})
+}
+
+// boundTokenRefreshAfter returns the time until the bound token of the cluster enters its renewal window
+func boundTokenRefreshAfter(cluster *Cluster, renewBefore time.Duration) time.Duration {
+	refreshAfter := time.Until(cluster.TokenExpiresAt.Add(-renewBefore))
+	if refreshAfter < time.Minute {
+		return time.Minute
+	}
+	return refreshAfter
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Bound token migration", func() {
+	var expiresAt time.Time
+
+	newIssuer := func(verifyErr error) *tokenIssuer {
+		clientset := kubefake.NewSimpleClientset()
+		clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "token" {
+				return false, nil, nil
+			}
+			return true, &authenticationv1.TokenRequest{
+				Status: authenticationv1.TokenRequestStatus{Token: "bound", ExpirationTimestamp: metav1.NewTime(expiresAt)},
+			}, nil
+		})
+		return &tokenIssuer{
+			clientset: clientset,
+			verify:    func(context.Context, string) error { return verifyErr },
+		}
+	}
+
+	BeforeEach(func() {
+		expiresAt = time.Now().Add(boundTokenExpiration).Truncate(time.Second)
+	})
+
+	It("Should issue and verify a bound token", func() {
+		token, expiration, err := newIssuer(nil).issue(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("bound"))
+		Expect(expiration).To(BeTemporally("==", expiresAt))
+	})
+
+	It("Should reject tokens failing verification", func() {
+		_, _, err := newIssuer(errors.New("unauthorized")).issue(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("unauthorized")))
+	})
+
+	It("Should delete the legacy token secret and report the migration", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+		}
+		legacy := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: legacyTokenSecretName, Namespace: hostedClusterServiceAccountNamespace},
+			Type:       corev1.SecretTypeServiceAccountToken,
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build()
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(legacy).Build()
+		r := &HyperOpsReconciler{Client: c, BoundTokens: true}
+
+		Expect(r.completeTokenMigration(context.Background(), hosted, hc)).To(Succeed())
+		err := hosted.Get(context.Background(), client.ObjectKeyFromObject(legacy), &corev1.Secret{})
+		Expect(client.IgnoreNotFound(err)).To(Succeed())
+		Expect(err).To(HaveOccurred())
+
+		updated := &hypershiftv1beta1.HostedCluster{}
+		Expect(c.Get(context.Background(), client.ObjectKeyFromObject(hc), updated)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(registrationConditions(updated), ConditionBoundServiceAccountToken)).To(BeTrue())
+	})
+
+	It("Should reuse the current bound token until it needs renewal", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+		}
+		current := &Cluster{HostedCluster: hc, TokenExpiresAt: expiresAt}
+		current.Name = "hosted"
+		current.Server = "https://hosted:6443"
+		current.Config.BearerToken = "current"
+		data, err := current.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hosted",
+				Namespace:   defaultGitOpsNamespace,
+				Annotations: map[string]string{hyperOpsTokenExpiresAtAnnotation: expiresAt.UTC().Format(time.RFC3339)},
+			},
+			Data: data,
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc, secret).Build(), BoundTokens: true}
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+		cluster, err := r.setupBoundTokenClusterConfig(context.Background(), hosted, newIssuer(nil), "https://hosted:6443", []byte("ca"), hc, defaultGitOpsNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cluster.Config.BearerToken).To(Equal("current"))
+		Expect(boundTokenRefreshAfter(cluster, boundTokenRefreshWindow)).To(BeNumerically(">", boundTokenExpiration-boundTokenRefreshWindow-time.Minute))
+	})
+})
@@ -0,0 +1,166 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Bound tokens are renewed by the reconcile scheduled for the start of their renewal window. The TokenRotator is the
+// safety net for renewals that don't happen that way, e.g. because the requeue was lost in a restart or the
+// registration was failing for a while: it periodically checks the expiration recorded on every ArgoCD cluster
+// secret and queues the HostedClusters whose token is due.
+
+const (
+	// DefaultTokenRotationInterval is the interval at which the TokenRotator checks the ArgoCD cluster secrets
+	DefaultTokenRotationInterval = time.Minute
+
+	// minTokenTTL is the shortest lifetime the TokenRequest API issues tokens for
+	minTokenTTL = 10 * time.Minute
+)
+
+var (
+	tokenExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hyperops_token_expiration_timestamp_seconds",
+		Help: "Expiration of the bound token in the ArgoCD cluster secret of a HostedCluster.",
+	}, []string{"hostedcluster", "namespace"})
+	tokenRotationsDue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hyperops_token_rotations_due",
+		Help: "Registrations whose bound token is in its renewal window but was not renewed yet.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(tokenExpiration, tokenRotationsDue)
+}
+
+// ValidateTokenRotation returns an error if bound tokens can't be issued for the lifetime or renewed in time
+func ValidateTokenRotation(ttl, renewBefore time.Duration) error {
+	if ttl < minTokenTTL {
+		return fmt.Errorf("the token lifetime %s is shorter than the minimum of %s", ttl, minTokenTTL)
+	}
+	if renewBefore <= 0 || renewBefore >= ttl {
+		return fmt.Errorf("tokens must be renewed before they expire and after they were issued, %s is not within the lifetime %s", renewBefore, ttl)
+	}
+	return nil
+}
+
+// tokenTTL returns the requested lifetime of bound tokens
+func (r *HyperOpsReconciler) tokenTTL() time.Duration {
+	if r.TokenTTL > 0 {
+		return r.TokenTTL
+	}
+	return boundTokenExpiration
+}
+
+// tokenRenewBefore returns the remaining lifetime at which bound tokens are renewed
+func (r *HyperOpsReconciler) tokenRenewBefore() time.Duration {
+	if r.TokenRenewBefore > 0 {
+		return r.TokenRenewBefore
+	}
+	return boundTokenRefreshWindow
+}
+
+// DueTokenRotations returns the HostedClusters whose ArgoCD cluster secret holds a bound token in its renewal window
+// and publishes the expiration of every bound token
+func DueTokenRotations(ctx context.Context, c client.Reader, renewBefore time.Duration, now time.Time) ([]types.NamespacedName, error) {
+	secrets := &corev1.SecretList{}
+	if err := c.List(ctx, secrets, client.MatchingLabels{argoCDSecretTypeLabel: argoCDSecretTypeCluster}); err != nil {
+		return nil, err
+	}
+	tokenExpiration.Reset()
+	due := []types.NamespacedName{}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		// copies are renewed together with the secret they were copied from
+		if !hyperOpsManaged(secret) || secret.Annotations[hyperOpsCopyOfAnnotation] != "" {
+			continue
+		}
+		namespace, name, ok := strings.Cut(secret.Annotations[hyperOpsHostedClusterAnnotation], "/")
+		if !ok {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, secret.Annotations[hyperOpsTokenExpiresAtAnnotation])
+		if err != nil {
+			continue
+		}
+		tokenExpiration.WithLabelValues(name, namespace).Set(float64(expiresAt.Unix()))
+		if !now.Before(expiresAt.Add(-renewBefore)) {
+			due = append(due, types.NamespacedName{Namespace: namespace, Name: name})
+		}
+	}
+	tokenRotationsDue.Set(float64(len(due)))
+	return due, nil
+}
+
+// TokenRotator periodically queues the HostedClusters whose bound token is due for renewal
+type TokenRotator struct {
+	Client      client.Client
+	Interval    time.Duration
+	RenewBefore time.Duration
+	// Rotations is watched by the registration controller, see HyperOpsReconciler.TokenRotations
+	Rotations chan<- event.GenericEvent
+}
+
+// Start runs the rotator until the context is cancelled, it implements manager.Runnable
+func (t *TokenRotator) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("token-rotation")
+	interval := t.Interval
+	if interval <= 0 {
+		interval = DefaultTokenRotationInterval
+	}
+	renewBefore := t.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = boundTokenRefreshWindow
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		due, err := DueTokenRotations(ctx, t.Client, renewBefore, time.Now())
+		if err != nil {
+			log.Error(err, "unable to check the bound tokens")
+			return
+		}
+		for _, key := range due {
+			log.V(1).Info("bound token is due for renewal", "hostedCluster", key)
+			hc := &hypershiftv1beta1.HostedCluster{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+			select {
+			case t.Rotations <- event.GenericEvent{Object: hc}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader, which is the only one reconciling, queues renewals
+func (t *TokenRotator) NeedLeaderElection() bool {
+	return true
+}
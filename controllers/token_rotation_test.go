@@ -0,0 +1,120 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Token rotation", func() {
+	var now time.Time
+
+	registration := func(name string, expiresAt time.Time, annotations map[string]string) *corev1.Secret {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: defaultGitOpsNamespace,
+			Labels:    map[string]string{argoCDSecretTypeLabel: argoCDSecretTypeCluster, hyperOpsTypeLabel: "hosted"},
+			Annotations: map[string]string{
+				hyperOpsHostedClusterAnnotation:  "clusters/" + name,
+				hyperOpsTokenExpiresAtAnnotation: expiresAt.UTC().Format(time.RFC3339),
+			},
+		}}
+		for k, v := range annotations {
+			secret.Annotations[k] = v
+		}
+		return secret
+	}
+
+	BeforeEach(func() {
+		now = time.Now().Truncate(time.Second)
+	})
+
+	It("Should validate the token lifetime and renewal window", func() {
+		Expect(ValidateTokenRotation(boundTokenExpiration, boundTokenRefreshWindow)).To(Succeed())
+		Expect(ValidateTokenRotation(time.Hour, 20*time.Minute)).To(Succeed())
+		Expect(ValidateTokenRotation(5*time.Minute, time.Minute)).NotTo(Succeed())
+		Expect(ValidateTokenRotation(time.Hour, time.Hour)).NotTo(Succeed())
+		Expect(ValidateTokenRotation(time.Hour, 0)).NotTo(Succeed())
+	})
+
+	It("Should find the tokens in their renewal window", func() {
+		unmanaged := registration("unmanaged", now, nil)
+		delete(unmanaged.Labels, hyperOpsTypeLabel)
+		copied := registration("copy", now, map[string]string{hyperOpsCopyOfAnnotation: "argocd/overdue"})
+		copied.Namespace = "argocd-copies"
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			registration("fresh", now.Add(20*time.Hour), nil),
+			registration("due", now.Add(8*time.Hour), nil),
+			registration("overdue", now.Add(-time.Minute), nil),
+			registration("legacy", now, map[string]string{hyperOpsTokenExpiresAtAnnotation: ""}),
+			unmanaged,
+			copied,
+		).Build()
+
+		due, err := DueTokenRotations(context.Background(), c, boundTokenRefreshWindow, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(due).To(ConsistOf(
+			types.NamespacedName{Namespace: "clusters", Name: "due"},
+			types.NamespacedName{Namespace: "clusters", Name: "overdue"},
+		))
+
+		By("using the configured renewal window")
+		due, err = DueTokenRotations(context.Background(), c, time.Hour, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(due).To(ConsistOf(types.NamespacedName{Namespace: "clusters", Name: "overdue"}))
+	})
+
+	It("Should queue the HostedClusters whose token is due", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			registration("overdue", now.Add(-time.Minute), nil),
+		).Build()
+		rotations := make(chan event.GenericEvent)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			defer GinkgoRecover()
+			Expect((&TokenRotator{Client: c, Interval: time.Hour, Rotations: rotations}).Start(ctx)).To(Succeed())
+		}()
+
+		var e event.GenericEvent
+		Eventually(rotations).Should(Receive(&e))
+		Expect(client.ObjectKeyFromObject(e.Object)).To(Equal(client.ObjectKey{Namespace: "clusters", Name: "overdue"}))
+	})
+
+	It("Should reuse the current token until the configured renewal window", func() {
+		r := &HyperOpsReconciler{TokenTTL: 2 * time.Hour, TokenRenewBefore: 30 * time.Minute}
+		Expect(r.tokenTTL()).To(Equal(2 * time.Hour))
+		Expect(r.tokenRenewBefore()).To(Equal(30 * time.Minute))
+		Expect(boundTokenRefreshAfter(&Cluster{TokenExpiresAt: now.Add(2 * time.Hour)}, r.tokenRenewBefore())).To(
+			BeNumerically("~", 90*time.Minute, time.Minute))
+
+		r = &HyperOpsReconciler{}
+		Expect(r.tokenTTL()).To(Equal(boundTokenExpiration))
+		Expect(r.tokenRenewBefore()).To(Equal(boundTokenRefreshWindow))
+	})
+})
@@ -0,0 +1,123 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Topology labels summarize the NodePools and nodes of a hosted cluster on its ArgoCD cluster secret, so
+// ApplicationSet cluster generators can route workloads to clusters able to run them, e.g. with a
+// hyper-ops.cloudmonkey.org/arch-arm64=true selector.
+
+// nodeArchLabel is the well known label holding the architecture of a node
+const nodeArchLabel = "kubernetes.io/arch"
+
+var (
+	hyperOpsNodePoolReplicasLabel = fmt.Sprintf("%s/nodepool-replicas", hyperOpsLabel)
+	hyperOpsArchLabelPrefix       = fmt.Sprintf("%s/arch-", hyperOpsLabel)
+	hyperOpsPlatformLabelPrefix   = fmt.Sprintf("%s/platform-", hyperOpsLabel)
+
+	// the KubeVirt infra labels name the cluster and namespace the KubeVirt VMs of the workers run in
+	hyperOpsKubevirtInfraClusterLabel   = fmt.Sprintf("%s/kubevirt-infra-cluster", hyperOpsLabel)
+	hyperOpsKubevirtInfraNamespaceLabel = fmt.Sprintf("%s/kubevirt-infra-namespace", hyperOpsLabel)
+)
+
+// topologyLabels returns the topology labels of the HostedCluster, built from its NodePools on the management cluster
+// and the nodes of the hosted cluster
+func (r *HyperOpsReconciler) topologyLabels(ctx context.Context, hostedClusterClient client.Client, hc *hypershiftv1beta1.HostedCluster) (map[string]string, error) {
+	nodePools, err := r.nodePools(ctx, hc)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	var replicas int32
+	for i := range nodePools {
+		replicas += nodePools[i].Status.Replicas
+		if platform := nodePools[i].Spec.Platform.Type; platform != "" {
+			labels[hyperOpsPlatformLabelPrefix+strings.ToLower(string(platform))] = "true"
+		}
+	}
+	labels[hyperOpsNodePoolReplicasLabel] = strconv.Itoa(int(replicas))
+
+	if hc.Spec.Platform.Type == hypershiftv1beta1.KubevirtPlatform {
+		for k, v := range r.kubevirtInfraLabels(hc) {
+			labels[k] = v
+		}
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := hostedClusterClient.List(ctx, nodes); err != nil {
+		return nil, fmt.Errorf("unable to list hosted cluster nodes: %w", err)
+	}
+	for i := range nodes.Items {
+		if arch := nodes.Items[i].Labels[nodeArchLabel]; arch != "" {
+			labels[hyperOpsArchLabelPrefix+arch] = "true"
+		}
+	}
+	return labels, nil
+}
+
+// nodePools returns the NodePools of the HostedCluster
+func (r *HyperOpsReconciler) nodePools(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) ([]hypershiftv1beta1.NodePool, error) {
+	list := &hypershiftv1beta1.NodePoolList{}
+	if err := r.List(ctx, list, client.InNamespace(hc.Namespace)); err != nil {
+		return nil, fmt.Errorf("unable to list nodepools: %w", err)
+	}
+	nodePools := []hypershiftv1beta1.NodePool{}
+	for i := range list.Items {
+		if list.Items[i].Spec.ClusterName == hc.Name {
+			nodePools = append(nodePools, list.Items[i])
+		}
+	}
+	return nodePools, nil
+}
+
+// hostedClusterForNodePool maps a NodePool to the HostedCluster it belongs to
+func (r *HyperOpsReconciler) hostedClusterForNodePool(obj client.Object) []reconcile.Request {
+	nodePool, ok := obj.(*hypershiftv1beta1.NodePool)
+	if !ok || nodePool.Spec.ClusterName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: nodePool.Namespace, Name: nodePool.Spec.ClusterName}}}
+}
+
+// kubevirtInfraLabels returns the labels naming the infra cluster and namespace the KubeVirt VMs of the HostedCluster
+// run in. The VMs run in the control plane namespace on the management cluster.
+func (r *HyperOpsReconciler) kubevirtInfraLabels(hc *hypershiftv1beta1.HostedCluster) map[string]string {
+	labels := map[string]string{
+		hyperOpsKubevirtInfraNamespaceLabel: hostedControlPlaneNamespace(hc),
+	}
+	if r.InfraClusterName != "" {
+		labels[hyperOpsKubevirtInfraClusterLabel] = r.InfraClusterName
+	}
+	return labels
+}
+
+// hostedControlPlaneNamespace returns the namespace of the hosted control plane of the HostedCluster, following the
+// HyperShift naming
+func hostedControlPlaneNamespace(hc *hypershiftv1beta1.HostedCluster) string {
+	return fmt.Sprintf("%s-%s", hc.Namespace, strings.ReplaceAll(hc.Name, ".", "-"))
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Topology labels", func() {
+	It("Should summarize the NodePools and node architectures of the HostedCluster", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+		}
+		nodePool := func(name, cluster string, platform hypershiftv1beta1.PlatformType, replicas int32) *hypershiftv1beta1.NodePool {
+			return &hypershiftv1beta1.NodePool{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+				Spec: hypershiftv1beta1.NodePoolSpec{
+					ClusterName: cluster,
+					Platform:    hypershiftv1beta1.NodePoolPlatform{Type: platform},
+				},
+				Status: hypershiftv1beta1.NodePoolStatus{Replicas: replicas},
+			}
+		}
+		node := func(name, arch string) *corev1.Node {
+			return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{nodeArchLabel: arch}}}
+		}
+		r := &HyperOpsReconciler{Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			hc,
+			nodePool("workers", "hosted", hypershiftv1beta1.AWSPlatform, 2),
+			nodePool("graviton", "hosted", hypershiftv1beta1.AWSPlatform, 1),
+			nodePool("other", "other", hypershiftv1beta1.KubevirtPlatform, 5),
+		).Build()}
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+			node("worker-0", "amd64"), node("worker-1", "amd64"), node("graviton-0", "arm64"),
+		).Build()
+
+		labels, err := r.topologyLabels(context.Background(), hosted, hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{
+			"hyper-ops.cloudmonkey.org/nodepool-replicas": "3",
+			"hyper-ops.cloudmonkey.org/platform-aws":      "true",
+			"hyper-ops.cloudmonkey.org/arch-amd64":        "true",
+			"hyper-ops.cloudmonkey.org/arch-arm64":        "true",
+		}))
+	})
+
+	It("Should label KubeVirt hosted clusters with their infra cluster and namespace", func() {
+		hc := &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted.example", Namespace: "clusters"},
+			Spec: hypershiftv1beta1.HostedClusterSpec{
+				Platform: hypershiftv1beta1.PlatformSpec{Type: hypershiftv1beta1.KubevirtPlatform},
+			},
+		}
+		r := &HyperOpsReconciler{
+			Client:           fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build(),
+			InfraClusterName: "mgmt-east",
+		}
+		hosted := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+		labels, err := r.topologyLabels(context.Background(), hosted, hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/kubevirt-infra-cluster", "mgmt-east"))
+		Expect(labels).To(HaveKeyWithValue("hyper-ops.cloudmonkey.org/kubevirt-infra-namespace", "clusters-hosted-example"))
+
+		r.InfraClusterName = ""
+		labels, err = r.topologyLabels(context.Background(), hosted, hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).NotTo(HaveKey("hyper-ops.cloudmonkey.org/kubevirt-infra-cluster"))
+	})
+
+	It("Should map a NodePool to its HostedCluster", func() {
+		r := &HyperOpsReconciler{}
+		requests := r.hostedClusterForNodePool(&hypershiftv1beta1.NodePool{
+			ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "clusters"},
+			Spec:       hypershiftv1beta1.NodePoolSpec{ClusterName: "hosted"},
+		})
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Namespace).To(Equal("clusters"))
+		Expect(requests[0].Name).To(Equal("hosted"))
+	})
+})
@@ -0,0 +1,157 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// GitOps fighting a release rollout, e.g. by self healing objects the new release changes, slows the upgrade down or
+// breaks it. While HyperShift rolls out a new release to a hosted cluster its registration can be flagged, and the
+// syncs of its root Application paused, until the rollout completed.
+
+const (
+	// UpgradePolicyIgnore registers HostedClusters rolling out a new release like any other (default)
+	UpgradePolicyIgnore = "ignore"
+	// UpgradePolicyFlag labels the ArgoCD cluster secrets of HostedClusters rolling out a new release, so
+	// ApplicationSet selectors can hold back on them
+	UpgradePolicyFlag = "flag"
+	// UpgradePolicyPause flags the registration and also disables the automated sync of the root Application
+	UpgradePolicyPause = "pause"
+
+	// ConditionUpgrading is true while the HostedCluster rolls out a new release and the upgrade policy holds GitOps
+	// back
+	ConditionUpgrading = "Upgrading"
+
+	// hyperOpsUpgradingLabel marks the ArgoCD cluster secrets of a HostedCluster rolling out a new release
+	hyperOpsUpgradingLabel = "hyper-ops.cloudmonkey.org/upgrading"
+
+	// upgradeRecheckInterval is the interval the rollout of an upgrading HostedCluster is checked at, the status
+	// updates of healthy registrations don't trigger reconciles
+	upgradeRecheckInterval = time.Minute
+
+	// EventUpgradeStarted is emitted when the upgrade policy starts holding GitOps back
+	EventUpgradeStarted = "UpgradeStarted"
+	// EventUpgradeCompleted is emitted when the rollout completed and GitOps resumes
+	EventUpgradeCompleted = "UpgradeCompleted"
+)
+
+// ValidateUpgradePolicy returns an error if the upgrade policy is unknown
+func ValidateUpgradePolicy(policy string) error {
+	switch policy {
+	case UpgradePolicyIgnore, UpgradePolicyFlag, UpgradePolicyPause:
+		return nil
+	}
+	return fmt.Errorf("invalid upgrade policy %q, must be %s, %s or %s", policy,
+		UpgradePolicyIgnore, UpgradePolicyFlag, UpgradePolicyPause)
+}
+
+// hostedClusterRollout describes the release rollout of the HostedCluster, empty if no upgrade is in progress. The
+// installation of the first release is not an upgrade.
+func hostedClusterRollout(hc *hypershiftv1beta1.HostedCluster) string {
+	version := hc.Status.Version
+	if version == nil || len(version.History) == 0 {
+		return ""
+	}
+	current := version.History[0]
+	if current.State == configv1.CompletedUpdate {
+		// HyperShift picks up a new release image with a delay, the upgrade starts with the spec change
+		if desired := hc.Spec.Release.Image; desired != "" && desired != current.Image {
+			return fmt.Sprintf("upgrade from %s to %s requested", current.Version, desired)
+		}
+		return ""
+	}
+	if len(version.History) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("rolling out %s over %s", current.Version, version.History[1].Version)
+}
+
+// upgradePolicy returns the upgrade policy, UpgradePolicyIgnore if unset
+func (r *HyperOpsReconciler) upgradePolicy() string {
+	if r.UpgradePolicy == "" {
+		return UpgradePolicyIgnore
+	}
+	return r.UpgradePolicy
+}
+
+// syncPaused returns true if the root Application of the HostedCluster must not sync automatically
+func (r *HyperOpsReconciler) syncPaused(hc *hypershiftv1beta1.HostedCluster) bool {
+	if r.upgradePolicy() != UpgradePolicyPause {
+		return false
+	}
+	return meta.IsStatusConditionTrue(registrationConditions(hc), ConditionUpgrading)
+}
+
+// reconcileUpgrade applies the upgrade policy to the registration. GitOps is held back from the start of a release
+// rollout until the rollout completed and HyperShift reports ClusterVersionSucceeding, the registration is checked
+// every minute in between.
+func (r *HyperOpsReconciler) reconcileUpgrade(ctx context.Context, reg *registration) error {
+	hc := reg.hc
+	policy := r.upgradePolicy()
+	previous := meta.FindStatusCondition(registrationConditions(hc), ConditionUpgrading)
+	upgrading := previous != nil && previous.Status == metav1.ConditionTrue
+	message := ""
+	if policy != UpgradePolicyIgnore {
+		message = hostedClusterRollout(hc)
+		// a completed rollout is only left once the cluster version operator reports success
+		if message == "" && upgrading {
+			if succeeding := meta.FindStatusCondition(hc.Status.Conditions, string(hypershiftv1beta1.ClusterVersionSucceeding)); succeeding != nil &&
+				succeeding.Status == metav1.ConditionFalse {
+				message = fmt.Sprintf("waiting for %s: %s", hypershiftv1beta1.ClusterVersionSucceeding, succeeding.Message)
+			}
+		}
+	}
+	if message == "" {
+		if !upgrading {
+			return nil
+		}
+		log.FromContext(ctx).Info("HostedCluster completed its release rollout, resuming GitOps")
+		r.recordEvent(hc, corev1.EventTypeNormal, EventUpgradeCompleted, "the release rollout completed, GitOps resumed")
+		return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+			Type:    ConditionUpgrading,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RolloutCompleted",
+			Message: "no release rollout in progress",
+		})
+	}
+	reason := "RegistrationFlagged"
+	if policy == UpgradePolicyPause {
+		reason = "SyncPaused"
+	}
+	if !upgrading {
+		log.FromContext(ctx).Info("HostedCluster is rolling out a new release, holding GitOps back", "rollout", message, "policy", policy)
+		r.recordEvent(hc, corev1.EventTypeNormal, EventUpgradeStarted, fmt.Sprintf("%s, the upgrade policy %s holds GitOps back", message, policy))
+	}
+	reg.labels[hyperOpsUpgradingLabel] = "true"
+	reg.requeueAfter = shorterRequeue(reg.requeueAfter, upgradeRecheckInterval)
+	return r.setRegistrationCondition(ctx, hc, metav1.Condition{
+		Type:    ConditionUpgrading,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Upgrade policy", func() {
+	const (
+		oldImage = "quay.io/openshift-release-dev/ocp-release:4.13.0-x86_64"
+		newImage = "quay.io/openshift-release-dev/ocp-release:4.13.1-x86_64"
+	)
+
+	var (
+		hc       *hypershiftv1beta1.HostedCluster
+		r        *HyperOpsReconciler
+		recorder *record.FakeRecorder
+	)
+
+	completed := func(version, image string) configv1.UpdateHistory {
+		return configv1.UpdateHistory{State: configv1.CompletedUpdate, Version: version, Image: image}
+	}
+
+	BeforeEach(func() {
+		hc = &hypershiftv1beta1.HostedCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+			Spec:       hypershiftv1beta1.HostedClusterSpec{Release: hypershiftv1beta1.Release{Image: oldImage}},
+			Status: hypershiftv1beta1.HostedClusterStatus{Version: &hypershiftv1beta1.ClusterVersionStatus{
+				History: []configv1.UpdateHistory{completed("4.13.0", oldImage)},
+			}},
+		}
+		recorder = record.NewFakeRecorder(10)
+		r = &HyperOpsReconciler{
+			Client:        fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(hc).Build(),
+			Recorder:      recorder,
+			UpgradePolicy: UpgradePolicyPause,
+			Bootstrap:     BootstrapApplication{RepoURL: "https://git.example.com/bootstrap.git", AutoSync: true},
+		}
+	})
+
+	// the status is set right before every reconcile, writing the registration conditions reads the HostedCluster back
+	startUpgrade := func() {
+		hc.Spec.Release.Image = newImage
+		hc.Status.Version.History = []configv1.UpdateHistory{
+			{State: configv1.PartialUpdate, Version: "4.13.1", Image: newImage},
+			completed("4.13.0", oldImage),
+		}
+	}
+	completeUpgrade := func(succeeding metav1.ConditionStatus) {
+		hc.Spec.Release.Image = newImage
+		hc.Status.Version.History = []configv1.UpdateHistory{completed("4.13.1", newImage), completed("4.13.0", oldImage)}
+		hc.Status.Conditions = []metav1.Condition{{
+			Type:    string(hypershiftv1beta1.ClusterVersionSucceeding),
+			Status:  succeeding,
+			Reason:  "ClusterOperatorDegraded",
+			Message: "Cluster operator console is degraded",
+		}}
+	}
+
+	It("Should validate the policy", func() {
+		Expect(ValidateUpgradePolicy(UpgradePolicyFlag)).To(Succeed())
+		Expect(ValidateUpgradePolicy("block")).NotTo(Succeed())
+	})
+
+	It("Should detect release rollouts but not the installation", func() {
+		Expect(hostedClusterRollout(hc)).To(BeEmpty())
+
+		installing := hc.DeepCopy()
+		installing.Status.Version.History[0].State = configv1.PartialUpdate
+		Expect(hostedClusterRollout(installing)).To(BeEmpty())
+
+		requested := hc.DeepCopy()
+		requested.Spec.Release.Image = newImage
+		Expect(hostedClusterRollout(requested)).To(Equal("upgrade from 4.13.0 to " + newImage + " requested"))
+
+		startUpgrade()
+		Expect(hostedClusterRollout(hc)).To(Equal("rolling out 4.13.1 over 4.13.0"))
+	})
+
+	It("Should hold GitOps back during a rollout and resume after ClusterVersionSucceeding", func() {
+		ctx := context.Background()
+		cluster := &Cluster{Cluster: argocd.Cluster{Name: "hosted", Server: "https://api.hosted.example.com:6443"}, GitOpsNamespace: defaultGitOpsNamespace}
+		autoSync := func() bool {
+			Expect(r.reconcileBootstrapApplication(ctx, hc, cluster)).To(Succeed())
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(applicationGVK)
+			Expect(r.Get(ctx, client.ObjectKey{Namespace: defaultGitOpsNamespace, Name: "hosted-bootstrap"}, obj)).To(Succeed())
+			_, found, _ := unstructured.NestedMap(obj.Object, "spec", "syncPolicy", "automated")
+			return found
+		}
+
+		reg := &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(ctx, reg)).To(Succeed())
+		Expect(reg.labels).NotTo(HaveKey(hyperOpsUpgradingLabel))
+		Expect(autoSync()).To(BeTrue())
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("flagging the registration and pausing the sync during the rollout")
+		startUpgrade()
+		reg = &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(ctx, reg)).To(Succeed())
+		Expect(reg.labels).To(HaveKeyWithValue(hyperOpsUpgradingLabel, "true"))
+		Expect(reg.requeueAfter).To(Equal(upgradeRecheckInterval))
+		condition := meta.FindStatusCondition(registrationConditions(hc), ConditionUpgrading)
+		Expect(condition.Reason).To(Equal("SyncPaused"))
+		Expect(autoSync()).To(BeFalse())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal UpgradeStarted rolling out 4.13.1 over 4.13.0")))
+
+		By("waiting for ClusterVersionSucceeding after the rollout completed")
+		completeUpgrade(metav1.ConditionFalse)
+		reg = &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(ctx, reg)).To(Succeed())
+		Expect(reg.labels).To(HaveKey(hyperOpsUpgradingLabel))
+		condition = meta.FindStatusCondition(registrationConditions(hc), ConditionUpgrading)
+		Expect(condition.Message).To(ContainSubstring("waiting for ClusterVersionSucceeding"))
+		Expect(recorder.Events).NotTo(Receive())
+
+		By("resuming once the cluster version succeeds")
+		completeUpgrade(metav1.ConditionTrue)
+		reg = &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(ctx, reg)).To(Succeed())
+		Expect(reg.labels).NotTo(HaveKey(hyperOpsUpgradingLabel))
+		Expect(meta.IsStatusConditionTrue(registrationConditions(hc), ConditionUpgrading)).To(BeFalse())
+		Expect(autoSync()).To(BeTrue())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal UpgradeCompleted")))
+	})
+
+	It("Should only flag the registration with the flag policy", func() {
+		r.UpgradePolicy = UpgradePolicyFlag
+		startUpgrade()
+		reg := &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(context.Background(), reg)).To(Succeed())
+		Expect(reg.labels).To(HaveKeyWithValue(hyperOpsUpgradingLabel, "true"))
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionUpgrading).Reason).To(Equal("RegistrationFlagged"))
+		Expect(r.syncPaused(hc)).To(BeFalse())
+	})
+
+	It("Should ignore rollouts with the ignore policy", func() {
+		r.UpgradePolicy = UpgradePolicyIgnore
+		startUpgrade()
+		reg := &registration{hc: hc, labels: map[string]string{}}
+		Expect(r.reconcileUpgrade(context.Background(), reg)).To(Succeed())
+		Expect(reg.labels).NotTo(HaveKey(hyperOpsUpgradingLabel))
+		Expect(meta.FindStatusCondition(registrationConditions(hc), ConditionUpgrading)).To(BeNil())
+	})
+})
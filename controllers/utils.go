@@ -1,54 +1,111 @@
 package controllers
 
 import (
-	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 
 	configv1 "github.com/openshift/api/config/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/retry"
 	"k8s.io/kubectl/pkg/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
-	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"github.com/cldmnky/hyper-ops/pkg/version"
 )
 
-// CreateOrUpdateWithRetries creates or updates the given object in the Kubernetes with retries
-func CreateOrUpdateWithRetries(
-	ctx context.Context,
-	c client.Client,
-	obj client.Object,
-	f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
-	var operationResult controllerutil.OperationResult
-	log := log.FromContext(ctx)
-	updateErr := wait.ExponentialBackoff(retry.DefaultBackoff, func() (ok bool, err error) {
-		operationResult, err = controllerutil.CreateOrUpdate(ctx, c, obj, f)
-		if err == nil {
-			log.V(5).Info("Successfully created/updated resource", "resource", obj)
-			return true, nil
-		}
-		if !apierrors.IsConflict(err) {
-			log.V(5).Error(err, "Failed to create/update resource", "resource", obj)
-			return false, err
+// ClientOption configures the client returned by GetClientForCluster
+type ClientOption func(*rest.Config)
+
+// WithUserAgent sets the user agent of the client, it shows up in the audit log of the target cluster
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *rest.Config) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithHeaders adds the headers to every request of the client
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(c *rest.Config) {
+		if len(headers) == 0 {
+			return
 		}
-		log.V(5).Info("Re-queuing request due to conflict", "resource", obj)
-		return false, nil
-	})
-	return operationResult, updateErr
+		c.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &headerRoundTripper{headers: headers, next: rt}
+		})
+	}
 }
 
-func GetClientForCluster(configBytes []byte) (client.Client, error) {
-	restConfig, err := clientcmd.RESTConfigFromKubeConfig(configBytes)
+// HostedClusterUserAgent returns the user agent used for requests against a hosted cluster
+func HostedClusterUserAgent(namespace, name string) string {
+	return fmt.Sprintf("hyper-ops/%s (hostedcluster=%s/%s)", version.Version, namespace, name)
+}
 
+func GetClientForCluster(configBytes []byte, opts ...ClientOption) (client.Client, error) {
+	restConfig, err := GetRESTConfigForCluster(configBytes, opts...)
 	if err != nil {
 		return nil, err
 	}
+
+	return client.New(restConfig, client.Options{Scheme: scheme.Scheme})
+}
+
+// GetRESTConfigForCluster returns the rest config for the current context of the kubeconfig with the options applied
+func GetRESTConfigForCluster(configBytes []byte, opts ...ClientOption) (*rest.Config, error) {
+	restConfig, _, err := GetRESTConfigForContext(configBytes, "", opts...)
+	return restConfig, err
+}
+
+// GetRESTConfigForContext returns the rest config and the server of a context of the kubeconfig with the options
+// applied, the current context if the context is empty. Kubeconfigs holding several clusters, e.g. one per exposure
+// path of the API server, are resolved through a single context, so the server always matches the rest config.
+func GetRESTConfigForContext(configBytes []byte, contextName string, opts ...ClientOption) (*rest.Config, string, error) {
+	config, err := clientcmd.Load(configBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	if contextName == "" {
+		contextName = config.CurrentContext
+	}
+	kubeContext, ok := config.Contexts[contextName]
+	if !ok {
+		contexts := make([]string, 0, len(config.Contexts))
+		for name := range config.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+		return nil, "", fmt.Errorf("context %q not found in the kubeconfig, it has the contexts %s", contextName, strings.Join(contexts, ", "))
+	}
+	cluster, ok := config.Clusters[kubeContext.Cluster]
+	if !ok {
+		return nil, "", fmt.Errorf("cluster %q of context %q not found in the kubeconfig", kubeContext.Cluster, contextName)
+	}
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*config, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	// requests are always made as the kubeconfig identity so they are attributed to hyper-ops in the audit log
+	restConfig.Impersonate = rest.ImpersonationConfig{}
+	for _, opt := range opts {
+		opt(restConfig)
+	}
 	err = configv1.AddToScheme(scheme.Scheme)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	return restConfig, cluster.Server, nil
+}
 
-	return client.New(restConfig, client.Options{Scheme: scheme.Scheme})
+type headerRoundTripper struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	return h.next.RoundTrip(req)
 }
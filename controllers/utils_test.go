@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+)
+
+var _ = Describe("Hosted cluster clients", func() {
+	It("Should identify hyper-ops and add the configured headers", func() {
+		var got http.Header
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			got = req.Header.Clone()
+		}))
+		defer srv.Close()
+
+		cfg := &rest.Config{Host: srv.URL}
+		WithUserAgent(HostedClusterUserAgent("clusters", "hosted"))(cfg)
+		WithHeaders(map[string]string{"X-Request-Source": "hyper-ops"})(cfg)
+		rt, err := rest.TransportFor(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("User-Agent", cfg.UserAgent)
+		resp, err := rt.RoundTrip(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+
+		Expect(got.Get("User-Agent")).To(Equal("hyper-ops/dev (hostedcluster=clusters/hosted)"))
+		Expect(got.Get("X-Request-Source")).To(Equal("hyper-ops"))
+	})
+})
@@ -0,0 +1,48 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+// Hosted clusters are often created ahead of their NodePools. Their control plane already serves namespaces and RBAC,
+// but workloads stay pending until nodes join. The workers label on the ArgoCD cluster secret tells ApplicationSets
+// which stage a cluster is in, e.g. a hyper-ops.cloudmonkey.org/workers=true selector holds back the workloads while
+// the control plane configuration is deployed to every cluster.
+
+var hyperOpsWorkersLabel = fmt.Sprintf("%s/workers", hyperOpsLabel)
+
+// workersLabels returns the workers label of the HostedCluster, true once one of its NodePools has nodes
+func (r *HyperOpsReconciler) workersLabels(ctx context.Context, hc *hypershiftv1beta1.HostedCluster) (map[string]string, error) {
+	nodePools, err := r.nodePools(ctx, hc)
+	if err != nil {
+		return nil, err
+	}
+	workers := false
+	for i := range nodePools {
+		if nodePools[i].Status.Replicas > 0 {
+			workers = true
+			break
+		}
+	}
+	return map[string]string{hyperOpsWorkersLabel: strconv.FormatBool(workers)}, nil
+}
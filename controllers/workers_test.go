@@ -0,0 +1,71 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+)
+
+var _ = Describe("Workers label", func() {
+	hc := &hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"},
+	}
+	nodePool := func(name, cluster string, replicas int32) *hypershiftv1beta1.NodePool {
+		return &hypershiftv1beta1.NodePool{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "clusters"},
+			Spec:       hypershiftv1beta1.NodePoolSpec{ClusterName: cluster},
+			Status:     hypershiftv1beta1.NodePoolStatus{Replicas: replicas},
+		}
+	}
+
+	It("Should label the cluster without workers until a NodePool has nodes", func() {
+		c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(nodePool("other", "other", 3)).Build()
+		r := &HyperOpsReconciler{Client: c, WorkersLabel: true}
+		labels, err := r.workersLabels(context.Background(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{"hyper-ops.cloudmonkey.org/workers": "false"}))
+
+		By("creating a NodePool whose nodes did not join yet")
+		workers := nodePool("workers", "hosted", 0)
+		Expect(c.Create(context.Background(), workers)).To(Succeed())
+		labels, err = r.workersLabels(context.Background(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(HaveKeyWithValue(hyperOpsWorkersLabel, "false"))
+
+		By("observing the first node")
+		workers.Status.Replicas = 1
+		Expect(c.Update(context.Background(), workers)).To(Succeed())
+		labels, err = r.workersLabels(context.Background(), hc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(labels).To(HaveKeyWithValue(hyperOpsWorkersLabel, "true"))
+	})
+
+	It("Should be disabled with the lifecycle group", func() {
+		disabled := hc.DeepCopy()
+		disabled.Annotations = map[string]string{hyperOpsDisabledBuiltinLabelsAnnotation: BuiltinLabelsLifecycle}
+		labels := removeBuiltinLabels(disabled, map[string]string{hyperOpsWorkersLabel: "false"}, disabledBuiltinLabels(disabled))
+		Expect(labels).To(BeEmpty())
+	})
+})
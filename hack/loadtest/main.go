@@ -0,0 +1,505 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// loadtest generates synthetic HostedClusters against envtest or an existing cluster, e.g. kind, runs the
+// hyper-ops reconciler in process and reports the reconcile throughput, memory usage and API call counts.
+//
+// Every synthetic HostedCluster gets an admin kubeconfig pointing at a path of a local proxy in front of the
+// management API server, so the hosted cluster requests are served by the same API server but counted separately.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openshift/hypershift/api/util/ipnet"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+)
+
+const (
+	// proxyToken is the placeholder bearer token of the synthetic kubeconfigs, the proxy replaces it with the
+	// management cluster credentials
+	proxyToken = "hyper-ops-loadtest"
+	// loadTestLabel marks the objects created by the load test
+	loadTestLabel = "hyper-ops.cloudmonkey.org/loadtest"
+)
+
+// Report is the result of a load test run
+type Report struct {
+	Clusters int `json:"clusters"`
+	// Registered is the number of hosted clusters registered before the timeout
+	Registered int `json:"registered"`
+	// Duration is the time from the creation of the first HostedCluster until all clusters were registered
+	Duration string `json:"duration"`
+	// Throughput is the number of registrations per second
+	Throughput float64      `json:"throughput"`
+	Memory     MemoryReport `json:"memory"`
+	// ManagementCalls are the API calls against the management cluster by HTTP method
+	ManagementCalls map[string]int64 `json:"managementCalls"`
+	// HostedClusterCalls are the API calls against the hosted clusters by HTTP method
+	HostedClusterCalls map[string]int64 `json:"hostedClusterCalls"`
+}
+
+// MemoryReport summarizes the memory usage of the process during the run
+type MemoryReport struct {
+	PeakHeapInuseBytes uint64 `json:"peakHeapInuseBytes"`
+	TotalAllocBytes    uint64 `json:"totalAllocBytes"`
+	NumGC              uint32 `json:"numGC"`
+	PeakGoroutines     int    `json:"peakGoroutines"`
+}
+
+// callCounter counts requests by HTTP method
+type callCounter struct {
+	mu     sync.Mutex
+	counts map[string]*int64
+}
+
+func (c *callCounter) inc(method string) {
+	c.mu.Lock()
+	counter, ok := c.counts[method]
+	if !ok {
+		counter = new(int64)
+		c.counts[method] = counter
+	}
+	c.mu.Unlock()
+	atomic.AddInt64(counter, 1)
+}
+
+func (c *callCounter) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := map[string]int64{}
+	var total int64
+	for method, counter := range c.counts {
+		snapshot[method] = atomic.LoadInt64(counter)
+		total += snapshot[method]
+	}
+	snapshot["TOTAL"] = total
+	return snapshot
+}
+
+type countingRoundTripper struct {
+	counter *callCounter
+	next    http.RoundTripper
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.counter.inc(req.Method)
+	return c.next.RoundTrip(req)
+}
+
+func main() {
+	var clusters int
+	var namespace string
+	var useEnvtest bool
+	var crdDir string
+	var timeout time.Duration
+	var boundTokens bool
+	var cleanup bool
+	flag.IntVar(&clusters, "clusters", 100, "Number of synthetic HostedClusters to create.")
+	flag.StringVar(&namespace, "namespace", "hyper-ops-loadtest", "Namespace the synthetic HostedClusters are created in.")
+	flag.BoolVar(&useEnvtest, "envtest", false, "Start an envtest API server instead of using the cluster of the current kubeconfig.")
+	flag.StringVar(&crdDir, "crd-dir", filepath.Join("config", "crd", "bases"), "Directory with the HostedCluster CRD installed into envtest.")
+	flag.DurationVar(&timeout, "timeout", 10*time.Minute, "Time to wait for all clusters to be registered.")
+	flag.BoolVar(&boundTokens, "bound-tokens", true, "Run the reconciler with TokenRequest issued tokens.")
+	flag.BoolVar(&cleanup, "cleanup", true, "Delete the synthetic HostedClusters after the run, ignored with --envtest.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(redact.NewLogger(zap.New(zap.UseFlagOptions(&opts))))
+	log := ctrl.Log.WithName("loadtest")
+
+	if err := run(clusters, namespace, useEnvtest, crdDir, timeout, boundTokens, cleanup); err != nil {
+		log.Error(err, "load test failed")
+		os.Exit(1)
+	}
+}
+
+func run(clusters int, namespace string, useEnvtest bool, crdDir string, timeout time.Duration, boundTokens, cleanup bool) error {
+	log := ctrl.Log.WithName("loadtest")
+	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+	defer cancel()
+
+	var cfg *rest.Config
+	if useEnvtest {
+		testEnv := &envtest.Environment{
+			CRDDirectoryPaths:     []string{crdDir},
+			ErrorIfCRDPathMissing: true,
+		}
+		var err error
+		if cfg, err = testEnv.Start(); err != nil {
+			return fmt.Errorf("unable to start envtest: %w", err)
+		}
+		defer func() {
+			if err := testEnv.Stop(); err != nil {
+				log.Error(err, "unable to stop envtest")
+			}
+		}()
+		cleanup = false
+	} else {
+		var err error
+		if cfg, err = ctrl.GetConfig(); err != nil {
+			return err
+		}
+	}
+
+	if err := hypershiftv1beta1.AddToScheme(clientgoscheme.Scheme); err != nil {
+		return err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		return err
+	}
+
+	hostedCalls := &callCounter{counts: map[string]*int64{}}
+	proxy, err := newHostedClusterProxy(cfg, hostedCalls)
+	if err != nil {
+		return err
+	}
+	defer proxy.Close()
+
+	if err := prepare(ctx, c, cfg, namespace, useEnvtest); err != nil {
+		return err
+	}
+
+	// only the requests of the reconciler are counted against the management cluster
+	managementCalls := &callCounter{counts: map[string]*int64{}}
+	managerConfig := rest.CopyConfig(cfg)
+	managerConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &countingRoundTripper{counter: managementCalls, next: rt}
+	})
+	mgr, err := ctrl.NewManager(managerConfig, ctrl.Options{
+		Scheme:                 clientgoscheme.Scheme,
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		return err
+	}
+	reconciler := &controllers.HyperOpsReconciler{
+		Client:                 mgr.GetClient(),
+		Scheme:                 mgr.GetScheme(),
+		DefaultEnrollment:      controllers.DefaultEnrollmentEnabled,
+		DuplicateServerWinner:  controllers.DuplicateServerWinnerOldest,
+		TerminalStatePolicy:    controllers.TerminalStatePolicyRetry,
+		RefreshQPS:             controllers.DefaultRefreshQPS,
+		MaxConcurrentRefreshes: 1,
+		BoundTokens:            boundTokens,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return err
+	}
+	managerErr := make(chan error, 1)
+	go func() {
+		managerErr <- mgr.Start(ctx)
+	}()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		return errors.New("unable to sync the manager cache")
+	}
+
+	memory := &MemoryReport{}
+	stopSampling := sampleMemory(memory)
+
+	log.Info("creating synthetic HostedClusters", "clusters", clusters, "namespace", namespace)
+	start := time.Now()
+	for i := 0; i < clusters; i++ {
+		if err := createHostedCluster(ctx, c, namespace, fmt.Sprintf("loadtest-%d", i), proxy.URL); err != nil {
+			return err
+		}
+	}
+
+	registered := 0
+	err = wait.PollImmediateWithContext(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
+		secrets := &corev1.SecretList{}
+		if err := c.List(ctx, secrets, client.MatchingLabels{
+			"argocd.argoproj.io/secret-type": "cluster",
+			"hyper-ops.cloudmonkey.org/type": "hosted",
+		}); err != nil {
+			return false, err
+		}
+		registered = 0
+		for i := range secrets.Items {
+			if strings.HasPrefix(secrets.Items[i].Annotations[controllers.HostedClusterAnnotation], namespace+"/") {
+				registered++
+			}
+		}
+		log.V(1).Info("waiting for registrations", "registered", registered, "clusters", clusters)
+		return registered >= clusters, nil
+	})
+	duration := time.Since(start)
+	stopSampling()
+	if err != nil && !errors.Is(err, wait.ErrWaitTimeout) {
+		return err
+	}
+
+	report := Report{
+		Clusters:           clusters,
+		Registered:         registered,
+		Duration:           duration.Round(time.Millisecond).String(),
+		Throughput:         float64(registered) / duration.Seconds(),
+		Memory:             *memory,
+		ManagementCalls:    managementCalls.snapshot(),
+		HostedClusterCalls: hostedCalls.snapshot(),
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if cleanup {
+		log.Info("deleting synthetic HostedClusters", "namespace", namespace)
+		if err := c.DeleteAllOf(ctx, &hypershiftv1beta1.HostedCluster{}, client.InNamespace(namespace), client.MatchingLabels{loadTestLabel: "true"}); err != nil {
+			log.Error(err, "unable to delete the synthetic HostedClusters")
+		}
+		if err := c.DeleteAllOf(ctx, &corev1.Secret{}, client.InNamespace(namespace), client.MatchingLabels{loadTestLabel: "true"}); err != nil {
+			log.Error(err, "unable to delete the synthetic kubeconfig secrets")
+		}
+	}
+	cancel()
+	stopErr := <-managerErr
+	// an incomplete run measured nothing, it fails even if the manager stopped cleanly
+	if registered < clusters {
+		return fmt.Errorf("only %d of %d clusters were registered within %s", registered, clusters, timeout)
+	}
+	return stopErr
+}
+
+// prepare creates the namespaces used by the run. On envtest, which runs no token controller, the legacy token
+// secret of the hyper-ops service account is seeded with a TokenRequest issued token.
+func prepare(ctx context.Context, c client.Client, cfg *rest.Config, namespace string, seedToken bool) error {
+	for _, name := range []string{namespace, "openshift-gitops"} {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if err := c.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	if !seedToken {
+		return nil
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-admin", Namespace: "kube-system"}}
+	if err := c.Create(ctx, sa); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	expiration := int64((24 * time.Hour).Seconds())
+	token, err := clientset.CoreV1().ServiceAccounts(sa.Namespace).CreateToken(ctx, sa.Name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expiration},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to issue a token for %s: %w", sa.Name, err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "hyper-ops-admin-token",
+			Namespace:   sa.Namespace,
+			Annotations: map[string]string{corev1.ServiceAccountNameKey: sa.Name},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{
+			corev1.ServiceAccountTokenKey: []byte(token.Status.Token),
+			"ca.crt":                      cfg.CAData,
+		},
+	}
+	if err := c.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// createHostedCluster creates a synthetic HostedCluster and its admin kubeconfig secret
+func createHostedCluster(ctx context.Context, c client.Client, namespace, name, proxyURL string) error {
+	labels := map[string]string{loadTestLabel: "true"}
+	hc := &hypershiftv1beta1.HostedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: hypershiftv1beta1.HostedClusterSpec{
+			Release: hypershiftv1beta1.Release{
+				Image: "quay.io/openshift-release-dev/ocp-release:4.12.0-x86_64",
+			},
+			Etcd: hypershiftv1beta1.EtcdSpec{
+				ManagementType: hypershiftv1beta1.Managed,
+			},
+			Networking: hypershiftv1beta1.ClusterNetworking{
+				NetworkType: hypershiftv1beta1.OVNKubernetes,
+				ClusterNetwork: []hypershiftv1beta1.ClusterNetworkEntry{
+					{CIDR: *ipnet.MustParseCIDR("10.128.0.0/14"), HostPrefix: 23},
+				},
+			},
+			Platform: hypershiftv1beta1.PlatformSpec{
+				Type: hypershiftv1beta1.NonePlatform,
+			},
+			Services: []hypershiftv1beta1.ServicePublishingStrategyMapping{
+				{
+					Service: hypershiftv1beta1.APIServer,
+					ServicePublishingStrategy: hypershiftv1beta1.ServicePublishingStrategy{
+						Type: hypershiftv1beta1.LoadBalancer,
+					},
+				},
+			},
+		},
+	}
+	if err := c.Create(ctx, hc); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create HostedCluster %s: %w", name, err)
+	}
+	kubeconfig, err := syntheticKubeConfig(fmt.Sprintf("%s/clusters/%s/%s", proxyURL, namespace, name))
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-admin-kubeconfig", name),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{"kubeconfig": kubeconfig},
+	}
+	if err := c.Create(ctx, secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("unable to create kubeconfig secret of %s: %w", name, err)
+	}
+	return nil
+}
+
+// syntheticKubeConfig returns a kubeconfig for the server authenticating with the proxy placeholder token
+func syntheticKubeConfig(server string) ([]byte, error) {
+	kubeConfig := clientcmdapi.NewConfig()
+	kubeConfig.Clusters["cluster"] = &clientcmdapi.Cluster{
+		Server:                server,
+		InsecureSkipTLSVerify: true,
+	}
+	kubeConfig.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: proxyToken}
+	kubeConfig.Contexts["admin"] = &clientcmdapi.Context{Cluster: "cluster", AuthInfo: "admin"}
+	kubeConfig.CurrentContext = "admin"
+	return clientcmd.Write(*kubeConfig)
+}
+
+// newHostedClusterProxy starts a proxy serving /clusters/<namespace>/<name>/... from the management API server.
+// Requests with the placeholder token are sent with the management credentials, other tokens, e.g. the service
+// account tokens verified by hyper-ops, are passed through.
+func newHostedClusterProxy(cfg *rest.Config, counter *callCounter) (*httptest.Server, error) {
+	target, err := url.Parse(cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+	authenticated, err := rest.TransportFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	anonymousConfig := rest.AnonymousClientConfig(cfg)
+	anonymous, err := rest.TransportFor(anonymousConfig)
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			// strip the /clusters/<namespace>/<name> prefix
+			parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 4)
+			req.URL.Path = "/"
+			if len(parts) == 4 {
+				req.URL.Path += parts[3]
+			}
+			req.URL.RawPath = ""
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+		},
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			counter.inc(req.Method)
+			if req.Header.Get("Authorization") == "Bearer "+proxyToken {
+				req.Header.Del("Authorization")
+				return authenticated.RoundTrip(req)
+			}
+			return anonymous.RoundTrip(req)
+		}),
+	}
+	return httptest.NewTLSServer(proxy), nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// sampleMemory records the peak heap and goroutine usage until the returned function is called
+func sampleMemory(report *MemoryReport) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	sample := func() {
+		stats := runtime.MemStats{}
+		runtime.ReadMemStats(&stats)
+		if stats.HeapInuse > report.PeakHeapInuseBytes {
+			report.PeakHeapInuseBytes = stats.HeapInuse
+		}
+		if g := runtime.NumGoroutine(); g > report.PeakGoroutines {
+			report.PeakGoroutines = g
+		}
+		report.TotalAllocBytes = stats.TotalAlloc
+		report.NumGC = stats.NumGC
+	}
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				sample()
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
@@ -17,21 +17,38 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"fmt"
+	"net"
 	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
 	"github.com/cldmnky/hyper-ops/controllers"
+	"github.com/cldmnky/hyper-ops/pkg/archive"
+	"github.com/cldmnky/hyper-ops/pkg/redact"
+	"github.com/cldmnky/hyper-ops/pkg/regproxy"
 	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
 	//+kubebuilder:scaffold:imports
 )
@@ -44,6 +61,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(hypershiftv1beta1.AddToScheme(scheme))
+	utilruntime.Must(hyperopsv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -51,41 +69,1238 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var fleetReportInterval time.Duration
+	var startupReport bool
+	var fleetReportNamespace string
+	var archiveURL string
+	var defaultEnrollment string
+	var duplicateServerWinner string
+	var terminalStatePolicy string
+	var hostedClusterRole string
+	var authMode string
+	var awsRoleName string
+	var clusterNameSource string
+	var clusterNameTemplate string
+	var secretConflictPolicy string
+	var upgradePolicy string
+	var terminalStateTimeout time.Duration
+	var allowedGitOpsNamespaces string
+	var gitOpsNamespaceRoutesFlag string
+	var discoverArgoCDInstances bool
+	var argoCDInstanceSelectorFlag string
+	var manageAdmissionPolicy bool
+	var refreshQPS float64
+	var hostedClusterHeaders string
+	var discoveryLabelsFlag string
+	var maxConcurrentRefreshes int
+	var hostedClientPoolSize int
+	var hostedClientIdleTimeout time.Duration
+	var registrationProxyURL string
+	var registrationProxySigningKeyFile string
+	var registrationProxyCAFile string
+	var remoteHubKubeconfigFile string
+	var remoteHubKubeconfigSecret string
+	var boundTokens bool
+	var tokenAudiencesFlag string
+	var ciOutputsFlag string
+	var fluxConfig hyperopsv1alpha1.FluxConfig
+	var rancherFleetConfig hyperopsv1alpha1.RancherFleetConfig
+	var rancherFleetTokenTTL time.Duration
+	var acmManagedClusters bool
+	var acmConfig hyperopsv1alpha1.ACMConfig
+	var acmAutoImportRetry int
+	var karmadaConfig hyperopsv1alpha1.KarmadaConfig
+	var labelSchema controllers.LabelSchema
+	var labelSchemaMigrationInterval time.Duration
+	var migrateHostedClusterLabels bool
+	var topologyLabels bool
+	var workersLabel bool
+	var infraClusterName string
+	var dryRun bool
+	var dryRunReportInterval time.Duration
+	var freezeNamespace string
+	var consistencyCheckInterval time.Duration
+	var tokenTTL time.Duration
+	var tokenRenewBefore time.Duration
+	var tokenRotationInterval time.Duration
+	var consistencyRepair bool
+	var orphanReapInterval time.Duration
+	var orphanRevocationTimeout time.Duration
+	var inventoryRepository string
+	var inventoryBranch string
+	var inventoryPath string
+	var inventoryDeployKeySecret string
+	var inventoryInterval time.Duration
+	var deletionGracePeriod time.Duration
+	var maxCredentialAge time.Duration
+	var quarantineStaleCredentials bool
+	var tenantRBAC bool
+	var tenantScopedClusters bool
+	var clusterAppProjects string
+	var syncProjectDestinations bool
+	var egressNetworkPolicies bool
+	var clusterRegistrations bool
+	var offboardHostedRBAC bool
+	var localClusterInCluster bool
+	var clusterResources bool
+	var shards int
+	var maxRegistrationsPerNamespace int
+	var quotas []hyperopsv1alpha1.RegistrationQuota
+	var policies []*controllers.RegistrationPolicy
+	var agentPrincipalAddress string
+	var agentResourceProxyServer string
+	var agentImage string
+	var privateClusterConnectivity string
+	var standaloneGitOps controllers.StandaloneGitOps
+	var baselineManifestsConfigMap string
+	var baselineManifestsArtifact string
+	var platformApplication controllers.PlatformApplication
+	var baselineApplicationSet controllers.BaselineApplicationSet
+	var bootstrap controllers.BootstrapApplication
+	var hubUserAgent string
+	var hubClientLimitsFlag string
+	var configFile string
+	var operatorConfigWebhook bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&startupReport, "startup-report", true,
+		"Log the discrepancies between the ArgoCD cluster secrets and the HostedClusters on startup and write them to the hyper-ops-startup-report ConfigMap in --fleet-report-namespace.")
+	flag.DurationVar(&fleetReportInterval, "fleet-report-interval", 0,
+		"Interval at which a fleet report is written to a ConfigMap. A value of 0 disables the report.")
+	flag.StringVar(&fleetReportNamespace, "fleet-report-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace the fleet report ConfigMap is written to. Defaults to the namespace of the controller.")
+	flag.StringVar(&archiveURL, "archive-url", "",
+		"Keep the full change histories of the registrations and the fleet report outside of etcd, in a directory (file:///<dir>, e.g. a persistent volume) or an S3 compatible bucket (s3://<bucket>[/<prefix>]?endpoint=<url>&region=<region>). Only the last changes and the report summary are kept in the API.")
+	flag.StringVar(&defaultEnrollment, "default-enrollment", controllers.DefaultEnrollmentDisabled,
+		"Whether HostedClusters without the hyper-ops.cloudmonkey.org/enabled label are registered, one of enabled or disabled.")
+	flag.StringVar(&duplicateServerWinner, "duplicate-server-winner", controllers.DuplicateServerWinnerOldest,
+		"Which HostedCluster keeps the registration when several HostedClusters share a server URL, one of oldest or newest.")
+	flag.StringVar(&terminalStatePolicy, "terminal-state-policy", controllers.TerminalStatePolicyRetry,
+		"How HostedClusters in a terminal failure state are handled, one of retry, skip or deregister.")
+	flag.StringVar(&hostedClusterRole, "hosted-cluster-role", controllers.DefaultHostedClusterRole,
+		"The ClusterRole bound to the service account of hyper-ops in the hosted clusters. hyper-ops-gitops-deployer creates and binds the bundled least-privilege role.")
+	flag.StringVar(&authMode, "auth-mode", controllers.AuthModeServiceAccount,
+		"How ArgoCD authenticates to the hosted clusters, serviceAccount for a token of the hyper-ops service account, clientCertificate for the client certificate of the admin kubeconfig or awsExecProvider for argocd-k8s-auth aws on HostedClusters on AWS.")
+	flag.StringVar(&awsRoleName, "aws-role-name", "",
+		"IAM role argocd-k8s-auth assumes in the AWS account of HostedClusters with the awsExecProvider auth mode. The identity of the ArgoCD pods is used if empty.")
+	flag.StringVar(&clusterNameSource, "cluster-name-source", controllers.ClusterNameSourceName,
+		"What the ArgoCD clusters are named after, one of name, infraID or template.")
+	flag.StringVar(&clusterNameTemplate, "cluster-name-template", "",
+		"The text/template the names of the ArgoCD clusters are rendered from with --cluster-name-source=template, e.g. {{.Namespace}}-{{.Name}}-{{.InfraID}}.")
+	flag.StringVar(&secretConflictPolicy, "secret-conflict-policy", controllers.SecretConflictPolicySkip,
+		"What happens to an existing ArgoCD cluster secret not created by hyper-ops, one of skip, fail or adopt.")
+	flag.StringVar(&upgradePolicy, "upgrade-policy", controllers.UpgradePolicyIgnore,
+		"How GitOps treats HostedClusters rolling out a new release, one of ignore, flag to label their ArgoCD cluster secrets with hyper-ops.cloudmonkey.org/upgrading=true, or pause to also pause the automated sync of their bootstrap Application until the rollout completed.")
+	flag.DurationVar(&terminalStateTimeout, "terminal-state-timeout", controllers.DefaultTerminalStateTimeout,
+		"Time a HostedCluster may be in a terminal failure state before the deregister policy removes its registration.")
+	flag.StringVar(&allowedGitOpsNamespaces, "allowed-gitops-namespaces", "",
+		"Comma separated list of gitops namespaces registrations may be written to. All namespaces are allowed if empty.")
+	flag.StringVar(&gitOpsNamespaceRoutesFlag, "gitops-namespace-routes", "",
+		"Semicolon separated list of <selector>:<namespace> routes registering HostedClusters without the gitops namespace label by their labels, the first match wins.")
+	flag.BoolVar(&discoverArgoCDInstances, "discover-argocd-instances", false,
+		"Register HostedClusters selecting ArgoCD instances into the namespaces of the ArgoCD CRs matching their selector.")
+	flag.StringVar(&argoCDInstanceSelectorFlag, "argocd-instance-selector", "",
+		"Label selector of the ArgoCD CRs HostedClusters without the gitops namespace label or an instance selector annotation are registered into, requires --discover-argocd-instances.")
+	flag.BoolVar(&manageAdmissionPolicy, "manage-admission-policy", false,
+		"Maintain a ValidatingAdmissionPolicy enforcing the hyper-ops label contract on HostedClusters.")
+	flag.Float64Var(&refreshQPS, "refresh-qps", controllers.DefaultRefreshQPS,
+		"Rate at which steady state refreshes of healthy registrations are processed. New and failing registrations are not throttled.")
+	flag.IntVar(&maxConcurrentRefreshes, "max-concurrent-refreshes", 1,
+		"Number of steady state refreshes processed concurrently.")
+	flag.IntVar(&hostedClientPoolSize, "hosted-client-pool-size", 0,
+		"Maximum number of hosted cluster clients kept alive between reconciles, the least recently used are evicted first. A client is created per reconcile if zero.")
+	flag.DurationVar(&hostedClientIdleTimeout, "hosted-client-idle-timeout", 10*time.Minute,
+		"Time a pooled hosted cluster client may be unused before it is evicted, zero keeps idle clients.")
+	flag.StringVar(&hostedClusterHeaders, "hosted-cluster-headers", "",
+		"Comma separated list of key=value HTTP headers added to every request against hosted clusters.")
+	flag.StringVar(&discoveryLabelsFlag, "discovery-labels", "",
+		"Comma separated list of <namespace>/<key>=<value> labels added to the ArgoCD cluster secrets in a gitops namespace, * selects every namespace.")
+	flag.StringVar(&registrationProxyURL, "registration-proxy-url", "",
+		"URL of a registration proxy running in the gitops cluster. When set, ArgoCD cluster secrets are sent to the proxy instead of written locally.")
+	flag.StringVar(&registrationProxySigningKeyFile, "registration-proxy-signing-key-file", "",
+		"File containing the shared key used to sign registration proxy payloads.")
+	flag.StringVar(&registrationProxyCAFile, "registration-proxy-ca-file", "",
+		"File containing the CA bundle used to verify the registration proxy certificate.")
+	flag.StringVar(&remoteHubKubeconfigFile, "remote-hub-kubeconfig", "",
+		"Kubeconfig of a hub cluster running ArgoCD. When set, ArgoCD cluster secrets are written to the hub instead of locally.")
+	flag.StringVar(&remoteHubKubeconfigSecret, "remote-hub-kubeconfig-secret", "",
+		"<namespace>/<name> of a secret holding the kubeconfig of a hub cluster running ArgoCD in its kubeconfig key, alternative to --remote-hub-kubeconfig.")
+	flag.BoolVar(&boundTokens, "bound-tokens", true,
+		"Register hosted clusters with short-lived TokenRequest issued tokens, migrating registrations from legacy service account token secrets. "+
+			"Disabling it falls back to the deprecated legacy token secrets.")
+	flag.DurationVar(&tokenTTL, "token-ttl", 24*time.Hour,
+		"Requested lifetime of bound tokens.")
+	flag.DurationVar(&tokenRenewBefore, "token-renew-before", 8*time.Hour,
+		"Remaining lifetime at which bound tokens are renewed.")
+	flag.DurationVar(&maxCredentialAge, "max-credential-age", 0,
+		"Age at which a credential that was not rotated, e.g. because its renewal kept failing, is flagged with the CredentialMaxAgeExceeded condition, 0 disables the check.")
+	flag.BoolVar(&quarantineStaleCredentials, "quarantine-stale-credentials", false,
+		"Withdraw registrations whose credential exceeded --max-credential-age until a newer credential is obtained.")
+	flag.DurationVar(&tokenRotationInterval, "token-rotation-interval", controllers.DefaultTokenRotationInterval,
+		"Interval at which the ArgoCD cluster secrets are checked for bound tokens that missed their renewal, 0 disables the check.")
+	flag.StringVar(&tokenAudiencesFlag, "token-audiences", "",
+		"Comma separated list of [<namespace>/]<name>=<audience> consumers getting bound tokens of their own audience in separate secrets. Requires --bound-tokens.")
+	flag.StringVar(&ciOutputsFlag, "ci-outputs", "",
+		"Comma separated list of <type>=<namespace> CI outputs writing kubeconfig secrets of the registered hosted clusters, the type is tekton or argo-workflows.")
+	flag.StringVar(&fluxConfig.Namespace, "flux-namespace", "",
+		"Namespace to write a kubeconfig secret, GitRepository and Kustomization of every registered hosted cluster to, so Flux deploys to it. Empty disables the Flux registration.")
+	flag.StringVar(&fluxConfig.URL, "flux-git-url", "",
+		"Template of the URL of the git repository Flux deploys the hosted clusters from, requires --flux-namespace.")
+	flag.StringVar(&fluxConfig.Branch, "flux-git-branch", controllers.DefaultFluxBranch,
+		"Template of the branch of the git repository Flux deploys the hosted clusters from.")
+	flag.StringVar(&fluxConfig.Path, "flux-path", controllers.DefaultFluxPath,
+		"Template of the path of the manifests of a hosted cluster in the git repository.")
+	flag.StringVar(&fluxConfig.SecretRef, "flux-git-secret", "",
+		"Name of the secret in --flux-namespace holding the credentials of the git repository.")
+	flag.StringVar(&rancherFleetConfig.Workspace, "rancher-fleet-workspace", "",
+		"Fleet workspace to create a Cluster, kubeconfig secret and ClusterRegistrationToken of every registered hosted cluster in, e.g. fleet-default. Empty disables the Rancher Fleet registration.")
+	flag.DurationVar(&rancherFleetTokenTTL, "rancher-fleet-registration-token-ttl", controllers.DefaultRancherFleetRegistrationTokenTTL,
+		"Time to live of the Fleet ClusterRegistrationTokens of the hosted clusters.")
+	flag.BoolVar(&acmManagedClusters, "acm-managed-clusters", false,
+		"Create a ManagedCluster and an auto-import secret for every registered hosted cluster, so ACM imports it.")
+	flag.StringVar(&acmConfig.ClusterSet, "acm-cluster-set", "",
+		"ManagedClusterSet the ManagedClusters of the hosted clusters are added to, requires --acm-managed-clusters.")
+	flag.IntVar(&acmAutoImportRetry, "acm-auto-import-retry", controllers.DefaultACMAutoImportRetry,
+		"Number of times ACM retries a failed import of a hosted cluster.")
+	flag.StringVar(&karmadaConfig.KubeconfigSecret, "karmada-kubeconfig-secret", "",
+		"<namespace>/<name> of a secret holding the kubeconfig of a Karmada API server in its kubeconfig key. When set, every registered hosted cluster joins Karmada in push mode. Empty disables the Karmada registration.")
+	flag.StringVar(&karmadaConfig.Namespace, "karmada-namespace", controllers.DefaultKarmadaNamespace,
+		"Namespace of the Karmada control plane the cluster secrets of the hosted clusters are written to.")
+	flag.StringVar(&labelSchema.Version, "label-schema", controllers.LabelSchemaV1,
+		"Schema the hyper-ops labels are written in, v1 (hyper-ops.cloudmonkey.org/) or v2 (v2.hyper-ops.cloudmonkey.org/). Labels of every schema are read.")
+	flag.BoolVar(&labelSchema.KeepPrevious, "keep-previous-label-schema", false,
+		"Also write the hyper-ops labels in the previous schema, while label selectors are moved to the new one.")
+	flag.DurationVar(&labelSchemaMigrationInterval, "label-schema-migration-interval", 0,
+		"Interval at which the labels of the existing ArgoCD cluster secrets are rewritten in --label-schema. A value of 0 disables the migration.")
+	flag.BoolVar(&migrateHostedClusterLabels, "label-schema-migrate-hostedclusters", false,
+		"Also rewrite the labels of the HostedClusters in --label-schema. Leave it off if the HostedClusters are labeled by a GitOps or IaC tool, which would revert the migration.")
+	flag.BoolVar(&topologyLabels, "topology-labels", false,
+		"Label ArgoCD cluster secrets with the NodePool replicas, platforms and node architectures of the hosted cluster.")
+	flag.BoolVar(&workersLabel, "workers-label", false,
+		"Label ArgoCD cluster secrets with workers=false until a NodePool of the hosted cluster has nodes.")
+	flag.StringVar(&infraClusterName, "infra-cluster-name", "",
+		"Name of the management cluster, added to the topology labels of KubeVirt hosted clusters whose VMs run on it.")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"Record the changes to ArgoCD cluster secrets in a dry-run report ConfigMap instead of applying them.")
+	flag.DurationVar(&dryRunReportInterval, "dry-run-report-interval", time.Minute,
+		"Interval at which the dry-run report is written to the fleet report namespace.")
+	flag.StringVar(&freezeNamespace, "freeze-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the hyper-ops-freeze ConfigMap putting the operator into read-only mode until its expiresAt. Defaults to the namespace of the controller, an empty namespace disables the freeze.")
+	flag.DurationVar(&deletionGracePeriod, "deletion-grace-period", 0,
+		"Period deregistered ArgoCD cluster secrets are kept, hidden from ArgoCD, before they are deleted. A value of 0 deletes them immediately.")
+	flag.BoolVar(&egressNetworkPolicies, "egress-network-policies", false,
+		"Maintain NetworkPolicies in the gitops namespaces allowing the ArgoCD pods to reach the registered hosted control planes.")
+	flag.BoolVar(&clusterRegistrations, "cluster-registrations", false,
+		"Maintain a ClusterRegistration in the namespace of every enrolled HostedCluster recording its registration.")
+	flag.IntVar(&maxRegistrationsPerNamespace, "max-registrations-per-namespace", 0,
+		"Number of HostedClusters of a namespace that may be registered, further HostedClusters wait for a free slot. A value of 0 disables the quota.")
+	flag.BoolVar(&localClusterInCluster, "local-cluster-in-cluster", false,
+		"Register the management cluster without credentials so ArgoCD uses its own service account, no token secret is kept in kube-system.")
+	flag.IntVar(&shards, "shards", 0,
+		"Number of application controller shards the ArgoCD clusters are spread over, written to the shard key of the cluster secrets. A value of 0 lets the application controller assign the shards.")
+	flag.BoolVar(&clusterResources, "cluster-resources", false,
+		"Let ArgoCD manage cluster scoped resources of namespace scoped clusters whose HostedCluster doesn't set the cluster-resources annotation.")
+	flag.BoolVar(&offboardHostedRBAC, "offboard-hosted-rbac", false,
+		"Also remove the service account of hyper-ops from hosted clusters labeled enabled=false when they are offboarded.")
+	flag.BoolVar(&tenantRBAC, "tenant-rbac", false,
+		"Maintain ArgoCD RBAC policies granting the groups of the tenant-groups annotation access to their hosted cluster.")
+	flag.BoolVar(&tenantScopedClusters, "tenant-scoped-clusters", false,
+		"Scope the ArgoCD clusters of HostedClusters with tenant groups to their tenant AppProject, the project annotation of a HostedCluster wins.")
+	flag.StringVar(&clusterAppProjects, "cluster-app-projects", "",
+		"Create an AppProject deploying only to the registered clusters per HostedCluster (cluster) or per tenant project (tenant).")
+	flag.BoolVar(&syncProjectDestinations, "sync-project-destinations", false,
+		"Add the servers of registrations to the destinations of the AppProjects they name and remove them on deregistration.")
+	flag.StringVar(&agentPrincipalAddress, "agent-principal-address", "",
+		"host:port of the principal the agents of outbound-only hosted clusters dial.")
+	flag.StringVar(&agentResourceProxyServer, "agent-resource-proxy-server", "",
+		"URL of the resource proxy of the principal, ArgoCD reaches outbound-only hosted clusters through it.")
+	flag.StringVar(&agentImage, "agent-image", controllers.DefaultAgentImage,
+		"Image of the agent installed into outbound-only hosted clusters.")
+	flag.StringVar(&privateClusterConnectivity, "private-cluster-connectivity", controllers.ConnectivityDirect,
+		"Connectivity of hosted clusters with private endpoint access and without the connectivity annotation, direct or outbound-only.")
+	flag.StringVar(&standaloneGitOps.Installer, "standalone-installer", controllers.StandaloneInstallerOpenShiftGitOps,
+		"How ArgoCD is installed into hosted clusters in the standalone gitops mode, openshift-gitops or manifests.")
+	flag.StringVar(&standaloneGitOps.Channel, "standalone-channel", controllers.DefaultStandaloneChannel,
+		"Channel of the OpenShift GitOps operator subscription of standalone hosted clusters.")
+	flag.StringVar(&standaloneGitOps.ManifestsURL, "standalone-manifests-url", controllers.DefaultStandaloneManifestsURL,
+		"URL of the ArgoCD install manifests applied to standalone hosted clusters by the manifests installer.")
+	flag.StringVar(&baselineManifestsConfigMap, "baseline-manifests-configmap", "",
+		"<namespace>/<name> of a ConfigMap whose .yaml, .yml and .json keys are applied into every hosted cluster after its registration.")
+	flag.StringVar(&baselineManifestsArtifact, "baseline-manifests-oci", "",
+		"Reference of an OCI artifact whose YAML layers are applied into every hosted cluster after its registration.")
+	flag.DurationVar(&consistencyCheckInterval, "consistency-check-interval", 0,
+		"Interval at which ArgoCD cluster secrets created by hyper-ops are checked for inconsistencies. A value of 0 disables the check.")
+	flag.BoolVar(&consistencyRepair, "consistency-repair", false,
+		"Delete orphaned and stale ArgoCD cluster secrets found by the consistency check instead of only reporting them.")
+	flag.DurationVar(&orphanReapInterval, "orphan-reap-interval", 0,
+		"Interval at which the registrations of HostedClusters that disappeared without deregistration, e.g. with a force-deleted namespace, have their token revoked and are deleted. A value of 0 disables the reaper.")
+	flag.DurationVar(&orphanRevocationTimeout, "orphan-revocation-timeout", controllers.DefaultOrphanRevocationTimeout,
+		"Time the token revocation of an orphaned registration is retried before the registration is deleted anyway.")
+	flag.StringVar(&inventoryRepository, "inventory-repository", "",
+		"URL of a git repository the cluster inventory is committed to, the inventory is not written if empty. Requires git on the PATH.")
+	flag.StringVar(&inventoryBranch, "inventory-branch", controllers.DefaultInventoryBranch,
+		"Existing branch of the inventory repository the cluster inventory is committed to.")
+	flag.StringVar(&inventoryPath, "inventory-path", controllers.DefaultInventoryPath,
+		"Path of the cluster inventory file in the inventory repository.")
+	flag.StringVar(&inventoryDeployKeySecret, "inventory-deploy-key-secret", "",
+		"Name of the secret in the operator namespace holding the SSH deploy key (sshPrivateKey) and known hosts (knownHosts) of the inventory repository.")
+	flag.DurationVar(&inventoryInterval, "inventory-interval", controllers.DefaultInventoryInterval,
+		"Interval at which the cluster inventory is written to the inventory repository.")
+	flag.StringVar(&platformApplication.RepoURL, "platform-repo-url", "",
+		"Git repository of the HyperShift operator manifests. When set, an ArgoCD Application deploying them to the management cluster is maintained.")
+	flag.StringVar(&platformApplication.Path, "platform-path", "",
+		"Path of the HyperShift operator manifests within the platform repository.")
+	flag.StringVar(&platformApplication.TargetRevision, "platform-revision", controllers.DefaultPlatformRevision,
+		"Git revision of the platform repository deployed to the management cluster.")
+	flag.StringVar(&platformApplication.Namespace, "platform-namespace", controllers.DefaultPlatformNamespace,
+		"Namespace on the management cluster the HyperShift operator manifests are deployed to.")
+	flag.BoolVar(&platformApplication.AutoSync, "platform-auto-sync", false,
+		"Automatically sync, prune and self heal the platform Application.")
+	flag.StringVar(&baselineApplicationSet.RepoURL, "baseline-repo-url", "",
+		"Git repository of the baseline every registered hosted cluster receives. When set, an ApplicationSet generating an Application per hosted cluster is created.")
+	flag.StringVar(&baselineApplicationSet.Path, "baseline-path", "",
+		"Path of the baseline within the baseline repository, ApplicationSet parameters such as {{name}} are substituted per cluster.")
+	flag.StringVar(&baselineApplicationSet.TargetRevision, "baseline-revision", controllers.DefaultPlatformRevision,
+		"Git revision of the baseline repository deployed to the hosted clusters.")
+	flag.StringVar(&baselineApplicationSet.Namespace, "baseline-namespace", "",
+		"Namespace on the hosted clusters the baseline is deployed to.")
+	flag.StringVar(&baselineApplicationSet.Project, "baseline-project", controllers.DefaultBaselineProject,
+		"AppProject of the baseline Applications.")
+	flag.BoolVar(&baselineApplicationSet.AutoSync, "baseline-auto-sync", false,
+		"Automatically sync, prune and self heal the baseline Applications.")
+	flag.BoolVar(&baselineApplicationSet.Maintain, "baseline-maintain", false,
+		"Revert changes to the baseline ApplicationSet. Otherwise it is only created if missing and then left to its users.")
+	flag.StringVar(&bootstrap.RepoURL, "bootstrap-repo-url", "",
+		"Git repository of the root Application of an app-of-apps. When set, a root Application is created for every registered hosted cluster.")
+	flag.StringVar(&bootstrap.Path, "bootstrap-path", "",
+		"Path of the root Application within the bootstrap repository, {{name}} and {{server}} are replaced per cluster.")
+	flag.StringVar(&bootstrap.TargetRevision, "bootstrap-revision", controllers.DefaultPlatformRevision,
+		"Git revision of the bootstrap repository deployed to the hosted clusters.")
+	flag.BoolVar(&bootstrap.AutoSync, "bootstrap-auto-sync", false,
+		"Automatically sync, prune and self heal the root Applications.")
+	flag.StringVar(&hubUserAgent, "hub-user-agent", controllers.DefaultHubUserAgent(),
+		"User agent of the requests to the hub API server, the subsystem sending them is appended.")
+	flag.StringVar(&hubClientLimitsFlag, "hub-client-limits", "",
+		"Client side rate limits of the subsystems talking to the hub API server, a list of <subsystem>=<qps>[:<burst>] with the subsystems registrar, rotation, gc and health.")
+	flag.StringVar(&configFile, "config", "",
+		"The HyperOpsOperatorConfig file. Settings in the file take precedence over the corresponding flags.")
+	flag.BoolVar(&operatorConfigWebhook, "operator-config-webhook", false,
+		"Serve the validating admission webhook rejecting ConfigMaps labeled hyper-ops.cloudmonkey.org/operator-config=true whose operator config would be rejected on reload. Requires a serving certificate in the webhook certificate directory.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	ctrl.SetLogger(redact.NewLogger(zap.New(zap.UseFlagOptions(&opts))))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var allowedNamespaces []string
+	if allowedGitOpsNamespaces != "" {
+		allowedNamespaces = strings.Split(allowedGitOpsNamespaces, ",")
+	}
+
+	headers := map[string]string{}
+	for _, h := range strings.Split(hostedClusterHeaders, ",") {
+		if h == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(h, "=")
+		if !ok {
+			setupLog.Error(fmt.Errorf("invalid header %q", h), "--hosted-cluster-headers must be a list of key=value pairs")
+			os.Exit(1)
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	discoveryLabels, err := controllers.ParseDiscoveryLabels(discoveryLabelsFlag)
+	if err != nil {
+		setupLog.Error(err, "--discovery-labels must be a list of <namespace>/<key>=<value> labels")
+		os.Exit(1)
+	}
+
+	gitOpsNamespaceRoutes, err := controllers.ParseGitOpsNamespaceRoutes(gitOpsNamespaceRoutesFlag)
+	if err != nil {
+		setupLog.Error(err, "--gitops-namespace-routes must be a list of <selector>:<namespace> routes")
+		os.Exit(1)
+	}
+
+	var argoCDInstanceSelector labels.Selector
+	if argoCDInstanceSelectorFlag != "" {
+		if argoCDInstanceSelector, err = labels.Parse(argoCDInstanceSelectorFlag); err != nil {
+			setupLog.Error(err, "--argocd-instance-selector must be a label selector")
+			os.Exit(1)
+		}
+	}
+
+	tokenAudiences, err := controllers.ParseTokenAudiences(tokenAudiencesFlag)
+	if err != nil {
+		setupLog.Error(err, "--token-audiences must be a list of [<namespace>/]<name>=<audience> consumers")
+		os.Exit(1)
+	}
+
+	ciOutputs, err := controllers.ParseCIOutputs(ciOutputsFlag)
+	if err != nil {
+		setupLog.Error(err, "--ci-outputs must be a list of <type>=<namespace> outputs")
+		os.Exit(1)
+	}
+
+	hubClientLimits, err := controllers.ParseHubClientLimits(hubClientLimitsFlag)
+	if err != nil {
+		setupLog.Error(err, "--hub-client-limits must be a list of <subsystem>=<qps>[:<burst>] limits")
+		os.Exit(1)
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "ac3de5fc.cloudmonkey.org",
-	})
+	}
+	// the hot reloadable settings given by the flags, a reloaded config file is applied on top of them
+	runtimeDefaults := controllers.RuntimeConfig{
+		DuplicateServerWinner: duplicateServerWinner,
+		TerminalStatePolicy:   terminalStatePolicy,
+		SecretConflictPolicy:  secretConflictPolicy,
+		UpgradePolicy:         upgradePolicy,
+		TerminalStateTimeout:  terminalStateTimeout,
+		HostedClusterHeaders:  headers,
+	}
+	if maxRegistrationsPerNamespace > 0 {
+		runtimeDefaults.Quotas = []hyperopsv1alpha1.RegistrationQuota{{Name: "namespace", Max: maxRegistrationsPerNamespace}}
+	}
+	if configFile != "" {
+		operatorConfig := hyperopsv1alpha1.HyperOpsOperatorConfig{}
+		var err error
+		options, err = options.AndFrom(ctrl.ConfigFile().AtPath(configFile).OfKind(&operatorConfig))
+		if err != nil {
+			setupLog.Error(err, "unable to load the config file")
+			os.Exit(1)
+		}
+		registration := operatorConfig.Registration
+		if registration.DefaultEnrollment != "" {
+			defaultEnrollment = registration.DefaultEnrollment
+		}
+		if registration.DuplicateServerWinner != "" {
+			duplicateServerWinner = registration.DuplicateServerWinner
+		}
+		if registration.TerminalStatePolicy != "" {
+			terminalStatePolicy = registration.TerminalStatePolicy
+		}
+		if registration.HostedClusterRole != "" {
+			hostedClusterRole = registration.HostedClusterRole
+		}
+		if registration.AuthMode != "" {
+			authMode = registration.AuthMode
+		}
+		if registration.AWSRoleName != "" {
+			awsRoleName = registration.AWSRoleName
+		}
+		if registration.ClusterNameSource != "" {
+			clusterNameSource = registration.ClusterNameSource
+		}
+		if registration.ClusterNameTemplate != "" {
+			clusterNameTemplate = registration.ClusterNameTemplate
+		}
+		if registration.SecretConflictPolicy != "" {
+			secretConflictPolicy = registration.SecretConflictPolicy
+		}
+		if registration.UpgradePolicy != "" {
+			upgradePolicy = registration.UpgradePolicy
+		}
+		if registration.TerminalStateTimeout != nil {
+			terminalStateTimeout = registration.TerminalStateTimeout.Duration
+		}
+		if registration.AllowedGitOpsNamespaces != nil {
+			allowedNamespaces = registration.AllowedGitOpsNamespaces
+		}
+		if registration.GitOpsNamespaceRoutes != nil {
+			if gitOpsNamespaceRoutes, err = controllers.CompileGitOpsNamespaceRoutes(registration.GitOpsNamespaceRoutes); err != nil {
+				setupLog.Error(err, "invalid gitops namespace routes in the config file")
+				os.Exit(1)
+			}
+		}
+		if registration.HostedClusterHeaders != nil {
+			headers = registration.HostedClusterHeaders
+		}
+		if registration.DiscoveryLabels != nil {
+			if err := controllers.ValidateDiscoveryLabels(registration.DiscoveryLabels); err != nil {
+				setupLog.Error(err, "invalid discovery labels in the config file")
+				os.Exit(1)
+			}
+			discoveryLabels = registration.DiscoveryLabels
+		}
+		if registration.Shards != 0 {
+			shards = registration.Shards
+		}
+		if registration.ClusterResources != nil {
+			clusterResources = *registration.ClusterResources
+		}
+		if registration.BoundTokens != nil {
+			boundTokens = *registration.BoundTokens
+		}
+		if registration.TokenAudiences != nil {
+			if err := controllers.ValidateTokenAudiences(registration.TokenAudiences); err != nil {
+				setupLog.Error(err, "invalid token audiences in the config file")
+				os.Exit(1)
+			}
+			tokenAudiences = registration.TokenAudiences
+		}
+		if registration.CIOutputs != nil {
+			if err := controllers.ValidateCIOutputs(registration.CIOutputs); err != nil {
+				setupLog.Error(err, "invalid CI outputs in the config file")
+				os.Exit(1)
+			}
+			ciOutputs = registration.CIOutputs
+		}
+		if registration.Flux != nil {
+			fluxConfig = *registration.Flux
+		}
+		if registration.RancherFleet != nil {
+			rancherFleetConfig = *registration.RancherFleet
+		}
+		if registration.ACM != nil {
+			acmManagedClusters = true
+			acmConfig = *registration.ACM
+		}
+		if registration.Karmada != nil {
+			karmadaConfig = *registration.Karmada
+		}
+		if s := registration.LabelSchema; s != nil {
+			if s.Version != "" {
+				labelSchema.Version = s.Version
+			}
+			if s.KeepPrevious != nil {
+				labelSchema.KeepPrevious = *s.KeepPrevious
+			}
+			if s.MigrationInterval != nil {
+				labelSchemaMigrationInterval = s.MigrationInterval.Duration
+			}
+			if s.MigrateHostedClusters != nil {
+				migrateHostedClusterLabels = *s.MigrateHostedClusters
+			}
+		}
+		if registration.TopologyLabels != nil {
+			topologyLabels = *registration.TopologyLabels
+		}
+		if registration.WorkersLabel != nil {
+			workersLabel = *registration.WorkersLabel
+		}
+		if registration.Quotas != nil {
+			if err := controllers.ValidateRegistrationQuotas(registration.Quotas); err != nil {
+				setupLog.Error(err, "invalid registration quotas in the config file")
+				os.Exit(1)
+			}
+			quotas = registration.Quotas
+		}
+		if registration.InfraClusterName != "" {
+			infraClusterName = registration.InfraClusterName
+		}
+		if registration.DeletionGracePeriod != nil {
+			deletionGracePeriod = registration.DeletionGracePeriod.Duration
+		}
+		if registration.MaxCredentialAge != nil {
+			maxCredentialAge = registration.MaxCredentialAge.Duration
+		}
+		if registration.QuarantineStaleCredentials != nil {
+			quarantineStaleCredentials = *registration.QuarantineStaleCredentials
+		}
+		if registration.EgressNetworkPolicies != nil {
+			egressNetworkPolicies = *registration.EgressNetworkPolicies
+		}
+		if registration.ClusterRegistrations != nil {
+			clusterRegistrations = *registration.ClusterRegistrations
+		}
+		if registration.LocalClusterInCluster != nil {
+			localClusterInCluster = *registration.LocalClusterInCluster
+		}
+		if registration.OffboardHostedRBAC != nil {
+			offboardHostedRBAC = *registration.OffboardHostedRBAC
+		}
+		if registration.TenantRBAC != nil {
+			tenantRBAC = *registration.TenantRBAC
+		}
+		if registration.TenantScopedClusters != nil {
+			tenantScopedClusters = *registration.TenantScopedClusters
+		}
+		if registration.ClusterAppProjects != "" {
+			clusterAppProjects = registration.ClusterAppProjects
+		}
+		if registration.SyncProjectDestinations != nil {
+			syncProjectDestinations = *registration.SyncProjectDestinations
+		}
+		if registration.DiscoverArgoCDInstances != nil {
+			discoverArgoCDInstances = *registration.DiscoverArgoCDInstances
+		}
+		if registration.ArgoCDInstanceSelector != nil {
+			if argoCDInstanceSelector, err = controllers.CompileArgoCDInstanceSelector(registration.ArgoCDInstanceSelector); err != nil {
+				setupLog.Error(err, "invalid ArgoCD instance selector in the config file")
+				os.Exit(1)
+			}
+		}
+		if policies, err = controllers.CompilePolicies(registration.Policies); err != nil {
+			setupLog.Error(err, "invalid registration policies")
+			os.Exit(1)
+		}
+		if registration.AgentPrincipalAddress != "" {
+			agentPrincipalAddress = registration.AgentPrincipalAddress
+		}
+		if registration.AgentResourceProxyServer != "" {
+			agentResourceProxyServer = registration.AgentResourceProxyServer
+		}
+		if registration.AgentImage != "" {
+			agentImage = registration.AgentImage
+		}
+		if registration.PrivateClusterConnectivity != "" {
+			privateClusterConnectivity = registration.PrivateClusterConnectivity
+		}
+		if registration.StandaloneInstaller != "" {
+			standaloneGitOps.Installer = registration.StandaloneInstaller
+		}
+		if registration.StandaloneChannel != "" {
+			standaloneGitOps.Channel = registration.StandaloneChannel
+		}
+		if registration.StandaloneManifestsURL != "" {
+			standaloneGitOps.ManifestsURL = registration.StandaloneManifestsURL
+		}
+		if registration.BaselineManifestsConfigMap != "" {
+			baselineManifestsConfigMap = registration.BaselineManifestsConfigMap
+		}
+		if registration.BaselineManifestsOCIArtifact != "" {
+			baselineManifestsArtifact = registration.BaselineManifestsOCIArtifact
+		}
+		if registration.ManageAdmissionPolicy != nil {
+			manageAdmissionPolicy = *registration.ManageAdmissionPolicy
+		}
+		if operatorConfig.Refresh.QPS != nil {
+			refreshQPS = *operatorConfig.Refresh.QPS
+		}
+		if operatorConfig.Refresh.MaxConcurrentRefreshes != nil {
+			maxConcurrentRefreshes = *operatorConfig.Refresh.MaxConcurrentRefreshes
+		}
+		if proxy := operatorConfig.RegistrationProxy; proxy != nil {
+			registrationProxyURL = proxy.URL
+			registrationProxySigningKeyFile = proxy.SigningKeyFile
+			registrationProxyCAFile = proxy.CAFile
+		}
+		if hub := operatorConfig.RemoteHub; hub != nil {
+			remoteHubKubeconfigFile = hub.KubeconfigFile
+			remoteHubKubeconfigSecret = hub.KubeconfigSecret
+		}
+		if operatorConfig.FleetReport.Interval != nil {
+			fleetReportInterval = operatorConfig.FleetReport.Interval.Duration
+		}
+		if operatorConfig.FleetReport.Namespace != "" {
+			fleetReportNamespace = operatorConfig.FleetReport.Namespace
+		}
+		if operatorConfig.ArchiveURL != "" {
+			archiveURL = operatorConfig.ArchiveURL
+		}
+		if operatorConfig.ConsistencyCheck.Interval != nil {
+			consistencyCheckInterval = operatorConfig.ConsistencyCheck.Interval.Duration
+		}
+		if operatorConfig.ConsistencyCheck.Repair != nil {
+			consistencyRepair = *operatorConfig.ConsistencyCheck.Repair
+		}
+		if operatorConfig.OrphanReaper.Interval != nil {
+			orphanReapInterval = operatorConfig.OrphanReaper.Interval.Duration
+		}
+		if operatorConfig.OrphanReaper.RevocationTimeout != nil {
+			orphanRevocationTimeout = operatorConfig.OrphanReaper.RevocationTimeout.Duration
+		}
+		if inventory := operatorConfig.Inventory; inventory.Repository != "" {
+			inventoryRepository = inventory.Repository
+			if inventory.Branch != "" {
+				inventoryBranch = inventory.Branch
+			}
+			if inventory.Path != "" {
+				inventoryPath = inventory.Path
+			}
+			if inventory.DeployKeySecret != "" {
+				inventoryDeployKeySecret = inventory.DeployKeySecret
+			}
+			if inventory.Interval != nil {
+				inventoryInterval = inventory.Interval.Duration
+			}
+		}
+		if operatorConfig.TokenRotation.TTL != nil {
+			tokenTTL = operatorConfig.TokenRotation.TTL.Duration
+		}
+		if operatorConfig.TokenRotation.RenewBefore != nil {
+			tokenRenewBefore = operatorConfig.TokenRotation.RenewBefore.Duration
+		}
+		if operatorConfig.TokenRotation.Interval != nil {
+			tokenRotationInterval = operatorConfig.TokenRotation.Interval.Duration
+		}
+		if operatorConfig.DryRun.Enabled != nil {
+			dryRun = *operatorConfig.DryRun.Enabled
+		}
+		if operatorConfig.DryRun.ReportInterval != nil {
+			dryRunReportInterval = operatorConfig.DryRun.ReportInterval.Duration
+		}
+		if operatorConfig.DryRun.FreezeNamespace != nil {
+			freezeNamespace = *operatorConfig.DryRun.FreezeNamespace
+		}
+		if platform := operatorConfig.PlatformApplication; platform.RepoURL != "" {
+			platformApplication.RepoURL = platform.RepoURL
+			platformApplication.Path = platform.Path
+			if platform.TargetRevision != "" {
+				platformApplication.TargetRevision = platform.TargetRevision
+			}
+			if platform.Namespace != "" {
+				platformApplication.Namespace = platform.Namespace
+			}
+			if platform.AutoSync != nil {
+				platformApplication.AutoSync = *platform.AutoSync
+			}
+		}
+		if baseline := operatorConfig.BaselineApplicationSet; baseline.RepoURL != "" {
+			baselineApplicationSet.RepoURL = baseline.RepoURL
+			baselineApplicationSet.Path = baseline.Path
+			if baseline.TargetRevision != "" {
+				baselineApplicationSet.TargetRevision = baseline.TargetRevision
+			}
+			if baseline.Namespace != "" {
+				baselineApplicationSet.Namespace = baseline.Namespace
+			}
+			if baseline.Project != "" {
+				baselineApplicationSet.Project = baseline.Project
+			}
+			if baseline.AutoSync != nil {
+				baselineApplicationSet.AutoSync = *baseline.AutoSync
+			}
+			if baseline.Maintain != nil {
+				baselineApplicationSet.Maintain = *baseline.Maintain
+			}
+			if baseline.GitOpsNamespace != "" {
+				baselineApplicationSet.GitOpsNamespace = baseline.GitOpsNamespace
+			}
+		}
+		if b := operatorConfig.Bootstrap; b.RepoURL != "" {
+			bootstrap.RepoURL = b.RepoURL
+			bootstrap.Path = b.Path
+			if b.TargetRevision != "" {
+				bootstrap.TargetRevision = b.TargetRevision
+			}
+			bootstrap.Values = b.Values
+			bootstrap.Project = b.Project
+			bootstrap.Namespace = b.Namespace
+			if b.AutoSync != nil {
+				bootstrap.AutoSync = *b.AutoSync
+			}
+		}
+		if operatorConfig.HubClients.UserAgent != "" {
+			hubUserAgent = operatorConfig.HubClients.UserAgent
+		}
+		if operatorConfig.HubClients.Limits != nil {
+			hubClientLimits = operatorConfig.HubClients.Limits
+		}
+	}
+
+	if quotas == nil && maxRegistrationsPerNamespace > 0 {
+		quotas = []hyperopsv1alpha1.RegistrationQuota{{Name: "namespace", Max: maxRegistrationsPerNamespace}}
+	}
+	if len(tokenAudiences) > 0 && !boundTokens {
+		setupLog.Error(fmt.Errorf("%d token audiences configured", len(tokenAudiences)), "token audiences require --bound-tokens")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateTokenRotation(tokenTTL, tokenRenewBefore); err != nil {
+		setupLog.Error(err, "invalid --token-ttl or --token-renew-before")
+		os.Exit(1)
+	}
+	if boundTokens {
+		err = controllers.ValidateMaxCredentialAge(maxCredentialAge, tokenTTL, tokenRenewBefore)
+	} else {
+		err = controllers.ValidateMaxCredentialAge(maxCredentialAge, 0, 0)
+	}
+	if err != nil {
+		setupLog.Error(err, "invalid --max-credential-age")
+		os.Exit(1)
+	}
+	if !boundTokens {
+		setupLog.Info("--bound-tokens=false is deprecated, legacy service account token secrets don't expire and are not " +
+			"generated on clusters with LegacyServiceAccountTokenNoAutoGeneration")
+	}
+	if defaultEnrollment != controllers.DefaultEnrollmentEnabled && defaultEnrollment != controllers.DefaultEnrollmentDisabled {
+		setupLog.Error(fmt.Errorf("invalid value %q", defaultEnrollment), "--default-enrollment must be enabled or disabled")
+		os.Exit(1)
+	}
+	if duplicateServerWinner != controllers.DuplicateServerWinnerOldest && duplicateServerWinner != controllers.DuplicateServerWinnerNewest {
+		setupLog.Error(fmt.Errorf("invalid value %q", duplicateServerWinner), "--duplicate-server-winner must be oldest or newest")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateTerminalStatePolicy(terminalStatePolicy); err != nil {
+		setupLog.Error(err, "--terminal-state-policy must be retry, skip or deregister")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateHostedClusterRole(hostedClusterRole); err != nil {
+		setupLog.Error(err, "invalid --hosted-cluster-role")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateAuthMode(authMode); err != nil {
+		setupLog.Error(err, "--auth-mode must be serviceAccount, clientCertificate or awsExecProvider")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateAWSRoleName(awsRoleName); err != nil {
+		setupLog.Error(err, "invalid --aws-role-name")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateShards(shards); err != nil {
+		setupLog.Error(err, "invalid --shards")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateClusterNameSource(clusterNameSource); err != nil {
+		setupLog.Error(err, "--cluster-name-source must be name, infraID or template")
+		os.Exit(1)
+	}
+	var nameTemplate *template.Template
+	if clusterNameSource == controllers.ClusterNameSourceTemplate {
+		var err error
+		if nameTemplate, err = controllers.ParseClusterNameTemplate(clusterNameTemplate); err != nil {
+			setupLog.Error(err, "invalid --cluster-name-template")
+			os.Exit(1)
+		}
+	}
+	if err := controllers.ValidateSecretConflictPolicy(secretConflictPolicy); err != nil {
+		setupLog.Error(err, "--secret-conflict-policy must be skip, fail or adopt")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateUpgradePolicy(upgradePolicy); err != nil {
+		setupLog.Error(err, "--upgrade-policy must be ignore, flag or pause")
+		os.Exit(1)
+	}
+	if agentPrincipalAddress != "" {
+		if _, _, err := net.SplitHostPort(agentPrincipalAddress); err != nil {
+			setupLog.Error(err, "--agent-principal-address must be host:port")
+			os.Exit(1)
+		}
+	}
+	if err := controllers.ValidateConnectivity(privateClusterConnectivity); err != nil {
+		setupLog.Error(err, "--private-cluster-connectivity must be direct or outbound-only")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateStandaloneInstaller(standaloneGitOps.Installer); err != nil {
+		setupLog.Error(err, "--standalone-installer must be openshift-gitops or manifests")
+		os.Exit(1)
+	}
+	var archiveStore archive.Store
+	if archiveURL != "" {
+		if archiveStore, err = archive.Open(archiveURL); err != nil {
+			setupLog.Error(err, "invalid --archive-url")
+			os.Exit(1)
+		}
+	}
+	baselineConfigMap, err := controllers.ParseBaselineManifestsConfigMap(baselineManifestsConfigMap)
+	if err != nil {
+		setupLog.Error(err, "--baseline-manifests-configmap must be <namespace>/<name>")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateBaselineManifestsArtifact(baselineManifestsArtifact); err != nil {
+		setupLog.Error(err, "--baseline-manifests-oci must be a reference like registry.example.com/baseline:v1")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateClusterAppProjects(clusterAppProjects); err != nil {
+		setupLog.Error(err, "--cluster-app-projects must be cluster or tenant")
+		os.Exit(1)
+	}
+	if err := controllers.ValidateLabelSchema(labelSchema.Version); err != nil {
+		setupLog.Error(err, "--label-schema must be v1 or v2")
+		os.Exit(1)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	if err := controllers.CheckHyperShiftAPI(mgr.GetRESTMapper()); err != nil {
+		setupLog.Error(err, "unsupported HyperShift operator")
+		os.Exit(1)
+	}
+	hubClients, err := controllers.NewHubClients(mgr.GetConfig(), mgr.GetCache(),
+		client.Options{Scheme: mgr.GetScheme(), Mapper: mgr.GetRESTMapper()}, hubUserAgent, hubClientLimits)
+	if err != nil {
+		setupLog.Error(err, "unable to create the hub clients")
+		os.Exit(1)
+	}
+	if remoteHubKubeconfigFile != "" && remoteHubKubeconfigSecret != "" {
+		setupLog.Error(fmt.Errorf("both remote hub kubeconfigs are set"), "--remote-hub-kubeconfig and --remote-hub-kubeconfig-secret are mutually exclusive")
+		os.Exit(1)
+	}
+	if registrationProxyURL != "" && (remoteHubKubeconfigFile != "" || remoteHubKubeconfigSecret != "") {
+		setupLog.Error(fmt.Errorf("both the registration proxy and a remote hub are set"), "the registration proxy and the remote hub are mutually exclusive")
+		os.Exit(1)
+	}
+	var remoteHub *controllers.RemoteHub
+	if remoteHubKubeconfigFile != "" || remoteHubKubeconfigSecret != "" {
+		var kubeconfig []byte
+		if remoteHubKubeconfigFile != "" {
+			kubeconfig, err = os.ReadFile(remoteHubKubeconfigFile)
+		} else {
+			kubeconfig, err = controllers.RemoteHubKubeconfig(context.Background(), mgr.GetAPIReader(), remoteHubKubeconfigSecret)
+		}
+		if err != nil {
+			setupLog.Error(err, "unable to read the remote hub kubeconfig")
+			os.Exit(1)
+		}
+		if remoteHub, err = controllers.NewRemoteHub(kubeconfig); err != nil {
+			setupLog.Error(err, "unable to create remote hub client")
+			os.Exit(1)
+		}
+	}
+	var argoCDReader client.Reader = mgr.GetAPIReader()
+	if remoteHub != nil {
+		argoCDReader = remoteHub.Client
+	}
+	controllers.LogArgoCDCapabilities(context.Background(), argoCDReader, allowedNamespaces, setupLog)
+
+	var registrars []controllers.Registrar
+	if fluxConfig.Namespace != "" {
+		flux, err := controllers.NewFluxRegistrar(hubClients.Registrar, fluxConfig)
+		if err != nil {
+			setupLog.Error(err, "invalid flux registration")
+			os.Exit(1)
+		}
+		registrars = append(registrars, flux)
+	}
+	if rancherFleetConfig.Workspace != "" {
+		if rancherFleetConfig.RegistrationTokenTTL == nil {
+			rancherFleetConfig.RegistrationTokenTTL = &metav1.Duration{Duration: rancherFleetTokenTTL}
+		}
+		fleet, err := controllers.NewRancherFleetRegistrar(hubClients.Registrar, rancherFleetConfig)
+		if err != nil {
+			setupLog.Error(err, "invalid rancher fleet registration")
+			os.Exit(1)
+		}
+		registrars = append(registrars, fleet)
+	}
+	if acmManagedClusters {
+		if acmConfig.AutoImportRetry == nil {
+			retry := int32(acmAutoImportRetry)
+			acmConfig.AutoImportRetry = &retry
+		}
+		acm, err := controllers.NewACMRegistrar(hubClients.Registrar, acmConfig)
+		if err != nil {
+			setupLog.Error(err, "invalid acm registration")
+			os.Exit(1)
+		}
+		registrars = append(registrars, acm)
+	}
+	if karmadaConfig.KubeconfigSecret != "" {
+		karmadaClient, err := controllers.NewKarmadaClient(context.Background(), mgr.GetAPIReader(), karmadaConfig.KubeconfigSecret)
+		if err != nil {
+			setupLog.Error(err, "unable to create karmada client")
+			os.Exit(1)
+		}
+		karmada, err := controllers.NewKarmadaRegistrar(karmadaClient, karmadaConfig)
+		if err != nil {
+			setupLog.Error(err, "invalid karmada registration")
+			os.Exit(1)
+		}
+		registrars = append(registrars, karmada)
+	}
+
+	var registrationProxy *regproxy.Client
+	if registrationProxyURL != "" {
+		signingKey, err := os.ReadFile(registrationProxySigningKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read registration proxy signing key")
+			os.Exit(1)
+		}
+		var caData []byte
+		if registrationProxyCAFile != "" {
+			if caData, err = os.ReadFile(registrationProxyCAFile); err != nil {
+				setupLog.Error(err, "unable to read registration proxy CA")
+				os.Exit(1)
+			}
+		}
+		if registrationProxy, err = regproxy.NewClient(registrationProxyURL, bytes.TrimSpace(signingKey), caData); err != nil {
+			setupLog.Error(err, "unable to create registration proxy client")
+			os.Exit(1)
+		}
+	}
 
-	if err = (&controllers.HyperOpsReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	var tokenRotations chan event.GenericEvent
+	if boundTokens && tokenRotationInterval > 0 && !dryRun {
+		tokenRotations = make(chan event.GenericEvent)
+	}
+	if hostedClientPoolSize < 0 || hostedClientIdleTimeout < 0 {
+		setupLog.Error(fmt.Errorf("invalid pool size %d or idle timeout %s", hostedClientPoolSize, hostedClientIdleTimeout),
+			"--hosted-client-pool-size and --hosted-client-idle-timeout must not be negative")
+		os.Exit(1)
+	}
+	if argoCDInstanceSelector != nil && !discoverArgoCDInstances {
+		setupLog.Error(fmt.Errorf("the ArgoCD instance selector is set without discovery"), "--argocd-instance-selector requires --discover-argocd-instances")
+		os.Exit(1)
+	}
+	var argoCDDiscovery *controllers.ArgoCDInstanceDiscovery
+	if discoverArgoCDInstances {
+		argoCDDiscovery = &controllers.ArgoCDInstanceDiscovery{
+			Client:   hubClients.Registrar,
+			Reader:   argoCDReader,
+			Selector: argoCDInstanceSelector,
+			Changes:  make(chan event.GenericEvent),
+		}
+		if err := mgr.Add(argoCDDiscovery); err != nil {
+			setupLog.Error(err, "unable to set up the ArgoCD instance discovery")
+			os.Exit(1)
+		}
+	}
+	var hostedClients *controllers.HostedClientPool
+	if hostedClientPoolSize > 0 {
+		hostedClients = controllers.NewHostedClientPool(hostedClientPoolSize, hostedClientIdleTimeout)
+		if err := mgr.Add(hostedClients); err != nil {
+			setupLog.Error(err, "unable to set up the hosted cluster client pool")
+			os.Exit(1)
+		}
+	}
+	reconciler := &controllers.HyperOpsReconciler{
+		Client:                     hubClients.Registrar,
+		Scheme:                     mgr.GetScheme(),
+		DefaultEnrollment:          defaultEnrollment,
+		DuplicateServerWinner:      duplicateServerWinner,
+		TerminalStatePolicy:        terminalStatePolicy,
+		HostedClusterRole:          hostedClusterRole,
+		AuthMode:                   authMode,
+		AWSRoleName:                awsRoleName,
+		ClusterNameSource:          clusterNameSource,
+		ClusterNameTemplate:        nameTemplate,
+		SecretConflictPolicy:       secretConflictPolicy,
+		UpgradePolicy:              upgradePolicy,
+		TerminalStateTimeout:       terminalStateTimeout,
+		AllowedGitOpsNamespaces:    allowedNamespaces,
+		GitOpsNamespaceRoutes:      gitOpsNamespaceRoutes,
+		RefreshQPS:                 refreshQPS,
+		MaxConcurrentRefreshes:     maxConcurrentRefreshes,
+		HostedClients:              hostedClients,
+		ArgoCDDiscovery:            argoCDDiscovery,
+		HostedClusterHeaders:       headers,
+		DiscoveryLabels:            discoveryLabels,
+		ClusterResources:           clusterResources,
+		Shards:                     shards,
+		RegistrationProxy:          registrationProxy,
+		RemoteHub:                  remoteHub,
+		BoundTokens:                boundTokens,
+		TokenAudiences:             tokenAudiences,
+		CIOutputs:                  ciOutputs,
+		Registrars:                 registrars,
+		TokenTTL:                   tokenTTL,
+		TokenRenewBefore:           tokenRenewBefore,
+		TokenRotations:             tokenRotations,
+		TopologyLabels:             topologyLabels,
+		WorkersLabel:               workersLabel,
+		Bootstrap:                  bootstrap,
+		InfraClusterName:           infraClusterName,
+		DryRun:                     dryRun,
+		FreezeNamespace:            freezeNamespace,
+		DeletionGracePeriod:        deletionGracePeriod,
+		MaxCredentialAge:           maxCredentialAge,
+		QuarantineStaleCredentials: quarantineStaleCredentials,
+		TenantRBAC:                 tenantRBAC,
+		TenantScopedClusters:       tenantScopedClusters,
+		ClusterAppProjects:         clusterAppProjects,
+		ClusterRegistrations:       clusterRegistrations,
+		OffboardHostedRBAC:         offboardHostedRBAC,
+		LocalClusterInCluster:      localClusterInCluster,
+		Quotas:                     quotas,
+		Recorder:                   mgr.GetEventRecorderFor("hyper-ops"),
+		EgressNetworkPolicies:      egressNetworkPolicies,
+		APIReader:                  mgr.GetAPIReader(),
+		HealthReader:               hubClients.Health,
+		Policies:                   policies,
+		AgentPrincipalAddress:      agentPrincipalAddress,
+		AgentResourceProxyServer:   agentResourceProxyServer,
+		AgentImage:                 agentImage,
+		PrivateClusterConnectivity: privateClusterConnectivity,
+		Standalone:                 standaloneGitOps,
+		BaselineManifests:          controllers.BaselineManifests{ConfigMap: baselineConfigMap, OCIArtifact: baselineManifestsArtifact},
+		Archive:                    archiveStore,
+		LabelSchema:                labelSchema,
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Config")
 		os.Exit(1)
 	}
+	if syncProjectDestinations && !dryRun {
+		if err = (&controllers.AppProjectDestinationReconciler{
+			Client: hubClients.Registrar,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "AppProjectDestinations")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if manageAdmissionPolicy {
+		if err := mgr.Add(&controllers.AdmissionPolicyManager{
+			Client:                  hubClients.Registrar,
+			AllowedGitOpsNamespaces: allowedNamespaces,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up admission policy")
+			os.Exit(1)
+		}
+	}
+
+	if platformApplication.RepoURL != "" && !dryRun {
+		if err := mgr.Add(&controllers.PlatformApplicationManager{
+			Client:      hubClients.Registrar,
+			Application: platformApplication,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up platform application")
+			os.Exit(1)
+		}
+	}
+
+	if baselineApplicationSet.RepoURL != "" && !dryRun {
+		baselineApplicationSet.LabelSchema = labelSchema
+		if err := mgr.Add(&controllers.BaselineApplicationSetManager{
+			Client:         hubClients.Registrar,
+			ApplicationSet: baselineApplicationSet,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up baseline applicationset")
+			os.Exit(1)
+		}
+	}
+
+	if operatorConfigWebhook {
+		mgr.GetWebhookServer().Register(controllers.OperatorConfigWebhookPath, &webhook.Admission{Handler: &controllers.OperatorConfigValidator{
+			Client: mgr.GetAPIReader(),
+			Scheme: scheme,
+		}})
+	}
+
+	if configFile != "" {
+		if err := mgr.Add(&controllers.ConfigReloader{
+			Path:       configFile,
+			Scheme:     scheme,
+			Reconciler: reconciler,
+			Defaults:   runtimeDefaults,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up config reload")
+			os.Exit(1)
+		}
+	}
+
+	if dryRun {
+		if err := mgr.Add(&controllers.DryRunReporter{
+			Client:     mgr.GetClient(),
+			Namespace:  fleetReportNamespace,
+			Interval:   dryRunReportInterval,
+			Reconciler: reconciler,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up dry-run report")
+			os.Exit(1)
+		}
+	}
+
+	if consistencyCheckInterval > 0 {
+		if err := mgr.Add(&controllers.ConsistencyChecker{
+			Client:    hubClients.GC,
+			Interval:  consistencyCheckInterval,
+			Repair:    consistencyRepair && !dryRun,
+			Routes:    gitOpsNamespaceRoutes,
+			Discovery: argoCDDiscovery,
+			// orphans are deleted by the reaper once their token is revoked
+			SkipOrphans: orphanReapInterval > 0 && !dryRun,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up consistency check")
+			os.Exit(1)
+		}
+	}
+
+	if orphanReapInterval > 0 && !dryRun {
+		if err := mgr.Add(&controllers.OrphanReaper{
+			Client:            hubClients.GC,
+			Interval:          orphanReapInterval,
+			ReadOnly:          reconciler.Frozen,
+			RevocationTimeout: orphanRevocationTimeout,
+			Headers:           headers,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up orphan reaper")
+			os.Exit(1)
+		}
+	}
+
+	if labelSchemaMigrationInterval > 0 && !dryRun {
+		if err := mgr.Add(&controllers.LabelSchemaMigrator{
+			Client:         hubClients.Registrar,
+			Schema:         labelSchema,
+			Interval:       labelSchemaMigrationInterval,
+			HostedClusters: migrateHostedClusterLabels,
+			ReadOnly:       reconciler.Frozen,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up label schema migration")
+			os.Exit(1)
+		}
+	}
+
+	if inventoryRepository != "" && !dryRun {
+		if err := controllers.ValidateInventoryPath(inventoryPath); err != nil {
+			setupLog.Error(err, "invalid --inventory-path")
+			os.Exit(1)
+		}
+		if inventoryInterval <= 0 {
+			setupLog.Error(fmt.Errorf("invalid interval %s", inventoryInterval), "--inventory-interval must be positive")
+			os.Exit(1)
+		}
+		if _, err := exec.LookPath("git"); err != nil {
+			setupLog.Error(err, "the cluster inventory requires git on the PATH of the operator")
+			os.Exit(1)
+		}
+		writer := &controllers.InventoryWriter{
+			Client:     mgr.GetClient(),
+			Repository: inventoryRepository,
+			Branch:     inventoryBranch,
+			Path:       inventoryPath,
+			Interval:   inventoryInterval,
+		}
+		if inventoryDeployKeySecret != "" {
+			writer.DeployKeySecret = client.ObjectKey{Namespace: os.Getenv("POD_NAMESPACE"), Name: inventoryDeployKeySecret}
+		}
+		if err := mgr.Add(writer); err != nil {
+			setupLog.Error(err, "unable to set up the cluster inventory")
+			os.Exit(1)
+		}
+	}
+
+	if tokenRotations != nil {
+		if err := mgr.Add(&controllers.TokenRotator{
+			Client:      hubClients.Rotation,
+			Interval:    tokenRotationInterval,
+			RenewBefore: tokenRenewBefore,
+			Rotations:   tokenRotations,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up token rotation")
+			os.Exit(1)
+		}
+	}
+
+	if deletionGracePeriod > 0 && !dryRun {
+		if err := mgr.Add(&controllers.PendingDeletionSweeper{
+			Client: hubClients.GC,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up pending deletion sweeper")
+			os.Exit(1)
+		}
+	}
+
+	if fleetReportInterval > 0 {
+		if err := mgr.Add(&controllers.FleetReporter{
+			Client:            mgr.GetClient(),
+			Namespace:         fleetReportNamespace,
+			Interval:          fleetReportInterval,
+			DefaultEnrollment: defaultEnrollment,
+			Archive:           archiveStore,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up fleet report")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -95,6 +1310,27 @@ func main() {
 		os.Exit(1)
 	}
 
+	// the snapshot is taken before the controllers start reconciling, so it shows the state hyper-ops started from
+	if startupReport {
+		if registrationProxyURL != "" || remoteHub != nil {
+			setupLog.Info("skipping the startup report, the ArgoCD cluster secrets are not on this cluster")
+		} else if report, err := controllers.GenerateStartupReport(context.Background(), mgr.GetAPIReader(), defaultEnrollment); err != nil {
+			setupLog.Error(err, "unable to generate startup report")
+		} else {
+			controllers.LogStartupReport(report, setupLog)
+			if fleetReportNamespace != "" {
+				if err := mgr.Add(&controllers.StartupReporter{
+					Client:    mgr.GetClient(),
+					Namespace: fleetReportNamespace,
+					Report:    report,
+				}); err != nil {
+					setupLog.Error(err, "unable to set up startup report")
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
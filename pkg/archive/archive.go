@@ -0,0 +1,145 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive stores verbose data outside of the Kubernetes API, in a directory, e.g. on a persistent volume, or
+// in an S3 compatible object storage bucket, so only compact status has to be kept in etcd.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for keys that were never written
+var ErrNotFound = errors.New("not found in the archive")
+
+// Store reads and writes archived objects by key, a relative slash separated path like history/ns/name.json
+type Store interface {
+	// Get returns the content of the key, ErrNotFound if the key doesn't exist
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put replaces the content of the key
+	Put(ctx context.Context, key string, data []byte) error
+	// Location returns the URL of the key, shown to users looking for the archived data
+	Location(key string) string
+}
+
+// Open returns the store of the archive URL, file:///<dir> for a directory or s3://<bucket>[/<prefix>] for a bucket.
+// Buckets take the endpoint and region query parameters, e.g. s3://hyper-ops?endpoint=https://minio:9000, and the
+// credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func Open(raw string) (Store, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive url %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" || !path.IsAbs(u.Path) {
+			return nil, fmt.Errorf("invalid archive url %q, must be file:///<absolute directory>", raw)
+		}
+		return &FileStore{Dir: filepath.FromSlash(u.Path)}, nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid archive url %q, must be s3://<bucket>[/<prefix>]", raw)
+		}
+		s := &S3Store{
+			Bucket:          u.Host,
+			Prefix:          strings.Trim(u.Path, "/"),
+			Region:          u.Query().Get("region"),
+			Endpoint:        u.Query().Get("endpoint"),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if s.Region == "" {
+			s.Region = DefaultS3Region
+		}
+		if s.Endpoint == "" {
+			s.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.Region)
+		}
+		if endpoint, err := url.Parse(s.Endpoint); err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q of archive url %q", s.Endpoint, raw)
+		}
+		if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+			return nil, fmt.Errorf("archive url %q requires the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables", raw)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid archive url %q, the scheme must be file or s3", raw)
+}
+
+// ValidateKey returns an error if the key is not a clean relative slash separated path
+func ValidateKey(key string) error {
+	if key == "" || path.Clean(key) != key || path.IsAbs(key) || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid archive key %q, must be a clean relative path", key)
+	}
+	return nil
+}
+
+// FileStore keeps the archive in a directory, e.g. the mount of a persistent volume
+type FileStore struct {
+	Dir string
+}
+
+var _ Store = &FileStore{}
+
+func (f *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(f.file(key))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return data, err
+}
+
+// Put writes the content to a temporary file that replaces the file of the key, so readers never see a partial write
+func (f *FileStore) Put(_ context.Context, key string, data []byte) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	file := f.file(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+func (f *FileStore) Location(key string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(f.file(key))}).String()
+}
+
+func (f *FileStore) file(key string) string {
+	return filepath.Join(f.Dir, filepath.FromSlash(key))
+}
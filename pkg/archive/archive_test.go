@@ -0,0 +1,141 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive", func() {
+	It("Should open directories and buckets", func() {
+		store, err := Open("file:///var/lib/hyper-ops")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Location("history/clusters/hosted.json")).To(Equal("file:///var/lib/hyper-ops/history/clusters/hosted.json"))
+
+		os.Setenv("AWS_ACCESS_KEY_ID", "id")
+		os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+		defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		store, err = Open("s3://hyper-ops/fleet-a?region=eu-west-1")
+		Expect(err).NotTo(HaveOccurred())
+		s3 := store.(*S3Store)
+		Expect(s3.Endpoint).To(Equal("https://s3.eu-west-1.amazonaws.com"))
+		Expect(s3.Location("history/clusters/hosted.json")).To(Equal("s3://hyper-ops/fleet-a/history/clusters/hosted.json"))
+		store, err = Open("s3://hyper-ops?endpoint=http://minio:9000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.(*S3Store).Region).To(Equal(DefaultS3Region))
+
+		for _, invalid := range []string{"/var/lib/hyper-ops", "file://host/dir", "file:relative", "s3:///prefix", "s3://bucket?endpoint=minio:9000", "gs://bucket"} {
+			_, err := Open(invalid)
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+		os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+		_, err = Open("s3://hyper-ops")
+		Expect(err).To(MatchError(ContainSubstring("AWS_SECRET_ACCESS_KEY")))
+	})
+
+	It("Should reject keys outside of the archive", func() {
+		Expect(ValidateKey("history/clusters/hosted.json")).To(Succeed())
+		for _, invalid := range []string{"", "/history", "../history", "history/../../x", "history//x", ".."} {
+			Expect(ValidateKey(invalid)).NotTo(Succeed(), invalid)
+		}
+	})
+
+	It("Should keep the archive in a directory", func() {
+		store := &FileStore{Dir: GinkgoT().TempDir()}
+		_, err := store.Get(context.Background(), "history/clusters/hosted.json")
+		Expect(errors.Is(err, ErrNotFound)).To(BeTrue())
+		Expect(store.Put(context.Background(), "history/clusters/hosted.json", []byte("v1"))).To(Succeed())
+		Expect(store.Put(context.Background(), "history/clusters/hosted.json", []byte("v2"))).To(Succeed())
+		data, err := store.Get(context.Background(), "history/clusters/hosted.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("v2"))
+		entries, err := os.ReadDir(filepath.Join(store.Dir, "history", "clusters"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(store.Put(context.Background(), "../escape", []byte("x"))).NotTo(Succeed())
+	})
+
+	It("Should keep the archive in a bucket with signed requests", func() {
+		var mu sync.Mutex
+		objects := map[string][]byte{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			Expect(auth).To(HavePrefix("AWS4-HMAC-SHA256 Credential=id/"))
+			Expect(auth).To(ContainSubstring("/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="))
+			Expect(r.Header.Get("X-Amz-Security-Token")).To(Equal("session"))
+			Expect(r.Header.Get("X-Amz-Date")).NotTo(BeEmpty())
+			mu.Lock()
+			defer mu.Unlock()
+			switch r.Method {
+			case http.MethodPut:
+				body, _ := io.ReadAll(r.Body)
+				Expect(r.Header.Get("X-Amz-Content-Sha256")).To(Equal(sha256Hex(body)))
+				objects[r.URL.EscapedPath()] = body
+			case http.MethodGet:
+				body, ok := objects[r.URL.EscapedPath()]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write(body)
+			}
+		}))
+		defer srv.Close()
+		store := &S3Store{Endpoint: srv.URL, Region: "eu-west-1", Bucket: "hyper-ops", Prefix: "fleet a",
+			AccessKeyID: "id", SecretAccessKey: "secret", SessionToken: "session"}
+
+		_, err := store.Get(context.Background(), "history/clusters/hosted.json")
+		Expect(errors.Is(err, ErrNotFound)).To(BeTrue())
+		Expect(store.Put(context.Background(), "history/clusters/hosted.json", []byte("v1"))).To(Succeed())
+		Expect(objects).To(HaveKey("/hyper-ops/fleet%20a/history/clusters/hosted.json"))
+		data, err := store.Get(context.Background(), "history/clusters/hosted.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("v1"))
+	})
+
+	It("Should bound the requests against the object storage", func() {
+		Expect(defaultS3Client.Timeout).To(BeNumerically(">", 0))
+
+		unblock := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-unblock:
+			}
+		}))
+		defer srv.Close()
+		defer close(unblock)
+		store := &S3Store{Endpoint: srv.URL, Region: "eu-west-1", Bucket: "hyper-ops", AccessKeyID: "id", SecretAccessKey: "secret"}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := store.Get(ctx, "history/clusters/hosted.json")
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+	})
+})
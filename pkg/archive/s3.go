@@ -0,0 +1,199 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultS3Region is the region of buckets without a region parameter
+	DefaultS3Region = "us-east-1"
+
+	// maxObjectSize caps the size of the objects read from a bucket
+	maxObjectSize = 64 << 20
+	// defaultS3Timeout bounds the requests of stores without a client, so an unresponsive object storage can't block
+	// a reconcile
+	defaultS3Timeout = 30 * time.Second
+)
+
+// defaultS3Client sends the requests of stores without a client
+var defaultS3Client = &http.Client{Timeout: defaultS3Timeout}
+
+// S3Store keeps the archive in a bucket of an S3 compatible object storage, addressed path style so it works with
+// MinIO, Ceph RGW and ODF as well as AWS. Requests are signed with AWS signature version 4.
+type S3Store struct {
+	// Endpoint is the URL of the object storage, e.g. https://s3.eu-west-1.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the keys
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Client sends the requests, a client with a timeout of 30 seconds if nil
+	Client *http.Client
+}
+
+var _ Store = &S3Store{}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s.responseError(http.MethodGet, key, resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxObjectSize {
+		return nil, fmt.Errorf("%s exceeds the maximum size of %d bytes", s.Location(key), maxObjectSize)
+	}
+	return data, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s.responseError(http.MethodPut, key, resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Location(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, s.objectKey(key))
+}
+
+func (s *S3Store) objectKey(key string) string {
+	if s.Prefix == "" {
+		return key
+	}
+	return s.Prefix + "/" + key
+}
+
+// do sends the signed request for the object of the key
+func (s *S3Store) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	uri := strings.TrimSuffix(endpoint.EscapedPath(), "/") + "/" + uriEncode(s.Bucket) + "/" + uriEncode(s.objectKey(key))
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.Scheme+"://"+endpoint.Host+uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, uri, body, time.Now())
+	client := s.Client
+	if client == nil {
+		client = defaultS3Client
+	}
+	return client.Do(req)
+}
+
+// sign adds the AWS signature version 4 of the request to its headers
+func (s *S3Store) sign(req *http.Request, uri string, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+		headers["x-amz-security-token"] = s.SessionToken
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	canonicalHeaders := ""
+	for _, h := range signedHeaders {
+		canonicalHeaders += h + ":" + headers[h] + "\n"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method, uri, "", canonicalHeaders, strings.Join(signedHeaders, ";"), payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, s.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, strings.Join(signedHeaders, ";"), hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func (s *S3Store) responseError(method, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s %s failed with status %d: %s", method, s.Location(key), resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// uriEncode escapes the path like S3 expects in the canonical request, every byte except the unreserved characters
+// of RFC 3986 and the slash
+func uriEncode(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
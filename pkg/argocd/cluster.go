@@ -0,0 +1,180 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package argocd contains a typed representation of the ArgoCD declarative cluster secret,
+// see https://argo-cd.readthedocs.io/en/stable/operator-manual/declarative-setup/#clusters
+package argocd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SecretTypeLabel is the label ArgoCD uses to discover declarative secrets
+	SecretTypeLabel = "argocd.argoproj.io/secret-type"
+	// SecretTypeCluster marks a secret as an ArgoCD cluster secret
+	SecretTypeCluster = "cluster"
+
+	// InClusterServer is the server URL ArgoCD uses for the cluster it is running in
+	InClusterServer = "https://kubernetes.default.svc"
+
+	secretKeyName    = "name"
+	secretKeyServer  = "server"
+	secretKeyConfig  = "config"
+	secretKeyProject = "project"
+
+	secretKeyNamespaces       = "namespaces"
+	secretKeyClusterResources = "clusterResources"
+	secretKeyShard            = "shard"
+)
+
+// Cluster is the content of an ArgoCD cluster secret
+type Cluster struct {
+	Name   string        `json:"name"`
+	Server string        `json:"server"`
+	Config ClusterConfig `json:"config"`
+	// Project scopes the cluster to an AppProject, supported by ArgoCD 2.4 and newer
+	Project string `json:"project,omitempty"`
+	// Namespaces restricts ArgoCD to the namespaces of the cluster, all namespaces if empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ClusterResources lets ArgoCD manage cluster scoped resources of a cluster restricted to namespaces
+	ClusterResources bool `json:"clusterResources,omitempty"`
+	// Shard assigns the cluster to a shard of a sharded application controller, the controller decides if nil
+	Shard *int64 `json:"shard,omitempty"`
+}
+
+// ClusterConfig is the connection configuration stored in the config key of an ArgoCD cluster secret
+type ClusterConfig struct {
+	// Username and Password are used for basic authentication
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// BearerToken is used for token authentication
+	BearerToken string `json:"bearerToken,omitempty"`
+
+	// TLSClientConfig contains the settings to enable transport layer security
+	TLSClientConfig TLSClientConfig `json:"tlsClientConfig"`
+
+	// AWSAuthConfig configures IAM authentication against EKS style clusters
+	AWSAuthConfig *AWSAuthConfig `json:"awsAuthConfig,omitempty"`
+
+	// ExecProviderConfig configures an external command providing the credentials
+	ExecProviderConfig *ExecProviderConfig `json:"execProviderConfig,omitempty"`
+
+	// DisableCompression bypasses automatic GZip compression requests to the server
+	DisableCompression bool `json:"disableCompression,omitempty"`
+
+	// ProxyURL is the URL of the proxy used to reach the cluster
+	ProxyURL string `json:"proxyUrl,omitempty"`
+}
+
+// TLSClientConfig contains the TLS settings used to connect to the cluster
+type TLSClientConfig struct {
+	// Insecure skips the verification of the server certificate
+	Insecure bool `json:"insecure"`
+	// ServerName is passed to the server for SNI and used to verify the server certificate
+	ServerName string `json:"serverName,omitempty"`
+	// CertData holds the PEM encoded client certificate
+	CertData []byte `json:"certData,omitempty"`
+	// KeyData holds the PEM encoded client key
+	KeyData []byte `json:"keyData,omitempty"`
+	// CAData holds the PEM encoded CA bundle used to verify the server certificate
+	CAData []byte `json:"caData,omitempty"`
+}
+
+// AWSAuthConfig configures IAM authentication using argocd-k8s-auth aws
+type AWSAuthConfig struct {
+	// ClusterName is the name of the cluster as known by AWS
+	ClusterName string `json:"clusterName,omitempty"`
+	// RoleARN is the IAM role assumed to authenticate against the cluster
+	RoleARN string `json:"roleARN,omitempty"`
+	// Profile is the AWS profile used to assume the role
+	Profile string `json:"profile,omitempty"`
+}
+
+// ExecProviderConfig configures an external command providing the credentials, modelled after the client-go exec plugin
+type ExecProviderConfig struct {
+	// Command is the command to execute
+	Command string `json:"command,omitempty"`
+	// Args are the arguments passed to the command
+	Args []string `json:"args,omitempty"`
+	// Env holds additional environment variables to expose to the command
+	Env map[string]string `json:"env,omitempty"`
+	// APIVersion is the preferred input version of the ExecInfo
+	APIVersion string `json:"apiVersion,omitempty"`
+	// InstallHint is printed if the command is not installed
+	InstallHint string `json:"installHint,omitempty"`
+}
+
+// SecretData renders the cluster into the data of an ArgoCD cluster secret
+func (c *Cluster) SecretData() (map[string][]byte, error) {
+	config, err := json.Marshal(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		secretKeyName:   []byte(c.Name),
+		secretKeyServer: []byte(c.Server),
+		secretKeyConfig: config,
+	}
+	if c.Project != "" {
+		data[secretKeyProject] = []byte(c.Project)
+	}
+	if len(c.Namespaces) > 0 {
+		data[secretKeyNamespaces] = []byte(strings.Join(c.Namespaces, ","))
+		data[secretKeyClusterResources] = []byte(strconv.FormatBool(c.ClusterResources))
+	}
+	if c.Shard != nil {
+		data[secretKeyShard] = []byte(strconv.FormatInt(*c.Shard, 10))
+	}
+	return data, nil
+}
+
+// ClusterFromSecretData parses the data of an ArgoCD cluster secret
+func ClusterFromSecretData(data map[string][]byte) (*Cluster, error) {
+	c := &Cluster{
+		Name:    string(data[secretKeyName]),
+		Server:  string(data[secretKeyServer]),
+		Project: string(data[secretKeyProject]),
+	}
+	if c.Server == "" {
+		return nil, fmt.Errorf("cluster secret has no server")
+	}
+	if namespaces := string(data[secretKeyNamespaces]); namespaces != "" {
+		for _, ns := range strings.Split(namespaces, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				c.Namespaces = append(c.Namespaces, ns)
+			}
+		}
+		c.ClusterResources = string(data[secretKeyClusterResources]) == "true"
+	}
+	if shard, ok := data[secretKeyShard]; ok && len(shard) > 0 {
+		n, err := strconv.ParseInt(strings.TrimSpace(string(shard)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid shard %q: %w", shard, err)
+		}
+		c.Shard = &n
+	}
+	if config, ok := data[secretKeyConfig]; ok && len(config) > 0 {
+		if err := json.Unmarshal(config, &c.Config); err != nil {
+			return nil, fmt.Errorf("unable to parse cluster config: %w", err)
+		}
+	}
+	return c, nil
+}
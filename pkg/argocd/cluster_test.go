@@ -0,0 +1,94 @@
+package argocd
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cluster", func() {
+	It("Should render the minimal bearer token config", func() {
+		c := &Cluster{
+			Name:   "hosted",
+			Server: "https://api.hosted:6443",
+			Config: ClusterConfig{
+				BearerToken:     "token",
+				TLSClientConfig: TLSClientConfig{CAData: []byte("ca")},
+			},
+		}
+		data, err := c.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("name", []byte("hosted")))
+		Expect(data).To(HaveKeyWithValue("server", []byte("https://api.hosted:6443")))
+		Expect(data).NotTo(HaveKey("project"))
+		Expect(data).NotTo(HaveKey("namespaces"))
+		Expect(data).NotTo(HaveKey("clusterResources"))
+		Expect(data).NotTo(HaveKey("shard"))
+		Expect(string(data["config"])).To(MatchJSON(`{"bearerToken":"token","tlsClientConfig":{"insecure":false,"caData":"Y2E="}}`))
+	})
+
+	It("Should round trip every config field", func() {
+		shard := int64(2)
+		c := &Cluster{
+			Name:             "hosted",
+			Server:           "https://api.hosted:6443",
+			Project:          "tenant-a",
+			Namespaces:       []string{"team-a", "team-b"},
+			ClusterResources: true,
+			Shard:            &shard,
+			Config: ClusterConfig{
+				Username:    "user",
+				Password:    "pass",
+				BearerToken: "token",
+				TLSClientConfig: TLSClientConfig{
+					Insecure:   true,
+					ServerName: "api.hosted",
+					CertData:   []byte("cert"),
+					KeyData:    []byte("key"),
+					CAData:     []byte("ca"),
+				},
+				AWSAuthConfig: &AWSAuthConfig{ClusterName: "hosted", RoleARN: "arn:aws:iam::1:role/argocd", Profile: "default"},
+				ExecProviderConfig: &ExecProviderConfig{
+					Command:     "argocd-k8s-auth",
+					Args:        []string{"aws"},
+					Env:         map[string]string{"AWS_REGION": "eu-north-1"},
+					APIVersion:  "client.authentication.k8s.io/v1beta1",
+					InstallHint: "install argocd-k8s-auth",
+				},
+				DisableCompression: true,
+				ProxyURL:           "http://proxy:3128",
+			},
+		}
+		data, err := c.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		parsed, err := ClusterFromSecretData(data)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(c))
+	})
+
+	It("Should write the namespaces of namespace scoped clusters", func() {
+		c := &Cluster{Name: "hosted", Server: "https://api.hosted:6443", Namespaces: []string{"team-a", "team-b"}}
+		data, err := c.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(HaveKeyWithValue("namespaces", []byte("team-a,team-b")))
+		Expect(data).To(HaveKeyWithValue("clusterResources", []byte("false")))
+	})
+
+	It("Should reject an invalid shard", func() {
+		_, err := ClusterFromSecretData(map[string][]byte{"server": []byte("https://api.hosted:6443"), "shard": []byte("first")})
+		Expect(err).To(MatchError(ContainSubstring("invalid shard")))
+	})
+
+	It("Should use the ArgoCD field names", func() {
+		raw, err := json.Marshal(ClusterConfig{ProxyURL: "http://proxy", AWSAuthConfig: &AWSAuthConfig{RoleARN: "arn"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(raw)).To(ContainSubstring(`"proxyUrl":"http://proxy"`))
+		Expect(string(raw)).To(ContainSubstring(`"roleARN":"arn"`))
+	})
+
+	It("Should reject secrets without a server", func() {
+		_, err := ClusterFromSecretData(map[string][]byte{"name": []byte("hosted")})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+// conformanceDir holds a directory per conformance case: the HostedCluster manifest in hostedcluster.yaml, optional
+// registration policies in policies.yaml, optional render options in options.yaml and the expected output of
+// hyper-ops render in expected.yaml
+const conformanceDir = "testdata/conformance"
+
+// conformanceOptions are the render options of a conformance case
+type conformanceOptions struct {
+	// Server is the API server of the hosted cluster, the control plane endpoint of the HostedCluster by default
+	Server string `json:"server,omitempty"`
+	// ArgoCDVersion is the version of ArgoCD the features are negotiated with
+	ArgoCDVersion string `json:"argoCDVersion,omitempty"`
+}
+
+// conformanceCases returns a table entry for every case directory
+func conformanceCases() []TableEntry {
+	dirs, err := os.ReadDir(conformanceDir)
+	if err != nil {
+		panic(err)
+	}
+	entries := []TableEntry{}
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			entries = append(entries, Entry(dir.Name(), filepath.Join(conformanceDir, dir.Name())))
+		}
+	}
+	return entries
+}
+
+var _ = Describe("Conformance", func() {
+	DescribeTable("Should render the expected registration", func(dir string) {
+		hc, err := ReadHostedCluster(filepath.Join(dir, "hostedcluster.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		options := conformanceOptions{}
+		if raw, err := os.ReadFile(filepath.Join(dir, "options.yaml")); err == nil {
+			Expect(yaml.UnmarshalStrict(raw, &options)).To(Succeed())
+		} else {
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		}
+		opts := controllers.RenderOptions{Server: options.Server, ArgoCDVersion: options.ArgoCDVersion}
+		if opts.Server == "" {
+			opts.Server, err = RenderServer(hc)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		if _, err := os.Stat(filepath.Join(dir, "policies.yaml")); err == nil {
+			opts.Policies, err = ReadPolicies(filepath.Join(dir, "policies.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		rendered, err := controllers.RenderRegistration(context.Background(), hc, opts)
+		Expect(err).NotTo(HaveOccurred())
+		out := &bytes.Buffer{}
+		Expect(PrintRendered(out, rendered)).To(Succeed())
+
+		expected := filepath.Join(dir, "expected.yaml")
+		if os.Getenv("UPDATE_CONFORMANCE") == "true" {
+			Expect(os.WriteFile(expected, out.Bytes(), 0o644)).To(Succeed())
+		}
+		want, err := os.ReadFile(expected)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal(string(want)), "the output of %s changed, changes of the output surface must stay backward compatible", dir)
+	}, conformanceCases())
+})
@@ -0,0 +1,78 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+// PrintExport renders an exported registration as a single YAML bundle. The registration conditions of the
+// HostedCluster head the bundle as comments, the data of the secrets is printed as stringData like rendered
+// registrations.
+func PrintExport(w io.Writer, export *controllers.ExportedRegistration) error {
+	if _, err := fmt.Fprintf(w, "# registration of HostedCluster %s\n", export.HostedCluster); err != nil {
+		return err
+	}
+	for _, c := range export.Conditions {
+		if _, err := fmt.Fprintf(w, "# %s=%s %s: %s\n", c.Type, c.Status, c.Reason, c.Message); err != nil {
+			return err
+		}
+	}
+	for _, obj := range export.Objects {
+		if obj.GetKind() == "Secret" {
+			if err := readableSecretData(obj); err != nil {
+				return err
+			}
+		}
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, "---"); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readableSecretData moves the data of the secret to stringData
+func readableSecretData(obj *unstructured.Unstructured) error {
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	stringData := map[string]interface{}{}
+	for k, v := range data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return fmt.Errorf("unable to decode %s of secret %s/%s: %w", k, obj.GetNamespace(), obj.GetName(), err)
+		}
+		stringData[k] = string(decoded)
+	}
+	unstructured.RemoveNestedField(obj.Object, "data")
+	return unstructured.SetNestedField(obj.Object, stringData, "stringData")
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+var _ = Describe("Export", func() {
+	It("Should print the bundle with readable secrets and the conditions as comments", func() {
+		secret := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "hosted", "namespace": "openshift-gitops"},
+			"data":       map[string]interface{}{"server": "aHR0cHM6Ly9hcGkuaG9zdGVkOjY0NDM="},
+		}}
+		project := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "AppProject",
+			"metadata":   map[string]interface{}{"name": "hosted", "namespace": "openshift-gitops"},
+		}}
+		out := &bytes.Buffer{}
+		Expect(PrintExport(out, &controllers.ExportedRegistration{
+			HostedCluster: client.ObjectKey{Namespace: "clusters", Name: "hosted"},
+			Conditions: []metav1.Condition{{
+				Type: controllers.ConditionPolicyAllowed, Status: metav1.ConditionTrue, Reason: "Allowed", Message: "allowed by 2 policies",
+			}},
+			Objects: []*unstructured.Unstructured{secret, project},
+		})).To(Succeed())
+		Expect(out.String()).To(HavePrefix("# registration of HostedCluster clusters/hosted\n# PolicyAllowed=True Allowed: allowed by 2 policies\n---\n"))
+		Expect(out.String()).To(ContainSubstring("stringData:\n  server: https://api.hosted:6443\n"))
+		Expect(out.String()).NotTo(ContainSubstring("\ndata:"))
+		Expect(out.String()).To(ContainSubstring("---\napiVersion: argoproj.io/v1alpha1\nkind: AppProject\n"))
+	})
+})
@@ -0,0 +1,339 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+const (
+	// APIVersion is the version of the machine readable output schema. Fields are only added within a version,
+	// renamed or removed fields bump the version.
+	APIVersion = "cli.hyper-ops.cloudmonkey.org/v1alpha1"
+
+	// OutputTable prints a human readable table, the default
+	OutputTable = "table"
+	// OutputJSON prints the versioned output schema as JSON
+	OutputJSON = "json"
+	// OutputYAML prints the versioned output schema as YAML
+	OutputYAML = "yaml"
+)
+
+// Printable is an output object that can be rendered as a table
+type Printable interface {
+	TableHeader() []string
+	TableRows() [][]string
+}
+
+// ClusterList is the output of the list command
+type ClusterList struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Items      []Cluster `json:"items"`
+}
+
+// ClusterStatus is the output of the status command
+type ClusterStatus struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Cluster    `json:",inline"`
+}
+
+// RegistrationHistory is the output of the history command
+type RegistrationHistory struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace"`
+	Changes    []Change `json:"changes"`
+}
+
+// ClusterExclusion is the output of the exclude and include commands
+type ClusterExclusion struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Excluded   bool               `json:"excluded"`
+	Reason     string             `json:"reason,omitempty"`
+	Items      []ClusterReference `json:"items"`
+}
+
+// ConfigValidation is the output of the validate-config command
+type ConfigValidation struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Path       string   `json:"path"`
+	Valid      bool     `json:"valid"`
+	Error      string   `json:"error,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// ClusterReference names a HostedCluster
+type ClusterReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// Cluster describes the registration of a single HostedCluster. It is part of the versioned output schema and kept
+// apart from the fleet report it is mapped from, so changes of the report don't change the schema.
+type Cluster struct {
+	Name                   string `json:"name"`
+	Namespace              string `json:"namespace"`
+	Platform               string `json:"platform,omitempty"`
+	Version                string `json:"version,omitempty"`
+	Enabled                bool   `json:"enabled"`
+	Registered             bool   `json:"registered"`
+	GitOpsNamespace        string `json:"gitopsNamespace,omitempty"`
+	Server                 string `json:"server,omitempty"`
+	LastRegistrationChange string `json:"lastRegistrationChange,omitempty"`
+	Available              bool   `json:"available"`
+	Degraded               bool   `json:"degraded"`
+	// State tells registered, pending, failed, skipped, disabled, not enrolled and unmanaged clusters apart
+	State string `json:"state"`
+	// Reason explains the state of clusters that are not registered
+	Reason string `json:"reason,omitempty"`
+	// BoundToken is true when the registration uses a TokenRequest issued token
+	BoundToken bool `json:"boundToken"`
+	// Excluded is true when the cluster is excluded from ApplicationSets
+	Excluded bool `json:"excluded"`
+	// ExcludedReason tells why the cluster is excluded
+	ExcludedReason string `json:"excludedReason,omitempty"`
+	// Features are the hyper-ops features active for the registration, as recorded by the last reconcile
+	Features *Features `json:"features,omitempty"`
+	// Conditions are the registration conditions recorded on the HostedCluster
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Features are the hyper-ops features active for the registration of a HostedCluster
+type Features struct {
+	DefaultEnrollment        bool     `json:"defaultEnrollment"`
+	RegistrationProxy        bool     `json:"registrationProxy"`
+	RemoteHub                bool     `json:"remoteHub"`
+	ClientCertificate        bool     `json:"clientCertificate"`
+	AuditHeaders             bool     `json:"auditHeaders"`
+	ConditionMirroring       bool     `json:"conditionMirroring"`
+	BoundServiceAccountToken bool     `json:"boundServiceAccountToken"`
+	TopologyLabels           bool     `json:"topologyLabels"`
+	WorkersLabel             bool     `json:"workersLabel"`
+	Impersonation            bool     `json:"impersonation"`
+	TenantRBAC               bool     `json:"tenantRBAC"`
+	EgressNetworkPolicy      bool     `json:"egressNetworkPolicy"`
+	Registrars               []string `json:"registrars,omitempty"`
+}
+
+// Change is a single entry of the registration history
+type Change struct {
+	Time    metav1.Time `json:"time"`
+	Type    string      `json:"type"`
+	Actor   string      `json:"actor"`
+	Message string      `json:"message,omitempty"`
+}
+
+// NewCluster maps a cluster of the fleet report into the output schema
+func NewCluster(c controllers.FleetReportCluster) Cluster {
+	cluster := Cluster{
+		Name:                   c.Name,
+		Namespace:              c.Namespace,
+		Platform:               c.Platform,
+		Version:                c.Version,
+		Enabled:                c.Enabled,
+		Registered:             c.Registered,
+		GitOpsNamespace:        c.GitOpsNamespace,
+		Server:                 c.Server,
+		LastRegistrationChange: c.LastRegistrationChange,
+		Available:              c.Available,
+		Degraded:               c.Degraded,
+		State:                  c.State,
+		Reason:                 c.Reason,
+		BoundToken:             c.BoundToken,
+		Excluded:               c.Excluded,
+		ExcludedReason:         c.ExcludedReason,
+		Conditions:             c.Conditions,
+	}
+	if f := c.Features; f != nil {
+		cluster.Features = &Features{
+			DefaultEnrollment:        f.DefaultEnrollment,
+			RegistrationProxy:        f.RegistrationProxy,
+			RemoteHub:                f.RemoteHub,
+			ClientCertificate:        f.ClientCertificate,
+			AuditHeaders:             f.AuditHeaders,
+			ConditionMirroring:       f.ConditionMirroring,
+			BoundServiceAccountToken: f.BoundServiceAccountToken,
+			TopologyLabels:           f.TopologyLabels,
+			WorkersLabel:             f.WorkersLabel,
+			Impersonation:            f.Impersonation,
+			TenantRBAC:               f.TenantRBAC,
+			EgressNetworkPolicy:      f.EgressNetworkPolicy,
+			Registrars:               f.Registrars,
+		}
+	}
+	return cluster
+}
+
+// NewClusterList returns the ClusterList output for the clusters
+func NewClusterList(clusters []Cluster) *ClusterList {
+	return &ClusterList{APIVersion: APIVersion, Kind: "ClusterList", Items: clusters}
+}
+
+// NewClusterStatus returns the ClusterStatus output for the cluster
+func NewClusterStatus(cluster Cluster) *ClusterStatus {
+	return &ClusterStatus{APIVersion: APIVersion, Kind: "ClusterStatus", Cluster: cluster}
+}
+
+// NewRegistrationHistory returns the RegistrationHistory output for the changes of the HostedCluster
+func NewRegistrationHistory(namespace, name string, changes []controllers.RegistrationChange) *RegistrationHistory {
+	history := &RegistrationHistory{APIVersion: APIVersion, Kind: "RegistrationHistory", Namespace: namespace, Name: name, Changes: []Change{}}
+	for _, c := range changes {
+		history.Changes = append(history.Changes, Change{Time: c.Time, Type: c.Type, Actor: c.Actor, Message: c.Message})
+	}
+	return history
+}
+
+// NewClusterExclusion returns the ClusterExclusion output for the HostedClusters that were excluded or included
+func NewClusterExclusion(hcs []hypershiftv1beta1.HostedCluster, excluded bool, reason string) *ClusterExclusion {
+	exclusion := &ClusterExclusion{APIVersion: APIVersion, Kind: "ClusterExclusion", Excluded: excluded, Reason: reason, Items: []ClusterReference{}}
+	for _, hc := range hcs {
+		exclusion.Items = append(exclusion.Items, ClusterReference{Name: hc.Name, Namespace: hc.Namespace})
+	}
+	return exclusion
+}
+
+// NewConfigValidation returns the ConfigValidation output for the operator config file, it is invalid if err is set
+func NewConfigValidation(path string, warnings []string, err error) *ConfigValidation {
+	validation := &ConfigValidation{APIVersion: APIVersion, Kind: "ConfigValidation", Path: path, Valid: err == nil, Warnings: warnings}
+	if err != nil {
+		validation.Error = err.Error()
+	}
+	return validation
+}
+
+func (l *ClusterList) TableHeader() []string {
+	return []string{"NAMESPACE", "NAME", "STATE", "ENABLED", "REGISTERED", "AVAILABLE", "GITOPS NAMESPACE", "SERVER", "REASON"}
+}
+
+func (l *ClusterList) TableRows() [][]string {
+	rows := [][]string{}
+	for _, c := range l.Items {
+		rows = append(rows, []string{c.Namespace, c.Name, c.State, strconv.FormatBool(c.Enabled), strconv.FormatBool(c.Registered),
+			strconv.FormatBool(c.Available), c.GitOpsNamespace, c.Server, c.Reason})
+	}
+	return rows
+}
+
+func (s *ClusterStatus) TableHeader() []string {
+	return []string{"CONDITION", "STATUS", "REASON", "MESSAGE"}
+}
+
+func (s *ClusterStatus) TableRows() [][]string {
+	rows := [][]string{}
+	for _, c := range s.Conditions {
+		rows = append(rows, []string{c.Type, string(c.Status), c.Reason, c.Message})
+	}
+	return rows
+}
+
+func (h *RegistrationHistory) TableHeader() []string {
+	return []string{"TIME", "TYPE", "ACTOR", "MESSAGE"}
+}
+
+func (h *RegistrationHistory) TableRows() [][]string {
+	rows := [][]string{}
+	for _, c := range h.Changes {
+		rows = append(rows, []string{c.Time.UTC().Format(time.RFC3339), c.Type, c.Actor, c.Message})
+	}
+	return rows
+}
+
+func (e *ClusterExclusion) TableHeader() []string {
+	return []string{"NAMESPACE", "NAME", "EXCLUDED", "REASON"}
+}
+
+func (e *ClusterExclusion) TableRows() [][]string {
+	rows := [][]string{}
+	for _, c := range e.Items {
+		rows = append(rows, []string{c.Namespace, c.Name, strconv.FormatBool(e.Excluded), e.Reason})
+	}
+	return rows
+}
+
+func (v *ConfigValidation) TableHeader() []string {
+	return []string{"PATH", "VALID", "MESSAGE"}
+}
+
+func (v *ConfigValidation) TableRows() [][]string {
+	valid := strconv.FormatBool(v.Valid)
+	rows := [][]string{}
+	if v.Error != "" {
+		rows = append(rows, []string{v.Path, valid, v.Error})
+	}
+	for _, warning := range v.Warnings {
+		rows = append(rows, []string{v.Path, valid, "warning: " + warning})
+	}
+	if len(rows) == 0 {
+		rows = append(rows, []string{v.Path, valid, ""})
+	}
+	return rows
+}
+
+// ValidateOutput returns an error if the output format is unknown
+func ValidateOutput(format string) error {
+	switch format {
+	case OutputTable, OutputJSON, OutputYAML, "":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, must be one of %s, %s or %s", format, OutputTable, OutputJSON, OutputYAML)
+}
+
+// Print renders the object in the output format
+func Print(w io.Writer, format string, obj Printable) error {
+	switch format {
+	case OutputJSON:
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case OutputYAML:
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case OutputTable, "":
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(obj.TableHeader(), "\t"))
+		for _, row := range obj.TableRows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return ValidateOutput(format)
+	}
+}
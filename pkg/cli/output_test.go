@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+var _ = Describe("Output", func() {
+	clusters := []Cluster{{Name: "hosted", Namespace: "clusters", Enabled: true, Registered: true, Server: "https://hosted:6443"}}
+
+	It("Should print the versioned schema as JSON", func() {
+		out := &bytes.Buffer{}
+		Expect(Print(out, OutputJSON, NewClusterList(clusters))).To(Succeed())
+		Expect(out.String()).To(ContainSubstring(`"apiVersion": "` + APIVersion + `"`))
+		Expect(out.String()).To(ContainSubstring(`"kind": "ClusterList"`))
+		Expect(out.String()).To(ContainSubstring(`"server": "https://hosted:6443"`))
+	})
+
+	It("Should inline the cluster in the status output", func() {
+		out := &bytes.Buffer{}
+		status := NewClusterStatus(clusters[0])
+		status.Conditions = []metav1.Condition{{Type: "DuplicateServer", Status: metav1.ConditionFalse, Reason: "UniqueServer"}}
+		Expect(Print(out, OutputYAML, status)).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("kind: ClusterStatus\n"))
+		Expect(out.String()).To(ContainSubstring("name: hosted\n"))
+		Expect(out.String()).To(ContainSubstring("reason: UniqueServer\n"))
+	})
+
+	It("Should print a table by default", func() {
+		out := &bytes.Buffer{}
+		Expect(Print(out, "", NewClusterList(clusters))).To(Succeed())
+		Expect(out.String()).To(HavePrefix("NAMESPACE"))
+		Expect(out.String()).To(ContainSubstring("clusters    hosted"))
+	})
+
+	It("Should print the registration history", func() {
+		out := &bytes.Buffer{}
+		changes := []controllers.RegistrationChange{{
+			Time:    metav1.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+			Type:    controllers.ChangeTypeCredentialsRotated,
+			Actor:   controllers.ChangeActorRotation,
+			Message: "rotated token",
+		}}
+		Expect(Print(out, "", NewRegistrationHistory("clusters", "hosted", changes))).To(Succeed())
+		Expect(out.String()).To(HavePrefix("TIME"))
+		Expect(out.String()).To(ContainSubstring("2023-05-01T12:00:00Z   CredentialsRotated   rotation   rotated token"))
+	})
+
+	It("Should print the excluded clusters", func() {
+		hcs := []hypershiftv1beta1.HostedCluster{{ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: "clusters"}}}
+		out := &bytes.Buffer{}
+		Expect(Print(out, OutputJSON, NewClusterExclusion(hcs, true, "INC-42"))).To(Succeed())
+		Expect(out.String()).To(MatchJSON(`{"apiVersion": "` + APIVersion + `", "kind": "ClusterExclusion", "excluded": true,
+			"reason": "INC-42", "items": [{"name": "hosted", "namespace": "clusters"}]}`))
+		out.Reset()
+		Expect(Print(out, "", NewClusterExclusion(hcs, false, ""))).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("clusters    hosted   false"))
+	})
+
+	It("Should print the validation of the operator config", func() {
+		out := &bytes.Buffer{}
+		Expect(Print(out, OutputYAML, NewConfigValidation("config.yaml", []string{"namespace gitops not found"}, nil))).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("kind: ConfigValidation\n"))
+		Expect(out.String()).To(ContainSubstring("valid: true\n"))
+		Expect(out.String()).To(ContainSubstring("- namespace gitops not found\n"))
+		out.Reset()
+		Expect(Print(out, "", NewConfigValidation("config.yaml", nil, errors.New("invalid policy")))).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("config.yaml   false   invalid policy"))
+	})
+
+	It("Should map the clusters of the fleet report into the output schema", func() {
+		report := controllers.FleetReportCluster{
+			Name: "hosted", Namespace: "clusters", Platform: "KubeVirt", Version: "4.14.0", Enabled: true, Registered: true,
+			GitOpsNamespace: "openshift-gitops", Server: "https://hosted:6443", LastRegistrationChange: "2023-05-01T12:00:00Z",
+			Available: true, State: controllers.ClusterStateRegistered, BoundToken: true, Excluded: true, ExcludedReason: "maintenance",
+			Features:   &controllers.RegistrationFeatures{BoundServiceAccountToken: true, Registrars: []string{"flux"}},
+			Conditions: []metav1.Condition{{Type: "DuplicateServer", Status: metav1.ConditionFalse, Reason: "UniqueServer"}},
+		}
+		expected, err := json.Marshal(report)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(json.Marshal(NewCluster(report))).To(MatchJSON(expected))
+	})
+
+	It("Should reject unknown output formats", func() {
+		Expect(ValidateOutput("xml")).NotTo(Succeed())
+		Expect(Print(&bytes.Buffer{}, "xml", NewClusterList(clusters))).NotTo(Succeed())
+	})
+})
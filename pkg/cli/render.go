@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	hypershiftv1beta1 "github.com/openshift/hypershift/api/v1beta1"
+	"sigs.k8s.io/yaml"
+
+	hyperopsv1alpha1 "github.com/cldmnky/hyper-ops/api/v1alpha1"
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+// ReadHostedCluster reads a HostedCluster manifest, unknown fields are rejected
+func ReadHostedCluster(path string) (*hypershiftv1beta1.HostedCluster, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hc := &hypershiftv1beta1.HostedCluster{}
+	if err := yaml.UnmarshalStrict(raw, hc); err != nil {
+		return nil, fmt.Errorf("unable to parse HostedCluster %s: %w", path, err)
+	}
+	if hc.Kind != "HostedCluster" {
+		return nil, fmt.Errorf("%s is a %q, not a HostedCluster", path, hc.Kind)
+	}
+	if hc.Name == "" || hc.Namespace == "" {
+		return nil, fmt.Errorf("HostedCluster %s needs a name and a namespace", path)
+	}
+	return hc, nil
+}
+
+// RenderServer returns the API server of the hosted cluster rendered by default, the control plane endpoint of the
+// HostedCluster status
+func RenderServer(hc *hypershiftv1beta1.HostedCluster) (string, error) {
+	endpoint := hc.Status.ControlPlaneEndpoint
+	if endpoint.Host == "" {
+		return "", fmt.Errorf("the HostedCluster has no control plane endpoint")
+	}
+	return fmt.Sprintf("https://%s:%d", endpoint.Host, endpoint.Port), nil
+}
+
+// ReadPolicies reads and compiles the registration policies of a file holding a single policy or a list of them,
+// in the format of registration.policies of the operator config
+func ReadPolicies(path string) ([]*controllers.RegistrationPolicy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policies := []hyperopsv1alpha1.RegistrationPolicy{}
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("-")) {
+		err = yaml.UnmarshalStrict(raw, &policies)
+	} else {
+		policy := hyperopsv1alpha1.RegistrationPolicy{}
+		err = yaml.UnmarshalStrict(raw, &policy)
+		policies = append(policies, policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse registration policies %s: %w", path, err)
+	}
+	return controllers.CompilePolicies(policies)
+}
+
+// PrintRendered renders the outputs of a rendered registration as YAML documents. The data of the secrets is printed
+// as stringData, so changes of the rendered config are readable in diffs. A skipped registration is printed as a
+// comment.
+func PrintRendered(w io.Writer, rendered *controllers.RenderedRegistration) error {
+	if rendered.Skipped != "" {
+		_, err := fmt.Fprintf(w, "# not registered: %s\n", rendered.Skipped)
+		return err
+	}
+	for i, secret := range rendered.Secrets {
+		secret = secret.DeepCopy()
+		secret.StringData = map[string]string{}
+		for k, v := range secret.Data {
+			secret.StringData[k] = string(v)
+		}
+		secret.Data = nil
+		data, err := yaml.Marshal(secret)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(w, "---"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
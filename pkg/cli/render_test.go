@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cldmnky/hyper-ops/controllers"
+)
+
+var _ = Describe("Render", func() {
+	write := func(name, content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), name)
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	It("Should read HostedCluster manifests", func() {
+		hc, err := ReadHostedCluster(write("hc.yaml", `apiVersion: hypershift.openshift.io/v1beta1
+kind: HostedCluster
+metadata:
+  name: hosted
+  namespace: clusters
+spec:
+  infraID: hosted-x7k2p
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hc.Spec.InfraID).To(Equal("hosted-x7k2p"))
+
+		_, err = ReadHostedCluster(write("nodepool.yaml", "kind: NodePool\nmetadata:\n  name: pool\n  namespace: clusters\n"))
+		Expect(err).To(HaveOccurred())
+		_, err = ReadHostedCluster(write("typo.yaml", "kind: HostedCluster\nmetadata:\n  name: hosted\n  namespace: clusters\nspec:\n  infraName: x\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should read a single policy or a list of policies", func() {
+		policies, err := ReadPolicies(write("policy.yaml", "name: tier\nlabels: '{\"tier\": \"gold\"}'\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(HaveLen(1))
+
+		policies, err = ReadPolicies(write("policies.yaml", "- name: tier\n  labels: '{\"tier\": \"gold\"}'\n- name: prod\n  validate: 'true'\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policies).To(HaveLen(2))
+
+		_, err = ReadPolicies(write("invalid.yaml", "name: broken\nvalidate: 'hostedCluster.'\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should print the rendered secrets with readable data", func() {
+		secret := func(namespace string) *corev1.Secret {
+			return &corev1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: metav1.ObjectMeta{Name: "hosted", Namespace: namespace},
+				Data:       map[string][]byte{"server": []byte("https://api.hosted:6443")},
+			}
+		}
+		out := &bytes.Buffer{}
+		Expect(PrintRendered(out, &controllers.RenderedRegistration{Secrets: []*corev1.Secret{secret("openshift-gitops"), secret("team-gitops")}})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("stringData:\n  server: https://api.hosted:6443\n"))
+		Expect(out.String()).To(ContainSubstring("namespace: openshift-gitops\n"))
+		Expect(out.String()).To(ContainSubstring("\n---\n"))
+		Expect(out.String()).NotTo(ContainSubstring("\ndata:"))
+
+		out.Reset()
+		Expect(PrintRendered(out, &controllers.RenderedRegistration{Skipped: "vetoed"})).To(Succeed())
+		Expect(out.String()).To(Equal("# not registered: vetoed\n"))
+	})
+})
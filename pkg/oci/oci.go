@@ -0,0 +1,267 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oci pulls the layers of OCI artifacts from registries implementing the OCI distribution API, e.g. YAML
+// manifests pushed with oras. Anonymous pulls and the bearer token flow of public registries are supported.
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// maxBlobSize caps the size of the manifests and layers read from a registry
+	maxBlobSize = 10 << 20
+)
+
+// Reference is a parsed artifact reference, registry/repository followed by :tag or @digest
+type Reference struct {
+	Registry   string
+	Repository string
+	// Reference is the tag or the digest of the artifact
+	Reference string
+}
+
+// String returns the reference in the form it was parsed from
+func (r Reference) String() string {
+	if strings.HasPrefix(r.Reference, "sha256:") {
+		return fmt.Sprintf("%s/%s@%s", r.Registry, r.Repository, r.Reference)
+	}
+	return fmt.Sprintf("%s/%s:%s", r.Registry, r.Repository, r.Reference)
+}
+
+// ParseReference parses an artifact reference. The registry is required, the tag defaults to latest.
+func ParseReference(raw string) (Reference, error) {
+	name, ref := raw, "latest"
+	if i := strings.Index(raw, "@"); i >= 0 {
+		name, ref = raw[:i], raw[i+1:]
+		if !strings.HasPrefix(ref, "sha256:") {
+			return Reference{}, fmt.Errorf("invalid artifact reference %q, only sha256 digests are supported", raw)
+		}
+	} else if i := strings.LastIndex(raw, ":"); i > strings.LastIndex(raw, "/") {
+		name, ref = raw[:i], raw[i+1:]
+	}
+	registry, repository, ok := strings.Cut(name, "/")
+	if !ok || repository == "" || ref == "" || !(strings.ContainsAny(registry, ".:") || registry == "localhost") {
+		return Reference{}, fmt.Errorf("invalid artifact reference %q, must be <registry>/<repository>[:<tag>|@<digest>]", raw)
+	}
+	return Reference{Registry: registry, Repository: repository, Reference: ref}, nil
+}
+
+// Layer is a layer of a pulled artifact
+type Layer struct {
+	MediaType string
+	Digest    string
+	Content   []byte
+}
+
+// Artifact is a pulled artifact
+type Artifact struct {
+	// Digest is the digest of the manifest of the artifact
+	Digest string
+	Layers []Layer
+}
+
+// Puller pulls artifacts from registries
+type Puller struct {
+	// Client sends the requests, http.DefaultClient if nil
+	Client *http.Client
+	// PlainHTTP talks to the registries without TLS
+	PlainHTTP bool
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// Pull fetches the manifest and the layers of the artifact, the digests of the layers are verified
+func (p *Puller) Pull(ctx context.Context, ref Reference) (*Artifact, error) {
+	token := ""
+	body, header, err := p.get(ctx, ref, "manifests/"+ref.Reference, mediaTypeOCIManifest+", "+mediaTypeDockerManifest, &token)
+	if err != nil {
+		return nil, err
+	}
+	m := manifest{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("unable to parse the manifest of %s: %w", ref, err)
+	}
+	artifact := &Artifact{Digest: header.Get("Docker-Content-Digest")}
+	if artifact.Digest == "" {
+		artifact.Digest = digest(body)
+	}
+	if strings.HasPrefix(ref.Reference, "sha256:") && digest(body) != ref.Reference {
+		return nil, fmt.Errorf("the manifest of %s doesn't match its digest", ref)
+	}
+	for _, layer := range m.Layers {
+		content, _, err := p.get(ctx, ref, "blobs/"+layer.Digest, "", &token)
+		if err != nil {
+			return nil, err
+		}
+		if digest(content) != layer.Digest {
+			return nil, fmt.Errorf("layer %s of %s doesn't match its digest", layer.Digest, ref)
+		}
+		artifact.Layers = append(artifact.Layers, Layer{MediaType: layer.MediaType, Digest: layer.Digest, Content: content})
+	}
+	return artifact, nil
+}
+
+// get reads a manifest or blob of the repository. An unauthorized request is retried with an anonymous token of
+// the bearer challenge, which is kept for the following requests.
+func (p *Puller) get(ctx context.Context, ref Reference, path, accept string, token *string) ([]byte, http.Header, error) {
+	scheme := "https"
+	if p.PlainHTTP {
+		scheme = "http"
+	}
+	u := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Registry, ref.Repository, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if *token != "" {
+			req.Header.Set("Authorization", "Bearer "+*token)
+		}
+		resp, err := p.client().Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to pull %s: %w", ref, err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to pull %s: %w", ref, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if *token, err = p.anonymousToken(ctx, ref, resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("unable to pull %s/%s: %s", ref, path, resp.Status)
+		}
+		if len(body) > maxBlobSize {
+			return nil, nil, fmt.Errorf("%s of %s exceeds %d bytes", path, ref, maxBlobSize)
+		}
+		return body, resp.Header, nil
+	}
+}
+
+// anonymousToken requests a pull token from the realm of a bearer challenge
+func (p *Puller) anonymousToken(ctx context.Context, ref Reference, challenge string) (string, error) {
+	params, ok := parseBearerChallenge(challenge)
+	if !ok || params["realm"] == "" {
+		return "", fmt.Errorf("unable to pull %s: the registry requires authentication", ref)
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %q: %w", params["realm"], err)
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to request a pull token for %s: %w", ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to request a pull token for %s: %s", ref, resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBlobSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("unable to parse the pull token for %s: %w", ref, err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+func (p *Puller) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+// parseBearerChallenge returns the parameters of a Bearer WWW-Authenticate challenge
+func parseBearerChallenge(challenge string) (map[string]string, bool) {
+	scheme, rest, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil, false
+	}
+	params := map[string]string{}
+	for rest != "" {
+		var kv string
+		// values are quoted and may contain commas, e.g. scopes of several repositories
+		key, value, ok := strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+			kv, rest = value[1:end+1], value[end+2:]
+		} else {
+			kv, rest, _ = strings.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = kv
+	}
+	return params, true
+}
+
+// digest returns the sha256 digest of the content
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
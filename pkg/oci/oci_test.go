@@ -0,0 +1,106 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OCI", func() {
+	It("Should parse artifact references", func() {
+		ref, err := ParseReference("quay.io/example/baseline:v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal(Reference{Registry: "quay.io", Repository: "example/baseline", Reference: "v1"}))
+		Expect(ref.String()).To(Equal("quay.io/example/baseline:v1"))
+
+		ref, err = ParseReference("localhost:5000/baseline")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal(Reference{Registry: "localhost:5000", Repository: "baseline", Reference: "latest"}))
+
+		digested := "sha256:" + strings.Repeat("a", 64)
+		ref, err = ParseReference("registry.example.com/baseline@" + digested)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref.Reference).To(Equal(digested))
+		Expect(ref.String()).To(Equal("registry.example.com/baseline@" + digested))
+
+		for _, invalid := range []string{"baseline", "example/baseline:v1", "quay.io/", "quay.io/baseline@md5:abc"} {
+			_, err := ParseReference(invalid)
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+	})
+
+	It("Should parse bearer challenges", func() {
+		params, ok := parseBearerChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a:pull,push"`)
+		Expect(ok).To(BeTrue())
+		Expect(params).To(Equal(map[string]string{
+			"realm":   "https://auth.example.com/token",
+			"service": "registry.example.com",
+			"scope":   "repository:a:pull,push",
+		}))
+		_, ok = parseBearerChallenge(`Basic realm="registry"`)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should pull the layers with an anonymous token", func() {
+		layer := []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: team-a\n")
+		manifestBody, _ := json.Marshal(manifest{
+			MediaType: mediaTypeOCIManifest,
+			Layers:    []descriptor{{MediaType: "application/yaml", Digest: digest(layer), Size: int64(len(layer))}},
+		})
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/token":
+				Expect(r.URL.Query().Get("scope")).To(Equal("repository:example/baseline:pull"))
+				_, _ = w.Write([]byte(`{"token":"anonymous"}`))
+			case r.Header.Get("Authorization") != "Bearer anonymous":
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry"`, srv.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+			case r.URL.Path == "/v2/example/baseline/manifests/v1":
+				Expect(r.Header.Get("Accept")).To(ContainSubstring(mediaTypeOCIManifest))
+				_, _ = w.Write(manifestBody)
+			case r.URL.Path == "/v2/example/baseline/blobs/"+digest(layer):
+				_, _ = w.Write(layer)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+		host := strings.TrimPrefix(srv.URL, "http://")
+		puller := &Puller{PlainHTTP: true}
+
+		artifact, err := puller.Pull(context.Background(), Reference{Registry: host, Repository: "example/baseline", Reference: "v1"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact.Digest).To(Equal(digest(manifestBody)))
+		Expect(artifact.Layers).To(HaveLen(1))
+		Expect(artifact.Layers[0].MediaType).To(Equal("application/yaml"))
+		Expect(artifact.Layers[0].Content).To(Equal(layer))
+
+		_, err = puller.Pull(context.Background(), Reference{Registry: host, Repository: "example/baseline", Reference: "v2"})
+		Expect(err).To(MatchError(ContainSubstring("404")))
+		_, err = puller.Pull(context.Background(), Reference{Registry: host, Repository: "example/baseline", Reference: "sha256:" + strings.Repeat("0", 64)})
+		Expect(err).To(HaveOccurred())
+	})
+})
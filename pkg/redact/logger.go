@@ -0,0 +1,73 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// NewLogger returns a logger redacting the messages, values and errors before they are passed to the sink of l
+func NewLogger(l logr.Logger) logr.Logger {
+	sink := l.GetSink()
+	if sink == nil {
+		return l
+	}
+	// account for the frame of the redacting sink
+	if withCallDepth, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = withCallDepth.WithCallDepth(1)
+	}
+	return logr.New(&logSink{sink: sink})
+}
+
+// logSink redacts everything before it is passed to the wrapped sink
+type logSink struct {
+	sink logr.LogSink
+}
+
+var _ logr.LogSink = &logSink{}
+var _ logr.CallDepthLogSink = &logSink{}
+
+// Init is a no-op, the wrapped sink was initialized by its logger and the call depth of the redacting sink is added
+// in NewLogger
+func (s *logSink) Init(logr.RuntimeInfo) {}
+
+func (s *logSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *logSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.sink.Info(level, String(msg), KeysAndValues(keysAndValues)...)
+}
+
+func (s *logSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.sink.Error(Error(err), String(msg), KeysAndValues(keysAndValues)...)
+}
+
+func (s *logSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &logSink{sink: s.sink.WithValues(KeysAndValues(keysAndValues)...)}
+}
+
+func (s *logSink) WithName(name string) logr.LogSink {
+	return &logSink{sink: s.sink.WithName(name)}
+}
+
+func (s *logSink) WithCallDepth(depth int) logr.LogSink {
+	if withCallDepth, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &logSink{sink: withCallDepth.WithCallDepth(depth)}
+	}
+	return s
+}
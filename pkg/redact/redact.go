@@ -0,0 +1,240 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redact scrubs credentials from values before they are logged
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// Redacted replaces redacted values
+const Redacted = "REDACTED"
+
+var (
+	// jwtPattern matches JSON web tokens, e.g. service account tokens
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	// pemPattern matches PEM encoded certificates and keys
+	pemPattern = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----[^-]*-----END [A-Z0-9 ]+-----`)
+	// credentialFieldPattern matches credential fields of kubeconfigs, headers and key=value pairs
+	credentialFieldPattern = regexp.MustCompile(`(?i)((?:token|client-key-data|client-certificate-data|certificate-authority-data|password|authorization)"?\s*[:=]\s*"?)(?:bearer\s+)?[^\s",}]+`)
+
+	// sensitiveFields are the lower case names of struct and map fields whose values are always redacted
+	sensitiveFields = map[string]bool{
+		"token":                      true,
+		"bearertoken":                true,
+		"password":                   true,
+		"cadata":                     true,
+		"certdata":                   true,
+		"keydata":                    true,
+		"kubeconfig":                 true,
+		"signingkey":                 true,
+		"client-key-data":            true,
+		"client-certificate-data":    true,
+		"certificate-authority-data": true,
+	}
+)
+
+// String scrubs tokens, PEM blocks and credential fields from the string
+func String(s string) string {
+	s = pemPattern.ReplaceAllString(s, Redacted)
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	return credentialFieldPattern.ReplaceAllString(s, "${1}"+Redacted)
+}
+
+// Error returns an error with the message of err scrubbed, nil if err is nil
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+// Unwrap keeps errors.Is and errors.As working on redacted errors
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Value returns a copy of the value that is safe to log. Secrets keep their keys but lose their values, rest
+// configs are rendered through their redacting String method, and other structs, maps and slices are converted to
+// their JSON representation with sensitive fields redacted and strings scrubbed.
+func Value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return String(v)
+	case []byte:
+		return String(string(v))
+	case error:
+		return Error(v)
+	case *rest.Config:
+		return v.String()
+	case rest.Config:
+		return v.String()
+	case *corev1.Secret:
+		if v == nil {
+			return nil
+		}
+		return secret(v)
+	case corev1.Secret:
+		return secret(&v)
+	case *corev1.SecretList:
+		if v == nil {
+			return nil
+		}
+		items := make([]interface{}, 0, len(v.Items))
+		for i := range v.Items {
+			items = append(items, secret(&v.Items[i]))
+		}
+		return items
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return v
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		// types with a custom String method like object keys are logged as strings, objects as structures
+		if stringer, ok := v.(fmt.Stringer); ok && !kubernetesObject(v) {
+			return String(stringer.String())
+		}
+		return structure(v)
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return structure(v)
+	}
+	return v
+}
+
+// KeysAndValues returns the log key value pairs with every value redacted, values of sensitive keys are replaced
+func KeysAndValues(keysAndValues []interface{}) []interface{} {
+	redacted := make([]interface{}, len(keysAndValues))
+	for i, kv := range keysAndValues {
+		if i%2 == 0 {
+			redacted[i] = kv
+			continue
+		}
+		if key, ok := keysAndValues[i-1].(string); ok && sensitiveFields[strings.ToLower(key)] {
+			redacted[i] = Redacted
+			continue
+		}
+		redacted[i] = Value(kv)
+	}
+	return redacted
+}
+
+// kubernetesObject returns true for values with object metadata
+func kubernetesObject(v interface{}) bool {
+	_, ok := v.(interface{ GetNamespace() string })
+	return ok
+}
+
+// structure converts the value to its JSON representation and redacts it
+func structure(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<unable to redact %T>", v)
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return fmt.Sprintf("<unable to redact %T>", v)
+	}
+	return walk(generic)
+}
+
+// walk redacts the sensitive fields and scrubs the strings of a JSON value
+func walk(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		secret := v["kind"] == "Secret"
+		for k, value := range v {
+			if sensitiveFields[strings.ToLower(k)] || (secret && (k == "data" || k == "stringData")) {
+				v[k] = redactField(value)
+				continue
+			}
+			v[k] = walk(value)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = walk(v[i])
+		}
+		return v
+	case string:
+		return String(v)
+	}
+	return v
+}
+
+// redactField redacts a sensitive field, maps keep their keys
+func redactField(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		redacted := map[string]interface{}{}
+		for k := range m {
+			redacted[k] = Redacted
+		}
+		return redacted
+	}
+	return Redacted
+}
+
+// secret returns the secret as a structure with the values of data and stringData redacted
+func secret(s *corev1.Secret) interface{} {
+	out := s.DeepCopy()
+	for k := range out.Data {
+		out.Data[k] = []byte(Redacted)
+	}
+	for k := range out.StringData {
+		out.StringData[k] = Redacted
+	}
+	// the last applied configuration contains the data of the secret
+	if _, ok := out.Annotations[corev1.LastAppliedConfigAnnotation]; ok {
+		out.Annotations[corev1.LastAppliedConfigAnnotation] = Redacted
+	}
+	generic := structure(out)
+	if m, ok := generic.(map[string]interface{}); ok {
+		// []byte values are base64 encoded by JSON, show the placeholder instead
+		if data, ok := m["data"].(map[string]interface{}); ok {
+			for k := range data {
+				data[k] = Redacted
+			}
+		}
+	}
+	return generic
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Client sends signed registration payloads to a registration proxy
+type Client struct {
+	URL        string
+	SigningKey []byte
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the proxy at url, trusting the PEM encoded caData if set
+func NewClient(url string, signingKey []byte, caData []byte) (*Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in registration proxy CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &Client{
+		URL:        strings.TrimSuffix(url, "/"),
+		SigningKey: signingKey,
+		HTTPClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Apply asks the proxy to create or update the secret
+func (c *Client) Apply(ctx context.Context, secret *corev1.Secret) error {
+	return c.send(ctx, &Payload{Operation: OperationApply, Secret: secret})
+}
+
+// Delete asks the proxy to delete the secret
+func (c *Client) Delete(ctx context.Context, secret *corev1.Secret) error {
+	return c.send(ctx, &Payload{Operation: OperationDelete, Secret: secret})
+}
+
+func (c *Client) send(ctx context.Context, payload *Payload) error {
+	payload.Timestamp = time.Now().UTC()
+	nonce, err := NewNonce()
+	if err != nil {
+		return err
+	}
+	payload.Nonce = nonce
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+RegistrationPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(c.SigningKey, body))
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("registration proxy returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package regproxy implements the registration proxy, a small HTTPS service running next to ArgoCD
+// in a gitops cluster that hyper-ops cannot reach through the Kubernetes API. hyper-ops sends signed
+// registration payloads to the proxy, which applies the ArgoCD cluster secrets locally.
+package regproxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 signature of the request body
+	SignatureHeader = "X-Hyper-Ops-Signature"
+	// RegistrationPath is the path the proxy accepts registration payloads on
+	RegistrationPath = "/v1/registrations"
+
+	// MaxPayloadAge is how old a payload may be before the proxy rejects it as a replay
+	MaxPayloadAge = 5 * time.Minute
+
+	// ManagedByLabel and ManagedByValue mark the secrets written by hyper-ops, the proxy only overwrites and deletes
+	// existing secrets carrying them or the HostedClusterAnnotation
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "hyper-ops"
+	// HostedClusterAnnotation names the HostedCluster an ArgoCD cluster secret of hyper-ops was written for
+	HostedClusterAnnotation = "hyper-ops.cloudmonkey.org/hosted-cluster"
+)
+
+// Operation is the action the proxy should take for a payload
+type Operation string
+
+const (
+	OperationApply  Operation = "apply"
+	OperationDelete Operation = "delete"
+)
+
+// Payload is a single registration request sent from hyper-ops to the proxy
+type Payload struct {
+	Operation Operation `json:"operation"`
+	Timestamp time.Time `json:"timestamp"`
+	// Nonce is unique per payload, the proxy rejects a nonce it has seen within MaxPayloadAge as a replay
+	Nonce  string         `json:"nonce"`
+	Secret *corev1.Secret `json:"secret"`
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature of body using key
+func Sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewNonce returns a random nonce for a payload
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Verify checks that signature is a valid signature of body using key
+func Verify(key, body []byte, signature string) error {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package regproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("Registration proxy", func() {
+	var (
+		ctx     context.Context
+		k8s     client.Client
+		srv     *httptest.Server
+		secret  *corev1.Secret
+		signKey = []byte("shared-key")
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		k8s = fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+		srv = httptest.NewServer(&Server{
+			Client:            k8s,
+			SigningKey:        signKey,
+			AllowedNamespaces: []string{"openshift-gitops"},
+			Log:               logr.Discard(),
+		})
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cluster",
+				Namespace: "openshift-gitops",
+				Labels:    map[string]string{argocd.SecretTypeLabel: argocd.SecretTypeCluster, ManagedByLabel: ManagedByValue},
+			},
+			Data: map[string][]byte{"server": []byte("https://cluster:6443")},
+		}
+	})
+
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("Should verify signatures", func() {
+		sig := Sign(signKey, []byte("body"))
+		Expect(Verify(signKey, []byte("body"), sig)).To(Succeed())
+		Expect(Verify(signKey, []byte("other"), sig)).NotTo(Succeed())
+		Expect(Verify([]byte("wrong"), []byte("body"), sig)).NotTo(Succeed())
+	})
+
+	It("Should apply and delete signed payloads", func() {
+		c := &Client{URL: srv.URL, SigningKey: signKey, HTTPClient: http.DefaultClient}
+		Expect(c.Apply(ctx, secret)).To(Succeed())
+
+		applied := &corev1.Secret{}
+		Expect(k8s.Get(ctx, client.ObjectKeyFromObject(secret), applied)).To(Succeed())
+		Expect(applied.Data).To(HaveKeyWithValue("server", []byte("https://cluster:6443")))
+
+		Expect(c.Delete(ctx, secret)).To(Succeed())
+		err := k8s.Get(ctx, client.ObjectKeyFromObject(secret), applied)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should reject payloads signed with another key", func() {
+		c := &Client{URL: srv.URL, SigningKey: []byte("other-key"), HTTPClient: http.DefaultClient}
+		Expect(c.Apply(ctx, secret)).NotTo(Succeed())
+	})
+
+	It("Should reject payloads for namespaces that are not allowed", func() {
+		c := &Client{URL: srv.URL, SigningKey: signKey, HTTPClient: http.DefaultClient}
+		secret.Namespace = "kube-system"
+		Expect(c.Apply(ctx, secret)).NotTo(Succeed())
+	})
+
+	It("Should reject secrets that are not ArgoCD cluster secrets", func() {
+		c := &Client{URL: srv.URL, SigningKey: signKey, HTTPClient: http.DefaultClient}
+		secret.Labels = nil
+		Expect(c.Apply(ctx, secret)).NotTo(Succeed())
+	})
+
+	It("Should leave existing secrets that are not managed by hyper-ops alone", func() {
+		foreign := secret.DeepCopy()
+		foreign.Labels = map[string]string{argocd.SecretTypeLabel: argocd.SecretTypeCluster}
+		foreign.Data = map[string][]byte{"server": []byte("https://foreign:6443")}
+		Expect(k8s.Create(ctx, foreign)).To(Succeed())
+
+		c := &Client{URL: srv.URL, SigningKey: signKey, HTTPClient: http.DefaultClient}
+		Expect(c.Apply(ctx, secret)).To(MatchError(ContainSubstring("not managed by hyper-ops")))
+		Expect(c.Delete(ctx, secret)).To(MatchError(ContainSubstring("not managed by hyper-ops")))
+
+		existing := &corev1.Secret{}
+		Expect(k8s.Get(ctx, client.ObjectKeyFromObject(secret), existing)).To(Succeed())
+		Expect(existing.Data).To(HaveKeyWithValue("server", []byte("https://foreign:6443")))
+	})
+
+	It("Should reject replayed payloads", func() {
+		nonce, err := NewNonce()
+		Expect(err).NotTo(HaveOccurred())
+		body, err := json.Marshal(&Payload{Operation: OperationApply, Timestamp: time.Now().UTC(), Nonce: nonce, Secret: secret})
+		Expect(err).NotTo(HaveOccurred())
+		send := func() int {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+RegistrationPath, bytes.NewReader(body))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set(SignatureHeader, Sign(signKey, body))
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			return resp.StatusCode
+		}
+		Expect(send()).To(Equal(http.StatusNoContent))
+		Expect(send()).To(Equal(http.StatusConflict))
+	})
+})
@@ -0,0 +1,202 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package regproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+const maxPayloadSize = 1 << 20
+
+// errNotManaged is returned for payloads targeting an existing secret that was not written by hyper-ops
+var errNotManaged = errors.New("secret is not managed by hyper-ops")
+
+// Server is an http.Handler applying signed registration payloads to the local cluster
+type Server struct {
+	Client     client.Client
+	SigningKey []byte
+	// AllowedNamespaces restricts the namespaces secrets may be written to, all namespaces are allowed if empty
+	AllowedNamespaces []string
+	Log               logr.Logger
+
+	mu sync.Mutex
+	// nonces are the nonces of the accepted payloads and when they leave the accepted window
+	nonces map[string]time.Time
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != RegistrationPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+	if err := Verify(s.SigningKey, body, r.Header.Get(SignatureHeader)); err != nil {
+		s.Log.Info("rejected registration payload", "reason", err.Error(), "remote", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	payload := &Payload{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		http.Error(w, "malformed payload", http.StatusBadRequest)
+		return
+	}
+	if err := s.validate(payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.claimNonce(payload) {
+		s.Log.Info("rejected registration payload", "reason", "replayed nonce", "remote", r.RemoteAddr)
+		http.Error(w, "replayed payload", http.StatusConflict)
+		return
+	}
+	if err := s.handle(r, payload); err != nil {
+		if errors.Is(err, errNotManaged) {
+			s.Log.Info("rejected registration payload", "reason", err.Error(), "operation", payload.Operation, "secret", client.ObjectKeyFromObject(payload.Secret))
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		s.Log.Error(err, "unable to apply registration payload", "operation", payload.Operation, "secret", client.ObjectKeyFromObject(payload.Secret))
+		http.Error(w, "unable to apply payload", http.StatusInternalServerError)
+		return
+	}
+	s.Log.Info("applied registration payload", "operation", payload.Operation, "secret", client.ObjectKeyFromObject(payload.Secret))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) validate(payload *Payload) error {
+	if age := time.Since(payload.Timestamp); age > MaxPayloadAge || age < -MaxPayloadAge {
+		return fmt.Errorf("payload timestamp outside of the accepted window")
+	}
+	if payload.Nonce == "" {
+		return fmt.Errorf("payload has no nonce")
+	}
+	if payload.Secret == nil || payload.Secret.Name == "" || payload.Secret.Namespace == "" {
+		return fmt.Errorf("payload does not reference a secret")
+	}
+	if len(s.AllowedNamespaces) > 0 {
+		allowed := false
+		for _, ns := range s.AllowedNamespaces {
+			if ns == payload.Secret.Namespace {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("namespace %s is not allowed", payload.Secret.Namespace)
+		}
+	}
+	switch payload.Operation {
+	case OperationApply:
+		// the proxy only ever manages ArgoCD cluster secrets
+		if payload.Secret.Labels[argocd.SecretTypeLabel] != argocd.SecretTypeCluster {
+			return fmt.Errorf("secret is not an ArgoCD cluster secret")
+		}
+	case OperationDelete:
+	default:
+		return fmt.Errorf("unknown operation %q", payload.Operation)
+	}
+	return nil
+}
+
+// claimNonce records the nonce of the payload and returns false if it was already seen, nonces are forgotten once
+// their payloads would be rejected as too old
+func (s *Server) claimNonce(payload *Payload) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.nonces == nil {
+		s.nonces = map[string]time.Time{}
+	}
+	for nonce, expires := range s.nonces {
+		if now.After(expires) {
+			delete(s.nonces, nonce)
+		}
+	}
+	if _, seen := s.nonces[payload.Nonce]; seen {
+		return false
+	}
+	s.nonces[payload.Nonce] = payload.Timestamp.Add(MaxPayloadAge)
+	return true
+}
+
+// managed returns true if the secret was written by hyper-ops
+func managed(secret *corev1.Secret) bool {
+	if secret.Labels[ManagedByLabel] == ManagedByValue {
+		return true
+	}
+	_, ok := secret.Annotations[HostedClusterAnnotation]
+	return ok
+}
+
+func (s *Server) handle(r *http.Request, payload *Payload) error {
+	ctx := r.Context()
+	desired := payload.Secret
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      desired.Name,
+			Namespace: desired.Namespace,
+		},
+	}
+	if payload.Operation == OperationDelete {
+		if err := s.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		// never delete secrets that are not ArgoCD cluster secrets
+		if secret.Labels[argocd.SecretTypeLabel] != argocd.SecretTypeCluster {
+			return nil
+		}
+		if !managed(secret) {
+			return errNotManaged
+		}
+		return client.IgnoreNotFound(s.Client.Delete(ctx, secret, client.Preconditions{UID: &secret.UID, ResourceVersion: &secret.ResourceVersion}))
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, s.Client, secret, func() error {
+		// secrets written by others, e.g. by hand or by ACM, are never taken over
+		if secret.ResourceVersion != "" && !managed(secret) {
+			return errNotManaged
+		}
+		secret.Labels = desired.Labels
+		for k, v := range desired.Annotations {
+			metav1.SetMetaDataAnnotation(&secret.ObjectMeta, k, v)
+		}
+		secret.Data = desired.Data
+		secret.Type = corev1.SecretTypeOpaque
+		return nil
+	})
+	return err
+}
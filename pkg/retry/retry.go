@@ -0,0 +1,145 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package retry retries requests against the Kubernetes API. Conflicts are retried for a number of steps, transient
+// errors of the API server (timeouts, failing webhooks, throttling and server errors) are retried with a jittered
+// backoff until a deadline, all other errors are returned right away.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// ReasonTimeout is a request that timed out on the API server or on the way to it
+	ReasonTimeout = "Timeout"
+	// ReasonWebhook is an admission webhook that timed out or could not be reached
+	ReasonWebhook = "WebhookFailed"
+	// ReasonThrottled is a request rejected by API priority and fairness
+	ReasonThrottled = "Throttled"
+	// ReasonServerError is any other 5xx response of the API server
+	ReasonServerError = "ServerError"
+	// ReasonConflict is an update based on an outdated resource version
+	ReasonConflict = "Conflict"
+)
+
+// DefaultConflictBackoff is the backoff of conflicts used by client-go
+var DefaultConflictBackoff = retry.DefaultBackoff
+
+// Classify returns the reason of a transient error of the API server, it returns false if the error is not caused by
+// the API server itself and retrying won't help. Conflicts are not transient in this sense, they are handled by Do.
+func Classify(err error) (string, bool) {
+	var netErr net.Error
+	switch {
+	// webhook failures are reported as internal errors, they are checked first to tell them apart
+	case apierrors.IsInternalError(err) && strings.Contains(err.Error(), "failed calling webhook"):
+		return ReasonWebhook, true
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		return ReasonTimeout, true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout, true
+	case apierrors.IsTooManyRequests(err):
+		return ReasonThrottled, true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return ReasonServerError, true
+	}
+	return "", false
+}
+
+// Error is returned when a request still failed with a transient error after the retries of the policy
+type Error struct {
+	// Policy is the name of the policy that gave up
+	Policy   string
+	Reason   string
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s API unhealthy (%s) after %d attempts: %s", e.Policy, e.Reason, e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Policy decides how the requests against an API server are retried
+type Policy struct {
+	// Name identifies the API server in errors, e.g. hub or hosted cluster
+	Name string
+	// Conflicts spaces the retries of conflicts, wait.ErrWaitTimeout is returned when its steps are exhausted. A
+	// zero backoff doesn't retry conflicts.
+	Conflicts wait.Backoff
+	// Transient spaces the retries of transient errors
+	Transient wait.Backoff
+	// Timeout caps the time transient errors are retried, an *Error is returned when it passed or the steps of
+	// Transient are exhausted
+	Timeout time.Duration
+	// OnRetry is called before every retry with the reason, the attempt that failed and the delay, e.g. to count
+	// retries in a metric
+	OnRetry func(reason string, attempt int, delay time.Duration, err error)
+}
+
+// Do calls fn until it succeeds or fails with an error the policy doesn't retry
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	conflicts, transient := p.Conflicts, p.Transient
+	deadline := time.Now().Add(p.Timeout)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var reason string
+		var delay time.Duration
+		if apierrors.IsConflict(err) {
+			if conflicts.Steps <= 1 {
+				if p.Conflicts.Steps == 0 {
+					return err
+				}
+				return wait.ErrWaitTimeout
+			}
+			reason, delay = ReasonConflict, conflicts.Step()
+		} else {
+			var ok bool
+			if reason, ok = Classify(err); !ok {
+				return err
+			}
+			delay = transient.Step()
+			if transient.Steps == 0 || time.Now().Add(delay).After(deadline) {
+				return &Error{Policy: p.Name, Reason: reason, Attempts: attempt, Err: err}
+			}
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(reason, attempt, delay, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// failing returns a function failing with err for the first failures calls
+func failing(err error, failures int) (func(context.Context) error, *int) {
+	calls := 0
+	return func(context.Context) error {
+		calls++
+		if calls <= failures {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+var _ = Describe("Retry", func() {
+	secretsResource := schema.GroupResource{Resource: "secrets"}
+	webhookErr := apierrors.NewInternalError(errors.New(`failed calling webhook "validate.example.com": context deadline exceeded`))
+	var policy Policy
+
+	BeforeEach(func() {
+		policy = Policy{
+			Name:      "test",
+			Conflicts: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+			Transient: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+			Timeout:   time.Second,
+		}
+	})
+
+	It("Should classify transient errors", func() {
+		for err, reason := range map[error]string{
+			webhookErr: ReasonWebhook,
+			apierrors.NewServerTimeout(secretsResource, "create", 1): ReasonTimeout,
+			apierrors.NewTimeoutError("request timed out", 1):        ReasonTimeout,
+			apierrors.NewTooManyRequests("slow down", 1):             ReasonThrottled,
+			apierrors.NewServiceUnavailable("unavailable"):           ReasonServerError,
+		} {
+			got, ok := Classify(err)
+			Expect(ok).To(BeTrue(), err.Error())
+			Expect(got).To(Equal(reason))
+		}
+		for _, err := range []error{
+			apierrors.NewForbidden(secretsResource, "hosted", errors.New("denied")),
+			apierrors.NewConflict(secretsResource, "hosted", errors.New("outdated")),
+		} {
+			_, ok := Classify(err)
+			Expect(ok).To(BeFalse(), err.Error())
+		}
+	})
+
+	It("Should retry transient errors and report the retries", func() {
+		reasons := []string{}
+		policy.OnRetry = func(reason string, attempt int, delay time.Duration, err error) {
+			reasons = append(reasons, reason)
+		}
+		fn, calls := failing(webhookErr, 2)
+		Expect(policy.Do(context.Background(), fn)).To(Succeed())
+		Expect(*calls).To(Equal(3))
+		Expect(reasons).To(Equal([]string{ReasonWebhook, ReasonWebhook}))
+	})
+
+	It("Should give up on persistent transient errors", func() {
+		fn, calls := failing(webhookErr, 10)
+		err := policy.Do(context.Background(), fn)
+		var retryErr *Error
+		Expect(errors.As(err, &retryErr)).To(BeTrue())
+		Expect(retryErr.Policy).To(Equal("test"))
+		Expect(retryErr.Reason).To(Equal(ReasonWebhook))
+		Expect(retryErr.Attempts).To(Equal(3))
+		Expect(*calls).To(Equal(3))
+		Expect(apierrors.IsInternalError(err)).To(BeTrue())
+	})
+
+	It("Should give up on transient errors after the timeout", func() {
+		policy.Transient = wait.Backoff{Duration: time.Second, Factor: 1, Steps: 10}
+		policy.Timeout = 100 * time.Millisecond
+		fn, calls := failing(apierrors.NewTooManyRequests("slow down", 1), 10)
+		var retryErr *Error
+		Expect(errors.As(policy.Do(context.Background(), fn), &retryErr)).To(BeTrue())
+		Expect(retryErr.Reason).To(Equal(ReasonThrottled))
+		Expect(*calls).To(Equal(1))
+	})
+
+	It("Should retry conflicts", func() {
+		conflict := apierrors.NewConflict(secretsResource, "hosted", errors.New("outdated"))
+		fn, calls := failing(conflict, 2)
+		Expect(policy.Do(context.Background(), fn)).To(Succeed())
+		Expect(*calls).To(Equal(3))
+
+		fn, _ = failing(conflict, 10)
+		Expect(policy.Do(context.Background(), fn)).To(MatchError(wait.ErrWaitTimeout))
+
+		policy.Conflicts = wait.Backoff{}
+		fn, calls = failing(conflict, 10)
+		Expect(apierrors.IsConflict(policy.Do(context.Background(), fn))).To(BeTrue())
+		Expect(*calls).To(Equal(1))
+	})
+
+	It("Should not retry other errors", func() {
+		fn, calls := failing(apierrors.NewBadRequest("invalid"), 10)
+		Expect(apierrors.IsBadRequest(policy.Do(context.Background(), fn))).To(BeTrue())
+		Expect(*calls).To(Equal(1))
+	})
+
+	It("Should stop retrying when the context is done", func() {
+		policy.Transient = wait.Backoff{Duration: time.Minute, Factor: 1, Steps: 10}
+		policy.Timeout = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		policy.OnRetry = func(string, int, time.Duration, error) { cancel() }
+		fn, _ := failing(webhookErr, 10)
+		Expect(policy.Do(ctx, fn)).To(MatchError(context.Canceled))
+	})
+})
@@ -0,0 +1,172 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+// SecretExpectation returns an error if the ArgoCD cluster secret or its parsed cluster does not meet the expectation
+type SecretExpectation func(secret *corev1.Secret, cluster *argocd.Cluster) error
+
+// GetClusterSecret returns the ArgoCD cluster secret of the key and the cluster parsed from it
+func GetClusterSecret(ctx context.Context, c client.Reader, key client.ObjectKey) (*corev1.Secret, *argocd.Cluster, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, key, secret); err != nil {
+		return nil, nil, err
+	}
+	cluster, err := argocd.ClusterFromSecretData(secret.Data)
+	if err != nil {
+		return secret, nil, fmt.Errorf("secret %s: %w", key, err)
+	}
+	return secret, cluster, nil
+}
+
+// CheckClusterSecret returns an error listing every expectation the secret does not meet. The secret must always be
+// labeled as an ArgoCD cluster secret and hold a valid cluster.
+func CheckClusterSecret(secret *corev1.Secret, expectations ...SecretExpectation) error {
+	if secret.Labels[argocd.SecretTypeLabel] != argocd.SecretTypeCluster {
+		return fmt.Errorf("secret %s is not labeled %s=%s", client.ObjectKeyFromObject(secret), argocd.SecretTypeLabel, argocd.SecretTypeCluster)
+	}
+	cluster, err := argocd.ClusterFromSecretData(secret.Data)
+	if err != nil {
+		return fmt.Errorf("secret %s: %w", client.ObjectKeyFromObject(secret), err)
+	}
+	var errs []error
+	for _, expect := range expectations {
+		if err := expect(secret, cluster); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return fmt.Errorf("secret %s: %w", client.ObjectKeyFromObject(secret), err)
+	}
+	return nil
+}
+
+// HasName expects the ArgoCD name of the cluster
+func HasName(name string) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if cluster.Name != name {
+			return fmt.Errorf("name is %q, expected %q", cluster.Name, name)
+		}
+		return nil
+	}
+}
+
+// HasServer expects the server URL of the cluster
+func HasServer(server string) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if cluster.Server != server {
+			return fmt.Errorf("server is %q, expected %q", cluster.Server, server)
+		}
+		return nil
+	}
+}
+
+// HasProject expects the AppProject the cluster is scoped to, none if empty
+func HasProject(project string) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if cluster.Project != project {
+			return fmt.Errorf("project is %q, expected %q", cluster.Project, project)
+		}
+		return nil
+	}
+}
+
+// HasNamespaces expects the namespaces the cluster is restricted to in order, an unrestricted cluster if none
+func HasNamespaces(namespaces ...string) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if len(namespaces) == 0 && len(cluster.Namespaces) == 0 {
+			return nil
+		}
+		if !reflect.DeepEqual(cluster.Namespaces, namespaces) {
+			return fmt.Errorf("namespaces are %v, expected %v", cluster.Namespaces, namespaces)
+		}
+		return nil
+	}
+}
+
+// HasClusterResources expects whether ArgoCD may manage cluster scoped resources of a namespace scoped cluster
+func HasClusterResources(clusterResources bool) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if cluster.ClusterResources != clusterResources {
+			return fmt.Errorf("clusterResources is %t, expected %t", cluster.ClusterResources, clusterResources)
+		}
+		return nil
+	}
+}
+
+// HasShard expects the application controller shard of the cluster, an unassigned shard if negative
+func HasShard(shard int64) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		switch {
+		case shard < 0 && cluster.Shard != nil:
+			return fmt.Errorf("shard is %d, expected none", *cluster.Shard)
+		case shard >= 0 && cluster.Shard == nil:
+			return fmt.Errorf("shard is unassigned, expected %d", shard)
+		case shard >= 0 && *cluster.Shard != shard:
+			return fmt.Errorf("shard is %d, expected %d", *cluster.Shard, shard)
+		}
+		return nil
+	}
+}
+
+// HasLabel expects the label on the secret
+func HasLabel(key, value string) SecretExpectation {
+	return func(secret *corev1.Secret, _ *argocd.Cluster) error {
+		if v, ok := secret.Labels[key]; !ok || v != value {
+			return fmt.Errorf("label %s is %q, expected %q", key, v, value)
+		}
+		return nil
+	}
+}
+
+// HasAnnotation expects the annotation on the secret
+func HasAnnotation(key, value string) SecretExpectation {
+	return func(secret *corev1.Secret, _ *argocd.Cluster) error {
+		if v, ok := secret.Annotations[key]; !ok || v != value {
+			return fmt.Errorf("annotation %s is %q, expected %q", key, v, value)
+		}
+		return nil
+	}
+}
+
+// AuthenticatesAgainst expects the bearer token of the cluster to authenticate against the API server of the hosted
+// cluster and the CA bundle of the hosted cluster
+func AuthenticatesAgainst(h *HostedCluster) SecretExpectation {
+	return func(_ *corev1.Secret, cluster *argocd.Cluster) error {
+		if cluster.Config.BearerToken == "" {
+			return fmt.Errorf("config has no bearer token")
+		}
+		if err := h.VerifyToken(context.Background(), cluster.Config.BearerToken); err != nil {
+			return fmt.Errorf("bearer token does not authenticate: %w", err)
+		}
+		if string(cluster.Config.TLSClientConfig.CAData) != string(h.CAData) {
+			return fmt.Errorf("CA bundle does not match the hosted cluster")
+		}
+		return nil
+	}
+}
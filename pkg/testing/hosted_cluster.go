@@ -0,0 +1,326 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testing provides an in-memory hosted cluster and assertions on ArgoCD cluster secrets, so registrations can
+// be tested against realistic hosted cluster behavior without envtest.
+package testing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	// DefaultServer is the API server URL of a HostedCluster
+	DefaultServer = "https://api.hosted.example.com:6443"
+	// DefaultCAData is the CA bundle of a HostedCluster
+	DefaultCAData = "hosted-ca"
+)
+
+// HostedCluster is an in-memory hosted cluster. Its client and clientset share the objects of the cluster and mimic
+// the behavior hyper-ops relies on which the controller-runtime fake client lacks:
+//   - service account token secrets are populated with a token, the CA bundle and the namespace on create
+//   - TokenRequests of existing service accounts issue bound tokens
+//   - SelfSubjectAccessReviews are allowed and TokenReviews authenticate the tokens issued by the cluster
+//   - tokens are revoked with their service account, legacy tokens also with their secret
+type HostedCluster struct {
+	// Client is the controller-runtime client of the hosted cluster
+	Client client.Client
+	// Clientset serves TokenRequests and TokenReviews of the hosted cluster
+	Clientset *kubefake.Clientset
+	// Server is the API server URL of the hosted cluster
+	Server string
+	// CAData is the CA bundle written to service account token secrets
+	CAData []byte
+	// Now returns the current time of the hosted cluster, time.Now if nil
+	Now func() time.Time
+	// Fail returns the error of a request to the hosted cluster, the request is served if it returns nil. The verb is
+	// one of get, list, create, update, patch, delete or token for TokenRequests.
+	Fail func(verb string, obj client.Object) error
+
+	objects client.WithWatch
+	mu      sync.Mutex
+	issued  int
+	tokens  map[string]Token
+}
+
+// Token is a token issued by a HostedCluster
+type Token struct {
+	// ServiceAccount is the service account the token was issued for
+	ServiceAccount client.ObjectKey
+	// Secret is the service account token secret holding a legacy token, empty for bound tokens
+	Secret string
+	// Audiences are the audiences of a bound token, the API server if empty
+	Audiences []string
+	// ExpiresAt is the expiration of a bound token, zero for legacy tokens
+	ExpiresAt time.Time
+}
+
+// NewHostedCluster returns a HostedCluster with the objects
+func NewHostedCluster(objs ...client.Object) *HostedCluster {
+	h := &HostedCluster{
+		Server:    DefaultServer,
+		CAData:    []byte(DefaultCAData),
+		Clientset: kubefake.NewSimpleClientset(),
+		objects:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objs...).Build(),
+		tokens:    map[string]Token{},
+	}
+	h.Client = &hostedClient{WithWatch: h.objects, cluster: h}
+	h.Clientset.PrependReactor("create", "serviceaccounts", h.tokenRequestReactor)
+	h.Clientset.PrependReactor("create", "tokenreviews", h.tokenReviewReactor)
+	return h
+}
+
+func (h *HostedCluster) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+func (h *HostedCluster) fail(verb string, obj client.Object) error {
+	if h.Fail == nil {
+		return nil
+	}
+	return h.Fail(verb, obj)
+}
+
+// issue records a new token of the service account
+func (h *HostedCluster) issue(token Token) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.issued++
+	value := fmt.Sprintf("hosted-token-%d", h.issued)
+	h.tokens[value] = token
+	return value
+}
+
+// Tokens returns the tokens issued by the hosted cluster, including revoked ones
+func (h *HostedCluster) Tokens() map[string]Token {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	tokens := make(map[string]Token, len(h.tokens))
+	for value, token := range h.tokens {
+		tokens[value] = token
+	}
+	return tokens
+}
+
+// Authenticate returns the token if it was issued by the hosted cluster for the audience and is still valid, an
+// Unauthorized error otherwise. An empty audience is the API server.
+func (h *HostedCluster) Authenticate(ctx context.Context, value, audience string) (Token, error) {
+	h.mu.Lock()
+	token, ok := h.tokens[value]
+	h.mu.Unlock()
+	unauthorized := apierrors.NewUnauthorized("invalid bearer token")
+	if !ok {
+		return Token{}, unauthorized
+	}
+	if !token.ExpiresAt.IsZero() && !h.now().Before(token.ExpiresAt) {
+		return Token{}, apierrors.NewUnauthorized("token has expired")
+	}
+	if !audienceAllowed(token.Audiences, audience) {
+		return Token{}, apierrors.NewUnauthorized("token audiences are invalid")
+	}
+	if err := h.objects.Get(ctx, token.ServiceAccount, &corev1.ServiceAccount{}); err != nil {
+		return Token{}, unauthorized
+	}
+	if token.Secret != "" {
+		if err := h.objects.Get(ctx, client.ObjectKey{Namespace: token.ServiceAccount.Namespace, Name: token.Secret}, &corev1.Secret{}); err != nil {
+			return Token{}, unauthorized
+		}
+	}
+	return token, nil
+}
+
+// VerifyToken returns an error if the token does not authenticate against the API server of the hosted cluster
+func (h *HostedCluster) VerifyToken(ctx context.Context, value string) error {
+	_, err := h.Authenticate(ctx, value, "")
+	return err
+}
+
+// ReviewToken returns an error if the token does not authenticate for the audience
+func (h *HostedCluster) ReviewToken(ctx context.Context, value, audience string) error {
+	_, err := h.Authenticate(ctx, value, audience)
+	return err
+}
+
+func audienceAllowed(audiences []string, audience string) bool {
+	if len(audiences) == 0 || audience == "" {
+		return len(audiences) == 0 && audience == ""
+	}
+	for _, a := range audiences {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenRequestReactor issues bound tokens for existing service accounts
+func (h *HostedCluster) tokenRequestReactor(action k8stesting.Action) (bool, runtime.Object, error) {
+	create, ok := action.(k8stesting.CreateActionImpl)
+	if !ok || action.GetSubresource() != "token" {
+		return false, nil, nil
+	}
+	tr, ok := create.GetObject().(*authenticationv1.TokenRequest)
+	if !ok {
+		return true, nil, fmt.Errorf("unexpected token request %T", create.GetObject())
+	}
+	key := client.ObjectKey{Namespace: action.GetNamespace(), Name: create.Name}
+	sa := &corev1.ServiceAccount{}
+	if err := h.fail("token", tr); err != nil {
+		return true, nil, err
+	}
+	if err := h.objects.Get(context.Background(), key, sa); err != nil {
+		return true, nil, err
+	}
+	ttl := time.Hour
+	if tr.Spec.ExpirationSeconds != nil {
+		ttl = time.Duration(*tr.Spec.ExpirationSeconds) * time.Second
+	}
+	token := Token{ServiceAccount: key, Audiences: tr.Spec.Audiences, ExpiresAt: h.now().Add(ttl).Truncate(time.Second)}
+	issued := tr.DeepCopy()
+	issued.Status = authenticationv1.TokenRequestStatus{Token: h.issue(token), ExpirationTimestamp: metav1.NewTime(token.ExpiresAt)}
+	return true, issued, nil
+}
+
+// tokenReviewReactor authenticates the tokens issued by the hosted cluster
+func (h *HostedCluster) tokenReviewReactor(action k8stesting.Action) (bool, runtime.Object, error) {
+	create, ok := action.(k8stesting.CreateAction)
+	if !ok {
+		return false, nil, nil
+	}
+	review, ok := create.GetObject().(*authenticationv1.TokenReview)
+	if !ok {
+		return true, nil, fmt.Errorf("unexpected token review %T", create.GetObject())
+	}
+	reviewed := review.DeepCopy()
+	reviewed.Status = h.review(review.Spec)
+	return true, reviewed, nil
+}
+
+func (h *HostedCluster) review(spec authenticationv1.TokenReviewSpec) authenticationv1.TokenReviewStatus {
+	audience := ""
+	if len(spec.Audiences) > 0 {
+		audience = spec.Audiences[0]
+	}
+	token, err := h.Authenticate(context.Background(), spec.Token, audience)
+	if err != nil {
+		return authenticationv1.TokenReviewStatus{Error: err.Error()}
+	}
+	return authenticationv1.TokenReviewStatus{
+		Authenticated: true,
+		Audiences:     spec.Audiences,
+		User: authenticationv1.UserInfo{
+			Username: fmt.Sprintf("system:serviceaccount:%s:%s", token.ServiceAccount.Namespace, token.ServiceAccount.Name),
+		},
+	}
+}
+
+// hostedClient is the controller-runtime client of a HostedCluster
+type hostedClient struct {
+	client.WithWatch
+	cluster *HostedCluster
+}
+
+func (c *hostedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.cluster.fail("get", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Get(ctx, key, obj, opts...)
+}
+
+func (c *hostedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.cluster.fail("list", nil); err != nil {
+		return err
+	}
+	return c.WithWatch.List(ctx, list, opts...)
+}
+
+func (c *hostedClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.cluster.fail("create", obj); err != nil {
+		return err
+	}
+	switch o := obj.(type) {
+	case *authorizationv1.SelfSubjectAccessReview:
+		// the reviews of the fake client are not authenticated, every review is allowed
+		o.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: true}
+		return nil
+	case *authenticationv1.TokenReview:
+		o.Status = c.cluster.review(o.Spec)
+		return nil
+	case *corev1.Secret:
+		if o.Type == corev1.SecretTypeServiceAccountToken {
+			if err := c.populateToken(ctx, o); err != nil {
+				return err
+			}
+		}
+	}
+	return c.WithWatch.Create(ctx, obj, opts...)
+}
+
+// populateToken populates a service account token secret like the token controller of the API server, secrets of
+// missing service accounts stay empty
+func (c *hostedClient) populateToken(ctx context.Context, secret *corev1.Secret) error {
+	name := secret.Annotations[corev1.ServiceAccountNameKey]
+	key := client.ObjectKey{Namespace: secret.Namespace, Name: name}
+	if err := c.WithWatch.Get(ctx, key, &corev1.ServiceAccount{}); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.ServiceAccountTokenKey] = []byte(c.cluster.issue(Token{ServiceAccount: key, Secret: secret.Name}))
+	secret.Data[corev1.ServiceAccountRootCAKey] = c.cluster.CAData
+	secret.Data[corev1.ServiceAccountNamespaceKey] = []byte(secret.Namespace)
+	return nil
+}
+
+func (c *hostedClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := c.cluster.fail("update", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Update(ctx, obj, opts...)
+}
+
+func (c *hostedClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := c.cluster.fail("patch", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *hostedClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.cluster.fail("delete", obj); err != nil {
+		return err
+	}
+	return c.WithWatch.Delete(ctx, obj, opts...)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cldmnky/hyper-ops/pkg/argocd"
+)
+
+var _ = Describe("HostedCluster", func() {
+	var (
+		ctx = context.Background()
+		sa  *corev1.ServiceAccount
+		now time.Time
+	)
+
+	requestToken := func(h *HostedCluster, audiences ...string) (*authenticationv1.TokenRequest, error) {
+		expirationSeconds := int64(3600)
+		return h.Clientset.CoreV1().ServiceAccounts("kube-system").CreateToken(ctx, "hyper-ops-admin",
+			&authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds, Audiences: audiences}}, metav1.CreateOptions{})
+	}
+
+	BeforeEach(func() {
+		now = time.Now()
+		sa = &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-admin", Namespace: "kube-system"}}
+	})
+
+	It("Should populate service account token secrets", func() {
+		h := NewHostedCluster(sa)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hyper-ops-admin-token",
+				Namespace:   "kube-system",
+				Annotations: map[string]string{corev1.ServiceAccountNameKey: "hyper-ops-admin"},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+		}
+		Expect(h.Client.Create(ctx, secret)).To(Succeed())
+		Expect(h.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKeyWithValue(corev1.ServiceAccountRootCAKey, []byte(DefaultCAData)))
+		token := string(secret.Data[corev1.ServiceAccountTokenKey])
+		Expect(h.VerifyToken(ctx, token)).To(Succeed())
+
+		By("revoking the token with its secret")
+		Expect(h.Client.Delete(ctx, secret)).To(Succeed())
+		Expect(apierrors.IsUnauthorized(h.VerifyToken(ctx, token))).To(BeTrue())
+	})
+
+	It("Should leave the token secrets of missing service accounts empty", func() {
+		h := NewHostedCluster()
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hyper-ops-admin-token",
+				Namespace:   "kube-system",
+				Annotations: map[string]string{corev1.ServiceAccountNameKey: "hyper-ops-admin"},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+		}
+		Expect(h.Client.Create(ctx, secret)).To(Succeed())
+		Expect(secret.Data).To(BeEmpty())
+	})
+
+	It("Should issue bound tokens until they expire or the service account is deleted", func() {
+		h := NewHostedCluster(sa)
+		h.Now = func() time.Time { return now }
+		tr, err := requestToken(h)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tr.Status.ExpirationTimestamp.Time).To(BeTemporally("~", now.Add(time.Hour), time.Second))
+		Expect(h.VerifyToken(ctx, tr.Status.Token)).To(Succeed())
+		Expect(h.Tokens()).To(HaveKeyWithValue(tr.Status.Token, HaveField("ServiceAccount", client.ObjectKeyFromObject(sa))))
+
+		now = now.Add(2 * time.Hour)
+		Expect(apierrors.IsUnauthorized(h.VerifyToken(ctx, tr.Status.Token))).To(BeTrue())
+
+		now = time.Now()
+		tr, err = requestToken(h)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.Client.Delete(ctx, sa)).To(Succeed())
+		Expect(apierrors.IsUnauthorized(h.VerifyToken(ctx, tr.Status.Token))).To(BeTrue())
+
+		_, err = requestToken(h)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("Should only authenticate audience tokens for their audience", func() {
+		h := NewHostedCluster(sa)
+		tr, err := requestToken(h, "vault")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.VerifyToken(ctx, tr.Status.Token)).NotTo(Succeed())
+		Expect(h.ReviewToken(ctx, tr.Status.Token, "vault")).To(Succeed())
+
+		review, err := h.Clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: tr.Status.Token, Audiences: []string{"vault"}},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(review.Status.Authenticated).To(BeTrue())
+		Expect(review.Status.User.Username).To(Equal("system:serviceaccount:kube-system:hyper-ops-admin"))
+	})
+
+	It("Should allow access reviews and fail requests on demand", func() {
+		h := NewHostedCluster(sa)
+		review := &authorizationv1.SelfSubjectAccessReview{}
+		Expect(h.Client.Create(ctx, review)).To(Succeed())
+		Expect(review.Status.Allowed).To(BeTrue())
+
+		h.Fail = func(verb string, obj client.Object) error {
+			if verb == "token" {
+				return errors.New("unavailable")
+			}
+			return nil
+		}
+		_, err := requestToken(h)
+		Expect(err).To(MatchError("unavailable"))
+		Expect(h.Client.Get(ctx, client.ObjectKeyFromObject(sa), &corev1.ServiceAccount{})).To(Succeed())
+	})
+})
+
+var _ = Describe("ArgoCD cluster secret assertions", func() {
+	newSecret := func(cluster *argocd.Cluster) *corev1.Secret {
+		data, err := cluster.SecretData()
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hosted",
+				Namespace: "openshift-gitops",
+				Labels:    map[string]string{argocd.SecretTypeLabel: argocd.SecretTypeCluster, "env": "prod"},
+			},
+			Data: data,
+		}
+	}
+
+	It("Should check the cluster secret", func() {
+		h := NewHostedCluster(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "hyper-ops-admin", Namespace: "kube-system"}})
+		expirationSeconds := int64(3600)
+		tr, err := h.Clientset.CoreV1().ServiceAccounts("kube-system").CreateToken(context.Background(), "hyper-ops-admin",
+			&authenticationv1.TokenRequest{Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &expirationSeconds}}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		secret := newSecret(&argocd.Cluster{
+			Name:       "hosted",
+			Server:     h.Server,
+			Namespaces: []string{"team-a"},
+			Config: argocd.ClusterConfig{
+				BearerToken:     tr.Status.Token,
+				TLSClientConfig: argocd.TLSClientConfig{CAData: h.CAData},
+			},
+		})
+		Expect(CheckClusterSecret(secret, HasName("hosted"), HasServer(DefaultServer), HasNamespaces("team-a"),
+			HasClusterResources(false), HasShard(-1), HasLabel("env", "prod"), HasProject(""), AuthenticatesAgainst(h))).To(Succeed())
+	})
+
+	It("Should report every unmet expectation", func() {
+		secret := newSecret(&argocd.Cluster{Name: "hosted", Server: "https://other:6443"})
+		err := CheckClusterSecret(secret, HasServer(DefaultServer), HasShard(1), HasNamespaces("team-a"), HasAnnotation("owner", "team-a"),
+			AuthenticatesAgainst(NewHostedCluster()))
+		Expect(err).To(MatchError(ContainSubstring("server is")))
+		Expect(err).To(MatchError(ContainSubstring("namespaces are")))
+		Expect(err).To(MatchError(ContainSubstring("shard is unassigned")))
+		Expect(err).To(MatchError(ContainSubstring("annotation owner")))
+		Expect(err).To(MatchError(ContainSubstring("no bearer token")))
+
+		delete(secret.Labels, argocd.SecretTypeLabel)
+		Expect(CheckClusterSecret(secret)).To(MatchError(ContainSubstring("is not labeled")))
+	})
+})